@@ -17,6 +17,7 @@ export interface CryptoPaymentResponse {
   success: boolean;
   paymentId?: string;
   address?: string;
+  memo?: string; // XRP、Stellar、TON 付款时必须填写的 Destination Tag / Memo / 转账注释
   amount?: number;
   qrCode?: string;
   expiredAt?: Date;
@@ -30,6 +31,8 @@ export interface CryptoQueryResponse {
   confirmations?: number;
   paidAt?: Date;
   actualAmount?: number;
+  txUrl?: string; // 入账交易在区块浏览器中的链接
+  addressUrl?: string; // 收款地址在区块浏览器中的链接
   message?: string;
 }
 
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+const maxExportRows = 10000
+
+// registerAdminRoutes 注册管理端接口
+func registerAdminRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	// 支付列表，q 参数为过滤表达式
+	admin.GET("/payments", func(c *gin.Context) {
+		page, err := apierr.ParsePageParams(c)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		records, err := ps.SearchPayments(c.Query("q"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+			return
+		}
+
+		start, end := apierr.Paginate(len(records), page)
+		apierr.RespondPage(c, records[start:end], page, len(records))
+	})
+
+	// 租户策略配置
+	admin.GET("/tenants/:tenantId/settings", func(c *gin.Context) {
+		apierr.RespondOK(c, ps.tenants.Get(c.Param("tenantId")))
+	})
+
+	admin.PUT("/tenants/:tenantId/settings", func(c *gin.Context) {
+		var settings TenantSettings
+		if err := c.ShouldBindJSON(&settings); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		settings.TenantID = c.Param("tenantId")
+
+		if err := ps.tenants.Put(&settings); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, settings)
+	})
+
+	// 按过滤表达式导出 CSV
+	admin.GET("/payments/export", func(c *gin.Context) {
+		records, err := ps.SearchPayments(c.Query("q"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+			return
+		}
+		if len(records) > maxExportRows {
+			apierr.RespondError(c, http.StatusBadRequest, "EXPORT_TOO_LARGE",
+				fmt.Sprintf("匹配记录 %d 条，超过单次导出上限 %d 条，请缩小过滤范围", len(records), maxExportRows))
+			return
+		}
+
+		content, err := paymentsCSV(records)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		filename := fmt.Sprintf("payments-%s.csv", time.Now().Format("20060102150405"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+	})
+}
+
+// SearchPayments 解析过滤表达式并检索支付记录
+func (ps *PaymentService) SearchPayments(query string) ([]*PaymentRecord, error) {
+	filter, err := ParseFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	return ps.store.Find(filter)
+}
+
+func paymentsCSV(records []*PaymentRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	// 写入 BOM，便于 Excel 正确识别中文
+	buf.WriteString("\xEF\xBB\xBF")
+
+	w := csv.NewWriter(&buf)
+	header := []string{"paymentId", "orderId", "method", "amount", "currency", "status", "providerTradeNo", "createdAt", "updatedAt"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		row := []string{
+			csvSafe(r.PaymentID),
+			csvSafe(r.OrderID),
+			r.Method,
+			strconv.FormatFloat(r.Amount, 'f', 2, 64),
+			r.Currency,
+			r.Status,
+			csvSafe(r.ProviderTradeNo),
+			r.CreatedAt.Format(time.RFC3339),
+			r.UpdatedAt.Format(time.RFC3339),
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvSafe 防止以公式字符开头的单元格在表格软件中被执行
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
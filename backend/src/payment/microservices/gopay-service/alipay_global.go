@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pay/gopay"
+)
+
+// 支付宝跨境收单：订单以外币标价（trans_currency），境外用户按支付宝报价支付，商户按 ALIPAY_SETTLE_CURRENCY（默认 CNY）结算。
+// 需在 ALIPAY_CURRENCIES 中加入允许的标价币种才会放行，如 ALIPAY_CURRENCIES=CNY,USD,EUR；订单币种为人民币时仍走境内收单
+
+// ForexInfo 跨境支付的币种和汇率。下单时记录标价与结算币种，支付完成时写入支付宝返回的汇率和结算金额，供对账和审计
+type ForexInfo struct {
+	TransCurrency  string     `json:"transCurrency"` // 标价币种，即订单币种
+	TransAmount    float64    `json:"transAmount"`
+	SettleCurrency string     `json:"settleCurrency"`
+	SettleAmount   float64    `json:"settleAmount,omitempty"`
+	SettleRate     float64    `json:"settleRate,omitempty"`  // 1 单位标价币种折合的结算币种
+	PayCurrency    string     `json:"payCurrency,omitempty"` // 用户实际支付的币种
+	PayAmount      float64    `json:"payAmount,omitempty"`
+	PayRate        float64    `json:"payRate,omitempty"` // 1 单位标价币种折合的支付币种
+	CapturedAt     *time.Time `json:"capturedAt,omitempty"`
+}
+
+func alipaySettleCurrency() string {
+	return strings.ToUpper(envString("ALIPAY_SETTLE_CURRENCY", "CNY"))
+}
+
+// isAlipayCrossBorder 订单币种不是人民币时走跨境收单，未指定币种按默认币种判断
+func isAlipayCrossBorder(currency string) bool {
+	if currency == "" {
+		currency = defaultCurrency()
+	}
+	return currency != "CNY"
+}
+
+// setAlipayForexParams 设置跨境订单的标价和结算币种，total_amount 按标价币种的小数位数传递，如日元没有小数
+func setAlipayForexParams(bm gopay.BodyMap, currency string) {
+	if currency == "" {
+		currency = defaultCurrency()
+	}
+	bm.Set("trans_currency", currency)
+	bm.Set("settle_currency", alipaySettleCurrency())
+}
+
+func newForexInfo(currency string, amount float64) *ForexInfo {
+	if currency == "" {
+		currency = defaultCurrency()
+	}
+	return &ForexInfo{
+		TransCurrency:  currency,
+		TransAmount:    amount,
+		SettleCurrency: alipaySettleCurrency(),
+	}
+}
+
+// alipayForexFields 支付宝异步通知和交易查询中的汇率字段，均为字符串
+type alipayForexFields struct {
+	SettleCurrency  string
+	SettleAmount    string
+	SettleTransRate string
+	PayCurrency     string
+	PayAmount       string
+	TransPayRate    string
+}
+
+func alipayForexFromNotify(bm gopay.BodyMap) alipayForexFields {
+	return alipayForexFields{
+		SettleCurrency:  bm.GetString("settle_currency"),
+		SettleAmount:    bm.GetString("settle_amount"),
+		SettleTransRate: bm.GetString("settle_trans_rate"),
+		PayCurrency:     bm.GetString("pay_currency"),
+		PayAmount:       bm.GetString("pay_amount"),
+		TransPayRate:    bm.GetString("trans_pay_rate"),
+	}
+}
+
+// captureAlipayForex 支付完成时记录实际汇率，非跨境支付或已记录过的不处理。调用方负责保存记录
+func captureAlipayForex(record *PaymentRecord, fields alipayForexFields) {
+	fx := record.Forex
+	if fx == nil || fx.CapturedAt != nil {
+		return
+	}
+	if fields.SettleCurrency != "" && fields.SettleCurrency != fx.SettleCurrency {
+		log.Printf("【跨境】支付 %s 结算币种为 %s，与下单时的 %s 不一致", record.PaymentID, fields.SettleCurrency, fx.SettleCurrency)
+		fx.SettleCurrency = fields.SettleCurrency
+	}
+	fx.SettleAmount = parseAlipayDecimal(fields.SettleAmount)
+	fx.SettleRate = parseAlipayDecimal(fields.SettleTransRate)
+	fx.PayCurrency = fields.PayCurrency
+	fx.PayAmount = parseAlipayDecimal(fields.PayAmount)
+	fx.PayRate = parseAlipayDecimal(fields.TransPayRate)
+	now := time.Now()
+	fx.CapturedAt = &now
+}
+
+// parseAlipayDecimal 解析支付宝返回的金额和汇率，缺失或格式错误时为 0
+func parseAlipayDecimal(raw string) float64 {
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
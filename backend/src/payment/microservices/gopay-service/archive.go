@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+var ErrArchiveDisabled = errors.New("未配置 ARCHIVE_UPLOAD_URL，归档未启用")
+
+// ArchiveRun 一次归档的结果
+type ArchiveRun struct {
+	RunID      string    `json:"runId"`
+	Cutoff     time.Time `json:"cutoff"` // 早于该时间创建的记录被归档
+	Payments   int       `json:"payments"`
+	Refunds    int       `json:"refunds"`
+	UploadedTo []string  `json:"uploadedTo,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// PaymentArchiver 把超过保留期的已完结支付及其退款导出为 CSV 上传到冷存储，上传成功后从在线存储删除。
+// 归档文件只包含对账所需字段，不含用户编号、元数据、购方信息等个人信息
+type PaymentArchiver struct {
+	payments  *PaymentService
+	uploader  Uploader
+	retention time.Duration
+	batch     int
+	interval  time.Duration
+
+	mu   sync.Mutex // 同一时间只运行一次归档
+	runs []*ArchiveRun
+}
+
+// NewPaymentArchiver 读取 ARCHIVE_UPLOAD_URL（s3://bucket/prefix 或 sftp://），未配置时不归档
+func NewPaymentArchiver(payments *PaymentService) *PaymentArchiver {
+	pa := &PaymentArchiver{
+		payments:  payments,
+		retention: time.Duration(envInt("ARCHIVE_RETENTION_DAYS", 365)) * 24 * time.Hour,
+		batch:     envInt("ARCHIVE_BATCH_SIZE", 5000),
+		interval:  envDuration("ARCHIVE_INTERVAL", 24*time.Hour),
+	}
+	if target := os.Getenv("ARCHIVE_UPLOAD_URL"); target != "" {
+		uploader, err := NewUploader(target)
+		if err != nil {
+			log.Printf("归档上传配置无效，归档未启用: %v", err)
+		} else {
+			pa.uploader = uploader
+		}
+	}
+	return pa
+}
+
+// Run 定时归档，每次最多处理 ARCHIVE_BATCH_SIZE 笔支付
+func (pa *PaymentArchiver) Run(ctx context.Context) {
+	if pa.uploader == nil {
+		return
+	}
+	ticker := time.NewTicker(pa.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := pa.Archive(ctx); err != nil {
+				log.Printf("归档支付记录失败: %v", err)
+			}
+		}
+	}
+}
+
+func archivable(record *PaymentRecord) bool {
+	switch record.Status {
+	case StatusPending, StatusAuthorized, StatusScheduled:
+		return false
+	}
+	return true
+}
+
+// Archive 执行一次归档。先上传支付和退款两个文件，全部成功后才删除在线记录
+func (pa *PaymentArchiver) Archive(ctx context.Context) (*ArchiveRun, error) {
+	if pa.uploader == nil {
+		return nil, ErrArchiveDisabled
+	}
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	run := &ArchiveRun{StartedAt: time.Now(), Cutoff: time.Now().Add(-pa.retention)}
+	// 编号精确到微秒，手动触发的多次归档不会覆盖同名文件
+	run.RunID = "archive-" + run.StartedAt.Format("20060102-150405.000000")
+	err := pa.archive(ctx, run)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now()
+	pa.runs = append(pa.runs, run)
+	return run, err
+}
+
+func (pa *PaymentArchiver) archive(ctx context.Context, run *ArchiveRun) error {
+	records, err := pa.payments.store.List()
+	if err != nil {
+		return err
+	}
+
+	var payments []*PaymentRecord
+	var refunds []*RefundRecord
+	// List 按创建时间倒序，从最旧的开始取
+	for i := len(records) - 1; i >= 0 && len(payments) < pa.batch; i-- {
+		record := records[i]
+		if !record.CreatedAt.Before(run.Cutoff) {
+			break
+		}
+		if !archivable(record) {
+			continue
+		}
+		list, err := pa.payments.refunds.ListByPayment(record.PaymentID)
+		if err != nil {
+			return err
+		}
+		pending := false
+		for _, refund := range list {
+			pending = pending || refund.Status == RefundPending || refund.Status == RefundAwaitingApproval
+		}
+		if pending {
+			continue
+		}
+		payments = append(payments, record)
+		refunds = append(refunds, list...)
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+
+	paymentsContent, err := archivedPaymentsCSV(payments)
+	if err != nil {
+		return err
+	}
+	location, err := pa.uploader.Upload(ctx, run.RunID+"-payments.csv", paymentsContent, "text/csv; charset=utf-8")
+	if err != nil {
+		return fmt.Errorf("上传支付归档失败: %w", err)
+	}
+	run.UploadedTo = append(run.UploadedTo, location)
+
+	refundsContent, err := archivedRefundsCSV(refunds)
+	if err != nil {
+		return err
+	}
+	location, err = pa.uploader.Upload(ctx, run.RunID+"-refunds.csv", refundsContent, "text/csv; charset=utf-8")
+	if err != nil {
+		return fmt.Errorf("上传退款归档失败: %w", err)
+	}
+	run.UploadedTo = append(run.UploadedTo, location)
+
+	for _, refund := range refunds {
+		if err := pa.payments.refunds.Delete(refund.RefundID); err != nil {
+			return err
+		}
+		run.Refunds++
+	}
+	for _, record := range payments {
+		if err := pa.payments.store.Delete(record.PaymentID); err != nil {
+			return err
+		}
+		run.Payments++
+	}
+	log.Printf("归档 %s 完成：%d 笔支付、%d 笔退款", run.RunID, run.Payments, run.Refunds)
+	return nil
+}
+
+// Runs 返回最近的归档记录，最新的在前
+func (pa *PaymentArchiver) Runs() []*ArchiveRun {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	runs := make([]*ArchiveRun, 0, len(pa.runs))
+	for i := len(pa.runs) - 1; i >= 0; i-- {
+		runs = append(runs, pa.runs[i])
+	}
+	return runs
+}
+
+func archivedPaymentsCSV(records []*PaymentRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"paymentId", "orderId", "tenantId", "method", "channel", "purpose", "amount", "capturedAmount", "refundedAmount",
+		"currency", "fee", "feeRefunded", "status", "outTradeNo", "providerTradeNo", "parentPaymentId", "invoiceNo", "createdAt", "updatedAt"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, r := range records {
+		var invoiceNo string
+		if r.Invoice != nil {
+			invoiceNo = r.Invoice.InvoiceNo
+		}
+		row := []string{
+			csvSafe(r.PaymentID),
+			csvSafe(r.OrderID),
+			csvSafe(r.TenantID),
+			r.Method,
+			r.Channel,
+			r.Purpose,
+			money(r.Amount),
+			money(r.CapturedAmount),
+			money(r.RefundedAmount),
+			r.Currency,
+			money(r.Fee),
+			money(r.FeeRefunded),
+			r.Status,
+			csvSafe(r.OutTradeNo),
+			csvSafe(r.ProviderTradeNo),
+			csvSafe(r.ParentPaymentID),
+			csvSafe(invoiceNo),
+			r.CreatedAt.Format(time.RFC3339),
+			r.UpdatedAt.Format(time.RFC3339),
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func archivedRefundsCSV(refunds []*RefundRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"refundId", "paymentId", "tenantId", "method", "amount", "currency", "destination", "status",
+		"providerRefundNo", "feeReturned", "createdAt", "updatedAt"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, r := range refunds {
+		row := []string{
+			csvSafe(r.RefundID),
+			csvSafe(r.PaymentID),
+			csvSafe(r.TenantID),
+			r.Method,
+			money(r.Amount),
+			r.Currency,
+			r.Destination,
+			r.Status,
+			csvSafe(r.ProviderRefundNo),
+			money(r.FeeReturned),
+			r.CreatedAt.Format(time.RFC3339),
+			r.UpdatedAt.Format(time.RFC3339),
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// registerArchiveRoutes 注册归档查询和手动触发接口
+func registerArchiveRoutes(api *gin.RouterGroup, pa *PaymentArchiver) {
+	admin := api.Group("/admin")
+
+	admin.GET("/archive/runs", func(c *gin.Context) {
+		apierr.RespondOK(c, pa.Runs())
+	})
+
+	admin.POST("/archive/run", func(c *gin.Context) {
+		run, err := pa.Archive(c.Request.Context())
+		if errors.Is(err, ErrArchiveDisabled) {
+			apierr.RespondError(c, http.StatusConflict, "ARCHIVE_DISABLED", err.Error())
+			return
+		}
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadGateway, "ARCHIVE_FAILED", err.Error())
+			return
+		}
+		apierr.RespondOK(c, run)
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 异步下单任务状态
+const (
+	AsyncCreateQueued     = "queued"
+	AsyncCreateProcessing = "processing"
+	AsyncCreateSucceeded  = "succeeded"
+	AsyncCreateFailed     = "failed"
+)
+
+// AsyncCreation 异步下单任务，支付编号即订单号，受理时即可返回
+type AsyncCreation struct {
+	PaymentID string       `json:"paymentId"`
+	Status    string       `json:"status"`
+	Payment   *PaymentData `json:"payment,omitempty"` // 成功后的跳转地址、二维码等
+	Code      string       `json:"code,omitempty"`    // 失败时的业务错误码
+	Message   string       `json:"message,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+
+	tenantID string
+}
+
+// AsyncCreator 异步下单：请求入队后立即返回 202，由 async_create 队列的 worker 调用渠道，
+// 渠道响应慢时削平下单接口的延迟尖峰。完成后推送 payment.created 或 payment.create_failed，
+// 调用方也可轮询 GET /payment/async/:paymentId。队列只在进程内，重启时未处理的任务丢失，
+// 调用方应以事件或轮询超时为准重新提交
+type AsyncCreator struct {
+	payments  *PaymentService
+	queue     *JobQueue
+	retention time.Duration
+
+	mu    sync.RWMutex
+	tasks map[string]*AsyncCreation
+}
+
+func NewAsyncCreator(payments *PaymentService) *AsyncCreator {
+	ac := &AsyncCreator{
+		payments: payments,
+		// 下单不保证幂等，失败不重试，由调用方根据结果重新提交
+		queue: payments.jobs.Queue("async_create", JobQueueConfig{
+			Workers:     8,
+			Capacity:    1000,
+			MaxAttempts: 1,
+		}),
+		retention: envDuration("ASYNC_CREATE_RETENTION", time.Hour),
+		tasks:     make(map[string]*AsyncCreation),
+	}
+	// 积压计入下单前的容量检查，队列将满时同步下单同样返回 RETRY_LATER
+	stats := ac.queue.Stats()
+	payments.preflight.AddQueueProbe("async_create", stats.Capacity, func() int {
+		return ac.queue.Stats().Queued
+	})
+	return ac
+}
+
+// Enqueue 受理异步下单，返回受理的任务或业务错误
+func (ac *AsyncCreator) Enqueue(req *PaymentRequest) (*apierr.Response, error) {
+	if hint := ac.payments.preflight.Check(req.Method); hint != nil {
+		return retryLaterResponse(hint), nil
+	}
+	if _, err := ac.payments.store.Get(req.OrderID); err == nil {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已存在: %s", req.OrderID)), nil
+	}
+
+	now := time.Now()
+	task := &AsyncCreation{PaymentID: req.OrderID, Status: AsyncCreateQueued, CreatedAt: now, UpdatedAt: now, tenantID: req.TenantID}
+	ac.mu.Lock()
+	if existing, ok := ac.tasks[req.OrderID]; ok && existing.Status != AsyncCreateFailed {
+		ac.mu.Unlock()
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已在异步下单队列中: %s", req.OrderID)), nil
+	}
+	job := NewJob("payment.create", req.OrderID, func(context.Context) error {
+		ac.process(req)
+		return nil
+	})
+	if err := ac.queue.Submit(job); err != nil {
+		ac.mu.Unlock()
+		return retryLaterResponse(&RetryHint{
+			Component:         "queue:async_create",
+			Reason:            "异步下单队列已满",
+			RetryAfterSeconds: seconds(ac.payments.preflight.retryAfter),
+		}), nil
+	}
+	ac.tasks[req.OrderID] = task
+	copied := *task
+	ac.mu.Unlock()
+
+	return apierr.SuccessResponse(&copied), nil
+}
+
+// Get 返回异步下单任务的当前状态
+func (ac *AsyncCreator) Get(paymentID string) (*AsyncCreation, bool) {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	task, ok := ac.tasks[paymentID]
+	if !ok {
+		return nil, false
+	}
+	copied := *task
+	return &copied, true
+}
+
+// Run 定期清理已完成的任务，直到 ctx 取消
+func (ac *AsyncCreator) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ac.purge(now)
+		}
+	}
+}
+
+func (ac *AsyncCreator) process(req *PaymentRequest) {
+	ac.update(req.OrderID, func(task *AsyncCreation) {
+		task.Status = AsyncCreateProcessing
+	})
+
+	resp, err := ac.payments.CreatePayment(req)
+	task := ac.update(req.OrderID, func(task *AsyncCreation) {
+		switch {
+		case err != nil:
+			task.Status = AsyncCreateFailed
+			task.Code = "INTERNAL_ERROR"
+			task.Message = err.Error()
+		case !resp.Success:
+			task.Status = AsyncCreateFailed
+			task.Code = resp.Code
+			task.Message = resp.Message
+		default:
+			task.Status = AsyncCreateSucceeded
+			task.Payment, _ = resp.Data.(*PaymentData)
+		}
+	})
+	if task == nil {
+		return
+	}
+
+	if task.Status == AsyncCreateSucceeded {
+		ac.payments.webhooks.Emit(task.tenantID, EventPaymentCreated, task)
+	} else {
+		log.Printf("异步下单失败 %s: %s %s", task.PaymentID, task.Code, task.Message)
+		ac.payments.webhooks.Emit(task.tenantID, EventPaymentCreateFailed, task)
+	}
+}
+
+// update 修改任务并返回修改后的副本
+func (ac *AsyncCreator) update(paymentID string, fn func(*AsyncCreation)) *AsyncCreation {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	task, ok := ac.tasks[paymentID]
+	if !ok {
+		return nil
+	}
+	fn(task)
+	task.UpdatedAt = time.Now()
+	copied := *task
+	return &copied
+}
+
+func (ac *AsyncCreator) purge(now time.Time) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	for id, task := range ac.tasks {
+		if (task.Status == AsyncCreateSucceeded || task.Status == AsyncCreateFailed) && now.Sub(task.UpdatedAt) > ac.retention {
+			delete(ac.tasks, id)
+		}
+	}
+}
+
+// registerAsyncCreateRoutes 注册异步下单的状态查询接口
+func registerAsyncCreateRoutes(api *gin.RouterGroup, ac *AsyncCreator) {
+	api.GET("/payment/async/:paymentId", func(c *gin.Context) {
+		task, ok := ac.Get(c.Param("paymentId"))
+		if !ok {
+			apierr.RespondError(c, http.StatusNotFound, "TASK_NOT_FOUND", "异步下单任务不存在或已过期")
+			return
+		}
+		apierr.RespondOK(c, task)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 审计类别
+const (
+	AuditNotify    = "notify"    // 渠道异步通知被拒绝、回放，及开启报文留存时收到的通知
+	AuditSignature = "signature" // 签名请求被拒绝，包括重放
+	AuditPrivacy   = "privacy"   // 个人信息导出和删除
+)
+
+// AuditEntry 一条安全审计记录
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	Category  string    `json:"category"`
+	Action    string    `json:"action"`
+	Provider  string    `json:"provider,omitempty"`
+	SourceIP  string    `json:"sourceIp,omitempty"`
+	PaymentID string    `json:"paymentId,omitempty"`
+	UserID    string    `json:"userId,omitempty"` // 个人信息类记录涉及的用户，删除个人信息后为假名
+	Detail    string    `json:"detail,omitempty"`
+	Payload   string    `json:"payload,omitempty"` // 通知类记录保存的原始报文，可按记录编号回放
+	At        time.Time `json:"at"`
+}
+
+// AuditLog 安全审计日志，只保留最近 AUDIT_LOG_MAX 条
+type AuditLog struct {
+	max int
+
+	mu      sync.RWMutex
+	entries []AuditEntry
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{max: envInt("AUDIT_LOG_MAX", 10000)}
+}
+
+func (al *AuditLog) Record(entry AuditEntry) {
+	entry.ID = fmt.Sprintf("AU%d%s", time.Now().UnixNano(), util.RandomNumber(4))
+	entry.At = time.Now()
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.entries = append(al.entries, entry)
+	if len(al.entries) > al.max {
+		al.entries = append([]AuditEntry(nil), al.entries[len(al.entries)-al.max:]...)
+	}
+}
+
+// Pseudonymize 把涉及 userID 的记录改为假名，删除个人信息时调用
+func (al *AuditLog) Pseudonymize(userID, pseudonym string) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	for i := range al.entries {
+		if al.entries[i].UserID == userID {
+			al.entries[i].UserID = pseudonym
+		}
+	}
+}
+
+// List 按时间倒序返回审计记录，category 为空时返回全部类别
+func (al *AuditLog) List(category string, limit int) []AuditEntry {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+
+	entries := make([]AuditEntry, 0, limit)
+	for i := len(al.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if category == "" || al.entries[i].Category == category {
+			entries = append(entries, al.entries[i])
+		}
+	}
+	return entries
+}
+
+// Get 按编号查找审计记录
+func (al *AuditLog) Get(id string) (AuditEntry, bool) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	for i := len(al.entries) - 1; i >= 0; i-- {
+		if al.entries[i].ID == id {
+			return al.entries[i], true
+		}
+	}
+	return AuditEntry{}, false
+}
+
+// registerAuditRoutes 注册审计日志查询接口
+func registerAuditRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	admin.GET("/audit", func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "limit 取值 1-1000")
+			return
+		}
+		apierr.RespondOK(c, ps.audit.List(c.Query("category"), limit))
+	})
+}
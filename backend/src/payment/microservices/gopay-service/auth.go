@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// 管理端角色
+const (
+	RoleOps        = "ops"        // 运营：配置、争议、维护窗口、退款发起
+	RoleFinance    = "finance"    // 财务：退款审批、付款、结算对账、账务
+	RoleReadonly   = "readonly"   // 只读：查询类接口
+	RoleCompliance = "compliance" // 合规：制裁筛查、旅行规则复核、个人信息导出与删除
+	RoleCustomer   = "customer"   // 终端用户：只能访问本人的钱包、代扣协议等资源，见 authorizeOwner
+	RoleMerchant   = "merchant"   // 商户系统：管理本租户的 Webhook 订阅，租户取自令牌的租户声明
+)
+
+const principalKey = "principal"
+
+var (
+	ErrTokenMissing = errors.New("缺少访问令牌")
+	ErrTokenInvalid = errors.New("访问令牌无效")
+)
+
+// Principal 通过 JWT 认证的调用方
+type Principal struct {
+	Subject  string   `json:"sub"`
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles"`
+	TenantID string   `json:"tenantId"` // 租户声明，见 AUTH_TENANT_CLAIM
+}
+
+// HasAny 是否具备任一角色
+func (p *Principal) HasAny(roles []string) bool {
+	for _, want := range roles {
+		for _, role := range p.Roles {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routePolicy 一组接口要求的角色，按路由模板前缀匹配，读接口为 GET
+type routePolicy struct {
+	prefix string
+	read   []string
+	write  []string
+}
+
+var (
+	allRoles     = []string{RoleReadonly, RoleOps, RoleFinance}
+	financeRoles = []string{RoleReadonly, RoleFinance}
+	staffRoles   = []string{RoleReadonly, RoleOps, RoleFinance, RoleCompliance}
+)
+
+// routePolicies 按顺序匹配，靠前的规则更具体。未列出的接口（下单、查询、回调、商户门户）不经过 JWT 认证
+var routePolicies = []routePolicy{
+	{prefix: "/api/v1/refunds/:refundId/approve", write: []string{RoleFinance}},
+	{prefix: "/api/v1/refunds/:refundId/reject", write: []string{RoleFinance}},
+	{prefix: "/api/v1/refunds", read: allRoles, write: []string{RoleOps, RoleFinance}},
+	{prefix: "/api/v1/payment/refund", read: allRoles, write: []string{RoleOps, RoleFinance}},
+	// 预授权请款和撤销
+	{prefix: "/api/v1/payment/capture", write: []string{RoleOps, RoleFinance}},
+	{prefix: "/api/v1/payment/void", write: []string{RoleOps, RoleFinance}},
+	{prefix: "/api/v1/payouts", read: financeRoles, write: []string{RoleFinance}},
+	{prefix: "/api/v1/admin/settlements", read: financeRoles, write: []string{RoleFinance}},
+	{prefix: "/api/v1/admin/ledger", read: financeRoles, write: []string{RoleFinance}},
+	{prefix: "/api/v1/admin/fees", read: allRoles, write: []string{RoleFinance}},
+	// GraphQL 只有查询，POST 也按读接口授权，结算报表字段在解析时另行要求财务或只读角色
+	{prefix: "/api/v1/admin/graphql", read: allRoles, write: allRoles},
+	{prefix: "/api/v1/admin", read: allRoles, write: []string{RoleOps}},
+	// 用户本人或运营可以解约，本人校验见 authorizeOwner
+	{prefix: "/api/v1/subscriptions/:agreementId/cancel", write: []string{RoleCustomer, RoleOps}},
+	// 钱包余额和流水只能由本人或员工查询
+	{prefix: "/api/v1/wallet/:userId", read: append([]string{RoleCustomer}, staffRoles...)},
+	// Webhook 订阅按令牌中的租户隔离，见 tenantFromToken
+	{prefix: "/api/v1/webhooks", read: []string{RoleMerchant, RoleOps}, write: []string{RoleMerchant, RoleOps}},
+	// 个人信息导出和删除由运营或合规人员处理
+	{prefix: "/api/v1/privacy", write: []string{RoleOps, RoleCompliance}},
+	// 加密货币网关的管理接口：退款从热钱包转出或登记手工转出的交易由财务操作
+	{prefix: "/api/v1/crypto/admin/refunds/:refundId/send", write: []string{RoleFinance}},
+	{prefix: "/api/v1/crypto/admin/refunds/:refundId/transaction", write: []string{RoleFinance}},
+	{prefix: "/api/v1/crypto/admin/refunds", read: allRoles, write: []string{RoleOps, RoleFinance}},
+	// 归集从收款地址转出资金，手动触发由财务操作
+	{prefix: "/api/v1/crypto/admin/sweeps", read: financeRoles, write: []string{RoleFinance}},
+	// 合规复核单只能由合规人员放行或拒绝，地址筛查供财务手工转账前使用
+	{prefix: "/api/v1/crypto/admin/compliance/screen", write: []string{RoleFinance, RoleCompliance}},
+	{prefix: "/api/v1/crypto/admin/compliance", read: []string{RoleReadonly, RoleOps, RoleCompliance}, write: []string{RoleCompliance}},
+	{prefix: "/api/v1/crypto/admin", read: allRoles, write: []string{RoleOps}},
+}
+
+// policyFor 返回路由要求的角色，返回 nil 表示不需要认证
+func policyFor(fullPath, method string) []string {
+	for _, policy := range routePolicies {
+		if !strings.HasPrefix(fullPath, policy.prefix) {
+			continue
+		}
+		if method == http.MethodGet || method == http.MethodHead {
+			if policy.read != nil {
+				return policy.read
+			}
+		}
+		return policy.write
+	}
+	return nil
+}
+
+// JWTAuth 使用身份提供方 JWKS 公钥校验 RS256/RS384/RS512 令牌，法币渠道服务和加密货币网关共用。
+// 未配置 AUTH_JWKS_URL 时不启用，管理接口保持开放，仅用于本地开发
+type JWTAuth struct {
+	jwksURL     string
+	issuer      string
+	audience    string
+	rolesClaim  string
+	tenantClaim string
+	skew        time.Duration
+	interval    time.Duration
+	httpClient  *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	lastFetch time.Time // 最近一次拉取尝试，失败也计入，避免无效 kid 反复触发拉取
+}
+
+func NewJWTAuth() *JWTAuth {
+	a := &JWTAuth{
+		jwksURL:     os.Getenv("AUTH_JWKS_URL"),
+		issuer:      os.Getenv("AUTH_ISSUER"),
+		audience:    os.Getenv("AUTH_AUDIENCE"),
+		rolesClaim:  os.Getenv("AUTH_ROLES_CLAIM"),
+		tenantClaim: envString("AUTH_TENANT_CLAIM", "tenant_id"),
+		skew:        envDuration("AUTH_CLOCK_SKEW", time.Minute),
+		interval:    envDuration("AUTH_JWKS_REFRESH", time.Hour),
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		keys:        make(map[string]*rsa.PublicKey),
+	}
+	if a.rolesClaim == "" {
+		a.rolesClaim = "roles"
+	}
+	if a.jwksURL == "" {
+		log.Printf("未配置 AUTH_JWKS_URL，管理、退款、付款接口未启用 JWT 认证")
+	}
+	return a
+}
+
+func (a *JWTAuth) Enabled() bool {
+	return a.jwksURL != ""
+}
+
+// Run 定时刷新 JWKS，身份提供方轮换密钥后无需重启
+func (a *JWTAuth) Run(ctx context.Context) {
+	if !a.Enabled() {
+		return
+	}
+	if err := a.refresh(ctx); err != nil {
+		log.Printf("拉取 JWKS 失败: %v", err)
+	}
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.refresh(ctx); err != nil {
+				log.Printf("刷新 JWKS 失败: %v", err)
+			}
+		}
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (a *JWTAuth) refresh(ctx context.Context) error {
+	a.mu.Lock()
+	a.lastFetch = time.Now()
+	a.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS 接口返回 %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return fmt.Errorf("解析 JWKS 失败: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAJWK(k)
+		if err != nil {
+			log.Printf("忽略无效的 JWK %s: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS 中没有可用的 RSA 签名公钥")
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+	return nil
+}
+
+func parseRSAJWK(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 {
+		return nil, errors.New("公钥指数无效")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// key 查找签名公钥，未知 kid 时最多每分钟重新拉取一次 JWKS
+func (a *JWTAuth) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	a.mu.RLock()
+	key, ok := a.keys[kid]
+	stale := time.Since(a.lastFetch) > time.Minute
+	a.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+	if err := a.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// Verify 校验签名、有效期、签发方和受众，返回调用方身份
+func (a *JWTAuth) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	hash, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("不支持的签名算法: %s", header.Alg)
+	}
+	key, err := a.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return nil, errors.New("访问令牌签名无效")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{
+		Subject:  stringClaim(claims, "sub"),
+		Roles:    rolesClaim(claims, a.rolesClaim),
+		TenantID: stringClaim(claims, a.tenantClaim),
+	}
+	for _, name := range []string{"preferred_username", "email", "name", "sub"} {
+		if principal.Name = stringClaim(claims, name); principal.Name != "" {
+			break
+		}
+	}
+	return principal, nil
+}
+
+func (a *JWTAuth) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("访问令牌缺少过期时间")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.skew)) {
+		return errors.New("访问令牌已过期")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.skew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("访问令牌尚未生效")
+	}
+	if a.issuer != "" && stringClaim(claims, "iss") != a.issuer {
+		return errors.New("访问令牌签发方不匹配")
+	}
+	if a.audience != "" {
+		matched := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			matched = aud == a.audience
+		case []interface{}:
+			for _, v := range aud {
+				if s, ok := v.(string); ok && s == a.audience {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return errors.New("访问令牌受众不匹配")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// rolesClaim 读取角色声明，支持 realm_access.roles 这样的嵌套路径，值可以是数组或空格分隔的字符串
+func rolesClaim(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// Middleware 按 routePolicies 校验令牌和角色，认证通过后调用方身份写入上下文
+func (a *JWTAuth) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Enabled() {
+			c.Next()
+			return
+		}
+		roles := policyFor(c.FullPath(), c.Request.Method)
+		if roles == nil {
+			c.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			apierr.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", ErrTokenMissing.Error())
+			c.Abort()
+			return
+		}
+		principal, err := a.Verify(c.Request.Context(), token)
+		if err != nil {
+			apierr.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			c.Abort()
+			return
+		}
+		if !principal.HasAny(roles) {
+			apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", fmt.Sprintf("需要以下角色之一: %s", strings.Join(roles, ", ")))
+			c.Abort()
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Set(httpmw.OperatorKey, principal.Name)
+		c.Next()
+	}
+}
+
+// authorizeOwner 终端用户只能访问 userID 本人的资源，员工角色不受此限制。
+// 未通过认证时（未启用认证或路由未要求认证）不做校验；拒绝时已写入 403 响应
+func authorizeOwner(c *gin.Context, userID string) bool {
+	principal := principalFromRequest(c)
+	if principal == nil || principal.HasAny(staffRoles) || principal.Subject == userID {
+		return true
+	}
+	apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", "只能访问本人的资源")
+	return false
+}
+
+// principalFromRequest 返回 JWT 认证的调用方，未启用认证时返回 nil
+func principalFromRequest(c *gin.Context) *Principal {
+	if v, ok := c.Get(principalKey); ok {
+		return v.(*Principal)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker 渠道调用熔断器：连续失败达到阈值后打开，冷却期过后放行一次探测请求
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// Allow 是否允许发起调用，冷却期结束时转为半开
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == BreakerOpen && time.Since(cb.openedAt) >= cb.cooldown {
+		cb.state = BreakerHalfOpen
+	}
+	return cb.state != BreakerOpen
+}
+
+// Success 调用成功，关闭熔断器
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = BreakerClosed
+	cb.failures = 0
+}
+
+// Failure 调用失败，半开状态下或失败次数达到阈值时打开熔断器
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.state == BreakerHalfOpen || cb.failures >= cb.threshold {
+		cb.state = BreakerOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// State 当前状态
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// RetryAfter 熔断器打开时距离允许探测的剩余时间
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != BreakerOpen {
+		return 0
+	}
+	if remaining := cb.cooldown - time.Since(cb.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Record 按调用结果更新熔断器
+func (cb *CircuitBreaker) Record(err error) {
+	if err != nil {
+		cb.Failure()
+		return
+	}
+	cb.Success()
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+const bundleSchemaVersion = 1
+
+// environmentOrder 配置只能沿此顺序逐级晋升，同环境导入视为恢复
+var environmentOrder = []string{"development", "staging", "production"}
+
+// currentEnvironment 当前部署环境，来自 APP_ENV
+func currentEnvironment() string {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return env
+	}
+	return "development"
+}
+
+// BundleWebhook 配置包中的 Webhook 订阅，不含签名密钥
+type BundleWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// ConfigBundle 租户完整配置的快照。Fees 为服务级共享配置，仅在显式要求时随包导入
+type ConfigBundle struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	TenantID      string          `json:"tenantId"`
+	Environment   string          `json:"environment"`
+	Version       string          `json:"version"`
+	ExportedAt    time.Time       `json:"exportedAt"`
+	Settings      TenantSettings  `json:"settings"`
+	Fees          []FeeRule       `json:"fees"`
+	Webhooks      []BundleWebhook `json:"webhooks"`
+}
+
+// contentVersion 配置内容的摘要，与导出时间和来源环境无关，用于比对和并发控制
+func (b *ConfigBundle) contentVersion() string {
+	content, _ := json.Marshal(struct {
+		Settings TenantSettings  `json:"settings"`
+		Fees     []FeeRule       `json:"fees"`
+		Webhooks []BundleWebhook `json:"webhooks"`
+	}{b.Settings, b.Fees, b.Webhooks})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// BundleChange 配置差异中的一项
+type BundleChange struct {
+	Section string      `json:"section"`
+	Key     string      `json:"key"`
+	Action  string      `json:"action"` // add | remove | change
+	From    interface{} `json:"from,omitempty"`
+	To      interface{} `json:"to,omitempty"`
+}
+
+type ImportBundleRequest struct {
+	Bundle      ConfigBundle `json:"bundle"`
+	BaseVersion string       `json:"baseVersion"` // 预览差异时的目标版本，不一致说明期间配置被改动
+	ApplyShared bool         `json:"applyShared"` // 是否同时导入服务级共享配置（手续费）
+	DryRun      bool         `json:"dryRun"`
+	Operator    string       `json:"operator" binding:"required"`
+}
+
+// ImportBundleResult 导入结果，新建订阅的签名密钥仅在此返回一次
+type ImportBundleResult struct {
+	FromVersion    string            `json:"fromVersion"`
+	ToVersion      string            `json:"toVersion"`
+	Applied        bool              `json:"applied"`
+	Changes        []BundleChange    `json:"changes"`
+	WebhookSecrets map[string]string `json:"webhookSecrets,omitempty"`
+}
+
+// BundleHistory 配置导入记录
+type BundleHistory struct {
+	TenantID          string    `json:"tenantId"`
+	SourceEnvironment string    `json:"sourceEnvironment"`
+	FromVersion       string    `json:"fromVersion"`
+	ToVersion         string    `json:"toVersion"`
+	Changes           int       `json:"changes"`
+	Operator          string    `json:"operator"`
+	ImportedAt        time.Time `json:"importedAt"`
+}
+
+// ConfigBundler 导出、比对及导入租户配置包
+type ConfigBundler struct {
+	payments *PaymentService
+
+	mu      sync.Mutex
+	history []*BundleHistory
+}
+
+func NewConfigBundler(payments *PaymentService) *ConfigBundler {
+	return &ConfigBundler{payments: payments}
+}
+
+// Export 生成租户当前配置包
+func (cb *ConfigBundler) Export(tenantID string) (*ConfigBundle, error) {
+	subs, err := cb.payments.webhooks.subs.ListByTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &ConfigBundle{
+		SchemaVersion: bundleSchemaVersion,
+		TenantID:      tenantID,
+		Environment:   currentEnvironment(),
+		ExportedAt:    time.Now(),
+		Settings:      cb.payments.tenants.Get(tenantID),
+		Fees:          cb.payments.fees.Rules(),
+		Webhooks:      make([]BundleWebhook, 0, len(subs)),
+	}
+	for _, sub := range subs {
+		w := BundleWebhook{URL: sub.URL}
+		if len(sub.Events) > 0 {
+			w.Events = sub.Events
+		}
+		bundle.Webhooks = append(bundle.Webhooks, w)
+	}
+	sort.Slice(bundle.Webhooks, func(i, j int) bool {
+		return bundle.Webhooks[i].URL < bundle.Webhooks[j].URL
+	})
+	bundle.Version = bundle.contentVersion()
+	return bundle, nil
+}
+
+// Diff 比较当前配置与配置包的差异
+func (cb *ConfigBundler) Diff(current, incoming *ConfigBundle, applyShared bool) []BundleChange {
+	var changes []BundleChange
+
+	if current.Settings.RefundDestination != incoming.Settings.RefundDestination {
+		changes = append(changes, BundleChange{Section: "settings", Key: "refundDestination", Action: "change",
+			From: current.Settings.RefundDestination, To: incoming.Settings.RefundDestination})
+	}
+
+	if applyShared {
+		feeKey := func(r FeeRule) string { return strings.Join([]string{r.Provider, r.Channel, r.Currency}, "/") }
+		changes = append(changes, diffByKey("fees", current.Fees, incoming.Fees, feeKey)...)
+	}
+
+	webhookKey := func(w BundleWebhook) string { return w.URL }
+	changes = append(changes, diffByKey("webhooks", current.Webhooks, incoming.Webhooks, webhookKey)...)
+	return changes
+}
+
+// diffByKey 按键比对两组配置项
+func diffByKey[T any](section string, current, incoming []T, key func(T) string) []BundleChange {
+	existing := make(map[string]T, len(current))
+	for _, item := range current {
+		existing[key(item)] = item
+	}
+
+	var changes []BundleChange
+	seen := make(map[string]bool, len(incoming))
+	for _, item := range incoming {
+		k := key(item)
+		seen[k] = true
+		old, ok := existing[k]
+		switch {
+		case !ok:
+			changes = append(changes, BundleChange{Section: section, Key: k, Action: "add", To: item})
+		case !reflect.DeepEqual(old, item):
+			changes = append(changes, BundleChange{Section: section, Key: k, Action: "change", From: old, To: item})
+		}
+	}
+	for _, item := range current {
+		if k := key(item); !seen[k] {
+			changes = append(changes, BundleChange{Section: section, Key: k, Action: "remove", From: item})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// checkPromotion 只允许同环境恢复或从上一级环境晋升
+func checkPromotion(source, target string) error {
+	if source == target {
+		return nil
+	}
+	for i := 1; i < len(environmentOrder); i++ {
+		if environmentOrder[i] == target && environmentOrder[i-1] == source {
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许将 %s 环境的配置导入 %s 环境", source, target)
+}
+
+// Import 预览或应用配置包
+func (cb *ConfigBundler) Import(tenantID string, req *ImportBundleRequest) (*apierr.Response, error) {
+	incoming := &req.Bundle
+	if incoming.SchemaVersion != bundleSchemaVersion {
+		return apierr.ErrorResponse("INVALID_BUNDLE", fmt.Sprintf("不支持的配置包版本: %d", incoming.SchemaVersion)), nil
+	}
+	if incoming.Version != incoming.contentVersion() {
+		return apierr.ErrorResponse("INVALID_BUNDLE", "配置包内容与版本摘要不一致"), nil
+	}
+	if err := checkPromotion(incoming.Environment, currentEnvironment()); err != nil {
+		return apierr.ErrorResponse("PROMOTION_DENIED", err.Error()), nil
+	}
+	for i, w := range incoming.Webhooks {
+		if err := validateWebhookURL(w.URL); err != nil {
+			return apierr.ErrorResponse("INVALID_BUNDLE", err.Error()), nil
+		}
+		if len(w.Events) == 0 {
+			incoming.Webhooks[i].Events = nil
+		}
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	current, err := cb.Export(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if req.BaseVersion != "" && req.BaseVersion != current.Version {
+		return apierr.ErrorResponse("VERSION_CONFLICT", fmt.Sprintf("当前配置版本为 %s，与预览时的 %s 不一致，请重新预览", current.Version, req.BaseVersion)), nil
+	}
+
+	result := &ImportBundleResult{
+		FromVersion: current.Version,
+		ToVersion:   incoming.Version,
+		Changes:     cb.Diff(current, incoming, req.ApplyShared),
+	}
+	if req.DryRun || len(result.Changes) == 0 {
+		return apierr.SuccessResponse(result), nil
+	}
+
+	if result.WebhookSecrets, err = cb.apply(tenantID, incoming, req.ApplyShared); err != nil {
+		return apierr.ErrorResponse("IMPORT_FAILED", err.Error()), nil
+	}
+	result.Applied = true
+
+	cb.history = append(cb.history, &BundleHistory{
+		TenantID:          tenantID,
+		SourceEnvironment: incoming.Environment,
+		FromVersion:       current.Version,
+		ToVersion:         incoming.Version,
+		Changes:           len(result.Changes),
+		Operator:          req.Operator,
+		ImportedAt:        time.Now(),
+	})
+	log.Printf("租户 %s 已导入 %s 环境配置包 %s（%d 项变更），操作人 %s", tenantID, incoming.Environment, incoming.Version, len(result.Changes), req.Operator)
+	return apierr.SuccessResponse(result), nil
+}
+
+// apply 写入配置：租户设置、共享手续费、Webhook 订阅（按 URL 增删改）
+func (cb *ConfigBundler) apply(tenantID string, incoming *ConfigBundle, applyShared bool) (map[string]string, error) {
+	settings := incoming.Settings
+	settings.TenantID = tenantID
+	if err := cb.payments.tenants.Put(&settings); err != nil {
+		return nil, err
+	}
+	if applyShared {
+		if err := cb.payments.fees.Replace(incoming.Fees); err != nil {
+			return nil, err
+		}
+	}
+
+	ws := cb.payments.webhooks
+	subs, err := ws.subs.ListByTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*WebhookSubscription, len(subs))
+	for _, sub := range subs {
+		existing[sub.URL] = sub
+	}
+
+	secrets := make(map[string]string)
+	for _, w := range incoming.Webhooks {
+		if sub, ok := existing[w.URL]; ok {
+			delete(existing, w.URL)
+			if len(sub.Events) != len(w.Events) || (len(w.Events) > 0 && !reflect.DeepEqual(sub.Events, w.Events)) {
+				sub.Events = w.Events
+				if err := ws.subs.Save(sub); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		resp, err := ws.Subscribe(tenantID, &CreateWebhookRequest{URL: w.URL, Events: w.Events})
+		if err != nil {
+			return nil, err
+		}
+		if created, ok := resp.Data.(*CreatedWebhook); ok {
+			secrets[w.URL] = created.Secret
+		}
+	}
+	for _, sub := range existing {
+		if err := ws.subs.Delete(sub.SubscriptionID); err != nil {
+			return nil, err
+		}
+	}
+	return secrets, nil
+}
+
+// History 返回租户的配置导入记录，最新的在前
+func (cb *ConfigBundler) History(tenantID string) []*BundleHistory {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	var result []*BundleHistory
+	for i := len(cb.history) - 1; i >= 0; i-- {
+		if cb.history[i].TenantID == tenantID {
+			result = append(result, cb.history[i])
+		}
+	}
+	return result
+}
+
+// registerBundleRoutes 注册配置包导出、预览、导入接口
+func registerBundleRoutes(api *gin.RouterGroup, cb *ConfigBundler) {
+	admin := api.Group("/admin")
+
+	admin.GET("/tenants/:tenantId/config/export", func(c *gin.Context) {
+		bundle, err := cb.Export(c.Param("tenantId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, bundle)
+	})
+
+	// dryRun=true 时只返回差异，可将返回的 fromVersion 作为正式导入的 baseVersion
+	admin.POST("/tenants/:tenantId/config/import", func(c *gin.Context) {
+		var req ImportBundleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := cb.Import(c.Param("tenantId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.GET("/tenants/:tenantId/config/history", func(c *gin.Context) {
+		apierr.RespondOK(c, cb.History(c.Param("tenantId")))
+	})
+}
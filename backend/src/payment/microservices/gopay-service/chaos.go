@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/wechat"
+
+	"gopay-service/internal/apierr"
+)
+
+// chaosProviders 支持故障注入的渠道
+var chaosProviders = []string{"alipay", "wechat", "crypto"}
+
+// ChaosRule 单个渠道的故障注入配置
+type ChaosRule struct {
+	Provider       string        `json:"provider"`
+	Latency        time.Duration `json:"-"`
+	LatencyText    string        `json:"latency,omitempty"`        // 每次渠道调用前的额外延迟，如 "2s"
+	ErrorRate      float64       `json:"errorRate,omitempty"`      // 渠道调用按此比例返回 5xx 错误，0-1
+	DropNotifyRate float64       `json:"dropNotifyRate,omitempty"` // 渠道通知按此比例丢弃，0-1
+}
+
+// ChaosStats 各渠道的注入次数
+type ChaosStats struct {
+	Delayed         int64 `json:"delayed"`
+	Failed          int64 `json:"failed"`
+	DroppedNotifies int64 `json:"droppedNotifies"`
+}
+
+// ChaosInjector 仅用于测试环境的故障注入：在渠道调用前注入延迟和 5xx 错误，按比例丢弃渠道通知，
+// 用于验证熔断、重试、对账补单和订单履约补偿是否按预期工作。
+// CHAOS_ENABLED=true 时启用，生产环境不允许启用。初始配置读取 CHAOS_<PROVIDER>_LATENCY、
+// CHAOS_<PROVIDER>_ERROR_RATE 和 CHAOS_<PROVIDER>_DROP_NOTIFY_RATE，运行中可通过管理接口调整
+type ChaosInjector struct {
+	mu    sync.RWMutex
+	rules map[string]*ChaosRule
+	stats map[string]*ChaosStats
+}
+
+// NewChaosInjector 未启用时返回 nil，nil 上的各方法不做任何注入
+func NewChaosInjector() *ChaosInjector {
+	if os.Getenv("CHAOS_ENABLED") != "true" {
+		return nil
+	}
+	if currentEnvironment() == "production" {
+		log.Printf("【警告】生产环境不允许启用 CHAOS_ENABLED，故障注入未启动")
+		return nil
+	}
+
+	ci := &ChaosInjector{rules: make(map[string]*ChaosRule), stats: make(map[string]*ChaosStats)}
+	for _, provider := range chaosProviders {
+		prefix := "CHAOS_" + strings.ToUpper(provider) + "_"
+		rule := &ChaosRule{
+			Provider:       provider,
+			Latency:        envDuration(prefix+"LATENCY", 0),
+			ErrorRate:      envFloat(prefix+"ERROR_RATE", 0),
+			DropNotifyRate: envFloat(prefix+"DROP_NOTIFY_RATE", 0),
+		}
+		if err := ci.Set(rule); err != nil {
+			log.Printf("忽略 %s 的故障注入配置: %v", provider, err)
+		}
+	}
+	log.Printf("【警告】已启用故障注入: %v", ci.Rules())
+	return ci
+}
+
+// Set 设置渠道的注入规则，各项均为 0 时清除该渠道的规则
+func (ci *ChaosInjector) Set(rule *ChaosRule) error {
+	if rule.LatencyText != "" {
+		latency, err := time.ParseDuration(rule.LatencyText)
+		if err != nil || latency < 0 {
+			return fmt.Errorf("无效的延迟: %s", rule.LatencyText)
+		}
+		rule.Latency = latency
+	}
+	if rule.ErrorRate < 0 || rule.ErrorRate > 1 || rule.DropNotifyRate < 0 || rule.DropNotifyRate > 1 {
+		return fmt.Errorf("比例取值 0-1")
+	}
+	rule.LatencyText = ""
+	if rule.Latency > 0 {
+		rule.LatencyText = rule.Latency.String()
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	if rule.Latency == 0 && rule.ErrorRate == 0 && rule.DropNotifyRate == 0 {
+		delete(ci.rules, rule.Provider)
+		return nil
+	}
+	ci.rules[rule.Provider] = rule
+	if ci.stats[rule.Provider] == nil {
+		ci.stats[rule.Provider] = new(ChaosStats)
+	}
+	return nil
+}
+
+// Clear 清除全部规则
+func (ci *ChaosInjector) Clear() {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.rules = make(map[string]*ChaosRule)
+}
+
+// Rules 返回当前生效的规则
+func (ci *ChaosInjector) Rules() []ChaosRule {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	rules := make([]ChaosRule, 0, len(ci.rules))
+	for _, rule := range ci.rules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Provider < rules[j].Provider })
+	return rules
+}
+
+// Stats 返回各渠道的注入次数
+func (ci *ChaosInjector) Stats() map[string]ChaosStats {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	stats := make(map[string]ChaosStats, len(ci.stats))
+	for provider, s := range ci.stats {
+		stats[provider] = *s
+	}
+	return stats
+}
+
+func (ci *ChaosInjector) rule(provider string) (ChaosRule, bool) {
+	if ci == nil {
+		return ChaosRule{}, false
+	}
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	rule, ok := ci.rules[provider]
+	if !ok {
+		return ChaosRule{}, false
+	}
+	return *rule, true
+}
+
+func (ci *ChaosInjector) count(provider string, fn func(s *ChaosStats)) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	if ci.stats[provider] == nil {
+		ci.stats[provider] = new(ChaosStats)
+	}
+	fn(ci.stats[provider])
+}
+
+// BeforeProviderCall 在调用渠道前执行：按规则延迟，并按比例返回模拟的渠道 5xx 错误。
+// 返回的错误与真实渠道错误一样计入熔断器
+func (ci *ChaosInjector) BeforeProviderCall(provider, operation string) error {
+	rule, ok := ci.rule(provider)
+	if !ok {
+		return nil
+	}
+	if rule.Latency > 0 {
+		time.Sleep(rule.Latency)
+		ci.count(provider, func(s *ChaosStats) { s.Delayed++ })
+	}
+	if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+		ci.count(provider, func(s *ChaosStats) { s.Failed++ })
+		return fmt.Errorf("%s %s 返回 HTTP 503（故障注入）", provider, operation)
+	}
+	return nil
+}
+
+// NotifyMiddleware 按比例丢弃渠道通知：不做任何处理并返回失败，渠道会按其重试策略再次通知
+func (ci *ChaosInjector) NotifyMiddleware(provider string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, ok := ci.rule(provider)
+		if !ok || rule.DropNotifyRate <= 0 || rand.Float64() >= rule.DropNotifyRate {
+			c.Next()
+			return
+		}
+
+		ci.count(provider, func(s *ChaosStats) { s.DroppedNotifies++ })
+		log.Printf("故障注入：丢弃 %s 通知", provider)
+		if provider == "wechat" {
+			rsp := &wechat.NotifyResponse{ReturnCode: gopay.FAIL, ReturnMsg: "chaos"}
+			c.Data(http.StatusServiceUnavailable, "application/xml; charset=utf-8", []byte(rsp.ToXmlString()))
+		} else {
+			c.Data(http.StatusServiceUnavailable, "text/plain; charset=utf-8", []byte("fail"))
+		}
+		c.Abort()
+	}
+}
+
+// registerChaosRoutes 注册故障注入配置接口，仅在启用时注册
+func registerChaosRoutes(api *gin.RouterGroup, ci *ChaosInjector) {
+	if ci == nil {
+		return
+	}
+	admin := api.Group("/admin")
+
+	admin.GET("/chaos", func(c *gin.Context) {
+		apierr.RespondOK(c, gin.H{"rules": ci.Rules(), "stats": ci.Stats()})
+	})
+
+	admin.PUT("/chaos/:provider", func(c *gin.Context) {
+		var rule ChaosRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		rule.Provider = c.Param("provider")
+		if !slices.Contains(chaosProviders, rule.Provider) {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", fmt.Sprintf("不支持的渠道: %s", rule.Provider))
+			return
+		}
+		if err := ci.Set(&rule); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, ci.Rules())
+	})
+
+	admin.DELETE("/chaos", func(c *gin.Context) {
+		ci.Clear()
+		apierr.RespondOK(c, ci.Rules())
+	})
+}
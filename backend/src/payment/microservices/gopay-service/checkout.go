@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/alipay"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// CheckoutEvent 推送给收银台页面的事件
+type CheckoutEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// CheckoutHub 收银台 SSE 连接管理，连接数同时用于判断用户是否仍停留在支付页
+type CheckoutHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan CheckoutEvent]struct{}
+}
+
+func NewCheckoutHub() *CheckoutHub {
+	return &CheckoutHub{subscribers: make(map[string]map[chan CheckoutEvent]struct{})}
+}
+
+// Subscribe 订阅某笔支付的事件，返回取消订阅函数
+func (h *CheckoutHub) Subscribe(paymentID string) (chan CheckoutEvent, func()) {
+	ch := make(chan CheckoutEvent, 8)
+
+	h.mu.Lock()
+	if h.subscribers[paymentID] == nil {
+		h.subscribers[paymentID] = make(map[chan CheckoutEvent]struct{})
+	}
+	h.subscribers[paymentID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[paymentID], ch)
+		if len(h.subscribers[paymentID]) == 0 {
+			delete(h.subscribers, paymentID)
+		}
+	}
+}
+
+// Publish 向所有订阅者推送事件，慢消费者的事件直接丢弃
+func (h *CheckoutHub) Publish(paymentID string, event CheckoutEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[paymentID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Active 是否有用户正在查看该支付的收银台
+func (h *CheckoutHub) Active(paymentID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[paymentID]) > 0
+}
+
+// ExpiryExtender 支付即将过期且用户仍在收银台时，自动延长一次有效期
+type ExpiryExtender struct {
+	payments  *PaymentService
+	hub       *CheckoutHub
+	enabled   bool
+	threshold time.Duration
+	extension time.Duration
+	interval  time.Duration
+	limiter   *rateLimiter
+}
+
+func NewExpiryExtender(payments *PaymentService, hub *CheckoutHub) *ExpiryExtender {
+	perMinute := envInt("CHECKOUT_EXTENSION_RATE_PER_MINUTE", 60)
+	return &ExpiryExtender{
+		payments:  payments,
+		hub:       hub,
+		enabled:   os.Getenv("CHECKOUT_EXTENSION_ENABLED") == "true",
+		threshold: envDuration("CHECKOUT_EXTENSION_THRESHOLD", 2*time.Minute),
+		extension: envDuration("CHECKOUT_EXTENSION_DURATION", 10*time.Minute),
+		interval:  15 * time.Second,
+		limiter:   newRateLimiter(perMinute, time.Minute),
+	}
+}
+
+func (e *ExpiryExtender) Run(ctx context.Context) {
+	if !e.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.scan(time.Now())
+		}
+	}
+}
+
+func (e *ExpiryExtender) scan(now time.Time) {
+	records, err := e.payments.store.List()
+	if err != nil {
+		log.Printf("加载支付记录失败: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if record.Status != StatusPending || record.ExpiryExtended || record.ExpiresAt.IsZero() {
+			continue
+		}
+		if record.ExpiresAt.Before(now) || record.ExpiresAt.Sub(now) > e.threshold {
+			continue
+		}
+		if !e.hub.Active(record.PaymentID) {
+			continue
+		}
+		if !e.limiter.Allow() {
+			log.Printf("支付有效期延长已达速率上限，跳过 %s", record.PaymentID)
+			return
+		}
+
+		data, err := e.payments.ExtendExpiry(record, e.extension)
+		if err != nil {
+			log.Printf("延长支付有效期失败 %s: %v", record.PaymentID, err)
+			continue
+		}
+		e.hub.Publish(record.PaymentID, CheckoutEvent{Type: "expiry_extended", Data: data})
+	}
+}
+
+// ExtendExpiry 重新向渠道下单以延长有效期，每笔支付只允许延长一次。
+// 持有支付单锁并重新读取记录，与支付通知、对账并发时不会基于旧状态关单重建
+func (ps *PaymentService) ExtendExpiry(record *PaymentRecord, extension time.Duration) (*PaymentData, error) {
+	var data *PaymentData
+	err := ps.withPaymentLock(record, func() error {
+		var err error
+		data, err = ps.extendExpiry(record, extension)
+		return err
+	})
+	return data, err
+}
+
+// extendExpiry ExtendExpiry 的渠道调用和状态变更，调用方须持有支付单锁
+func (ps *PaymentService) extendExpiry(record *PaymentRecord, extension time.Duration) (*PaymentData, error) {
+	if record.Status != StatusPending {
+		return nil, fmt.Errorf("支付状态为 %s，不能延长有效期", record.Status)
+	}
+	if record.ExpiryExtended {
+		return nil, fmt.Errorf("支付有效期已延长过")
+	}
+
+	expiresAt := record.ExpiresAt.Add(extension)
+	oldTradeNo := outTradeNo(record)
+	newTradeNo := record.PaymentID + "_X1"
+	data := &PaymentData{
+		PaymentID: record.PaymentID,
+		ExpiredAt: expiresAt.Format(time.RFC3339),
+		Status:    record.Status,
+	}
+
+	switch record.Method {
+	case "alipay":
+		if ps.aliClient() == nil {
+			return nil, fmt.Errorf("支付宝客户端未初始化")
+		}
+		// 原交易已支付或无法确认已关闭时不能重新下单，否则买家可能对同一笔支付付两次款
+		queryBm := make(gopay.BodyMap)
+		queryBm.Set("out_trade_no", oldTradeNo)
+		aliRsp, err := ps.aliClient().TradeQuery(context.Background(), queryBm)
+		bizErr, _ := alipay.IsBizError(err)
+		switch {
+		case bizErr != nil && bizErr.SubCode == "ACQ.TRADE_NOT_EXIST":
+			// 买家未扫码时交易尚未创建，无需关闭
+		case err != nil:
+			return nil, fmt.Errorf("查询支付宝原订单失败: %w", err)
+		case aliRsp.Response.TradeStatus == "TRADE_SUCCESS" || aliRsp.Response.TradeStatus == "TRADE_FINISHED":
+			return nil, fmt.Errorf("支付宝原订单 %s 已支付，不延长有效期", oldTradeNo)
+		case aliRsp.Response.TradeStatus == "WAIT_BUYER_PAY":
+			closeBm := make(gopay.BodyMap)
+			closeBm.Set("out_trade_no", oldTradeNo)
+			if _, err := ps.aliClient().TradeClose(context.Background(), closeBm); err != nil {
+				return nil, fmt.Errorf("关闭支付宝原订单失败: %w", err)
+			}
+		}
+
+		bm := make(gopay.BodyMap)
+		bm.Set("out_trade_no", newTradeNo)
+		bm.Set("total_amount", fmt.Sprintf("%.2f", record.Amount))
+		bm.Set("subject", record.Subject)
+		bm.Set("time_expire", expiresAt.Format("2006-01-02 15:04:05"))
+		if record.ReturnURL != "" {
+			bm.Set("return_url", record.ReturnURL)
+		}
+		if record.NotifyURL != "" {
+			bm.Set("notify_url", record.NotifyURL)
+		}
+		if record.Installment != nil {
+			bm.Set("extend_params", record.Installment.extendParams())
+		}
+		if passback := ps.passback.Encode(record.Metadata, alipayPassbackLimit, true); passback != "" {
+			bm.Set("passback_params", passback)
+		}
+		payURL, err := ps.aliClient().TradePagePay(context.Background(), bm)
+		if err != nil {
+			return nil, fmt.Errorf("重新创建支付宝支付失败: %w", err)
+		}
+		data.RedirectURL = payURL
+	case "wechat":
+		if ps.wxClient() == nil {
+			return nil, fmt.Errorf("微信客户端未初始化")
+		}
+		closeBm := make(gopay.BodyMap)
+		closeBm.Set("out_trade_no", oldTradeNo)
+		closeBm.Set("nonce_str", util.RandomString(32))
+		if _, err := ps.wxClient().CloseOrder(context.Background(), closeBm); err != nil {
+			return nil, fmt.Errorf("关闭微信原订单失败: %w", err)
+		}
+
+		bm := make(gopay.BodyMap)
+		bm.Set("out_trade_no", newTradeNo)
+		bm.Set("nonce_str", util.RandomString(32))
+		bm.Set("total_fee", toMinorUnits(record.Amount))
+		bm.Set("body", record.Subject)
+		bm.Set("spbill_create_ip", "127.0.0.1")
+		bm.Set("trade_type", "NATIVE")
+		bm.Set("time_expire", expiresAt.Format("20060102150405"))
+		if record.NotifyURL != "" {
+			bm.Set("notify_url", record.NotifyURL)
+		}
+		if attach := ps.passback.Encode(record.Metadata, wechatAttachLimit, false); attach != "" {
+			bm.Set("attach", attach)
+		}
+		wxRsp, err := ps.wxClient().UnifiedOrder(context.Background(), bm)
+		if err != nil {
+			return nil, fmt.Errorf("重新创建微信支付失败: %w", err)
+		}
+		if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
+			return nil, fmt.Errorf("重新创建微信支付失败: %s", wxRsp.ErrCodeDes)
+		}
+		data.QRCode = wxRsp.CodeUrl
+	default:
+		return nil, fmt.Errorf("支付方式 %s 不支持延长有效期", record.Method)
+	}
+
+	record.OutTradeNo = newTradeNo
+	record.ExpiresAt = expiresAt
+	record.ExpiryExtended = true
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// outTradeNo 渠道侧商户订单号，延长有效期重新下单后与支付ID不同
+func outTradeNo(record *PaymentRecord) string {
+	if record.OutTradeNo != "" {
+		return record.OutTradeNo
+	}
+	return record.PaymentID
+}
+
+// registerCheckoutRoutes 注册收银台 SSE 接口
+func registerCheckoutRoutes(api *gin.RouterGroup, ps *PaymentService, hub *CheckoutHub) {
+	api.GET("/checkout/:paymentId/events", func(c *gin.Context) {
+		paymentID := c.Param("paymentId")
+		record, err := ps.store.Get(paymentID)
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", err.Error())
+			return
+		}
+
+		events, unsubscribe := hub.Subscribe(paymentID)
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.SSEvent("status", &PaymentData{
+			PaymentID: record.PaymentID,
+			Status:    record.Status,
+			ExpiredAt: formatTime(record.ExpiresAt),
+		})
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case event := <-events:
+				c.SSEvent(event.Type, event.Data)
+				return true
+			case <-heartbeat.C:
+				c.SSEvent("ping", time.Now().Unix())
+				return true
+			}
+		})
+	})
+}
+
+// rateLimiter 固定窗口计数限流
+type rateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	count       int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window}
+}
+
+func (rl *rateLimiter) Allow() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.windowStart) >= rl.window {
+		rl.windowStart = now
+		rl.count = 0
+	}
+	if rl.count >= rl.limit {
+		return false
+	}
+	rl.count++
+	return true
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Webhook 事件格式
+const (
+	WebhookFormatLegacy      = "legacy"      // 服务自有的 WebhookEvent 结构
+	WebhookFormatCloudEvents = "cloudevents" // CloudEvents 1.0 结构化 JSON
+)
+
+// CloudEvent CloudEvents 1.0 结构化模式的事件信封。traceparent 为 Distributed Tracing 扩展，
+// tenantid 为自定义扩展，扩展属性按规范使用小写字母
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	TraceParent     string      `json:"traceparent,omitempty"`
+	TenantID        string      `json:"tenantid,omitempty"`
+	Data            interface{} `json:"data"`
+}
+
+func validWebhookFormat(format string) bool {
+	return format == "" || format == WebhookFormatLegacy || format == WebhookFormatCloudEvents
+}
+
+// newTraceParent 生成 W3C traceparent。事件由后台流程产生，没有上游调用链，每个事件开启新的链路，
+// 同一事件的各次投递共用同一 trace-id
+func newTraceParent() string {
+	var traceID [16]byte
+	var spanID [8]byte
+	rand.Read(traceID[:])
+	rand.Read(spanID[:])
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(traceID[:]), hex.EncodeToString(spanID[:]))
+}
+
+// cloudEvent 把事件包装为 CloudEvents，type 为 CLOUDEVENTS_TYPE_PREFIX 加事件类型，如 com.onlinestore.payment.paid
+func (ws *WebhookService) cloudEvent(event *WebhookEvent) *CloudEvent {
+	return &CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              event.EventID,
+		Source:          ws.eventSource,
+		Type:            ws.eventTypePrefix + event.Type,
+		Subject:         event.subject,
+		Time:            event.CreatedAt,
+		DataContentType: "application/json",
+		TraceParent:     event.traceParent,
+		TenantID:        event.TenantID,
+		Data:            event.Data,
+	}
+}
+
+// encodeEvent 按订阅的格式序列化事件，返回请求体和 Content-Type
+func (ws *WebhookService) encodeEvent(format string, event *WebhookEvent) ([]byte, string, error) {
+	if format == "" {
+		format = ws.defaultFormat
+	}
+	if format == WebhookFormatCloudEvents {
+		body, err := json.Marshal(ws.cloudEvent(event))
+		return body, "application/cloudevents+json", err
+	}
+	body, err := json.Marshal(event)
+	return body, "application/json", err
+}
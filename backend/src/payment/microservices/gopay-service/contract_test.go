@@ -0,0 +1,218 @@
+//go:build contract
+
+// 客户端 SDK（pkg/paymentsclient）与服务端接口的契约测试。
+//
+//	go test -tags=contract -run TestContract -v
+//
+// 逐字段比对服务端类型与客户端类型的 JSON 字段，再以模拟渠道启动服务，
+// 用客户端走一遍下单、查询、支付、退款，确认两边的编码实际可以互通。
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/pkg/paymentsclient"
+)
+
+// jsonFields 返回结构体的 JSON 字段名，嵌套的结构体字段展开为 a.b 形式，忽略 json:"-" 和未导出字段
+func jsonFields(t reflect.Type, prefix string, seen map[reflect.Type]bool) []string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			fields = append(fields, jsonFields(field.Type, prefix, seen)...)
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, prefix+name)
+		fields = append(fields, jsonFields(field.Type, prefix+name+".", seen)...)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestContractTypes(t *testing.T) {
+	pairs := []struct {
+		name   string
+		server interface{}
+		client interface{}
+	}{
+		{"PaymentRequest", PaymentRequest{}, paymentsclient.CreatePaymentRequest{}},
+		{"PaymentData", PaymentData{}, paymentsclient.Payment{}},
+		{"AsyncCreation", AsyncCreation{}, paymentsclient.AsyncCreation{}},
+		{"RefundRequest", RefundRequest{}, paymentsclient.RefundRequest{}},
+		{"RefundRecord", RefundRecord{}, paymentsclient.Refund{}},
+		{"RetryHint", RetryHint{}, paymentsclient.RetryHint{}},
+		{"MaintenanceNotice", MaintenanceNotice{}, paymentsclient.MaintenanceNotice{}},
+		{"apierr.Response", apierr.Response{}, paymentsclient.Response{}},
+	}
+	for _, pair := range pairs {
+		server := jsonFields(reflect.TypeOf(pair.server), "", map[reflect.Type]bool{})
+		client := jsonFields(reflect.TypeOf(pair.client), "", map[reflect.Type]bool{})
+		if !reflect.DeepEqual(server, client) {
+			t.Errorf("%s 字段不一致\n服务端: %v\n客户端: %v", pair.name, server, client)
+		}
+	}
+}
+
+// contractServer 以模拟渠道启动只含下单、退款相关路由的服务
+func contractServer(t *testing.T) (*PaymentService, *httptest.Server) {
+	t.Helper()
+	t.Setenv("PAYMENTS_MOCK", "true")
+	t.Setenv("APP_ENV", "test")
+	gin.SetMode(gin.TestMode)
+
+	ps := NewPaymentService()
+	async := NewAsyncCreator(ps)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go ps.jobs.Run(ctx)
+
+	r := gin.New()
+	api := r.Group("/api/v1")
+	registerPaymentRoutes(api, ps, async)
+	registerAsyncCreateRoutes(api, async)
+	registerRefundRoutes(api, ps)
+	registerMockRoutes(api, ps)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return ps, srv
+}
+
+func TestContractPaymentLifecycle(t *testing.T) {
+	_, srv := contractServer(t)
+	client := paymentsclient.New(srv.URL)
+	ctx := context.Background()
+
+	payment, err := client.CreatePayment(ctx, &paymentsclient.CreatePaymentRequest{
+		Method:        "wechat",
+		OrderID:       "CONTRACT001",
+		Amount:        88.8,
+		Subject:       "契约测试",
+		ExpireMinutes: 15,
+	})
+	if err != nil {
+		t.Fatalf("下单失败: %v", err)
+	}
+	if payment.PaymentID != "CONTRACT001" || payment.QRCode == "" {
+		t.Fatalf("下单响应不完整: %+v", payment)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/v1/mock/pay/CONTRACT001", "application/json", nil)
+	if err != nil {
+		t.Fatalf("模拟支付失败: %v", err)
+	}
+	resp.Body.Close()
+
+	payment, err = client.QueryPayment(ctx, "CONTRACT001")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if payment.Status != paymentsclient.StatusPaid {
+		t.Fatalf("支付状态为 %s，预期 paid", payment.Status)
+	}
+
+	refund, err := client.CreateRefund(ctx, &paymentsclient.RefundRequest{
+		PaymentID:   "CONTRACT001",
+		Amount:      8.8,
+		Destination: paymentsclient.RefundToSource,
+	})
+	if err != nil {
+		t.Fatalf("退款失败: %v", err)
+	}
+	if refund.Status != paymentsclient.RefundSucceeded || refund.ProviderRefundNo == "" {
+		t.Fatalf("退款响应不完整: %+v", refund)
+	}
+
+	got, err := client.GetRefund(ctx, refund.RefundID)
+	if err != nil || got.Amount != 8.8 {
+		t.Fatalf("查询退款失败: %+v %v", got, err)
+	}
+	refunds, err := client.ListRefunds(ctx, "CONTRACT001")
+	if err != nil || len(refunds) != 1 {
+		t.Fatalf("退款列表不符: %+v %v", refunds, err)
+	}
+}
+
+func TestContractAsyncCreation(t *testing.T) {
+	_, srv := contractServer(t)
+	client := paymentsclient.New(srv.URL)
+	ctx := context.Background()
+
+	task, err := client.CreatePaymentAsync(ctx, &paymentsclient.CreatePaymentRequest{
+		Method:  "alipay",
+		OrderID: "CONTRACT002",
+		Amount:  10,
+		Subject: "契约测试",
+	})
+	if err != nil {
+		t.Fatalf("异步下单失败: %v", err)
+	}
+	if task.PaymentID != "CONTRACT002" {
+		t.Fatalf("异步下单响应不完整: %+v", task)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for task.Status != paymentsclient.AsyncCreateSucceeded {
+		if time.Now().After(deadline) {
+			t.Fatalf("异步下单未完成: %+v", task)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if task, err = client.GetAsyncCreation(ctx, "CONTRACT002"); err != nil {
+			t.Fatalf("查询异步下单失败: %v", err)
+		}
+	}
+	if task.Payment == nil || task.Payment.RedirectURL == "" {
+		t.Fatalf("异步下单结果不完整: %+v", task)
+	}
+}
+
+func TestContractErrors(t *testing.T) {
+	_, srv := contractServer(t)
+	client := paymentsclient.New(srv.URL)
+
+	_, err := client.CreatePayment(context.Background(), &paymentsclient.CreatePaymentRequest{
+		Method:  "cash",
+		OrderID: "CONTRACT003",
+		Amount:  10,
+		Subject: "契约测试",
+	})
+	if !paymentsclient.IsCode(err, "UNSUPPORTED_METHOD") {
+		t.Fatalf("预期 UNSUPPORTED_METHOD，实际 %v", err)
+	}
+
+	_, err = client.CreatePayment(context.Background(), &paymentsclient.CreatePaymentRequest{OrderID: "CONTRACT004"})
+	if !paymentsclient.IsCode(err, "INVALID_PARAMS") {
+		t.Fatalf("预期 INVALID_PARAMS，实际 %v", err)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/alipay"
+	"github.com/go-pay/gopay/wechat"
+
+	"gopay-service/internal/apierr"
+)
+
+// 密钥状态
+const (
+	KeyStaged   = "staged"   // 已录入，尚未启用
+	KeyActive   = "active"   // 新支付使用
+	KeyRetiring = "retiring" // 已被替换，重叠期内仍用于旧支付的回调验签
+)
+
+// envKeyID 启动时从环境变量加载的密钥编号
+const envKeyID = "env"
+
+// KeySet 一套渠道密钥。支付宝使用 AppID/PrivateKey/PublicKey，微信使用 AppID/MchID/APIKey 及证书
+type KeySet struct {
+	KeyID       string    `json:"keyId" binding:"required"`
+	Provider    string    `json:"provider"`
+	AppID       string    `json:"appId"`
+	PrivateKey  string    `json:"privateKey,omitempty"`
+	PublicKey   string    `json:"publicKey,omitempty"`
+	MchID       string    `json:"mchId,omitempty"`
+	APIKey      string    `json:"apiKey,omitempty"`
+	CertPath    string    `json:"certPath,omitempty"`
+	KeyPath     string    `json:"keyPath,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ActivatedAt time.Time `json:"activatedAt,omitempty"`
+	RetiresAt   time.Time `json:"retiresAt,omitempty"`
+}
+
+// KeySetView 对外展示的密钥信息，只包含指纹
+type KeySetView struct {
+	KeyID       string    `json:"keyId"`
+	Provider    string    `json:"provider"`
+	AppID       string    `json:"appId"`
+	MchID       string    `json:"mchId,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ActivatedAt time.Time `json:"activatedAt,omitempty"`
+	RetiresAt   time.Time `json:"retiresAt,omitempty"`
+}
+
+func (ks *KeySet) view() KeySetView {
+	sum := sha256.Sum256([]byte(ks.PrivateKey + ks.PublicKey + ks.APIKey))
+	return KeySetView{
+		KeyID:       ks.KeyID,
+		Provider:    ks.Provider,
+		AppID:       ks.AppID,
+		MchID:       ks.MchID,
+		Fingerprint: hex.EncodeToString(sum[:6]),
+		Status:      ks.Status,
+		CreatedAt:   ks.CreatedAt,
+		ActivatedAt: ks.ActivatedAt,
+		RetiresAt:   ks.RetiresAt,
+	}
+}
+
+func newAlipayClient(ks *KeySet) (*alipay.Client, error) {
+	client, err := alipay.NewClient(ks.AppID, ks.PrivateKey, true) // 是否是沙箱环境
+	if err != nil {
+		return nil, err
+	}
+	// 设置支付宝公钥
+	if ks.PublicKey != "" {
+		client.AutoVerifySign([]byte(ks.PublicKey))
+	}
+	return client, nil
+}
+
+func newWechatClient(ks *KeySet) (*wechat.Client, error) {
+	client := wechat.NewClient(ks.AppID, ks.MchID, ks.APIKey, true) // 是否是沙箱环境
+	// 企业付款需要商户API证书
+	if ks.CertPath != "" && ks.KeyPath != "" {
+		if err := client.AddCertPemFilePath(ks.CertPath, ks.KeyPath); err != nil {
+			return nil, fmt.Errorf("加载微信商户证书失败: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// CredentialManager 管理渠道密钥的录入、切换和过期清理。
+// 切换后新支付使用新密钥，旧密钥在 CREDENTIAL_OVERLAP 内继续用于其创建的支付的回调验签
+type CredentialManager struct {
+	overlap time.Duration
+
+	mu   sync.RWMutex
+	sets map[string][]*KeySet
+
+	alipay atomic.Pointer[alipay.Client]
+	wechat atomic.Pointer[wechat.Client]
+}
+
+// NewCredentialManager 以环境变量中的密钥作为初始启用密钥
+func NewCredentialManager() *CredentialManager {
+	cm := &CredentialManager{
+		overlap: envDuration("CREDENTIAL_OVERLAP", 72*time.Hour),
+		sets:    make(map[string][]*KeySet),
+	}
+	now := time.Now()
+
+	alipayKeys := &KeySet{
+		KeyID:       envKeyID,
+		Provider:    "alipay",
+		AppID:       os.Getenv("ALIPAY_APP_ID"),
+		PrivateKey:  os.Getenv("ALIPAY_PRIVATE_KEY"),
+		PublicKey:   os.Getenv("ALIPAY_PUBLIC_KEY"),
+		Status:      KeyActive,
+		CreatedAt:   now,
+		ActivatedAt: now,
+	}
+	if client, err := newAlipayClient(alipayKeys); err != nil {
+		log.Printf("初始化支付宝客户端失败: %v", err)
+	} else {
+		cm.alipay.Store(client)
+	}
+	cm.sets["alipay"] = []*KeySet{alipayKeys}
+
+	wechatKeys := &KeySet{
+		KeyID:       envKeyID,
+		Provider:    "wechat",
+		AppID:       os.Getenv("WECHAT_APP_ID"),
+		MchID:       os.Getenv("WECHAT_MCH_ID"),
+		APIKey:      os.Getenv("WECHAT_API_KEY"),
+		CertPath:    os.Getenv("WECHAT_CERT_PATH"),
+		KeyPath:     os.Getenv("WECHAT_KEY_PATH"),
+		Status:      KeyActive,
+		CreatedAt:   now,
+		ActivatedAt: now,
+	}
+	client, err := newWechatClient(wechatKeys)
+	if err != nil {
+		// 证书加载失败时仍保留不带证书的客户端，仅企业付款不可用
+		log.Printf("%v", err)
+		wechatKeys.CertPath, wechatKeys.KeyPath = "", ""
+		client, _ = newWechatClient(wechatKeys)
+	}
+	cm.wechat.Store(client)
+	cm.sets["wechat"] = []*KeySet{wechatKeys}
+
+	return cm
+}
+
+// Stage 录入新密钥，启用前不影响现有支付
+func (cm *CredentialManager) Stage(provider string, ks *KeySet) error {
+	if provider != "alipay" && provider != "wechat" {
+		return fmt.Errorf("不支持密钥轮换的渠道: %s", provider)
+	}
+	if ks.AppID == "" {
+		return fmt.Errorf("appId 不能为空")
+	}
+	switch provider {
+	case "alipay":
+		if ks.PrivateKey == "" || ks.PublicKey == "" {
+			return fmt.Errorf("支付宝密钥需要 privateKey 和 publicKey")
+		}
+		// 提前校验私钥格式，避免启用时才失败
+		if _, err := newAlipayClient(ks); err != nil {
+			return fmt.Errorf("支付宝密钥无效: %w", err)
+		}
+	case "wechat":
+		if ks.MchID == "" || ks.APIKey == "" {
+			return fmt.Errorf("微信密钥需要 mchId 和 apiKey")
+		}
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for _, existing := range cm.sets[provider] {
+		if existing.KeyID == ks.KeyID {
+			return fmt.Errorf("密钥编号已存在: %s", ks.KeyID)
+		}
+	}
+	staged := *ks
+	staged.Provider = provider
+	staged.Status = KeyStaged
+	staged.CreatedAt = time.Now()
+	cm.sets[provider] = append(cm.sets[provider], &staged)
+	return nil
+}
+
+// Activate 启用已录入的密钥，原启用密钥进入重叠期
+func (cm *CredentialManager) Activate(provider, keyID string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var next *KeySet
+	for _, ks := range cm.sets[provider] {
+		if ks.KeyID == keyID {
+			next = ks
+		}
+	}
+	if next == nil {
+		return fmt.Errorf("密钥不存在: %s", keyID)
+	}
+	if next.Status != KeyStaged {
+		return fmt.Errorf("只能启用待启用状态的密钥，当前状态: %s", next.Status)
+	}
+
+	switch provider {
+	case "alipay":
+		client, err := newAlipayClient(next)
+		if err != nil {
+			return err
+		}
+		cm.alipay.Store(client)
+	case "wechat":
+		client, err := newWechatClient(next)
+		if err != nil {
+			return err
+		}
+		cm.wechat.Store(client)
+	}
+
+	now := time.Now()
+	for _, ks := range cm.sets[provider] {
+		if ks.Status == KeyActive {
+			ks.Status = KeyRetiring
+			ks.RetiresAt = now.Add(cm.overlap)
+		}
+	}
+	next.Status = KeyActive
+	next.ActivatedAt = now
+	log.Printf("%s 已切换到密钥 %s，旧密钥将于 %s 后停用", provider, keyID, cm.overlap)
+	return nil
+}
+
+// ActiveKeyID 当前新支付使用的密钥编号
+func (cm *CredentialManager) ActiveKeyID(provider string) string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	for _, ks := range cm.sets[provider] {
+		if ks.Status == KeyActive {
+			return ks.KeyID
+		}
+	}
+	return ""
+}
+
+// VerifyKeys 回调验签使用的密钥：支付创建时的密钥仍在重叠期内时优先使用，其次为当前启用密钥
+func (cm *CredentialManager) VerifyKeys(provider, keyID string) []KeySet {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	var result []KeySet
+	for _, ks := range cm.sets[provider] {
+		if ks.KeyID == keyID && ks.Status == KeyRetiring {
+			result = append(result, *ks)
+		}
+	}
+	for _, ks := range cm.sets[provider] {
+		if ks.Status == KeyActive {
+			result = append(result, *ks)
+		}
+	}
+	return result
+}
+
+// List 返回全部密钥的脱敏信息
+func (cm *CredentialManager) List() []KeySetView {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	var views []KeySetView
+	for _, sets := range cm.sets {
+		for _, ks := range sets {
+			views = append(views, ks.view())
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Provider != views[j].Provider {
+			return views[i].Provider < views[j].Provider
+		}
+		return views[i].CreatedAt.Before(views[j].CreatedAt)
+	})
+	return views
+}
+
+// cleanup 删除超过重叠期的旧密钥
+func (cm *CredentialManager) cleanup(now time.Time) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for provider, sets := range cm.sets {
+		kept := sets[:0]
+		for _, ks := range sets {
+			if ks.Status == KeyRetiring && now.After(ks.RetiresAt) {
+				log.Printf("%s 旧密钥 %s 重叠期已结束，已清理", provider, ks.KeyID)
+				continue
+			}
+			kept = append(kept, ks)
+		}
+		cm.sets[provider] = kept
+	}
+}
+
+func (cm *CredentialManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(envDuration("CREDENTIAL_CLEANUP_INTERVAL", 10*time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cm.cleanup(now)
+		}
+	}
+}
+
+// aliClient 当前启用密钥对应的支付宝客户端，初始化失败时为 nil
+func (ps *PaymentService) aliClient() *alipay.Client {
+	return ps.credentials.alipay.Load()
+}
+
+// wxClient 当前启用密钥对应的微信客户端
+func (ps *PaymentService) wxClient() *wechat.Client {
+	return ps.credentials.wechat.Load()
+}
+
+// registerCredentialRoutes 注册密钥轮换接口
+func registerCredentialRoutes(api *gin.RouterGroup, cm *CredentialManager) {
+	admin := api.Group("/admin")
+
+	admin.GET("/credentials", func(c *gin.Context) {
+		apierr.RespondOK(c, cm.List())
+	})
+
+	admin.POST("/credentials/:provider", func(c *gin.Context) {
+		var ks KeySet
+		if err := c.ShouldBindJSON(&ks); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if err := cm.Stage(c.Param("provider"), &ks); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, cm.List())
+	})
+
+	admin.POST("/credentials/:provider/:keyId/activate", func(c *gin.Context) {
+		if err := cm.Activate(c.Param("provider"), c.Param("keyId")); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_STATE", err.Error())
+			return
+		}
+		apierr.RespondOK(c, cm.List())
+	})
+}
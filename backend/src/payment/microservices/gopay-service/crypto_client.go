@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+	"gopay-service/internal/model"
+)
+
+// CryptoGatewayClient 调用加密货币网关服务的客户端
+type CryptoGatewayClient struct {
+	baseURL    string
+	httpClient *http.Client
+	mock       *MockProviders // 启用模拟渠道时不请求网关
+	chaos      *ChaosInjector
+}
+
+func NewCryptoGatewayClient() *CryptoGatewayClient {
+	baseURL := os.Getenv("CRYPTO_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8081"
+	}
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	// 网关开启 mTLS 时出示本服务证书
+	if tlsConfig, err := httpmw.LoadTLSConfig().ClientTLSConfig(); err != nil {
+		log.Printf("加载加密货币网关客户端证书失败: %v", err)
+	} else if tlsConfig != nil {
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	return &CryptoGatewayClient{
+		baseURL:    baseURL,
+		httpClient: httpClient,
+	}
+}
+
+// CreateInvoice 创建加密货币收款账单
+func (cc *CryptoGatewayClient) CreateInvoice(ctx context.Context, req *model.CryptoPaymentRequest) (*model.CryptoPayment, error) {
+	if err := cc.chaos.BeforeProviderCall("crypto", "create"); err != nil {
+		return nil, err
+	}
+	if cc.mock != nil {
+		return cc.mock.CreateInvoice(req)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	invoice := new(model.CryptoPayment)
+	if err := cc.do(ctx, http.MethodPost, "/api/v1/crypto/payment/create", bytes.NewReader(body), invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// QueryInvoice 查询账单状态
+func (cc *CryptoGatewayClient) QueryInvoice(ctx context.Context, paymentID string) (*model.CryptoPaymentStatus, error) {
+	if err := cc.chaos.BeforeProviderCall("crypto", "query"); err != nil {
+		return nil, err
+	}
+	if cc.mock != nil {
+		return cc.mock.QueryInvoice(paymentID)
+	}
+	status := new(model.CryptoPaymentStatus)
+	if err := cc.do(ctx, http.MethodGet, "/api/v1/crypto/payment/query/"+url.PathEscape(paymentID), nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Status 查询网关运行状态
+func (cc *CryptoGatewayClient) Status(ctx context.Context) (*model.CryptoGatewayStatus, error) {
+	if cc.mock != nil {
+		return &model.CryptoGatewayStatus{Ready: true}, nil
+	}
+	status := new(model.CryptoGatewayStatus)
+	if err := cc.do(ctx, http.MethodGet, "/api/v1/crypto/status", nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (cc *CryptoGatewayClient) do(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+	httpReq, err := http.NewRequestWithContext(ctx, method, cc.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := cc.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("请求加密货币网关失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	envelope := apierr.Response{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("解析加密货币网关响应失败: %w", err)
+	}
+	if !envelope.Success {
+		return fmt.Errorf("加密货币网关错误(%s): %s", envelope.Code, envelope.Message)
+	}
+	return nil
+}
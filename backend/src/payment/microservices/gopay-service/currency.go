@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/rates"
+)
+
+// iso4217Codes ISO 4217 现行货币代码，不含贵金属和测试代码。小数位不是 2 的货币见 minorUnitExponents
+var iso4217Codes = strings.Fields(`
+	AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BOV
+	BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CLF CLP CNY COP COU CRC CUP CVE CZK
+	DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD HNL
+	HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT
+	LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR
+	MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF
+	SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP
+	TRY TTD TWD TZS UAH UGX USD USN UYI UYU UYW UZS VED VES VND VUV WST XAF XCD XCG
+	XOF XPF YER ZAR ZMW ZWG
+`)
+
+// minorUnitExponents 最小货币单位的小数位数，未列出的为 2
+var minorUnitExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+var knownCurrencies = func() map[string]bool {
+	known := make(map[string]bool, len(iso4217Codes))
+	for _, code := range iso4217Codes {
+		known[code] = true
+	}
+	return known
+}()
+
+// defaultProviderCurrencies 各支付方式默认支持的币种，nil 表示支持全部 ISO 4217 币种。
+// 可用 <METHOD>_CURRENCIES 覆盖，如 STRIPE_CURRENCIES=USD,EUR,JPY
+var defaultProviderCurrencies = map[string][]string{
+	"alipay": {"CNY"},
+	"wechat": {"CNY"},
+	"stripe": nil,
+}
+
+// defaultCurrency 请求未指定币种时按 DEFAULT_CURRENCY（默认 CNY）校验
+func defaultCurrency() string {
+	return strings.ToUpper(envString("DEFAULT_CURRENCY", "CNY"))
+}
+
+// currencyExponent 币种的小数位数，空币种按默认币种计算
+func currencyExponent(currency string) int {
+	if currency == "" {
+		currency = defaultCurrency()
+	}
+	if exp, ok := minorUnitExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// toMinorUnitsIn 按币种的小数位数将金额转换为最小货币单位，如 JPY 1000 为 1000，USD 10.5 为 1050，KWD 1.005 为 1005。
+// 调用渠道和比较同一支付记录的金额时使用
+func toMinorUnitsIn(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(currencyExponent(currency))))
+}
+
+// fromMinorUnitsIn toMinorUnitsIn 的逆运算，按币种的小数位数将最小货币单位换算为金额
+func fromMinorUnitsIn(minor int64, currency string) float64 {
+	return float64(minor) / math.Pow10(currencyExponent(currency))
+}
+
+// roundAmountIn 按币种的小数位数舍入金额，避免浮点累加误差，如 JPY 取整、KWD 保留三位小数
+func roundAmountIn(amount float64, currency string) float64 {
+	return fromMinorUnitsIn(toMinorUnitsIn(amount, currency), currency)
+}
+
+// formatAmount 按币种的小数位数格式化金额，用于以字符串传金额的渠道，如 USD 10.50、JPY 1000
+func formatAmount(amount float64, currency string) string {
+	return fmt.Sprintf("%.*f", currencyExponent(currency), amount)
+}
+
+// CurrencyRules 各支付方式支持的币种
+type CurrencyRules struct {
+	providers map[string]map[string]bool // 支付方式 -> 支持的币种，nil 表示不限
+}
+
+func NewCurrencyRules() *CurrencyRules {
+	cr := &CurrencyRules{providers: make(map[string]map[string]bool)}
+	for method, defaults := range defaultProviderCurrencies {
+		codes := defaults
+		if raw := os.Getenv(strings.ToUpper(method) + "_CURRENCIES"); raw != "" {
+			codes = splitList(strings.ToUpper(raw))
+		}
+		if codes == nil {
+			cr.providers[method] = nil
+			continue
+		}
+		allowed := make(map[string]bool, len(codes))
+		for _, code := range codes {
+			if !knownCurrencies[code] {
+				log.Printf("【警告】%s_CURRENCIES 中的 %s 不是有效的 ISO 4217 币种，已忽略", strings.ToUpper(method), code)
+				continue
+			}
+			allowed[code] = true
+		}
+		cr.providers[method] = allowed
+	}
+	return cr
+}
+
+// Supports 支付方式是否支持该币种。余额、礼品卡等未列出的支付方式按账户币种处理，不限制
+func (cr *CurrencyRules) Supports(method, currency string) bool {
+	if currency == "" {
+		currency = defaultCurrency()
+	}
+	allowed, ok := cr.providers[method]
+	return !ok || allowed == nil || allowed[currency]
+}
+
+// Check 下单前校验币种和金额精度，返回 nil 表示通过。
+// currency 统一转为大写，便于渠道和对账按同一写法处理
+func (cr *CurrencyRules) Check(method string, currency *string, amount float64) *apierr.Response {
+	*currency = strings.ToUpper(strings.TrimSpace(*currency))
+	code := *currency
+	if code == "" {
+		code = defaultCurrency()
+	}
+	if !knownCurrencies[code] {
+		return apierr.ErrorResponse("INVALID_CURRENCY", fmt.Sprintf("不是有效的 ISO 4217 币种: %s", code))
+	}
+	if !cr.Supports(method, code) {
+		return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", fmt.Sprintf("支付方式 %s 不支持币种 %s", method, code))
+	}
+	exp := currencyExponent(code)
+	scaled := amount * math.Pow10(exp)
+	if math.Abs(scaled-math.Round(scaled)) > 1e-6 {
+		return apierr.ErrorResponse("INVALID_AMOUNT", fmt.Sprintf("币种 %s 金额最多 %d 位小数: %v", code, exp, amount))
+	}
+	return nil
+}
+
+// CurrencySupport 支付方式支持的币种，供收银台按币种展示可用的支付方式
+type CurrencySupport struct {
+	Method     string   `json:"method"`
+	Currencies []string `json:"currencies,omitempty"` // 为空表示支持全部 ISO 4217 币种
+}
+
+func (cr *CurrencyRules) List() []CurrencySupport {
+	list := make([]CurrencySupport, 0, len(cr.providers))
+	for method, allowed := range cr.providers {
+		support := CurrencySupport{Method: method}
+		for code := range allowed {
+			support.Currencies = append(support.Currencies, code)
+		}
+		sort.Strings(support.Currencies)
+		list = append(list, support)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Method < list[j].Method })
+	return list
+}
+
+// reportingCurrency 记账和报表使用的币种，REPORTING_CURRENCY 未配置时与默认币种相同
+func reportingCurrency() string {
+	return strings.ToUpper(envString("REPORTING_CURRENCY", defaultCurrency()))
+}
+
+// referenceRate 订单币种与记账币种不同时记录下单时的参考汇率，供对账和审计。
+// 汇率查询失败不影响下单，只记录日志
+func (ps *PaymentService) referenceRate(currency string) *rates.Quote {
+	if currency == "" || currency == reportingCurrency() || ps.rates == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	quote, err := ps.rates.Get(ctx, currency, reportingCurrency())
+	if err != nil {
+		log.Printf("【汇率】获取 %s/%s 参考汇率失败: %v", currency, reportingCurrency(), err)
+		return nil
+	}
+	return quote
+}
+
+// registerCurrencyRoutes 注册币种和汇率查询接口
+func registerCurrencyRoutes(api *gin.RouterGroup, cr *CurrencyRules, rs *rates.Service) {
+	api.GET("/payment/currencies", func(c *gin.Context) {
+		apierr.RespondOK(c, gin.H{
+			"default":   defaultCurrency(),
+			"reporting": reportingCurrency(),
+			"providers": cr.List(),
+		})
+	})
+
+	// 汇率查询，quote 默认为记账币种
+	api.GET("/payment/rates", func(c *gin.Context) {
+		base := strings.ToUpper(c.Query("base"))
+		quote := strings.ToUpper(c.DefaultQuery("quote", reportingCurrency()))
+		if base == "" {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "缺少 base 参数")
+			return
+		}
+		rate, err := rs.Get(c.Request.Context(), base, quote)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadGateway, "RATE_UNAVAILABLE", err.Error())
+			return
+		}
+		apierr.RespondOK(c, gin.H{
+			"rate":    rate,
+			"sources": rs.Sources(),
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRoundAmountIn(t *testing.T) {
+	cases := []struct {
+		amount   float64
+		currency string
+		minor    int64
+		rounded  float64
+	}{
+		{1000, "JPY", 1000, 1000},
+		{999.6, "JPY", 1000, 1000},
+		{1.005, "KWD", 1005, 1.005},
+		{0.1 + 0.2, "KWD", 300, 0.3},
+		{10.5, "USD", 1050, 10.5},
+		{10.005, "CLF", 100050, 10.005},
+	}
+	for _, tc := range cases {
+		if got := toMinorUnitsIn(tc.amount, tc.currency); got != tc.minor {
+			t.Errorf("toMinorUnitsIn(%v, %s) = %d，预期 %d", tc.amount, tc.currency, got, tc.minor)
+		}
+		if got := roundAmountIn(tc.amount, tc.currency); got != tc.rounded {
+			t.Errorf("roundAmountIn(%v, %s) = %v，预期 %v", tc.amount, tc.currency, got, tc.rounded)
+		}
+	}
+}
+
+func TestRefundableInCurrency(t *testing.T) {
+	ps := &PaymentService{refunds: NewMemoryRefundStore()}
+	cases := []struct {
+		name    string
+		record  *PaymentRecord
+		pending float64
+		want    float64
+	}{
+		{"KWD 保留三位小数", &PaymentRecord{PaymentID: "P1", Amount: 1.005, Currency: "KWD"}, 0, 1.005},
+		{"KWD 扣除待审批退款", &PaymentRecord{PaymentID: "P2", Amount: 2.5, RefundedAmount: 0.75, Currency: "KWD"}, 0.125, 1.625},
+		{"JPY 无小数", &PaymentRecord{PaymentID: "P3", Amount: 1000, RefundedAmount: 300, Currency: "JPY"}, 0, 700},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.pending > 0 {
+				refund := &RefundRecord{RefundID: tc.record.PaymentID + "R", PaymentID: tc.record.PaymentID, Amount: tc.pending, Currency: tc.record.Currency, Status: RefundAwaitingApproval}
+				if err := ps.refunds.Save(refund); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := ps.refundable(tc.record, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("可退金额 %v，预期 %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFeeCalculateInCurrency(t *testing.T) {
+	fs := &FeeSchedule{}
+	if err := fs.Replace([]FeeRule{
+		{Provider: "stripe", Currency: "JPY", Percent: 0.036},
+		{Provider: "stripe", Currency: "KWD", Percent: 0.029, Fixed: 0.1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		currency string
+		amount   float64
+		want     float64
+	}{
+		{"JPY", 1234, 44},     // 44.424 取整
+		{"KWD", 10.5, 0.405},  // 0.3045 + 0.1，保留三位小数
+		{"KWD", 0.001, 0.001}, // 手续费不超过收款金额
+		{"JPY", 10, 0},        // 0.36 取整为 0
+	}
+	for _, tc := range cases {
+		if got := fs.Calculate("stripe", "", tc.currency, tc.amount); got != tc.want {
+			t.Errorf("%s %v 的手续费 %v，预期 %v", tc.currency, tc.amount, got, tc.want)
+		}
+	}
+}
+
+func TestMemoryWalletInCurrency(t *testing.T) {
+	store := NewMemoryWalletStore()
+	if _, err := store.Credit("U1", "KWD", 1.005); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Debit("U1", "KWD", 1.006); err != ErrInsufficientBalance {
+		t.Fatalf("超出余额 0.001 KWD 的扣减应失败，实际: %v", err)
+	}
+	account, err := store.Debit("U1", "KWD", 0.005)
+	if err != nil || account.Balance != 1 {
+		t.Fatalf("扣减后余额 %+v %v，预期 1", account, err)
+	}
+
+	if _, err := store.Credit("U1", "JPY", 999.6); err != nil {
+		t.Fatal(err)
+	}
+	account, err = store.Get("U1", "JPY")
+	if err != nil || account.Balance != 1000 {
+		t.Fatalf("JPY 余额 %+v %v，预期 1000", account, err)
+	}
+}
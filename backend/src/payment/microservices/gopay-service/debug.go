@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+)
+
+// DebugServer 独立端口上的运行时诊断接口：pprof、goroutine 堆栈和 GC 统计，
+// 大促期间无需重新部署即可采集性能数据。只在配置 DEBUG_ADDR 时启动，必须同时配置 DEBUG_TOKEN，
+// 请求须携带 Authorization: Bearer <DEBUG_TOKEN>。端口不应暴露到公网
+type DebugServer struct {
+	addr  string
+	token string
+}
+
+// NewDebugServer 未配置 DEBUG_ADDR 或 DEBUG_TOKEN 时返回 nil
+func NewDebugServer() *DebugServer {
+	addr := os.Getenv("DEBUG_ADDR")
+	if addr == "" {
+		return nil
+	}
+	token := os.Getenv("DEBUG_TOKEN")
+	if token == "" {
+		log.Printf("【警告】配置了 DEBUG_ADDR 但未配置 DEBUG_TOKEN，诊断端口不启动")
+		return nil
+	}
+	return &DebugServer{addr: addr, token: token}
+}
+
+func (ds *DebugServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// 完整的 goroutine 堆栈，排查阻塞和泄漏
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rpprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+
+	mux.HandleFunc("/debug/gc", func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		var gc debug.GCStats
+		debug.ReadGCStats(&gc)
+
+		var pauses []string
+		for i, pause := range gc.Pause {
+			if i >= 10 {
+				break
+			}
+			pauses = append(pauses, pause.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"goroutines":    runtime.NumGoroutine(),
+			"heapAlloc":     mem.HeapAlloc,
+			"heapInuse":     mem.HeapInuse,
+			"heapObjects":   mem.HeapObjects,
+			"sys":           mem.Sys,
+			"numGC":         gc.NumGC,
+			"lastGC":        gc.LastGC,
+			"pauseTotal":    gc.PauseTotal.String(),
+			"recentPauses":  pauses,
+			"gcCPUFraction": mem.GCCPUFraction,
+			"nextGC":        mem.NextGC,
+		})
+	})
+
+	return ds.authenticate(mux)
+}
+
+// authenticate 校验诊断令牌，失败一律返回 401，不区分原因
+func (ds *DebugServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ds.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("诊断接口访问 %s 来自 %s", r.URL.Path, r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run 监听诊断端口直到 ctx 取消
+func (ds *DebugServer) Run(ctx context.Context) {
+	// CPU profile 和 trace 按 seconds 参数持续采集，写超时须长于最长采集时间
+	srv := &http.Server{
+		Addr:              ds.addr,
+		Handler:           ds.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      envDuration("DEBUG_WRITE_TIMEOUT", 2*time.Minute),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("诊断端口已启动: %s", ds.addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("诊断端口启动失败: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 通知处理状态
+const (
+	NotifyProcessing = "processing"
+	NotifyProcessed  = "processed"
+	NotifyFailed     = "failed" // 处理失败，渠道重试时允许重新处理
+)
+
+var ErrNotifyInProgress = errors.New("相同通知正在处理中")
+
+// NotifyReceipt 渠道异步通知的去重记录，按渠道交易号 + 通知类型唯一
+type NotifyReceipt struct {
+	Key             string    `json:"key"`
+	Provider        string    `json:"provider"`
+	ProviderTradeNo string    `json:"providerTradeNo"`
+	NotifyType      string    `json:"notifyType"`
+	PaymentID       string    `json:"paymentId"`
+	Status          string    `json:"status"`
+	Duplicates      int       `json:"duplicates"`
+	Error           string    `json:"error,omitempty"`
+	FirstSeenAt     time.Time `json:"firstSeenAt"`
+	LastSeenAt      time.Time `json:"lastSeenAt"`
+}
+
+func notifyKey(provider, providerTradeNo, notifyType string) string {
+	return provider + ":" + providerTradeNo + ":" + notifyType
+}
+
+// NotifyDedupStore 通知去重表
+type NotifyDedupStore interface {
+	// Claim 登记一次通知。首次或上次处理失败时返回 true；已处理过返回 false；
+	// 另一次投递仍在处理中时返回 ErrNotifyInProgress，由渠道稍后重试
+	Claim(receipt *NotifyReceipt) (bool, error)
+	// Complete 记录处理结果
+	Complete(key string, err error) error
+	ListByPayment(paymentID string) ([]*NotifyReceipt, error)
+	// Purge 删除最后一次收到早于 before 的记录
+	Purge(before time.Time) (int, error)
+}
+
+type memoryNotifyDedupStore struct {
+	mu       sync.Mutex
+	receipts map[string]*NotifyReceipt
+}
+
+func NewMemoryNotifyDedupStore() NotifyDedupStore {
+	return &memoryNotifyDedupStore{receipts: make(map[string]*NotifyReceipt)}
+}
+
+func (s *memoryNotifyDedupStore) Claim(receipt *NotifyReceipt) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	existing, ok := s.receipts[receipt.Key]
+	if !ok {
+		claimed := *receipt
+		claimed.Status = NotifyProcessing
+		claimed.FirstSeenAt = now
+		claimed.LastSeenAt = now
+		s.receipts[receipt.Key] = &claimed
+		return true, nil
+	}
+
+	existing.LastSeenAt = now
+	switch existing.Status {
+	case NotifyFailed:
+		existing.Status = NotifyProcessing
+		existing.Error = ""
+		return true, nil
+	case NotifyProcessing:
+		return false, ErrNotifyInProgress
+	default:
+		existing.Duplicates++
+		return false, nil
+	}
+}
+
+func (s *memoryNotifyDedupStore) Complete(key string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt, ok := s.receipts[key]
+	if !ok {
+		return nil
+	}
+	if err != nil {
+		receipt.Status = NotifyFailed
+		receipt.Error = err.Error()
+	} else {
+		receipt.Status = NotifyProcessed
+	}
+	return nil
+}
+
+func (s *memoryNotifyDedupStore) ListByPayment(paymentID string) ([]*NotifyReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var receipts []*NotifyReceipt
+	for _, receipt := range s.receipts {
+		if receipt.PaymentID == paymentID {
+			copied := *receipt
+			receipts = append(receipts, &copied)
+		}
+	}
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].FirstSeenAt.Before(receipts[j].FirstSeenAt)
+	})
+	return receipts, nil
+}
+
+func (s *memoryNotifyDedupStore) Purge(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for key, receipt := range s.receipts {
+		if receipt.Status != NotifyProcessing && receipt.LastSeenAt.Before(before) {
+			delete(s.receipts, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// dedupNotify 按去重表处理一次通知：重复通知直接视为成功，处理失败时允许渠道重试
+func (ps *PaymentService) dedupNotify(receipt *NotifyReceipt, handle func() error) error {
+	// 没有渠道交易号的通知无法去重，直接处理
+	if receipt.ProviderTradeNo == "" {
+		return handle()
+	}
+	receipt.Key = notifyKey(receipt.Provider, receipt.ProviderTradeNo, receipt.NotifyType)
+
+	claimed, err := ps.notifyDedup.Claim(receipt)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Printf("忽略重复通知 %s", receipt.Key)
+		return nil
+	}
+
+	err = handle()
+	if completeErr := ps.notifyDedup.Complete(receipt.Key, err); completeErr != nil {
+		log.Printf("更新通知去重记录失败 %s: %v", receipt.Key, completeErr)
+	}
+	return err
+}
+
+// NotifyDedupJanitor 定时清理过期的去重记录，保留时间需长于渠道的最长重试周期
+type NotifyDedupJanitor struct {
+	store     NotifyDedupStore
+	retention time.Duration
+}
+
+func NewNotifyDedupJanitor(store NotifyDedupStore) *NotifyDedupJanitor {
+	return &NotifyDedupJanitor{
+		store:     store,
+		retention: envDuration("NOTIFY_DEDUP_RETENTION", 7*24*time.Hour),
+	}
+}
+
+func (j *NotifyDedupJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if purged, err := j.store.Purge(now.Add(-j.retention)); err != nil {
+				log.Printf("清理通知去重记录失败: %v", err)
+			} else if purged > 0 {
+				log.Printf("已清理 %d 条过期通知去重记录", purged)
+			}
+		}
+	}
+}
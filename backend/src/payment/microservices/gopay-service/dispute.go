@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 争议状态
+const (
+	DisputeNeedsResponse = "needs_response" // 等待提交举证
+	DisputeUnderReview   = "under_review"   // 已提交举证，等待渠道裁决
+	DisputeWon           = "won"
+	DisputeLost          = "lost"
+	DisputeAccepted      = "accepted" // 商户主动认可，不再抗辩
+)
+
+var ErrDisputeNotFound = errors.New("争议不存在")
+
+// disputeDefaultWindow 渠道未给出举证截止时间时的默认期限
+var disputeDefaultWindow = map[string]time.Duration{
+	"stripe": 7 * 24 * time.Hour,
+	"alipay": 3 * 24 * time.Hour,
+	"wechat": 3 * 24 * time.Hour,
+}
+
+// DisputeEvidence 举证材料，文件类材料只保存存储地址
+type DisputeEvidence struct {
+	EvidenceID  string    `json:"evidenceId"`
+	Type        string    `json:"type" binding:"required"` // text | file
+	Content     string    `json:"content" binding:"required"`
+	Description string    `json:"description"`
+	SubmittedBy string    `json:"submittedBy" binding:"required"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Dispute 渠道争议：Stripe 拒付（dispute）、支付宝/微信投诉
+type Dispute struct {
+	DisputeID         string            `json:"disputeId"`
+	PaymentID         string            `json:"paymentId"`
+	TenantID          string            `json:"tenantId"`
+	Provider          string            `json:"provider"`
+	ProviderDisputeID string            `json:"providerDisputeId"`
+	Reason            string            `json:"reason"`
+	Amount            float64           `json:"amount"`
+	Currency          string            `json:"currency,omitempty"`
+	Status            string            `json:"status"`
+	DueBy             time.Time         `json:"dueBy"`
+	Evidence          []DisputeEvidence `json:"evidence,omitempty"`
+	AlertedAt         time.Time         `json:"alertedAt,omitempty"`
+	ClosedAt          time.Time         `json:"closedAt,omitempty"`
+	Remark            string            `json:"remark,omitempty"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
+}
+
+func (d *Dispute) closed() bool {
+	return d.Status == DisputeWon || d.Status == DisputeLost || d.Status == DisputeAccepted
+}
+
+type OpenDisputeRequest struct {
+	PaymentID         string    `json:"paymentId" binding:"required"`
+	ProviderDisputeID string    `json:"providerDisputeId" binding:"required"`
+	Reason            string    `json:"reason" binding:"required"`
+	Amount            float64   `json:"amount"` // 为空时为支付金额
+	DueBy             time.Time `json:"dueBy"`  // 渠道给出的举证截止时间
+}
+
+type ResolveDisputeRequest struct {
+	Status   string `json:"status" binding:"required"` // won | lost | accepted
+	Operator string `json:"operator" binding:"required"`
+	Remark   string `json:"remark"`
+}
+
+// DisputeStore 争议存储
+type DisputeStore interface {
+	Save(dispute *Dispute) error
+	Get(disputeID string) (*Dispute, error)
+	List() ([]*Dispute, error)
+}
+
+type memoryDisputeStore struct {
+	mu       sync.RWMutex
+	disputes map[string]*Dispute
+}
+
+func NewMemoryDisputeStore() DisputeStore {
+	return &memoryDisputeStore{disputes: make(map[string]*Dispute)}
+}
+
+func (s *memoryDisputeStore) Save(dispute *Dispute) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if dispute.CreatedAt.IsZero() {
+		dispute.CreatedAt = now
+	}
+	dispute.UpdatedAt = now
+
+	copied := *dispute
+	copied.Evidence = append([]DisputeEvidence(nil), dispute.Evidence...)
+	s.disputes[dispute.DisputeID] = &copied
+	return nil
+}
+
+func (s *memoryDisputeStore) Get(disputeID string) (*Dispute, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dispute, ok := s.disputes[disputeID]
+	if !ok {
+		return nil, ErrDisputeNotFound
+	}
+	copied := *dispute
+	copied.Evidence = append([]DisputeEvidence(nil), dispute.Evidence...)
+	return &copied, nil
+}
+
+func (s *memoryDisputeStore) List() ([]*Dispute, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	disputes := make([]*Dispute, 0, len(s.disputes))
+	for _, dispute := range s.disputes {
+		copied := *dispute
+		copied.Evidence = append([]DisputeEvidence(nil), dispute.Evidence...)
+		disputes = append(disputes, &copied)
+	}
+	sort.Slice(disputes, func(i, j int) bool {
+		return disputes[i].DueBy.Before(disputes[j].DueBy)
+	})
+	return disputes, nil
+}
+
+// DisputeService 登记争议、收集举证，并在举证截止前提醒客服
+type DisputeService struct {
+	payments    *PaymentService
+	store       DisputeStore
+	alertBefore time.Duration
+	interval    time.Duration
+	mu          sync.Mutex
+}
+
+func NewDisputeService(payments *PaymentService) *DisputeService {
+	return &DisputeService{
+		payments:    payments,
+		store:       NewMemoryDisputeStore(),
+		alertBefore: envDuration("DISPUTE_ALERT_BEFORE", 48*time.Hour),
+		interval:    envDuration("DISPUTE_CHECK_INTERVAL", 10*time.Minute),
+	}
+}
+
+// Open 登记渠道推送或客服录入的争议
+func (ds *DisputeService) Open(req *OpenDisputeRequest, operator string) (*apierr.Response, error) {
+	record, err := ds.payments.store.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if record.Status != StatusPaid && record.Status != StatusPartiallyRefunded && record.Status != StatusRefunded {
+		return apierr.ErrorResponse("INVALID_STATE", "只有已支付的订单可以登记争议"), nil
+	}
+	window, ok := disputeDefaultWindow[record.Method]
+	if !ok {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("该支付方式不支持争议: %s", record.Method)), nil
+	}
+
+	amount := req.Amount
+	if amount <= 0 {
+		amount = record.Amount
+	}
+	if amount > record.Amount {
+		return apierr.ErrorResponse("INVALID_PARAMS", "争议金额不能超过支付金额"), nil
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	existing, err := ds.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range existing {
+		if d.Provider == record.Method && d.ProviderDisputeID == req.ProviderDisputeID {
+			return apierr.ErrorResponse("DUPLICATE_DISPUTE", fmt.Sprintf("渠道争议 %s 已登记为 %s", req.ProviderDisputeID, d.DisputeID)), nil
+		}
+	}
+
+	dueBy := req.DueBy
+	if dueBy.IsZero() {
+		dueBy = time.Now().Add(window)
+	}
+	dispute := &Dispute{
+		DisputeID:         fmt.Sprintf("DP%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		PaymentID:         record.PaymentID,
+		TenantID:          record.TenantID,
+		Provider:          record.Method,
+		ProviderDisputeID: req.ProviderDisputeID,
+		Reason:            req.Reason,
+		Amount:            roundAmountIn(amount, record.Currency),
+		Currency:          record.Currency,
+		Status:            DisputeNeedsResponse,
+		DueBy:             dueBy,
+	}
+	if err := ds.store.Save(dispute); err != nil {
+		return nil, err
+	}
+	ds.payments.webhooks.Emit(dispute.TenantID, EventDisputeCreated, dispute)
+	ds.payments.actions.Record(dispute.PaymentID, operator, "dispute.opened", fmt.Sprintf("%s %s: %s", dispute.DisputeID, dispute.ProviderDisputeID, dispute.Reason))
+	log.Printf("支付 %s 收到%s争议 %s，举证截止 %s", record.PaymentID, record.Method, dispute.DisputeID, dueBy.Format(time.RFC3339))
+	return apierr.SuccessResponse(dispute), nil
+}
+
+// AddEvidence 追加举证材料，提交给渠道前可多次追加
+func (ds *DisputeService) AddEvidence(disputeID string, evidence *DisputeEvidence) (*apierr.Response, error) {
+	if evidence.Type != "text" && evidence.Type != "file" {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的举证类型: %s", evidence.Type)), nil
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	dispute, err := ds.store.Get(disputeID)
+	if err != nil {
+		return apierr.ErrorResponse("DISPUTE_NOT_FOUND", err.Error()), nil
+	}
+	if dispute.Status != DisputeNeedsResponse {
+		return apierr.ErrorResponse("INVALID_STATE", "举证已提交或争议已结束，不能追加材料"), nil
+	}
+	if time.Now().After(dispute.DueBy) {
+		return apierr.ErrorResponse("INVALID_STATE", "已超过举证截止时间"), nil
+	}
+
+	added := *evidence
+	added.EvidenceID = fmt.Sprintf("EVD%d%s", time.Now().UnixNano(), util.RandomNumber(4))
+	added.CreatedAt = time.Now()
+	dispute.Evidence = append(dispute.Evidence, added)
+	if err := ds.store.Save(dispute); err != nil {
+		return nil, err
+	}
+	ds.payments.actions.Record(dispute.PaymentID, added.SubmittedBy, "dispute.evidence_added", fmt.Sprintf("%s %s", dispute.DisputeID, added.EvidenceID))
+	return apierr.SuccessResponse(dispute), nil
+}
+
+// Submit 标记举证已提交渠道，进入审核
+func (ds *DisputeService) Submit(disputeID, operator string) (*apierr.Response, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	dispute, err := ds.store.Get(disputeID)
+	if err != nil {
+		return apierr.ErrorResponse("DISPUTE_NOT_FOUND", err.Error()), nil
+	}
+	if dispute.Status != DisputeNeedsResponse {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不能提交举证: %s", dispute.Status)), nil
+	}
+	if len(dispute.Evidence) == 0 {
+		return apierr.ErrorResponse("INVALID_STATE", "请先添加举证材料"), nil
+	}
+
+	dispute.Status = DisputeUnderReview
+	if err := ds.store.Save(dispute); err != nil {
+		return nil, err
+	}
+	ds.payments.actions.Record(dispute.PaymentID, operator, "dispute.submitted", dispute.DisputeID)
+	return apierr.SuccessResponse(dispute), nil
+}
+
+// Resolve 记录渠道裁决结果或商户主动认可
+func (ds *DisputeService) Resolve(disputeID string, req *ResolveDisputeRequest) (*apierr.Response, error) {
+	switch req.Status {
+	case DisputeWon, DisputeLost, DisputeAccepted:
+	default:
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的争议结果: %s", req.Status)), nil
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	dispute, err := ds.store.Get(disputeID)
+	if err != nil {
+		return apierr.ErrorResponse("DISPUTE_NOT_FOUND", err.Error()), nil
+	}
+	if dispute.closed() {
+		return apierr.ErrorResponse("INVALID_STATE", "争议已结束"), nil
+	}
+
+	if err := ds.close(dispute, req.Status, fmt.Sprintf("%s: %s", req.Operator, req.Remark)); err != nil {
+		return nil, err
+	}
+	ds.payments.actions.Record(dispute.PaymentID, req.Operator, "dispute."+req.Status, fmt.Sprintf("%s %s", dispute.DisputeID, req.Remark))
+	return apierr.SuccessResponse(dispute), nil
+}
+
+func (ds *DisputeService) close(dispute *Dispute, status, remark string) error {
+	dispute.Status = status
+	dispute.Remark = remark
+	dispute.ClosedAt = time.Now()
+	if err := ds.store.Save(dispute); err != nil {
+		return err
+	}
+	ds.payments.webhooks.Emit(dispute.TenantID, EventDisputeClosed, dispute)
+	return nil
+}
+
+// Run 定时检查举证截止时间：临近截止时提醒一次，超过截止仍未举证的按渠道规则判负
+func (ds *DisputeService) Run(ctx context.Context) {
+	ticker := time.NewTicker(ds.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ds.checkDeadlines(now)
+		}
+	}
+}
+
+func (ds *DisputeService) checkDeadlines(now time.Time) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	disputes, err := ds.store.List()
+	if err != nil {
+		log.Printf("加载争议列表失败: %v", err)
+		return
+	}
+	for _, dispute := range disputes {
+		if dispute.Status != DisputeNeedsResponse {
+			continue
+		}
+
+		if now.After(dispute.DueBy) {
+			log.Printf("争议 %s 超过举证截止时间未举证，已判负", dispute.DisputeID)
+			if err := ds.close(dispute, DisputeLost, "举证超时"); err != nil {
+				log.Printf("更新争议 %s 失败: %v", dispute.DisputeID, err)
+				continue
+			}
+			ds.payments.actions.Record(dispute.PaymentID, "system", "dispute.lost", dispute.DisputeID+" 举证超时")
+			continue
+		}
+
+		if dispute.AlertedAt.IsZero() && dispute.DueBy.Sub(now) <= ds.alertBefore {
+			dispute.AlertedAt = now
+			if err := ds.store.Save(dispute); err != nil {
+				log.Printf("更新争议 %s 失败: %v", dispute.DisputeID, err)
+				continue
+			}
+			log.Printf("【提醒】争议 %s 将于 %s 截止举证，请尽快处理", dispute.DisputeID, dispute.DueBy.Format(time.RFC3339))
+			ds.payments.webhooks.Emit(dispute.TenantID, EventDisputeDeadline, dispute)
+		}
+	}
+}
+
+// registerDisputeRoutes 注册争议管理接口，供客服后台使用
+func registerDisputeRoutes(api *gin.RouterGroup, ds *DisputeService) {
+	admin := api.Group("/admin")
+
+	admin.POST("/disputes", func(c *gin.Context) {
+		var req OpenDisputeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ds.Open(&req, operatorFromRequest(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// status 为空时返回全部，按举证截止时间升序
+	admin.GET("/disputes", func(c *gin.Context) {
+		disputes, err := ds.store.List()
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		status := c.Query("status")
+		filtered := make([]*Dispute, 0, len(disputes))
+		for _, d := range disputes {
+			if status == "" || d.Status == status {
+				filtered = append(filtered, d)
+			}
+		}
+		apierr.RespondOK(c, filtered)
+	})
+
+	admin.GET("/disputes/:disputeId", func(c *gin.Context) {
+		dispute, err := ds.store.Get(c.Param("disputeId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "DISPUTE_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, dispute)
+	})
+
+	admin.POST("/disputes/:disputeId/evidence", func(c *gin.Context) {
+		var evidence DisputeEvidence
+		if err := c.ShouldBindJSON(&evidence); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ds.AddEvidence(c.Param("disputeId"), &evidence)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.POST("/disputes/:disputeId/submit", func(c *gin.Context) {
+		resp, err := ds.Submit(c.Param("disputeId"), operatorFromRequest(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.POST("/disputes/:disputeId/resolve", func(c *gin.Context) {
+		var req ResolveDisputeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ds.Resolve(c.Param("disputeId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
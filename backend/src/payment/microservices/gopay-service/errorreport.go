@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// errorReporting 是否已配置错误上报。未配置 SENTRY_DSN 时各上报函数只是空操作，错误仍照常写日志
+var errorReporting bool
+
+// 事件发送前替换为掩码的个人信息：身份证号须先于银行卡号匹配。
+// 两侧要求单词边界，支付单号、渠道订单号中的长数字串不受影响
+var piiPatterns = []struct {
+	pattern *regexp.Regexp
+	mask    string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[email]"},
+	{regexp.MustCompile(`\b\d{17}[\dXx]\b`), "[id]"},
+	{regexp.MustCompile(`\b\d{16,19}\b`), "[card]"},
+	{regexp.MustCompile(`\b1[3-9]\d{9}\b`), "[phone]"},
+}
+
+// InitErrorReporting 按 SENTRY_DSN 初始化错误上报，返回关闭前调用的刷新函数。
+// 事件带环境和版本号，SENTRY_SAMPLE_RATE 控制采样比例，默认全部上报
+func InitErrorReporting() func() {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return func() {}
+	}
+	release := version
+	if gitSHA != "" {
+		release = version + "+" + gitSHA
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              dsn,
+		Environment:      currentEnvironment(),
+		Release:          "gopay-service@" + release,
+		SampleRate:       envFloat("SENTRY_SAMPLE_RATE", 1),
+		AttachStacktrace: true,
+		SendDefaultPII:   false,
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			return scrubEvent(event)
+		},
+	})
+	if err != nil {
+		log.Printf("【警告】错误上报初始化失败，仅写日志: %v", err)
+		return func() {}
+	}
+	errorReporting = true
+	log.Printf("错误上报已启用")
+	return func() { sentry.Flush(5 * time.Second) }
+}
+
+// scrubEvent 去掉请求体、查询参数、Cookie、请求头和用户信息，并对文本中的个人信息打码。
+// 支付单号、渠道、路由等排查所需的信息放在标签里，不受影响
+func scrubEvent(event *sentry.Event) *sentry.Event {
+	if event.Request != nil {
+		event.Request.Data = ""
+		event.Request.QueryString = ""
+		event.Request.Cookies = ""
+		event.Request.Headers = nil
+		event.Request.Env = nil
+	}
+	event.User = sentry.User{}
+	event.Message = scrubPII(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = scrubPII(event.Exception[i].Value)
+	}
+	for _, breadcrumb := range event.Breadcrumbs {
+		breadcrumb.Message = scrubPII(breadcrumb.Message)
+		breadcrumb.Data = nil
+	}
+	for key, value := range event.Extra {
+		if s, ok := value.(string); ok {
+			event.Extra[key] = scrubPII(s)
+		}
+	}
+	return event
+}
+
+func scrubPII(s string) string {
+	for _, p := range piiPatterns {
+		s = p.pattern.ReplaceAllString(s, p.mask)
+	}
+	return s
+}
+
+// reportError 上报错误，tags 中的空值忽略
+func reportError(err error, tags map[string]string) {
+	if !errorReporting || err == nil {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		setReportTags(scope, tags)
+		sentry.CaptureException(err)
+	})
+}
+
+// reportWarning 上报不伴随错误值的异常情况，如渠道拨测失败
+func reportWarning(message string, tags map[string]string) {
+	if !errorReporting {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		setReportTags(scope, tags)
+		sentry.CaptureMessage(message)
+	})
+}
+
+func setReportTags(scope *sentry.Scope, tags map[string]string) {
+	for key, value := range tags {
+		if value != "" {
+			scope.SetTag(key, value)
+		}
+	}
+}
+
+// reportingRecovery 替代 gin.Recovery：记录 panic 堆栈并上报，带路由和支付单号标签，返回统一的 500 响应
+func reportingRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			log.Printf("处理请求 %s %s 时发生 panic: %v\n%s", c.Request.Method, c.FullPath(), recovered, debug.Stack())
+
+			if errorReporting {
+				sentry.WithScope(func(scope *sentry.Scope) {
+					scope.SetLevel(sentry.LevelFatal)
+					scope.SetRequest(c.Request)
+					setReportTags(scope, map[string]string{
+						"method":     c.Request.Method,
+						"route":      c.FullPath(),
+						"payment_id": requestPaymentID(c),
+					})
+					sentry.CaptureException(fmt.Errorf("panic: %v", recovered))
+				})
+			}
+
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "服务内部错误")
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
+
+// requestPaymentID 从路径参数或查询参数中取支付单号，不读取请求体
+func requestPaymentID(c *gin.Context) string {
+	if id := c.Param("paymentId"); id != "" {
+		return id
+	}
+	return c.Query("paymentId")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// BusMessage 事件总线上的一条消息
+type BusMessage struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// EventBus 事件总线。各实现语义一致：同一消费组内每条消息只投递给一个实例，handler 返回后才确认，
+// 实例崩溃时未确认的消息会重新投递；handler 返回错误时记录日志并确认，死信由调用方处理
+type EventBus interface {
+	Publish(ctx context.Context, msg BusMessage) error
+	// Subscribe 以消费组 group 订阅 topic，阻塞直到 ctx 取消
+	Subscribe(ctx context.Context, topic, group string, handler func(context.Context, BusMessage) error) error
+	Close() error
+}
+
+// NewEventBus 按 EVENT_BUS（kafka | nats）选择实现。未设置时配置了 KAFKA_BROKERS 使用 Kafka，
+// 配置了 NATS_URL 使用 NATS JetStream，都未配置返回 nil
+func NewEventBus() EventBus {
+	kind := os.Getenv("EVENT_BUS")
+	if kind == "" {
+		switch {
+		case os.Getenv("KAFKA_BROKERS") != "":
+			kind = "kafka"
+		case os.Getenv("NATS_URL") != "":
+			kind = "nats"
+		default:
+			return nil
+		}
+	}
+
+	switch kind {
+	case "kafka":
+		return newKafkaBus()
+	case "nats":
+		bus, err := newNATSBus()
+		if err != nil {
+			log.Printf("连接 NATS 失败，事件总线未启用: %v", err)
+			return nil
+		}
+		return bus
+	default:
+		log.Printf("不支持的 EVENT_BUS: %s，事件总线未启用", kind)
+		return nil
+	}
+}
+
+// kafkaBus 基于 Kafka 消费组，处理完成后提交位点
+type kafkaBus struct {
+	brokers []string
+	dialer  *kafka.Dialer
+	writer  *kafka.Writer
+}
+
+// newKafkaBus 读取 KAFKA_BROKERS，KAFKA_TLS=true 启用 TLS，配置 KAFKA_SASL_USERNAME 时使用 SASL/PLAIN
+func newKafkaBus() *kafkaBus {
+	brokers := splitList(envString("KAFKA_BROKERS", "localhost:9092"))
+	dialer := &kafka.Dialer{Timeout: 10 * time.Second, DualStack: true}
+	transport := &kafka.Transport{}
+	if os.Getenv("KAFKA_TLS") == "true" {
+		dialer.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		transport.TLS = dialer.TLS
+	}
+	if user := os.Getenv("KAFKA_SASL_USERNAME"); user != "" {
+		mechanism := plain.Mechanism{Username: user, Password: os.Getenv("KAFKA_SASL_PASSWORD")}
+		dialer.SASLMechanism = mechanism
+		transport.SASL = mechanism
+	}
+	return &kafkaBus{
+		brokers: brokers,
+		dialer:  dialer,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Transport:    transport,
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+func (b *kafkaBus) Publish(ctx context.Context, msg BusMessage) error {
+	headers := make([]kafka.Header, 0, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return b.writer.WriteMessages(ctx, kafka.Message{Topic: msg.Topic, Key: []byte(msg.Key), Value: msg.Value, Headers: headers})
+}
+
+func (b *kafkaBus) Subscribe(ctx context.Context, topic, group string, handler func(context.Context, BusMessage) error) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  b.brokers,
+		GroupID:  group,
+		Topic:    topic,
+		Dialer:   b.dialer,
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+	defer reader.Close()
+
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("拉取 %s 消息失败: %v", topic, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		msg := BusMessage{Topic: m.Topic, Key: string(m.Key), Value: m.Value, Headers: make(map[string]string, len(m.Headers))}
+		for _, h := range m.Headers {
+			msg.Headers[h.Key] = string(h.Value)
+		}
+		if err := handler(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("处理 %s 消息失败: %v", topic, err)
+		}
+		if err := reader.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+			log.Printf("提交 %s 位点失败: %v", topic, err)
+		}
+	}
+}
+
+func (b *kafkaBus) Close() error {
+	return b.writer.Close()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsBus 基于 NATS JetStream，消费组对应持久消费者，处理完成后逐条确认。
+// 流由运维按主题预先创建，这里只按主题查找所属的流
+type natsBus struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// newNATSBus 读取 NATS_URL，配置 NATS_CREDS 时使用凭据文件认证
+func newNATSBus() (*natsBus, error) {
+	opts := []nats.Option{
+		nats.Name("gopay-service"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS 连接断开: %v", err)
+			}
+		}),
+	}
+	if creds := os.Getenv("NATS_CREDS"); creds != "" {
+		opts = append(opts, nats.UserCredentials(creds))
+	}
+	conn, err := nats.Connect(envString("NATS_URL", nats.DefaultURL), opts...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &natsBus{conn: conn, js: js}, nil
+}
+
+func (b *natsBus) Publish(ctx context.Context, msg BusMessage) error {
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Value
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+	if msg.Key != "" {
+		m.Header.Set("key", msg.Key)
+	}
+	_, err := b.js.PublishMsg(ctx, m)
+	return err
+}
+
+func (b *natsBus) Subscribe(ctx context.Context, topic, group string, handler func(context.Context, BusMessage) error) error {
+	stream, err := b.js.StreamNameBySubject(ctx, topic)
+	if err != nil {
+		return fmt.Errorf("查找主题 %s 所属的流失败: %w", topic, err)
+	}
+	consumer, err := b.js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       group,
+		FilterSubject: topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       envDuration("NATS_ACK_WAIT", 2*time.Minute),
+	})
+	if err != nil {
+		return fmt.Errorf("创建消费者 %s 失败: %w", group, err)
+	}
+	messages, err := consumer.Messages()
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		messages.Stop()
+	}()
+
+	for {
+		m, err := messages.Next()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return nil
+			}
+			log.Printf("拉取 %s 消息失败: %v", topic, err)
+			continue
+		}
+
+		msg := BusMessage{Topic: m.Subject(), Value: m.Data(), Headers: make(map[string]string, len(m.Headers()))}
+		for k := range m.Headers() {
+			msg.Headers[k] = m.Headers().Get(k)
+		}
+		msg.Key = msg.Headers["key"]
+		if err := handler(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				// 未确认的消息在 AckWait 后重新投递
+				return nil
+			}
+			log.Printf("处理 %s 消息失败: %v", topic, err)
+		}
+		if err := m.Ack(); err != nil {
+			log.Printf("确认 %s 消息失败: %v", topic, err)
+		}
+	}
+}
+
+func (b *natsBus) Close() error {
+	return b.conn.Drain()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 电子发票状态
+const (
+	FapiaoPending = "pending" // 等待支付完成
+	FapiaoIssued  = "issued"
+	FapiaoFailed  = "failed"
+)
+
+// fapiaoRetryDelays 开票失败后的重试间隔
+var fapiaoRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+// InvoiceRequest 下单时提交的购方开票信息
+type InvoiceRequest struct {
+	Type  string `json:"type"` // personal | company
+	Title string `json:"title" binding:"required"`
+	TaxNo string `json:"taxNo"` // 企业抬头必填
+	Email string `json:"email"`
+}
+
+// FapiaoInfo 支付记录上的开票信息及结果
+type FapiaoInfo struct {
+	InvoiceRequest
+	Status     string    `json:"status"`
+	InvoiceNo  string    `json:"invoiceNo,omitempty"`
+	InvoiceURL string    `json:"invoiceUrl,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Attempts   int       `json:"attempts"`
+	IssuedAt   time.Time `json:"issuedAt,omitempty"`
+}
+
+func (r *InvoiceRequest) validate() error {
+	switch r.Type {
+	case "", "personal":
+	case "company":
+		if r.TaxNo == "" {
+			return fmt.Errorf("企业抬头需要纳税人识别号")
+		}
+	default:
+		return fmt.Errorf("不支持的发票抬头类型: %s", r.Type)
+	}
+	return nil
+}
+
+// FapiaoClient 调用第三方电子发票服务，未配置 FAPIAO_API_URL 时不开票
+type FapiaoClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewFapiaoClient() *FapiaoClient {
+	return &FapiaoClient{
+		baseURL:    os.Getenv("FAPIAO_API_URL"),
+		apiKey:     os.Getenv("FAPIAO_API_KEY"),
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (fc *FapiaoClient) Enabled() bool {
+	return fc.baseURL != ""
+}
+
+type fapiaoIssueRequest struct {
+	RequestID string          `json:"requestId"` // 以支付单号作为幂等键
+	OrderID   string          `json:"orderId"`
+	Amount    float64         `json:"amount"`
+	Currency  string          `json:"currency,omitempty"`
+	Subject   string          `json:"subject"`
+	Buyer     *InvoiceRequest `json:"buyer"`
+}
+
+type fapiaoIssueResponse struct {
+	InvoiceNo  string `json:"invoiceNo"`
+	InvoiceURL string `json:"invoiceUrl"`
+}
+
+// Issue 申请开票
+func (fc *FapiaoClient) Issue(ctx context.Context, record *PaymentRecord) (*fapiaoIssueResponse, error) {
+	amount := record.Amount
+	if record.CapturedAmount > 0 {
+		amount = record.CapturedAmount
+	}
+	body, err := json.Marshal(&fapiaoIssueRequest{
+		RequestID: record.PaymentID,
+		OrderID:   record.OrderID,
+		Amount:    amount,
+		Currency:  record.Currency,
+		Subject:   record.Subject,
+		Buyer:     &record.Invoice.InvoiceRequest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fc.baseURL+"/invoices", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if fc.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+fc.apiKey)
+	}
+
+	resp, err := fc.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求发票服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("发票服务返回 %d: %s", resp.StatusCode, respBody)
+	}
+
+	result := new(fapiaoIssueResponse)
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return nil, fmt.Errorf("解析发票服务响应失败: %w", err)
+	}
+	if result.InvoiceURL == "" {
+		return nil, fmt.Errorf("发票服务未返回发票地址")
+	}
+	return result, nil
+}
+
+// requestFapiao 支付成功后异步开票，失败按 fapiaoRetryDelays 重试
+func (ps *PaymentService) requestFapiao(paymentID string) {
+	if !ps.fapiao.Enabled() {
+		return
+	}
+	go func() {
+		for attempt := 0; ; attempt++ {
+			done, err := ps.issueFapiao(paymentID)
+			if done {
+				return
+			}
+			if attempt >= len(fapiaoRetryDelays) {
+				log.Printf("支付 %s 开票失败，已停止重试: %v", paymentID, err)
+				return
+			}
+			time.Sleep(fapiaoRetryDelays[attempt])
+		}
+	}()
+}
+
+// issueFapiao 执行一次开票，done 表示无需再重试
+func (ps *PaymentService) issueFapiao(paymentID string) (done bool, err error) {
+	record, err := ps.store.Get(paymentID)
+	if err != nil || record.Invoice == nil || record.Invoice.Status == FapiaoIssued {
+		return true, err
+	}
+
+	result, issueErr := ps.fapiao.Issue(context.Background(), record)
+
+	// 开票请求期间记录可能被其他流程更新，重新加载后再写入结果
+	if record, err = ps.store.Get(paymentID); err != nil {
+		return true, err
+	}
+	invoice := *record.Invoice
+	invoice.Attempts++
+	if issueErr != nil {
+		invoice.Status = FapiaoFailed
+		invoice.Error = issueErr.Error()
+	} else {
+		invoice.Status = FapiaoIssued
+		invoice.Error = ""
+		invoice.InvoiceNo = result.InvoiceNo
+		invoice.InvoiceURL = result.InvoiceURL
+		invoice.IssuedAt = time.Now()
+	}
+	record.Invoice = &invoice
+	if err := ps.store.Save(record); err != nil {
+		return true, err
+	}
+	return issueErr == nil, issueErr
+}
+
+// registerFapiaoRoutes 注册电子发票接口
+func registerFapiaoRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	api.GET("/payments/:paymentId/invoice", func(c *gin.Context) {
+		record, err := ps.store.Get(c.Param("paymentId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", err.Error())
+			return
+		}
+		if record.Invoice == nil {
+			apierr.RespondError(c, http.StatusNotFound, "INVOICE_NOT_FOUND", "该支付未申请开票")
+			return
+		}
+		apierr.RespondOK(c, record.Invoice)
+	})
+
+	admin := api.Group("/admin")
+
+	// 手动重新开票，用于自动重试用尽后的补开
+	admin.POST("/payments/:paymentId/invoice/retry", func(c *gin.Context) {
+		record, err := ps.store.Get(c.Param("paymentId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", err.Error())
+			return
+		}
+		if record.Invoice == nil || record.Invoice.Status != FapiaoFailed {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_STATE", "仅开票失败的支付可以重试")
+			return
+		}
+		if !ps.fapiao.Enabled() {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_STATE", "未配置电子发票服务")
+			return
+		}
+
+		ps.actions.Record(record.PaymentID, operatorFromRequest(c), "invoice.retry", "")
+		if _, err := ps.issueFapiao(record.PaymentID); err != nil {
+			apierr.RespondError(c, http.StatusBadGateway, "FAPIAO_ERROR", err.Error())
+			return
+		}
+		record, err = ps.store.Get(record.PaymentID)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, record.Invoice)
+	})
+}
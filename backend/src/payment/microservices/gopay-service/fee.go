@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// FeeRule 渠道手续费规则，Channel/Currency 为空表示不限
+type FeeRule struct {
+	Provider    string  `json:"provider"`
+	Channel     string  `json:"channel,omitempty"`
+	Currency    string  `json:"currency,omitempty"`
+	Percent     float64 `json:"percent"`         // 费率，0.006 表示 0.6%
+	Fixed       float64 `json:"fixed,omitempty"` // 每笔固定费用
+	Min         float64 `json:"min,omitempty"`
+	Max         float64 `json:"max,omitempty"`
+	RefundsFees bool    `json:"refundsFees"` // 原路退款时渠道是否按比例退还手续费
+}
+
+func (r *FeeRule) matches(provider, channel, currency string) bool {
+	return r.Provider == provider &&
+		(r.Channel == "" || r.Channel == channel) &&
+		(r.Currency == "" || r.Currency == currency)
+}
+
+// specificity 同时匹配多条规则时，限定条件越多越优先
+func (r *FeeRule) specificity() int {
+	n := 0
+	if r.Channel != "" {
+		n += 2
+	}
+	if r.Currency != "" {
+		n++
+	}
+	return n
+}
+
+// defaultFeeRules 未配置 FEE_SCHEDULE_FILE 时使用的标准费率
+var defaultFeeRules = []FeeRule{
+	{Provider: "alipay", Percent: 0.006, RefundsFees: true},
+	{Provider: "wechat", Percent: 0.006, RefundsFees: true},
+	{Provider: "stripe", Percent: 0.029, Fixed: 0.30},
+	{Provider: "crypto", Percent: 0.01},
+}
+
+// FeeSchedule 手续费配置
+type FeeSchedule struct {
+	mu    sync.RWMutex
+	rules []FeeRule
+}
+
+// NewFeeSchedule 从 FEE_SCHEDULE_FILE 指向的 JSON 文件加载规则
+func NewFeeSchedule() *FeeSchedule {
+	fs := &FeeSchedule{rules: defaultFeeRules}
+	if path := os.Getenv("FEE_SCHEDULE_FILE"); path != "" {
+		if err := fs.loadFile(path); err != nil {
+			log.Printf("加载手续费配置失败，使用默认费率: %v", err)
+		}
+	}
+	return fs
+}
+
+func (fs *FeeSchedule) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rules []FeeRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return err
+	}
+	return fs.Replace(rules)
+}
+
+// Replace 整体替换费率规则
+func (fs *FeeSchedule) Replace(rules []FeeRule) error {
+	for _, r := range rules {
+		if r.Provider == "" {
+			return fmt.Errorf("手续费规则缺少 provider")
+		}
+		if r.Percent < 0 || r.Percent >= 1 || r.Fixed < 0 || r.Min < 0 || r.Max < 0 {
+			return fmt.Errorf("手续费规则 %s 参数无效", r.Provider)
+		}
+		if r.Max > 0 && r.Min > r.Max {
+			return fmt.Errorf("手续费规则 %s 的最低费用高于封顶费用", r.Provider)
+		}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.rules = append([]FeeRule(nil), rules...)
+	return nil
+}
+
+// Rules 返回规则副本
+func (fs *FeeSchedule) Rules() []FeeRule {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return append([]FeeRule(nil), fs.rules...)
+}
+
+// Lookup 返回最匹配的规则，未配置时返回 nil（不收手续费）
+func (fs *FeeSchedule) Lookup(provider, channel, currency string) *FeeRule {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var best *FeeRule
+	for i := range fs.rules {
+		rule := &fs.rules[i]
+		if rule.matches(provider, channel, currency) && (best == nil || rule.specificity() > best.specificity()) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	copied := *best
+	return &copied
+}
+
+// Calculate 计算单笔收款的手续费
+func (fs *FeeSchedule) Calculate(provider, channel, currency string, amount float64) float64 {
+	rule := fs.Lookup(provider, channel, currency)
+	if rule == nil {
+		return 0
+	}
+
+	fee := int64(math.Round(float64(toMinorUnitsIn(amount, currency))*rule.Percent)) + toMinorUnitsIn(rule.Fixed, currency)
+	if min := toMinorUnitsIn(rule.Min, currency); fee < min {
+		fee = min
+	}
+	if max := toMinorUnitsIn(rule.Max, currency); max > 0 && fee > max {
+		fee = max
+	}
+	if gross := toMinorUnitsIn(amount, currency); fee > gross {
+		fee = gross
+	}
+	return fromMinorUnitsIn(fee, currency)
+}
+
+// RefundedFee 原路退款时渠道退还的手续费，按退款金额占实收金额的比例计算，最后一笔退完剩余部分
+func (fs *FeeSchedule) RefundedFee(record *PaymentRecord, amount float64) float64 {
+	if record.Fee <= 0 {
+		return 0
+	}
+	rule := fs.Lookup(record.Method, record.Channel, record.Currency)
+	if rule == nil || !rule.RefundsFees {
+		return 0
+	}
+
+	gross := record.Amount
+	if record.CapturedAmount > 0 {
+		gross = record.CapturedAmount
+	}
+	remaining := toMinorUnitsIn(record.Fee, record.Currency) - toMinorUnitsIn(record.FeeRefunded, record.Currency)
+	if toMinorUnitsIn(record.RefundedAmount+amount, record.Currency) >= toMinorUnitsIn(gross, record.Currency) {
+		return fromMinorUnitsIn(remaining, record.Currency)
+	}
+
+	returned := int64(math.Round(float64(toMinorUnitsIn(record.Fee, record.Currency)) * amount / gross))
+	if returned > remaining {
+		returned = remaining
+	}
+	return fromMinorUnitsIn(returned, record.Currency)
+}
+
+// registerFeeRoutes 注册手续费配置接口
+func registerFeeRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	admin.GET("/fees/schedule", func(c *gin.Context) {
+		apierr.RespondOK(c, ps.fees.Rules())
+	})
+
+	admin.PUT("/fees/schedule", func(c *gin.Context) {
+		var rules []FeeRule
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if err := ps.fees.Replace(rules); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, ps.fees.Rules())
+	})
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrDataKeyUnknown = errors.New("数据密钥对应的主密钥不存在")
+
+// KeyManager 管理加密字段使用的数据密钥。数据密钥由主密钥加密后随密文保存，主密钥不离开 KMS
+type KeyManager interface {
+	// GenerateDataKey 生成数据密钥，返回明文、主密钥加密后的密文和主密钥编号
+	GenerateDataKey() (plaintext, wrapped []byte, keyID string, err error)
+	// DecryptDataKey 用编号对应的主密钥解开数据密钥
+	DecryptDataKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// localKeyManager 使用本地配置的主密钥，供未接入云 KMS 的部署和开发环境使用。
+// FIELD_ENCRYPTION_KEYS 格式为 keyId:base64(32 字节)，逗号分隔；轮换主密钥时追加新密钥并修改
+// FIELD_ENCRYPTION_ACTIVE_KEY，旧密钥保留到历史数据重新加密完成
+type localKeyManager struct {
+	masterKeys map[string][]byte
+	activeID   string
+}
+
+func newLocalKeyManager(raw, activeID string) (*localKeyManager, error) {
+	km := &localKeyManager{masterKeys: make(map[string][]byte), activeID: activeID}
+	for _, item := range splitList(raw) {
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("主密钥格式应为 keyId:base64")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("主密钥 %s 须为 base64 编码的 32 字节", id)
+		}
+		km.masterKeys[id] = key
+		if activeID == "" {
+			km.activeID = id
+		}
+	}
+	if _, ok := km.masterKeys[km.activeID]; !ok {
+		return nil, fmt.Errorf("启用的主密钥 %s 不存在", km.activeID)
+	}
+	return km, nil
+}
+
+func (km *localKeyManager) GenerateDataKey() ([]byte, []byte, string, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, nil, "", err
+	}
+	wrapped, err := aesGCMSeal(km.masterKeys[km.activeID], plaintext)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return plaintext, wrapped, km.activeID, nil
+}
+
+func (km *localKeyManager) DecryptDataKey(keyID string, wrapped []byte) ([]byte, error) {
+	master, ok := km.masterKeys[keyID]
+	if !ok {
+		return nil, ErrDataKeyUnknown
+	}
+	return aesGCMOpen(master, wrapped)
+}
+
+// aesGCMSeal 输出 nonce || ciphertext
+func aesGCMSeal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("密文长度不足")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// SealedData 信封加密的密文：数据密钥由主密钥加密，字段由数据密钥加密
+type SealedData struct {
+	KeyID      string `json:"keyId"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FieldCipher 字段加解密。数据密钥在 FIELD_DATA_KEY_TTL 内复用，避免每次写入都调用 KMS；
+// 解密时按密文中的数据密钥缓存明文密钥
+type FieldCipher struct {
+	kms KeyManager
+	ttl time.Duration
+
+	mu        sync.Mutex
+	plainKey  []byte
+	wrapped   []byte
+	keyID     string
+	createdAt time.Time
+	opened    map[string][]byte
+}
+
+// NewFieldCipher 未配置 FIELD_ENCRYPTION_KEYS 时返回 nil，敏感字段以明文保存
+func NewFieldCipher() *FieldCipher {
+	raw := os.Getenv("FIELD_ENCRYPTION_KEYS")
+	if raw == "" {
+		if currentEnvironment() == "production" {
+			log.Printf("【警告】未配置 FIELD_ENCRYPTION_KEYS，支付元数据和购方信息以明文保存")
+		}
+		return nil
+	}
+	kms, err := newLocalKeyManager(raw, os.Getenv("FIELD_ENCRYPTION_ACTIVE_KEY"))
+	if err != nil {
+		log.Fatalf("加载字段加密主密钥失败: %v", err)
+	}
+	return &FieldCipher{
+		kms:    kms,
+		ttl:    envDuration("FIELD_DATA_KEY_TTL", time.Hour),
+		opened: make(map[string][]byte),
+	}
+}
+
+func (fc *FieldCipher) dataKey() ([]byte, []byte, string, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.plainKey == nil || time.Since(fc.createdAt) > fc.ttl {
+		plain, wrapped, keyID, err := fc.kms.GenerateDataKey()
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("生成数据密钥失败: %w", err)
+		}
+		fc.plainKey, fc.wrapped, fc.keyID, fc.createdAt = plain, wrapped, keyID, time.Now()
+	}
+	return fc.plainKey, fc.wrapped, fc.keyID, nil
+}
+
+// Seal 把 v 序列化后加密
+func (fc *FieldCipher) Seal(v interface{}) (*SealedData, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	key, wrapped, keyID, err := fc.dataKey()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := aesGCMSeal(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &SealedData{KeyID: keyID, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open 解密并反序列化到 v
+func (fc *FieldCipher) Open(sealed *SealedData, v interface{}) error {
+	cacheKey := sealed.KeyID + ":" + base64.StdEncoding.EncodeToString(sealed.WrappedKey)
+
+	fc.mu.Lock()
+	key, ok := fc.opened[cacheKey]
+	fc.mu.Unlock()
+	if !ok {
+		var err error
+		if key, err = fc.kms.DecryptDataKey(sealed.KeyID, sealed.WrappedKey); err != nil {
+			return fmt.Errorf("解密数据密钥失败: %w", err)
+		}
+		fc.mu.Lock()
+		fc.opened[cacheKey] = key
+		fc.mu.Unlock()
+	}
+
+	plaintext, err := aesGCMOpen(key, sealed.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("解密字段失败: %w", err)
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// sealedPaymentFields 支付记录中加密保存的字段
+type sealedPaymentFields struct {
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	Buyer             *InvoiceRequest        `json:"buyer,omitempty"`             // 开票购方抬头、税号、邮箱
+	ScheduledMetadata map[string]interface{} `json:"scheduledMetadata,omitempty"` // 预约支付保存的原始请求
+	ScheduledBuyer    *InvoiceRequest        `json:"scheduledBuyer,omitempty"`
+}
+
+// encryptedPaymentStore 在写入底层存储前加密敏感字段，读取时透明解密，业务代码始终看到明文
+type encryptedPaymentStore struct {
+	PaymentStore
+	cipher *FieldCipher
+}
+
+// NewEncryptedPaymentStore cipher 为 nil 时直接返回底层存储
+func NewEncryptedPaymentStore(inner PaymentStore, cipher *FieldCipher) PaymentStore {
+	if cipher == nil {
+		return inner
+	}
+	return &encryptedPaymentStore{PaymentStore: inner, cipher: cipher}
+}
+
+func (s *encryptedPaymentStore) Save(record *PaymentRecord) error {
+	sealed := *record
+	var fields sealedPaymentFields
+
+	fields.Metadata, sealed.Metadata = record.Metadata, nil
+	if record.Invoice != nil {
+		invoice := *record.Invoice
+		buyer := invoice.InvoiceRequest
+		fields.Buyer = &buyer
+		invoice.InvoiceRequest = InvoiceRequest{Type: buyer.Type}
+		sealed.Invoice = &invoice
+	}
+	if record.Scheduled != nil {
+		scheduled := *record.Scheduled
+		fields.ScheduledMetadata, scheduled.Request.Metadata = scheduled.Request.Metadata, nil
+		fields.ScheduledBuyer, scheduled.Request.Invoice = scheduled.Request.Invoice, nil
+		sealed.Scheduled = &scheduled
+	}
+
+	data, err := s.cipher.Seal(&fields)
+	if err != nil {
+		return err
+	}
+	sealed.Sealed = data
+	if err := s.PaymentStore.Save(&sealed); err != nil {
+		return err
+	}
+	// 底层存储会回写创建和更新时间
+	record.CreatedAt, record.UpdatedAt = sealed.CreatedAt, sealed.UpdatedAt
+	return nil
+}
+
+func (s *encryptedPaymentStore) open(record *PaymentRecord) (*PaymentRecord, error) {
+	if record.Sealed == nil {
+		// 启用加密前写入的明文记录
+		return record, nil
+	}
+	var fields sealedPaymentFields
+	if err := s.cipher.Open(record.Sealed, &fields); err != nil {
+		return nil, fmt.Errorf("支付记录 %s: %w", record.PaymentID, err)
+	}
+	record.Sealed = nil
+	record.Metadata = fields.Metadata
+	if record.Invoice != nil && fields.Buyer != nil {
+		invoice := *record.Invoice
+		invoice.InvoiceRequest = *fields.Buyer
+		record.Invoice = &invoice
+	}
+	if record.Scheduled != nil {
+		scheduled := *record.Scheduled
+		scheduled.Request.Metadata = fields.ScheduledMetadata
+		scheduled.Request.Invoice = fields.ScheduledBuyer
+		record.Scheduled = &scheduled
+	}
+	return record, nil
+}
+
+func (s *encryptedPaymentStore) Get(paymentID string) (*PaymentRecord, error) {
+	record, err := s.PaymentStore.Get(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(record)
+}
+
+func (s *encryptedPaymentStore) List() ([]*PaymentRecord, error) {
+	records, err := s.PaymentStore.List()
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(records)
+}
+
+// Find 可检索字段均为明文列，直接交给底层存储过滤
+func (s *encryptedPaymentStore) Find(filter FilterExpr) ([]*PaymentRecord, error) {
+	records, err := s.PaymentStore.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(records)
+}
+
+func (s *encryptedPaymentStore) openAll(records []*PaymentRecord) ([]*PaymentRecord, error) {
+	for i, record := range records {
+		opened, err := s.open(record)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = opened
+	}
+	return records, nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 管理端支付检索的过滤表达式，例如:
+//
+//	status:paid AND amount>100 AND method:wechat AND created:2024-11-*
+//
+// 支持 AND / OR / NOT 和括号，相邻条件之间默认为 AND。
+// 表达式既可以编译为参数化 SQL，也可以直接在内存中匹配记录。
+
+const (
+	maxFilterLength     = 512
+	maxFilterConditions = 20
+)
+
+type filterFieldKind int
+
+const (
+	fieldString filterFieldKind = iota
+	fieldNumber
+	fieldTime
+)
+
+type filterField struct {
+	column string
+	kind   filterFieldKind
+	value  func(*PaymentRecord) interface{}
+}
+
+// filterFields 允许检索的字段白名单，SQL 列名只能来自这里
+var filterFields = map[string]filterField{
+	"status":   {column: "status", kind: fieldString, value: func(r *PaymentRecord) interface{} { return r.Status }},
+	"method":   {column: "method", kind: fieldString, value: func(r *PaymentRecord) interface{} { return r.Method }},
+	"currency": {column: "currency", kind: fieldString, value: func(r *PaymentRecord) interface{} { return r.Currency }},
+	"order":    {column: "order_id", kind: fieldString, value: func(r *PaymentRecord) interface{} { return r.OrderID }},
+	"payment":  {column: "payment_id", kind: fieldString, value: func(r *PaymentRecord) interface{} { return r.PaymentID }},
+	"amount":   {column: "amount", kind: fieldNumber, value: func(r *PaymentRecord) interface{} { return r.Amount }},
+	"created":  {column: "created_at", kind: fieldTime, value: func(r *PaymentRecord) interface{} { return r.CreatedAt }},
+	"updated":  {column: "updated_at", kind: fieldTime, value: func(r *PaymentRecord) interface{} { return r.UpdatedAt }},
+}
+
+// FilterExpr 解析后的过滤表达式
+type FilterExpr interface {
+	Match(record *PaymentRecord) bool
+	writeSQL(b *sqlBuilder)
+}
+
+type andExpr struct{ left, right FilterExpr }
+type orExpr struct{ left, right FilterExpr }
+type notExpr struct{ inner FilterExpr }
+
+type conditionExpr struct {
+	field    string
+	op       string
+	raw      string
+	number   float64
+	from, to time.Time
+}
+
+func (e *andExpr) Match(r *PaymentRecord) bool { return e.left.Match(r) && e.right.Match(r) }
+func (e *orExpr) Match(r *PaymentRecord) bool  { return e.left.Match(r) || e.right.Match(r) }
+func (e *notExpr) Match(r *PaymentRecord) bool { return !e.inner.Match(r) }
+
+func (e *andExpr) writeSQL(b *sqlBuilder) {
+	b.sb.WriteString("(")
+	e.left.writeSQL(b)
+	b.sb.WriteString(" AND ")
+	e.right.writeSQL(b)
+	b.sb.WriteString(")")
+}
+
+func (e *orExpr) writeSQL(b *sqlBuilder) {
+	b.sb.WriteString("(")
+	e.left.writeSQL(b)
+	b.sb.WriteString(" OR ")
+	e.right.writeSQL(b)
+	b.sb.WriteString(")")
+}
+
+func (e *notExpr) writeSQL(b *sqlBuilder) {
+	b.sb.WriteString("NOT (")
+	e.inner.writeSQL(b)
+	b.sb.WriteString(")")
+}
+
+func (e *conditionExpr) Match(r *PaymentRecord) bool {
+	field := filterFields[e.field]
+	switch field.kind {
+	case fieldNumber:
+		return compareNumber(field.value(r).(float64), e.op, e.number)
+	case fieldTime:
+		return compareTime(field.value(r).(time.Time), e.op, e.from, e.to)
+	default:
+		actual := strings.ToLower(field.value(r).(string))
+		expected := strings.ToLower(e.raw)
+		matched := actual == expected
+		if strings.Contains(expected, "*") {
+			matched = wildcardMatch(expected, actual)
+		}
+		if e.op == "!=" {
+			return !matched
+		}
+		return matched
+	}
+}
+
+func (e *conditionExpr) writeSQL(b *sqlBuilder) {
+	field := filterFields[e.field]
+	column := field.column
+
+	switch field.kind {
+	case fieldNumber:
+		b.sb.WriteString(column + " " + sqlOperator(e.op) + " ?")
+		b.args = append(b.args, e.number)
+	case fieldTime:
+		// 时间列保存为 Unix 纳秒
+		from, to := e.from.UnixNano(), e.to.UnixNano()
+		switch e.op {
+		case ":", "=":
+			b.sb.WriteString("(" + column + " >= ? AND " + column + " < ?)")
+			b.args = append(b.args, from, to)
+		case "!=":
+			b.sb.WriteString("(" + column + " < ? OR " + column + " >= ?)")
+			b.args = append(b.args, from, to)
+		case ">":
+			b.sb.WriteString(column + " >= ?")
+			b.args = append(b.args, to)
+		case ">=":
+			b.sb.WriteString(column + " >= ?")
+			b.args = append(b.args, from)
+		case "<":
+			b.sb.WriteString(column + " < ?")
+			b.args = append(b.args, from)
+		case "<=":
+			b.sb.WriteString(column + " < ?")
+			b.args = append(b.args, to)
+		}
+	default:
+		if strings.Contains(e.raw, "*") {
+			op := "LIKE"
+			if e.op == "!=" {
+				op = "NOT LIKE"
+			}
+			b.sb.WriteString("LOWER(" + column + ") " + op + " ? ESCAPE '\\'")
+			b.args = append(b.args, likePattern(strings.ToLower(e.raw)))
+			return
+		}
+		b.sb.WriteString("LOWER(" + column + ") " + sqlOperator(e.op) + " ?")
+		b.args = append(b.args, strings.ToLower(e.raw))
+	}
+}
+
+type sqlBuilder struct {
+	sb   strings.Builder
+	args []interface{}
+}
+
+// FilterToSQL 将过滤表达式编译为 WHERE 子句（不含 WHERE 关键字）及参数
+func FilterToSQL(expr FilterExpr) (string, []interface{}) {
+	if expr == nil {
+		return "1=1", nil
+	}
+	b := &sqlBuilder{}
+	expr.writeSQL(b)
+	return b.sb.String(), b.args
+}
+
+// ParseFilter 解析过滤表达式，空字符串返回 nil 表示不过滤
+func ParseFilter(input string) (FilterExpr, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, nil
+	}
+	if len(input) > maxFilterLength {
+		return nil, fmt.Errorf("过滤表达式过长，最多 %d 个字符", maxFilterLength)
+	}
+
+	tokens, err := tokenizeFilter(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("无法解析的内容: %s", p.tokens[p.pos])
+	}
+	if p.conditions > maxFilterConditions {
+		return nil, fmt.Errorf("过滤条件过多，最多 %d 个", maxFilterConditions)
+	}
+	return expr, nil
+}
+
+type filterParser struct {
+	tokens     []string
+	pos        int
+	conditions int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) parseOr() (FilterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (FilterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		next := p.peek()
+		if next == "" || next == ")" || strings.EqualFold(next, "OR") {
+			return left, nil
+		}
+		if strings.EqualFold(next, "AND") {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseUnary() (FilterExpr, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("过滤表达式不完整")
+	case strings.EqualFold(token, "NOT"):
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{inner: inner}, nil
+	case token == "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("缺少右括号")
+		}
+		p.pos++
+		return expr, nil
+	case token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR"):
+		return nil, fmt.Errorf("意外的关键字: %s", token)
+	default:
+		p.pos++
+		p.conditions++
+		return parseCondition(token)
+	}
+}
+
+// tokenizeFilter 按空白和括号切分，双引号内的内容视为一个整体
+func tokenizeFilter(input string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	inQuote := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, ch := range input {
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+		case inQuote:
+			current.WriteRune(ch)
+		case unicode.IsSpace(ch):
+			flush()
+		case ch == '(' || ch == ')':
+			flush()
+			tokens = append(tokens, string(ch))
+		default:
+			current.WriteRune(ch)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("引号未闭合")
+	}
+	flush()
+	return tokens, nil
+}
+
+var filterOperators = []string{">=", "<=", "!=", ":", "=", ">", "<"}
+
+func parseCondition(token string) (FilterExpr, error) {
+	opIndex, op := -1, ""
+	for i := range token {
+		for _, candidate := range filterOperators {
+			if strings.HasPrefix(token[i:], candidate) {
+				opIndex, op = i, candidate
+				break
+			}
+		}
+		if opIndex >= 0 {
+			break
+		}
+	}
+	if opIndex <= 0 {
+		return nil, fmt.Errorf("无效的过滤条件: %s", token)
+	}
+
+	name := strings.ToLower(token[:opIndex])
+	value := token[opIndex+len(op):]
+	field, ok := filterFields[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的过滤字段: %s", name)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("过滤条件缺少值: %s", token)
+	}
+
+	cond := &conditionExpr{field: name, op: op, raw: value}
+	switch field.kind {
+	case fieldNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s 需要数字: %s", name, value)
+		}
+		cond.number = number
+	case fieldTime:
+		from, to, err := parseDateRange(value)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s 的日期无效: %s", name, value)
+		}
+		cond.from, cond.to = from, to
+	default:
+		if op != ":" && op != "=" && op != "!=" {
+			return nil, fmt.Errorf("字段 %s 不支持运算符 %s", name, op)
+		}
+	}
+	return cond, nil
+}
+
+// parseDateRange 将 2024、2024-11、2024-11-05 及带 * 的前缀解析为 [from, to) 区间
+func parseDateRange(value string) (time.Time, time.Time, error) {
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "*"), "-")
+
+	layouts := []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, value, time.Local); err == nil {
+			return t, l.next(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date")
+}
+
+func sqlOperator(op string) string {
+	switch op {
+	case ":", "=":
+		return "="
+	case "!=":
+		return "<>"
+	default:
+		return op
+	}
+}
+
+func likePattern(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%")
+	return replacer.Replace(value)
+}
+
+func compareNumber(actual float64, op string, expected float64) bool {
+	switch op {
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case "!=":
+		return actual != expected
+	default:
+		return actual == expected
+	}
+}
+
+func compareTime(actual time.Time, op string, from, to time.Time) bool {
+	switch op {
+	case ">":
+		return !actual.Before(to)
+	case ">=":
+		return !actual.Before(from)
+	case "<":
+		return actual.Before(from)
+	case "<=":
+		return actual.Before(to)
+	case "!=":
+		return actual.Before(from) || !actual.Before(to)
+	default:
+		return !actual.Before(from) && actual.Before(to)
+	}
+}
+
+// wildcardMatch 仅支持 * 通配符
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if i == len(parts)-1 {
+			return strings.HasSuffix(value, part)
+		}
+		idx := strings.Index(value, part)
+		if idx < 0 {
+			return false
+		}
+		value = value[idx+len(part):]
+	}
+	return true
+}
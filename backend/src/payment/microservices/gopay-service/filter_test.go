@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	cases := []struct {
+		input   string
+		where   string
+		args    []interface{}
+		wantErr string
+	}{
+		{input: "", where: "1=1"},
+		{input: "status:paid", where: "LOWER(status) = ?", args: []interface{}{"paid"}},
+		{input: "status:paid method:wechat", where: "(LOWER(status) = ? AND LOWER(method) = ?)", args: []interface{}{"paid", "wechat"}},
+		{input: "status:paid OR status:refunded AND amount>=100", where: "(LOWER(status) = ? OR (LOWER(status) = ? AND amount >= ?))", args: []interface{}{"paid", "refunded", 100.0}},
+		{input: "NOT (method:alipay OR method:wechat)", where: "NOT ((LOWER(method) = ? OR LOWER(method) = ?))", args: []interface{}{"alipay", "wechat"}},
+		{input: "order:ORD_1*", where: "LOWER(order_id) LIKE ? ESCAPE '\\'", args: []interface{}{"ord\\_1%"}},
+		{input: "currency!=CNY", where: "LOWER(currency) <> ?", args: []interface{}{"cny"}},
+		{input: `payment:"P 1"`, where: "LOWER(payment_id) = ?", args: []interface{}{"p 1"}},
+		{input: "amount>abc", wantErr: "需要数字"},
+		{input: "created:2024-13", wantErr: "日期无效"},
+		{input: "status>paid", wantErr: "不支持运算符"},
+		{input: "secret:1", wantErr: "不支持的过滤字段"},
+		{input: "status:", wantErr: "缺少值"},
+		{input: "(status:paid", wantErr: "缺少右括号"},
+		{input: "status:paid)", wantErr: "无法解析"},
+		{input: "AND status:paid", wantErr: "意外的关键字"},
+		{input: `order:"abc`, wantErr: "引号未闭合"},
+		{input: strings.Repeat("status:paid ", 21), wantErr: "过滤条件过多"},
+		{input: "order:" + strings.Repeat("a", maxFilterLength), wantErr: "过滤表达式过长"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			expr, err := ParseFilter(tc.input)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("预期错误包含 %q，实际: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			where, args := FilterToSQL(expr)
+			if where != tc.where || !reflect.DeepEqual(args, tc.args) {
+				t.Fatalf("编译为 %s %v，预期 %s %v", where, args, tc.where, tc.args)
+			}
+		})
+	}
+}
+
+func TestFilterTimeRange(t *testing.T) {
+	expr, err := ParseFilter("created:2024-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 11, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2024, 12, 1, 0, 0, 0, 0, time.Local)
+	where, args := FilterToSQL(expr)
+	if where != "(created_at >= ? AND created_at < ?)" || !reflect.DeepEqual(args, []interface{}{from.UnixNano(), to.UnixNano()}) {
+		t.Fatalf("编译为 %s %v", where, args)
+	}
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{from, true},
+		{to.Add(-time.Nanosecond), true},
+		{to, false},
+		{from.Add(-time.Nanosecond), false},
+	} {
+		if got := expr.Match(&PaymentRecord{CreatedAt: tc.at}); got != tc.want {
+			t.Errorf("%s 匹配结果 %v，预期 %v", tc.at, got, tc.want)
+		}
+	}
+}
+
+// TestSQLiteFindMatchesMemory 同一表达式在 SQLite 中过滤与内存匹配的结果一致
+func TestSQLiteFindMatchesMemory(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+	memory := NewMemoryPaymentStore()
+	base := time.Date(2024, 11, 5, 12, 0, 0, 0, time.Local)
+	records := []*PaymentRecord{
+		{PaymentID: "P1", OrderID: "ORD_1", Method: "alipay", Amount: 88.5, Currency: "CNY", Status: StatusPaid, CreatedAt: base},
+		{PaymentID: "P2", OrderID: "ORD-2", Method: "wechat", Amount: 120, Currency: "CNY", Status: StatusRefunded, CreatedAt: base.AddDate(0, 0, 1)},
+		{PaymentID: "P3", OrderID: "ORDX1", Method: "stripe", Amount: 1000, Currency: "JPY", Status: StatusPending, CreatedAt: base.AddDate(0, 1, 0)},
+		{PaymentID: "P4", OrderID: "ord_10", Method: "Stripe", Amount: 1.005, Currency: "KWD", Status: StatusPaid, CreatedAt: base.AddDate(0, 0, -10)},
+	}
+	for _, record := range records {
+		copied := *record
+		if err := repo.Payments.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.Save(&copied); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, input := range []string{
+		"",
+		"status:paid",
+		"method:stripe",
+		"order:ORD_1*",
+		"order:ord*1",
+		"currency!=cny",
+		"amount>100 OR status:pending",
+		"amount<=88.5",
+		"created:2024-11",
+		"created>2024-11-05",
+		"created<2024-11-05 OR created!=2024",
+		"NOT (method:alipay OR method:wechat) AND status:paid",
+		"updated>2000",
+	} {
+		expr, err := ParseFilter(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		got, err := repo.Payments.Find(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		want, err := memory.Find(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids(got) != ids(want) {
+			t.Errorf("%q: SQLite 返回 %s，内存匹配 %s", input, ids(got), ids(want))
+		}
+	}
+}
+
+func ids(records []*PaymentRecord) string {
+	var parts []string
+	for _, r := range records {
+		parts = append(parts, r.PaymentID)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 礼品卡状态
+const (
+	GiftCardInactive  = "inactive"  // 已制卡未售出
+	GiftCardActive    = "active"    // 已激活可使用
+	GiftCardExhausted = "exhausted" // 余额用尽
+	GiftCardLocked    = "locked"    // 密码错误次数过多
+)
+
+// maxPinAttempts 连续输错密码达到该次数后锁卡
+const maxPinAttempts = 5
+
+var (
+	ErrGiftCardNotFound = errors.New("礼品卡不存在")
+	ErrGiftCardPIN      = errors.New("礼品卡密码错误")
+)
+
+// GiftCard 礼品卡，余额为商户负债，密码只保存摘要
+type GiftCard struct {
+	CardNo         string    `json:"cardNo"`
+	PinHash        string    `json:"-"`
+	Currency       string    `json:"currency,omitempty"`
+	InitialValue   float64   `json:"initialValue"`
+	Balance        float64   `json:"balance"`
+	Status         string    `json:"status"`
+	FailedAttempts int       `json:"-"`
+	ExpiresAt      time.Time `json:"expiresAt,omitempty"`
+	ActivatedAt    time.Time `json:"activatedAt,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// GiftCardStore 礼品卡存储
+type GiftCardStore interface {
+	Save(card *GiftCard) error
+	Get(cardNo string) (*GiftCard, error)
+	List() ([]*GiftCard, error)
+}
+
+type memoryGiftCardStore struct {
+	mu    sync.RWMutex
+	cards map[string]*GiftCard
+}
+
+func NewMemoryGiftCardStore() GiftCardStore {
+	return &memoryGiftCardStore{cards: make(map[string]*GiftCard)}
+}
+
+func (s *memoryGiftCardStore) Save(card *GiftCard) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if card.CreatedAt.IsZero() {
+		card.CreatedAt = now
+	}
+	card.UpdatedAt = now
+
+	copied := *card
+	s.cards[card.CardNo] = &copied
+	return nil
+}
+
+func (s *memoryGiftCardStore) Get(cardNo string) (*GiftCard, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	card, ok := s.cards[cardNo]
+	if !ok {
+		return nil, ErrGiftCardNotFound
+	}
+	copied := *card
+	return &copied, nil
+}
+
+func (s *memoryGiftCardStore) List() ([]*GiftCard, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cards := make([]*GiftCard, 0, len(s.cards))
+	for _, card := range s.cards {
+		copied := *card
+		cards = append(cards, &copied)
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].CreatedAt.After(cards[j].CreatedAt)
+	})
+	return cards, nil
+}
+
+type IssueGiftCardRequest struct {
+	Value         float64 `json:"value" binding:"required"`
+	Currency      string  `json:"currency"`
+	Count         int     `json:"count"` // 为空时制 1 张
+	ExpiresInDays int     `json:"expiresInDays"`
+}
+
+// IssuedGiftCard 制卡结果，密码仅在制卡时返回一次
+type IssuedGiftCard struct {
+	CardNo    string  `json:"cardNo"`
+	PIN       string  `json:"pin"`
+	Value     float64 `json:"value"`
+	ExpiresAt string  `json:"expiresAt,omitempty"`
+}
+
+type GiftCardBalanceRequest struct {
+	CardNo string `json:"cardNo" binding:"required"`
+	PIN    string `json:"pin" binding:"required"`
+}
+
+// GiftCardService 礼品卡制卡、激活、查询余额及支付
+type GiftCardService struct {
+	cards  GiftCardStore
+	secret []byte
+	mu     sync.Mutex
+}
+
+func NewGiftCardService(cards GiftCardStore) *GiftCardService {
+	secret := os.Getenv("GIFTCARD_PIN_SECRET")
+	if secret == "" {
+		log.Printf("未配置 GIFTCARD_PIN_SECRET，礼品卡密码摘要使用随机密钥，重启后已制卡密码将失效")
+		secret = util.RandomString(32)
+	}
+	return &GiftCardService{
+		cards:  cards,
+		secret: []byte(secret),
+	}
+}
+
+func (gs *GiftCardService) hashPIN(cardNo, pin string) string {
+	mac := hmac.New(sha256.New, gs.secret)
+	mac.Write([]byte(cardNo + ":" + pin))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Issue 批量制卡，新卡为未激活状态
+func (gs *GiftCardService) Issue(req *IssueGiftCardRequest) (*apierr.Response, error) {
+	if req.Value <= 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "面值必须大于0"), nil
+	}
+	count := req.Count
+	if count <= 0 {
+		count = 1
+	}
+	if count > 1000 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "单次最多制卡 1000 张"), nil
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresInDays > 0 {
+		expiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays)
+	}
+
+	issued := make([]*IssuedGiftCard, 0, count)
+	for i := 0; i < count; i++ {
+		cardNo := "GC" + util.RandomNumber(16)
+		pin := util.RandomNumber(8)
+		card := &GiftCard{
+			CardNo:       cardNo,
+			PinHash:      gs.hashPIN(cardNo, pin),
+			Currency:     req.Currency,
+			InitialValue: roundAmountIn(req.Value, req.Currency),
+			Balance:      roundAmountIn(req.Value, req.Currency),
+			Status:       GiftCardInactive,
+			ExpiresAt:    expiresAt,
+		}
+		if err := gs.cards.Save(card); err != nil {
+			return nil, err
+		}
+		issued = append(issued, &IssuedGiftCard{
+			CardNo:    cardNo,
+			PIN:       pin,
+			Value:     card.InitialValue,
+			ExpiresAt: formatTime(expiresAt),
+		})
+	}
+	return apierr.SuccessResponse(issued), nil
+}
+
+// Activate 激活礼品卡（售出），卡面余额记为商户负债
+func (gs *GiftCardService) Activate(cardNo string, ledger Ledger) (*apierr.Response, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	card, err := gs.cards.Get(cardNo)
+	if err != nil {
+		return apierr.ErrorResponse("GIFTCARD_NOT_FOUND", err.Error()), nil
+	}
+	if card.Status != GiftCardInactive {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许激活: %s", card.Status)), nil
+	}
+
+	description := fmt.Sprintf("礼品卡激活 %s", card.CardNo)
+	if err := ledger.Post(
+		LedgerEntry{TxnID: card.CardNo, Account: "clearing:giftcard_sales", Direction: Debit, Amount: card.Balance, Currency: card.Currency, Description: description},
+		LedgerEntry{TxnID: card.CardNo, Account: "giftcard:" + card.CardNo, Direction: Credit, Amount: card.Balance, Currency: card.Currency, Description: description},
+	); err != nil {
+		return nil, err
+	}
+
+	card.Status = GiftCardActive
+	card.ActivatedAt = time.Now()
+	if err := gs.cards.Save(card); err != nil {
+		return nil, err
+	}
+	return apierr.SuccessResponse(card), nil
+}
+
+// verify 校验卡号密码，连续输错达到上限后锁卡
+func (gs *GiftCardService) verify(cardNo, pin string) (*GiftCard, error) {
+	card, err := gs.cards.Get(cardNo)
+	if err != nil {
+		return nil, err
+	}
+	if card.Status == GiftCardLocked {
+		return nil, fmt.Errorf("礼品卡已锁定")
+	}
+	if !hmac.Equal([]byte(card.PinHash), []byte(gs.hashPIN(cardNo, pin))) {
+		card.FailedAttempts++
+		if card.FailedAttempts >= maxPinAttempts {
+			card.Status = GiftCardLocked
+			log.Printf("礼品卡 %s 密码连续错误 %d 次，已锁定", cardNo, card.FailedAttempts)
+		}
+		if err := gs.cards.Save(card); err != nil {
+			return nil, err
+		}
+		return nil, ErrGiftCardPIN
+	}
+	if card.FailedAttempts > 0 {
+		card.FailedAttempts = 0
+		if err := gs.cards.Save(card); err != nil {
+			return nil, err
+		}
+	}
+	return card, nil
+}
+
+// Balance 校验密码后返回余额
+func (gs *GiftCardService) Balance(req *GiftCardBalanceRequest) (*apierr.Response, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	card, err := gs.verify(req.CardNo, req.PIN)
+	if err != nil {
+		return apierr.ErrorResponse("GIFTCARD_DENIED", err.Error()), nil
+	}
+	return apierr.SuccessResponse(card), nil
+}
+
+// Redeem 从礼品卡扣款，支持部分使用
+func (gs *GiftCardService) Redeem(cardNo, pin, currency string, amount float64) (*GiftCard, *apierr.Response, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	card, err := gs.verify(cardNo, pin)
+	if err != nil {
+		return nil, apierr.ErrorResponse("GIFTCARD_DENIED", err.Error()), nil
+	}
+	if card.Status != GiftCardActive {
+		return nil, apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("礼品卡不可用: %s", card.Status)), nil
+	}
+	if !card.ExpiresAt.IsZero() && time.Now().After(card.ExpiresAt) {
+		return nil, apierr.ErrorResponse("INVALID_STATE", "礼品卡已过期"), nil
+	}
+	if card.Currency != currency {
+		return nil, apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("礼品卡币种 %s 与订单币种 %s 不一致", card.Currency, currency)), nil
+	}
+	if toMinorUnitsIn(card.Balance, card.Currency) < toMinorUnitsIn(amount, card.Currency) {
+		return nil, apierr.ErrorResponse("INSUFFICIENT_BALANCE", fmt.Sprintf("礼品卡余额 %.2f 不足", card.Balance)), nil
+	}
+
+	card.Balance = roundAmountIn(card.Balance-amount, card.Currency)
+	if toMinorUnitsIn(card.Balance, card.Currency) == 0 {
+		card.Status = GiftCardExhausted
+	}
+	if err := gs.cards.Save(card); err != nil {
+		return nil, nil, err
+	}
+	return card, nil, nil
+}
+
+// Restore 退款时把金额退回礼品卡
+func (gs *GiftCardService) Restore(cardNo string, amount float64) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	card, err := gs.cards.Get(cardNo)
+	if err != nil {
+		return err
+	}
+	card.Balance = roundAmountIn(card.Balance+amount, card.Currency)
+	if card.Status == GiftCardExhausted {
+		card.Status = GiftCardActive
+	}
+	return gs.cards.Save(card)
+}
+
+// payWithGiftCard 礼品卡支付，扣款成功即支付完成
+func (ps *PaymentService) payWithGiftCard(req *PaymentRequest) (*apierr.Response, error) {
+	if req.GiftCardNo == "" || req.GiftCardPIN == "" {
+		return apierr.ErrorResponse("INVALID_PARAMS", "礼品卡支付需要 giftCardNo 和 giftCardPin"), nil
+	}
+	if _, err := ps.store.Get(req.OrderID); err == nil {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已存在支付记录: %s", req.OrderID)), nil
+	}
+
+	amount := roundAmountIn(req.Amount, req.Currency)
+	card, failure, err := ps.giftCards.Redeem(req.GiftCardNo, req.GiftCardPIN, req.Currency, amount)
+	if err != nil || failure != nil {
+		return failure, err
+	}
+
+	description := fmt.Sprintf("礼品卡支付 %s", req.OrderID)
+	if err := ps.ledger.Post(
+		LedgerEntry{TxnID: req.OrderID, Account: "giftcard:" + card.CardNo, Direction: Debit, Amount: amount, Currency: req.Currency, Description: description},
+		LedgerEntry{TxnID: req.OrderID, Account: "merchant:sales", Direction: Credit, Amount: amount, Currency: req.Currency, Description: description},
+	); err != nil {
+		return nil, err
+	}
+
+	if err := ps.recordPayment(req, nil); err != nil {
+		return nil, err
+	}
+	record, err := ps.store.Get(req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	record.GiftCardNo = card.CardNo
+	record.Status = StatusPaid
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	log.Printf("订单 %s 礼品卡支付成功，卡号 %s 剩余余额 %.2f", req.OrderID, card.CardNo, card.Balance)
+	ps.afterPaid(record)
+
+	return apierr.SuccessResponse(&PaymentData{
+		PaymentID: req.OrderID,
+		Status:    StatusPaid,
+	}), nil
+}
+
+// registerGiftCardRoutes 注册礼品卡接口
+func registerGiftCardRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	api.POST("/giftcards/balance", func(c *gin.Context) {
+		var req GiftCardBalanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.giftCards.Balance(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin := api.Group("/admin")
+
+	admin.POST("/giftcards", func(c *gin.Context) {
+		var req IssueGiftCardRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.giftCards.Issue(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.POST("/giftcards/:cardNo/activate", func(c *gin.Context) {
+		resp, err := ps.giftCards.Activate(c.Param("cardNo"), ps.ledger)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.GET("/giftcards/:cardNo", func(c *gin.Context) {
+		card, err := ps.giftCards.cards.Get(c.Param("cardNo"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "GIFTCARD_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, card)
+	})
+}
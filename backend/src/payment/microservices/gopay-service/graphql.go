@@ -0,0 +1,589 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"gopay-service/internal/apierr"
+)
+
+// maxGraphQLDepth 查询允许的最大嵌套深度，避免 payment.refunds.payment.refunds... 无限展开
+const maxGraphQLDepth = 8
+
+// backofficeSchema 管理后台使用的只读 GraphQL 接口，一次请求即可取到支付详情页所需的
+// 支付、分段、退款、时间线等关联数据
+const backofficeSchema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	payment(id: ID!): Payment
+	# filter 为与 GET /admin/payments 相同的过滤表达式，如 "status:paid AND amount>100"
+	payments(filter: String, tenantId: String, first: Int = 20, after: String): PaymentConnection!
+	refund(id: ID!): Refund
+	# 按创建时间倒序
+	refunds(paymentId: ID, status: String, tenantId: String, first: Int = 20, after: String): RefundConnection!
+	# 结算对账报表，需要财务或只读角色
+	settlementReport(id: ID!): SettlementReport
+	settlementReports(period: String): [SettlementReport!]!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+	endCursor: String
+}
+
+type PaymentConnection {
+	totalCount: Int!
+	nodes: [Payment!]!
+	pageInfo: PageInfo!
+}
+
+type RefundConnection {
+	totalCount: Int!
+	nodes: [Refund!]!
+	pageInfo: PageInfo!
+}
+
+type Payment {
+	paymentId: ID!
+	orderId: String!
+	tenantId: String!
+	method: String!
+	channel: String
+	purpose: String
+	amount: Float!
+	currency: String
+	subject: String
+	status: String!
+	providerTradeNo: String
+	capturedAmount: Float!
+	refundedAmount: Float!
+	fee: Float!
+	feeRefunded: Float!
+	riskScore: Float!
+	riskDecision: String
+	sagaStatus: String
+	expiresAt: Time
+	createdAt: Time!
+	updatedAt: Time!
+	statusHistory: [StatusChange!]!
+	# 组合支付中外部渠道段所属的主记录
+	parent: Payment
+	# 组合支付的各外部渠道段
+	legs: [Payment!]!
+	refunds: [Refund!]!
+	# 状态变化、渠道通知、链上确认、Webhook 推送、运营操作和退款，按时间升序
+	events(source: String): [Event!]!
+}
+
+type StatusChange {
+	from: String
+	to: String!
+	at: Time!
+}
+
+type Refund {
+	refundId: ID!
+	paymentId: ID!
+	tenantId: String!
+	method: String!
+	amount: Float!
+	currency: String
+	destination: String!
+	status: String!
+	reason: String
+	providerRefundNo: String
+	feeReturned: Float!
+	failureReason: String
+	requestedBy: String
+	reviewedBy: String
+	reviewedAt: Time
+	reviewNote: String
+	createdAt: Time!
+	updatedAt: Time!
+	payment: Payment
+}
+
+type Event {
+	at: Time!
+	source: String!
+	event: String!
+	detail: String
+	actor: String
+	paymentId: ID!
+}
+
+type SettlementReport {
+	reportId: ID!
+	period: String!
+	periodStart: Time!
+	periodEnd: Time!
+	generatedAt: Time!
+	uploadedTo: [String!]!
+	lines(provider: String, tenantId: String, currency: String): [SettlementLine!]!
+}
+
+type SettlementLine {
+	provider: String!
+	tenantId: String!
+	currency: String!
+	paymentCount: Int!
+	gross: Float!
+	refundCount: Int!
+	refunds: Float!
+	fees: Float!
+	net: Float!
+}
+`
+
+type principalContextKey struct{}
+
+// registerGraphQLRoutes 注册管理后台 GraphQL 接口 POST /admin/graphql，只支持查询
+func registerGraphQLRoutes(api *gin.RouterGroup, ps *PaymentService, ss *SettlementService) {
+	schema := graphql.MustParseSchema(backofficeSchema, &backofficeResolver{payments: ps, settlements: ss},
+		graphql.MaxDepth(maxGraphQLDepth))
+	admin := api.Group("/admin")
+
+	admin.POST("/graphql", func(c *gin.Context) {
+		var req struct {
+			Query         string                 `json:"query" binding:"required"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		ctx := c.Request.Context()
+		if principal := principalFromRequest(c); principal != nil {
+			ctx = context.WithValue(ctx, principalContextKey{}, principal)
+		}
+		// 按 GraphQL 约定返回 {data, errors}，不使用统一响应信封
+		c.JSON(http.StatusOK, schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	})
+}
+
+// requireRoles 启用 JWT 认证时要求调用方具备任一角色，用于比接口本身要求更严格的字段
+func requireRoles(ctx context.Context, roles []string) error {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	if !ok || principal.HasAny(roles) {
+		return nil
+	}
+	return fmt.Errorf("需要以下角色之一: %s", strings.Join(roles, ", "))
+}
+
+// graphqlPage 将 first/after 参数换算为分页区间，after 为上一页返回的 endCursor
+func graphqlPage(total int, first int32, after *string) (start, end int, err error) {
+	page := apierr.PageParams{Limit: int(first)}
+	if page.Limit <= 0 {
+		return 0, 0, fmt.Errorf("first 参数无效: %d", first)
+	}
+	if page.Limit > apierr.MaxPageLimit {
+		page.Limit = apierr.MaxPageLimit
+	}
+	if after != nil && *after != "" {
+		if page.Offset, err = apierr.DecodeCursor(*after); err != nil {
+			return 0, 0, err
+		}
+	}
+	start, end = apierr.Paginate(total, page)
+	return start, end, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return defaultTenantID
+	}
+	return tenantID
+}
+
+type backofficeResolver struct {
+	payments    *PaymentService
+	settlements *SettlementService
+}
+
+func (r *backofficeResolver) Payment(args struct{ ID graphql.ID }) (*paymentResolver, error) {
+	return r.payment(string(args.ID))
+}
+
+func (r *backofficeResolver) payment(paymentID string) (*paymentResolver, error) {
+	record, err := r.payments.store.Get(paymentID)
+	if errors.Is(err, ErrPaymentNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &paymentResolver{root: r, record: record}, nil
+}
+
+func (r *backofficeResolver) Payments(args struct {
+	Filter   *string
+	TenantID *string
+	First    int32
+	After    *string
+}) (*connectionResolver[*paymentResolver], error) {
+	query := ""
+	if args.Filter != nil {
+		query = *args.Filter
+	}
+	records, err := r.payments.SearchPayments(query)
+	if err != nil {
+		return nil, err
+	}
+	if args.TenantID != nil {
+		matched := records[:0:0]
+		for _, record := range records {
+			if tenantOrDefault(record.TenantID) == *args.TenantID {
+				matched = append(matched, record)
+			}
+		}
+		records = matched
+	}
+
+	start, end, err := graphqlPage(len(records), args.First, args.After)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*paymentResolver, 0, end-start)
+	for _, record := range records[start:end] {
+		nodes = append(nodes, &paymentResolver{root: r, record: record})
+	}
+	return &connectionResolver[*paymentResolver]{nodes: nodes, total: len(records), end: end}, nil
+}
+
+func (r *backofficeResolver) Refund(args struct{ ID graphql.ID }) (*refundResolver, error) {
+	refund, err := r.payments.refunds.Get(string(args.ID))
+	if errors.Is(err, ErrRefundNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &refundResolver{root: r, refund: refund}, nil
+}
+
+func (r *backofficeResolver) Refunds(args struct {
+	PaymentID *graphql.ID
+	Status    *string
+	TenantID  *string
+	First     int32
+	After     *string
+}) (*connectionResolver[*refundResolver], error) {
+	var refunds []*RefundRecord
+	var err error
+	if args.PaymentID != nil {
+		refunds, err = r.payments.refunds.ListByPayment(string(*args.PaymentID))
+	} else {
+		refunds, err = r.payments.refunds.List()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matched := refunds[:0:0]
+	for _, refund := range refunds {
+		if args.Status != nil && refund.Status != *args.Status {
+			continue
+		}
+		if args.TenantID != nil && tenantOrDefault(refund.TenantID) != *args.TenantID {
+			continue
+		}
+		matched = append(matched, refund)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	start, end, err := graphqlPage(len(matched), args.First, args.After)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*refundResolver, 0, end-start)
+	for _, refund := range matched[start:end] {
+		nodes = append(nodes, &refundResolver{root: r, refund: refund})
+	}
+	return &connectionResolver[*refundResolver]{nodes: nodes, total: len(matched), end: end}, nil
+}
+
+func (r *backofficeResolver) SettlementReport(ctx context.Context, args struct{ ID graphql.ID }) (*settlementReportResolver, error) {
+	if err := requireRoles(ctx, financeRoles); err != nil {
+		return nil, err
+	}
+	report, err := r.settlements.Get(string(args.ID))
+	if errors.Is(err, ErrSettlementNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settlementReportResolver{report: report}, nil
+}
+
+func (r *backofficeResolver) SettlementReports(ctx context.Context, args struct{ Period *string }) ([]*settlementReportResolver, error) {
+	if err := requireRoles(ctx, financeRoles); err != nil {
+		return nil, err
+	}
+	period := ""
+	if args.Period != nil {
+		period = *args.Period
+	}
+	reports := r.settlements.List(period)
+	resolvers := make([]*settlementReportResolver, 0, len(reports))
+	for _, report := range reports {
+		resolvers = append(resolvers, &settlementReportResolver{report: report})
+	}
+	return resolvers, nil
+}
+
+// connectionResolver 分页列表，end 为当前页结束位置，用于生成下一页游标
+type connectionResolver[T any] struct {
+	nodes []T
+	total int
+	end   int
+}
+
+func (c *connectionResolver[T]) TotalCount() int32 { return int32(c.total) }
+func (c *connectionResolver[T]) Nodes() []T        { return c.nodes }
+
+func (c *connectionResolver[T]) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: c.end < c.total}
+	if info.hasNextPage {
+		cursor := apierr.EncodeCursor(c.end)
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (p *pageInfoResolver) HasNextPage() bool  { return p.hasNextPage }
+func (p *pageInfoResolver) EndCursor() *string { return p.endCursor }
+
+type paymentResolver struct {
+	root   *backofficeResolver
+	record *PaymentRecord
+}
+
+func (p *paymentResolver) PaymentID() graphql.ID    { return graphql.ID(p.record.PaymentID) }
+func (p *paymentResolver) OrderID() string          { return p.record.OrderID }
+func (p *paymentResolver) TenantID() string         { return tenantOrDefault(p.record.TenantID) }
+func (p *paymentResolver) Method() string           { return p.record.Method }
+func (p *paymentResolver) Channel() *string         { return optionalString(p.record.Channel) }
+func (p *paymentResolver) Purpose() *string         { return optionalString(p.record.Purpose) }
+func (p *paymentResolver) Amount() float64          { return p.record.Amount }
+func (p *paymentResolver) Currency() *string        { return optionalString(p.record.Currency) }
+func (p *paymentResolver) Subject() *string         { return optionalString(p.record.Subject) }
+func (p *paymentResolver) Status() string           { return p.record.Status }
+func (p *paymentResolver) ProviderTradeNo() *string { return optionalString(p.record.ProviderTradeNo) }
+func (p *paymentResolver) CapturedAmount() float64  { return p.record.CapturedAmount }
+func (p *paymentResolver) RefundedAmount() float64  { return p.record.RefundedAmount }
+func (p *paymentResolver) Fee() float64             { return p.record.Fee }
+func (p *paymentResolver) FeeRefunded() float64     { return p.record.FeeRefunded }
+func (p *paymentResolver) RiskScore() float64       { return p.record.RiskScore }
+func (p *paymentResolver) RiskDecision() *string    { return optionalString(p.record.RiskDecision) }
+func (p *paymentResolver) CreatedAt() graphql.Time  { return graphql.Time{Time: p.record.CreatedAt} }
+func (p *paymentResolver) UpdatedAt() graphql.Time  { return graphql.Time{Time: p.record.UpdatedAt} }
+
+func (p *paymentResolver) ExpiresAt() *graphql.Time {
+	if p.record.ExpiresAt.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: p.record.ExpiresAt}
+}
+
+func (p *paymentResolver) StatusHistory() []*statusChangeResolver {
+	history := make([]*statusChangeResolver, 0, len(p.record.StatusHistory))
+	for _, change := range p.record.StatusHistory {
+		history = append(history, &statusChangeResolver{change: change})
+	}
+	return history
+}
+
+func (p *paymentResolver) SagaStatus() *string {
+	if p.record.Saga == nil {
+		return nil
+	}
+	return optionalString(p.record.Saga.Status)
+}
+
+func (p *paymentResolver) Parent() (*paymentResolver, error) {
+	if p.record.ParentPaymentID == "" {
+		return nil, nil
+	}
+	return p.root.payment(p.record.ParentPaymentID)
+}
+
+func (p *paymentResolver) Legs() ([]*paymentResolver, error) {
+	var legs []*paymentResolver
+	for _, leg := range p.record.Legs {
+		// 余额段没有独立记录，其单号与主记录相同
+		if leg.PaymentID == "" || leg.PaymentID == p.record.PaymentID {
+			continue
+		}
+		resolver, err := p.root.payment(leg.PaymentID)
+		if err != nil {
+			return nil, err
+		}
+		if resolver != nil {
+			legs = append(legs, resolver)
+		}
+	}
+	return legs, nil
+}
+
+func (p *paymentResolver) Refunds() ([]*refundResolver, error) {
+	refunds, err := p.root.payments.refunds.ListByPayment(p.record.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*refundResolver, 0, len(refunds))
+	for _, refund := range refunds {
+		resolvers = append(resolvers, &refundResolver{root: p.root, refund: refund})
+	}
+	return resolvers, nil
+}
+
+func (p *paymentResolver) Events(ctx context.Context, args struct{ Source *string }) ([]*eventResolver, error) {
+	entries, err := p.root.payments.Timeline(ctx, p.record.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*eventResolver, 0, len(entries))
+	for _, entry := range entries {
+		if args.Source != nil && entry.Source != *args.Source {
+			continue
+		}
+		events = append(events, &eventResolver{entry: entry})
+	}
+	return events, nil
+}
+
+type statusChangeResolver struct {
+	change StatusChange
+}
+
+func (s *statusChangeResolver) From() *string    { return optionalString(s.change.From) }
+func (s *statusChangeResolver) To() string       { return s.change.To }
+func (s *statusChangeResolver) At() graphql.Time { return graphql.Time{Time: s.change.At} }
+
+type refundResolver struct {
+	root   *backofficeResolver
+	refund *RefundRecord
+}
+
+func (r *refundResolver) RefundID() graphql.ID      { return graphql.ID(r.refund.RefundID) }
+func (r *refundResolver) PaymentID() graphql.ID     { return graphql.ID(r.refund.PaymentID) }
+func (r *refundResolver) TenantID() string          { return tenantOrDefault(r.refund.TenantID) }
+func (r *refundResolver) Method() string            { return r.refund.Method }
+func (r *refundResolver) Amount() float64           { return r.refund.Amount }
+func (r *refundResolver) Currency() *string         { return optionalString(r.refund.Currency) }
+func (r *refundResolver) Destination() string       { return r.refund.Destination }
+func (r *refundResolver) Status() string            { return r.refund.Status }
+func (r *refundResolver) Reason() *string           { return optionalString(r.refund.Reason) }
+func (r *refundResolver) ProviderRefundNo() *string { return optionalString(r.refund.ProviderRefundNo) }
+func (r *refundResolver) FeeReturned() float64      { return r.refund.FeeReturned }
+func (r *refundResolver) FailureReason() *string    { return optionalString(r.refund.FailureReason) }
+func (r *refundResolver) RequestedBy() *string      { return optionalString(r.refund.RequestedBy) }
+func (r *refundResolver) ReviewedBy() *string       { return optionalString(r.refund.ReviewedBy) }
+func (r *refundResolver) ReviewNote() *string       { return optionalString(r.refund.ReviewNote) }
+func (r *refundResolver) CreatedAt() graphql.Time   { return graphql.Time{Time: r.refund.CreatedAt} }
+func (r *refundResolver) UpdatedAt() graphql.Time   { return graphql.Time{Time: r.refund.UpdatedAt} }
+
+func (r *refundResolver) ReviewedAt() *graphql.Time {
+	if r.refund.ReviewedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.refund.ReviewedAt}
+}
+
+func (r *refundResolver) Payment() (*paymentResolver, error) {
+	return r.root.payment(r.refund.PaymentID)
+}
+
+type eventResolver struct {
+	entry TimelineEntry
+}
+
+func (e *eventResolver) At() graphql.Time      { return graphql.Time{Time: e.entry.At} }
+func (e *eventResolver) Source() string        { return e.entry.Source }
+func (e *eventResolver) Event() string         { return e.entry.Event }
+func (e *eventResolver) Detail() *string       { return optionalString(e.entry.Detail) }
+func (e *eventResolver) Actor() *string        { return optionalString(e.entry.Actor) }
+func (e *eventResolver) PaymentID() graphql.ID { return graphql.ID(e.entry.PaymentID) }
+
+type settlementReportResolver struct {
+	report *SettlementReport
+}
+
+func (s *settlementReportResolver) ReportID() graphql.ID { return graphql.ID(s.report.ReportID) }
+func (s *settlementReportResolver) Period() string       { return s.report.Period }
+func (s *settlementReportResolver) PeriodStart() graphql.Time {
+	return graphql.Time{Time: s.report.PeriodStart}
+}
+func (s *settlementReportResolver) PeriodEnd() graphql.Time {
+	return graphql.Time{Time: s.report.PeriodEnd}
+}
+func (s *settlementReportResolver) GeneratedAt() graphql.Time {
+	return graphql.Time{Time: s.report.GeneratedAt}
+}
+func (s *settlementReportResolver) UploadedTo() []string {
+	return append([]string{}, s.report.UploadedTo...)
+}
+
+func (s *settlementReportResolver) Lines(args struct {
+	Provider *string
+	TenantID *string
+	Currency *string
+}) []*settlementLineResolver {
+	var lines []*settlementLineResolver
+	for _, line := range s.report.Lines {
+		if args.Provider != nil && line.Provider != *args.Provider {
+			continue
+		}
+		if args.TenantID != nil && line.TenantID != *args.TenantID {
+			continue
+		}
+		if args.Currency != nil && line.Currency != *args.Currency {
+			continue
+		}
+		lines = append(lines, &settlementLineResolver{line: line})
+	}
+	return lines
+}
+
+type settlementLineResolver struct {
+	line SettlementLine
+}
+
+func (l *settlementLineResolver) Provider() string    { return l.line.Provider }
+func (l *settlementLineResolver) TenantID() string    { return l.line.TenantID }
+func (l *settlementLineResolver) Currency() string    { return l.line.Currency }
+func (l *settlementLineResolver) PaymentCount() int32 { return int32(l.line.PaymentCount) }
+func (l *settlementLineResolver) Gross() float64      { return l.line.Gross }
+func (l *settlementLineResolver) RefundCount() int32  { return int32(l.line.RefundCount) }
+func (l *settlementLineResolver) Refunds() float64    { return l.line.Refunds }
+func (l *settlementLineResolver) Fees() float64       { return l.line.Fees }
+func (l *settlementLineResolver) Net() float64        { return l.line.Net }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// huabeiFeeRates 花呗分期总手续费率（按期数），来自支付宝花呗分期标准费率
+var huabeiFeeRates = map[int]float64{
+	3:  0.023,
+	6:  0.045,
+	12: 0.075,
+}
+
+// InstallmentOption 下单时选择的分期方案
+type InstallmentOption struct {
+	Periods       int `json:"periods"`       // 分期期数：3 / 6 / 12
+	SellerPercent int `json:"sellerPercent"` // 商家承担手续费比例：0（用户承担）或 100（商家贴息）
+}
+
+// InstallmentPeriod 单期还款明细
+type InstallmentPeriod struct {
+	Period    int     `json:"period"`
+	Principal float64 `json:"principal"`
+	Fee       float64 `json:"fee"`
+	Amount    float64 `json:"amount"`
+}
+
+// InstallmentPlan 分期方案及还款计划
+type InstallmentPlan struct {
+	Periods       int                 `json:"periods"`
+	SellerPercent int                 `json:"sellerPercent"`
+	FeeRate       float64             `json:"feeRate"`
+	TotalFee      float64             `json:"totalFee"`
+	BuyerFee      float64             `json:"buyerFee"`
+	SellerFee     float64             `json:"sellerFee"`
+	Schedule      []InstallmentPeriod `json:"schedule"`
+}
+
+// NewInstallmentPlan 计算分期还款计划，本金和用户手续费除不尽的部分计入第一期
+func NewInstallmentPlan(amount float64, opt *InstallmentOption) (*InstallmentPlan, error) {
+	rate, ok := huabeiFeeRates[opt.Periods]
+	if !ok {
+		return nil, fmt.Errorf("不支持的分期期数: %d", opt.Periods)
+	}
+	if opt.SellerPercent != 0 && opt.SellerPercent != 100 {
+		return nil, fmt.Errorf("商家承担手续费比例只能为 0 或 100: %d", opt.SellerPercent)
+	}
+
+	principal := toMinorUnits(amount)
+	totalFee := int64(math.Round(float64(principal) * rate))
+	sellerFee := totalFee * int64(opt.SellerPercent) / 100
+	buyerFee := totalFee - sellerFee
+
+	n := int64(opt.Periods)
+	schedule := make([]InstallmentPeriod, opt.Periods)
+	for i := range schedule {
+		p := principal / n
+		f := buyerFee / n
+		if i == 0 {
+			p += principal % n
+			f += buyerFee % n
+		}
+		schedule[i] = InstallmentPeriod{
+			Period:    i + 1,
+			Principal: fromMinorUnits(p),
+			Fee:       fromMinorUnits(f),
+			Amount:    fromMinorUnits(p + f),
+		}
+	}
+
+	return &InstallmentPlan{
+		Periods:       opt.Periods,
+		SellerPercent: opt.SellerPercent,
+		FeeRate:       rate,
+		TotalFee:      fromMinorUnits(totalFee),
+		BuyerFee:      fromMinorUnits(buyerFee),
+		SellerFee:     fromMinorUnits(sellerFee),
+		Schedule:      schedule,
+	}, nil
+}
+
+// extendParams 支付宝花呗分期业务扩展参数
+func (p *InstallmentPlan) extendParams() map[string]string {
+	return map[string]string{
+		"hb_fq_num":            strconv.Itoa(p.Periods),
+		"hb_fq_seller_percent": strconv.Itoa(p.SellerPercent),
+	}
+}
+
+func fromMinorUnits(cents int64) float64 {
+	return float64(cents) / 100
+}
@@ -0,0 +1,140 @@
+// Package apierr 支付服务与加密货币网关共用的响应信封、错误响应和分页参数。
+//
+// 业务错误以 success=false 加错误码返回，HTTP 状态码只表示错误类别，
+// 调用方按 code 区分具体原因。
+package apierr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Response 所有接口统一使用的响应信封
+type Response struct {
+	Success bool        `json:"success"`
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
+}
+
+// Meta 响应附加信息
+type Meta struct {
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination 基于游标的分页信息
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// PageParams 从请求中解析出的分页参数
+type PageParams struct {
+	Cursor string
+	Offset int
+	Limit  int
+}
+
+func SuccessResponse(data interface{}) *Response {
+	return &Response{Success: true, Data: data}
+}
+
+func ErrorResponse(code, message string) *Response {
+	return &Response{Success: false, Code: code, Message: message}
+}
+
+func RespondOK(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, SuccessResponse(data))
+}
+
+func RespondError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, ErrorResponse(code, message))
+}
+
+// RespondPage 返回分页列表，items 为当前页数据，total 为本次查询匹配的记录数
+func RespondPage(c *gin.Context, items interface{}, page PageParams, total int) {
+	pagination := &Pagination{
+		Limit:   page.Limit,
+		Cursor:  page.Cursor,
+		HasMore: page.Offset+page.Limit < total,
+	}
+	if pagination.HasMore {
+		pagination.NextCursor = EncodeCursor(page.Offset + page.Limit)
+	}
+
+	c.JSON(http.StatusOK, &Response{
+		Success: true,
+		Data:    items,
+		Meta:    &Meta{Pagination: pagination},
+	})
+}
+
+// ParsePageParams 解析 cursor/limit 查询参数
+func ParsePageParams(c *gin.Context) (PageParams, error) {
+	page := PageParams{
+		Cursor: c.Query("cursor"),
+		Limit:  DefaultPageLimit,
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return page, fmt.Errorf("limit 参数无效: %s", raw)
+		}
+		if limit > MaxPageLimit {
+			limit = MaxPageLimit
+		}
+		page.Limit = limit
+	}
+
+	if page.Cursor != "" {
+		offset, err := DecodeCursor(page.Cursor)
+		if err != nil {
+			return page, err
+		}
+		page.Offset = offset
+	}
+
+	return page, nil
+}
+
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func DecodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("cursor 参数无效")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("cursor 参数无效")
+	}
+	return offset, nil
+}
+
+// Paginate 根据分页参数截取切片区间
+func Paginate(total int, page PageParams) (start, end int) {
+	start = page.Offset
+	if start > total {
+		start = total
+	}
+	end = start + page.Limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
@@ -0,0 +1,77 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sqliteAddressStore 基于 SQLite 的地址池存储，表结构见 migrations/00002_crypto_addresses.sql，
+// 数据库连接由统一入口按 STORE_DRIVER 打开并传入
+type sqliteAddressStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteAddressStore(db *sql.DB) AddressStore {
+	return &sqliteAddressStore{db: db}
+}
+
+func (s *sqliteAddressStore) Save(addr *PooledAddress) error {
+	now := time.Now()
+	if addr.CreatedAt.IsZero() {
+		addr.CreatedAt = now
+	}
+	addr.UpdatedAt = now
+
+	data, err := json.Marshal(addr)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO crypto_addresses (address, chain, derivation_index, status, payment_id, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET status = excluded.status, payment_id = excluded.payment_id,
+			updated_at = excluded.updated_at, data = excluded.data`,
+		addr.Address, addr.Chain, addr.Index, addr.Status, addr.PaymentID, addr.UpdatedAt.UnixNano(), data)
+	return err
+}
+
+func (s *sqliteAddressStore) Get(address string) (*PooledAddress, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM crypto_addresses WHERE address = ?`, address).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	addr := new(PooledAddress)
+	if err := json.Unmarshal(data, addr); err != nil {
+		return nil, fmt.Errorf("解析收款地址失败: %w", err)
+	}
+	return addr, nil
+}
+
+func (s *sqliteAddressStore) List(chain string) ([]*PooledAddress, error) {
+	rows, err := s.db.Query(`SELECT data FROM crypto_addresses WHERE ? = '' OR chain = ?
+		ORDER BY chain, derivation_index`, chain, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []*PooledAddress
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		addr := new(PooledAddress)
+		if err := json.Unmarshal(data, addr); err != nil {
+			return nil, fmt.Errorf("解析收款地址失败: %w", err)
+		}
+		addresses = append(addresses, addr)
+	}
+	return addresses, rows.Err()
+}
@@ -0,0 +1,378 @@
+package cryptogw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 地址状态
+const (
+	AddressReserved  = "reserved"  // 已分配给未付款的账单
+	AddressUsed      = "used"      // 已收到入账，不再分配
+	AddressAvailable = "available" // 账单过期未付款后回收，冷却期过后可重新分配
+)
+
+var ErrAddressNotFound = errors.New("收款地址不存在")
+
+// PooledAddress 地址池中的一个派生地址
+type PooledAddress struct {
+	Address       string    `json:"address"`
+	Chain         string    `json:"chain"`
+	Network       string    `json:"network"` // 最近一次分配时的网络
+	Index         uint32    `json:"index"`
+	Path          string    `json:"path"`
+	Status        string    `json:"status"`
+	PaymentID     string    `json:"paymentId,omitempty"`
+	ReservedUntil time.Time `json:"reservedUntil,omitempty"`
+	LastUsedAt    time.Time `json:"lastUsedAt,omitempty"` // 最近一次分配的账单结束的时间，回收冷却期从此开始
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// AddressStore 地址池存储
+type AddressStore interface {
+	Save(addr *PooledAddress) error
+	Get(address string) (*PooledAddress, error)
+	// List 按派生序号顺序返回指定链的地址，chain 为空时返回全部
+	List(chain string) ([]*PooledAddress, error)
+}
+
+type memoryAddressStore struct {
+	mu        sync.RWMutex
+	addresses map[string]*PooledAddress
+}
+
+func NewMemoryAddressStore() AddressStore {
+	return &memoryAddressStore{addresses: make(map[string]*PooledAddress)}
+}
+
+func (s *memoryAddressStore) Save(addr *PooledAddress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if addr.CreatedAt.IsZero() {
+		addr.CreatedAt = now
+	}
+	addr.UpdatedAt = now
+	copied := *addr
+	s.addresses[addr.Address] = &copied
+	return nil
+}
+
+func (s *memoryAddressStore) Get(address string) (*PooledAddress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addr, ok := s.addresses[address]
+	if !ok {
+		return nil, ErrAddressNotFound
+	}
+	copied := *addr
+	return &copied, nil
+}
+
+func (s *memoryAddressStore) List(chain string) ([]*PooledAddress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var addresses []*PooledAddress
+	for _, addr := range s.addresses {
+		if chain == "" || addr.Chain == chain {
+			copied := *addr
+			addresses = append(addresses, &copied)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if addresses[i].Chain != addresses[j].Chain {
+			return addresses[i].Chain < addresses[j].Chain
+		}
+		return addresses[i].Index < addresses[j].Index
+	})
+	return addresses, nil
+}
+
+// AddressPool 收款地址的分配与回收。
+// 优先复用已过冷却期（ADDRESS_RECYCLE_COOLDOWN）的回收地址，没有时派生新地址；
+// 派生出的未收款地址连续超过 HD_GAP_LIMIT 个时，钱包按 BIP44 扫描会找不到后面的入账，此时提前复用仍在冷却期的地址
+type AddressPool struct {
+	wallet   *HDWallet
+	store    AddressStore
+	gapLimit uint32
+	cooldown time.Duration
+
+	mu sync.Mutex
+}
+
+// NewAddressPool 按已持久化的地址恢复各链的派生序号
+func NewAddressPool(wallet *HDWallet, store AddressStore) (*AddressPool, error) {
+	addresses, err := store.List("")
+	if err != nil {
+		return nil, fmt.Errorf("加载收款地址失败: %w", err)
+	}
+	for _, addr := range addresses {
+		wallet.Reserve(addr.Chain, addr.Index)
+	}
+	return &AddressPool{
+		wallet:   wallet,
+		store:    store,
+		gapLimit: uint32(envInt("HD_GAP_LIMIT", 20)),
+		cooldown: envDuration("ADDRESS_RECYCLE_COOLDOWN", 24*time.Hour),
+	}, nil
+}
+
+// Reserve 为账单分配收款地址，保留到 until
+func (p *AddressPool) Reserve(network, paymentID string, until time.Time) (*PooledAddress, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	chain, ok := networkChains[network]
+	if !ok || !p.wallet.Supports(network) {
+		return nil, fmt.Errorf("网络 %s 未配置扩展公钥", network)
+	}
+	addresses, err := p.store.List(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var recycled []*PooledAddress
+	var highestUsed int64 = -1
+	for _, addr := range addresses {
+		switch addr.Status {
+		case AddressAvailable:
+			recycled = append(recycled, addr)
+		case AddressUsed:
+			highestUsed = max(highestUsed, int64(addr.Index))
+		}
+	}
+	// 空闲最久的地址优先，迟到的转账最有可能已经到账
+	sort.Slice(recycled, func(i, j int) bool { return recycled[i].LastUsedAt.Before(recycled[j].LastUsedAt) })
+
+	var addr *PooledAddress
+	if len(recycled) > 0 && now.Sub(recycled[0].LastUsedAt) >= p.cooldown {
+		addr = recycled[0]
+	} else if gap := p.gap(chain, highestUsed); gap >= p.gapLimit && len(recycled) > 0 {
+		addr = recycled[0]
+		log.Printf("【地址池】%s 链未收款地址已达 gap limit %d，提前复用冷却中的地址 %s", chain, p.gapLimit, addr.Address)
+	} else {
+		if gap >= p.gapLimit {
+			log.Printf("【警告】%s 链连续 %d 个地址未收款，超过 gap limit %d，用钱包恢复资金时需调大扫描范围", chain, gap+1, p.gapLimit)
+		}
+		derived, err := p.wallet.Next(network)
+		if err != nil {
+			return nil, err
+		}
+		addr = &PooledAddress{
+			Address: derived.Address,
+			Chain:   derived.Chain,
+			Index:   derived.Index,
+			Path:    derived.Path,
+		}
+	}
+
+	addr.Network = network
+	addr.Status = AddressReserved
+	addr.PaymentID = paymentID
+	addr.ReservedUntil = until
+	if err := p.store.Save(addr); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// gap 最后一个收过款的地址之后已派生的地址数
+func (p *AddressPool) gap(chain string, highestUsed int64) uint32 {
+	next := p.wallet.NextIndex(chain)
+	return uint32(int64(next) - highestUsed - 1)
+}
+
+// MarkUsed 地址收到入账后不再回收
+func (p *AddressPool) MarkUsed(address, paymentID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addr, err := p.store.Get(address)
+	if errors.Is(err, ErrAddressNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	addr.Status = AddressUsed
+	addr.PaymentID = paymentID
+	addr.LastUsedAt = time.Now()
+	return p.store.Save(addr)
+}
+
+// Recycle 回收保留期已过且账单未付款的地址。账单被延长有效期时顺延保留期，已收到入账的标记为已使用
+func (p *AddressPool) Recycle(invoices InvoiceStore, now time.Time) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addresses, err := p.store.List("")
+	if err != nil {
+		return 0, err
+	}
+	recycled := 0
+	for _, addr := range addresses {
+		if addr.Status != AddressReserved || now.Before(addr.ReservedUntil) {
+			continue
+		}
+		invoice, err := invoices.Get(addr.PaymentID)
+		switch {
+		case errors.Is(err, ErrInvoiceNotFound):
+			// 账单未保存成功，地址直接回收
+		case err != nil:
+			return recycled, err
+		case invoice.TxHash != "":
+			addr.Status = AddressUsed
+			addr.LastUsedAt = invoice.PaidAt
+			if err := p.store.Save(addr); err != nil {
+				return recycled, err
+			}
+			continue
+		case now.Before(invoice.ExpiresAt):
+			addr.ReservedUntil = invoice.ExpiresAt
+			if err := p.store.Save(addr); err != nil {
+				return recycled, err
+			}
+			continue
+		}
+
+		addr.Status = AddressAvailable
+		addr.LastUsedAt = addr.ReservedUntil
+		if err := p.store.Save(addr); err != nil {
+			return recycled, err
+		}
+		recycled++
+	}
+	return recycled, nil
+}
+
+// AddressPoolSummary 单条链的地址池概况
+type AddressPoolSummary struct {
+	Chain     string `json:"chain"`
+	Derived   int    `json:"derived"`
+	Reserved  int    `json:"reserved"`
+	Used      int    `json:"used"`
+	Available int    `json:"available"`
+	Gap       uint32 `json:"gap"` // 最后一个收过款的地址之后已派生的地址数
+	GapLimit  uint32 `json:"gapLimit"`
+}
+
+func (p *AddressPool) Summary() ([]AddressPoolSummary, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addresses, err := p.store.List("")
+	if err != nil {
+		return nil, err
+	}
+	byChain := make(map[string]*AddressPoolSummary)
+	highestUsed := make(map[string]int64)
+	for chain := range p.wallet.chains {
+		byChain[chain] = &AddressPoolSummary{Chain: chain, GapLimit: p.gapLimit}
+		highestUsed[chain] = -1
+	}
+	for _, addr := range addresses {
+		s, ok := byChain[addr.Chain]
+		if !ok {
+			continue
+		}
+		s.Derived++
+		switch addr.Status {
+		case AddressReserved:
+			s.Reserved++
+		case AddressUsed:
+			s.Used++
+			highestUsed[addr.Chain] = max(highestUsed[addr.Chain], int64(addr.Index))
+		case AddressAvailable:
+			s.Available++
+		}
+	}
+
+	summaries := make([]AddressPoolSummary, 0, len(byChain))
+	for chain, s := range byChain {
+		s.Gap = p.gap(chain, highestUsed[chain])
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Chain < summaries[j].Chain })
+	return summaries, nil
+}
+
+// AddressRecycler 定期回收过期未付款账单的地址
+type AddressRecycler struct {
+	crypto   *CryptoService
+	interval time.Duration
+}
+
+func NewAddressRecycler(crypto *CryptoService) *AddressRecycler {
+	return &AddressRecycler{
+		crypto:   crypto,
+		interval: envDuration("ADDRESS_RECYCLE_INTERVAL", 5*time.Minute),
+	}
+}
+
+func (r *AddressRecycler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			recycled, err := r.crypto.addresses.Recycle(r.crypto.invoices, now)
+			if err != nil {
+				log.Printf("回收收款地址失败: %v", err)
+				continue
+			}
+			if recycled > 0 {
+				log.Printf("已回收 %d 个过期未付款账单的收款地址", recycled)
+			}
+		}
+	}
+}
+
+// registerAddressPoolRoutes 注册地址池查询接口
+func registerAddressPoolRoutes(api *gin.RouterGroup, cs *CryptoService) {
+	admin := api.Group("/crypto/admin")
+
+	admin.GET("/addresses", func(c *gin.Context) {
+		addresses, err := cs.addresses.store.List(c.Query("chain"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if status := c.Query("status"); status != "" {
+			filtered := addresses[:0]
+			for _, addr := range addresses {
+				if addr.Status == status {
+					filtered = append(filtered, addr)
+				}
+			}
+			addresses = filtered
+		}
+		apierr.RespondOK(c, addresses)
+	})
+
+	admin.GET("/addresses/summary", func(c *gin.Context) {
+		summaries, err := cs.addresses.Summary()
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, summaries)
+	})
+}
@@ -0,0 +1,33 @@
+package cryptogw
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// AdminAuthenticator 管理接口（/crypto/admin）的认证，由统一入口传入与法币渠道服务共用的 JWT 认证：
+// 按路由要求的角色校验访问令牌，通过后将令牌中的用户名写入 httpmw.OperatorKey
+type AdminAuthenticator interface {
+	Middleware() gin.HandlerFunc
+	// Run 定时刷新签名公钥，随网关后台任务退出
+	Run(ctx context.Context)
+}
+
+// requestOperator 退款、归集、复核等操作的操作人。启用认证时取访问令牌中的用户名，忽略请求中填写的 operator；
+// 未启用认证（本地开发）时取请求中的 operator，为空时返回参数错误
+func requestOperator(c *gin.Context, requested string) (string, bool) {
+	if operator := httpmw.Operator(c); operator != "" {
+		return operator, true
+	}
+	if operator := strings.TrimSpace(requested); operator != "" {
+		return operator, true
+	}
+	apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "operator 不能为空")
+	return "", false
+}
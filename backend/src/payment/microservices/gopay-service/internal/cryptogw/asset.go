@@ -0,0 +1,248 @@
+package cryptogw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Asset 规范化后的币种与网络
+type Asset struct {
+	Currency string `json:"currency"`
+	Network  string `json:"network"`
+}
+
+// Key 地址池等内部映射使用的键，如 USDT_TRC20
+func (a Asset) Key() string {
+	return a.Currency + "_" + a.Network
+}
+
+func (a Asset) String() string {
+	return fmt.Sprintf("%s on %s", a.Currency, networkNames[a.Network])
+}
+
+// supportedAssets 支持的币种及其可用网络，只有一个网络的币种可省略网络
+var supportedAssets = map[string][]string{
+	"USDT": {"TRC20", "ERC20", "BEP20", "POLYGON", "SOL"},
+	"USDC": {"SOL"},
+	"BTC":  {"BTC"},
+	"ETH":  {"ERC20"},
+	"XRP":  {"XRP"},
+	"XLM":  {"XLM"},
+	"TON":  {"TON"},
+}
+
+// networkNames 网络的展示名称
+var networkNames = map[string]string{
+	"TRC20":   "TRON",
+	"ERC20":   "Ethereum",
+	"BEP20":   "BNB Smart Chain",
+	"POLYGON": "Polygon",
+	"BTC":     "Bitcoin",
+	"SOL":     "Solana",
+	"XRP":     "XRP Ledger",
+	"XLM":     "Stellar",
+	"TON":     "TON",
+}
+
+// currencyAliases 币种别名，键为小写
+var currencyAliases = map[string]string{
+	"usdt":    "USDT",
+	"tether":  "USDT",
+	"usdc":    "USDC",
+	"btc":     "BTC",
+	"xbt":     "BTC",
+	"bitcoin": "BTC",
+	"eth":     "ETH",
+	"ether":   "ETH",
+	"xrp":     "XRP",
+	"ripple":  "XRP",
+	"xlm":     "XLM",
+	"stellar": "XLM",
+	"lumens":  "XLM",
+	"ton":     "TON",
+	"toncoin": "TON",
+}
+
+// networkAliases 网络别名，键为小写
+var networkAliases = map[string]string{
+	"trc20":    "TRC20",
+	"trc-20":   "TRC20",
+	"tron":     "TRC20",
+	"trx":      "TRC20",
+	"erc20":    "ERC20",
+	"erc-20":   "ERC20",
+	"eth":      "ERC20",
+	"ethereum": "ERC20",
+	"bep20":    "BEP20",
+	"bep-20":   "BEP20",
+	"bsc":      "BEP20",
+	"bnb":      "BEP20",
+	"polygon":  "POLYGON",
+	"matic":    "POLYGON",
+	"pol":      "POLYGON",
+	"btc":      "BTC",
+	"bitcoin":  "BTC",
+	"sol":      "SOL",
+	"solana":   "SOL",
+	"spl":      "SOL",
+	"xrp":      "XRP",
+	"xrpl":     "XRP",
+	"ripple":   "XRP",
+	"xlm":      "XLM",
+	"stellar":  "XLM",
+	"ton":      "TON",
+}
+
+// NormalizeAsset 把用户输入的币种、网络（如 "usdt"、"Usdt-trc20"、"tron"）规范化为支持的币种网络组合。
+// 币种中带网络后缀时可省略 network；无法识别时错误信息中给出最接近的候选
+func NormalizeAsset(currency, network string) (Asset, error) {
+	rawCurrency, rawNetwork := strings.TrimSpace(currency), strings.TrimSpace(network)
+	if rawCurrency == "" {
+		return Asset{}, fmt.Errorf("币种不能为空")
+	}
+
+	// 拆分 "USDT-TRC20"、"usdt_trc20"、"USDT/TRON"、"USDT TRC20" 这类合并写法
+	if parts := strings.FieldsFunc(rawCurrency, func(r rune) bool {
+		return r == '_' || r == '/' || r == ' ' || r == '@' || r == ':'
+	}); len(parts) == 2 {
+		if rawNetwork != "" && networkAliases[strings.ToLower(rawNetwork)] != networkAliases[strings.ToLower(parts[1])] {
+			return Asset{}, fmt.Errorf("币种 %s 中的网络与 network=%s 不一致", rawCurrency, rawNetwork)
+		}
+		rawCurrency, rawNetwork = parts[0], parts[1]
+	} else if rawNetwork == "" {
+		// 连字符同时出现在 TRC-20 等网络别名中，只在后半段能识别为网络时拆分
+		for i := strings.Index(rawCurrency, "-"); i > 0; {
+			if _, ok := networkAliases[strings.ToLower(rawCurrency[i+1:])]; ok {
+				rawCurrency, rawNetwork = rawCurrency[:i], rawCurrency[i+1:]
+				break
+			}
+			next := strings.Index(rawCurrency[i+1:], "-")
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+
+	canonical, ok := currencyAliases[strings.ToLower(rawCurrency)]
+	if !ok {
+		// 只填了网络（如 "tron"）时，提示该网络上可用的币种
+		if net, isNetwork := networkAliases[strings.ToLower(rawCurrency)]; isNetwork && rawNetwork == "" {
+			return Asset{}, fmt.Errorf("%s 是网络而不是币种，是否为 %s？", rawCurrency, joinAssets(assetsOnNetwork(net)))
+		}
+		return Asset{}, fmt.Errorf("不支持的加密货币: %s%s", rawCurrency, suggest(currency, currencyCandidates()))
+	}
+	networks := supportedAssets[canonical]
+
+	if rawNetwork == "" {
+		if len(networks) == 1 {
+			return Asset{Currency: canonical, Network: networks[0]}, nil
+		}
+		return Asset{}, fmt.Errorf("%s 需要指定网络，可选: %s", canonical, joinAssets(assetsOf(canonical)))
+	}
+
+	net, ok := networkAliases[strings.ToLower(rawNetwork)]
+	if !ok {
+		return Asset{}, fmt.Errorf("不支持的网络: %s%s", rawNetwork, suggest(rawNetwork, networkAliases))
+	}
+	for _, n := range networks {
+		if n == net {
+			return Asset{Currency: canonical, Network: net}, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("%s 不支持 %s 网络，可选: %s", canonical, networkNames[net], joinAssets(assetsOf(canonical)))
+}
+
+// assetsOf 币种可用的网络，不含未登记或已下架的代币
+func assetsOf(currency string) []Asset {
+	var assets []Asset
+	for _, n := range supportedAssets[currency] {
+		if asset := (Asset{Currency: currency, Network: n}); asset.registered() {
+			assets = append(assets, asset)
+		}
+	}
+	return assets
+}
+
+func assetsOnNetwork(network string) []Asset {
+	var assets []Asset
+	for currency, networks := range supportedAssets {
+		for _, n := range networks {
+			if asset := (Asset{Currency: currency, Network: n}); n == network && asset.registered() {
+				assets = append(assets, asset)
+			}
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Currency < assets[j].Currency })
+	return assets
+}
+
+// SupportedAssets 全部支持的币种网络组合
+func SupportedAssets() []Asset {
+	var assets []Asset
+	for currency := range supportedAssets {
+		assets = append(assets, assetsOf(currency)...)
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Key() < assets[j].Key() })
+	return assets
+}
+
+func joinAssets(assets []Asset) string {
+	names := make([]string, 0, len(assets))
+	for _, a := range assets {
+		names = append(names, a.String())
+	}
+	return strings.Join(names, "、")
+}
+
+// currencyCandidates 币种别名及 "usdt-trc20" 形式的合并写法，用于拼写提示
+func currencyCandidates() map[string]string {
+	candidates := make(map[string]string, len(currencyAliases))
+	for alias, canonical := range currencyAliases {
+		candidates[alias] = canonical
+	}
+	for _, asset := range SupportedAssets() {
+		for alias, network := range networkAliases {
+			if network == asset.Network {
+				candidates[strings.ToLower(asset.Currency)+"-"+alias] = asset.String()
+			}
+		}
+	}
+	return candidates
+}
+
+// suggest 按编辑距离给出最接近的候选，距离过大时不提示
+func suggest(input string, candidates map[string]string) string {
+	input = strings.ToLower(strings.TrimSpace(input))
+	best, bestDist := "", 3
+	for alias, display := range candidates {
+		if d := editDistance(input, alias); d < bestDist || (d == bestDist && display < best) {
+			best, bestDist = display, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("，是否为 %s？", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,538 @@
+package cryptogw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 人工复核状态
+const (
+	ReviewOpen     = "open"
+	ReviewResolved = "resolved"
+)
+
+var ErrReviewNotFound = errors.New("复核单不存在")
+
+// InboundTransfer 链上监听到的入账
+type InboundTransfer struct {
+	TxHash   string  `json:"txHash" binding:"required"`
+	Address  string  `json:"address" binding:"required"`
+	Currency string  `json:"currency" binding:"required"`
+	Network  string  `json:"network"`
+	Amount   float64 `json:"amount" binding:"required"`
+	// 入账所在区块，用于计算链上监听延迟和识别链重组
+	BlockHeight int64      `json:"blockHeight"`
+	BlockHash   string     `json:"blockHash"`
+	BlockTime   *time.Time `json:"blockTime"`
+	// 比特币未打包的交易声明了 RBF
+	Replaceable bool `json:"replaceable"`
+	// Solana Pay 参考公钥。Solana 账单共用收款钱包，带参考公钥时只归属到对应账单
+	Reference string `json:"reference"`
+	// XRP 的 Destination Tag、Stellar 的 memo、TON 的转账注释。这些网络的账单共用收款地址，只按标签归属
+	Memo string `json:"memo"`
+	// 付款方地址，确认前按制裁名单和 KYT 筛查；比特币为全部输入的地址
+	Senders []string `json:"senders"`
+}
+
+// AttributionResult 入账归属结果
+type AttributionResult struct {
+	TxHash        string `json:"txHash"`
+	PaymentID     string `json:"paymentId,omitempty"`
+	AddressReused bool   `json:"addressReused"`
+	ReviewID      string `json:"reviewId,omitempty"`
+	Duplicate     bool   `json:"duplicate,omitempty"` // 该交易此前已归属
+	Reorged       bool   `json:"reorged,omitempty"`   // 重复通知的交易已打包到其他区块
+	// 金额与账单不一致，按地址唯一匹配到未过期账单，账单标记为少付或多付
+	AmountMismatch bool `json:"amountMismatch,omitempty"`
+}
+
+// ReviewItem 无法自动归属的入账，进入人工复核队列
+type ReviewItem struct {
+	ReviewID          string          `json:"reviewId"`
+	Transfer          InboundTransfer `json:"transfer"`
+	Candidates        []string        `json:"candidates,omitempty"`
+	Reason            string          `json:"reason"`
+	Status            string          `json:"status"`
+	ResolvedPaymentID string          `json:"resolvedPaymentId,omitempty"`
+	ResolvedBy        string          `json:"resolvedBy,omitempty"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+}
+
+type ResolveReviewRequest struct {
+	PaymentID string `json:"paymentId" binding:"required"`
+	Operator  string `json:"operator"` // 启用管理接口认证时取访问令牌中的用户名
+}
+
+// ReviewQueue 人工复核队列
+type ReviewQueue struct {
+	mu    sync.RWMutex
+	items map[string]*ReviewItem
+	table *queueTable // 为 nil 时只保存在内存中
+}
+
+func NewReviewQueue() *ReviewQueue {
+	return &ReviewQueue{items: make(map[string]*ReviewItem)}
+}
+
+func (q *ReviewQueue) Add(item *ReviewItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	item.CreatedAt, item.UpdatedAt = now, now
+	copied := *item
+	q.items[item.ReviewID] = &copied
+	q.table.save(item.ReviewID, item.Status, item.CreatedAt, item.UpdatedAt, item)
+}
+
+func (q *ReviewQueue) Get(reviewID string) (*ReviewItem, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	item, ok := q.items[reviewID]
+	if !ok {
+		return nil, ErrReviewNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (q *ReviewQueue) Save(item *ReviewItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item.UpdatedAt = time.Now()
+	copied := *item
+	q.items[item.ReviewID] = &copied
+	q.table.save(item.ReviewID, item.Status, item.CreatedAt, item.UpdatedAt, item)
+}
+
+// FindByTx 查找同一交易的复核单
+func (q *ReviewQueue) FindByTx(txHash string) *ReviewItem {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for _, item := range q.items {
+		if item.Transfer.TxHash == txHash {
+			copied := *item
+			return &copied
+		}
+	}
+	return nil
+}
+
+// List 按创建时间顺序返回指定状态的复核单，status 为空时返回全部
+func (q *ReviewQueue) List(status string) []*ReviewItem {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var items []*ReviewItem
+	for _, item := range q.items {
+		if status == "" || item.Status == status {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items
+}
+
+// AttributeTransfer 把入账归属到账单。
+// 优先匹配同地址未过期且金额一致的账单；只能匹配到已过期账单时视为地址复用（用户从地址簿重复转账），
+// 金额唯一匹配时仍自动归属并打上复用标记；金额不一致但同地址只有一笔未过期账单时归属该账单并标记为少付或多付；
+// 无法唯一确定时进入人工复核
+func (cs *CryptoService) AttributeTransfer(transfer *InboundTransfer) (*AttributionResult, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	result := &AttributionResult{TxHash: transfer.TxHash}
+	if item := cs.reviews.FindByTx(transfer.TxHash); item != nil && item.Status == ReviewOpen {
+		result.ReviewID = item.ReviewID
+		return result, nil
+	}
+
+	invoices, err := cs.invoices.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var active, expired, mismatched []*CryptoInvoice
+	for _, invoice := range invoices {
+		if invoice.TxHash == transfer.TxHash {
+			// 重复通知。交易被链重组移出后重新打包时更新所在区块，由确认流程重新计算确认数；
+			// 已确认账单的重组由确认流程核实
+			moved := invoice.BlockHeight != transfer.BlockHeight ||
+				(transfer.BlockHash != "" && invoice.BlockHash != "" && invoice.BlockHash != transfer.BlockHash)
+			if transfer.BlockHeight > 0 && invoice.awaitingConfirmation() && moved {
+				if invoice.BlockHeight > 0 {
+					invoice.Reorgs++
+					result.Reorged = true
+					log.Printf("【链重组】交易 %s 从区块 %d 重新打包到区块 %d", invoice.TxHash, invoice.BlockHeight, transfer.BlockHeight)
+				}
+				invoice.BlockHeight = transfer.BlockHeight
+				invoice.BlockHash = transfer.BlockHash
+				invoice.MissingSince = time.Time{}
+				invoice.Confirmations = 0
+				if err := cs.invoices.Save(invoice); err != nil {
+					return nil, err
+				}
+			}
+			result.PaymentID = invoice.PaymentID
+			result.AddressReused = invoice.AddressReused
+			result.Duplicate = true
+			return result, nil
+		}
+		if !strings.EqualFold(invoice.Address, transfer.Address) || invoice.Currency != transfer.Currency {
+			continue
+		}
+		if transfer.Reference != "" && invoice.Reference != transfer.Reference {
+			continue
+		}
+		if invoice.Memo != transfer.Memo {
+			continue
+		}
+		if invoice.Status != InvoicePending && invoice.Status != InvoiceExpired {
+			continue
+		}
+		if !cs.amountMatches(invoice.Amount, transfer.Amount) {
+			if invoice.Status == InvoicePending && now.Before(invoice.ExpiresAt) {
+				mismatched = append(mismatched, invoice)
+			}
+			continue
+		}
+		if invoice.Status == InvoicePending && now.Before(invoice.ExpiresAt) {
+			active = append(active, invoice)
+		} else {
+			expired = append(expired, invoice)
+		}
+	}
+
+	var matched *CryptoInvoice
+	switch {
+	case len(active) == 1:
+		matched = active[0]
+	case len(active) > 1:
+		result.ReviewID = cs.flagForReview(transfer, active, "同一地址存在多笔金额相同的未过期账单")
+	case len(expired) == 1:
+		matched = expired[0]
+		result.AddressReused = true
+	case len(expired) > 1:
+		result.AddressReused = true
+		result.ReviewID = cs.flagForReview(transfer, expired, "向已过期账单地址转账，且存在多笔金额相同的候选账单")
+	case len(mismatched) == 1:
+		matched = mismatched[0]
+		result.AmountMismatch = true
+	case len(mismatched) > 1:
+		result.ReviewID = cs.flagForReview(transfer, mismatched, "金额与账单不一致，且同一地址存在多笔未过期账单")
+	case isMemoNetwork(transfer.Network):
+		result.ReviewID = cs.flagForReview(transfer, nil, missingMemoReason(transfer))
+	default:
+		result.ReviewID = cs.flagForReview(transfer, nil, "未找到金额匹配的账单")
+	}
+	if matched == nil {
+		return result, nil
+	}
+
+	matched.TxHash = transfer.TxHash
+	matched.Senders, matched.Screening = transfer.Senders, nil
+	matched.PaidAmount = transfer.Amount
+	matched.PaidAt = now
+	if transfer.BlockTime != nil {
+		matched.PaidAt = *transfer.BlockTime
+	}
+	matched.BlockHeight = transfer.BlockHeight
+	matched.BlockHash = transfer.BlockHash
+	matched.Replaceable = transfer.Replaceable && transfer.BlockHeight == 0
+	cs.applyConfirmationPolicy(matched)
+	matched.AddressReused = result.AddressReused
+	matched.LatePayment = matched.RateLockExpired(matched.PaidAt)
+	cs.classifyAmount(matched)
+	if err := cs.invoices.Save(matched); err != nil {
+		return nil, err
+	}
+	if err := cs.addresses.MarkUsed(matched.Address, matched.PaymentID); err != nil {
+		return nil, err
+	}
+	if result.AddressReused {
+		log.Printf("【警告】入账 %s 复用了已过期账单 %s 的地址 %s，已按金额归属", transfer.TxHash, matched.PaymentID, transfer.Address)
+	}
+	if matched.LatePayment {
+		log.Printf("【汇率】账单 %s 在锁定汇率过期后付款，需调用重新报价接口按当前汇率核算", matched.PaymentID)
+	}
+
+	result.PaymentID = matched.PaymentID
+	return result, nil
+}
+
+// verifyTransfer 按该网络的节点核验外部监听服务上报的入账：交易存在且未执行失败，向上报的收款地址转入该币种，
+// 标签网络还须携带上报的标签。到账数量和所在区块以链上为准。核验不通过时返回原因；
+// 没有节点或节点查询失败时返回错误，入账不能只凭上报归属
+func (cs *CryptoService) verifyTransfer(ctx context.Context, transfer *InboundTransfer) (string, error) {
+	reader := cs.chainReader(transfer.Network)
+	if reader == nil {
+		return "", fmt.Errorf("未配置 %s 节点，无法核验链上交易", networkNames[transfer.Network])
+	}
+	if !validTxHash(transfer.Network, transfer.TxHash) {
+		return fmt.Sprintf("不是有效的 %s 交易哈希: %s", networkNames[transfer.Network], transfer.TxHash), nil
+	}
+	tx, err := reader.FetchTx(ctx, transfer.TxHash)
+	if err != nil {
+		return "", fmt.Errorf("查询 %s 交易失败: %w", networkNames[transfer.Network], err)
+	}
+	switch {
+	case tx == nil:
+		return "链上查不到该交易", nil
+	case tx.Failed:
+		return "交易执行失败，转账不会到账", nil
+	}
+
+	received := new(big.Int)
+	for _, candidate := range tx.Transfers {
+		if candidate.Currency != transfer.Currency || !strings.EqualFold(candidate.To, transfer.Address) {
+			continue
+		}
+		if isMemoNetwork(transfer.Network) && candidate.Memo != transfer.Memo {
+			continue
+		}
+		received.Add(received, candidate.Units)
+	}
+	if received.Sign() <= 0 {
+		return fmt.Sprintf("交易中没有转入 %s 的 %s", transfer.Address, transfer.Currency), nil
+	}
+	// 交易哈希统一为节点返回的格式，避免同一交易以不同大小写重复上报时重复归属
+	if tx.TxHash != "" {
+		transfer.TxHash = tx.TxHash
+	}
+	transfer.Amount = unitsToAmount(received, Asset{Currency: transfer.Currency, Network: transfer.Network}.Decimals())
+	transfer.BlockHeight, transfer.BlockHash = tx.BlockHeight, tx.BlockHash
+	return "", nil
+}
+
+// ReplaceTransfer 已归属但尚未打包的入账被 RBF 替换时，把账单关联到替换交易。
+// 替换交易转入原收款地址的金额不足时，账单退回未付款并把替换交易转人工复核；原交易未归属任何账单时按新入账处理
+func (cs *CryptoService) ReplaceTransfer(replacedTxHash string, replacement *InboundTransfer) (*AttributionResult, error) {
+	result, handled, err := cs.replaceTransfer(replacedTxHash, replacement)
+	if err != nil || handled {
+		return result, err
+	}
+	if replacement.Amount <= 0 {
+		return &AttributionResult{TxHash: replacement.TxHash}, nil
+	}
+	return cs.AttributeTransfer(replacement)
+}
+
+func (cs *CryptoService) replaceTransfer(replacedTxHash string, replacement *InboundTransfer) (*AttributionResult, bool, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoices, err := cs.invoices.List()
+	if err != nil {
+		return nil, false, err
+	}
+	var invoice *CryptoInvoice
+	for _, candidate := range invoices {
+		if candidate.TxHash == replacedTxHash {
+			invoice = candidate
+			break
+		}
+	}
+	if invoice == nil || !invoice.awaitingConfirmation() || invoice.BlockHeight > 0 {
+		return nil, false, nil
+	}
+
+	result := &AttributionResult{TxHash: replacement.TxHash, AddressReused: invoice.AddressReused}
+	// 替换交易与原入账金额相同，或补足了应付数量时仍归属该账单
+	sameAmount := cs.amountMatches(invoice.PaidAmount, replacement.Amount) || cs.amountMatches(invoice.Amount, replacement.Amount)
+	if strings.EqualFold(invoice.Address, replacement.Address) && sameAmount {
+		invoice.TxHash = replacement.TxHash
+		invoice.Senders, invoice.Screening = replacement.Senders, nil
+		invoice.PaidAmount = replacement.Amount
+		if invoice.Resolution == nil {
+			cs.classifyAmount(invoice)
+		}
+		invoice.BlockHeight = replacement.BlockHeight
+		invoice.BlockHash = replacement.BlockHash
+		invoice.MissingSince = time.Time{}
+		invoice.Confirmations = 0
+		invoice.Replaceable = replacement.Replaceable && replacement.BlockHeight == 0
+		if err := cs.invoices.Save(invoice); err != nil {
+			return nil, false, err
+		}
+		log.Printf("【RBF】账单 %s 的入账 %s 被替换为 %s", invoice.PaymentID, replacedTxHash, replacement.TxHash)
+		result.PaymentID = invoice.PaymentID
+		return result, true, nil
+	}
+
+	invoice.TxHash = ""
+	invoice.Senders, invoice.Screening = nil, nil
+	invoice.PaidAmount = 0
+	invoice.PaidAt = time.Time{}
+	invoice.BlockHeight = 0
+	invoice.BlockHash = ""
+	invoice.MissingSince = time.Time{}
+	invoice.Confirmations = 0
+	invoice.RequiredConfirmations = 0
+	invoice.ConfirmationPolicy = nil
+	invoice.Replaceable = false
+	invoice.LatePayment = false
+	invoice.AmountDelta = ""
+	invoice.Status = InvoicePending
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, false, err
+	}
+	log.Printf("【RBF】账单 %s 的入账 %s 被替换为 %s，转入金额 %v 与应付 %v 不一致，账单退回未付款",
+		invoice.PaymentID, replacedTxHash, replacement.TxHash, replacement.Amount, invoice.Amount)
+	if replacement.Amount > 0 {
+		result.ReviewID = cs.flagForReview(replacement, []*CryptoInvoice{invoice},
+			fmt.Sprintf("入账 %s 被 RBF 替换，替换交易金额与账单不一致", replacedTxHash))
+	}
+	return result, true, nil
+}
+
+// amountMatches 金额在容差范围内视为一致
+func (cs *CryptoService) amountMatches(expected, actual float64) bool {
+	tolerance := math.Max(expected*cs.matchTolerance, 1e-8)
+	return math.Abs(expected-actual) <= tolerance
+}
+
+func (cs *CryptoService) flagForReview(transfer *InboundTransfer, candidates []*CryptoInvoice, reason string) string {
+	item := &ReviewItem{
+		ReviewID: fmt.Sprintf("RV%d", time.Now().UnixNano()),
+		Transfer: *transfer,
+		Reason:   reason,
+		Status:   ReviewOpen,
+	}
+	for _, invoice := range candidates {
+		item.Candidates = append(item.Candidates, invoice.PaymentID)
+	}
+	cs.reviews.Add(item)
+	log.Printf("入账 %s 无法自动归属，已进入人工复核: %s", transfer.TxHash, reason)
+	return item.ReviewID
+}
+
+// ResolveReview 人工指定入账归属的账单
+func (cs *CryptoService) ResolveReview(reviewID string, req *ResolveReviewRequest) (*apierr.Response, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	item, err := cs.reviews.Get(reviewID)
+	if err != nil {
+		return apierr.ErrorResponse("REVIEW_NOT_FOUND", err.Error()), nil
+	}
+	if item.Status != ReviewOpen {
+		return apierr.ErrorResponse("INVALID_STATE", "复核单已处理"), nil
+	}
+
+	invoice, err := cs.invoices.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	switch invoice.TxHash {
+	case "":
+		invoice.TxHash = item.Transfer.TxHash
+		invoice.Senders, invoice.Screening = item.Transfer.Senders, nil
+		invoice.PaidAmount = item.Transfer.Amount
+		invoice.PaidAt = item.CreatedAt
+		invoice.BlockHeight = item.Transfer.BlockHeight
+		invoice.BlockHash = item.Transfer.BlockHash
+		cs.applyConfirmationPolicy(invoice)
+		invoice.AddressReused = invoice.ExpiresAt.Before(item.CreatedAt)
+		cs.classifyAmount(invoice)
+		if err := cs.invoices.Save(invoice); err != nil {
+			return nil, err
+		}
+		if err := cs.addresses.MarkUsed(invoice.Address, invoice.PaymentID); err != nil {
+			return nil, err
+		}
+	case item.Transfer.TxHash:
+		// 重新报价转入的复核，入账已归属该账单，人工确认后只关闭复核单
+	default:
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("账单已关联交易 %s", invoice.TxHash)), nil
+	}
+
+	item.Status = ReviewResolved
+	item.ResolvedPaymentID = invoice.PaymentID
+	item.ResolvedBy = req.Operator
+	cs.reviews.Save(item)
+	return apierr.SuccessResponse(item), nil
+}
+
+// registerAttributionRoutes 注册入账归属及人工复核接口
+func registerAttributionRoutes(api *gin.RouterGroup, cs *CryptoService) {
+	// 外部链上监听服务推送入账，须通过监听服务认证（见 ScannerAuth），按节点核验交易后才归属
+	api.POST("/crypto/transfers", func(c *gin.Context) {
+		var transfer InboundTransfer
+		if err := c.ShouldBindJSON(&transfer); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		asset, err := NormalizeAsset(transfer.Currency, transfer.Network)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "UNSUPPORTED_CURRENCY", err.Error())
+			return
+		}
+		transfer.Currency, transfer.Network = asset.Currency, asset.Network
+		transfer.Memo = strings.TrimSpace(transfer.Memo)
+		cs.scanners.Observe(transfer.Network, transfer.BlockHeight, transfer.BlockTime)
+
+		reason, err := cs.verifyTransfer(c.Request.Context(), &transfer)
+		if err != nil {
+			apierr.RespondError(c, http.StatusServiceUnavailable, "CHAIN_UNAVAILABLE", err.Error())
+			return
+		}
+		if reason != "" {
+			log.Printf("【警告】监听服务上报的入账 %s 未通过链上核验: %s", transfer.TxHash, reason)
+			apierr.RespondError(c, http.StatusBadRequest, "TX_NOT_VERIFIED", reason)
+			return
+		}
+
+		result, err := cs.AttributeTransfer(&transfer)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, result)
+	})
+
+	admin := api.Group("/crypto/admin")
+
+	admin.GET("/reviews", func(c *gin.Context) {
+		apierr.RespondOK(c, cs.reviews.List(c.DefaultQuery("status", ReviewOpen)))
+	})
+
+	admin.POST("/reviews/:reviewId/resolve", func(c *gin.Context) {
+		var req ResolveReviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		var ok bool
+		if req.Operator, ok = requestOperator(c, req.Operator); !ok {
+			return
+		}
+
+		resp, err := cs.ResolveReview(c.Param("reviewId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,125 @@
+package cryptogw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopay-service/internal/apierr"
+)
+
+type BalanceData struct {
+	Address      string    `json:"address"`
+	Currency     string    `json:"currency"`
+	Network      string    `json:"network"`
+	Balance      float64   `json:"balance"`
+	BalanceExact string    `json:"balanceExact"` // 按链上精度格式化的十进制数量
+	BaseUnits    string    `json:"baseUnits"`    // 链上最小单位的数量
+	Decimals     int       `json:"decimals"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	Stale        bool      `json:"stale,omitempty"` // 节点查询失败，返回的是过期缓存
+}
+
+// balanceCache 地址余额缓存，结果缓存 BALANCE_CACHE_TTL（默认 30s），避免频繁查询消耗节点请求预算；
+// 节点查询失败时在 BALANCE_MAX_STALENESS（默认 5m）内继续返回上次的结果
+type balanceCache struct {
+	ttl          time.Duration
+	maxStaleness time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*BalanceData
+}
+
+func newBalanceCache() *balanceCache {
+	return &balanceCache{
+		ttl:          envDuration("BALANCE_CACHE_TTL", 30*time.Second),
+		maxStaleness: envDuration("BALANCE_MAX_STALENESS", 5*time.Minute),
+		entries:      make(map[string]*BalanceData),
+	}
+}
+
+func (c *balanceCache) get(key string) *BalanceData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached := c.entries[key]; cached != nil {
+		copied := *cached
+		return &copied
+	}
+	return nil
+}
+
+func (c *balanceCache) put(key string, balance *BalanceData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *balance
+	c.entries[key] = &copied
+}
+
+// GetAddressBalance 通过该网络的链上节点查询地址的币种余额：原生币查询账户余额，代币查询合约余额，
+// 按币种在该链上的精度换算。比特币只统计已确认的余额
+func (cs *CryptoService) GetAddressBalance(ctx context.Context, address, currency, network string) (*apierr.Response, error) {
+	asset, err := NormalizeAsset(currency, network)
+	if err != nil {
+		return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", err.Error()), nil
+	}
+	address = strings.TrimSpace(address)
+	if err := cs.addresses.wallet.ValidateAddress(asset.Network, address); err != nil {
+		return apierr.ErrorResponse("INVALID_ADDRESS", err.Error()), nil
+	}
+	reader := cs.chainReader(asset.Network)
+	if reader == nil {
+		return apierr.ErrorResponse("CHAIN_UNAVAILABLE", fmt.Sprintf("未配置 %s 节点，无法查询余额", networkNames[asset.Network])), nil
+	}
+
+	key := asset.Key() + "/" + address
+	if _, ok := evmChains[asset.Network]; ok {
+		key = strings.ToLower(key)
+	}
+	cached := cs.balances.get(key)
+	if cached != nil && time.Since(cached.FetchedAt) < cs.balances.ttl {
+		return apierr.SuccessResponse(cached), nil
+	}
+
+	units, err := reader.Balance(ctx, address, asset)
+	if err != nil {
+		if cached != nil && time.Since(cached.FetchedAt) < cs.balances.maxStaleness {
+			log.Printf("查询 %s 地址 %s 余额失败，使用 %s 前的缓存: %v", asset, address, time.Since(cached.FetchedAt).Round(time.Second), err)
+			cached.Stale = true
+			return apierr.SuccessResponse(cached), nil
+		}
+		return apierr.ErrorResponse("CHAIN_UNAVAILABLE", fmt.Sprintf("查询 %s 余额失败: %v", asset, err)), nil
+	}
+
+	exact := formatAmount(new(big.Rat).SetFrac(units, pow10(asset.Decimals())), asset.Decimals())
+	value, _ := strconv.ParseFloat(exact, 64)
+	balance := &BalanceData{
+		Address:      address,
+		Currency:     asset.Currency,
+		Network:      asset.Network,
+		Balance:      value,
+		BalanceExact: exact,
+		BaseUnits:    units.String(),
+		Decimals:     asset.Decimals(),
+		FetchedAt:    time.Now(),
+	}
+	cs.balances.put(key, balance)
+	return apierr.SuccessResponse(balance), nil
+}
+
+// parseHexUnits 解析节点返回的十六进制数量
+func parseHexUnits(raw string) (*big.Int, error) {
+	digits := strings.TrimPrefix(raw, "0x")
+	if digits == "" {
+		return nil, fmt.Errorf("节点返回的余额为空，地址可能不是代币合约")
+	}
+	units, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("节点返回的余额无效: %s", raw)
+	}
+	return units, nil
+}
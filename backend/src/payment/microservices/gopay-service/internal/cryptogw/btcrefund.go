@@ -0,0 +1,232 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// 交易体积估算（vbyte）：固定部分约 11，每个 P2WPKH 输入 68，P2WPKH 找零输出 31
+const (
+	btcTxOverhead  = 11
+	btcInputVSize  = 68
+	btcChangeVSize = 31
+	btcDustLimit   = 294 // P2WPKH 输出的粉尘下限（聪），低于该值的找零并入网络费
+)
+
+var errEsploraRejected = errors.New("交易被节点拒绝")
+
+type esploraUTXO struct {
+	TxID   string        `json:"txid"`
+	Vout   uint32        `json:"vout"`
+	Value  int64         `json:"value"`
+	Status esploraStatus `json:"status"`
+}
+
+func (u esploraUTXO) outpoint() string {
+	return fmt.Sprintf("%s:%d", u.TxID, u.Vout)
+}
+
+// SendRefund 从热钱包的原生隔离见证地址签名转出退款，找零回到热钱包。
+// 只花费已确认的输出，按从大到小选取；重发时原交易的输入仍未花费则沿用，原交易和重发的交易只有一笔能上链。
+// 网络费率取 REFUND_BTC_FEE_TARGET 个区块内确认的费率（默认按 REFUND_FEE_LEVEL 档位，standard 为 6），不超过 REFUND_BTC_MAX_FEE_RATE（默认 200 sat/vB）；
+// 交易声明 RBF，费率不足时可由财务加速
+func (w *BTCWatcher) SendRefund(ctx context.Context, refund *CryptoRefund) (string, error) {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	hot := w.crypto.hotWallet
+	units, err := refund.units()
+	if err != nil {
+		return "", err
+	}
+	destination, err := btcutil.DecodeAddress(refund.ToAddress, hot.btcParams)
+	if err != nil {
+		return "", fmt.Errorf("退款地址无效: %s", refund.ToAddress)
+	}
+	destScript, err := txscript.PayToAddrScript(destination)
+	if err != nil {
+		return "", err
+	}
+	hotScript, err := txscript.PayToAddrScript(hot.btcAddress)
+	if err != nil {
+		return "", err
+	}
+
+	utxos, err := w.spendableUTXOs(ctx, refund)
+	if err != nil {
+		return "", err
+	}
+	feeRate, err := w.estimateFeeRate(ctx, envInt("REFUND_BTC_FEE_TARGET", btcFeeTarget(envString("REFUND_FEE_LEVEL", FeeStandard))), envFloat("REFUND_BTC_MAX_FEE_RATE", 200))
+	if err != nil {
+		return "", err
+	}
+	selected, fee, change, err := selectUTXOs(utxos, units.Int64(), feeRate, 9+len(destScript))
+	if err != nil {
+		return "", err
+	}
+
+	tx := wire.NewMsgTx(2)
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	for _, utxo := range selected {
+		hash, err := chainhash.NewHashFromStr(utxo.TxID)
+		if err != nil {
+			return "", err
+		}
+		outpoint := wire.NewOutPoint(hash, utxo.Vout)
+		in := wire.NewTxIn(outpoint, nil, nil)
+		in.Sequence = wire.MaxTxInSequenceNum - 2 // BIP125 可替换
+		tx.AddTxIn(in)
+		prevOuts[*outpoint] = wire.NewTxOut(utxo.Value, hotScript)
+	}
+	tx.AddTxOut(wire.NewTxOut(units.Int64(), destScript))
+	if change > 0 {
+		tx.AddTxOut(wire.NewTxOut(change, hotScript))
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, txscript.NewMultiPrevOutFetcher(prevOuts))
+	for i, utxo := range selected {
+		digest, err := txscript.CalcWitnessSigHash(hotScript, sigHashes, txscript.SigHashAll, tx, i, utxo.Value)
+		if err != nil {
+			return "", err
+		}
+		sig, err := signBitcoin(ctx, hot.btc, digest)
+		if err != nil {
+			return "", fmt.Errorf("签名失败: %w", err)
+		}
+		tx.TxIn[i].Witness = wire.TxWitness{append(sig, byte(txscript.SigHashAll)), hot.btc.PublicKey().SerializeCompressed()}
+	}
+	var raw bytes.Buffer
+	if err := tx.Serialize(&raw); err != nil {
+		return "", err
+	}
+	txHash := tx.TxHash().String()
+	refund.FromAddress = hot.btcAddress.EncodeAddress()
+	refund.Fee = formatAmount(new(big.Rat).SetFrac64(fee, 1e8), 8)
+
+	err = w.broadcast(ctx, hex.EncodeToString(raw.Bytes()))
+	if errors.Is(err, errEsploraRejected) {
+		return "", err
+	}
+	// 广播成功或结果不确定时都记录花费的输入，重发时沿用
+	refund.Inputs = nil
+	for _, utxo := range selected {
+		refund.Inputs = append(refund.Inputs, utxo.outpoint())
+	}
+	refund.TxHash = txHash
+	return txHash, err
+}
+
+// spendableUTXOs 热钱包可花费的已确认输出，排除其他广播中的退款已花费的输出。
+// 退款此前花费过的输出全部仍未花费时只返回这些输出
+func (w *BTCWatcher) spendableUTXOs(ctx context.Context, refund *CryptoRefund) ([]esploraUTXO, error) {
+	var utxos []esploraUTXO
+	if err := w.get(ctx, "/address/"+w.crypto.hotWallet.btcAddress.EncodeAddress()+"/utxo", &utxos); err != nil {
+		return nil, err
+	}
+	byOutpoint := make(map[string]esploraUTXO)
+	for _, utxo := range utxos {
+		byOutpoint[utxo.outpoint()] = utxo
+	}
+
+	if len(refund.Inputs) > 0 {
+		var previous []esploraUTXO
+		for _, outpoint := range refund.Inputs {
+			if utxo, ok := byOutpoint[outpoint]; ok {
+				previous = append(previous, utxo)
+			}
+		}
+		if len(previous) == len(refund.Inputs) {
+			return previous, nil
+		}
+		log.Printf("退款 %s 原交易的输入已被其他交易花费，重新选取输入", refund.RefundID)
+	}
+
+	inFlight := make(map[string]bool)
+	for _, other := range w.crypto.refunds.List(RefundBroadcast) {
+		for _, outpoint := range other.Inputs {
+			inFlight[outpoint] = true
+		}
+	}
+	var spendable []esploraUTXO
+	for _, utxo := range utxos {
+		if utxo.Status.Confirmed && !inFlight[utxo.outpoint()] {
+			spendable = append(spendable, utxo)
+		}
+	}
+	return spendable, nil
+}
+
+// estimateFeeRate target 个区块内确认的网络费率（sat/vB），不超过 limit
+func (w *BTCWatcher) estimateFeeRate(ctx context.Context, target int, limit float64) (float64, error) {
+	estimate, err := w.crypto.feeEstimate(ctx, "BTC")
+	if err != nil {
+		return 0, err
+	}
+	rate := estimate.BTC.rate(target)
+	if rate > limit {
+		log.Printf("比特币网络费率 %.1f sat/vB 超过上限，按 %.1f sat/vB 发送", rate, limit)
+		rate = limit
+	}
+	return rate, nil
+}
+
+// selectUTXOs 按金额从大到小选取输入，直到覆盖退款数量和网络费。outputVSize 为退款输出的体积，
+// 找零低于粉尘下限时不找零，并入网络费
+func selectUTXOs(utxos []esploraUTXO, amount int64, feeRate float64, outputVSize int) ([]esploraUTXO, int64, int64, error) {
+	sorted := append([]esploraUTXO(nil), utxos...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value > sorted[j].Value })
+
+	var total int64
+	for n, utxo := range sorted {
+		total += utxo.Value
+		vsize := btcTxOverhead + btcInputVSize*(n+1) + outputVSize
+		feeNoChange := int64(math.Ceil(feeRate * float64(vsize)))
+		if total < amount+feeNoChange {
+			continue
+		}
+		fee := int64(math.Ceil(feeRate * float64(vsize+btcChangeVSize)))
+		if change := total - amount - fee; change >= btcDustLimit {
+			return sorted[:n+1], fee, change, nil
+		}
+		return sorted[:n+1], total - amount, 0, nil
+	}
+	return nil, 0, 0, fmt.Errorf("热钱包可用余额 %d 聪不足以支付退款 %d 聪及网络费", total, amount)
+}
+
+// broadcast 广播原始交易。节点以 HTTP 400 拒绝时（输入已花费、费率过低等）返回 errEsploraRejected，不换节点重试
+func (w *BTCWatcher) broadcast(ctx context.Context, rawHex string) error {
+	return w.pool.Do(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL+"/tx", strings.NewReader(rawHex))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := w.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("/tx 请求失败: %w", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		switch {
+		case resp.StatusCode == http.StatusBadRequest:
+			return fmt.Errorf("%w: %s", errEsploraRejected, strings.TrimSpace(string(body)))
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("/tx 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return nil
+	}, func(err error) bool { return errors.Is(err, errEsploraRejected) })
+}
@@ -0,0 +1,178 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PlanSweeps 本轮所有候选地址已确认的输出合并为一笔归集，合计达到门槛时才归集
+func (w *BTCWatcher) PlanSweeps(ctx context.Context, addresses []*PooledAddress, toAddress string) ([]*SweepRecord, error) {
+	var sources []SweepSource
+	var errs []error
+	total := new(big.Int)
+	for _, addr := range addresses {
+		utxos, err := w.confirmedUTXOs(ctx, addr.Address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", addr.Address, err))
+			continue
+		}
+		if len(utxos) == 0 {
+			continue
+		}
+		source := SweepSource{Address: addr.Address, Index: addr.Index, Path: addr.Path}
+		var value int64
+		for _, utxo := range utxos {
+			value += utxo.Value
+			source.Inputs = append(source.Inputs, utxo.outpoint())
+		}
+		source.Amount = formatAmount(new(big.Rat).SetFrac64(value, 1e8), 8)
+		sources = append(sources, source)
+		total.Add(total, big.NewInt(value))
+	}
+
+	asset := Asset{Currency: "BTC", Network: "BTC"}
+	if len(sources) == 0 || total.Cmp(sweepMinimum(asset)) < 0 {
+		return nil, errors.Join(errs...)
+	}
+	return []*SweepRecord{newSweep(asset, toAddress, total, sources...)}, errors.Join(errs...)
+}
+
+// SendSweep 花费各收款地址全部已确认的输出，扣除网络费后转入归集地址，不找零。
+// 网络费率取 SWEEP_BTC_FEE_TARGET 个区块内确认的费率（默认按 SWEEP_FEE_LEVEL 档位，slow 为 144），不超过 SWEEP_BTC_MAX_FEE_RATE（默认 50 sat/vB），
+// 归集不急于确认，交易声明 RBF，需要时可加速
+func (w *BTCWatcher) SendSweep(ctx context.Context, sweep *SweepRecord, keys *hdKeystore) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	params := w.crypto.hotWallet.btcParams
+	destination, err := btcutil.DecodeAddress(sweep.ToAddress, params)
+	if err != nil {
+		return fmt.Errorf("归集地址无效: %s", sweep.ToAddress)
+	}
+	destScript, err := txscript.PayToAddrScript(destination)
+	if err != nil {
+		return err
+	}
+
+	type input struct {
+		utxo   esploraUTXO
+		signer Signer
+		script []byte
+	}
+	var inputs []input
+	var sources []SweepSource
+	var total int64
+	for _, source := range sweep.Sources {
+		signer, err := keys.signer(source.Index)
+		if err != nil {
+			return err
+		}
+		address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(signer.PublicKey().SerializeCompressed()), params)
+		if err != nil {
+			return err
+		}
+		if address.EncodeAddress() != source.Address {
+			return fmt.Errorf("序号 %d 派生的地址 %s 与收款地址 %s 不一致", source.Index, address.EncodeAddress(), source.Address)
+		}
+		script, err := txscript.PayToAddrScript(address)
+		if err != nil {
+			return err
+		}
+		utxos, err := w.confirmedUTXOs(ctx, source.Address)
+		if err != nil {
+			return err
+		}
+		if len(utxos) == 0 {
+			continue
+		}
+		var value int64
+		source.Inputs = nil
+		for _, utxo := range utxos {
+			inputs = append(inputs, input{utxo: utxo, signer: signer, script: script})
+			source.Inputs = append(source.Inputs, utxo.outpoint())
+			value += utxo.Value
+		}
+		source.Amount = formatAmount(new(big.Rat).SetFrac64(value, 1e8), 8)
+		sources = append(sources, source)
+		total += value
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("收款地址没有已确认的输出")
+	}
+
+	feeRate, err := w.estimateFeeRate(ctx, envInt("SWEEP_BTC_FEE_TARGET", btcFeeTarget(envString("SWEEP_FEE_LEVEL", FeeSlow))), envFloat("SWEEP_BTC_MAX_FEE_RATE", 50))
+	if err != nil {
+		return err
+	}
+	fee := int64(math.Ceil(feeRate * float64(btcTxOverhead+btcInputVSize*len(inputs)+9+len(destScript))))
+	if float64(fee) > float64(total)*envFloat("SWEEP_MAX_FEE_RATIO", 0.05) {
+		return fmt.Errorf("%w: 网络费 %d 聪超过归集金额 %d 聪的上限比例", errSweepDeferred, fee, total)
+	}
+	value := total - fee
+
+	tx := wire.NewMsgTx(2)
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	for _, in := range inputs {
+		hash, err := chainhash.NewHashFromStr(in.utxo.TxID)
+		if err != nil {
+			return err
+		}
+		outpoint := wire.NewOutPoint(hash, in.utxo.Vout)
+		txIn := wire.NewTxIn(outpoint, nil, nil)
+		txIn.Sequence = wire.MaxTxInSequenceNum - 2 // BIP125 可替换
+		tx.AddTxIn(txIn)
+		prevOuts[*outpoint] = wire.NewTxOut(in.utxo.Value, in.script)
+	}
+	tx.AddTxOut(wire.NewTxOut(value, destScript))
+	sigHashes := txscript.NewTxSigHashes(tx, txscript.NewMultiPrevOutFetcher(prevOuts))
+	for i, in := range inputs {
+		digest, err := txscript.CalcWitnessSigHash(in.script, sigHashes, txscript.SigHashAll, tx, i, in.utxo.Value)
+		if err != nil {
+			return err
+		}
+		sig, err := signBitcoin(ctx, in.signer, digest)
+		if err != nil {
+			return fmt.Errorf("签名失败: %w", err)
+		}
+		tx.TxIn[i].Witness = wire.TxWitness{append(sig, byte(txscript.SigHashAll)), in.signer.PublicKey().SerializeCompressed()}
+	}
+	var raw bytes.Buffer
+	if err := tx.Serialize(&raw); err != nil {
+		return err
+	}
+
+	err = w.broadcast(ctx, hex.EncodeToString(raw.Bytes()))
+	if errors.Is(err, errEsploraRejected) {
+		return err
+	}
+	sweep.Sources = sources
+	sweep.setUnits(big.NewInt(value))
+	sweep.Fee = formatAmount(new(big.Rat).SetFrac64(fee, 1e8), 8)
+	sweep.TxHash, sweep.Status = tx.TxHash().String(), SweepBroadcast
+	return err
+}
+
+// confirmedUTXOs 地址已确认的输出，内存池中的入账待确认后再归集
+func (w *BTCWatcher) confirmedUTXOs(ctx context.Context, address string) ([]esploraUTXO, error) {
+	var utxos []esploraUTXO
+	if err := w.get(ctx, "/address/"+address+"/utxo", &utxos); err != nil {
+		return nil, err
+	}
+	var confirmed []esploraUTXO
+	for _, utxo := range utxos {
+		if utxo.Status.Confirmed {
+			confirmed = append(confirmed, utxo)
+		}
+	}
+	return confirmed, nil
+}
@@ -0,0 +1,399 @@
+package cryptogw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errEsploraNotFound = errors.New("Esplora 未找到该记录")
+
+// BTCWatcher 通过 Esplora API（BTC_ESPLORA_URLS 逗号分隔，也可用单个 BTC_ESPLORA_URL，如 https://blockstream.info/api、
+// https://mempool.space/api，或与 Bitcoin Core 一同部署的 electrs；多个地址按健康评分故障切换，见 EndpointPool）按收款地址查询交易。交易进入内存池即归属账单（txStatus 为 pending），
+// 打包后按区块推进确认数。未打包的交易可能被 RBF 替换：原交易从内存池消失时，按其花费的输入查出替换交易，
+// 替换交易仍足额转入收款地址时改为关联替换交易，否则账单退回未付款并转人工复核
+type BTCWatcher struct {
+	crypto   *CryptoService
+	hub      *CheckoutHub
+	pool     *EndpointPool
+	client   *http.Client
+	interval time.Duration
+
+	// 未打包入账交易花费的输入，原交易被替换后据此查找替换交易
+	inputs map[string][]esploraOutpoint
+	// 已从内存池消失且查不到替换交易的入账，只记录一次日志
+	missing map[string]bool
+
+	// 退款交易串行发送，避免两笔退款选中同一输出
+	sendMu sync.Mutex
+}
+
+// NewBTCWatcher 未配置 BTC_ESPLORA_URLS 时返回 nil
+func NewBTCWatcher(crypto *CryptoService, hub *CheckoutHub) *BTCWatcher {
+	var urls []string
+	for _, raw := range splitList(envString("BTC_ESPLORA_URLS", os.Getenv("BTC_ESPLORA_URL"))) {
+		urls = append(urls, strings.TrimRight(raw, "/"))
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	w := &BTCWatcher{
+		crypto:   crypto,
+		hub:      hub,
+		pool:     crypto.newEndpointPool("BTC", "BTC", urls),
+		client:   &http.Client{Timeout: envDuration("RPC_HTTP_TIMEOUT", 10*time.Second)},
+		interval: envDuration("BTC_POLL_INTERVAL", 30*time.Second),
+		inputs:   make(map[string][]esploraOutpoint),
+		missing:  make(map[string]bool),
+	}
+	crypto.registerChain("BTC", w)
+	crypto.registerSweepSender("BTC", w)
+	if crypto.hotWallet.btc != nil {
+		crypto.registerSender("BTC", w)
+	}
+	return w
+}
+
+func (w *BTCWatcher) Run(ctx context.Context) {
+	log.Printf("Bitcoin 链上监听已启动，%d 个节点，轮询间隔 %s", w.pool.Len(), w.interval)
+	go w.pool.RunHealthChecks(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		var height int64
+		return w.request(ctx, ep.URL, "/blocks/tip/height", &height)
+	})
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Bitcoin 链上监听失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type esploraOutpoint struct {
+	TxID     string `json:"txid"`
+	Vout     int    `json:"vout"`
+	Sequence uint32 `json:"sequence"`
+	Prevout  *struct {
+		Address string `json:"scriptpubkey_address"`
+	} `json:"prevout,omitempty"`
+}
+
+type esploraStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight int64  `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	BlockTime   int64  `json:"block_time"`
+}
+
+type esploraTx struct {
+	TxID string            `json:"txid"`
+	Vin  []esploraOutpoint `json:"vin"`
+	Vout []struct {
+		Address string `json:"scriptpubkey_address"`
+		Value   int64  `json:"value"` // 聪
+	} `json:"vout"`
+	Status esploraStatus `json:"status"`
+}
+
+// received 交易转入指定地址的数量，同一交易可能有多个输出转入同一地址
+func (tx *esploraTx) received(address string) int64 {
+	var sats int64
+	for _, out := range tx.Vout {
+		if out.Address == address {
+			sats += out.Value
+		}
+	}
+	return sats
+}
+
+// senders 交易各输入花费的地址，去重后按出现顺序返回
+func (tx *esploraTx) senders() []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, in := range tx.Vin {
+		if in.Prevout == nil || in.Prevout.Address == "" || seen[in.Prevout.Address] {
+			continue
+		}
+		seen[in.Prevout.Address] = true
+		addresses = append(addresses, in.Prevout.Address)
+	}
+	return addresses
+}
+
+// signalsRBF 任一输入的 nSequence 小于 0xfffffffe 即声明可替换（BIP125）。
+// 节点启用 full-RBF 后未声明的交易同样可能被替换，因此替换检查对所有未打包的入账都会进行
+func (tx *esploraTx) signalsRBF() bool {
+	for _, in := range tx.Vin {
+		if in.Sequence < 0xfffffffe {
+			return true
+		}
+	}
+	return false
+}
+
+// transfer 交易转入收款地址的入账
+func (tx *esploraTx) transfer(address string) *InboundTransfer {
+	transfer := &InboundTransfer{
+		TxHash:      tx.TxID,
+		Address:     address,
+		Currency:    "BTC",
+		Network:     "BTC",
+		Amount:      unitsToAmount(big.NewInt(tx.received(address)), Asset{Currency: "BTC", Network: "BTC"}.Decimals()),
+		Replaceable: !tx.Status.Confirmed && tx.signalsRBF(),
+		Senders:     tx.senders(),
+	}
+	if tx.Status.Confirmed {
+		blockTime := time.Unix(tx.Status.BlockTime, 0)
+		transfer.BlockHeight = tx.Status.BlockHeight
+		transfer.BlockHash = tx.Status.BlockHash
+		transfer.BlockTime = &blockTime
+	}
+	return transfer
+}
+
+// poll 先处理被替换的入账，再查询收款地址的新交易，最后按链头推进确认数
+func (w *BTCWatcher) poll(ctx context.Context) error {
+	var blocks []struct {
+		Height    int64 `json:"height"`
+		Timestamp int64 `json:"timestamp"`
+	}
+	if err := w.get(ctx, "/blocks", &blocks); err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("节点未返回最新区块")
+	}
+
+	if err := w.checkReplacements(ctx); err != nil {
+		return err
+	}
+
+	watched, err := w.crypto.watchedAddresses("BTC")
+	if err != nil {
+		return err
+	}
+	for address := range watched["BTC"] {
+		if err := w.scanAddress(ctx, address); err != nil {
+			return err
+		}
+	}
+
+	blockTime := time.Unix(blocks[0].Timestamp, 0)
+	w.crypto.scanners.Observe("BTC", blocks[0].Height, &blockTime)
+
+	changed, err := w.crypto.AdvanceConfirmations(ctx, "BTC", blocks[0].Height, w)
+	if err != nil {
+		return err
+	}
+	publishConfirmations(w.hub, changed)
+	return nil
+}
+
+// scanAddress 收款地址的交易（含内存池中的交易）交给入账归属，已归属的交易按重复通知处理
+func (w *BTCWatcher) scanAddress(ctx context.Context, address string) error {
+	var txs []esploraTx
+	if err := w.get(ctx, "/address/"+address+"/txs", &txs); err != nil {
+		return err
+	}
+	for i := range txs {
+		tx := &txs[i]
+		if tx.received(address) <= 0 {
+			continue
+		}
+		if !tx.Status.Confirmed {
+			w.inputs[tx.TxID] = tx.Vin
+		}
+		w.crypto.deliverTransfer(w.hub, tx.transfer(address))
+	}
+	return nil
+}
+
+// checkReplacements 检查已归属但未打包的入账是否仍在内存池或已打包
+func (w *BTCWatcher) checkReplacements(ctx context.Context) error {
+	invoices, err := w.crypto.invoices.List()
+	if err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		if invoice.Network != "BTC" || !invoice.awaitingConfirmation() || invoice.TxHash == "" || invoice.BlockHeight > 0 {
+			continue
+		}
+		txHash := invoice.TxHash
+
+		var status esploraStatus
+		err := w.get(ctx, "/tx/"+txHash+"/status", &status)
+		switch {
+		case err == nil && status.Confirmed:
+			delete(w.inputs, txHash)
+			continue
+		case err == nil:
+			// 服务重启后首次检查，补记输入
+			if _, ok := w.inputs[txHash]; !ok {
+				var tx esploraTx
+				if err := w.get(ctx, "/tx/"+txHash, &tx); err != nil {
+					return err
+				}
+				w.inputs[txHash] = tx.Vin
+			}
+			continue
+		case !errors.Is(err, errEsploraNotFound):
+			return err
+		}
+
+		replacement, err := w.findReplacement(ctx, txHash)
+		if err != nil {
+			return err
+		}
+		if replacement == nil {
+			if !w.missing[txHash] {
+				w.missing[txHash] = true
+				log.Printf("【RBF】账单 %s 的入账 %s 已不在内存池，未找到替换交易", invoice.PaymentID, txHash)
+			}
+			continue
+		}
+
+		result, err := w.crypto.ReplaceTransfer(txHash, replacement.transfer(invoice.Address))
+		if err != nil {
+			return err
+		}
+		delete(w.inputs, txHash)
+		delete(w.missing, txHash)
+		if !replacement.Status.Confirmed {
+			w.inputs[replacement.TxID] = replacement.Vin
+		}
+		if updated, err := w.crypto.invoices.Get(invoice.PaymentID); err == nil {
+			w.hub.Publish(invoice.PaymentID, CheckoutEvent{Type: "transfer_replaced", Data: paymentStatus(updated)})
+		}
+		if result.ReviewID != "" {
+			log.Printf("【RBF】替换交易 %s 已转人工复核 %s", replacement.TxID, result.ReviewID)
+		}
+	}
+	return nil
+}
+
+// findReplacement 按原交易花费的输入查找花费同一输入的交易
+func (w *BTCWatcher) findReplacement(ctx context.Context, txHash string) (*esploraTx, error) {
+	for _, in := range w.inputs[txHash] {
+		var spend struct {
+			Spent bool   `json:"spent"`
+			TxID  string `json:"txid"`
+		}
+		if err := w.get(ctx, fmt.Sprintf("/tx/%s/outspend/%d", in.TxID, in.Vout), &spend); err != nil {
+			return nil, err
+		}
+		if !spend.Spent || spend.TxID == txHash {
+			continue
+		}
+		var tx esploraTx
+		if err := w.get(ctx, "/tx/"+spend.TxID, &tx); err != nil {
+			return nil, err
+		}
+		return &tx, nil
+	}
+	return nil, nil
+}
+
+// LocateTx 内存池中的交易返回高度 0，既不在链上也不在内存池时 ok 为 false
+func (w *BTCWatcher) LocateTx(ctx context.Context, txHash string) (TxLocation, bool, error) {
+	var status esploraStatus
+	err := w.get(ctx, "/tx/"+txHash+"/status", &status)
+	if errors.Is(err, errEsploraNotFound) {
+		return TxLocation{}, false, nil
+	}
+	if err != nil {
+		return TxLocation{}, false, err
+	}
+	if !status.Confirmed {
+		return TxLocation{}, true, nil
+	}
+	return TxLocation{Height: status.BlockHeight, BlockHash: status.BlockHash}, true, nil
+}
+
+// FetchTx 按哈希查询交易（含内存池中的交易），每个输出作为一笔转账
+func (w *BTCWatcher) FetchTx(ctx context.Context, txHash string) (*ChainTx, error) {
+	var tx esploraTx
+	err := w.get(ctx, "/tx/"+txHash, &tx)
+	if errors.Is(err, errEsploraNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var head int64
+	if err := w.get(ctx, "/blocks/tip/height", &head); err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: tx.TxID, Head: head}
+	if tx.Status.Confirmed {
+		result.BlockHeight, result.BlockHash = tx.Status.BlockHeight, tx.Status.BlockHash
+	}
+	for _, out := range tx.Vout {
+		if out.Address == "" || out.Value <= 0 {
+			continue
+		}
+		result.Transfers = append(result.Transfers, ChainTransfer{To: out.Address, Currency: "BTC", Units: big.NewInt(out.Value)})
+	}
+	return result, nil
+}
+
+// Balance 已确认的余额，内存池中的交易不计入
+func (w *BTCWatcher) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	var info struct {
+		ChainStats struct {
+			Funded int64 `json:"funded_txo_sum"`
+			Spent  int64 `json:"spent_txo_sum"`
+		} `json:"chain_stats"`
+	}
+	if err := w.get(ctx, "/address/"+address, &info); err != nil {
+		return nil, err
+	}
+	return big.NewInt(info.ChainStats.Funded - info.ChainStats.Spent), nil
+}
+
+func (w *BTCWatcher) get(ctx context.Context, path string, result interface{}) error {
+	return w.pool.Do(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		return w.request(ctx, ep.URL, path, result)
+	}, func(err error) bool { return errors.Is(err, errEsploraNotFound) })
+}
+
+func (w *BTCWatcher) request(ctx context.Context, baseURL, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s 请求失败: %w", path, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errEsploraNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s 返回 HTTP %d: %s", path, resp.StatusCode, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("%s 响应解析失败: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package cryptogw
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// CheckoutEvent 推送给收银台页面的事件
+type CheckoutEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// CheckoutHub 收银台 SSE 连接管理，连接数同时用于判断用户是否仍停留在支付页。
+// 账单回调等服务端监听函数通过 OnPublish 接收同一事件流
+type CheckoutHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan CheckoutEvent]struct{}
+	listeners   []func(paymentID string, event CheckoutEvent)
+}
+
+func NewCheckoutHub() *CheckoutHub {
+	return &CheckoutHub{subscribers: make(map[string]map[chan CheckoutEvent]struct{})}
+}
+
+// Subscribe 订阅某笔支付的事件，返回取消订阅函数
+func (h *CheckoutHub) Subscribe(paymentID string) (chan CheckoutEvent, func()) {
+	ch := make(chan CheckoutEvent, 8)
+
+	h.mu.Lock()
+	if h.subscribers[paymentID] == nil {
+		h.subscribers[paymentID] = make(map[chan CheckoutEvent]struct{})
+	}
+	h.subscribers[paymentID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[paymentID], ch)
+		if len(h.subscribers[paymentID]) == 0 {
+			delete(h.subscribers, paymentID)
+		}
+	}
+}
+
+// OnPublish 登记事件监听函数，监听函数在 Publish 的调用方协程中执行，不能阻塞
+func (h *CheckoutHub) OnPublish(listener func(paymentID string, event CheckoutEvent)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, listener)
+}
+
+// Publish 向所有订阅者推送事件，慢消费者的事件直接丢弃
+func (h *CheckoutHub) Publish(paymentID string, event CheckoutEvent) {
+	h.mu.Lock()
+	for ch := range h.subscribers[paymentID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	listeners := h.listeners
+	h.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(paymentID, event)
+	}
+}
+
+// Active 是否有用户正在查看该账单的收银台
+func (h *CheckoutHub) Active(paymentID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[paymentID]) > 0
+}
+
+// ExpiryExtender 账单即将过期且用户仍在收银台时，自动延长一次有效期
+type ExpiryExtender struct {
+	crypto    *CryptoService
+	hub       *CheckoutHub
+	enabled   bool
+	threshold time.Duration
+	extension time.Duration
+	interval  time.Duration
+	limiter   *rateLimiter
+}
+
+func NewExpiryExtender(crypto *CryptoService, hub *CheckoutHub) *ExpiryExtender {
+	perMinute := envInt("CHECKOUT_EXTENSION_RATE_PER_MINUTE", 60)
+	return &ExpiryExtender{
+		crypto:    crypto,
+		hub:       hub,
+		enabled:   os.Getenv("CHECKOUT_EXTENSION_ENABLED") == "true",
+		threshold: envDuration("CHECKOUT_EXTENSION_THRESHOLD", 2*time.Minute),
+		extension: envDuration("CHECKOUT_EXTENSION_DURATION", 10*time.Minute),
+		interval:  15 * time.Second,
+		limiter:   newRateLimiter(perMinute, time.Minute),
+	}
+}
+
+func (e *ExpiryExtender) Run(ctx context.Context) {
+	if !e.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.scan(time.Now())
+		}
+	}
+}
+
+func (e *ExpiryExtender) scan(now time.Time) {
+	invoices, err := e.crypto.invoices.List()
+	if err != nil {
+		log.Printf("加载支付账单失败: %v", err)
+		return
+	}
+
+	for _, invoice := range invoices {
+		if invoice.Status != InvoicePending || invoice.ExpiryExtended {
+			continue
+		}
+		if invoice.ExpiresAt.Before(now) || invoice.ExpiresAt.Sub(now) > e.threshold {
+			continue
+		}
+		if !e.hub.Active(invoice.PaymentID) {
+			continue
+		}
+		if !e.limiter.Allow() {
+			log.Printf("账单有效期延长已达速率上限，跳过 %s", invoice.PaymentID)
+			return
+		}
+
+		data, err := e.crypto.ExtendExpiry(invoice, e.extension)
+		if err != nil {
+			log.Printf("延长账单有效期失败 %s: %v", invoice.PaymentID, err)
+			continue
+		}
+		e.hub.Publish(invoice.PaymentID, CheckoutEvent{Type: "expiry_extended", Data: data})
+	}
+}
+
+// InvoiceExpirer 将超过有效期仍未付款的账单标记为 expired，并推送 expired 事件。
+// 过期账单的收款地址在冷却期内仍受监听，迟到的付款照常归属（见 AttributeTransfer）
+type InvoiceExpirer struct {
+	crypto   *CryptoService
+	hub      *CheckoutHub
+	interval time.Duration
+}
+
+func NewInvoiceExpirer(crypto *CryptoService, hub *CheckoutHub) *InvoiceExpirer {
+	return &InvoiceExpirer{
+		crypto:   crypto,
+		hub:      hub,
+		interval: envDuration("INVOICE_EXPIRY_SCAN_INTERVAL", 30*time.Second),
+	}
+}
+
+func (e *InvoiceExpirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := e.crypto.ExpireInvoices(now)
+			if err != nil {
+				log.Printf("标记过期账单失败: %v", err)
+			}
+			for _, invoice := range expired {
+				e.hub.Publish(invoice.PaymentID, CheckoutEvent{Type: "expired", Data: paymentStatus(invoice)})
+			}
+		}
+	}
+}
+
+// ExpireInvoices 在归属锁内标记已过期的待付款账单，返回本次标记的账单
+func (cs *CryptoService) ExpireInvoices(now time.Time) ([]*CryptoInvoice, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoices, err := cs.invoices.List()
+	if err != nil {
+		return nil, err
+	}
+	var expired []*CryptoInvoice
+	for _, invoice := range invoices {
+		if invoice.Status != InvoicePending || now.Before(invoice.ExpiresAt) {
+			continue
+		}
+		invoice.Status = InvoiceExpired
+		if err := cs.invoices.Save(invoice); err != nil {
+			return expired, err
+		}
+		expired = append(expired, invoice)
+	}
+	return expired, nil
+}
+
+// ExtendExpiry 重新签发账单以延长有效期，收款地址不变，每笔账单只允许延长一次
+func (cs *CryptoService) ExtendExpiry(invoice *CryptoInvoice, extension time.Duration) (*model.CryptoPayment, error) {
+	if invoice.ExpiryExtended {
+		return nil, fmt.Errorf("账单有效期已延长过")
+	}
+
+	invoice.ExpiresAt = invoice.ExpiresAt.Add(extension)
+	invoice.ExpiryExtended = true
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, err
+	}
+
+	// 延长的只是收款有效期，锁定汇率的有效期不变
+	return &model.CryptoPayment{
+		PaymentID:   invoice.PaymentID,
+		Address:     invoice.Address,
+		Currency:    invoice.Currency,
+		Network:     invoice.Network,
+		Amount:      invoice.Amount,
+		AmountExact: invoice.AmountExact,
+		ExpiredAt:   invoice.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// registerCheckoutRoutes 注册收银台 SSE 接口
+func registerCheckoutRoutes(api *gin.RouterGroup, cs *CryptoService, hub *CheckoutHub) {
+	api.GET("/crypto/checkout/:paymentId/events", func(c *gin.Context) {
+		paymentID := c.Param("paymentId")
+		invoice, err := cs.invoices.Get(paymentID)
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", err.Error())
+			return
+		}
+
+		events, unsubscribe := hub.Subscribe(paymentID)
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.SSEvent("status", &model.CryptoPaymentStatus{
+			PaymentID: invoice.PaymentID,
+			Status:    invoice.Status,
+		})
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case event := <-events:
+				c.SSEvent(event.Type, event.Data)
+				return true
+			case <-heartbeat.C:
+				c.SSEvent("ping", time.Now().Unix())
+				return true
+			}
+		})
+	})
+}
+
+// rateLimiter 固定窗口计数限流
+type rateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	count       int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window}
+}
+
+func (rl *rateLimiter) Allow() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.windowStart) >= rl.window {
+		rl.windowStart = now
+		rl.count = 0
+	}
+	if rl.count >= rl.limit {
+		return false
+	}
+	rl.count++
+	return true
+}
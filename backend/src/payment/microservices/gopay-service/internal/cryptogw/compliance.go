@@ -0,0 +1,582 @@
+package cryptogw
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 地址筛查结论
+const (
+	ScreeningClear    = "clear"    // 未命中
+	ScreeningFlagged  = "flagged"  // 命中制裁名单或 KYT 高风险
+	ScreeningError    = "error"    // 外部 KYT 服务不可用，下一轮重试
+	ScreeningApproved = "approved" // 命中后经合规人员复核放行
+)
+
+// 合规复核单状态
+const (
+	CaseOpen     = "open"
+	CaseApproved = "approved"
+	CaseRejected = "rejected"
+)
+
+// 合规复核类型
+const (
+	CaseSanctions  = "sanctions"   // 交易对手地址命中制裁名单或 KYT 高风险
+	CaseTravelRule = "travel_rule" // 付款金额达到旅行规则门槛，核对付款人信息
+)
+
+var ErrCaseNotFound = errors.New("合规复核单不存在")
+
+// ScreeningHit 地址命中的名单或风险类别
+type ScreeningHit struct {
+	Address  string `json:"address"`
+	Source   string `json:"source"`             // blocklist、chainalysis、trm
+	Category string `json:"category"`           // 如 sanctions
+	Name     string `json:"name,omitempty"`     // 名单条目或实体名称
+	Risk     string `json:"risk,omitempty"`     // 服务商给出的风险等级
+	Detail   string `json:"detail,omitempty"`   // 服务商的说明
+	URL      string `json:"url,omitempty"`      // 服务商控制台的详情页
+	RiskType string `json:"riskType,omitempty"` // 直接持有或间接暴露
+}
+
+// Screening 一次地址筛查的结果，记录在账单和退款单上
+type Screening struct {
+	Result     string         `json:"result"`
+	Addresses  []string       `json:"addresses,omitempty"`
+	Hits       []ScreeningHit `json:"hits,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	CaseID     string         `json:"caseId,omitempty"`
+	ScreenedAt time.Time      `json:"screenedAt"`
+}
+
+func (screening *Screening) flagged() bool {
+	return screening != nil && screening.Result == ScreeningFlagged
+}
+
+// passed 未筛查（未启用筛查）、未命中或已复核放行
+func (screening *Screening) passed() bool {
+	return screening == nil || screening.Result == ScreeningClear || screening.Result == ScreeningApproved
+}
+
+// KYTProvider 外部 KYT 服务适配器，见 kyt.go
+type KYTProvider interface {
+	Name() string
+	// ScreenAddress 返回地址命中的风险项，未命中时为空
+	ScreenAddress(ctx context.Context, network, address string) ([]ScreeningHit, error)
+}
+
+type cachedScreening struct {
+	hits []ScreeningHit
+	at   time.Time
+}
+
+// Screener 交易对手地址筛查：先查本地名单，未命中时再查外部 KYT 服务。
+// COMPLIANCE_BLOCKLIST 逗号分隔的地址，COMPLIANCE_BLOCKLIST_FILE 每行一个地址的名单文件（如 OFAC SDN 的数字货币地址，
+// 可写作 地址,说明，# 开头为注释）；COMPLIANCE_KYT_PROVIDER 为 chainalysis 或 trm 时启用外部服务，
+// 结果缓存 COMPLIANCE_SCREENING_TTL（默认 24 小时）。外部服务不可用时默认暂缓确认和退款，
+// COMPLIANCE_FAIL_OPEN=true 时放行。名单和服务均未配置时不筛查
+type Screener struct {
+	blocklist map[string]string // 地址 -> 名单说明
+	provider  KYTProvider
+	failOpen  bool
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedScreening
+}
+
+func NewScreener() *Screener {
+	s := &Screener{
+		blocklist: make(map[string]string),
+		failOpen:  os.Getenv("COMPLIANCE_FAIL_OPEN") == "true",
+		ttl:       envDuration("COMPLIANCE_SCREENING_TTL", 24*time.Hour),
+		cache:     make(map[string]cachedScreening),
+	}
+	for _, address := range splitList(os.Getenv("COMPLIANCE_BLOCKLIST")) {
+		s.blocklist[screeningKey(address)] = "COMPLIANCE_BLOCKLIST"
+	}
+	if path := os.Getenv("COMPLIANCE_BLOCKLIST_FILE"); path != "" {
+		if err := s.loadBlocklist(path); err != nil {
+			log.Fatalf("读取 COMPLIANCE_BLOCKLIST_FILE 失败: %v", err)
+		}
+	}
+
+	switch provider := strings.ToLower(os.Getenv("COMPLIANCE_KYT_PROVIDER")); provider {
+	case "":
+	case "chainalysis":
+		s.provider = newChainalysisProvider()
+	case "trm":
+		s.provider = newTRMProvider()
+	default:
+		log.Fatalf("COMPLIANCE_KYT_PROVIDER 只支持 chainalysis 和 trm: %s", provider)
+	}
+	if s.Enabled() {
+		provider := "未启用"
+		if s.provider != nil {
+			provider = s.provider.Name()
+		}
+		log.Printf("交易对手地址筛查已启用：本地名单 %d 个地址，外部 KYT 服务 %s", len(s.blocklist), provider)
+	}
+	return s
+}
+
+func (s *Screener) loadBlocklist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		address, label, _ := strings.Cut(line, ",")
+		if label = strings.TrimSpace(label); label == "" {
+			label = path
+		}
+		s.blocklist[screeningKey(strings.TrimSpace(address))] = label
+	}
+	return scanner.Err()
+}
+
+// screeningKey EVM 地址不区分大小写，其他链的地址原样比较
+func screeningKey(address string) string {
+	if strings.HasPrefix(address, "0x") || strings.HasPrefix(address, "0X") {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+// Enabled 配置了本地名单或外部 KYT 服务
+func (s *Screener) Enabled() bool {
+	return len(s.blocklist) > 0 || s.provider != nil
+}
+
+// needsScreening 尚未筛查或上次外部服务不可用
+func (s *Screener) needsScreening(screening *Screening) bool {
+	return s.Enabled() && (screening == nil || screening.Result == ScreeningError)
+}
+
+// pending 需要筛查但还没有可用的结论，此时暂缓确认或发送
+func (s *Screener) pending(screening *Screening) bool {
+	return s.Enabled() && (screening == nil || (screening.Result == ScreeningError && !s.failOpen))
+}
+
+// Screen 筛查一组交易对手地址，任一地址命中即为 flagged
+func (s *Screener) Screen(ctx context.Context, network string, addresses []string) *Screening {
+	screening := &Screening{Result: ScreeningClear, Addresses: addresses, ScreenedAt: time.Now()}
+	var errs []error
+	for _, address := range addresses {
+		hits, err := s.screenAddress(ctx, network, address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", address, err))
+			continue
+		}
+		screening.Hits = append(screening.Hits, hits...)
+	}
+	switch {
+	case len(screening.Hits) > 0:
+		screening.Result = ScreeningFlagged
+	case len(errs) > 0:
+		screening.Result = ScreeningError
+		screening.Error = errors.Join(errs...).Error()
+	}
+	return screening
+}
+
+func (s *Screener) screenAddress(ctx context.Context, network, address string) ([]ScreeningHit, error) {
+	key := screeningKey(address)
+	if label, ok := s.blocklist[key]; ok {
+		return []ScreeningHit{{Address: address, Source: "blocklist", Category: "sanctions", Name: label}}, nil
+	}
+	if s.provider == nil {
+		return nil, nil
+	}
+
+	cacheKey := network + ":" + key
+	s.mu.Lock()
+	cached, ok := s.cache[cacheKey]
+	s.mu.Unlock()
+	if ok && time.Since(cached.at) < s.ttl {
+		return cached.hits, nil
+	}
+	hits, err := s.provider.ScreenAddress(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("%s 筛查失败: %w", s.provider.Name(), err)
+	}
+	s.mu.Lock()
+	s.cache[cacheKey] = cachedScreening{hits: hits, at: time.Now()}
+	s.mu.Unlock()
+	return hits, nil
+}
+
+// describeHits 复核单和日志中的命中摘要
+func describeHits(hits []ScreeningHit) string {
+	parts := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		part := fmt.Sprintf("%s 命中 %s %s", hit.Address, hit.Source, hit.Category)
+		if hit.Name != "" {
+			part += "（" + hit.Name + "）"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "；")
+}
+
+// ComplianceCase 等待合规人员复核的付款或退款
+type ComplianceCase struct {
+	CaseID    string         `json:"caseId"`
+	Kind      string         `json:"kind"`
+	PaymentID string         `json:"paymentId"`
+	RefundID  string         `json:"refundId,omitempty"` // 退款地址的复核
+	Currency  string         `json:"currency"`
+	Network   string         `json:"network"`
+	Amount    string         `json:"amount"`
+	TxHash    string         `json:"txHash,omitempty"`
+	Addresses []string       `json:"addresses,omitempty"`
+	Hits      []ScreeningHit `json:"hits,omitempty"`
+	// 旅行规则复核时下单提供的付款人信息
+	Originator *TravelRuleOriginator `json:"originator,omitempty"`
+	Reason     string                `json:"reason"`
+	Status     string                `json:"status"`
+	Operator   string                `json:"operator,omitempty"`
+	Note       string                `json:"note,omitempty"`
+	CreatedAt  time.Time             `json:"createdAt"`
+	UpdatedAt  time.Time             `json:"updatedAt"`
+}
+
+// ComplianceQueue 合规复核队列
+type ComplianceQueue struct {
+	mu    sync.RWMutex
+	cases map[string]*ComplianceCase
+	table *queueTable // 为 nil 时只保存在内存中
+}
+
+func NewComplianceQueue() *ComplianceQueue {
+	return &ComplianceQueue{cases: make(map[string]*ComplianceCase)}
+}
+
+// Open 新建复核单并返回单号
+func (q *ComplianceQueue) Open(item *ComplianceCase) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	item.CaseID = fmt.Sprintf("CC%d", now.UnixNano())
+	item.Status = CaseOpen
+	item.CreatedAt, item.UpdatedAt = now, now
+	copied := *item
+	q.cases[item.CaseID] = &copied
+	q.table.save(item.CaseID, item.Status, item.CreatedAt, item.UpdatedAt, item)
+	return item.CaseID
+}
+
+func (q *ComplianceQueue) Get(caseID string) (*ComplianceCase, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	item, ok := q.cases[caseID]
+	if !ok {
+		return nil, ErrCaseNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (q *ComplianceQueue) Save(item *ComplianceCase) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item.UpdatedAt = time.Now()
+	copied := *item
+	q.cases[item.CaseID] = &copied
+	q.table.save(item.CaseID, item.Status, item.CreatedAt, item.UpdatedAt, item)
+}
+
+// List 按创建时间顺序返回指定状态和类型的复核单，条件为空时不限
+func (q *ComplianceQueue) List(status, kind string) []*ComplianceCase {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	items := make([]*ComplianceCase, 0)
+	for _, item := range q.cases {
+		if (status == "" || item.Status == status) && (kind == "" || item.Kind == kind) {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items
+}
+
+// screenPayment 筛查入账的付款方地址并记录在账单上。筛查在归属锁外进行，记录前核对入账交易未被替换。
+// 外部监听服务推送的入账未提供付款方地址时无从筛查，按未命中记录
+func (cs *CryptoService) screenPayment(ctx context.Context, candidate *CryptoInvoice) {
+	screening := cs.screener.Screen(ctx, candidate.Network, candidate.Senders)
+	paymentID := candidate.PaymentID
+
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoice, err := cs.invoices.Get(paymentID)
+	if err != nil || invoice.TxHash != candidate.TxHash || !invoice.awaitingConfirmation() {
+		return
+	}
+	invoice.Screening = screening
+	if err := cs.invoices.Save(invoice); err != nil {
+		log.Printf("记录账单 %s 的筛查结果失败: %v", paymentID, err)
+		return
+	}
+	switch screening.Result {
+	case ScreeningFlagged:
+		log.Printf("【合规】账单 %s 的付款方地址命中名单: %s", paymentID, describeHits(screening.Hits))
+	case ScreeningError:
+		log.Printf("【合规】账单 %s 的付款方地址筛查失败，暂缓确认: %s", paymentID, screening.Error)
+	}
+}
+
+// paymentCase 账单入账的复核单
+func paymentCase(invoice *CryptoInvoice, kind, reason string) *ComplianceCase {
+	return &ComplianceCase{
+		Kind:      kind,
+		PaymentID: invoice.PaymentID,
+		Currency:  invoice.Currency,
+		Network:   invoice.Network,
+		Amount:    formatAmount(decimalRat(invoice.PaidAmount), Asset{Currency: invoice.Currency, Network: invoice.Network}.Decimals()),
+		TxHash:    invoice.TxHash,
+		Reason:    reason,
+	}
+}
+
+// holdPayment 付款方地址命中名单的入账达到确认数后挂起，转合规复核
+func (cs *CryptoService) holdPayment(invoice *CryptoInvoice) {
+	item := paymentCase(invoice, CaseSanctions, "付款方地址 "+describeHits(invoice.Screening.Hits))
+	item.Addresses = invoice.Screening.Addresses
+	item.Hits = invoice.Screening.Hits
+
+	invoice.Status = InvoiceHeld
+	invoice.Screening.CaseID = cs.compliance.Open(item)
+	log.Printf("【合规】账单 %s 的入账 %s 已达到确认数，付款方地址命中名单，挂起等待复核 %s", invoice.PaymentID, invoice.TxHash, invoice.Screening.CaseID)
+}
+
+// screenRefund 发送退款前筛查退款地址，命中时退款单挂起并转合规复核。返回不能发送的原因
+func (cs *CryptoService) screenRefund(ctx context.Context, refund *CryptoRefund) *apierr.Response {
+	if cs.screener.needsScreening(refund.Screening) {
+		refund.Screening = cs.screener.Screen(ctx, refund.Network, []string{refund.ToAddress})
+	}
+	switch {
+	case refund.Screening.flagged():
+		refund.Status = RefundHeld
+		refund.Screening.CaseID = cs.compliance.Open(&ComplianceCase{
+			Kind:      CaseSanctions,
+			PaymentID: refund.PaymentID,
+			RefundID:  refund.RefundID,
+			Currency:  refund.Currency,
+			Network:   refund.Network,
+			Amount:    refund.AmountExact,
+			Addresses: refund.Screening.Addresses,
+			Hits:      refund.Screening.Hits,
+			Reason:    "退款地址 " + describeHits(refund.Screening.Hits),
+		})
+		cs.refunds.Save(refund)
+		log.Printf("【合规】退款 %s 的退款地址命中名单，挂起等待复核 %s", refund.RefundID, refund.Screening.CaseID)
+		return apierr.ErrorResponse("COMPLIANCE_HOLD", fmt.Sprintf("退款地址命中制裁名单或高风险，已转合规复核 %s", refund.Screening.CaseID))
+	case cs.screener.pending(refund.Screening):
+		cs.refunds.Save(refund)
+		return apierr.ErrorResponse("SCREENING_UNAVAILABLE", fmt.Sprintf("退款地址筛查失败，请稍后重试: %s", refund.Screening.Error))
+	}
+	return nil
+}
+
+type ResolveCaseRequest struct {
+	Operator string `json:"operator"` // 启用管理接口认证时取访问令牌中的用户名
+	Note     string `json:"note"`
+}
+
+// ResolveCase 合规人员处理复核单。放行的付款按已确认入账，还需旅行规则复核时转入新的复核单，
+// 拒绝的付款标记为 rejected，款项按合规流程另行处置；
+// 放行的退款回到待发送，拒绝的退款不再发送
+func (cs *CryptoService) ResolveCase(caseID string, approve bool, req *ResolveCaseRequest) (*apierr.Response, []*ConfirmationUpdate, error) {
+	item, err := cs.compliance.Get(caseID)
+	if err != nil {
+		return apierr.ErrorResponse("CASE_NOT_FOUND", err.Error()), nil, nil
+	}
+	if item.Status != CaseOpen {
+		return apierr.ErrorResponse("INVALID_STATE", "复核单已处理"), nil, nil
+	}
+
+	var updates []*ConfirmationUpdate
+	var resp *apierr.Response
+	if item.RefundID != "" {
+		resp, err = cs.resolveRefundCase(item, approve)
+	} else {
+		resp, updates, err = cs.resolvePaymentCase(item, approve)
+	}
+	if resp != nil || err != nil {
+		return resp, nil, err
+	}
+
+	action := "拒绝"
+	item.Status = CaseRejected
+	if approve {
+		item.Status, action = CaseApproved, "放行"
+	}
+	item.Operator, item.Note = req.Operator, req.Note
+	cs.compliance.Save(item)
+	log.Printf("【合规】复核单 %s 已%s，操作人 %s", caseID, action, req.Operator)
+	return apierr.SuccessResponse(item), updates, nil
+}
+
+func (cs *CryptoService) resolvePaymentCase(item *ComplianceCase, approve bool) (*apierr.Response, []*ConfirmationUpdate, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoice, err := cs.invoices.Get(item.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil, nil
+	}
+	if invoice.Status != InvoiceHeld {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("账单状态 %s 不在合规挂起中", invoice.Status)), nil, nil
+	}
+
+	now := time.Now()
+	event := "compliance_rejected"
+	switch {
+	case !approve:
+		invoice.Status = InvoiceRejected
+	case item.Kind == CaseTravelRule:
+		invoice.TravelRule.Approved = true
+	case invoice.Screening != nil:
+		invoice.Screening.Result = ScreeningApproved
+	}
+	if approve {
+		if invoice.TravelRule.pending() {
+			// 地址筛查放行后仍需核对付款人信息，账单保持挂起
+			cs.holdTravelRule(invoice)
+			event = "compliance_hold"
+		} else {
+			event = "compliance_approved"
+			invoice.Status = InvoiceConfirmed
+			invoice.ConfirmedAt = now
+		}
+	}
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, nil, err
+	}
+	updates := []*ConfirmationUpdate{{Invoice: invoice, Event: event}}
+	if invoice.Status == InvoiceConfirmed && invoice.ParentPaymentID != "" {
+		update, err := cs.settleTopUpParent(invoice, now)
+		if err != nil {
+			return nil, updates, err
+		}
+		if update != nil {
+			updates = append(updates, update)
+		}
+	}
+	return nil, updates, nil
+}
+
+func (cs *CryptoService) resolveRefundCase(item *ComplianceCase, approve bool) (*apierr.Response, error) {
+	cs.refundMu.Lock()
+	defer cs.refundMu.Unlock()
+
+	refund, err := cs.refunds.Get(item.RefundID)
+	if err != nil {
+		return apierr.ErrorResponse("REFUND_NOT_FOUND", err.Error()), nil
+	}
+	if refund.Status != RefundHeld {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("退款状态 %s 不在合规挂起中", refund.Status)), nil
+	}
+	refund.Status = RefundRejected
+	if approve {
+		refund.Status = RefundQueued
+		if refund.Screening != nil {
+			refund.Screening.Result = ScreeningApproved
+		}
+	}
+	cs.refunds.Save(refund)
+	return nil, nil
+}
+
+// registerComplianceRoutes 注册合规复核接口（按 status、kind 筛选复核单），以及供财务手工转账前使用的地址筛查接口
+func registerComplianceRoutes(api *gin.RouterGroup, cs *CryptoService, hub *CheckoutHub) {
+	admin := api.Group("/crypto/admin/compliance")
+
+	admin.GET("/cases", func(c *gin.Context) {
+		apierr.RespondOK(c, cs.compliance.List(c.DefaultQuery("status", CaseOpen), c.Query("kind")))
+	})
+
+	admin.GET("/cases/:caseId", func(c *gin.Context) {
+		item, err := cs.compliance.Get(c.Param("caseId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "CASE_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, item)
+	})
+
+	resolve := func(approve bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var req ResolveCaseRequest
+			// 启用认证时操作人取自访问令牌，备注可选，可以不传请求体
+			if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+				return
+			}
+			var ok bool
+			if req.Operator, ok = requestOperator(c, req.Operator); !ok {
+				return
+			}
+			resp, updates, err := cs.ResolveCase(c.Param("caseId"), approve, &req)
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+			publishConfirmations(hub, updates)
+			c.JSON(http.StatusOK, resp)
+		}
+	}
+	admin.POST("/cases/:caseId/approve", resolve(true))
+	admin.POST("/cases/:caseId/reject", resolve(false))
+
+	admin.POST("/screen", func(c *gin.Context) {
+		var req struct {
+			Network string `json:"network" binding:"required"`
+			Address string `json:"address" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		network, ok := networkAliases[strings.ToLower(req.Network)]
+		if !ok {
+			apierr.RespondError(c, http.StatusBadRequest, "UNSUPPORTED_NETWORK", fmt.Sprintf("不支持的网络: %s", req.Network))
+			return
+		}
+		if !cs.screener.Enabled() {
+			apierr.RespondError(c, http.StatusServiceUnavailable, "SCREENING_DISABLED", "未配置制裁名单或 KYT 服务")
+			return
+		}
+		apierr.RespondOK(c, cs.screener.Screen(c.Request.Context(), network, []string{strings.TrimSpace(req.Address)}))
+	})
+}
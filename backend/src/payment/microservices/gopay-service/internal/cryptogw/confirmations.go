@@ -0,0 +1,430 @@
+package cryptogw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopay-service/internal/model"
+)
+
+// defaultConfirmations 各网络入账达到最终确认所需的区块确认数，可用 CONFIRMATIONS_<网络> 覆盖，如 CONFIRMATIONS_ERC20=20；
+// 账单入账还可按金额分档（见 ConfirmationBands）
+var defaultConfirmations = map[string]int{
+	"BTC":     2,
+	"ERC20":   12,
+	"BEP20":   15,
+	"POLYGON": 128, // Polygon PoS 历史上出现过数十个区块的重组
+	"TRC20":   19,  // TRON 由 27 个超级代表出块，19 个确认后区块不可逆
+	"SOL":     32,  // 按 slot 计算，约 32 个 slot 后区块最终确认
+	"XRP":     1,   // XRP Ledger、Stellar 的共识账本一经验证即最终确认，TON 的主链区块同样即时最终
+	"XLM":     1,
+	"TON":     1,
+}
+
+// requiredConfirmations 网络所需的确认数
+func requiredConfirmations(network string) int {
+	return envInt("CONFIRMATIONS_"+network, defaultConfirmations[network])
+}
+
+// 确认数规则
+const (
+	ConfirmationRuleNetwork = "network" // 网络默认值
+	ConfirmationRuleBand    = "band"    // 按入账金额分档
+)
+
+// ConfirmationPolicy 入账适用的确认数规则，随账单状态返回
+type ConfirmationPolicy = model.ConfirmationPolicy
+
+type confirmationBand struct {
+	below    float64 // 入账折合金额低于该值时适用
+	required int
+}
+
+// ConfirmationBands 按入账金额分档的确认数。CONFIRMATION_BANDS_<网络> 为逗号分隔的 上限:确认数，按上限升序，
+// 如 CONFIRMATION_BANDS_BTC=50:1,500:3 表示低于 50 需 1 个确认、低于 500 需 3 个，其余按 CONFIRMATIONS_BTC；
+// 金额以 CONFIRMATION_BAND_CURRENCY（默认 USD）计，汇率在下单时锁定（见 CryptoInvoice.BandRate）
+type ConfirmationBands struct {
+	currency string
+	bands    map[string][]confirmationBand
+}
+
+func NewConfirmationBands() *ConfirmationBands {
+	b := &ConfirmationBands{
+		currency: strings.ToUpper(envString("CONFIRMATION_BAND_CURRENCY", "USD")),
+		bands:    make(map[string][]confirmationBand),
+	}
+	for network := range networkNames {
+		key := "CONFIRMATION_BANDS_" + network
+		raw := os.Getenv(key)
+		if raw == "" {
+			continue
+		}
+		bands, err := parseConfirmationBands(raw)
+		if err != nil {
+			log.Fatalf("%s 配置错误: %v", key, err)
+		}
+		b.bands[network] = bands
+		log.Printf("%s 入账按金额分档确认：%s，以 %s 计，其余 %d 个确认", networkNames[network], raw, b.currency, requiredConfirmations(network))
+	}
+	return b
+}
+
+func parseConfirmationBands(raw string) ([]confirmationBand, error) {
+	var bands []confirmationBand
+	for _, item := range splitList(raw) {
+		below, required, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("档位应为 上限:确认数: %s", item)
+		}
+		var band confirmationBand
+		var err error
+		if band.below, err = strconv.ParseFloat(strings.TrimSpace(below), 64); err != nil || band.below <= 0 {
+			return nil, fmt.Errorf("金额上限无效: %s", item)
+		}
+		if band.required, err = strconv.Atoi(strings.TrimSpace(required)); err != nil || band.required <= 0 {
+			return nil, fmt.Errorf("确认数无效: %s", item)
+		}
+		if n := len(bands); n > 0 && band.below <= bands[n-1].below {
+			return nil, fmt.Errorf("金额上限须升序: %s", item)
+		}
+		bands = append(bands, band)
+	}
+	return bands, nil
+}
+
+// banded 网络配置了金额分档
+func (b *ConfirmationBands) banded(network string) bool {
+	return len(b.bands[network]) > 0
+}
+
+// policy 按入账金额确定所需确认数。未配置分档或下单时未能取得汇率时取网络默认值
+func (b *ConfirmationBands) policy(invoice *CryptoInvoice) *ConfirmationPolicy {
+	policy := &ConfirmationPolicy{
+		Network:  invoice.Network,
+		Required: requiredConfirmations(invoice.Network),
+		Rule:     ConfirmationRuleNetwork,
+	}
+	bands := b.bands[invoice.Network]
+	if len(bands) == 0 || invoice.BandRate <= 0 {
+		return policy
+	}
+
+	policy.Rule = ConfirmationRuleBand
+	policy.Currency = b.currency
+	policy.Value = math.Round(invoice.PaidAmount*invoice.BandRate*100) / 100
+	lower := 0.0
+	for _, band := range bands {
+		if policy.Value < band.below {
+			policy.Required = band.required
+			policy.Band = fmt.Sprintf("[%g, %g) %s", lower, band.below, b.currency)
+			return policy
+		}
+		lower = band.below
+	}
+	policy.Band = fmt.Sprintf(">= %g %s", lower, b.currency)
+	return policy
+}
+
+// applyConfirmationPolicy 入账归属后按金额确定所需确认数，并在账单上记录所用规则
+func (cs *CryptoService) applyConfirmationPolicy(invoice *CryptoInvoice) {
+	invoice.ConfirmationPolicy = cs.bands.policy(invoice)
+	invoice.RequiredConfirmations = invoice.ConfirmationPolicy.Required
+}
+
+// reorgWatchBlocks 账单确认后继续核实入账的区块数，默认与所需确认数相同，可用 REORG_WATCH_<网络> 覆盖
+func reorgWatchBlocks(network string) int {
+	return envInt("REORG_WATCH_"+network, requiredConfirmations(network))
+}
+
+// TxLocation 交易所在区块
+type TxLocation struct {
+	Height    int64
+	BlockHash string // TRON、Solana 查询交易时不返回区块哈希，为空时只按高度比较
+}
+
+// TxLocator 链上监听器实现，确认前后查询交易当前所在的区块
+type TxLocator interface {
+	// LocateTx 返回交易所在区块，交易因链重组被移出主链时 ok 为 false；比特币内存池中的交易高度为 0
+	LocateTx(ctx context.Context, txHash string) (loc TxLocation, ok bool, err error)
+}
+
+// ConfirmationUpdate 确认流程中有变化的账单及推送给收银台的事件：
+// confirmations 确认数变化；topup_confirmed 补款账单已确认，少付的原账单视为足额；
+// compliance_hold 付款方地址命中名单或金额达到旅行规则门槛，达到确认数后挂起，compliance_approved、compliance_rejected 合规复核的结果；reorg 入账所在区块被重组；payment_reverted 已确认的入账被重组，账单退回确认中，
+// 业务方应暂停发货；payment_failed 入账交易被移出主链后超过 REORG_FAIL_AFTER 仍未重新打包，账单失败；
+// refund_confirmed、refund_failed 退款交易已确认或未能上链，此时 Invoice 为空
+type ConfirmationUpdate struct {
+	Invoice *CryptoInvoice
+	Refund  *CryptoRefund
+	Event   string
+}
+
+// AdvanceConfirmations 按链上最新区块高度推进该网络确认中账单的确认数，达到所需确认数后标记为已确认。
+// locator 不为 nil 时先核实交易仍在原区块：交易被重组移出或重新打包到其他区块时按新位置重新计算确认数，
+// 已确认的账单在确认后 reorgWatchBlocks 个区块内同样核实，被重组时退回确认中；
+// 外部监听服务通过心跳推进时 locator 为 nil，只按上报的区块高度计算。已广播的退款交易随后一并跟踪（见 trackRefunds）。
+// 返回有变化的账单和退款单
+func (cs *CryptoService) AdvanceConfirmations(ctx context.Context, network string, head int64, locator TxLocator) ([]*ConfirmationUpdate, error) {
+	if head <= 0 {
+		return nil, nil
+	}
+	invoices, err := cs.invoices.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*ConfirmationUpdate
+	for _, candidate := range invoices {
+		if candidate.Network != network || candidate.TxHash == "" {
+			continue
+		}
+		switch {
+		case candidate.awaitingConfirmation():
+		case candidate.Status == InvoiceConfirmed:
+			if locator == nil || candidate.Confirmations >= candidate.RequiredConfirmations+reorgWatchBlocks(network) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if candidate.awaitingConfirmation() && cs.screener.needsScreening(candidate.Screening) {
+			cs.screenPayment(ctx, candidate)
+		}
+
+		var located TxLocation
+		var onChain bool
+		if locator != nil {
+			if located, onChain, err = locator.LocateTx(ctx, candidate.TxHash); err != nil {
+				log.Printf("查询交易 %s 所在区块失败: %v", candidate.TxHash, err)
+				continue
+			}
+		}
+
+		updates, err := cs.applyConfirmations(candidate.PaymentID, head, locator != nil, located, onChain)
+		changed = append(changed, updates...)
+		if err != nil {
+			return changed, err
+		}
+	}
+	return append(changed, cs.trackRefunds(ctx, network)...), nil
+}
+
+// applyConfirmations 在归属锁内重新读取账单后更新确认数，避免覆盖同时进行的人工复核或重新报价。
+// 少付、多付的账单只更新确认数，差额处理后才会确认；补款账单确认时原账单一并回到确认流程
+func (cs *CryptoService) applyConfirmations(paymentID string, head int64, verified bool, located TxLocation, onChain bool) ([]*ConfirmationUpdate, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoice, err := cs.invoices.Get(paymentID)
+	if err != nil || (!invoice.awaitingConfirmation() && invoice.Status != InvoiceConfirmed) {
+		return nil, err
+	}
+	previous := *invoice
+	now := time.Now()
+	event := "confirmations"
+
+	if verified {
+		blockHash := located.BlockHash
+		if blockHash == "" && located.Height == invoice.BlockHeight {
+			blockHash = invoice.BlockHash
+		}
+		if !onChain {
+			located, blockHash = TxLocation{}, ""
+		}
+		reorged := invoice.BlockHeight > 0 &&
+			(located.Height != invoice.BlockHeight || (blockHash != "" && invoice.BlockHash != "" && blockHash != invoice.BlockHash))
+		if reorged {
+			event = "reorg"
+			invoice.Reorgs++
+			if located.Height > 0 {
+				log.Printf("【链重组】交易 %s 从区块 %d 重新打包到区块 %d，账单 %s 重新计算确认数", invoice.TxHash, invoice.BlockHeight, located.Height, paymentID)
+			} else {
+				log.Printf("【链重组】交易 %s 已不在区块 %d，账单 %s 等待交易重新打包", invoice.TxHash, invoice.BlockHeight, paymentID)
+			}
+		}
+		invoice.BlockHeight, invoice.BlockHash = located.Height, blockHash
+		if !onChain {
+			if invoice.MissingSince.IsZero() {
+				invoice.MissingSince = now
+			}
+		} else {
+			invoice.MissingSince = time.Time{}
+		}
+	}
+
+	invoice.Confirmations = 0
+	if invoice.BlockHeight > 0 && head >= invoice.BlockHeight {
+		invoice.Confirmations = int(head-invoice.BlockHeight) + 1
+	}
+	if invoice.BlockHeight > 0 {
+		invoice.Replaceable = false
+	}
+	if invoice.RequiredConfirmations == 0 {
+		cs.applyConfirmationPolicy(invoice)
+	}
+
+	switch {
+	case invoice.Status == InvoiceConfirmed && invoice.Confirmations < invoice.RequiredConfirmations:
+		invoice.Status = InvoiceConfirming
+		invoice.ConfirmedAt = time.Time{}
+		invoice.RevertedAt = now
+		event = "payment_reverted"
+		log.Printf("【链重组】已确认账单 %s 的入账 %s 确认数回退到 %d，退回确认中", paymentID, invoice.TxHash, invoice.Confirmations)
+	case invoice.Status == InvoiceConfirming && invoice.Confirmations >= invoice.RequiredConfirmations && cs.screener.pending(invoice.Screening):
+		// 付款方地址还没有筛查结论（KYT 服务不可用），下一轮重新筛查后再确认
+	case invoice.Status == InvoiceConfirming && invoice.Confirmations >= invoice.RequiredConfirmations && invoice.Screening.flagged():
+		cs.holdPayment(invoice)
+		event = "compliance_hold"
+	case invoice.Status == InvoiceConfirming && invoice.Confirmations >= invoice.RequiredConfirmations && invoice.TravelRule.pending():
+		cs.holdTravelRule(invoice)
+		event = "compliance_hold"
+	case invoice.Status == InvoiceConfirming && invoice.Confirmations >= invoice.RequiredConfirmations:
+		invoice.Status = InvoiceConfirmed
+		invoice.ConfirmedAt = now
+		log.Printf("账单 %s 的入账 %s 已达到 %d 个确认", paymentID, invoice.TxHash, invoice.Confirmations)
+	case invoice.awaitingConfirmation() && !invoice.MissingSince.IsZero() &&
+		now.Sub(invoice.MissingSince) > envDuration("REORG_FAIL_AFTER", time.Hour):
+		invoice.Status = InvoiceFailed
+		event = "payment_failed"
+		log.Printf("【链重组】账单 %s 的入账 %s 自 %s 起不在链上，账单失败", paymentID, invoice.TxHash, invoice.MissingSince.Format(time.RFC3339))
+	}
+
+	if invoice.Status == previous.Status && invoice.BlockHeight == previous.BlockHeight && invoice.BlockHash == previous.BlockHash &&
+		invoice.Confirmations == previous.Confirmations && invoice.MissingSince.Equal(previous.MissingSince) {
+		return nil, nil
+	}
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, err
+	}
+	var updates []*ConfirmationUpdate
+	// 已确认账单在观察窗口内的确认数增长不再推送
+	if previous.Status != InvoiceConfirmed || invoice.Status != InvoiceConfirmed || event != "confirmations" {
+		updates = append(updates, &ConfirmationUpdate{Invoice: invoice, Event: event})
+	}
+	if invoice.ParentPaymentID != "" && invoice.Status == InvoiceConfirmed && previous.Status != InvoiceConfirmed {
+		update, err := cs.settleTopUpParent(invoice, now)
+		if err != nil {
+			return updates, err
+		}
+		if update != nil {
+			updates = append(updates, update)
+		}
+	}
+	return updates, nil
+}
+
+// watchedAddresses 链上监听器需要监听的收款地址，按币种区分。
+// 过期账单在地址回收冷却期内仍然监听，迟到的转账可以归属到原账单
+func (cs *CryptoService) watchedAddresses(network string) (map[string]map[string]bool, error) {
+	invoices, err := cs.invoices.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	watched := make(map[string]map[string]bool)
+	for _, invoice := range invoices {
+		if invoice.Network != network || invoice.Address == "" {
+			continue
+		}
+		if invoice.Status != InvoicePending && invoice.Status != InvoiceExpired {
+			continue
+		}
+		if now.Sub(invoice.ExpiresAt) > cs.addresses.cooldown {
+			continue
+		}
+		if watched[invoice.Currency] == nil {
+			watched[invoice.Currency] = make(map[string]bool)
+		}
+		// EVM 地址的大小写只是 EIP-55 校验，统一转小写比较；TRON 的 Base58 地址区分大小写
+		address := invoice.Address
+		if _, ok := evmChains[network]; ok {
+			address = strings.ToLower(address)
+		}
+		watched[invoice.Currency][address] = true
+	}
+	return watched, nil
+}
+
+// deliverTransfer 链上监听器发现的入账交给归属，新归属的入账推送给收银台
+func (cs *CryptoService) deliverTransfer(hub *CheckoutHub, transfer *InboundTransfer) {
+	result, err := cs.AttributeTransfer(transfer)
+	if err != nil {
+		log.Printf("入账 %s 归属失败: %v", transfer.TxHash, err)
+		return
+	}
+	if result.Reorged {
+		if invoice, err := cs.invoices.Get(result.PaymentID); err == nil {
+			hub.Publish(invoice.PaymentID, CheckoutEvent{Type: "reorg", Data: paymentStatus(invoice)})
+		}
+	}
+	if result.PaymentID == "" || result.Duplicate {
+		return
+	}
+	log.Printf("%s 入账 %s %v %s 已归属账单 %s", networkNames[transfer.Network], transfer.TxHash, transfer.Amount, transfer.Currency, result.PaymentID)
+	event := "transfer_detected"
+	if result.AmountMismatch {
+		// 收银台提示用户补款，或等待运营处理
+		event = "amount_mismatch"
+	}
+	if invoice, err := cs.invoices.Get(result.PaymentID); err == nil {
+		hub.Publish(invoice.PaymentID, CheckoutEvent{Type: event, Data: paymentStatus(invoice)})
+	}
+}
+
+// publishConfirmations 向收银台推送确认进度，链重组导致的退回和失败，以及退款结果
+func publishConfirmations(hub *CheckoutHub, updates []*ConfirmationUpdate) {
+	for _, update := range updates {
+		if update.Refund != nil {
+			hub.Publish(update.Refund.PaymentID, CheckoutEvent{Type: update.Event, Data: update.Refund.customerView()})
+			continue
+		}
+		hub.Publish(update.Invoice.PaymentID, CheckoutEvent{Type: update.Event, Data: paymentStatus(update.Invoice)})
+	}
+}
+
+// paymentStatus 账单的支付状态及入账确认进度
+func paymentStatus(invoice *CryptoInvoice) *model.CryptoPaymentStatus {
+	status := &model.CryptoPaymentStatus{
+		PaymentID:             invoice.PaymentID,
+		Status:                invoice.Status,
+		TxHash:                invoice.TxHash,
+		Replaceable:           invoice.Replaceable,
+		Confirmations:         invoice.Confirmations,
+		RequiredConfirmations: invoice.RequiredConfirmations,
+		Reorgs:                invoice.Reorgs,
+		ExpectedAmount:        invoice.AmountExact,
+		ActualAmount:          invoice.PaidAmount,
+		AmountDelta:           invoice.AmountDelta,
+		TopUpPaymentID:        invoice.TopUpPaymentID,
+		ConfirmationPolicy:    invoice.ConfirmationPolicy,
+		TxURL:                 explorerTxURL(invoice.Network, invoice.TxHash),
+		AddressURL:            explorerAddressURL(invoice.Network, invoice.Address),
+	}
+	if invoice.Resolution != nil {
+		status.Resolution = invoice.Resolution.Action
+	}
+	if invoice.TxHash != "" {
+		switch {
+		case invoice.BlockHeight > 0:
+			status.TxStatus = model.TxMined
+		case !invoice.MissingSince.IsZero():
+			status.TxStatus = model.TxDropped
+		default:
+			status.TxStatus = model.TxPending
+		}
+	}
+	if !invoice.RevertedAt.IsZero() {
+		status.RevertedAt = invoice.RevertedAt.Format(time.RFC3339)
+	}
+	if !invoice.PaidAt.IsZero() {
+		status.PaidAt = invoice.PaidAt.Format(time.RFC3339)
+	}
+	return status
+}
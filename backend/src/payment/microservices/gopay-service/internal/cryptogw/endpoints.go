@@ -0,0 +1,299 @@
+package cryptogw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopay-service/internal/model"
+)
+
+// 节点健康状态
+const (
+	endpointHealthy  = "healthy"
+	endpointDown     = "down"     // 连续失败，冷却期内不再使用
+	endpointDisabled = "disabled" // 链 ID 不一致等配置错误，不再使用
+)
+
+// rpcEndpoint 一个链上节点（Infura、Alchemy、QuickNode、公共节点或自建节点）及其健康统计
+type rpcEndpoint struct {
+	URL  string
+	name string // 去掉路径和参数的地址，Infura、Alchemy 的 API Key 在路径中，日志和状态接口只展示 name
+
+	budget  int          // 每分钟请求预算，0 表示不限
+	limiter *rateLimiter // budget 为 0 时为 nil
+
+	// 以下字段由 EndpointPool.mu 保护
+	verified  bool
+	disabled  string        // 停用原因
+	latency   time.Duration // 成功请求耗时的指数移动平均
+	failures  int           // 连续失败次数
+	downUntil time.Time
+	requests  int64
+	errors    int64
+	lastError string
+}
+
+// allow 消耗一次请求预算
+func (ep *rpcEndpoint) allow() bool {
+	return ep.limiter == nil || ep.limiter.Allow()
+}
+
+// EndpointPool 同一网络的多个节点。请求优先发往评分最好的健康节点：评分为成功请求的平均耗时，
+// 连续失败时加罚；节点请求失败时按评分顺序换下一个，连续失败达到阈值后进入冷却（逐次翻倍，最长 10 分钟），
+// 冷却期间由健康检查探测，恢复后重新参与评分。超出每分钟预算的节点本轮跳过，把流量让给其他节点，
+// 避免单个服务商故障或限流让整条链的监听停摆。配置项以网络前缀区分：
+// <前缀>_RPC_BUDGET 每分钟请求预算，单个值适用于全部节点，逗号分隔时按节点顺序分别设置，0 表示不限；
+// RPC_FAIL_THRESHOLD 连续失败多少次进入冷却（默认 3），RPC_COOLDOWN 首次冷却时长（默认 30s），
+// RPC_HEALTH_INTERVAL 健康检查间隔（默认 30s）
+type EndpointPool struct {
+	network   string
+	endpoints []*rpcEndpoint
+	threshold int
+	cooldown  time.Duration
+
+	mu sync.Mutex
+}
+
+// newEndpointPool 按配置创建节点池，并登记到网关状态
+func (cs *CryptoService) newEndpointPool(network, prefix string, urls []string) *EndpointPool {
+	pool := &EndpointPool{
+		network:   network,
+		threshold: max(envInt("RPC_FAIL_THRESHOLD", 3), 1),
+		cooldown:  envDuration("RPC_COOLDOWN", 30*time.Second),
+	}
+	budgets := splitList(envString(prefix+"_RPC_BUDGET", "0"))
+	for i, raw := range urls {
+		ep := &rpcEndpoint{URL: raw, name: endpointName(raw)}
+		budget := budgets[min(i, len(budgets)-1)]
+		if n, err := strconv.Atoi(budget); err != nil || n < 0 {
+			log.Fatalf("%s_RPC_BUDGET 配置无效: %s", prefix, budget)
+		} else if n > 0 {
+			ep.budget = n
+			ep.limiter = newRateLimiter(n, time.Minute)
+		}
+		pool.endpoints = append(pool.endpoints, ep)
+	}
+
+	cs.endpointsMu.Lock()
+	cs.endpoints = append(cs.endpoints, pool)
+	cs.endpointsMu.Unlock()
+	return pool
+}
+
+// endpointName 节点地址去掉路径、参数和用户信息
+func endpointName(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "节点"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Len 节点数
+func (p *EndpointPool) Len() int {
+	return len(p.endpoints)
+}
+
+// ranked 按评分排序的可用节点；没有健康节点时只返回最早结束冷却的节点，避免监听完全停止
+func (p *EndpointPool) ranked() []*rpcEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var healthy, down []*rpcEndpoint
+	for _, ep := range p.endpoints {
+		switch {
+		case ep.disabled != "":
+		case now.Before(ep.downUntil):
+			down = append(down, ep)
+		default:
+			healthy = append(healthy, ep)
+		}
+	}
+	if len(healthy) == 0 {
+		if len(down) == 0 {
+			return nil
+		}
+		sort.SliceStable(down, func(i, j int) bool { return down[i].downUntil.Before(down[j].downUntil) })
+		return down[:1]
+	}
+	// 尚未测得耗时的节点评分为 0，优先使用以尽快测得耗时
+	score := func(ep *rpcEndpoint) time.Duration {
+		return ep.latency + time.Duration(ep.failures)*time.Second
+	}
+	sort.SliceStable(healthy, func(i, j int) bool { return score(healthy[i]) < score(healthy[j]) })
+	return healthy
+}
+
+// Do 依次在评分最好的节点上执行 fn，直到成功或返回 permanent 判定的错误（如 JSON-RPC 业务错误、记录不存在，
+// 换节点也不会有不同结果，不计入节点失败）
+func (p *EndpointPool) Do(ctx context.Context, fn func(ctx context.Context, ep *rpcEndpoint) error, permanent func(error) bool) error {
+	var lastErr error
+	for _, ep := range p.ranked() {
+		if !ep.allow() {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("节点 %s 已用完每分钟 %d 次的请求预算", ep.name, ep.budget)
+			}
+			continue
+		}
+		start := time.Now()
+		err := fn(ctx, ep)
+		if err == nil || (permanent != nil && permanent(err)) {
+			p.succeed(ep, time.Since(start))
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		// 返回去掉节点地址的错误，调用方会记录日志
+		lastErr = errors.New(p.fail(ep, err))
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s 没有可用的节点", networkNames[p.network])
+	}
+	return lastErr
+}
+
+func (p *EndpointPool) succeed(ep *rpcEndpoint, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep.requests++
+	if ep.latency == 0 {
+		ep.latency = elapsed
+	} else {
+		ep.latency = (ep.latency*4 + elapsed) / 5
+	}
+	if !ep.downUntil.IsZero() {
+		log.Printf("%s 节点 %s 已恢复", networkNames[p.network], ep.name)
+	}
+	ep.failures = 0
+	ep.downUntil = time.Time{}
+}
+
+// fail 记录一次失败，返回去掉节点地址的错误信息
+func (p *EndpointPool) fail(ep *rpcEndpoint, err error) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep.requests++
+	ep.errors++
+	ep.failures++
+	// 请求错误带有完整的节点地址
+	ep.lastError = strings.ReplaceAll(err.Error(), ep.URL, ep.name)
+	if ep.failures < p.threshold {
+		return ep.lastError
+	}
+	cooldown := min(p.cooldown<<min(ep.failures-p.threshold, 5), 10*time.Minute)
+	ep.downUntil = time.Now().Add(cooldown)
+	// 冷却期间健康检查仍失败时延长冷却，只在首次进入冷却时记录日志
+	if ep.failures == p.threshold {
+		log.Printf("%s 节点 %s 连续失败 %d 次，%s 内不再使用: %s", networkNames[p.network], ep.name, ep.failures, cooldown, ep.lastError)
+	}
+	return ep.lastError
+}
+
+// disable 停用配置错误的节点
+func (p *EndpointPool) disable(ep *rpcEndpoint, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep.disabled = reason
+	log.Printf("【警告】%s 节点 %s 已停用: %s", networkNames[p.network], ep.name, reason)
+}
+
+func (p *EndpointPool) isVerified(ep *rpcEndpoint) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ep.verified
+}
+
+func (p *EndpointPool) markVerified(ep *rpcEndpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep.verified = true
+}
+
+// RunHealthChecks 定时探测全部未停用的节点，冷却中的节点探测成功即恢复，备用节点也能保持最新的耗时评分。
+// 探测同样消耗请求预算，预算用完的节点本轮跳过
+func (p *EndpointPool) RunHealthChecks(ctx context.Context, probe func(ctx context.Context, ep *rpcEndpoint) error) {
+	ticker := time.NewTicker(envDuration("RPC_HEALTH_INTERVAL", 30*time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, ep := range p.endpoints {
+			p.mu.Lock()
+			disabled := ep.disabled != ""
+			p.mu.Unlock()
+			if disabled || !ep.allow() {
+				continue
+			}
+			start := time.Now()
+			if err := probe(ctx, ep); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				p.fail(ep, err)
+			} else {
+				p.succeed(ep, time.Since(start))
+			}
+		}
+	}
+}
+
+// Snapshot 节点健康状态
+func (p *EndpointPool) Snapshot(now time.Time) []model.CryptoEndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]model.CryptoEndpointStatus, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		status := model.CryptoEndpointStatus{
+			Network:             p.network,
+			Endpoint:            ep.name,
+			Status:              endpointHealthy,
+			LatencyMs:           ep.latency.Milliseconds(),
+			ConsecutiveFailures: ep.failures,
+			Requests:            ep.requests,
+			Errors:              ep.errors,
+			BudgetPerMinute:     ep.budget,
+			LastError:           ep.lastError,
+		}
+		switch {
+		case ep.disabled != "":
+			status.Status = endpointDisabled
+			status.LastError = ep.disabled
+		case now.Before(ep.downUntil):
+			status.Status = endpointDown
+			downUntil := ep.downUntil
+			status.DownUntil = &downUntil
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// endpointStatuses 全部节点池的健康状态
+func (cs *CryptoService) endpointStatuses(now time.Time) []model.CryptoEndpointStatus {
+	cs.endpointsMu.Lock()
+	pools := append([]*EndpointPool(nil), cs.endpoints...)
+	cs.endpointsMu.Unlock()
+
+	var statuses []model.CryptoEndpointStatus
+	for _, pool := range pools {
+		statuses = append(statuses, pool.Snapshot(now)...)
+	}
+	return statuses
+}
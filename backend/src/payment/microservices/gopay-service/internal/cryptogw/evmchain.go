@@ -0,0 +1,109 @@
+package cryptogw
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EVMChain 一条 EVM 兼容链的监听配置。内置链的配置项以前缀区分（ETH_、BSC_、POLYGON_）：
+// <前缀>_RPC_URLS 逗号分隔的节点地址（也可用单个 <前缀>_RPC_URL），可混用 Infura、Alchemy 和自建节点，
+// 按健康评分选择并自动故障切换，<前缀>_RPC_BUDGET 限制每个节点每分钟的请求数（见 EndpointPool）；
+// <前缀>_CHAIN_ID 节点返回的链 ID 必须与之一致，避免把一条链的配置误指向另一条链的节点；
+// <前缀>_POLL_INTERVAL、<前缀>_LOG_RANGE、<前缀>_START_BLOCK 控制扫描节奏和起点。
+// 代币合约取自代币登记表（见 TokenRegistry），确认数用 CONFIRMATIONS_<网络> 覆盖
+type EVMChain struct {
+	Network      string
+	EnvPrefix    string
+	ChainID      int64
+	RPCURLs      []string
+	Tokens       map[string]string // 币种 -> 合约地址，启用时按代币登记表填入
+	Native       string            // 原生币种，未作为收款币种时为空
+	PollInterval time.Duration     // 与出块时间相当
+	LogRange     int64             // 单次 eth_getLogs 的区块数，公共节点通常限制在 1000 以内
+	StartBlock   int64             // 0 表示从尚未最终确认的区块开始
+}
+
+// builtinEVMChains 内置链的默认配置。BSC 和 Polygon 默认使用公共节点，开箱即可监听；
+// 以太坊公共节点普遍限制 eth_getLogs，需配置 ETH_RPC_URLS 后才启用
+var builtinEVMChains = []EVMChain{
+	{
+		Network:      "ERC20",
+		EnvPrefix:    "ETH",
+		ChainID:      1,
+		Native:       "ETH",
+		PollInterval: 12 * time.Second,
+		LogRange:     500,
+	},
+	{
+		Network:      "BEP20",
+		EnvPrefix:    "BSC",
+		ChainID:      56,
+		RPCURLs:      []string{"https://bsc-dataseed.bnbchain.org", "https://bsc-rpc.publicnode.com"},
+		PollInterval: 3 * time.Second,
+		LogRange:     500,
+	},
+	{
+		Network:      "POLYGON",
+		EnvPrefix:    "POLYGON",
+		ChainID:      137,
+		RPCURLs:      []string{"https://polygon-rpc.com", "https://polygon-bor-rpc.publicnode.com"},
+		PollInterval: 4 * time.Second,
+		LogRange:     500,
+	},
+}
+
+// evmChains 内置链按网络索引
+var evmChains = func() map[string]*EVMChain {
+	chains := make(map[string]*EVMChain, len(builtinEVMChains))
+	for i := range builtinEVMChains {
+		chains[builtinEVMChains[i].Network] = &builtinEVMChains[i]
+	}
+	return chains
+}()
+
+// LoadEVMChains 按环境变量覆盖内置配置，返回需要启动监听的链。
+// EVM_CHAINS 指定启用的网络（默认全部内置链），未配置节点地址的链不启用
+func LoadEVMChains() []*EVMChain {
+	var chains []*EVMChain
+	for _, network := range splitList(envString("EVM_CHAINS", "ERC20,BEP20,POLYGON")) {
+		builtin, ok := evmChains[strings.ToUpper(network)]
+		if !ok {
+			log.Printf("【警告】EVM_CHAINS 中的 %s 不是支持的 EVM 网络", network)
+			continue
+		}
+		chain := *builtin
+		prefix := chain.EnvPrefix
+
+		if urls := splitList(envString(prefix+"_RPC_URLS", os.Getenv(prefix+"_RPC_URL"))); len(urls) > 0 {
+			chain.RPCURLs = urls
+		}
+		if len(chain.RPCURLs) == 0 {
+			continue
+		}
+		if raw := os.Getenv(prefix + "_CHAIN_ID"); raw != "" {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				log.Fatalf("%s_CHAIN_ID 配置无效: %v", prefix, err)
+			}
+			chain.ChainID = id
+		}
+		chain.PollInterval = envDuration(prefix+"_POLL_INTERVAL", chain.PollInterval)
+		chain.LogRange = int64(envInt(prefix+"_LOG_RANGE", int(chain.LogRange)))
+		chain.StartBlock = int64(envInt(prefix+"_START_BLOCK", int(chain.StartBlock)))
+
+		chain.Tokens = make(map[string]string)
+		for _, asset := range assetsOnNetwork(chain.Network) {
+			if asset.Currency == chain.Native {
+				continue
+			}
+			if token, ok := tokenRegistry.Lookup(asset); ok {
+				chain.Tokens[asset.Currency] = token.Contract
+			}
+		}
+		chains = append(chains, &chain)
+	}
+	return chains
+}
@@ -0,0 +1,257 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// SendRefund 用热钱包签名交易并广播：原生币直接转账，代币调用合约的 transfer。
+// 网络费按 REFUND_FEE_LEVEL 档位出价（见 FeeEstimate），支持 EIP-1559 的链发送 type 2 交易。
+// 同一条链的退款串行发送，nonce 取节点待打包交易数与本地已分配的较大者；
+// 重发时原 nonce 尚未被使用则沿用，原交易即使之后重新广播也不会重复退款
+func (w *EVMWatcher) SendRefund(ctx context.Context, refund *CryptoRefund) (string, error) {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	hot := w.crypto.hotWallet
+	asset := Asset{Currency: refund.Currency, Network: refund.Network}
+	units, err := refund.units()
+	if err != nil {
+		return "", err
+	}
+	recipient, err := hex.DecodeString(strings.TrimPrefix(refund.ToAddress, "0x"))
+	if err != nil || len(recipient) != 20 {
+		return "", fmt.Errorf("退款地址无效: %s", refund.ToAddress)
+	}
+
+	to, value, data := recipient, units, []byte(nil)
+	if asset.Currency != w.chain.Native {
+		contract, ok := w.chain.Tokens[asset.Currency]
+		if !ok {
+			return "", fmt.Errorf("未配置 %s_CONTRACT", asset.Key())
+		}
+		balance, err := w.Balance(ctx, hot.evmAddress, asset)
+		if err != nil {
+			return "", err
+		}
+		if balance.Cmp(units) < 0 {
+			return "", fmt.Errorf("热钱包 %s 的 %s 余额 %s 不足", hot.evmAddress, asset, formatAmount(new(big.Rat).SetFrac(balance, pow10(asset.Decimals())), asset.Decimals()))
+		}
+		to, _ = hex.DecodeString(strings.TrimPrefix(contract, "0x"))
+		selector, _ := hex.DecodeString(trc20Transfer)
+		data = append(append(selector, leftPad32(recipient)...), leftPad32(units.Bytes())...)
+		value = new(big.Int)
+	}
+
+	price, err := w.gasPrice(ctx, envString("REFUND_FEE_LEVEL", FeeStandard))
+	if err != nil {
+		return "", err
+	}
+	var gasHex, balanceHex string
+	call := map[string]string{
+		"from":  hot.evmAddress,
+		"to":    "0x" + hex.EncodeToString(to),
+		"value": "0x" + value.Text(16),
+		"data":  "0x" + hex.EncodeToString(data),
+	}
+	if err := w.rpc.Call(ctx, "eth_estimateGas", []interface{}{call}, &gasHex); err != nil {
+		return "", err
+	}
+	if err := w.rpc.Call(ctx, "eth_getBalance", []interface{}{hot.evmAddress, "latest"}, &balanceHex); err != nil {
+		return "", err
+	}
+	gas, err := parseHexUnits(gasHex)
+	if err != nil {
+		return "", err
+	}
+	// 预估值上浮 20%，代币合约的实际消耗可能随状态变化
+	gas.Div(gas.Mul(gas, big.NewInt(6)), big.NewInt(5))
+	// EIP-1559 交易按 maxFeePerGas 计算最高网络费，实际按区块基础费加小费扣除
+	fee := new(big.Int).Mul(gas, price.maxFee)
+	nativeBalance, err := parseHexUnits(balanceHex)
+	if err != nil {
+		return "", err
+	}
+	if nativeBalance.Cmp(new(big.Int).Add(fee, value)) < 0 {
+		return "", fmt.Errorf("热钱包 %s 的原生币余额不足以支付退款和网络费", hot.evmAddress)
+	}
+
+	nonce, err := w.hotNonce(ctx, refund.Nonce)
+	if err != nil {
+		return "", err
+	}
+	raw, txHash, err := signEVMTx(ctx, hot.evm, w.chain.ChainID, nonce, price, gas, to, value, data)
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %w", err)
+	}
+	refund.FromAddress = hot.evmAddress
+	refund.Fee = formatAmount(new(big.Rat).SetFrac(fee, pow10(18)), 18)
+
+	err = w.sendRawTransaction(ctx, raw)
+	if reason, rejected := txRejected(err); rejected {
+		// 节点明确拒绝，交易没有广播出去，nonce 留给下一笔
+		return "", fmt.Errorf("节点拒绝退款交易: %s", reason)
+	}
+	// 广播成功或结果不确定（如请求超时）时都占用该 nonce，重发时沿用
+	refund.Nonce, refund.TxHash = &nonce, txHash
+	w.useNonce(nonce)
+	return txHash, err
+}
+
+// hotNonce 热钱包交易的 nonce。交易此前分配过 nonce（previous）且尚未被链上交易使用时沿用；
+// 已被使用说明原交易以外的交易占用了它（原交易已核实不在链上），重新分配
+func (w *EVMWatcher) hotNonce(ctx context.Context, previous *uint64) (uint64, error) {
+	var latestHex, pendingHex string
+	if err := w.rpc.Call(ctx, "eth_getTransactionCount", []interface{}{w.crypto.hotWallet.evmAddress, "latest"}, &latestHex); err != nil {
+		return 0, err
+	}
+	latest, err := parseHexInt(latestHex)
+	if err != nil {
+		return 0, err
+	}
+	if previous != nil && *previous >= uint64(latest) {
+		return *previous, nil
+	}
+	if err := w.rpc.Call(ctx, "eth_getTransactionCount", []interface{}{w.crypto.hotWallet.evmAddress, "pending"}, &pendingHex); err != nil {
+		return 0, err
+	}
+	pending, err := parseHexInt(pendingHex)
+	if err != nil {
+		return 0, err
+	}
+	// 刚广播的交易可能还没同步到其他节点的交易池，以本地分配的为准
+	return max(uint64(pending), w.nextNonce), nil
+}
+
+// useNonce 记录热钱包已占用的 nonce
+func (w *EVMWatcher) useNonce(nonce uint64) {
+	if nonce >= w.nextNonce {
+		w.nextNonce = nonce + 1
+	}
+}
+
+func (w *EVMWatcher) sendRawTransaction(ctx context.Context, raw []byte) error {
+	var sent string
+	return w.rpc.Call(ctx, "eth_sendRawTransaction", []interface{}{"0x" + hex.EncodeToString(raw)}, &sent)
+}
+
+// txRejected 节点是否明确拒绝了交易。交易已在节点交易池中（already known）视为广播成功
+func txRejected(err error) (string, bool) {
+	var rpcErr *jsonRPCError
+	if errors.As(err, &rpcErr) && !strings.Contains(strings.ToLower(rpcErr.Message), "already known") {
+		return rpcErr.Message, true
+	}
+	return "", false
+}
+
+// gasPrice 档位的网络费出价
+func (w *EVMWatcher) gasPrice(ctx context.Context, level string) (evmGasPrice, error) {
+	estimate, err := w.crypto.feeEstimate(ctx, w.chain.Network)
+	if err != nil {
+		return evmGasPrice{}, err
+	}
+	return estimate.EVM.price(level), nil
+}
+
+// signEVMTx 按出价签名 EIP-1559 或传统交易，返回原始交易和交易哈希
+func signEVMTx(ctx context.Context, signer Signer, chainID int64, nonce uint64, price evmGasPrice, gas *big.Int, to []byte, value *big.Int, data []byte) ([]byte, string, error) {
+	if price.priority == nil {
+		return signLegacyTx(ctx, signer, chainID, nonce, price.maxFee, gas, to, value, data)
+	}
+	return signDynamicFeeTx(ctx, signer, chainID, nonce, price.priority, price.maxFee, gas, to, value, data)
+}
+
+// signDynamicFeeTx 签名 EIP-1559（type 2）交易：0x02 || rlp([chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gas, to, value, data, accessList, yParity, r, s])
+func signDynamicFeeTx(ctx context.Context, signer Signer, chainID int64, nonce uint64, priority, maxFee, gas *big.Int, to []byte, value *big.Int, data []byte) ([]byte, string, error) {
+	fields := [][]byte{
+		rlpUint(big.NewInt(chainID)),
+		rlpUint(new(big.Int).SetUint64(nonce)),
+		rlpUint(priority),
+		rlpUint(maxFee),
+		rlpUint(gas),
+		rlpBytes(to),
+		rlpUint(value),
+		rlpBytes(data),
+		rlpList(), // accessList
+	}
+	unsigned := append([]byte{0x02}, rlpList(fields...)...)
+
+	r, s, recovery, err := signEthereum(ctx, signer, keccak256(unsigned))
+	if err != nil {
+		return nil, "", err
+	}
+	signed := rlpList(append(fields, rlpUint(big.NewInt(int64(recovery))), rlpBytes(bytes.TrimLeft(r, "\x00")), rlpBytes(bytes.TrimLeft(s, "\x00")))...)
+	raw := append([]byte{0x02}, signed...)
+	return raw, "0x" + hex.EncodeToString(keccak256(raw)), nil
+}
+
+// signLegacyTx 按 EIP-155 签名传统交易，返回原始交易和交易哈希
+func signLegacyTx(ctx context.Context, signer Signer, chainID int64, nonce uint64, gasPrice, gas *big.Int, to []byte, value *big.Int, data []byte) ([]byte, string, error) {
+	fields := [][]byte{
+		rlpUint(new(big.Int).SetUint64(nonce)),
+		rlpUint(gasPrice),
+		rlpUint(gas),
+		rlpBytes(to),
+		rlpUint(value),
+		rlpBytes(data),
+	}
+	id := big.NewInt(chainID)
+	unsigned := rlpList(append(fields, rlpUint(id), rlpUint(new(big.Int)), rlpUint(new(big.Int)))...)
+
+	r, s, recovery, err := signEthereum(ctx, signer, keccak256(unsigned))
+	if err != nil {
+		return nil, "", err
+	}
+	v := new(big.Int).Add(new(big.Int).Mul(id, big.NewInt(2)), big.NewInt(int64(recovery)+35))
+	raw := rlpList(append(fields, rlpUint(v), rlpBytes(bytes.TrimLeft(r, "\x00")), rlpBytes(bytes.TrimLeft(s, "\x00")))...)
+	return raw, "0x" + hex.EncodeToString(keccak256(raw)), nil
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// leftPad32 ABI 编码的 32 字节参数
+func leftPad32(b []byte) []byte {
+	padded := make([]byte, 32)
+	copy(padded[32-len(b):], b)
+	return padded
+}
+
+// rlpUint 整数按去掉前导零的大端字节编码，0 编码为空字节串
+func rlpUint(n *big.Int) []byte {
+	return rlpBytes(n.Bytes())
+}
+
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	return append(rlpLength(len(b), 0x80), b...)
+}
+
+func rlpList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpLength(len(payload), 0xc0), payload...)
+}
+
+// rlpLength 长度前缀，55 字节以内为 offset+长度，否则为 offset+55+长度字节数，后跟长度
+func rlpLength(n int, offset byte) []byte {
+	if n <= 55 {
+		return []byte{offset + byte(n)}
+	}
+	length := big.NewInt(int64(n)).Bytes()
+	return append([]byte{offset + 55 + byte(len(length))}, length...)
+}
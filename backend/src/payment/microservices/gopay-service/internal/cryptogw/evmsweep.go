@@ -0,0 +1,205 @@
+package cryptogw
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PlanSweeps 每个收款地址一笔归集：先归集达到门槛的代币，没有待归集的代币时才归集原生币，
+// 避免原生币转出后代币转账付不起网络费
+func (w *EVMWatcher) PlanSweeps(ctx context.Context, addresses []*PooledAddress, toAddress string) ([]*SweepRecord, error) {
+	currencies := make([]string, 0, len(w.chain.Tokens))
+	for currency := range w.chain.Tokens {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	if w.native != "" {
+		currencies = append(currencies, w.native)
+	}
+
+	var sweeps []*SweepRecord
+	var errs []error
+	for _, addr := range addresses {
+		for _, currency := range currencies {
+			asset := Asset{Currency: currency, Network: w.chain.Network}
+			balance, err := w.Balance(ctx, addr.Address, asset)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", addr.Address, asset, err))
+				break
+			}
+			if balance.Cmp(sweepMinimum(asset)) < 0 {
+				continue
+			}
+			sweep := newSweep(asset, toAddress, balance, SweepSource{Address: addr.Address, Index: addr.Index, Path: addr.Path})
+			sweep.Sources[0].Amount = sweep.Amount
+			sweeps = append(sweeps, sweep)
+			break
+		}
+	}
+	return sweeps, errors.Join(errs...)
+}
+
+// SendSweep 用收款地址的私钥签名归集交易，网络费按 SWEEP_FEE_LEVEL 档位出价。原生币转出余额减去最高网络费后的全部数量；
+// 代币转出当前全部余额，收款地址的原生币不足以支付网络费时先由热钱包补充预估网络费的 1.2 倍，
+// 补充交易上链后下一轮再转出。补充交易与退款共用热钱包的 nonce 分配，同样串行发送
+func (w *EVMWatcher) SendSweep(ctx context.Context, sweep *SweepRecord, keys *hdKeystore) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	source := &sweep.Sources[0]
+	signer, err := keys.signer(source.Index)
+	if err != nil {
+		return err
+	}
+	if from := checksumAddress(keccakAddress(signer.PublicKey().SerializeUncompressed())); !strings.EqualFold(from, source.Address) {
+		return fmt.Errorf("序号 %d 派生的地址 %s 与收款地址 %s 不一致", source.Index, from, source.Address)
+	}
+	recipient, err := hex.DecodeString(strings.TrimPrefix(sweep.ToAddress, "0x"))
+	if err != nil || len(recipient) != 20 {
+		return fmt.Errorf("归集地址无效: %s", sweep.ToAddress)
+	}
+
+	price, err := w.gasPrice(ctx, envString("SWEEP_FEE_LEVEL", FeeSlow))
+	if err != nil {
+		return err
+	}
+	asset := Asset{Currency: sweep.Currency, Network: sweep.Network}
+	balance, err := w.Balance(ctx, source.Address, asset)
+	if err != nil {
+		return err
+	}
+
+	to, value, data, gas := recipient, new(big.Int), []byte(nil), big.NewInt(21000)
+	if asset.Currency == w.chain.Native {
+		fee := new(big.Int).Mul(gas, price.maxFee)
+		limit := new(big.Rat).Mul(new(big.Rat).SetInt(balance), new(big.Rat).SetFloat64(envFloat("SWEEP_MAX_FEE_RATIO", 0.05)))
+		if new(big.Rat).SetInt(fee).Cmp(limit) > 0 {
+			return fmt.Errorf("%w: 网络费 %s %s 超过余额的上限比例", errSweepDeferred, formatAmount(new(big.Rat).SetFrac(fee, pow10(18)), 18), sweep.FeeCurrency)
+		}
+		value.Sub(balance, fee)
+	} else {
+		contract, ok := w.chain.Tokens[asset.Currency]
+		if !ok {
+			return fmt.Errorf("未配置 %s_CONTRACT", asset.Key())
+		}
+		if balance.Sign() == 0 {
+			return fmt.Errorf("收款地址 %s 的 %s 余额为 0", source.Address, asset)
+		}
+		to, _ = hex.DecodeString(strings.TrimPrefix(contract, "0x"))
+		selector, _ := hex.DecodeString(trc20Transfer)
+		data = append(append(selector, leftPad32(recipient)...), leftPad32(balance.Bytes())...)
+
+		var gasHex string
+		call := map[string]string{
+			"from": source.Address,
+			"to":   contract,
+			"data": "0x" + hex.EncodeToString(data),
+		}
+		if err := w.rpc.Call(ctx, "eth_estimateGas", []interface{}{call}, &gasHex); err != nil {
+			return err
+		}
+		if gas, err = parseHexUnits(gasHex); err != nil {
+			return err
+		}
+		gas.Div(gas.Mul(gas, big.NewInt(6)), big.NewInt(5))
+	}
+	fee := new(big.Int).Mul(gas, price.maxFee)
+
+	nativeBalance := balance
+	if asset.Currency != w.chain.Native {
+		if nativeBalance, err = w.Balance(ctx, source.Address, Asset{Currency: w.chain.Native, Network: w.chain.Network}); err != nil {
+			return err
+		}
+	}
+	if nativeBalance.Cmp(new(big.Int).Add(fee, value)) < 0 {
+		return w.fundSweep(ctx, sweep, new(big.Int).Sub(new(big.Int).Div(new(big.Int).Mul(fee, big.NewInt(6)), big.NewInt(5)), nativeBalance))
+	}
+
+	var nonceHex string
+	if err := w.rpc.Call(ctx, "eth_getTransactionCount", []interface{}{source.Address, "pending"}, &nonceHex); err != nil {
+		return err
+	}
+	nonce, err := parseHexInt(nonceHex)
+	if err != nil {
+		return err
+	}
+	raw, txHash, err := signEVMTx(ctx, signer, w.chain.ChainID, uint64(nonce), price, gas, to, value, data)
+	if err != nil {
+		return fmt.Errorf("签名失败: %w", err)
+	}
+	if asset.Currency == w.chain.Native {
+		sweep.setUnits(value)
+	} else {
+		sweep.setUnits(balance)
+	}
+	source.Amount = sweep.Amount
+	sweep.Fee = formatAmount(new(big.Rat).SetFrac(fee, pow10(18)), 18)
+
+	err = w.sendRawTransaction(ctx, raw)
+	if reason, rejected := txRejected(err); rejected {
+		return fmt.Errorf("节点拒绝归集交易: %s", reason)
+	}
+	sweep.TxHash, sweep.Status = txHash, SweepBroadcast
+	return err
+}
+
+// fundSweep 从热钱包向收款地址补充原生币。已补充过的归集在补充交易上链前等待，
+// 补充交易执行失败或长时间不在链上时沿用原 nonce 重新补充
+func (w *EVMWatcher) fundSweep(ctx context.Context, sweep *SweepRecord, amount *big.Int) error {
+	if sweep.Status == SweepFunding {
+		tx, err := w.FetchTx(ctx, sweep.FundingTxHash)
+		if err != nil {
+			return err
+		}
+		if confirmed, retry := fundingStatus(sweep, tx, time.Now()); !confirmed && !retry {
+			return nil
+		}
+		// 补充已上链但网络费上涨，按当前网络费再补充差额
+	}
+
+	hot := w.crypto.hotWallet
+	if hot.evm == nil {
+		return fmt.Errorf("收款地址 %s 的 %s 不足以支付网络费，未配置 REFUND_SIGNER_EVM 无法补充", sweep.Sources[0].Address, w.chain.Native)
+	}
+	recipient, _ := hex.DecodeString(strings.TrimPrefix(sweep.Sources[0].Address, "0x"))
+	price, err := w.gasPrice(ctx, envString("SWEEP_FEE_LEVEL", FeeSlow))
+	if err != nil {
+		return err
+	}
+	var balanceHex string
+	if err := w.rpc.Call(ctx, "eth_getBalance", []interface{}{hot.evmAddress, "latest"}, &balanceHex); err != nil {
+		return err
+	}
+	hotBalance, err := parseHexUnits(balanceHex)
+	if err != nil {
+		return err
+	}
+	gas := big.NewInt(21000)
+	if hotBalance.Cmp(new(big.Int).Add(amount, new(big.Int).Mul(gas, price.maxFee))) < 0 {
+		return fmt.Errorf("热钱包 %s 的原生币余额不足以补充归集网络费", hot.evmAddress)
+	}
+
+	nonce, err := w.hotNonce(ctx, sweep.FundingNonce)
+	if err != nil {
+		return err
+	}
+	raw, txHash, err := signEVMTx(ctx, hot.evm, w.chain.ChainID, nonce, price, gas, recipient, amount, nil)
+	if err != nil {
+		return fmt.Errorf("签名失败: %w", err)
+	}
+	err = w.sendRawTransaction(ctx, raw)
+	if reason, rejected := txRejected(err); rejected {
+		return fmt.Errorf("节点拒绝补充网络费交易: %s", reason)
+	}
+	sweep.FundingNonce, sweep.FundingTxHash = &nonce, txHash
+	sweep.FundingAmount = formatAmount(new(big.Rat).SetFrac(amount, pow10(18)), 18)
+	sweep.Status, sweep.MissingSince = SweepFunding, time.Time{}
+	w.useNonce(nonce)
+	return err
+}
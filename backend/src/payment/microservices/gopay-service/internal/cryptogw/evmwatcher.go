@@ -0,0 +1,595 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// erc20TransferTopic keccak256("Transfer(address,address,uint256)")
+const erc20TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// erc20BalanceOf balanceOf(address) 的函数选择器
+const erc20BalanceOf = "70a08231"
+
+// erc20Decimals decimals() 的函数选择器
+const erc20Decimals = "313ce567"
+
+// evmAddressBatch 单次 eth_getLogs 过滤的收款地址数，地址过多时部分节点会拒绝请求
+const evmAddressBatch = 100
+
+// EVMWatcher 通过 JSON-RPC 轮询一条 EVM 兼容链（配置见 EVMChain），
+// 按收款地址过滤 ERC20 Transfer 日志及原生币转账，交给入账归属，并随新区块推进确认数。
+// 扫描到链头为止，未达确认数的入账在确认前会核实交易仍在主链上
+type EVMWatcher struct {
+	crypto *CryptoService
+	hub    *CheckoutHub
+	chain  *EVMChain
+	rpc    *jsonRPCClient
+	tokens map[string]Asset // 小写合约地址 -> 币种
+	native string
+
+	next     int64 // 下一个待扫描的区块
+	failures int   // 连续失败次数，用于退避
+
+	// 退款交易串行发送，nextNonce 为本地已分配的下一个 nonce
+	sendMu    sync.Mutex
+	nextNonce uint64
+}
+
+func NewEVMWatcher(crypto *CryptoService, hub *CheckoutHub, chain *EVMChain) *EVMWatcher {
+	w := &EVMWatcher{
+		crypto: crypto,
+		hub:    hub,
+		chain:  chain,
+		rpc:    newJSONRPCClient(crypto.newEndpointPool(chain.Network, chain.EnvPrefix, chain.RPCURLs), chain.ChainID),
+		tokens: make(map[string]Asset),
+		next:   chain.StartBlock,
+	}
+	for currency, contract := range chain.Tokens {
+		w.tokens[strings.ToLower(contract)] = Asset{Currency: currency, Network: chain.Network}
+	}
+	for _, asset := range assetsOnNetwork(chain.Network) {
+		if asset.Currency == chain.Native {
+			w.native = asset.Currency
+		}
+	}
+	crypto.registerChain(chain.Network, w)
+	crypto.registerSweepSender(chain.Network, w)
+	if crypto.hotWallet.evm != nil {
+		crypto.registerSender(chain.Network, w)
+	}
+	return w
+}
+
+func (w *EVMWatcher) Run(ctx context.Context) {
+	name := networkNames[w.chain.Network]
+	log.Printf("%s 链上监听已启动，链 ID %d，%d 个节点，轮询间隔 %s", name, w.chain.ChainID, len(w.chain.RPCURLs), w.chain.PollInterval)
+	go w.rpc.pool.RunHealthChecks(ctx, w.rpc.Probe("eth_blockNumber"))
+	w.verifyTokens(ctx)
+
+	for {
+		wait := w.chain.PollInterval
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			// 节点持续不可用时按指数退避，最长一分钟，避免刷屏和触发公共节点限流
+			w.failures++
+			wait = min(w.chain.PollInterval<<min(w.failures, 6), time.Minute)
+			log.Printf("%s 链上监听失败（连续 %d 次，%s 后重试）: %v", name, w.failures, wait, err)
+		} else {
+			w.failures = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// poll 扫描上次之后的新区块，再按链头推进确认数
+func (w *EVMWatcher) poll(ctx context.Context) error {
+	var headHex string
+	if err := w.rpc.Call(ctx, "eth_blockNumber", nil, &headHex); err != nil {
+		return err
+	}
+	head, err := parseHexInt(headHex)
+	if err != nil {
+		return err
+	}
+	if w.next <= 0 {
+		// 未指定起始区块时从尚未最终确认的区块开始，覆盖重启期间可能漏掉的入账
+		w.next = max(head-int64(requiredConfirmations(w.chain.Network))+1, 1)
+	}
+
+	for w.next <= head {
+		to := min(head, w.next+w.chain.LogRange-1)
+		if err := w.scan(ctx, w.next, to); err != nil {
+			return err
+		}
+		w.next = to + 1
+	}
+
+	header, err := w.block(ctx, head, false)
+	if err != nil {
+		return err
+	}
+	blockTime := time.Unix(header.timestamp(), 0)
+	w.crypto.scanners.Observe(w.chain.Network, head, &blockTime)
+
+	changed, err := w.crypto.AdvanceConfirmations(ctx, w.chain.Network, head, w)
+	if err != nil {
+		return err
+	}
+	publishConfirmations(w.hub, changed)
+	return nil
+}
+
+// scan 扫描 [from, to] 区块范围内转入收款地址的代币和原生币
+func (w *EVMWatcher) scan(ctx context.Context, from, to int64) error {
+	watched, err := w.crypto.watchedAddresses(w.chain.Network)
+	if err != nil {
+		return err
+	}
+
+	blockTimes := make(map[int64]time.Time)
+	var contracts []string
+	tokenAddresses := make(map[string]bool)
+	for contract, asset := range w.tokens {
+		if len(watched[asset.Currency]) == 0 {
+			continue
+		}
+		contracts = append(contracts, contract)
+		for address := range watched[asset.Currency] {
+			tokenAddresses[address] = true
+		}
+	}
+	if len(contracts) > 0 {
+		topics := make([]string, 0, len(tokenAddresses))
+		for address := range tokenAddresses {
+			topics = append(topics, "0x"+strings.Repeat("0", 24)+strings.TrimPrefix(address, "0x"))
+		}
+		for start := 0; start < len(topics); start += evmAddressBatch {
+			batch := topics[start:min(start+evmAddressBatch, len(topics))]
+			if err := w.scanTokenLogs(ctx, from, to, contracts, batch, watched, blockTimes); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.native != "" && len(watched[w.native]) > 0 {
+		for height := from; height <= to; height++ {
+			if err := w.scanNativeBlock(ctx, height, watched[w.native]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type evmLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	BlockHash       string   `json:"blockHash"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	Removed         bool     `json:"removed"`
+}
+
+func (w *EVMWatcher) scanTokenLogs(ctx context.Context, from, to int64, contracts, toTopics []string,
+	watched map[string]map[string]bool, blockTimes map[int64]time.Time) error {
+	filter := map[string]interface{}{
+		"fromBlock": hexInt(from),
+		"toBlock":   hexInt(to),
+		"address":   contracts,
+		"topics":    []interface{}{erc20TransferTopic, nil, toTopics},
+	}
+	var logs []evmLog
+	if err := w.rpc.Call(ctx, "eth_getLogs", []interface{}{filter}, &logs); err != nil {
+		return err
+	}
+
+	for _, entry := range logs {
+		asset, ok := w.tokens[strings.ToLower(entry.Address)]
+		if !ok || entry.Removed || len(entry.Topics) != 3 || len(entry.Topics[1]) < 40 || len(entry.Topics[2]) < 40 {
+			continue
+		}
+		to := "0x" + strings.ToLower(entry.Topics[2][len(entry.Topics[2])-40:])
+		if !watched[asset.Currency][to] {
+			continue
+		}
+		units, ok := new(big.Int).SetString(strings.TrimPrefix(entry.Data, "0x"), 16)
+		if !ok || units.Sign() <= 0 {
+			continue
+		}
+		height, err := parseHexInt(entry.BlockNumber)
+		if err != nil {
+			return err
+		}
+		blockTime, ok := blockTimes[height]
+		if !ok {
+			header, err := w.block(ctx, height, false)
+			if err != nil {
+				return err
+			}
+			blockTime = time.Unix(header.timestamp(), 0)
+			blockTimes[height] = blockTime
+		}
+
+		w.crypto.deliverTransfer(w.hub, &InboundTransfer{
+			TxHash:      entry.TransactionHash,
+			Address:     to,
+			Currency:    asset.Currency,
+			Network:     w.chain.Network,
+			Amount:      unitsToAmount(units, asset.Decimals()),
+			BlockHeight: height,
+			BlockHash:   entry.BlockHash,
+			BlockTime:   &blockTime,
+			Senders:     []string{"0x" + strings.ToLower(entry.Topics[1][len(entry.Topics[1])-40:])},
+		})
+	}
+	return nil
+}
+
+type evmTransaction struct {
+	Hash  string `json:"hash"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+	Input string `json:"input"`
+}
+
+type evmBlock struct {
+	Number       string           `json:"number"`
+	Hash         string           `json:"hash"`
+	Timestamp    string           `json:"timestamp"`
+	Transactions []evmTransaction `json:"transactions"`
+}
+
+func (b *evmBlock) timestamp() int64 {
+	ts, _ := parseHexInt(b.Timestamp)
+	return ts
+}
+
+func (w *EVMWatcher) block(ctx context.Context, height int64, fullTx bool) (*evmBlock, error) {
+	var block *evmBlock
+	if err := w.rpc.Call(ctx, "eth_getBlockByNumber", []interface{}{hexInt(height), fullTx}, &block); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("区块 %d 不存在", height)
+	}
+	return block, nil
+}
+
+// scanNativeBlock 原生币转账没有事件日志，需要逐个区块检查交易的接收地址。
+// 合约内部转账（如从交易所热钱包合约提币）不会出现在区块交易中，需人工复核补录
+func (w *EVMWatcher) scanNativeBlock(ctx context.Context, height int64, addresses map[string]bool) error {
+	block, err := w.block(ctx, height, true)
+	if err != nil {
+		return err
+	}
+	blockTime := time.Unix(block.timestamp(), 0)
+
+	for _, tx := range block.Transactions {
+		to := strings.ToLower(tx.To)
+		if to == "" || !addresses[to] {
+			continue
+		}
+		value, ok := new(big.Int).SetString(strings.TrimPrefix(tx.Value, "0x"), 16)
+		if !ok || value.Sign() <= 0 {
+			continue
+		}
+		// 执行失败的交易同样打包在区块中，但转账金额不会到账
+		receipt, err := w.receipt(ctx, tx.Hash)
+		if err != nil {
+			return err
+		}
+		if receipt == nil || receipt.Status != "0x1" {
+			continue
+		}
+
+		asset := Asset{Currency: w.native, Network: w.chain.Network}
+		w.crypto.deliverTransfer(w.hub, &InboundTransfer{
+			TxHash:      tx.Hash,
+			Address:     to,
+			Currency:    asset.Currency,
+			Network:     w.chain.Network,
+			Amount:      unitsToAmount(value, asset.Decimals()),
+			BlockHeight: height,
+			BlockHash:   block.Hash,
+			BlockTime:   &blockTime,
+			Senders:     []string{strings.ToLower(tx.From)},
+		})
+	}
+	return nil
+}
+
+type evmReceipt struct {
+	BlockNumber string   `json:"blockNumber"`
+	BlockHash   string   `json:"blockHash"`
+	Status      string   `json:"status"`
+	Logs        []evmLog `json:"logs"`
+}
+
+func (w *EVMWatcher) receipt(ctx context.Context, txHash string) (*evmReceipt, error) {
+	var receipt *evmReceipt
+	if err := w.rpc.Call(ctx, "eth_getTransactionReceipt", []interface{}{txHash}, &receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// LocateTx 交易被链重组移出主链后节点查不到回执，重新打包后回执指向新的区块
+func (w *EVMWatcher) LocateTx(ctx context.Context, txHash string) (TxLocation, bool, error) {
+	receipt, err := w.receipt(ctx, txHash)
+	if err != nil || receipt == nil || receipt.BlockNumber == "" {
+		return TxLocation{}, false, err
+	}
+	height, err := parseHexInt(receipt.BlockNumber)
+	if err != nil {
+		return TxLocation{}, false, err
+	}
+	return TxLocation{Height: height, BlockHash: receipt.BlockHash}, true, nil
+}
+
+// FetchTx 按哈希查询交易。已打包的交易按回执中的 Transfer 日志列出代币转账（含合约内部转账），
+// 尚未打包的交易只能按调用数据解析直接调用代币合约的 transfer/transferFrom
+func (w *EVMWatcher) FetchTx(ctx context.Context, txHash string) (*ChainTx, error) {
+	var tx *evmTransaction
+	if err := w.rpc.Call(ctx, "eth_getTransactionByHash", []interface{}{txHash}, &tx); err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, nil
+	}
+	var headHex string
+	if err := w.rpc.Call(ctx, "eth_blockNumber", nil, &headHex); err != nil {
+		return nil, err
+	}
+	head, err := parseHexInt(headHex)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: tx.Hash, Head: head}
+	to := strings.ToLower(tx.To)
+	if value, ok := new(big.Int).SetString(strings.TrimPrefix(tx.Value, "0x"), 16); ok && value.Sign() > 0 && to != "" {
+		result.Transfers = append(result.Transfers, ChainTransfer{To: to, Currency: w.chain.Native, Units: value})
+	}
+
+	receipt, err := w.receipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt == nil || receipt.BlockNumber == "" {
+		if recipient, units, ok := decodeTransferCall(tx.Input); ok {
+			result.Transfers = append(result.Transfers, ChainTransfer{
+				To:       "0x" + recipient,
+				Currency: w.tokens[to].Currency,
+				Contract: to,
+				Units:    units,
+			})
+		}
+		return result, nil
+	}
+
+	if result.BlockHeight, err = parseHexInt(receipt.BlockNumber); err != nil {
+		return nil, err
+	}
+	result.BlockHash = receipt.BlockHash
+	result.Failed = receipt.Status != "0x1"
+	for _, entry := range receipt.Logs {
+		if len(entry.Topics) != 3 || !strings.EqualFold(entry.Topics[0], erc20TransferTopic) || len(entry.Topics[2]) < 40 {
+			continue
+		}
+		units, ok := new(big.Int).SetString(strings.TrimPrefix(entry.Data, "0x"), 16)
+		if !ok || units.Sign() <= 0 {
+			continue
+		}
+		contract := strings.ToLower(entry.Address)
+		result.Transfers = append(result.Transfers, ChainTransfer{
+			To:       "0x" + strings.ToLower(entry.Topics[2][len(entry.Topics[2])-40:]),
+			Currency: w.tokens[contract].Currency,
+			Contract: contract,
+			Units:    units,
+		})
+	}
+	return result, nil
+}
+
+// Balance 原生币查询账户余额，代币调用合约的 balanceOf，均按最新区块
+func (w *EVMWatcher) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	var raw string
+	if asset.Currency == w.chain.Native {
+		if err := w.rpc.Call(ctx, "eth_getBalance", []interface{}{address, "latest"}, &raw); err != nil {
+			return nil, err
+		}
+		return parseHexUnits(raw)
+	}
+
+	contract, ok := w.chain.Tokens[asset.Currency]
+	if !ok {
+		return nil, fmt.Errorf("未配置 %s_CONTRACT", asset.Key())
+	}
+	call := map[string]string{
+		"to":   contract,
+		"data": "0x" + erc20BalanceOf + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(address, "0x")),
+	}
+	if err := w.rpc.Call(ctx, "eth_call", []interface{}{call, "latest"}, &raw); err != nil {
+		return nil, err
+	}
+	return parseHexUnits(raw)
+}
+
+// verifyTokens 启动时核对登记的代币合约：合约地址上有代码，decimals() 与登记的精度一致，否则下架（见 TokenRegistry.verify）
+func (w *EVMWatcher) verifyTokens(ctx context.Context) {
+	for contract, asset := range w.tokens {
+		decimals, err := w.tokenDecimals(ctx, contract)
+		tokenRegistry.verify(asset, decimals, err)
+	}
+}
+
+func (w *EVMWatcher) tokenDecimals(ctx context.Context, contract string) (int, error) {
+	var code string
+	if err := w.rpc.Call(ctx, "eth_getCode", []interface{}{contract, "latest"}, &code); err != nil {
+		return 0, err
+	}
+	if strings.TrimPrefix(code, "0x") == "" {
+		return 0, errNotContract
+	}
+	var raw string
+	call := map[string]string{"to": contract, "data": "0x" + erc20Decimals}
+	if err := w.rpc.Call(ctx, "eth_call", []interface{}{call, "latest"}, &raw); err != nil {
+		return 0, err
+	}
+	decimals, err := parseHexUnits(raw)
+	if err != nil {
+		return 0, err
+	}
+	if !decimals.IsInt64() {
+		return 0, fmt.Errorf("decimals() 返回值无效: %s", raw)
+	}
+	return int(decimals.Int64()), nil
+}
+
+// jsonRPCClient JSON-RPC 客户端，节点选择、故障切换和请求预算由 EndpointPool 负责。
+// 以太坊节点首次使用前核对链 ID，链 ID 不一致的节点停用；chainID 为 0 时不核对（如 Solana 节点）
+type jsonRPCClient struct {
+	pool       *EndpointPool
+	chainID    int64
+	httpClient *http.Client
+	id         atomic.Int64
+}
+
+func newJSONRPCClient(pool *EndpointPool, chainID int64) *jsonRPCClient {
+	return &jsonRPCClient{
+		pool:       pool,
+		chainID:    chainID,
+		httpClient: &http.Client{Timeout: envDuration("RPC_HTTP_TIMEOUT", 10*time.Second)},
+	}
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonRPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC 错误 %d: %s", e.Code, e.Message)
+}
+
+// isJSONRPCError 节点返回的 JSON-RPC 错误说明节点可用，换节点也不会有不同结果
+func isJSONRPCError(err error) bool {
+	var rpcErr *jsonRPCError
+	return errors.As(err, &rpcErr)
+}
+
+// Call 调用 JSON-RPC 方法并把 result 解析到 result
+func (c *jsonRPCClient) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	return c.pool.Do(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		if err := c.verify(ctx, ep); err != nil {
+			return err
+		}
+		return c.call(ctx, ep.URL, method, params, result)
+	}, isJSONRPCError)
+}
+
+// Probe 健康检查，用 method 这类轻量调用探测节点
+func (c *jsonRPCClient) Probe(method string) func(ctx context.Context, ep *rpcEndpoint) error {
+	return func(ctx context.Context, ep *rpcEndpoint) error {
+		if err := c.verify(ctx, ep); err != nil {
+			return err
+		}
+		var result json.RawMessage
+		return c.call(ctx, ep.URL, method, nil, &result)
+	}
+}
+
+// verify 核对节点的链 ID
+func (c *jsonRPCClient) verify(ctx context.Context, ep *rpcEndpoint) error {
+	if c.chainID == 0 || c.pool.isVerified(ep) {
+		return nil
+	}
+
+	var idHex string
+	if err := c.call(ctx, ep.URL, "eth_chainId", nil, &idHex); err != nil {
+		return err
+	}
+	id, err := parseHexInt(idHex)
+	if err != nil {
+		return err
+	}
+	if id != c.chainID {
+		reason := fmt.Sprintf("链 ID 为 %d，与配置的 %d 不一致", id, c.chainID)
+		c.pool.disable(ep, reason)
+		return fmt.Errorf("节点 %s 的%s", ep.name, reason)
+	}
+	c.pool.markVerified(ep)
+	return nil
+}
+
+func (c *jsonRPCClient) call(ctx context.Context, url, method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.id.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s 请求失败: %w", method, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 HTTP %d: %s", method, resp.StatusCode, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Error  *jsonRPCError   `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("%s 响应解析失败: %w", method, err)
+	}
+	if envelope.Error != nil {
+		return envelope.Error
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+func hexInt(n int64) string {
+	return "0x" + strconv.FormatInt(n, 16)
+}
+
+func parseHexInt(s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimPrefix(s, "0x"), 16, 64)
+}
@@ -0,0 +1,55 @@
+package cryptogw
+
+import (
+	"net/url"
+	"strings"
+)
+
+// explorerTemplate 区块浏览器链接模板，{txHash}、{address} 替换为交易哈希和地址
+type explorerTemplate struct {
+	tx      string
+	address string
+}
+
+// defaultExplorers 各网络主网的区块浏览器，可用 EXPLORER_TX_URL_<网络>、EXPLORER_ADDRESS_URL_<网络> 覆盖，
+// 测试网或自建浏览器时配置，如 EXPLORER_TX_URL_ERC20=https://sepolia.etherscan.io/tx/{txHash}
+var defaultExplorers = map[string]explorerTemplate{
+	"BTC":     {tx: "https://mempool.space/tx/{txHash}", address: "https://mempool.space/address/{address}"},
+	"ERC20":   {tx: "https://etherscan.io/tx/{txHash}", address: "https://etherscan.io/address/{address}"},
+	"BEP20":   {tx: "https://bscscan.com/tx/{txHash}", address: "https://bscscan.com/address/{address}"},
+	"POLYGON": {tx: "https://polygonscan.com/tx/{txHash}", address: "https://polygonscan.com/address/{address}"},
+	"TRC20":   {tx: "https://tronscan.org/#/transaction/{txHash}", address: "https://tronscan.org/#/address/{address}"},
+	"SOL":     {tx: "https://solscan.io/tx/{txHash}", address: "https://solscan.io/account/{address}"},
+	"XRP":     {tx: "https://livenet.xrpl.org/transactions/{txHash}", address: "https://livenet.xrpl.org/accounts/{address}"},
+	"XLM":     {tx: "https://stellar.expert/explorer/public/tx/{txHash}", address: "https://stellar.expert/explorer/public/account/{address}"},
+	"TON":     {tx: "https://tonviewer.com/transaction/{txHash}", address: "https://tonviewer.com/{address}"},
+}
+
+// explorerFor 网络的链接模板。BTC_NETWORK=testnet 时比特币默认使用 mempool.space 的测试网
+func explorerFor(network string) explorerTemplate {
+	template := defaultExplorers[network]
+	if network == "BTC" && envString("BTC_NETWORK", "mainnet") == "testnet" {
+		template = explorerTemplate{tx: "https://mempool.space/testnet/tx/{txHash}", address: "https://mempool.space/testnet/address/{address}"}
+	}
+	template.tx = envString("EXPLORER_TX_URL_"+network, template.tx)
+	template.address = envString("EXPLORER_ADDRESS_URL_"+network, template.address)
+	return template
+}
+
+// explorerTxURL 交易在区块浏览器中的链接，网络未配置浏览器或交易哈希为空时为空串
+func explorerTxURL(network, txHash string) string {
+	template := explorerFor(network).tx
+	if template == "" || txHash == "" {
+		return ""
+	}
+	return strings.ReplaceAll(template, "{txHash}", url.PathEscape(txHash))
+}
+
+// explorerAddressURL 地址在区块浏览器中的链接
+func explorerAddressURL(network, address string) string {
+	template := explorerFor(network).address
+	if template == "" || address == "" {
+		return ""
+	}
+	return strings.ReplaceAll(template, "{address}", url.PathEscape(address))
+}
@@ -0,0 +1,310 @@
+package cryptogw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopay-service/internal/apierr"
+)
+
+// 网络费档位，退款默认 standard（REFUND_FEE_LEVEL），归集默认 slow（SWEEP_FEE_LEVEL）
+const (
+	FeeSlow     = "slow"
+	FeeStandard = "standard"
+	FeeFast     = "fast"
+)
+
+var feeLevels = []string{FeeSlow, FeeStandard, FeeFast}
+
+// btcFeeTargets 各档位对应的比特币确认目标（区块数）
+var btcFeeTargets = map[string]int{
+	FeeSlow:     144,
+	FeeStandard: 6,
+	FeeFast:     2,
+}
+
+// btcFeeTarget 档位的确认目标，未知档位按 standard
+func btcFeeTarget(level string) int {
+	if target, ok := btcFeeTargets[level]; ok {
+		return target
+	}
+	return btcFeeTargets[FeeStandard]
+}
+
+// evmFeePercentiles 各档位取近期区块小费的百分位
+var evmFeePercentiles = []float64{10, 50, 90}
+
+// FeeEstimate 网络当前的推荐网络费，按网络类型填写其中一项
+type FeeEstimate struct {
+	Network     string    `json:"network"`
+	FeeCurrency string    `json:"feeCurrency"`
+	EVM         *EVMFees  `json:"evm,omitempty"`
+	BTC         *BTCFees  `json:"btc,omitempty"`
+	Tron        *TronFees `json:"tron,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	Stale       bool      `json:"stale,omitempty"` // 节点查询失败，返回的是过期缓存
+}
+
+// EVMFees EVM 链的网络费，单位 gwei。支持 EIP-1559 的链按近期区块的小费分布给出各档位的 maxPriorityFeePerGas，
+// maxFeePerGas 取下一区块基础费的 2 倍加小费，可承受连续数个满块的基础费上涨；不支持的链只有 gasPrice
+type EVMFees struct {
+	BaseFee     string            `json:"baseFee,omitempty"`
+	PriorityFee map[string]string `json:"priorityFee,omitempty"`
+	MaxFee      map[string]string `json:"maxFee"`
+	GasPrice    string            `json:"gasPrice"`
+
+	baseFee  *big.Int // wei，不支持 EIP-1559 时为 nil
+	priority map[string]*big.Int
+	gasPrice *big.Int
+}
+
+// evmGasPrice 一笔交易的网络费出价：priority 不为空时发送 EIP-1559 交易，否则为 legacy 交易，maxFee 即 gasPrice
+type evmGasPrice struct {
+	maxFee   *big.Int
+	priority *big.Int
+}
+
+// price 档位的出价，未知档位按 standard
+func (f *EVMFees) price(level string) evmGasPrice {
+	if f.baseFee == nil {
+		return evmGasPrice{maxFee: f.gasPrice}
+	}
+	priority, ok := f.priority[level]
+	if !ok {
+		priority = f.priority[FeeStandard]
+	}
+	return evmGasPrice{
+		maxFee:   new(big.Int).Add(new(big.Int).Mul(f.baseFee, big.NewInt(2)), priority),
+		priority: priority,
+	}
+}
+
+// BTCFees 比特币各档位的网络费率（sat/vB）及其确认目标
+type BTCFees struct {
+	Rates   map[string]float64 `json:"rates"`
+	Targets map[string]int     `json:"targets"`
+
+	estimates map[int]float64 // /fee-estimates 的全部确认目标
+}
+
+// rate target 个区块内确认的费率。节点未给出该目标时取更长目标中最近的一个，都没有时按最低 1 sat/vB
+func (f *BTCFees) rate(target int) float64 {
+	best, rate := 0, 1.0
+	for blocks, estimate := range f.estimates {
+		if blocks >= target && (best == 0 || blocks < best) {
+			best, rate = blocks, estimate
+		}
+	}
+	return max(rate, 1)
+}
+
+// TronFees TRON 的资源单价（sun）。TRON 没有竞价，网络费由消耗的能量和带宽按链参数燃烧 TRX 计算，
+// TRC20TransferFee 按 TRON_TRC20_TRANSFER_ENERGY（默认 65000，接收方从未持有该代币时约翻倍）估算
+type TronFees struct {
+	EnergyPrice         int64  `json:"energyPrice"`
+	BandwidthPrice      int64  `json:"bandwidthPrice"`
+	TRC20TransferEnergy int64  `json:"trc20TransferEnergy"`
+	TRC20TransferFee    string `json:"trc20TransferFee"` // TRX
+}
+
+// FeeSource 链上监听器实现，从节点查询当前网络费
+type FeeSource interface {
+	FeeEstimate(ctx context.Context) (*FeeEstimate, error)
+}
+
+// feeCache 网络费缓存，结果缓存 FEE_CACHE_TTL（默认 15s），退款、归集和查询接口共用；
+// 节点查询失败时在 FEE_MAX_STALENESS（默认 5m）内继续使用上次的结果
+type feeCache struct {
+	ttl          time.Duration
+	maxStaleness time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*FeeEstimate
+}
+
+func newFeeCache() *feeCache {
+	return &feeCache{
+		ttl:          envDuration("FEE_CACHE_TTL", 15*time.Second),
+		maxStaleness: envDuration("FEE_MAX_STALENESS", 5*time.Minute),
+		entries:      make(map[string]*FeeEstimate),
+	}
+}
+
+func (c *feeCache) get(network string) *FeeEstimate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached := c.entries[network]; cached != nil {
+		copied := *cached
+		return &copied
+	}
+	return nil
+}
+
+func (c *feeCache) put(network string, estimate *FeeEstimate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *estimate
+	c.entries[network] = &copied
+}
+
+// feeEstimate 网络当前的推荐网络费，优先使用缓存
+func (cs *CryptoService) feeEstimate(ctx context.Context, network string) (*FeeEstimate, error) {
+	source, ok := cs.chainReader(network).(FeeSource)
+	if !ok {
+		return nil, fmt.Errorf("未配置 %s 节点或该网络不支持网络费估算", networkNames[network])
+	}
+	cached := cs.fees.get(network)
+	if cached != nil && time.Since(cached.FetchedAt) < cs.fees.ttl {
+		return cached, nil
+	}
+
+	estimate, err := source.FeeEstimate(ctx)
+	if err != nil {
+		if cached != nil && time.Since(cached.FetchedAt) < cs.fees.maxStaleness {
+			log.Printf("查询 %s 网络费失败，使用 %s 前的缓存: %v", networkNames[network], time.Since(cached.FetchedAt).Round(time.Second), err)
+			cached.Stale = true
+			return cached, nil
+		}
+		return nil, fmt.Errorf("查询 %s 网络费失败: %w", networkNames[network], err)
+	}
+	estimate.Network, estimate.FeeCurrency, estimate.FetchedAt = network, feeCurrencies[network], time.Now()
+	cs.fees.put(network, estimate)
+	return estimate, nil
+}
+
+// GetFees 查询网络当前的推荐网络费，network 为空时返回所有已配置节点的网络
+func (cs *CryptoService) GetFees(ctx context.Context, network string) (*apierr.Response, error) {
+	if strings.TrimSpace(network) != "" {
+		canonical, ok := networkAliases[strings.ToLower(strings.TrimSpace(network))]
+		if !ok {
+			return apierr.ErrorResponse("UNSUPPORTED_NETWORK", fmt.Sprintf("不支持的网络: %s%s", network, suggest(network, networkAliases))), nil
+		}
+		estimate, err := cs.feeEstimate(ctx, canonical)
+		if err != nil {
+			return apierr.ErrorResponse("CHAIN_UNAVAILABLE", err.Error()), nil
+		}
+		return apierr.SuccessResponse(estimate), nil
+	}
+
+	networks := make([]string, 0, len(networkNames))
+	for network := range networkNames {
+		if _, ok := cs.chainReader(network).(FeeSource); ok {
+			networks = append(networks, network)
+		}
+	}
+	sort.Strings(networks)
+	estimates := make([]*FeeEstimate, 0, len(networks))
+	for _, network := range networks {
+		estimate, err := cs.feeEstimate(ctx, network)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		estimates = append(estimates, estimate)
+	}
+	return apierr.SuccessResponse(estimates), nil
+}
+
+// FeeEstimate 按 eth_feeHistory 最近 20 个区块的小费百分位估算各档位，节点不支持或链上没有基础费时只返回 gasPrice
+func (w *EVMWatcher) FeeEstimate(ctx context.Context) (*FeeEstimate, error) {
+	var gasPriceHex string
+	if err := w.rpc.Call(ctx, "eth_gasPrice", nil, &gasPriceHex); err != nil {
+		return nil, err
+	}
+	gasPrice, err := parseHexUnits(gasPriceHex)
+	if err != nil {
+		return nil, err
+	}
+	fees := &EVMFees{gasPrice: gasPrice, GasPrice: formatGwei(gasPrice), MaxFee: make(map[string]string)}
+
+	var history struct {
+		BaseFeePerGas []string   `json:"baseFeePerGas"`
+		Reward        [][]string `json:"reward"`
+	}
+	err = w.rpc.Call(ctx, "eth_feeHistory", []interface{}{hexInt(20), "latest", evmFeePercentiles}, &history)
+	if err == nil && len(history.BaseFeePerGas) > 0 && len(history.Reward) > 0 {
+		// 最后一项为下一区块的基础费
+		baseFee, err := parseHexUnits(history.BaseFeePerGas[len(history.BaseFeePerGas)-1])
+		if err == nil && baseFee.Sign() > 0 {
+			fees.baseFee, fees.BaseFee = baseFee, formatGwei(baseFee)
+			fees.priority, fees.PriorityFee = make(map[string]*big.Int), make(map[string]string)
+			for i, level := range feeLevels {
+				priority := medianReward(history.Reward, i)
+				// 节点的 gasPrice 已含其建议的小费，近期区块没有小费数据时以此兜底
+				if priority.Sign() == 0 && gasPrice.Cmp(baseFee) > 0 {
+					priority.Sub(gasPrice, baseFee)
+				}
+				fees.priority[level], fees.PriorityFee[level] = priority, formatGwei(priority)
+			}
+		}
+	} else if err != nil && !isJSONRPCError(err) {
+		return nil, err
+	}
+	for _, level := range feeLevels {
+		fees.MaxFee[level] = formatGwei(fees.price(level).maxFee)
+	}
+	return &FeeEstimate{EVM: fees}, nil
+}
+
+// medianReward 各区块第 column 个百分位小费的中位数
+func medianReward(rewards [][]string, column int) *big.Int {
+	var values []*big.Int
+	for _, reward := range rewards {
+		if column >= len(reward) {
+			continue
+		}
+		if value, err := parseHexUnits(reward[column]); err == nil {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return new(big.Int)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	return new(big.Int).Set(values[len(values)/2])
+}
+
+func formatGwei(wei *big.Int) string {
+	return formatAmount(new(big.Rat).SetFrac(wei, pow10(9)), 9)
+}
+
+// FeeEstimate 读取 /fee-estimates，按档位的确认目标给出费率
+func (w *BTCWatcher) FeeEstimate(ctx context.Context) (*FeeEstimate, error) {
+	var raw map[string]float64
+	if err := w.get(ctx, "/fee-estimates", &raw); err != nil {
+		return nil, err
+	}
+	fees := &BTCFees{Rates: make(map[string]float64), Targets: btcFeeTargets, estimates: make(map[int]float64)}
+	for target, rate := range raw {
+		if blocks, err := strconv.Atoi(target); err == nil {
+			fees.estimates[blocks] = rate
+		}
+	}
+	for level, target := range btcFeeTargets {
+		fees.Rates[level] = fees.rate(target)
+	}
+	return &FeeEstimate{BTC: fees}, nil
+}
+
+// FeeEstimate 读取链参数中的能量和带宽单价
+func (w *TronWatcher) FeeEstimate(ctx context.Context) (*FeeEstimate, error) {
+	params, err := w.chainParameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fees := &TronFees{
+		EnergyPrice:         params["getEnergyFee"],
+		BandwidthPrice:      params["getTransactionFee"],
+		TRC20TransferEnergy: int64(envInt("TRON_TRC20_TRANSFER_ENERGY", 65000)),
+	}
+	sun := fees.TRC20TransferEnergy*fees.EnergyPrice + tronSweepBandwidth*fees.BandwidthPrice
+	fees.TRC20TransferFee = formatAmount(new(big.Rat).SetFrac64(sun, 1e6), 6)
+	return &FeeEstimate{Tron: fees}, nil
+}
@@ -0,0 +1,256 @@
+package cryptogw
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"golang.org/x/crypto/sha3"
+)
+
+// 地址派生链。各 EVM 兼容链的地址格式相同，共用一个扩展公钥和一组序号，同一地址不会同时分给两条链的账单
+const (
+	ChainBitcoin = "btc"
+	ChainEVM     = "evm"
+	ChainTron    = "tron"
+)
+
+// networkChains 网络对应的地址派生链
+var networkChains = map[string]string{
+	"BTC":     ChainBitcoin,
+	"ERC20":   ChainEVM,
+	"BEP20":   ChainEVM,
+	"POLYGON": ChainEVM,
+	"TRC20":   ChainTron,
+}
+
+// defaultAccountPaths 扩展公钥所在的账户层路径，只用于记录派生路径，实际派生从扩展公钥开始
+var defaultAccountPaths = map[string]string{
+	ChainBitcoin: "m/84'/0'/0'",
+	ChainEVM:     "m/44'/60'/0'",
+	ChainTron:    "m/44'/195'/0'",
+}
+
+// devXpub BIP32 测试向量 1 的主公钥，私钥公开，只在非生产环境显式设置 CRYPTO_ALLOW_DEV_XPUB=1 且未配置扩展公钥时使用，
+// 不可收取真实资金
+const devXpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+
+// DerivedAddress 为账单派生的收款地址
+type DerivedAddress struct {
+	Chain   string `json:"chain"`
+	Index   uint32 `json:"index"`
+	Path    string `json:"path"` // 完整派生路径，如 m/44'/60'/0'/0/12，用于在冷钱包中找回私钥
+	Address string `json:"address"`
+}
+
+// hdChain 一条链的扩展公钥及下一个可用序号
+type hdChain struct {
+	name        string
+	accountPath string
+	external    *hdkeychain.ExtendedKey // 账户下的外部链 .../0
+	next        uint32
+}
+
+// HDWallet 按 BIP32/44 从扩展公钥派生收款地址，每笔账单一个新地址，入账可按地址直接归属。
+// 服务只持有扩展公钥（HD_XPUB_BTC、HD_XPUB_EVM、HD_XPUB_TRON），私钥离线保管
+type HDWallet struct {
+	btcParams *chaincfg.Params
+
+	mu     sync.Mutex
+	chains map[string]*hdChain
+}
+
+// NewHDWallet 读取各链的扩展公钥。配置了扩展私钥或无法解析时退出进程，避免私钥进入服务或把款收到错误地址；
+// 生产环境未配置的链不能收款，非生产环境未配置时须设置 CRYPTO_ALLOW_DEV_XPUB=1 才使用测试扩展公钥，否则退出进程
+func NewHDWallet() *HDWallet {
+	w := &HDWallet{
+		btcParams: &chaincfg.MainNetParams,
+		chains:    make(map[string]*hdChain),
+	}
+	if envString("BTC_NETWORK", "mainnet") == "testnet" {
+		w.btcParams = &chaincfg.TestNet3Params
+	}
+	production := envString("APP_ENV", "development") == "production"
+	allowDevXpub := os.Getenv("CRYPTO_ALLOW_DEV_XPUB") == "1"
+	if production && allowDevXpub {
+		log.Fatalf("生产环境不能设置 CRYPTO_ALLOW_DEV_XPUB")
+	}
+
+	for chain, accountPath := range defaultAccountPaths {
+		upper := strings.ToUpper(chain)
+		xpub := os.Getenv("HD_XPUB_" + upper)
+		if xpub == "" {
+			if production {
+				log.Printf("【警告】未配置 HD_XPUB_%s，该链的币种无法收款", upper)
+				continue
+			}
+			if !allowDevXpub {
+				log.Fatalf("未配置 HD_XPUB_%s；本地开发如需使用公开的测试扩展公钥，请设置 CRYPTO_ALLOW_DEV_XPUB=1", upper)
+			}
+			log.Printf("【警告】未配置 HD_XPUB_%s，使用公开的测试扩展公钥派生地址，请勿向这些地址转入真实资金", upper)
+			xpub, accountPath = devXpub, "m"
+		}
+		hc, err := newHDChain(chain, xpub, envString("HD_PATH_"+upper, accountPath))
+		if err != nil {
+			log.Fatalf("HD_XPUB_%s 配置无效: %v", upper, err)
+		}
+		w.chains[chain] = hc
+	}
+	return w
+}
+
+func newHDChain(name, xpub, accountPath string) (*hdChain, error) {
+	key, err := hdkeychain.NewKeyFromString(strings.TrimSpace(xpub))
+	if err != nil {
+		return nil, err
+	}
+	if key.IsPrivate() {
+		return nil, fmt.Errorf("只能配置扩展公钥，不能配置扩展私钥")
+	}
+	external, err := key.Derive(0)
+	if err != nil {
+		return nil, err
+	}
+	return &hdChain{name: name, accountPath: accountPath, external: external}, nil
+}
+
+// Supports 网络是否已配置扩展公钥
+func (w *HDWallet) Supports(network string) bool {
+	_, ok := w.chains[networkChains[network]]
+	return ok
+}
+
+// Next 为网络派生下一个未使用的地址
+func (w *HDWallet) Next(network string) (*DerivedAddress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hc, ok := w.chains[networkChains[network]]
+	if !ok {
+		return nil, fmt.Errorf("网络 %s 未配置扩展公钥", network)
+	}
+	for {
+		index := hc.next
+		if index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%s 链的地址序号已用尽", hc.name)
+		}
+		hc.next++
+		derived, err := w.derive(hc, index)
+		if err != nil {
+			// 极少数序号派生出无效密钥，BIP32 规定跳过该序号
+			if err == hdkeychain.ErrInvalidChild {
+				continue
+			}
+			return nil, err
+		}
+		return derived, nil
+	}
+}
+
+// Reserve 标记序号已被使用，启动时按地址池恢复，避免重复派生同一地址
+func (w *HDWallet) Reserve(chain string, index uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hc, ok := w.chains[chain]; ok && index >= hc.next {
+		hc.next = index + 1
+	}
+}
+
+// NextIndex 链上下一个待派生的序号
+func (w *HDWallet) NextIndex(chain string) uint32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hc, ok := w.chains[chain]; ok {
+		return hc.next
+	}
+	return 0
+}
+
+func (w *HDWallet) derive(hc *hdChain, index uint32) (*DerivedAddress, error) {
+	child, err := hc.external.Derive(index)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var address string
+	switch hc.name {
+	case ChainBitcoin:
+		// BIP84 原生隔离见证地址 bc1...
+		witness, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey.SerializeCompressed()), w.btcParams)
+		if err != nil {
+			return nil, err
+		}
+		address = witness.EncodeAddress()
+	case ChainEVM:
+		address = checksumAddress(keccakAddress(pubKey.SerializeUncompressed()))
+	case ChainTron:
+		// TRON 地址为 0x41 前缀加公钥哈希的 Base58Check 编码，T 开头
+		address = base58.CheckEncode(keccakAddress(pubKey.SerializeUncompressed()), 0x41)
+	}
+	return &DerivedAddress{
+		Chain:   hc.name,
+		Index:   index,
+		Path:    fmt.Sprintf("%s/0/%d", hc.accountPath, index),
+		Address: address,
+	}, nil
+}
+
+// keccakAddress 以太坊系地址：未压缩公钥去掉 0x04 前缀后 Keccak-256 哈希的后 20 字节
+func keccakAddress(uncompressed []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(uncompressed[1:])
+	return h.Sum(nil)[12:]
+}
+
+// checksumAddress EIP-55 大小写校验格式
+func checksumAddress(addr []byte) string {
+	lower := hex.EncodeToString(addr)
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(lower))
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	out := []byte(lower)
+	for i, c := range out {
+		if c >= 'a' && digest[i] >= '8' {
+			out[i] = c - 32
+		}
+	}
+	return "0x" + string(out)
+}
+
+// ValidateAddress 校验外部地址（如用户填写的退款地址）的格式和校验和，避免把款转到无法找回的地址。
+// 比特币地址须与 BTC_NETWORK 一致；EVM 地址大小写混合时按 EIP-55 校验
+func (w *HDWallet) ValidateAddress(network, address string) error {
+	switch network {
+	case "BTC":
+		decoded, err := btcutil.DecodeAddress(address, w.btcParams)
+		if err != nil || !decoded.IsForNet(w.btcParams) {
+			return fmt.Errorf("不是有效的比特币 %s 地址: %s", w.btcParams.Name, address)
+		}
+	case "TRC20":
+		if _, err := tronHexAddress(address); err != nil {
+			return fmt.Errorf("不是有效的 TRON 地址: %s", address)
+		}
+	case "SOL":
+		if len(base58.Decode(address)) != 32 {
+			return fmt.Errorf("不是有效的 Solana 地址: %s", address)
+		}
+	default:
+		if _, ok := evmChains[network]; !ok {
+			return fmt.Errorf("不支持的网络: %s", network)
+		}
+		return validateEVMAddress(address)
+	}
+	return nil
+}
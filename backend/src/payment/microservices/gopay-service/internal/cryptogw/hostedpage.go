@@ -0,0 +1,129 @@
+package cryptogw
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed invoicepage.html
+var invoicePageHTML string
+
+// invoicePage 托管收银页，没有前端的商户把付款人引导到 /pay/{paymentId} 即可收款
+var invoicePage = template.Must(template.New("invoice").Parse(invoicePageHTML))
+
+// invoicePageData 托管收银页的渲染数据，State 为页面脚本的初始状态，之后随 SSE 推送更新
+type invoicePageData struct {
+	Label        string
+	PaymentID    string
+	Currency     string
+	NetworkName  string
+	Address      string
+	Memo         string
+	MemoLabel    string
+	AmountExact  string
+	FiatAmount   float64
+	FiatCurrency string
+	// 付款链接和二维码的 bitcoin:、ethereum:、data: 等协议需标记为可信，否则模板会替换为 #ZgotmplZ
+	PaymentURL template.URL
+	QRCode     template.URL
+	EventsURL  string
+	State      invoicePageState
+}
+
+// invoicePageState 与 SSE 推送的账单状态字段同名，页面脚本按字段合并
+type invoicePageState struct {
+	PaymentID             string `json:"paymentId"`
+	Status                string `json:"status"`
+	Confirmations         int    `json:"confirmations,omitempty"`
+	RequiredConfirmations int    `json:"requiredConfirmations,omitempty"`
+	TopUpPaymentID        string `json:"topUpPaymentId,omitempty"`
+	TxURL                 string `json:"txUrl,omitempty"`
+	ExpiredAt             string `json:"expiredAt"`
+}
+
+// checkoutURL 托管收银页的访问地址，未配置 CRYPTO_CHECKOUT_BASE_URL（对外的服务地址，如 https://pay.example.com）时为空
+func checkoutURL(paymentID string) string {
+	base := strings.TrimRight(envString("CRYPTO_CHECKOUT_BASE_URL", ""), "/")
+	if base == "" {
+		return ""
+	}
+	return base + "/pay/" + url.PathEscape(paymentID)
+}
+
+// renderInvoicePage 按账单当前状态渲染托管收银页，待付款的账单过期后按已过期展示
+func renderInvoicePage(invoice *CryptoInvoice) ([]byte, error) {
+	status := invoice.Status
+	if status == InvoicePending && time.Now().After(invoice.ExpiresAt) {
+		status = InvoiceExpired
+	}
+	amount := NewCryptoAmount(invoice.expectedAmount(), Asset{Currency: invoice.Currency, Network: invoice.Network})
+	data := invoicePageData{
+		Label:        paymentLabel(),
+		PaymentID:    invoice.PaymentID,
+		Currency:     invoice.Currency,
+		NetworkName:  networkNames[invoice.Network],
+		Address:      invoice.Address,
+		Memo:         invoice.Memo,
+		MemoLabel:    memoNetworks[invoice.Network].label,
+		AmountExact:  amount.Exact,
+		FiatAmount:   invoice.FiatAmount,
+		FiatCurrency: invoice.FiatCurrency,
+		PaymentURL:   template.URL(paymentURI(invoice, amount)),
+		QRCode:       template.URL(qrCodeDataURI(invoice, amount)),
+		// 相对地址，经网关以路径前缀转发时同样可用
+		EventsURL: "../api/v1/crypto/checkout/" + url.PathEscape(invoice.PaymentID) + "/events",
+		State: invoicePageState{
+			PaymentID:             invoice.PaymentID,
+			Status:                status,
+			Confirmations:         invoice.Confirmations,
+			RequiredConfirmations: invoice.RequiredConfirmations,
+			TopUpPaymentID:        invoice.TopUpPaymentID,
+			TxURL:                 explorerTxURL(invoice.Network, invoice.TxHash),
+			ExpiredAt:             invoice.ExpiresAt.Format(time.RFC3339),
+		},
+	}
+	var page bytes.Buffer
+	if err := invoicePage.Execute(&page, data); err != nil {
+		return nil, err
+	}
+	return page.Bytes(), nil
+}
+
+// registerHostedPageRoutes 注册托管收银页。页面只展示账单，付款状态通过 /api/v1/crypto/checkout/:paymentId/events 实时更新，
+// CRYPTO_CHECKOUT_PAGE=false 时不提供
+func registerHostedPageRoutes(r *gin.Engine, cs *CryptoService) {
+	if os.Getenv("CRYPTO_CHECKOUT_PAGE") == "false" {
+		return
+	}
+	r.GET("/pay/:paymentId", func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Referrer-Policy", "no-referrer")
+
+		invoice, err := cs.invoices.Get(c.Param("paymentId"))
+		if err != nil {
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			c.String(http.StatusNotFound, "账单不存在")
+			return
+		}
+		page, err := renderInvoicePage(invoice)
+		if err != nil {
+			log.Printf("渲染账单 %s 的收银页失败: %v", invoice.PaymentID, err)
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			c.String(http.StatusInternalServerError, "收银页暂时不可用，请稍后重试")
+			return
+		}
+
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	})
+}
@@ -0,0 +1,99 @@
+package cryptogw
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// HotWallet 退款热钱包。收款地址只有扩展公钥，退款从单独的热钱包转出，私钥由签名器保管（见 newSigner），
+// 不出现在配置和进程内存中：REFUND_SIGNER_EVM 各 EVM 兼容链共用，REFUND_SIGNER_BTC 从其原生隔离见证地址转出。
+// 热钱包同时为归集代币的收款地址补充网络费（见 Sweeper），REFUND_SIGNER_TRON 目前只用于补充 TRX。
+// 热钱包只应存放满足近期退款的余额，未配置或签名器不可用的链退款由财务从钱包手工转出后登记交易哈希
+type HotWallet struct {
+	evm        Signer
+	evmAddress string
+
+	tron        Signer
+	tronAddress string
+
+	btc        Signer
+	btcAddress btcutil.Address
+	btcParams  *chaincfg.Params
+}
+
+// NewHotWallet 初始化签名器并读取公钥。仍以明文配置私钥时退出进程
+func NewHotWallet(btcParams *chaincfg.Params) *HotWallet {
+	w := &HotWallet{btcParams: btcParams}
+	for _, legacy := range []string{"REFUND_EVM_PRIVATE_KEY", "REFUND_BTC_WIF"} {
+		if os.Getenv(legacy) != "" {
+			log.Fatalf("不再支持以 %s 明文配置私钥，请导入 KMS 或加密密钥库后改用 REFUND_SIGNER_EVM / REFUND_SIGNER_BTC", legacy)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("KMS_HTTP_TIMEOUT", 10*time.Second)*2)
+	defer cancel()
+
+	if spec := os.Getenv("REFUND_SIGNER_EVM"); spec != "" {
+		signer, err := newSigner(ctx, spec)
+		if err != nil {
+			log.Printf("【警告】EVM 退款签名器不可用，退款需手工转出: %v", err)
+		} else {
+			w.evm = signer
+			w.evmAddress = checksumAddress(keccakAddress(signer.PublicKey().SerializeUncompressed()))
+			log.Printf("EVM 退款热钱包: %s", w.evmAddress)
+		}
+	}
+
+	if spec := os.Getenv("REFUND_SIGNER_TRON"); spec != "" {
+		signer, err := newSigner(ctx, spec)
+		if err != nil {
+			log.Printf("【警告】TRON 热钱包签名器不可用，TRC20 归集无法补充 TRX: %v", err)
+		} else {
+			w.tron = signer
+			w.tronAddress = base58.CheckEncode(keccakAddress(signer.PublicKey().SerializeUncompressed()), tronAddressPrefix)
+			log.Printf("TRON 热钱包: %s", w.tronAddress)
+		}
+	}
+
+	if spec := os.Getenv("REFUND_SIGNER_BTC"); spec != "" {
+		signer, err := newSigner(ctx, spec)
+		if err == nil {
+			w.btcAddress, err = btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(signer.PublicKey().SerializeCompressed()), btcParams)
+		}
+		if err != nil {
+			log.Printf("【警告】比特币退款签名器不可用，退款需手工转出: %v", err)
+		} else {
+			w.btc = signer
+			log.Printf("比特币退款热钱包: %s", w.btcAddress.EncodeAddress())
+		}
+	}
+	return w
+}
+
+// RefundSender 链上监听器实现，用热钱包构造、签名并广播退款交易
+type RefundSender interface {
+	// SendRefund 签名并广播退款交易，返回交易哈希。交易哈希、nonce 或花费的输入在广播前写入 refund，
+	// 广播结果不确定时重发会沿用，原交易和重发的交易只有一笔能上链
+	SendRefund(ctx context.Context, refund *CryptoRefund) (string, error)
+}
+
+// registerSender 登记网络的退款发送接口，由配置了热钱包的监听器创建时调用
+func (cs *CryptoService) registerSender(network string, sender RefundSender) {
+	cs.chainsMu.Lock()
+	defer cs.chainsMu.Unlock()
+	if cs.senders == nil {
+		cs.senders = make(map[string]RefundSender)
+	}
+	cs.senders[network] = sender
+}
+
+func (cs *CryptoService) refundSender(network string) RefundSender {
+	cs.chainsMu.RLock()
+	defer cs.chainsMu.RUnlock()
+	return cs.senders[network]
+}
@@ -0,0 +1,149 @@
+package cryptogw
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gopay-service/internal/rates"
+)
+
+// 账单状态
+const (
+	InvoicePending    = "pending"
+	InvoiceConfirming = "confirming"
+	InvoiceConfirmed  = "confirmed"
+	InvoiceExpired    = "expired"
+	InvoiceFailed     = "failed"    // 入账交易被链重组移出后未重新打包
+	InvoiceUnderpaid  = "underpaid" // 到账数量少于应付，等待补款或人工接受
+	InvoiceOverpaid   = "overpaid"  // 到账数量多于应付，等待人工接受或退还差额
+	InvoiceHeld       = "held"      // 付款方地址命中制裁名单或 KYT 高风险，达到确认数后挂起等待合规复核
+	InvoiceRejected   = "rejected"  // 合规复核拒绝，款项不计入订单，按合规流程另行处置
+)
+
+var ErrInvoiceNotFound = errors.New("支付账单不存在")
+
+// CryptoInvoice 加密货币支付账单
+type CryptoInvoice struct {
+	PaymentID             string                 `json:"paymentId"`
+	OrderID               string                 `json:"orderId"`
+	UserID                int                    `json:"userId"`
+	Currency              string                 `json:"currency"`
+	Network               string                 `json:"network"`
+	Address               string                 `json:"address"`
+	DerivationPath        string                 `json:"derivationPath,omitempty"` // 收款地址的 BIP32 派生路径
+	DerivationIndex       uint32                 `json:"derivationIndex,omitempty"`
+	AddressRecycled       bool                   `json:"addressRecycled,omitempty"` // 收款地址曾分配给过期未付款的账单
+	Reference             string                 `json:"reference,omitempty"`       // Solana Pay 参考公钥，Solana 账单共用收款钱包时以此区分
+	Memo                  string                 `json:"memo,omitempty"`            // XRP、Stellar、TON 账单共用收款地址时入账须携带的标签，见 memoNetworks
+	Amount                float64                `json:"amount"`
+	AmountExact           string                 `json:"amountExact,omitempty"`
+	FiatCurrency          string                 `json:"fiatCurrency,omitempty"`
+	FiatAmount            float64                `json:"fiatAmount,omitempty"`
+	LockedRate            float64                `json:"lockedRate,omitempty"` // 下单时锁定的 法币/加密货币 汇率
+	MarketRate            *rates.Quote           `json:"marketRate,omitempty"` // 下单时汇率源给出的市场汇率及来源
+	RateLockedAt          time.Time              `json:"rateLockedAt,omitempty"`
+	RateExpiresAt         time.Time              `json:"rateExpiresAt,omitempty"` // 锁定汇率的有效期
+	RealizedRate          float64                `json:"realizedRate,omitempty"`  // 实际兑换成法币的汇率
+	ConvertedAt           time.Time              `json:"convertedAt,omitempty"`
+	Status                string                 `json:"status"`
+	TxHash                string                 `json:"txHash,omitempty"`
+	Senders               []string               `json:"senders,omitempty"`    // 入账交易的付款方地址
+	Screening             *Screening             `json:"screening,omitempty"`  // 付款方地址的制裁名单和 KYT 筛查结果
+	TravelRule            *TravelRule            `json:"travelRule,omitempty"` // 达到旅行规则门槛，确认前需合规复核
+	PaidAmount            float64                `json:"paidAmount,omitempty"`
+	PaidAt                time.Time              `json:"paidAt,omitempty"`
+	BlockHeight           int64                  `json:"blockHeight,omitempty"`  // 入账交易所在区块，0 表示尚未打包或已被链重组移出
+	BlockHash             string                 `json:"blockHash,omitempty"`    // 同一高度的区块被重组替换时哈希不同
+	Reorgs                int                    `json:"reorgs,omitempty"`       // 入账所在区块被重组的次数
+	MissingSince          time.Time              `json:"missingSince,omitempty"` // 入账交易被移出主链且不在内存池的起始时间
+	RevertedAt            time.Time              `json:"revertedAt,omitempty"`   // 最近一次已确认后因链重组退回确认中的时间
+	Confirmations         int                    `json:"confirmations,omitempty"`
+	RequiredConfirmations int                    `json:"requiredConfirmations,omitempty"`
+	ConfirmationPolicy    *ConfirmationPolicy    `json:"confirmationPolicy,omitempty"` // 入账适用的确认数规则
+	BandRate              float64                `json:"bandRate,omitempty"`           // 下单时 1 单位币种折合 CONFIRMATION_BAND_CURRENCY 的汇率，用于按入账金额分档
+	Replaceable           bool                   `json:"replaceable,omitempty"`        // 入账交易声明了 RBF（BIP125），打包前可能被替换
+	ConfirmedAt           time.Time              `json:"confirmedAt,omitempty"`
+	LatePayment           bool                   `json:"latePayment,omitempty"` // 锁定汇率过期后才付款，需按当前汇率核算
+	Repricings            []Repricing            `json:"repricings,omitempty"`
+	AddressReused         bool                   `json:"addressReused,omitempty"`   // 入账地址来自已过期账单
+	AmountDelta           string                 `json:"amountDelta,omitempty"`     // 到账数量减应付数量，负数为少付
+	Resolution            *AmountResolution      `json:"resolution,omitempty"`      // 少付或多付的处理方式
+	ParentPaymentID       string                 `json:"parentPaymentId,omitempty"` // 补款账单对应的原账单
+	TopUpPaymentID        string                 `json:"topUpPaymentId,omitempty"`  // 少付账单最近一次的补款账单
+	Metadata              map[string]interface{} `json:"metadata,omitempty"`
+	CallbackURL           string                 `json:"callbackUrl,omitempty"` // 账单回调地址，见 CryptoWebhooks
+	ExpiresAt             time.Time              `json:"expiresAt"`
+	ExpiryExtended        bool                   `json:"expiryExtended,omitempty"`
+	CreatedAt             time.Time              `json:"createdAt"`
+	UpdatedAt             time.Time              `json:"updatedAt"`
+}
+
+// awaitingConfirmation 入账已归属、尚未最终确认。少付和多付的账单同样跟踪确认数和链重组
+func (invoice *CryptoInvoice) awaitingConfirmation() bool {
+	switch invoice.Status {
+	case InvoiceConfirming, InvoiceUnderpaid, InvoiceOverpaid:
+		return true
+	}
+	return false
+}
+
+// InvoiceStore 账单存储
+type InvoiceStore interface {
+	Save(invoice *CryptoInvoice) error
+	Get(paymentID string) (*CryptoInvoice, error)
+	List() ([]*CryptoInvoice, error)
+}
+
+type memoryInvoiceStore struct {
+	mu       sync.RWMutex
+	invoices map[string]*CryptoInvoice
+}
+
+func NewMemoryInvoiceStore() InvoiceStore {
+	return &memoryInvoiceStore{invoices: make(map[string]*CryptoInvoice)}
+}
+
+func (s *memoryInvoiceStore) Save(invoice *CryptoInvoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if invoice.CreatedAt.IsZero() {
+		invoice.CreatedAt = now
+	}
+	invoice.UpdatedAt = now
+
+	copied := *invoice
+	s.invoices[invoice.PaymentID] = &copied
+	return nil
+}
+
+func (s *memoryInvoiceStore) Get(paymentID string) (*CryptoInvoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoice, ok := s.invoices[paymentID]
+	if !ok {
+		return nil, ErrInvoiceNotFound
+	}
+	copied := *invoice
+	return &copied, nil
+}
+
+// List 按创建时间倒序返回全部账单
+func (s *memoryInvoiceStore) List() ([]*CryptoInvoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoices := make([]*CryptoInvoice, 0, len(s.invoices))
+	for _, invoice := range s.invoices {
+		copied := *invoice
+		invoices = append(invoices, &copied)
+	}
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].CreatedAt.After(invoices[j].CreatedAt)
+	})
+	return invoices, nil
+}
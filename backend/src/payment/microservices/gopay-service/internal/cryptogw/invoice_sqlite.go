@@ -0,0 +1,74 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sqliteInvoiceStore 基于 SQLite 的账单存储，表结构见 migrations/00007_crypto_queues.sql
+type sqliteInvoiceStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteInvoiceStore(db *sql.DB) InvoiceStore {
+	return &sqliteInvoiceStore{db: db}
+}
+
+func (s *sqliteInvoiceStore) Save(invoice *CryptoInvoice) error {
+	now := time.Now()
+	if invoice.CreatedAt.IsZero() {
+		invoice.CreatedAt = now
+	}
+	invoice.UpdatedAt = now
+
+	data, err := json.Marshal(invoice)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO crypto_invoices (payment_id, status, created_at, updated_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (payment_id) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at, data = excluded.data`,
+		invoice.PaymentID, invoice.Status, invoice.CreatedAt.UnixNano(), invoice.UpdatedAt.UnixNano(), data)
+	return err
+}
+
+func (s *sqliteInvoiceStore) Get(paymentID string) (*CryptoInvoice, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM crypto_invoices WHERE payment_id = ?`, paymentID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	invoice := new(CryptoInvoice)
+	if err := json.Unmarshal(data, invoice); err != nil {
+		return nil, fmt.Errorf("解析账单失败: %w", err)
+	}
+	return invoice, nil
+}
+
+// List 按创建时间倒序返回全部账单
+func (s *sqliteInvoiceStore) List() ([]*CryptoInvoice, error) {
+	rows, err := s.db.Query(`SELECT data FROM crypto_invoices ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []*CryptoInvoice
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		invoice := new(CryptoInvoice)
+		if err := json.Unmarshal(data, invoice); err != nil {
+			return nil, fmt.Errorf("解析账单失败: %w", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, rows.Err()
+}
@@ -0,0 +1,357 @@
+package cryptogw
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// keystoreFile 以太坊 Web3 Secret Storage（v3）格式的加密密钥文件，可与 geth 等钱包互相导入导出
+type keystoreFile struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+	Address string `json:"address,omitempty"`
+	Crypto  struct {
+		Cipher       string `json:"cipher"`
+		CipherText   string `json:"ciphertext"`
+		CipherParams struct {
+			IV string `json:"iv"`
+		} `json:"cipherparams"`
+		KDF       string            `json:"kdf"`
+		KDFParams keystoreKDFParams `json:"kdfparams"`
+		MAC       string            `json:"mac"`
+	} `json:"crypto"`
+}
+
+type keystoreKDFParams struct {
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+	N     int    `json:"n,omitempty"` // scrypt
+	R     int    `json:"r,omitempty"`
+	P     int    `json:"p,omitempty"`
+	C     int    `json:"c,omitempty"` // pbkdf2
+	PRF   string `json:"prf,omitempty"`
+}
+
+// keystoreSigner 加密的本地密钥库。口令从 KEYSTORE_PASSWORD_FILE 指向的文件读取（如挂载的 Secret），
+// 每次签名时读取口令并解密私钥，签名后立即清零，私钥和口令都不常驻内存
+type keystoreSigner struct {
+	path   string
+	pubKey *btcec.PublicKey
+}
+
+func newKeystoreSigner(path string) (*keystoreSigner, error) {
+	s := &keystoreSigner{path: path}
+	key, err := s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	s.pubKey = key.PubKey()
+	return s, nil
+}
+
+func (s *keystoreSigner) PublicKey() *btcec.PublicKey {
+	return s.pubKey
+}
+
+func (s *keystoreSigner) SignDigest(_ context.Context, digest []byte) ([]byte, error) {
+	key, err := s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	// 紧凑签名首字节为恢复 ID，其后为 low-S 的 r||s
+	sig, err := ecdsa.SignCompact(key, digest, false)
+	if err != nil {
+		return nil, err
+	}
+	return sig[1:], nil
+}
+
+func (s *keystoreSigner) unlock() (*btcec.PrivateKey, error) {
+	file, secret, err := openKeystore(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(secret)
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("密钥库 %s 保存的不是单个私钥", s.path)
+	}
+	key, _ := btcec.PrivKeyFromBytes(secret)
+	if file.Address != "" && !strings.EqualFold(strings.TrimPrefix(file.Address, "0x"), hex.EncodeToString(keccakAddress(key.PubKey().SerializeUncompressed()))) {
+		key.Zero()
+		return nil, fmt.Errorf("密钥库 %s 的地址与私钥不一致", s.path)
+	}
+	return key, nil
+}
+
+// openKeystore 读取口令并解密密钥库，调用方用完后清零返回的明文
+func openKeystore(path string) (*keystoreFile, []byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file keystoreFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, nil, fmt.Errorf("密钥库 %s 格式无效: %w", path, err)
+	}
+	password, err := readKeystorePassword(os.Getenv("KEYSTORE_PASSWORD_FILE"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zero(password)
+
+	secret, err := file.decrypt(password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("密钥库 %s: %w", path, err)
+	}
+	return &file, secret, nil
+}
+
+func (file *keystoreFile) decrypt(password []byte) ([]byte, error) {
+	if file.Version != 3 || file.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("只支持 v3 版本、aes-128-ctr 加密的密钥库")
+	}
+	params := file.Crypto.KDFParams
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, err
+	}
+	var derived []byte
+	switch file.Crypto.KDF {
+	case "scrypt":
+		derived, err = scrypt.Key(password, salt, params.N, params.R, params.P, params.DKLen)
+	case "pbkdf2":
+		if params.PRF != "hmac-sha256" {
+			return nil, fmt.Errorf("不支持的 pbkdf2 算法 %s", params.PRF)
+		}
+		derived = pbkdf2.Key(password, salt, params.C, params.DKLen, sha256.New)
+	default:
+		err = fmt.Errorf("不支持的密钥派生算法 %s", file.Crypto.KDF)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer zero(derived)
+	if len(derived) < 32 {
+		return nil, fmt.Errorf("dklen 过短")
+	}
+
+	ciphertext, err := hex.DecodeString(file.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	mac := keccak256(append(append([]byte(nil), derived[16:32]...), ciphertext...))
+	if hex.EncodeToString(mac) != strings.ToLower(file.Crypto.MAC) {
+		return nil, fmt.Errorf("口令错误")
+	}
+	iv, err := hex.DecodeString(file.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived[:16])
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(secret, ciphertext)
+	return secret, nil
+}
+
+// encryptKeystore 用 scrypt 派生密钥加密私钥（或扩展私钥的字符串）。light 使用 geth 的轻量参数（n=4096），解密更快但抗暴力破解能力较弱
+func encryptKeystore(secret, password []byte, light bool) (*keystoreFile, error) {
+	n := 1 << 18
+	if light {
+		n = 1 << 12
+	}
+	salt, iv, id := make([]byte, 32), make([]byte, aes.BlockSize), make([]byte, 16)
+	for _, buf := range [][]byte{salt, iv, id} {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+	}
+	derived, err := scrypt.Key(password, salt, n, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(derived)
+	block, err := aes.NewCipher(derived[:16])
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(secret))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, secret)
+
+	// UUID v4
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	file := &keystoreFile{
+		Version: 3,
+		ID:      fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]),
+	}
+	file.Crypto.Cipher = "aes-128-ctr"
+	file.Crypto.CipherText = hex.EncodeToString(ciphertext)
+	file.Crypto.CipherParams.IV = hex.EncodeToString(iv)
+	file.Crypto.KDF = "scrypt"
+	file.Crypto.KDFParams = keystoreKDFParams{DKLen: 32, Salt: hex.EncodeToString(salt), N: n, R: 8, P: 1}
+	file.Crypto.MAC = hex.EncodeToString(keccak256(append(append([]byte(nil), derived[16:32]...), ciphertext...)))
+	return file, nil
+}
+
+func readKeystorePassword(path string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("未配置 KEYSTORE_PASSWORD_FILE")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥库口令失败: %w", err)
+	}
+	return bytes.TrimRight(raw, "\r\n"), nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// RunKeystoreCLI 生成或导入热钱包私钥并写入加密的密钥库，输出对应的 EVM 和比特币地址。
+// 指定 -xprv 时导入收款地址所在账户的扩展私钥，供归集签名（见 hdKeystore）
+func RunKeystoreCLI(args []string) int {
+	fs := flag.NewFlagSet("crypto-keystore", flag.ContinueOnError)
+	out := fs.String("out", "", "密钥库文件路径")
+	passwordFile := fs.String("password-file", os.Getenv("KEYSTORE_PASSWORD_FILE"), "口令文件")
+	importKey := fs.Bool("import", false, "从标准输入读取要导入的私钥（十六进制或 WIF），不指定时随机生成")
+	xprv := fs.Bool("xprv", false, "从标准输入读取收款账户的扩展私钥（如 m/44'/60'/0' 层的 xprv），用于归集")
+	light := fs.Bool("light", false, "使用轻量的 scrypt 参数")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *out == "" {
+		fmt.Fprintln(os.Stderr, "用法: gopay-service crypto-keystore -out <路径> [-password-file 口令文件] [-import | -xprv] [-light]")
+		return 2
+	}
+	if _, err := os.Stat(*out); err == nil {
+		fmt.Fprintf(os.Stderr, "%s 已存在，不会覆盖\n", *out)
+		return 1
+	}
+	password, err := readKeystorePassword(*passwordFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer zero(password)
+	if *xprv {
+		return writeXprvKeystore(*out, password, *light)
+	}
+
+	secret := make([]byte, 32)
+	defer zero(secret)
+	if *importKey {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		line = strings.TrimSpace(line)
+		if wif, err := btcutil.DecodeWIF(line); err == nil {
+			wif.PrivKey.Key.PutBytesUnchecked(secret)
+		} else if decoded, err := hex.DecodeString(strings.TrimPrefix(line, "0x")); err == nil && len(decoded) == 32 {
+			copy(secret, decoded)
+			zero(decoded)
+		} else {
+			fmt.Fprintln(os.Stderr, "私钥须为 32 字节十六进制或 WIF")
+			return 1
+		}
+	} else {
+		key, err := btcec.NewPrivateKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		key.Key.PutBytesUnchecked(secret)
+		key.Zero()
+	}
+
+	key, _ := btcec.PrivKeyFromBytes(secret)
+	defer key.Zero()
+	file, err := encryptKeystore(secret, password, *light)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	file.Address = hex.EncodeToString(keccakAddress(key.PubKey().SerializeUncompressed()))
+	if err := writeKeystoreFile(*out, file); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	params := &chaincfg.MainNetParams
+	if envString("BTC_NETWORK", "mainnet") == "testnet" {
+		params = &chaincfg.TestNet3Params
+	}
+	btcAddress, _ := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), params)
+	fmt.Printf("已写入 %s\nEVM 地址: %s\n比特币地址: %s\n配置: REFUND_SIGNER_EVM=keystore:%s 或 REFUND_SIGNER_BTC=keystore:%s\n",
+		*out, checksumAddress(keccakAddress(key.PubKey().SerializeUncompressed())), btcAddress.EncodeAddress(), *out, *out)
+	return 0
+}
+
+// writeXprvKeystore 导入扩展私钥写入密钥库，输出对应的扩展公钥供与 HD_XPUB_* 核对
+func writeXprvKeystore(out string, password []byte, light bool) int {
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	secret := []byte(strings.TrimSpace(line))
+	defer zero(secret)
+	key, err := hdkeychain.NewKeyFromString(string(secret))
+	if err != nil || !key.IsPrivate() {
+		fmt.Fprintln(os.Stderr, "不是有效的扩展私钥")
+		return 1
+	}
+	xpub, err := key.Neuter()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	file, err := encryptKeystore(secret, password, light)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := writeKeystoreFile(out, file); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("已写入 %s\n扩展公钥: %s\n须与该链的 HD_XPUB_* 一致，配置: SWEEP_KEYSTORE_<BTC|EVM|TRON>=%s\n", out, xpub.String(), out)
+	return 0
+}
+
+func writeKeystoreFile(path string, file *keystoreFile) error {
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// O_EXCL 防止检查之后被其他进程抢先创建
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,201 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// awsKMSSigner AWS KMS 非对称密钥签名，私钥不离开 KMS 的 HSM。
+// 区域取 ARN 中的区域或 AWS_REGION（AWS_DEFAULT_REGION），AWS_KMS_ENDPOINT 可指向 VPC 终端节点；
+// 凭证取 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY 和可选的 AWS_SESSION_TOKEN，由部署环境注入临时凭证。
+// 授权策略只需 kms:GetPublicKey 和 kms:Sign
+type awsKMSSigner struct {
+	keyID    string
+	region   string
+	endpoint string
+	client   *http.Client
+	pubKey   *btcec.PublicKey
+}
+
+func newAWSKMSSigner(ctx context.Context, keyID string) (*awsKMSSigner, error) {
+	region := envString("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION"))
+	if parts := strings.Split(keyID, ":"); len(parts) >= 6 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		return nil, fmt.Errorf("未配置 AWS_REGION")
+	}
+	s := &awsKMSSigner{
+		keyID:    keyID,
+		region:   region,
+		endpoint: strings.TrimRight(envString("AWS_KMS_ENDPOINT", "https://kms."+region+".amazonaws.com"), "/"),
+		client:   &http.Client{Timeout: envDuration("KMS_HTTP_TIMEOUT", 10*time.Second)},
+	}
+
+	var resp struct {
+		PublicKey string `json:"PublicKey"`
+		KeySpec   string `json:"KeySpec"`
+		KeyUsage  string `json:"KeyUsage"`
+	}
+	if err := s.call(ctx, "GetPublicKey", map[string]string{"KeyId": keyID}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.KeySpec != "ECC_SECG_P256K1" || resp.KeyUsage != "SIGN_VERIFY" {
+		return nil, fmt.Errorf("AWS KMS 密钥 %s 的类型为 %s/%s，须为 ECC_SECG_P256K1 签名密钥", keyID, resp.KeySpec, resp.KeyUsage)
+	}
+	der, err := base64.StdEncoding.DecodeString(resp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if s.pubKey, err = parseSubjectPublicKey(der); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *awsKMSSigner) PublicKey() *btcec.PublicKey {
+	return s.pubKey
+}
+
+func (s *awsKMSSigner) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	var resp struct {
+		Signature string `json:"Signature"`
+	}
+	payload := map[string]string{
+		"KeyId":            s.keyID,
+		"Message":          base64.StdEncoding.EncodeToString(digest),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}
+	if err := s.call(ctx, "Sign", payload, &resp); err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return parseDERSignature(der)
+}
+
+// call 调用 KMS 的 JSON 协议接口
+func (s *awsKMSSigner) call(ctx context.Context, operation string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+	creds := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return fmt.Errorf("未配置 AWS 凭证")
+	}
+	signAWSRequest(req, body, "kms", s.region, creds, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("AWS KMS %s 请求失败: %w", operation, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var kmsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(raw, &kmsErr)
+		return fmt.Errorf("AWS KMS %s 返回 HTTP %d: %s %s", operation, resp.StatusCode, kmsErr.Type, kmsErr.Message)
+	}
+	return json.Unmarshal(raw, result)
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// signAWSRequest 按 Signature Version 4 签名请求，签入 Host、Content-Type 和全部 X-Amz-* 头
+func signAWSRequest(req *http.Request, body []byte, service, region string, creds awsCredentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
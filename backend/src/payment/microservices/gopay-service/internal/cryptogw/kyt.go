@@ -0,0 +1,188 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// kytRequest 调用 KYT 服务的 JSON 接口，非 200 响应作为错误返回
+func kytRequest(ctx context.Context, client *http.Client, req *http.Request, result interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("响应解析失败: %w", err)
+	}
+	return nil
+}
+
+// chainalysisProvider Chainalysis 制裁名单筛查接口（Sanctions Screening API），
+// CHAINALYSIS_API_KEY 为接口密钥，CHAINALYSIS_API_URL 默认 https://public.chainalysis.com。
+// 该接口只覆盖制裁名单，不区分链，命中即为 sanctions
+type chainalysisProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func newChainalysisProvider() *chainalysisProvider {
+	apiKey := os.Getenv("CHAINALYSIS_API_KEY")
+	if apiKey == "" {
+		log.Fatalf("COMPLIANCE_KYT_PROVIDER=chainalysis 需要配置 CHAINALYSIS_API_KEY")
+	}
+	return &chainalysisProvider{
+		baseURL: strings.TrimRight(envString("CHAINALYSIS_API_URL", "https://public.chainalysis.com"), "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: envDuration("KYT_HTTP_TIMEOUT", 10*time.Second)},
+	}
+}
+
+func (p *chainalysisProvider) Name() string { return "chainalysis" }
+
+func (p *chainalysisProvider) ScreenAddress(ctx context.Context, network, address string) ([]ScreeningHit, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+"/api/v1/address/"+url.PathEscape(address), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", p.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		Identifications []struct {
+			Category    string `json:"category"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			URL         string `json:"url"`
+		} `json:"identifications"`
+	}
+	if err := kytRequest(ctx, p.client, req, &resp); err != nil {
+		return nil, err
+	}
+	var hits []ScreeningHit
+	for _, id := range resp.Identifications {
+		hits = append(hits, ScreeningHit{
+			Address:  address,
+			Source:   p.Name(),
+			Category: strings.ToLower(id.Category),
+			Name:     id.Name,
+			Detail:   id.Description,
+			URL:      id.URL,
+		})
+	}
+	return hits, nil
+}
+
+// trmChains TRM 的链标识
+var trmChains = map[string]string{
+	"BTC":     "bitcoin",
+	"ERC20":   "ethereum",
+	"BEP20":   "binance_smart_chain",
+	"POLYGON": "polygon",
+	"TRC20":   "tron",
+	"SOL":     "solana",
+}
+
+// trmProvider TRM Labs 地址筛查接口，TRM_API_KEY 为接口密钥，TRM_API_URL 默认 https://api.trmlabs.com。
+// 地址自身归属（OWNERSHIP）或资金往来（COUNTERPARTY、INDIRECT）任一风险类别的等级
+// 达到 TRM_MIN_RISK_LEVEL（默认 10，即 High；Severe 为 15）时视为命中
+type trmProvider struct {
+	baseURL  string
+	apiKey   string
+	minLevel int
+	client   *http.Client
+}
+
+func newTRMProvider() *trmProvider {
+	apiKey := os.Getenv("TRM_API_KEY")
+	if apiKey == "" {
+		log.Fatalf("COMPLIANCE_KYT_PROVIDER=trm 需要配置 TRM_API_KEY")
+	}
+	return &trmProvider{
+		baseURL:  strings.TrimRight(envString("TRM_API_URL", "https://api.trmlabs.com"), "/"),
+		apiKey:   apiKey,
+		minLevel: envInt("TRM_MIN_RISK_LEVEL", 10),
+		client:   &http.Client{Timeout: envDuration("KYT_HTTP_TIMEOUT", 10*time.Second)},
+	}
+}
+
+func (p *trmProvider) Name() string { return "trm" }
+
+func (p *trmProvider) ScreenAddress(ctx context.Context, network, address string) ([]ScreeningHit, error) {
+	chain, ok := trmChains[network]
+	if !ok {
+		return nil, fmt.Errorf("TRM 不支持网络 %s", network)
+	}
+	body, _ := json.Marshal([]map[string]string{{"address": address, "chain": chain, "accountExternalId": address}})
+	req, err := http.NewRequest(http.MethodPost, p.baseURL+"/public/v2/screening/addresses", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.apiKey, p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp []struct {
+		Address               string `json:"address"`
+		AddressRiskIndicators []struct {
+			Category                    string `json:"category"`
+			CategoryRiskScoreLevel      int    `json:"categoryRiskScoreLevel"`
+			CategoryRiskScoreLevelLabel string `json:"categoryRiskScoreLevelLabel"`
+			RiskType                    string `json:"riskType"`
+		} `json:"addressRiskIndicators"`
+		Entities []struct {
+			Category            string `json:"category"`
+			Entity              string `json:"entity"`
+			RiskScoreLevel      int    `json:"riskScoreLevel"`
+			RiskScoreLevelLabel string `json:"riskScoreLevelLabel"`
+			TrmAppURL           string `json:"trmAppUrl"`
+		} `json:"entities"`
+	}
+	if err := kytRequest(ctx, p.client, req, &resp); err != nil {
+		return nil, err
+	}
+	var hits []ScreeningHit
+	for _, result := range resp {
+		for _, entity := range result.Entities {
+			if entity.RiskScoreLevel >= p.minLevel {
+				hits = append(hits, ScreeningHit{
+					Address:  address,
+					Source:   p.Name(),
+					Category: strings.ToLower(entity.Category),
+					Name:     entity.Entity,
+					Risk:     entity.RiskScoreLevelLabel,
+					URL:      entity.TrmAppURL,
+					RiskType: "OWNERSHIP",
+				})
+			}
+		}
+		for _, indicator := range result.AddressRiskIndicators {
+			if indicator.CategoryRiskScoreLevel >= p.minLevel {
+				hits = append(hits, ScreeningHit{
+					Address:  address,
+					Source:   p.Name(),
+					Category: strings.ToLower(indicator.Category),
+					Risk:     indicator.CategoryRiskScoreLevelLabel,
+					RiskType: indicator.RiskType,
+				})
+			}
+		}
+	}
+	return hits, nil
+}
@@ -0,0 +1,50 @@
+package cryptogw
+
+import (
+	"context"
+	"sync"
+)
+
+// LoopSupervisor 托管链上监听、账本核验等常驻循环，由统一入口传入与法币渠道服务共用的任务框架：
+// 循环 panic 或在关闭前退出时按退避重启，关闭网关时等待全部循环退出
+type LoopSupervisor interface {
+	// Loop 启动名为 name 的常驻循环，run 须在 ctx 取消后返回
+	Loop(name string, run func(ctx context.Context))
+	// Stop 取消全部循环并等待退出，ctx 到期时返回错误
+	Stop(ctx context.Context) error
+}
+
+// goroutineLoops 未传入 LoopSupervisor 时的退化实现：每个循环一个 goroutine，不重启，关闭时等待退出
+type goroutineLoops struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newGoroutineLoops() *goroutineLoops {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &goroutineLoops{ctx: ctx, cancel: cancel}
+}
+
+func (l *goroutineLoops) Loop(_ string, run func(ctx context.Context)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		run(l.ctx)
+	}()
+}
+
+func (l *goroutineLoops) Stop(ctx context.Context) error {
+	l.cancel()
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
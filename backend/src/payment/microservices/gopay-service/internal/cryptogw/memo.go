@@ -0,0 +1,244 @@
+package cryptogw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoNetwork 所有账单共用一个收款地址、按转账附带的标签区分账单的网络
+type memoNetwork struct {
+	label   string         // 钱包中标签字段的名称，用于提示付款人
+	max     int64          // 标签取值上限
+	address *regexp.Regexp // 收款地址格式
+	node    string         // 核验入账的节点配置项
+}
+
+// memoMin 生成的标签至少 9 位，避免与付款人随手填写或交易所默认的小数字撞上
+const memoMin = 100000000
+
+// memoNetworks XRP Ledger 的 Destination Tag 为 32 位无符号整数；Stellar 使用 MEMO_ID（64 位无符号整数）；
+// TON 没有数字标签，使用转账注释（comment），同样生成纯数字便于付款人手工输入
+var memoNetworks = map[string]memoNetwork{
+	"XRP": {label: "Destination Tag", max: math.MaxUint32, address: regexp.MustCompile(`^r[1-9A-HJ-NP-Za-km-z]{24,34}$`), node: "XRP_RPC_URLS"},
+	"XLM": {label: "Memo (ID)", max: 1e12, address: regexp.MustCompile(`^G[A-Z2-7]{55}$`), node: "XLM_HORIZON_URLS"},
+	"TON": {label: "Comment", max: 1e12, address: regexp.MustCompile(`^([EU]Q[A-Za-z0-9_-]{46}|-?[0-9]+:[0-9a-fA-F]{64})$`), node: "TON_API_URLS"},
+}
+
+func isMemoNetwork(network string) bool {
+	_, ok := memoNetworks[network]
+	return ok
+}
+
+// memoDepositWallets 各标签网络的收款地址（<网络>_DEPOSIT_ADDRESS，如 XRP_DEPOSIT_ADDRESS）。
+// 这些链按账户收款，激活每个地址都要锁定一笔储备金，不适合每笔账单分配新地址，因此所有账单共用收款地址，
+// 下单时为每笔账单生成标签，入账须携带相同标签才会归属。未配置的网络不支持下单。
+// 入账由外部监听服务上报，网关按该网络的节点核验后才归属，配置了收款地址的网络须同时配置节点（见 startLedgers）
+func memoDepositWallets() map[string]string {
+	wallets := make(map[string]string)
+	for network, memo := range memoNetworks {
+		address := os.Getenv(network + "_DEPOSIT_ADDRESS")
+		if address == "" {
+			continue
+		}
+		if !memo.address.MatchString(address) {
+			log.Fatalf("%s_DEPOSIT_ADDRESS 不是有效的 %s 地址: %s", network, networkNames[network], address)
+		}
+		wallets[network] = address
+	}
+	return wallets
+}
+
+// newPaymentMemo 随机生成 [memoMin, max) 范围内的数字标签
+func newPaymentMemo(network string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(memoNetworks[network].max-memoMin))
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(n.Int64()+memoMin, 10), nil
+}
+
+// MemoStore 已分配的标签。标签分配后不释放，账单过期后迟到的付款仍按标签归属
+type MemoStore interface {
+	// Reserve 标签在该网络未被占用时登记到账单并返回 true，检查和登记是原子的，并发下单不会分配出相同标签
+	Reserve(network, memo, paymentID string) (bool, error)
+}
+
+type memoryMemoStore struct {
+	mu    sync.Mutex
+	memos map[string]string // 网络:标签 -> 账单号
+}
+
+func NewMemoryMemoStore() MemoStore {
+	return &memoryMemoStore{memos: make(map[string]string)}
+}
+
+func (s *memoryMemoStore) Reserve(network, memo, paymentID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := network + ":" + memo
+	if _, ok := s.memos[key]; ok {
+		return false, nil
+	}
+	s.memos[key] = paymentID
+	return true, nil
+}
+
+// assignMemo 为账单分配标签，与该网络已分配过的标签（含已过期账单的，迟到的付款仍按标签归属）不重复
+func (cs *CryptoService) assignMemo(invoice *CryptoInvoice) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		memo, err := newPaymentMemo(invoice.Network)
+		if err != nil {
+			return err
+		}
+		ok, err := cs.memos.Reserve(invoice.Network, memo, invoice.PaymentID)
+		if err != nil {
+			return fmt.Errorf("登记 %s 失败: %w", memoNetworks[invoice.Network].label, err)
+		}
+		if ok {
+			invoice.Memo = memo
+			return nil
+		}
+	}
+	return fmt.Errorf("%s 生成不重复的 %s 失败", networkNames[invoice.Network], memoNetworks[invoice.Network].label)
+}
+
+// memoPaymentURI 标签网络的付款链接，带上标签，钱包扫码后无需手工填写：XRP 为 ripple:地址?amount=&dt=，
+// Stellar 按 SEP-7（web+stellar:pay），TON 为 ton://transfer/地址?amount=（nanoton）&text=
+func memoPaymentURI(invoice *CryptoInvoice, amount CryptoAmount) string {
+	query := url.Values{}
+	switch invoice.Network {
+	case "XRP":
+		query.Set("amount", amount.Exact)
+		query.Set("dt", invoice.Memo)
+		return "ripple:" + invoice.Address + "?" + query.Encode()
+	case "XLM":
+		query.Set("destination", invoice.Address)
+		query.Set("amount", amount.Exact)
+		query.Set("memo", invoice.Memo)
+		query.Set("memo_type", "MEMO_ID")
+		query.Set("msg", fmt.Sprintf("订单 %s", invoice.OrderID))
+		// SEP-7 按 RFC 3986 解码，空格不能编码为 +
+		return "web+stellar:pay?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+	case "TON":
+		query.Set("amount", amount.BaseUnits)
+		query.Set("text", invoice.Memo)
+		return "ton://transfer/" + invoice.Address + "?" + query.Encode()
+	}
+	return ""
+}
+
+// missingMemoReason 入账未携带或携带了未知标签时转人工复核的原因
+func missingMemoReason(transfer *InboundTransfer) string {
+	label := memoNetworks[transfer.Network].label
+	if transfer.Memo == "" {
+		return fmt.Sprintf("转入共用收款地址的入账未携带 %s，无法确定所属账单", label)
+	}
+	return fmt.Sprintf("未找到 %s 为 %s 且金额匹配的待付款账单", label, transfer.Memo)
+}
+
+// chainLedger 标签网络的链上读取接口。网关不扫描这些链的区块，只按节点核验外部监听服务上报的交易，
+// 并按节点查询的最新账本推进确认数
+type chainLedger interface {
+	TxLocator
+	// Head 最新的已验证账本（主链区块）序号
+	Head(ctx context.Context) (int64, error)
+}
+
+// startLedgers 启动已配置节点的标签网络的入账核验。配置了收款地址但没有节点的网络无法核验入账，返回错误
+func (cs *CryptoService) startLedgers(loops LoopSupervisor, hub *CheckoutHub) error {
+	if ledger := NewXRPLedger(cs, hub); ledger != nil {
+		loops.Loop("xrp_ledger", ledger.Run)
+	}
+	if ledger := NewStellarLedger(cs, hub); ledger != nil {
+		loops.Loop("stellar_ledger", ledger.Run)
+	}
+	if ledger := NewTONLedger(cs, hub); ledger != nil {
+		loops.Loop("ton_ledger", ledger.Run)
+	}
+	for network := range cs.memoWallets {
+		if cs.chainReader(network) == nil {
+			return fmt.Errorf("已配置 %s_DEPOSIT_ADDRESS，但未配置 %s，无法核验 %s 入账", network, memoNetworks[network].node, networkNames[network])
+		}
+	}
+	return nil
+}
+
+// trackLedger 每隔 LEDGER_POLL_INTERVAL（默认 5s）按节点查询的最新账本推进该网络账单和退款的确认数
+func (cs *CryptoService) trackLedger(ctx context.Context, hub *CheckoutHub, network string, ledger chainLedger) {
+	ticker := time.NewTicker(envDuration("LEDGER_POLL_INTERVAL", 5*time.Second))
+	defer ticker.Stop()
+
+	for {
+		head, err := ledger.Head(ctx)
+		if err == nil {
+			var changed []*ConfirmationUpdate
+			changed, err = cs.AdvanceConfirmations(ctx, network, head, ledger)
+			publishConfirmations(hub, changed)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("%s 推进确认数失败: %v", networkNames[network], err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// errLedgerNotFound 节点返回 404，查询的交易或账户不存在
+var errLedgerNotFound = errors.New("记录不存在")
+
+// getLedgerJSON 在节点池上发起 GET 请求并解析 JSON 响应。记录不存在时返回 errLedgerNotFound，换节点也不会有不同结果，不计入节点失败
+func getLedgerJSON(ctx context.Context, pool *EndpointPool, client *http.Client, path string, header http.Header, result interface{}) error {
+	return pool.Do(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		return requestLedgerJSON(ctx, client, ep.URL+path, header, result)
+	}, func(err error) bool { return errors.Is(err, errLedgerNotFound) })
+}
+
+func requestLedgerJSON(ctx context.Context, client *http.Client, target string, header http.Header, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errLedgerNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("响应解析失败: %w", err)
+	}
+	return nil
+}
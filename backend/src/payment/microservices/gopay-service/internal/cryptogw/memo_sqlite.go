@@ -0,0 +1,27 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"time"
+)
+
+// sqliteMemoStore 基于 SQLite 的标签登记，表结构见 migrations/00004_crypto_memos.sql。
+// 网络和标签为主键，多个实例共用数据库时同样不会分配出相同标签
+type sqliteMemoStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteMemoStore(db *sql.DB) MemoStore {
+	return &sqliteMemoStore{db: db}
+}
+
+func (s *sqliteMemoStore) Reserve(network, memo, paymentID string) (bool, error) {
+	result, err := s.db.Exec(`INSERT INTO crypto_memos (network, memo, payment_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (network, memo) DO NOTHING`,
+		network, memo, paymentID, time.Now().UnixNano())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
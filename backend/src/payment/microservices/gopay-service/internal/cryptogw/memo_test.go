@@ -0,0 +1,109 @@
+package cryptogw
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewPaymentMemoRange(t *testing.T) {
+	for network, memo := range memoNetworks {
+		for i := 0; i < 1000; i++ {
+			raw, err := newPaymentMemo(network)
+			if err != nil {
+				t.Fatalf("%s 生成标签失败: %v", network, err)
+			}
+			value, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				t.Fatalf("%s 的标签 %s 不是数字: %v", network, raw, err)
+			}
+			if value < memoMin || value >= memo.max {
+				t.Fatalf("%s 的标签 %d 超出 [%d, %d)", network, value, memoMin, memo.max)
+			}
+		}
+	}
+}
+
+func TestMemoryMemoStoreReserve(t *testing.T) {
+	store := NewMemoryMemoStore()
+	cases := []struct {
+		network, memo, paymentID string
+		want                     bool
+	}{
+		{"XRP", "123456789", "P1", true},
+		{"XRP", "123456789", "P2", false}, // 同一网络的标签已被占用
+		{"XLM", "123456789", "P3", true},  // 不同网络互不影响
+		{"XRP", "123456790", "P4", true},
+	}
+	for _, tc := range cases {
+		ok, err := store.Reserve(tc.network, tc.memo, tc.paymentID)
+		if err != nil || ok != tc.want {
+			t.Errorf("Reserve(%s, %s, %s) = %v, %v，预期 %v", tc.network, tc.memo, tc.paymentID, ok, err, tc.want)
+		}
+	}
+}
+
+// newMemoTestService 只含入账归属用到的组件，不派生收款地址
+func newMemoTestService() *CryptoService {
+	return &CryptoService{
+		addresses: &AddressPool{store: NewMemoryAddressStore()},
+		invoices:  NewMemoryInvoiceStore(),
+		reviews:   NewReviewQueue(),
+		memos:     NewMemoryMemoStore(),
+		bands:     &ConfirmationBands{bands: make(map[string][]confirmationBand)},
+	}
+}
+
+func TestAssignMemoReserves(t *testing.T) {
+	cs := newMemoTestService()
+	invoice := &CryptoInvoice{PaymentID: "P1", Network: "XRP"}
+	if err := cs.assignMemo(invoice); err != nil {
+		t.Fatalf("分配标签失败: %v", err)
+	}
+	if ok, _ := cs.memos.Reserve("XRP", invoice.Memo, "P2"); ok {
+		t.Fatalf("已分配的标签 %s 可以被再次登记", invoice.Memo)
+	}
+}
+
+func TestAttributeTransferMemo(t *testing.T) {
+	const wallet = "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh"
+	cs := newMemoTestService()
+	expires := time.Now().Add(time.Hour)
+	for _, invoice := range []*CryptoInvoice{
+		{PaymentID: "P1", Currency: "XRP", Network: "XRP", Address: wallet, Memo: "100000001", Amount: 10, AmountExact: "10", Status: InvoicePending, ExpiresAt: expires},
+		{PaymentID: "P2", Currency: "XRP", Network: "XRP", Address: wallet, Memo: "100000002", Amount: 10, AmountExact: "10", Status: InvoicePending, ExpiresAt: expires},
+	} {
+		if err := cs.invoices.Save(invoice); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name, txHash, memo string
+		wantPayment        string
+		wantReview         bool
+	}{
+		{"标签匹配", "TX1", "100000002", "P2", false},
+		{"未携带标签", "TX2", "", "", true},
+		{"未知标签", "TX3", "999999999", "", true},
+		{"标签已付款", "TX4", "100000002", "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := cs.AttributeTransfer(&InboundTransfer{
+				TxHash: tc.txHash, Address: wallet, Currency: "XRP", Network: "XRP", Amount: 10, Memo: tc.memo,
+			})
+			if err != nil {
+				t.Fatalf("归属失败: %v", err)
+			}
+			if result.PaymentID != tc.wantPayment || (result.ReviewID != "") != tc.wantReview {
+				t.Fatalf("归属到 %q，复核 %q，预期归属到 %q，复核 %v", result.PaymentID, result.ReviewID, tc.wantPayment, tc.wantReview)
+			}
+		})
+	}
+
+	invoice, err := cs.invoices.Get("P1")
+	if err != nil || invoice.Status != InvoicePending {
+		t.Fatalf("其他标签的账单不应被归属: %+v %v", invoice, err)
+	}
+}
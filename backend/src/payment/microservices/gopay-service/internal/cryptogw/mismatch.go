@@ -0,0 +1,295 @@
+package cryptogw
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// 少付、多付的处理方式
+const (
+	ResolveTopUp  = "topup"  // 按差额生成补款账单，补款确认后原账单视为足额
+	ResolveAccept = "accept" // 按实际到账数量接受
+	ResolveRefund = "refund" // 多付的差额退还给用户
+)
+
+// AmountResolution 少付或多付账单的处理记录
+type AmountResolution struct {
+	Action         string    `json:"action"`
+	AmountDelta    string    `json:"amountDelta"`
+	TopUpPaymentID string    `json:"topUpPaymentId,omitempty"`
+	RefundID       string    `json:"refundId,omitempty"`
+	Operator       string    `json:"operator,omitempty"`
+	Note           string    `json:"note,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type ResolveAmountRequest struct {
+	Action        string `json:"action" binding:"required,oneof=topup accept refund"`
+	Operator      string `json:"operator"`      // 为空表示由收银台发起，只能申请补款
+	RefundAddress string `json:"refundAddress"` // 为空时退款单等待用户在收银台提供地址
+	Note          string `json:"note"`
+}
+
+// AmountResolutionResult 差额处理结果
+type AmountResolutionResult struct {
+	Payment *model.CryptoPaymentStatus `json:"payment"`
+	TopUp   *model.CryptoPayment       `json:"topUp,omitempty"`
+	Refund  *CryptoRefund              `json:"refund,omitempty"`
+}
+
+// expectedAmount 应付数量
+func (invoice *CryptoInvoice) expectedAmount() *big.Rat {
+	if exact, ok := new(big.Rat).SetString(invoice.AmountExact); ok {
+		return exact
+	}
+	return decimalRat(invoice.Amount)
+}
+
+// formatAmount 按链上精度格式化数量，去掉末尾的 0
+func formatAmount(amount *big.Rat, decimals int) string {
+	formatted := amount.FloatString(decimals)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// classifyAmount 按实际到账数量设置已归属账单的状态：容差范围内为确认中，否则记录差额并标记为少付或多付
+func (cs *CryptoService) classifyAmount(invoice *CryptoInvoice) {
+	invoice.Status = InvoiceConfirming
+	invoice.AmountDelta = ""
+	if cs.amountMatches(invoice.Amount, invoice.PaidAmount) {
+		return
+	}
+
+	asset := Asset{Currency: invoice.Currency, Network: invoice.Network}
+	delta := new(big.Rat).Sub(decimalRat(invoice.PaidAmount), invoice.expectedAmount())
+	invoice.AmountDelta = formatAmount(delta, asset.Decimals())
+	if delta.Sign() < 0 {
+		invoice.Status = InvoiceUnderpaid
+	} else {
+		invoice.Status = InvoiceOverpaid
+	}
+	log.Printf("【金额不符】账单 %s 应付 %s %s，实际到账 %v，差额 %s，等待处理", invoice.PaymentID,
+		invoice.AmountExact, asset, invoice.PaidAmount, invoice.AmountDelta)
+}
+
+// settleResolved 差额处理完毕的账单回到确认流程，入账已达到所需确认数时直接确认
+func settleResolved(invoice *CryptoInvoice, now time.Time) {
+	invoice.Status = InvoiceConfirming
+	// 付款方地址命中名单、尚无筛查结论或需旅行规则复核时留在确认中，由确认流程挂起或重新筛查
+	if invoice.RequiredConfirmations > 0 && invoice.Confirmations >= invoice.RequiredConfirmations && invoice.Screening.passed() && !invoice.TravelRule.pending() {
+		invoice.Status = InvoiceConfirmed
+		invoice.ConfirmedAt = now
+	}
+}
+
+// ResolveAmount 处理少付或多付的账单：
+// topup 按差额生成补款账单（与原账单同一收款地址，有效期 TOPUP_EXPIRE_MINUTES），补款确认后原账单视为足额，收银台可直接发起；
+// accept 按实际到账数量接受；refund 为多付的差额创建退款单，原账单按应付数量继续确认，未提供退款地址时由用户在收银台填写。
+// 后两者须由运营人员操作
+func (cs *CryptoService) ResolveAmount(paymentID string, req *ResolveAmountRequest) (*apierr.Response, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoice, err := cs.invoices.Get(paymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if invoice.Status != InvoiceUnderpaid && invoice.Status != InvoiceOverpaid {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("账单状态 %s 无需处理差额", invoice.Status)), nil
+	}
+	if req.Action != ResolveTopUp && req.Operator == "" {
+		return apierr.ErrorResponse("INVALID_PARAMS", "接受差额或退款须由运营人员操作，operator 不能为空"), nil
+	}
+
+	now := time.Now()
+	resolution := &AmountResolution{
+		Action:      req.Action,
+		AmountDelta: invoice.AmountDelta,
+		Operator:    req.Operator,
+		Note:        req.Note,
+		CreatedAt:   now,
+	}
+	result := &AmountResolutionResult{}
+	switch req.Action {
+	case ResolveTopUp:
+		if invoice.Status != InvoiceUnderpaid {
+			return apierr.ErrorResponse("INVALID_STATE", "只有少付的账单可以补款"), nil
+		}
+		topUp, err := cs.topUpInvoice(invoice, now)
+		if err != nil {
+			return nil, err
+		}
+		resolution.TopUpPaymentID = topUp.PaymentID
+		invoice.TopUpPaymentID = topUp.PaymentID
+		result.TopUp = quotedPayment(topUp)
+	case ResolveAccept:
+		if err := cs.expireTopUp(invoice, now); err != nil {
+			return nil, err
+		}
+		settleResolved(invoice, now)
+	case ResolveRefund:
+		if invoice.Status != InvoiceOverpaid {
+			return apierr.ErrorResponse("INVALID_STATE", "只有多付的账单可以退款"), nil
+		}
+		if req.RefundAddress != "" {
+			if err := cs.addresses.wallet.ValidateAddress(invoice.Network, req.RefundAddress); err != nil {
+				return apierr.ErrorResponse("INVALID_ADDRESS", err.Error()), nil
+			}
+		}
+		excess := new(big.Rat).Sub(decimalRat(invoice.PaidAmount), invoice.expectedAmount())
+		refund := newRefund(invoice, RefundOverpayment, excess, req.RefundAddress, req.Operator, now)
+		cs.refunds.Save(refund)
+		resolution.RefundID = refund.RefundID
+		result.Refund = refund
+		settleResolved(invoice, now)
+		log.Printf("账单 %s 多付 %s %s，已创建退款 %s", invoice.PaymentID, refund.AmountExact, Asset{Currency: invoice.Currency, Network: invoice.Network}, refund.RefundID)
+	}
+
+	invoice.Resolution = resolution
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, err
+	}
+	operator := req.Operator
+	if operator == "" {
+		operator = "收银台"
+	}
+	log.Printf("账单 %s 差额 %s 处理方式: %s，操作人 %s", invoice.PaymentID, invoice.AmountDelta, req.Action, operator)
+	result.Payment = paymentStatus(invoice)
+	return apierr.SuccessResponse(result), nil
+}
+
+// topUpInvoice 按少付差额生成补款账单，收款地址和派生路径与原账单相同（Solana 账单使用新的参考公钥）；
+// 已有未过期的补款账单时直接返回
+func (cs *CryptoService) topUpInvoice(invoice *CryptoInvoice, now time.Time) (*CryptoInvoice, error) {
+	if invoice.TopUpPaymentID != "" {
+		existing, err := cs.invoices.Get(invoice.TopUpPaymentID)
+		if err != nil && !errors.Is(err, ErrInvoiceNotFound) {
+			return nil, err
+		}
+		if err == nil && existing.Status == InvoicePending && now.Before(existing.ExpiresAt) {
+			return existing, nil
+		}
+	}
+
+	asset := Asset{Currency: invoice.Currency, Network: invoice.Network}
+	amount := NewCryptoAmount(new(big.Rat).Sub(invoice.expectedAmount(), decimalRat(invoice.PaidAmount)), asset)
+	topUp := &CryptoInvoice{
+		PaymentID:       fmt.Sprintf("CRYPTO_%d_%s", now.UnixNano(), invoice.Currency),
+		OrderID:         invoice.OrderID,
+		UserID:          invoice.UserID,
+		Currency:        invoice.Currency,
+		Network:         invoice.Network,
+		Address:         invoice.Address,
+		DerivationPath:  invoice.DerivationPath,
+		DerivationIndex: invoice.DerivationIndex,
+		Amount:          amount.Value,
+		AmountExact:     amount.Exact,
+		BandRate:        invoice.BandRate,
+		Status:          InvoicePending,
+		ParentPaymentID: invoice.PaymentID,
+		Metadata:        invoice.Metadata,
+		ExpiresAt:       now.Add(time.Duration(envInt("TOPUP_EXPIRE_MINUTES", 60)) * time.Minute),
+	}
+	if invoice.Reference != "" {
+		reference, err := newSolanaReference()
+		if err != nil {
+			return nil, err
+		}
+		topUp.Reference = reference
+	}
+	if invoice.Memo != "" {
+		if err := cs.assignMemo(topUp); err != nil {
+			return nil, err
+		}
+	}
+	if err := cs.invoices.Save(topUp); err != nil {
+		return nil, err
+	}
+	log.Printf("账单 %s 少付，已生成补款账单 %s，应补 %s %s", invoice.PaymentID, topUp.PaymentID, amount.Exact, asset)
+	return topUp, nil
+}
+
+// expireTopUp 接受少付后，尚未付款的补款账单立即过期，收银台不再展示
+func (cs *CryptoService) expireTopUp(invoice *CryptoInvoice, now time.Time) error {
+	if invoice.TopUpPaymentID == "" {
+		return nil
+	}
+	topUp, err := cs.invoices.Get(invoice.TopUpPaymentID)
+	if err != nil || topUp.Status != InvoicePending || !now.Before(topUp.ExpiresAt) {
+		return nil
+	}
+	topUp.ExpiresAt = now
+	return cs.invoices.Save(topUp)
+}
+
+// settleTopUpParent 补款账单确认后，少付的原账单视为足额回到确认流程。调用方持有归属锁
+func (cs *CryptoService) settleTopUpParent(topUp *CryptoInvoice, now time.Time) (*ConfirmationUpdate, error) {
+	parent, err := cs.invoices.Get(topUp.ParentPaymentID)
+	if errors.Is(err, ErrInvoiceNotFound) {
+		return nil, nil
+	}
+	if err != nil || parent.Status != InvoiceUnderpaid {
+		return nil, err
+	}
+	settleResolved(parent, now)
+	if err := cs.invoices.Save(parent); err != nil {
+		return nil, err
+	}
+	log.Printf("账单 %s 的补款账单 %s 已确认，原账单视为足额", parent.PaymentID, topUp.PaymentID)
+	return &ConfirmationUpdate{Invoice: parent, Event: "topup_confirmed"}, nil
+}
+
+// registerAmountResolutionRoutes 注册少付、多付处理接口，收银台申请补款，运营接受差额或退还多付部分
+func registerAmountResolutionRoutes(api *gin.RouterGroup, cs *CryptoService, hub *CheckoutHub) {
+	api.POST("/crypto/payment/:paymentId/resolve-amount", func(c *gin.Context) {
+		var req ResolveAmountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := cs.ResolveAmount(c.Param("paymentId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if result, ok := resp.Data.(*AmountResolutionResult); ok {
+			if result.TopUp != nil {
+				hub.Publish(result.Payment.PaymentID, CheckoutEvent{Type: "topup_requested", Data: result.TopUp})
+			} else {
+				hub.Publish(result.Payment.PaymentID, CheckoutEvent{Type: "amount_resolved", Data: result.Payment})
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin := api.Group("/crypto/admin")
+
+	// 待处理的少付、多付账单
+	admin.GET("/amount-mismatches", func(c *gin.Context) {
+		invoices, err := cs.invoices.List()
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		mismatched := make([]*CryptoInvoice, 0)
+		for _, invoice := range invoices {
+			if invoice.Status == InvoiceUnderpaid || invoice.Status == InvoiceOverpaid {
+				mismatched = append(mismatched, invoice)
+			}
+		}
+		apierr.RespondOK(c, mismatched)
+	})
+}
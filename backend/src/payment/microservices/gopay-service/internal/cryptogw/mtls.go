@@ -0,0 +1,24 @@
+package cryptogw
+
+import (
+	"os"
+
+	"gopay-service/internal/httpmw"
+)
+
+// createPaths 需要客户端证书的下单接口，网关没有退款接口
+var createPaths = []string{"/api/v1/crypto/payment/create"}
+
+// newClientCertAuth 按 MTLS_CREATE_CLIENTS 限制可调用下单接口的内部服务，未配置时不做限制；
+// 按 MTLS_SCANNER_CLIENTS 限制可上报入账的外部监听服务，未配置时由 ScannerAuth 按请求签名校验
+func newClientCertAuth() *httpmw.ClientCertAuth {
+	return httpmw.NewClientCertAuth(httpmw.CertPolicy{
+		Name:     "create",
+		Paths:    createPaths,
+		Services: splitList(os.Getenv("MTLS_CREATE_CLIENTS")),
+	}, httpmw.CertPolicy{
+		Name:     "scanner",
+		Paths:    scannerPaths,
+		Services: splitList(os.Getenv("MTLS_SCANNER_CLIENTS")),
+	})
+}
@@ -0,0 +1,185 @@
+package cryptogw
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+
+	"gopay-service/internal/apierr"
+)
+
+// 二维码图片格式
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+)
+
+// 二维码边长的取值范围（像素）
+const (
+	qrMinSize = 64
+	qrMaxSize = 1024
+)
+
+var errQRFormat = errors.New("二维码格式只支持 png 和 svg")
+
+// paymentLabel 付款链接中展示给付款人的收款方名称
+func paymentLabel() string {
+	return envString("CRYPTO_PAY_LABEL", "OnlineStore")
+}
+
+// paymentURI 钱包可直接识别的付款链接，携带收款地址、应付数量和代币合约：
+// BTC 按 BIP21（bitcoin:地址?amount=），EVM 链按 EIP-681，原生币为 ethereum:地址@链ID?value=，
+// 代币为 ethereum:合约@链ID/transfer?address=地址&uint256=数量；TRC20 没有统一标准，
+// 采用 TronLink 等钱包识别的 tron:地址?token=合约&amount=；Solana 为 Solana Pay 转账请求（见 solanaPayURL），
+// XRP、Stellar、TON 带上账单标签（见 memoPaymentURI）。
+// 链 ID 和合约地址与监听使用同一组配置（<前缀>_CHAIN_ID、代币登记表），
+// 代币未登记时返回空串，二维码退回只含收款地址
+func paymentURI(invoice *CryptoInvoice, amount CryptoAmount) string {
+	asset := Asset{Currency: invoice.Currency, Network: invoice.Network}
+	switch {
+	case invoice.Reference != "":
+		return solanaPayURL(invoice)
+	case invoice.Memo != "":
+		return memoPaymentURI(invoice, amount)
+	case asset.Network == "BTC":
+		query := url.Values{}
+		query.Set("amount", amount.Exact)
+		query.Set("label", paymentLabel())
+		query.Set("message", fmt.Sprintf("订单 %s", invoice.OrderID))
+		// BIP21 按 RFC 3986 解码，空格不能编码为 +
+		return "bitcoin:" + invoice.Address + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+	case asset.Network == "TRC20":
+		token, ok := tokenRegistry.Lookup(asset)
+		if !ok {
+			return ""
+		}
+		query := url.Values{}
+		query.Set("token", token.Contract)
+		query.Set("amount", amount.Exact)
+		return "tron:" + invoice.Address + "?" + query.Encode()
+	}
+
+	chain, ok := evmChains[asset.Network]
+	if !ok {
+		return ""
+	}
+	chainID := strconv.Itoa(envInt(chain.EnvPrefix+"_CHAIN_ID", int(chain.ChainID)))
+	if asset.Currency == chain.Native {
+		return fmt.Sprintf("ethereum:%s@%s?value=%s", invoice.Address, chainID, amount.BaseUnits)
+	}
+	token, ok := tokenRegistry.Lookup(asset)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("ethereum:%s@%s/transfer?address=%s&uint256=%s", token.Contract, chainID, invoice.Address, amount.BaseUnits)
+}
+
+// qrCodeContent 二维码编码的内容，没有付款链接时只编码收款地址
+func qrCodeContent(invoice *CryptoInvoice, amount CryptoAmount) string {
+	if uri := paymentURI(invoice, amount); uri != "" {
+		return uri
+	}
+	return invoice.Address
+}
+
+// qrRecoveryLevel CRYPTO_QR_RECOVERY 纠错等级（low、medium、high、highest，默认 medium），
+// 等级越高越耐污损，但同样边长下模块更密
+func qrRecoveryLevel() qrcode.RecoveryLevel {
+	switch strings.ToLower(envString("CRYPTO_QR_RECOVERY", "medium")) {
+	case "low":
+		return qrcode.Low
+	case "high":
+		return qrcode.High
+	case "highest":
+		return qrcode.Highest
+	default:
+		return qrcode.Medium
+	}
+}
+
+// renderQRCode 生成二维码图片，size 为边长（像素），返回图片内容和 Content-Type
+func renderQRCode(content, format string, size int) ([]byte, string, error) {
+	size = min(max(size, qrMinSize), qrMaxSize)
+	code, err := qrcode.New(content, qrRecoveryLevel())
+	if err != nil {
+		return nil, "", err
+	}
+	switch strings.ToLower(format) {
+	case QRFormatPNG:
+		png, err := code.PNG(size)
+		return png, "image/png", err
+	case QRFormatSVG:
+		return qrSVG(code.Bitmap(), size), "image/svg+xml", nil
+	default:
+		return nil, "", errQRFormat
+	}
+}
+
+// qrSVG 每个深色模块画成一个单位方格，由 viewBox 缩放到指定边长，任意缩放都不模糊
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, len(bitmap), len(bitmap))
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`, path.String())
+	return svg.Bytes()
+}
+
+// qrCodeDataURI 下单和重新报价返回的二维码，格式和边长取 CRYPTO_QR_FORMAT（png 或 svg，默认 png）
+// 和 CRYPTO_QR_SIZE（默认 256 像素）。生成失败不影响下单，只记录日志并返回空串
+func qrCodeDataURI(invoice *CryptoInvoice, amount CryptoAmount) string {
+	image, contentType, err := renderQRCode(qrCodeContent(invoice, amount), envString("CRYPTO_QR_FORMAT", QRFormatPNG), envInt("CRYPTO_QR_SIZE", 256))
+	if err != nil {
+		log.Printf("【警告】生成账单 %s 的二维码失败: %v", invoice.PaymentID, err)
+		return ""
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image)
+}
+
+// registerQRCodeRoutes 注册二维码图片接口，收银台可直接作为 <img> 的地址，按需指定 format 和 size
+func registerQRCodeRoutes(api *gin.RouterGroup, cs *CryptoService) {
+	api.GET("/crypto/payment/:paymentId/qr", func(c *gin.Context) {
+		invoice, err := cs.invoices.Get(c.Param("paymentId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", err.Error())
+			return
+		}
+
+		size := envInt("CRYPTO_QR_SIZE", 256)
+		if raw := c.Query("size"); raw != "" {
+			if size, err = strconv.Atoi(raw); err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "size 必须是整数")
+				return
+			}
+		}
+		amount := NewCryptoAmount(invoice.expectedAmount(), Asset{Currency: invoice.Currency, Network: invoice.Network})
+		image, contentType, err := renderQRCode(qrCodeContent(invoice, amount), c.DefaultQuery("format", envString("CRYPTO_QR_FORMAT", QRFormatPNG)), size)
+		if errors.Is(err, errQRFormat) {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, contentType, image)
+	})
+}
@@ -0,0 +1,107 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// queueTable 退款队列、归集台账、合规复核和人工复核队列的持久化，表结构见 migrations/00007_crypto_queues.sql。
+// 队列启动时从表中载入全部记录，之后读取走内存，每次保存同步写回表中
+type queueTable struct {
+	db    *sql.DB
+	table string
+}
+
+// save 写回一条记录。队列的保存接口不返回错误，写入失败只记录日志，内存中的状态仍然有效，下次保存时再次写回
+func (t *queueTable) save(id, status string, createdAt, updatedAt time.Time, record any) {
+	if t == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = t.db.Exec(`INSERT INTO `+t.table+` (id, status, created_at, updated_at, data) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at, data = excluded.data`,
+			id, status, createdAt.UnixNano(), updatedAt.UnixNano(), data)
+	}
+	if err != nil {
+		log.Printf("【警告】保存 %s 记录 %s 失败: %v", t.table, id, err)
+	}
+}
+
+// loadQueue 按创建时间顺序读出表中的全部记录
+func loadQueue[T any](t *queueTable) ([]*T, error) {
+	rows, err := t.db.Query(`SELECT data FROM ` + t.table + ` ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*T
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		record := new(T)
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, fmt.Errorf("解析 %s 记录失败: %w", t.table, err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func NewSQLiteRefundQueue(db *sql.DB) (*RefundQueue, error) {
+	q := NewRefundQueue()
+	q.table = &queueTable{db: db, table: "crypto_refunds"}
+	refunds, err := loadQueue[CryptoRefund](q.table)
+	if err != nil {
+		return nil, err
+	}
+	for _, refund := range refunds {
+		q.refunds[refund.RefundID] = refund
+	}
+	return q, nil
+}
+
+func NewSQLiteSweepLedger(db *sql.DB) (*SweepLedger, error) {
+	l := NewSweepLedger()
+	l.table = &queueTable{db: db, table: "crypto_sweeps"}
+	sweeps, err := loadQueue[SweepRecord](l.table)
+	if err != nil {
+		return nil, err
+	}
+	for _, sweep := range sweeps {
+		l.sweeps[sweep.SweepID] = sweep
+	}
+	return l, nil
+}
+
+func NewSQLiteComplianceQueue(db *sql.DB) (*ComplianceQueue, error) {
+	q := NewComplianceQueue()
+	q.table = &queueTable{db: db, table: "crypto_compliance_cases"}
+	cases, err := loadQueue[ComplianceCase](q.table)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range cases {
+		q.cases[item.CaseID] = item
+	}
+	return q, nil
+}
+
+func NewSQLiteReviewQueue(db *sql.DB) (*ReviewQueue, error) {
+	q := NewReviewQueue()
+	q.table = &queueTable{db: db, table: "crypto_reviews"}
+	items, err := loadQueue[ReviewItem](q.table)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		q.items[item.ReviewID] = item
+	}
+	return q, nil
+}
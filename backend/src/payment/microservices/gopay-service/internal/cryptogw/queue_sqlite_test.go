@@ -0,0 +1,67 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openQueueTestDB 内存数据库，只建 00007 迁移中的表
+func openQueueTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	migration, err := os.ReadFile("../../migrations/00007_crypto_queues.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+	if _, err := db.Exec(up); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestSQLiteStoresReload 重新打开存储后，账单和各队列的记录与保存时一致
+func TestSQLiteStoresReload(t *testing.T) {
+	db := openQueueTestDB(t)
+	stores, err := NewSQLiteStores(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stores.Invoices.Save(&CryptoInvoice{PaymentID: "P1", Currency: "USDT", Network: "TRC20", AmountExact: "10.5", Status: InvoicePending}); err != nil {
+		t.Fatal(err)
+	}
+	stores.Refunds.Save(&CryptoRefund{RefundID: "R1", PaymentID: "P1", AmountExact: "10.5", Status: RefundAwaitingAddress})
+	stores.Sweeps.Save(&SweepRecord{SweepID: "S1", Network: "TRC20", Amount: "100", Status: SweepBroadcast, Sources: []SweepSource{{Address: "T1"}}})
+	caseID := stores.Compliance.Open(&ComplianceCase{PaymentID: "P1", Reason: "命中制裁名单"})
+	stores.Reviews.Add(&ReviewItem{ReviewID: "RV1", Transfer: InboundTransfer{TxHash: "TX1"}, Status: ReviewOpen})
+
+	reloaded, err := NewSQLiteStores(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice, err := reloaded.Invoices.Get("P1"); err != nil || invoice.AmountExact != "10.5" {
+		t.Errorf("账单 %+v %v", invoice, err)
+	}
+	if refund, err := reloaded.Refunds.Get("R1"); err != nil || refund.Status != RefundAwaitingAddress {
+		t.Errorf("退款单 %+v %v", refund, err)
+	}
+	if sweep, err := reloaded.Sweeps.Get("S1"); err != nil || len(sweep.Sources) != 1 {
+		t.Errorf("归集 %+v %v", sweep, err)
+	}
+	if item, err := reloaded.Compliance.Get(caseID); err != nil || item.Status != CaseOpen {
+		t.Errorf("合规复核单 %+v %v", item, err)
+	}
+	if item := reloaded.Reviews.FindByTx("TX1"); item == nil || item.ReviewID != "RV1" {
+		t.Errorf("人工复核单 %+v", item)
+	}
+}
@@ -0,0 +1,136 @@
+package cryptogw
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"gopay-service/internal/rates"
+)
+
+// nativeDecimals 原生币链上最小单位的小数位数，代币的精度见 TokenRegistry
+var nativeDecimals = map[string]int{
+	"BTC_BTC":   8,
+	"ETH_ERC20": 18,
+	"XRP_XRP":   6,
+	"XLM_XLM":   7,
+	"TON_TON":   9,
+}
+
+// quoteDecimals 报价保留的小数位数，不超过链上精度。18 位精度的币种报价只保留 8 位，便于用户在钱包中输入
+var quoteDecimals = map[string]int{
+	"USDT": 6,
+	"USDC": 6,
+	"BTC":  8,
+	"ETH":  8,
+	"XRP":  6,
+	"XLM":  7,
+	"TON":  9,
+}
+
+// Decimals 链上最小单位的小数位数，同一币种在不同链上的合约精度可能不同
+func (a Asset) Decimals() int {
+	if token, ok := tokenRegistry.Lookup(a); ok {
+		return token.Decimals
+	}
+	return nativeDecimals[a.Key()]
+}
+
+// QuoteDecimals 报价金额的小数位数
+func (a Asset) QuoteDecimals() int {
+	return min(quoteDecimals[a.Currency], a.Decimals())
+}
+
+// CryptoAmount 应付的加密货币数量
+type CryptoAmount struct {
+	Value     float64 // 仅用于展示和容差比较
+	Exact     string  // 按报价精度格式化的十进制数量，如 "14.084508"
+	BaseUnits string  // 链上最小单位的数量，如 USDT-TRC20 的 14084508
+}
+
+// NewCryptoAmount 按报价精度向上取整，宁可多收一个最小单位也不少收
+func NewCryptoAmount(amount *big.Rat, asset Asset) CryptoAmount {
+	qd := asset.QuoteDecimals()
+	scaled := new(big.Rat).Mul(amount, new(big.Rat).SetInt(pow10(qd)))
+	units, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		units.Add(units, big.NewInt(1))
+	}
+
+	exact := new(big.Rat).SetFrac(units, pow10(qd)).FloatString(qd)
+	value, _ := strconv.ParseFloat(exact, 64)
+	return CryptoAmount{
+		Value:     value,
+		Exact:     exact,
+		BaseUnits: new(big.Int).Mul(units, pow10(asset.Decimals()-qd)).String(),
+	}
+}
+
+// convertFiat 按汇率将法币金额换算为加密货币数量，rate 为 1 单位加密货币折合的法币
+func convertFiat(fiatAmount, rate float64, asset Asset) (CryptoAmount, error) {
+	if rate <= 0 {
+		return CryptoAmount{}, fmt.Errorf("汇率无效: %v", rate)
+	}
+	amount := new(big.Rat).Quo(decimalRat(fiatAmount), decimalRat(rate))
+	return NewCryptoAmount(amount, asset), nil
+}
+
+// quoteFiat 查询当前汇率并换算应付数量
+func (cs *CryptoService) quoteFiat(asset Asset, fiatCurrency string, fiatAmount float64) (*rates.Quote, CryptoAmount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	quote, err := cs.rates.Get(ctx, asset.Currency, fiatCurrency)
+	if err != nil {
+		return nil, CryptoAmount{}, err
+	}
+	amount, err := convertFiat(fiatAmount, quote.Rate, asset)
+	if err != nil {
+		return nil, CryptoAmount{}, err
+	}
+	return quote, amount, nil
+}
+
+// valuationRate 1 单位账单币种折合 currency 的汇率，按该法币下单时取锁定汇率
+func (cs *CryptoService) valuationRate(invoice *CryptoInvoice, asset Asset, currency string) (float64, error) {
+	if invoice.LockedRate > 0 && invoice.FiatCurrency == currency {
+		return invoice.LockedRate, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	quote, err := cs.rates.Get(ctx, asset.Currency, currency)
+	if err != nil {
+		return 0, err
+	}
+	return quote.Rate, nil
+}
+
+// unitsToAmount 链上最小单位的数量换算为币种数量
+func unitsToAmount(units *big.Int, decimals int) float64 {
+	value, _ := new(big.Rat).SetFrac(units, pow10(decimals)).Float64()
+	return value
+}
+
+// decimalUnits 十进制表示的数量（如 Horizon 返回的 "10.0000000"）换算为链上最小单位
+func decimalUnits(amount string, decimals int) (*big.Int, error) {
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("数量无效: %s", amount)
+	}
+	scaled := value.Mul(value, new(big.Rat).SetInt(pow10(decimals)))
+	if !scaled.IsInt() {
+		return nil, fmt.Errorf("数量 %s 超出链上精度", amount)
+	}
+	return scaled.Num(), nil
+}
+
+// decimalRat 按 float64 的最短十进制表示转换，避免 0.1 这类金额带入二进制误差
+func decimalRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,542 @@
+package cryptogw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 退款状态
+const (
+	RefundAwaitingAddress = "awaiting_address" // 等待用户在收银台提供退款地址
+	RefundQueued          = "queued"           // 等待运营人员从热钱包发送，未配置热钱包的链由财务手工转出后登记
+	RefundBroadcast       = "broadcast"        // 退款交易已广播，跟踪确认数
+	RefundConfirmed       = "confirmed"        // 退款交易达到所需确认数
+	RefundFailed          = "failed"           // 发送失败或交易未能上链，可重新发送
+	RefundHeld            = "held"             // 退款地址命中制裁名单或 KYT 高风险，等待合规复核
+	RefundRejected        = "rejected"         // 合规复核拒绝，不再发送
+)
+
+// 退款原因
+const (
+	RefundOverpayment    = "overpayment"     // 多付差额
+	RefundLatePayment    = "late_payment"    // 锁定汇率过期后付款，商户不接受
+	RefundOrderCancelled = "order_cancelled" // 订单取消
+)
+
+var ErrRefundNotFound = errors.New("退款单不存在")
+
+// CryptoRefund 链上退款单
+type CryptoRefund struct {
+	RefundID              string     `json:"refundId"`
+	PaymentID             string     `json:"paymentId"`
+	Reason                string     `json:"reason"`
+	Currency              string     `json:"currency"`
+	Network               string     `json:"network"`
+	Amount                float64    `json:"amount"`
+	AmountExact           string     `json:"amountExact"`
+	ToAddress             string     `json:"toAddress"`
+	Status                string     `json:"status"`
+	Operator              string     `json:"operator,omitempty"`
+	FromAddress           string     `json:"fromAddress,omitempty"` // 转出的热钱包地址
+	TxHash                string     `json:"txHash,omitempty"`
+	Nonce                 *uint64    `json:"nonce,omitempty"`  // EVM 退款交易的 nonce，重发时沿用
+	Inputs                []string   `json:"inputs,omitempty"` // 比特币退款交易花费的输出（txid:vout），重发时沿用
+	Fee                   string     `json:"fee,omitempty"`    // 网络费，EVM 为按 gas 上限计算的最高值，以原生币计
+	BlockHeight           int64      `json:"blockHeight,omitempty"`
+	Confirmations         int        `json:"confirmations,omitempty"`
+	RequiredConfirmations int        `json:"requiredConfirmations,omitempty"`
+	MissingSince          time.Time  `json:"missingSince,omitempty"` // 退款交易既不在链上也不在交易池的起始时间
+	Error                 string     `json:"error,omitempty"`        // 最近一次发送或跟踪失败的原因
+	Screening             *Screening `json:"screening,omitempty"`    // 退款地址的制裁名单和 KYT 筛查结果
+	SentBy                string     `json:"sentBy,omitempty"`
+	BroadcastAt           time.Time  `json:"broadcastAt,omitempty"`
+	ConfirmedAt           time.Time  `json:"confirmedAt,omitempty"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
+}
+
+// units 退款数量，以链上最小单位计
+func (refund *CryptoRefund) units() (*big.Int, error) {
+	amount, ok := new(big.Rat).SetString(refund.AmountExact)
+	if !ok || amount.Sign() <= 0 {
+		return nil, fmt.Errorf("退款数量无效: %s", refund.AmountExact)
+	}
+	scaled := amount.Mul(amount, new(big.Rat).SetInt(pow10(Asset{Currency: refund.Currency, Network: refund.Network}.Decimals())))
+	if !scaled.IsInt() {
+		return nil, fmt.Errorf("退款数量 %s 超出链上精度", refund.AmountExact)
+	}
+	return scaled.Num(), nil
+}
+
+// customerView 返回给收银台的退款单，不含操作人、热钱包输入和失败原因等内部信息
+func (refund *CryptoRefund) customerView() *CryptoRefund {
+	copied := *refund
+	copied.Operator, copied.SentBy, copied.Error = "", "", ""
+	copied.Nonce, copied.Inputs, copied.Fee = nil, nil, ""
+	copied.Screening = nil
+	return &copied
+}
+
+// RefundQueue 退款队列
+type RefundQueue struct {
+	mu      sync.RWMutex
+	refunds map[string]*CryptoRefund
+	table   *queueTable // 为 nil 时只保存在内存中
+}
+
+func NewRefundQueue() *RefundQueue {
+	return &RefundQueue{refunds: make(map[string]*CryptoRefund)}
+}
+
+func (q *RefundQueue) Save(refund *CryptoRefund) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = now
+	}
+	refund.UpdatedAt = now
+	copied := *refund
+	q.refunds[refund.RefundID] = &copied
+	q.table.save(refund.RefundID, refund.Status, refund.CreatedAt, refund.UpdatedAt, refund)
+}
+
+func (q *RefundQueue) Get(refundID string) (*CryptoRefund, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	refund, ok := q.refunds[refundID]
+	if !ok {
+		return nil, ErrRefundNotFound
+	}
+	copied := *refund
+	return &copied, nil
+}
+
+// List 按创建时间顺序返回指定状态的退款单，status 为空时返回全部
+func (q *RefundQueue) List(status string) []*CryptoRefund {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var refunds []*CryptoRefund
+	for _, refund := range q.refunds {
+		if status == "" || refund.Status == status {
+			copied := *refund
+			refunds = append(refunds, &copied)
+		}
+	}
+	sort.Slice(refunds, func(i, j int) bool {
+		return refunds[i].CreatedAt.Before(refunds[j].CreatedAt)
+	})
+	return refunds
+}
+
+// newRefund 为账单创建退款单，未提供退款地址时等待用户在收银台填写
+func newRefund(invoice *CryptoInvoice, reason string, amount *big.Rat, toAddress, operator string, now time.Time) *CryptoRefund {
+	asset := Asset{Currency: invoice.Currency, Network: invoice.Network}
+	exact := formatAmount(amount, asset.Decimals())
+	value, _ := strconv.ParseFloat(exact, 64)
+	refund := &CryptoRefund{
+		RefundID:    fmt.Sprintf("RF%d", now.UnixNano()),
+		PaymentID:   invoice.PaymentID,
+		Reason:      reason,
+		Currency:    invoice.Currency,
+		Network:     invoice.Network,
+		Amount:      value,
+		AmountExact: exact,
+		ToAddress:   toAddress,
+		Status:      RefundQueued,
+		Operator:    operator,
+	}
+	if toAddress == "" {
+		refund.Status = RefundAwaitingAddress
+	}
+	return refund
+}
+
+type CreateRefundRequest struct {
+	PaymentID     string `json:"paymentId" binding:"required"`
+	Amount        string `json:"amount"` // 为空时退还实际到账数量中尚未退款的部分
+	Reason        string `json:"reason" binding:"required,oneof=late_payment order_cancelled"`
+	RefundAddress string `json:"refundAddress"` // 为空时等待用户在收银台提供
+	Operator      string `json:"operator"`      // 启用管理接口认证时取访问令牌中的用户名
+}
+
+// CreateRefund 为已确认的账单创建退款单，累计退款不超过实际到账数量。多付差额的退款见 ResolveAmount
+func (cs *CryptoService) CreateRefund(req *CreateRefundRequest) (*apierr.Response, error) {
+	cs.refundMu.Lock()
+	defer cs.refundMu.Unlock()
+
+	invoice, err := cs.invoices.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if invoice.Status != InvoiceConfirmed || invoice.PaidAmount <= 0 {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("账单状态 %s 不能退款，只有入账已确认的账单可以退款", invoice.Status)), nil
+	}
+	if req.RefundAddress != "" {
+		if err := cs.addresses.wallet.ValidateAddress(invoice.Network, req.RefundAddress); err != nil {
+			return apierr.ErrorResponse("INVALID_ADDRESS", err.Error()), nil
+		}
+	}
+
+	refundable := decimalRat(invoice.PaidAmount)
+	for _, existing := range cs.refunds.List("") {
+		if existing.PaymentID != invoice.PaymentID {
+			continue
+		}
+		if amount, ok := new(big.Rat).SetString(existing.AmountExact); ok {
+			refundable.Sub(refundable, amount)
+		}
+	}
+	amount := refundable
+	if req.Amount != "" {
+		var ok bool
+		if amount, ok = new(big.Rat).SetString(req.Amount); !ok || amount.Sign() <= 0 {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("amount 无效: %s", req.Amount)), nil
+		}
+	}
+	decimals := Asset{Currency: invoice.Currency, Network: invoice.Network}.Decimals()
+	if refundable.Sign() <= 0 || amount.Cmp(refundable) > 0 {
+		return apierr.ErrorResponse("AMOUNT_EXCEEDED", fmt.Sprintf("可退款数量为 %s", formatAmount(refundable, decimals))), nil
+	}
+
+	refund := newRefund(invoice, req.Reason, amount, req.RefundAddress, req.Operator, time.Now())
+	cs.refunds.Save(refund)
+	log.Printf("账单 %s 创建退款 %s: %s %s，原因 %s，操作人 %s", invoice.PaymentID, refund.RefundID, refund.AmountExact, refund.Currency, refund.Reason, req.Operator)
+	return apierr.SuccessResponse(refund), nil
+}
+
+// SubmitRefundAddress 用户提供退款地址，只能填写一次，之后由运营人员发送
+func (cs *CryptoService) SubmitRefundAddress(refundID, address string) (*apierr.Response, error) {
+	cs.refundMu.Lock()
+	defer cs.refundMu.Unlock()
+
+	refund, err := cs.refunds.Get(refundID)
+	if err != nil {
+		return apierr.ErrorResponse("REFUND_NOT_FOUND", err.Error()), nil
+	}
+	if refund.Status != RefundAwaitingAddress {
+		return apierr.ErrorResponse("INVALID_STATE", "退款地址已提供，不能修改"), nil
+	}
+	address = strings.TrimSpace(address)
+	if err := cs.addresses.wallet.ValidateAddress(refund.Network, address); err != nil {
+		return apierr.ErrorResponse("INVALID_ADDRESS", err.Error()), nil
+	}
+	refund.ToAddress = address
+	refund.Status = RefundQueued
+	cs.refunds.Save(refund)
+	log.Printf("退款 %s 已收到退款地址 %s", refundID, address)
+	return apierr.SuccessResponse(refund.customerView()), nil
+}
+
+// SendRefund 从热钱包签名并广播退款交易。发送前筛查退款地址，命中名单时挂起转合规复核；
+// 重新发送失败的退款前先核实原交易：仍在链上或交易池时继续跟踪，不再发送
+func (cs *CryptoService) SendRefund(ctx context.Context, refundID, operator string) (*apierr.Response, error) {
+	cs.refundMu.Lock()
+	defer cs.refundMu.Unlock()
+
+	refund, err := cs.refunds.Get(refundID)
+	if err != nil {
+		return apierr.ErrorResponse("REFUND_NOT_FOUND", err.Error()), nil
+	}
+	if refund.Status != RefundQueued && refund.Status != RefundFailed {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("退款状态 %s 不能发送", refund.Status)), nil
+	}
+	sender := cs.refundSender(refund.Network)
+	if sender == nil {
+		return apierr.ErrorResponse("REFUND_MANUAL", fmt.Sprintf("未配置 %s 退款热钱包，请从钱包手工转出后登记交易哈希", networkNames[refund.Network])), nil
+	}
+	if resp := cs.screenRefund(ctx, refund); resp != nil {
+		return resp, nil
+	}
+
+	if refund.TxHash != "" {
+		tx, err := cs.chainReader(refund.Network).FetchTx(ctx, refund.TxHash)
+		if err != nil {
+			return apierr.ErrorResponse("CHAIN_UNAVAILABLE", fmt.Sprintf("无法核实原退款交易 %s，请稍后重试: %v", refund.TxHash, err)), nil
+		}
+		if tx != nil && !tx.Failed {
+			markBroadcast(refund, operator)
+			cs.refunds.Save(refund)
+			log.Printf("退款 %s 的原交易 %s 仍在链上或交易池中，继续跟踪确认", refundID, refund.TxHash)
+			return apierr.SuccessResponse(refund), nil
+		}
+	}
+
+	txHash, err := sender.SendRefund(ctx, refund)
+	if err != nil && txHash == "" {
+		refund.Error = err.Error()
+		cs.refunds.Save(refund)
+		log.Printf("退款 %s 发送失败: %v", refundID, err)
+		return apierr.ErrorResponse("REFUND_SEND_FAILED", err.Error()), nil
+	}
+	markBroadcast(refund, operator)
+	if err != nil {
+		// 广播结果不确定，交易可能已进入交易池，由确认跟踪核实，长时间不在链上时标记失败
+		refund.Error = fmt.Sprintf("广播结果不确定: %v", err)
+		log.Printf("【警告】退款 %s 的交易 %s 广播结果不确定: %v", refundID, txHash, err)
+	}
+	cs.refunds.Save(refund)
+	log.Printf("退款 %s 已广播: %s %s 转至 %s，交易 %s，操作人 %s", refundID, refund.AmountExact, refund.Currency, refund.ToAddress, txHash, operator)
+	return apierr.SuccessResponse(refund), nil
+}
+
+type RecordRefundTxRequest struct {
+	TxHash   string `json:"txHash" binding:"required"`
+	Operator string `json:"operator"` // 启用管理接口认证时取访问令牌中的用户名
+}
+
+// RecordRefundTx 登记财务手工转出的退款交易，同样跟踪确认数，确认时核对转入退款地址的数量
+func (cs *CryptoService) RecordRefundTx(refundID string, req *RecordRefundTxRequest) (*apierr.Response, error) {
+	cs.refundMu.Lock()
+	defer cs.refundMu.Unlock()
+
+	refund, err := cs.refunds.Get(refundID)
+	if err != nil {
+		return apierr.ErrorResponse("REFUND_NOT_FOUND", err.Error()), nil
+	}
+	if refund.Status != RefundQueued && refund.Status != RefundFailed {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("退款状态 %s 不能登记交易", refund.Status)), nil
+	}
+	if !validTxHash(refund.Network, req.TxHash) {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不是有效的 %s 交易哈希: %s", networkNames[refund.Network], req.TxHash)), nil
+	}
+	refund.TxHash, refund.FromAddress = req.TxHash, ""
+	refund.Nonce, refund.Inputs, refund.Fee = nil, nil, ""
+	markBroadcast(refund, req.Operator)
+	cs.refunds.Save(refund)
+	log.Printf("退款 %s 登记手工转出的交易 %s，操作人 %s", refundID, req.TxHash, req.Operator)
+	return apierr.SuccessResponse(refund), nil
+}
+
+func markBroadcast(refund *CryptoRefund, operator string) {
+	refund.Status = RefundBroadcast
+	refund.SentBy = operator
+	refund.BroadcastAt = time.Now()
+	refund.Error = ""
+	refund.BlockHeight, refund.Confirmations = 0, 0
+	refund.RequiredConfirmations = requiredConfirmations(refund.Network)
+	refund.MissingSince = time.Time{}
+}
+
+// trackRefunds 随链上监听器的确认流程跟踪该网络已广播的退款交易：达到所需确认数且足额转入退款地址时确认，
+// 交易执行失败或超过 REORG_FAIL_AFTER 既不在链上也不在交易池时标记失败。返回状态有变化的退款单
+func (cs *CryptoService) trackRefunds(ctx context.Context, network string) []*ConfirmationUpdate {
+	reader := cs.chainReader(network)
+	if reader == nil {
+		return nil
+	}
+	var updates []*ConfirmationUpdate
+	for _, refund := range cs.refunds.List(RefundBroadcast) {
+		if refund.Network != network {
+			continue
+		}
+		tx, err := reader.FetchTx(ctx, refund.TxHash)
+		if err != nil {
+			log.Printf("查询退款交易 %s 失败: %v", refund.TxHash, err)
+			continue
+		}
+		if update := cs.applyRefundTx(refund.RefundID, tx); update != nil {
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+// applyRefundTx 在退款锁内重新读取退款单后按链上交易更新，避免覆盖同时进行的重新发送
+func (cs *CryptoService) applyRefundTx(refundID string, tx *ChainTx) *ConfirmationUpdate {
+	cs.refundMu.Lock()
+	defer cs.refundMu.Unlock()
+
+	refund, err := cs.refunds.Get(refundID)
+	if err != nil || refund.Status != RefundBroadcast {
+		return nil
+	}
+	previous := *refund
+	now := time.Now()
+	event := ""
+
+	switch {
+	case tx == nil:
+		refund.BlockHeight, refund.Confirmations = 0, 0
+		if refund.MissingSince.IsZero() {
+			refund.MissingSince = now
+		}
+		if now.Sub(refund.MissingSince) > envDuration("REORG_FAIL_AFTER", time.Hour) {
+			refund.Status = RefundFailed
+			refund.Error = fmt.Sprintf("退款交易自 %s 起不在链上或交易池中", refund.MissingSince.Format(time.RFC3339))
+		}
+	case tx.Failed:
+		refund.Status = RefundFailed
+		refund.Error = "退款交易执行失败"
+		// 执行失败的交易已占用 nonce，重发时重新分配
+		refund.Nonce = nil
+	default:
+		refund.MissingSince = time.Time{}
+		refund.BlockHeight, refund.Confirmations = tx.BlockHeight, 0
+		if tx.BlockHeight > 0 && tx.Head >= tx.BlockHeight {
+			refund.Confirmations = int(tx.Head-tx.BlockHeight) + 1
+		}
+		if refund.Confirmations < refund.RequiredConfirmations {
+			break
+		}
+		units, _ := refund.units()
+		received := new(big.Int)
+		for _, transfer := range tx.Transfers {
+			if transfer.Currency == refund.Currency && strings.EqualFold(transfer.To, refund.ToAddress) {
+				received.Add(received, transfer.Units)
+			}
+		}
+		if units == nil || received.Cmp(units) < 0 {
+			refund.Status = RefundFailed
+			refund.Error = fmt.Sprintf("交易 %s 未向退款地址足额转入 %s %s", refund.TxHash, refund.AmountExact, refund.Currency)
+		} else {
+			refund.Status = RefundConfirmed
+			refund.ConfirmedAt = now
+		}
+	}
+
+	if refund.Status == previous.Status && refund.BlockHeight == previous.BlockHeight &&
+		refund.Confirmations == previous.Confirmations && refund.MissingSince.Equal(previous.MissingSince) {
+		return nil
+	}
+	cs.refunds.Save(refund)
+	switch refund.Status {
+	case RefundConfirmed:
+		event = "refund_confirmed"
+		log.Printf("退款 %s 的交易 %s 已达到 %d 个确认", refundID, refund.TxHash, refund.Confirmations)
+	case RefundFailed:
+		event = "refund_failed"
+		log.Printf("【警告】退款 %s 失败，需重新发送: %s", refundID, refund.Error)
+	default:
+		return nil
+	}
+	return &ConfirmationUpdate{Refund: refund, Event: event}
+}
+
+func registerRefundRoutes(api *gin.RouterGroup, cs *CryptoService, hub *CheckoutHub) {
+	api.GET("/crypto/refunds/:refundId", func(c *gin.Context) {
+		refund, err := cs.refunds.Get(c.Param("refundId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "REFUND_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, refund.customerView())
+	})
+
+	api.GET("/crypto/payment/:paymentId/refunds", func(c *gin.Context) {
+		refunds := make([]*CryptoRefund, 0)
+		for _, refund := range cs.refunds.List("") {
+			if refund.PaymentID == c.Param("paymentId") {
+				refunds = append(refunds, refund.customerView())
+			}
+		}
+		apierr.RespondOK(c, refunds)
+	})
+
+	// 收银台提交退款地址
+	api.POST("/crypto/refunds/:refundId/address", func(c *gin.Context) {
+		var req struct {
+			RefundAddress string `json:"refundAddress" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		resp, err := cs.SubmitRefundAddress(c.Param("refundId"), req.RefundAddress)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin := api.Group("/crypto/admin")
+
+	admin.GET("/refunds", func(c *gin.Context) {
+		apierr.RespondOK(c, cs.refunds.List(c.DefaultQuery("status", RefundQueued)))
+	})
+
+	admin.POST("/refunds", func(c *gin.Context) {
+		var req CreateRefundRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		var ok bool
+		if req.Operator, ok = requestOperator(c, req.Operator); !ok {
+			return
+		}
+		resp, err := cs.CreateRefund(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if refund, ok := resp.Data.(*CryptoRefund); ok && refund.Status == RefundAwaitingAddress {
+			hub.Publish(refund.PaymentID, CheckoutEvent{Type: "refund_address_required", Data: refund.customerView()})
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.POST("/refunds/:refundId/send", func(c *gin.Context) {
+		var req struct {
+			Operator string `json:"operator"`
+		}
+		// 启用认证时操作人取自访问令牌，可以不传请求体
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		operator, ok := requestOperator(c, req.Operator)
+		if !ok {
+			return
+		}
+		resp, err := cs.SendRefund(c.Request.Context(), c.Param("refundId"), operator)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if refund, ok := resp.Data.(*CryptoRefund); ok {
+			hub.Publish(refund.PaymentID, CheckoutEvent{Type: "refund_broadcast", Data: refund.customerView()})
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// 未配置热钱包的链由财务手工转出后登记交易哈希
+	admin.POST("/refunds/:refundId/transaction", func(c *gin.Context) {
+		var req RecordRefundTxRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		var ok bool
+		if req.Operator, ok = requestOperator(c, req.Operator); !ok {
+			return
+		}
+		resp, err := cs.RecordRefundTx(c.Param("refundId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if refund, ok := resp.Data.(*CryptoRefund); ok {
+			hub.Publish(refund.PaymentID, CheckoutEvent{Type: "refund_broadcast", Data: refund.customerView()})
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,324 @@
+package cryptogw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopay-service/internal/httpmw"
+)
+
+// Nacos 心跳响应中表示实例不存在的代码，服务端重启或实例过期被摘除后需要重新注册
+const nacosInstanceNotFound = 20404
+
+// ServiceRegistry 将本实例注册到 Nacos，网关按服务名发现实例，不再写死端口。
+// 配置 NACOS_ADDR（如 http://nacos:8848，多个地址逗号分隔）时启用，注册为临时实例：
+// 按 NACOS_HEARTBEAT_INTERVAL（默认 5 秒）发送心跳，超过 NACOS_HEALTH_TTL（默认 15 秒）未收到心跳时
+// Nacos 将实例标记为不健康，超过两倍 TTL 时摘除。关闭时先注销再停止接收请求
+type ServiceRegistry struct {
+	addrs       []string
+	namespace   string
+	group       string
+	cluster     string
+	serviceName string
+	ip          string
+	port        string
+	metadata    map[string]string
+	interval    time.Duration
+	ttl         time.Duration
+	username    string
+	password    string
+	httpClient  *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	registered  bool
+	stopped     bool
+}
+
+// NewServiceRegistry 未配置 NACOS_ADDR 时返回 nil，nil 上的各方法不做任何操作。
+// metadata 为服务自身的版本和能力描述，如启用的支付渠道
+func NewServiceRegistry(serviceName, port string, metadata map[string]string) *ServiceRegistry {
+	addrs := splitList(os.Getenv("NACOS_ADDR"))
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	ip := os.Getenv("SERVICE_IP")
+	if ip == "" {
+		var err error
+		if ip, err = localIPv4(); err != nil {
+			log.Printf("【警告】无法确定本机地址，未注册到 Nacos，请配置 SERVICE_IP: %v", err)
+			return nil
+		}
+	}
+
+	sr := &ServiceRegistry{
+		addrs:       addrs,
+		namespace:   os.Getenv("NACOS_NAMESPACE"),
+		group:       envString("NACOS_GROUP", "DEFAULT_GROUP"),
+		cluster:     envString("NACOS_CLUSTER", "DEFAULT"),
+		serviceName: serviceName,
+		ip:          ip,
+		port:        port,
+		interval:    envDuration("NACOS_HEARTBEAT_INTERVAL", 5*time.Second),
+		ttl:         envDuration("NACOS_HEALTH_TTL", 15*time.Second),
+		username:    os.Getenv("NACOS_USERNAME"),
+		password:    os.Getenv("NACOS_PASSWORD"),
+		httpClient:  &http.Client{Timeout: 5 * time.Second},
+	}
+	if sr.ttl <= sr.interval {
+		log.Printf("NACOS_HEALTH_TTL 不大于心跳间隔，调整为心跳间隔的 3 倍")
+		sr.ttl = 3 * sr.interval
+	}
+
+	// preserved.* 为 Nacos 约定的实例级心跳配置，单位毫秒
+	sr.metadata = map[string]string{
+		"scheme":                        "http",
+		"preserved.heart.beat.interval": strconv.FormatInt(sr.interval.Milliseconds(), 10),
+		"preserved.heart.beat.timeout":  strconv.FormatInt(sr.ttl.Milliseconds(), 10),
+		"preserved.ip.delete.timeout":   strconv.FormatInt(2*sr.ttl.Milliseconds(), 10),
+	}
+	if httpmw.LoadTLSConfig().Enabled() {
+		sr.metadata["scheme"] = "https"
+	}
+	for k, v := range metadata {
+		sr.metadata[k] = v
+	}
+	return sr
+}
+
+// Run 注册实例并定时发送心跳，直到 ctx 取消或已注销。注册失败时按心跳间隔重试，不影响服务启动
+func (sr *ServiceRegistry) Run(ctx context.Context) {
+	if sr == nil {
+		return
+	}
+	if err := sr.register(ctx); err != nil {
+		log.Printf("注册到 Nacos 失败，稍后重试: %v", err)
+	}
+
+	ticker := time.NewTicker(sr.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sr.mu.Lock()
+		stopped, registered := sr.stopped, sr.registered
+		sr.mu.Unlock()
+		if stopped {
+			return
+		}
+		if !registered {
+			if err := sr.register(ctx); err != nil {
+				log.Printf("注册到 Nacos 失败，稍后重试: %v", err)
+			}
+			continue
+		}
+		if err := sr.beat(ctx); err != nil {
+			log.Printf("Nacos 心跳失败: %v", err)
+		}
+	}
+}
+
+// Deregister 注销实例，之后不再发送心跳。关闭时在停止接收请求之前调用，使网关尽早摘除本实例
+func (sr *ServiceRegistry) Deregister() {
+	if sr == nil {
+		return
+	}
+	sr.mu.Lock()
+	sr.stopped = true
+	registered := sr.registered
+	sr.registered = false
+	sr.mu.Unlock()
+	if !registered {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	params := sr.instanceParams()
+	if _, err := sr.call(ctx, http.MethodDelete, "/nacos/v1/ns/instance", params); err != nil {
+		log.Printf("从 Nacos 注销失败，实例将在心跳超时后被摘除: %v", err)
+		return
+	}
+	log.Printf("已从 Nacos 注销 %s %s:%s", sr.serviceName, sr.ip, sr.port)
+}
+
+func (sr *ServiceRegistry) register(ctx context.Context) error {
+	params := sr.instanceParams()
+	metadata, err := json.Marshal(sr.metadata)
+	if err != nil {
+		return err
+	}
+	params.Set("metadata", string(metadata))
+	params.Set("weight", "1")
+	params.Set("enabled", "true")
+	params.Set("healthy", "true")
+	if _, err := sr.call(ctx, http.MethodPost, "/nacos/v1/ns/instance", params); err != nil {
+		return err
+	}
+
+	sr.mu.Lock()
+	sr.registered = !sr.stopped
+	sr.mu.Unlock()
+	log.Printf("已注册到 Nacos: %s %s:%s", sr.serviceName, sr.ip, sr.port)
+	return nil
+}
+
+func (sr *ServiceRegistry) beat(ctx context.Context) error {
+	port, _ := strconv.Atoi(sr.port)
+	beat, err := json.Marshal(map[string]interface{}{
+		"serviceName": sr.group + "@@" + sr.serviceName,
+		"cluster":     sr.cluster,
+		"ip":          sr.ip,
+		"port":        port,
+		"metadata":    sr.metadata,
+		"scheduled":   true,
+		"weight":      1,
+	})
+	if err != nil {
+		return err
+	}
+	params := sr.instanceParams()
+	params.Set("beat", string(beat))
+
+	body, err := sr.call(ctx, http.MethodPut, "/nacos/v1/ns/instance/beat", params)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Code int `json:"code"`
+	}
+	if json.Unmarshal(body, &result) == nil && result.Code == nacosInstanceNotFound {
+		log.Printf("Nacos 中已无本实例，重新注册")
+		return sr.register(ctx)
+	}
+	return nil
+}
+
+func (sr *ServiceRegistry) instanceParams() url.Values {
+	params := url.Values{}
+	params.Set("serviceName", sr.serviceName)
+	params.Set("groupName", sr.group)
+	params.Set("clusterName", sr.cluster)
+	params.Set("ip", sr.ip)
+	params.Set("port", sr.port)
+	params.Set("ephemeral", "true")
+	if sr.namespace != "" {
+		params.Set("namespaceId", sr.namespace)
+	}
+	return params
+}
+
+// call 依次尝试各 Nacos 地址，启用鉴权时附带 accessToken
+func (sr *ServiceRegistry) call(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	var lastErr error
+	for _, addr := range sr.addrs {
+		base := strings.TrimRight(addr, "/")
+		if sr.username != "" {
+			token, err := sr.accessToken(ctx, base)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			params.Set("accessToken", token)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, base+path+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := sr.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			if resp.StatusCode == http.StatusForbidden {
+				sr.mu.Lock()
+				sr.token = ""
+				sr.mu.Unlock()
+			}
+			lastErr = fmt.Errorf("%s 返回 HTTP %d: %s", base, resp.StatusCode, strings.TrimSpace(string(body)))
+			continue
+		}
+		return body, nil
+	}
+	return nil, lastErr
+}
+
+// accessToken 返回缓存的登录令牌，过期前 1 分钟重新登录
+func (sr *ServiceRegistry) accessToken(ctx context.Context, base string) (string, error) {
+	sr.mu.Lock()
+	if sr.token != "" && time.Now().Before(sr.tokenExpiry) {
+		token := sr.token
+		sr.mu.Unlock()
+		return token, nil
+	}
+	sr.mu.Unlock()
+
+	form := url.Values{"username": {sr.username}, "password": {sr.password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/nacos/v1/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := sr.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Nacos 登录失败: HTTP %d", resp.StatusCode)
+	}
+	var result struct {
+		AccessToken string `json:"accessToken"`
+		TokenTTL    int64  `json:"tokenTtl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("解析 Nacos 登录响应失败: %w", err)
+	}
+
+	sr.mu.Lock()
+	sr.token = result.AccessToken
+	sr.tokenExpiry = time.Now().Add(time.Duration(result.TokenTTL)*time.Second - time.Minute)
+	sr.mu.Unlock()
+	return result.AccessToken, nil
+}
+
+// localIPv4 返回第一个非回环的 IPv4 地址
+func localIPv4() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			if ip4 := ipNet.IP.To4(); ip4 != nil {
+				return ip4.String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("未找到非回环 IPv4 地址")
+}
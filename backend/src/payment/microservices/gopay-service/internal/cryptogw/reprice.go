@@ -0,0 +1,178 @@
+package cryptogw
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// 重新报价的处理结果
+const (
+	RepriceRequoted = "requoted" // 未付款的账单按当前汇率重新计算应付数量
+	RepriceAccepted = "accepted" // 锁定过期后付款，按当前汇率仍足额，直接接受
+	RepriceReview   = "review"   // 锁定过期后付款，按当前汇率不足额，转人工复核
+)
+
+// Repricing 一次重新报价，原汇率和新汇率都保留，供对账和复核时追溯
+type Repricing struct {
+	OriginalRate   float64   `json:"originalRate"`
+	NewRate        float64   `json:"newRate"`
+	RateSource     string    `json:"rateSource"`
+	OriginalAmount string    `json:"originalAmount"`
+	NewAmount      string    `json:"newAmount"`            // 按新汇率计算的应付数量
+	PaidAmount     float64   `json:"paidAmount,omitempty"` // 锁定过期后实际到账的数量
+	Outcome        string    `json:"outcome"`
+	ReviewID       string    `json:"reviewId,omitempty"`
+	Operator       string    `json:"operator,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type RepriceRequest struct {
+	Operator string `json:"operator"` // 为空表示由收银台发起
+}
+
+// RateLockExpired 锁定汇率在 at 时刻是否已失效，未锁定汇率的账单始终返回 false
+func (invoice *CryptoInvoice) RateLockExpired(at time.Time) bool {
+	return !invoice.RateExpiresAt.IsZero() && at.After(invoice.RateExpiresAt)
+}
+
+// Reprice 处理锁定汇率过期的账单：
+// 未付款的账单按当前汇率重新报价并重新锁定；锁定过期后才付款的账单按当前汇率核算到账数量，
+// 足额（允许 ADDRESS_MATCH_TOLERANCE 的容差）时接受，否则转人工复核
+func (cs *CryptoService) Reprice(paymentID string, req *RepriceRequest) (*apierr.Response, error) {
+	cs.attributionMu.Lock()
+	defer cs.attributionMu.Unlock()
+
+	invoice, err := cs.invoices.Get(paymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if invoice.LockedRate <= 0 || invoice.FiatAmount <= 0 {
+		return apierr.ErrorResponse("INVALID_STATE", "该账单按加密货币计价，未锁定汇率"), nil
+	}
+
+	now := time.Now()
+	switch {
+	case invoice.Status == InvoicePending && now.Before(invoice.ExpiresAt):
+		if !invoice.RateLockExpired(now) {
+			return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("锁定汇率在 %s 前有效，无需重新报价", invoice.RateExpiresAt.Format(time.RFC3339))), nil
+		}
+	case invoice.LatePayment && invoice.TxHash != "":
+		if n := len(invoice.Repricings); n > 0 && invoice.Repricings[n-1].Outcome != RepriceRequoted {
+			return apierr.ErrorResponse("INVALID_STATE", "该笔付款已按当前汇率核算过"), nil
+		}
+	default:
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("账单状态 %s 不支持重新报价", invoice.Status)), nil
+	}
+
+	asset := Asset{Currency: invoice.Currency, Network: invoice.Network}
+	quote, amount, err := cs.quoteFiat(asset, invoice.FiatCurrency, invoice.FiatAmount)
+	if err != nil {
+		log.Printf("【汇率】重新报价 %s 失败: %v", paymentID, err)
+		return apierr.ErrorResponse("RATE_UNAVAILABLE", fmt.Sprintf("暂时无法获取 %s/%s 汇率，请稍后重试", asset.Currency, invoice.FiatCurrency)), nil
+	}
+
+	repricing := Repricing{
+		OriginalRate:   invoice.LockedRate,
+		NewRate:        quote.Rate,
+		RateSource:     quote.Source,
+		OriginalAmount: invoice.AmountExact,
+		NewAmount:      amount.Exact,
+		Operator:       req.Operator,
+		CreatedAt:      now,
+	}
+
+	if invoice.TxHash == "" {
+		repricing.Outcome = RepriceRequoted
+		invoice.Amount = amount.Value
+		invoice.AmountExact = amount.Exact
+		invoice.LockedRate = quote.Rate
+		invoice.MarketRate = quote
+		invoice.RateLockedAt = now
+		invoice.RateExpiresAt = now.Add(cs.rateLock)
+		if invoice.RateExpiresAt.After(invoice.ExpiresAt) {
+			invoice.RateExpiresAt = invoice.ExpiresAt
+		}
+	} else {
+		repricing.PaidAmount = invoice.PaidAmount
+		if invoice.PaidAmount >= amount.Value || cs.amountMatches(amount.Value, invoice.PaidAmount) {
+			repricing.Outcome = RepriceAccepted
+		} else {
+			repricing.Outcome = RepriceReview
+			repricing.ReviewID = cs.flagForReview(&InboundTransfer{
+				TxHash:   invoice.TxHash,
+				Address:  invoice.Address,
+				Currency: invoice.Currency,
+				Network:  invoice.Network,
+				Amount:   invoice.PaidAmount,
+			}, []*CryptoInvoice{invoice}, fmt.Sprintf("锁定汇率过期后付款，按当前汇率 %v 应付 %s，实际到账 %v",
+				quote.Rate, amount.Exact, invoice.PaidAmount))
+		}
+	}
+	invoice.Repricings = append(invoice.Repricings, repricing)
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, err
+	}
+	log.Printf("账单 %s 重新报价: 汇率 %v -> %v，结果 %s", paymentID, repricing.OriginalRate, repricing.NewRate, repricing.Outcome)
+	return apierr.SuccessResponse(invoice), nil
+}
+
+// quotedPayment 重新报价或生成补款账单后推送给收银台的账单信息
+func quotedPayment(invoice *CryptoInvoice) *model.CryptoPayment {
+	asset := Asset{Currency: invoice.Currency, Network: invoice.Network}
+	amount := NewCryptoAmount(invoice.expectedAmount(), asset)
+	payment := &model.CryptoPayment{
+		PaymentID:    invoice.PaymentID,
+		Address:      invoice.Address,
+		Currency:     invoice.Currency,
+		Network:      invoice.Network,
+		Amount:       amount.Value,
+		AmountExact:  amount.Exact,
+		BaseUnits:    amount.BaseUnits,
+		Decimals:     asset.Decimals(),
+		FiatCurrency: invoice.FiatCurrency,
+		FiatAmount:   invoice.FiatAmount,
+		Rate:         invoice.LockedRate,
+		Reference:    invoice.Reference,
+		Memo:         invoice.Memo,
+		PaymentURL:   paymentURI(invoice, amount),
+		QRCode:       qrCodeDataURI(invoice, amount),
+		CheckoutURL:  checkoutURL(invoice.PaymentID),
+		TravelRule:   invoice.TravelRule != nil,
+		ExpiredAt:    invoice.ExpiresAt.Format(time.RFC3339),
+	}
+	if invoice.MarketRate != nil {
+		payment.RateSource = invoice.MarketRate.Source
+		payment.RateLockedUntil = invoice.RateExpiresAt.Format(time.RFC3339)
+	}
+	return payment
+}
+
+// registerRepricingRoutes 注册重新报价接口，收银台在锁定汇率过期后调用，运营在复核锁定过期后的付款时调用
+func registerRepricingRoutes(api *gin.RouterGroup, cs *CryptoService, hub *CheckoutHub) {
+	api.POST("/crypto/payment/:paymentId/reprice", func(c *gin.Context) {
+		var req RepriceRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+				return
+			}
+		}
+
+		resp, err := cs.Reprice(c.Param("paymentId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if invoice, ok := resp.Data.(*CryptoInvoice); ok && invoice.TxHash == "" {
+			hub.Publish(invoice.PaymentID, CheckoutEvent{Type: "rate_requoted", Data: quotedPayment(invoice)})
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
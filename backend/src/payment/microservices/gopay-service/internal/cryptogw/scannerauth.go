@@ -0,0 +1,92 @@
+package cryptogw
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// scannerPaths 外部链上监听服务调用的接口：上报入账和心跳
+var scannerPaths = []string{"/api/v1/crypto/transfers", "/api/v1/crypto/scanner/heartbeat"}
+
+// ScannerAuth 外部链上监听服务的认证。MTLS_SCANNER_CLIENTS 配置了允许的服务时按客户端证书校验（见 newClientCertAuth），
+// 否则按 CRYPTO_SCANNER_SECRET 校验请求签名：X-Scanner-Timestamp 为 Unix 秒，X-Scanner-Signature 为
+// hex(HMAC-SHA256(secret, timestamp + "." + 请求体))，与网关发出的 Webhook 签名方式相同，时间戳与网关时间相差不超过 5 分钟。
+// 两者都未配置时拒绝全部上报
+type ScannerAuth struct {
+	secret string
+	skew   time.Duration
+}
+
+func newScannerAuth() *ScannerAuth {
+	a := &ScannerAuth{secret: os.Getenv("CRYPTO_SCANNER_SECRET"), skew: 5 * time.Minute}
+	if a.secret == "" && os.Getenv("MTLS_SCANNER_CLIENTS") == "" {
+		log.Printf("【警告】未配置 MTLS_SCANNER_CLIENTS 或 CRYPTO_SCANNER_SECRET，外部链上监听服务的上报将全部被拒绝")
+	}
+	return a
+}
+
+// Middleware 校验监听服务的证书或请求签名，须在客户端证书认证之后、注册路由前挂载
+func (a *ScannerAuth) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(scannerPaths, c.FullPath()) {
+			c.Next()
+			return
+		}
+		// 客户端证书已按 MTLS_SCANNER_CLIENTS 校验通过
+		if c.GetString(httpmw.ClientServiceKey) != "" {
+			c.Next()
+			return
+		}
+		if a.secret == "" {
+			apierr.RespondError(c, http.StatusUnauthorized, "SCANNER_AUTH_REQUIRED", "未配置链上监听服务认证，拒绝上报")
+			c.Abort()
+			return
+		}
+
+		timestamp := c.GetHeader("X-Scanner-Timestamp")
+		signature := c.GetHeader("X-Scanner-Signature")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || signature == "" {
+			apierr.RespondError(c, http.StatusUnauthorized, "SCANNER_AUTH_REQUIRED", "缺少监听服务签名")
+			c.Abort()
+			return
+		}
+		if age := time.Since(time.Unix(seconds, 0)); age > a.skew || age < -a.skew {
+			apierr.RespondError(c, http.StatusUnauthorized, "SIGNATURE_EXPIRED", "监听服务签名的时间戳已过期")
+			c.Abort()
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		mac := hmac.New(sha256.New, []byte(a.secret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		expected, err := hex.DecodeString(signature)
+		if err != nil || !hmac.Equal(expected, mac.Sum(nil)) {
+			log.Printf("【警告】拒绝签名无效的监听服务上报 %s，来源 %s", c.FullPath(), c.ClientIP())
+			apierr.RespondError(c, http.StatusUnauthorized, "INVALID_SIGNATURE", "监听服务签名无效")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
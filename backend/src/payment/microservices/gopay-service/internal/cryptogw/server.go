@@ -0,0 +1,541 @@
+package cryptogw
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+	"gopay-service/internal/model"
+	"gopay-service/internal/rates"
+)
+
+type CryptoService struct {
+	// 每笔账单从扩展公钥派生独立的收款地址，过期未付款的地址回收复用
+	addresses *AddressPool
+	invoices  InvoiceStore
+	reviews   *ReviewQueue
+	refunds   *RefundQueue
+	scanners  *ScannerTracker
+	rates     *rates.Service
+
+	// 入账归属时的金额相对容差
+	matchTolerance float64
+	attributionMu  sync.Mutex
+
+	// 下单时锁定汇率的时长
+	rateLock time.Duration
+
+	// Solana 收款钱包，Solana 账单共用该地址并按参考公钥区分
+	solanaWallet string
+	// XRP、Stellar、TON 的收款地址，各网络账单共用并按标签区分
+	memoWallets map[string]string
+	memos       MemoStore
+
+	// 各链监听器的节点池，用于状态接口展示节点健康
+	endpointsMu sync.Mutex
+	endpoints   []*EndpointPool
+
+	// 各网络的链上读取接口，由链上监听器登记，用于交易核验和余额查询
+	chainsMu sync.RWMutex
+	chains   map[string]ChainReader
+	balances *balanceCache
+	fees     *feeCache
+
+	// 退款热钱包及配置了热钱包的网络的退款发送接口，refundMu 串行化退款单的状态变更
+	hotWallet *HotWallet
+	senders   map[string]RefundSender
+	refundMu  sync.Mutex
+
+	// 收款地址的归集台账及各网络的归集发送接口
+	sweeps       *SweepLedger
+	sweepSenders map[string]SweepSender
+
+	// 交易对手地址筛查、旅行规则门槛及合规复核队列
+	screener   *Screener
+	travelRule *TravelRulePolicy
+	compliance *ComplianceQueue
+
+	// 按入账金额分档的确认数
+	bands *ConfirmationBands
+}
+
+// Stores 网关需要持久化的状态，字段为 nil 时只保存在内存中，进程重启后丢失
+type Stores struct {
+	Addresses  AddressStore
+	Memos      MemoStore
+	Invoices   InvoiceStore
+	Refunds    *RefundQueue
+	Sweeps     *SweepLedger
+	Compliance *ComplianceQueue
+	Reviews    *ReviewQueue
+}
+
+// NewSQLiteStores 全部状态保存到 SQLite，表结构见 migrations 下的 crypto_* 表
+func NewSQLiteStores(db *sql.DB) (Stores, error) {
+	stores := Stores{
+		Addresses: NewSQLiteAddressStore(db),
+		Memos:     NewSQLiteMemoStore(db),
+		Invoices:  NewSQLiteInvoiceStore(db),
+	}
+	var err error
+	if stores.Refunds, err = NewSQLiteRefundQueue(db); err != nil {
+		return Stores{}, fmt.Errorf("加载退款队列失败: %w", err)
+	}
+	if stores.Sweeps, err = NewSQLiteSweepLedger(db); err != nil {
+		return Stores{}, fmt.Errorf("加载归集台账失败: %w", err)
+	}
+	if stores.Compliance, err = NewSQLiteComplianceQueue(db); err != nil {
+		return Stores{}, fmt.Errorf("加载合规复核队列失败: %w", err)
+	}
+	if stores.Reviews, err = NewSQLiteReviewQueue(db); err != nil {
+		return Stores{}, fmt.Errorf("加载人工复核队列失败: %w", err)
+	}
+	return stores, nil
+}
+
+func NewCryptoService(stores Stores) *CryptoService {
+	if stores.Addresses == nil {
+		stores.Addresses = NewMemoryAddressStore()
+	}
+	if stores.Memos == nil {
+		stores.Memos = NewMemoryMemoStore()
+	}
+	if stores.Invoices == nil {
+		stores.Invoices = NewMemoryInvoiceStore()
+	}
+	if stores.Refunds == nil {
+		stores.Refunds = NewRefundQueue()
+	}
+	if stores.Sweeps == nil {
+		stores.Sweeps = NewSweepLedger()
+	}
+	if stores.Compliance == nil {
+		stores.Compliance = NewComplianceQueue()
+	}
+	if stores.Reviews == nil {
+		stores.Reviews = NewReviewQueue()
+	}
+	wallet := NewHDWallet()
+	addresses, err := NewAddressPool(wallet, stores.Addresses)
+	if err != nil {
+		log.Fatalf("初始化收款地址池失败: %v", err)
+	}
+	return &CryptoService{
+		addresses:      addresses,
+		invoices:       stores.Invoices,
+		reviews:        stores.Reviews,
+		refunds:        stores.Refunds,
+		scanners:       NewScannerTracker(),
+		rates:          rates.NewService(),
+		matchTolerance: envFloat("ADDRESS_MATCH_TOLERANCE", 0),
+		rateLock:       envDuration("CRYPTO_RATE_LOCK", 15*time.Minute),
+		solanaWallet:   solanaMerchantWallet(),
+		memoWallets:    memoDepositWallets(),
+		memos:          stores.Memos,
+		balances:       newBalanceCache(),
+		fees:           newFeeCache(),
+		hotWallet:      NewHotWallet(wallet.btcParams),
+		sweeps:         stores.Sweeps,
+		screener:       NewScreener(),
+		travelRule:     NewTravelRulePolicy(),
+		compliance:     stores.Compliance,
+		bands:          NewConfirmationBands(),
+	}
+}
+
+func (cs *CryptoService) CreatePayment(req *model.CryptoPaymentRequest) (*apierr.Response, error) {
+	asset, err := NormalizeAsset(req.Currency, req.Network)
+	if err != nil {
+		return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", err.Error()), nil
+	}
+	if !asset.registered() {
+		return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", fmt.Sprintf("%s 未登记代币合约或已下架，暂不支持收款", asset)), nil
+	}
+	req.Currency, req.Network = asset.Currency, asset.Network
+
+	// 生成支付ID
+	paymentID := fmt.Sprintf("CRYPTO_%d_%s", time.Now().UnixNano(), req.Currency)
+
+	// 设置过期时间
+	expireMinutes := req.ExpireMinutes
+	if expireMinutes == 0 {
+		expireMinutes = 60 // 默认60分钟
+	}
+	expiredAt := time.Now().Add(time.Duration(expireMinutes) * time.Minute)
+
+	invoice := &CryptoInvoice{
+		PaymentID:    paymentID,
+		OrderID:      req.OrderID,
+		UserID:       req.UserID,
+		Currency:     req.Currency,
+		Network:      req.Network,
+		FiatCurrency: req.FiatCurrency,
+		FiatAmount:   req.FiatAmount,
+		Status:       InvoicePending,
+		Metadata:     req.Metadata,
+		ExpiresAt:    expiredAt,
+	}
+
+	var amount CryptoAmount
+	if req.FiatAmount > 0 {
+		// 按法币计价的订单以实时汇率换算应付数量，并在 CRYPTO_RATE_LOCK 内锁定该汇率
+		if invoice.FiatCurrency == "" {
+			invoice.FiatCurrency = envString("DEFAULT_CURRENCY", "CNY")
+		}
+		invoice.FiatCurrency = strings.ToUpper(invoice.FiatCurrency)
+		quote, converted, err := cs.quoteFiat(asset, invoice.FiatCurrency, req.FiatAmount)
+		if err != nil {
+			log.Printf("【汇率】%s 换算 %s/%s 失败: %v", req.OrderID, asset.Currency, invoice.FiatCurrency, err)
+			return apierr.ErrorResponse("RATE_UNAVAILABLE", fmt.Sprintf("暂时无法获取 %s/%s 汇率，请稍后重试", asset.Currency, invoice.FiatCurrency)), nil
+		}
+		amount = converted
+		invoice.LockedRate = quote.Rate
+		invoice.MarketRate = quote
+		invoice.RateLockedAt = time.Now()
+		invoice.RateExpiresAt = invoice.RateLockedAt.Add(cs.rateLock)
+		if invoice.RateExpiresAt.After(expiredAt) {
+			invoice.RateExpiresAt = expiredAt
+		}
+	} else {
+		if req.Amount <= 0 {
+			return apierr.ErrorResponse("INVALID_PARAMS", "amount 和 fiatAmount 至少需要一个大于 0"), nil
+		}
+		amount = NewCryptoAmount(decimalRat(req.Amount), asset)
+	}
+	invoice.Amount = amount.Value
+	invoice.AmountExact = amount.Exact
+	if cs.bands.banded(asset.Network) {
+		// 按下单时的汇率估值入账金额，避免归属入账时再请求汇率
+		if rate, err := cs.valuationRate(invoice, asset, cs.bands.currency); err != nil {
+			log.Printf("【汇率】%s 获取 %s/%s 汇率失败，入账按网络默认确认数: %v", req.OrderID, asset.Currency, cs.bands.currency, err)
+		} else {
+			invoice.BandRate = rate
+		}
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+		}
+		invoice.CallbackURL = req.CallbackURL
+	}
+	if resp := cs.applyTravelRule(invoice, asset, amount); resp != nil {
+		return resp, nil
+	}
+
+	if asset.Network == "SOL" {
+		// Solana 账单共用收款钱包，按参考公钥区分
+		if cs.solanaWallet == "" {
+			return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", fmt.Sprintf("%s 暂无可用收款地址", asset)), nil
+		}
+		reference, err := newSolanaReference()
+		if err != nil {
+			return nil, err
+		}
+		invoice.Address = cs.solanaWallet
+		invoice.Reference = reference
+	} else if isMemoNetwork(asset.Network) {
+		// 共用收款地址，按标签区分
+		if cs.memoWallets[asset.Network] == "" {
+			return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", fmt.Sprintf("%s 暂无可用收款地址", asset)), nil
+		}
+		if err := cs.assignMemo(invoice); err != nil {
+			return nil, err
+		}
+		invoice.Address = cs.memoWallets[asset.Network]
+	} else {
+		// 分配本笔账单专用的收款地址，保留到账单过期
+		address, err := cs.addresses.Reserve(asset.Network, paymentID, expiredAt)
+		if err != nil {
+			log.Printf("分配 %s 收款地址失败: %v", asset, err)
+			return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", fmt.Sprintf("%s 暂无可用收款地址", asset)), nil
+		}
+		invoice.Address = address.Address
+		invoice.DerivationPath = address.Path
+		invoice.DerivationIndex = address.Index
+		invoice.AddressRecycled = !address.LastUsedAt.IsZero()
+	}
+
+	if err := cs.invoices.Save(invoice); err != nil {
+		return nil, err
+	}
+
+	payment := &model.CryptoPayment{
+		PaymentID:    paymentID,
+		Address:      invoice.Address,
+		Currency:     asset.Currency,
+		Network:      asset.Network,
+		Amount:       amount.Value,
+		AmountExact:  amount.Exact,
+		BaseUnits:    amount.BaseUnits,
+		Decimals:     asset.Decimals(),
+		FiatCurrency: invoice.FiatCurrency,
+		FiatAmount:   invoice.FiatAmount,
+		Rate:         invoice.LockedRate,
+		Reference:    invoice.Reference,
+		Memo:         invoice.Memo,
+		PaymentURL:   paymentURI(invoice, amount),
+		QRCode:       qrCodeDataURI(invoice, amount),
+		CheckoutURL:  checkoutURL(paymentID),
+		TravelRule:   invoice.TravelRule != nil,
+		ExpiredAt:    expiredAt.Format(time.RFC3339),
+	}
+	if invoice.MarketRate != nil {
+		payment.RateSource = invoice.MarketRate.Source
+		payment.RateLockedUntil = invoice.RateExpiresAt.Format(time.RFC3339)
+	}
+	return apierr.SuccessResponse(payment), nil
+}
+
+func (cs *CryptoService) QueryPayment(paymentID string) (*apierr.Response, error) {
+	invoice, err := cs.invoices.Get(paymentID)
+	if errors.Is(err, ErrInvoiceNotFound) {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := paymentStatus(invoice)
+	if data.Status == InvoicePending && time.Now().After(invoice.ExpiresAt) {
+		data.Status = InvoiceExpired
+	}
+	return apierr.SuccessResponse(data), nil
+}
+
+// Options 由统一入口传入的运行参数
+type Options struct {
+	Port        string // 监听端口
+	ServiceName string // 注册到服务发现使用的服务名
+	Version     string
+	DB          *sql.DB // STORE_DRIVER=sqlite 时传入，地址池、标签、账单、退款、归集和复核队列持久化到 crypto_* 表，并从 crypto_tokens 表加载代币登记
+	// AdminAuth 管理接口的认证，为 nil 时管理接口不做认证，仅用于本地开发
+	AdminAuth AdminAuthenticator
+	// Loops 托管链上监听和账本核验，为 nil 时直接启动 goroutine，异常退出后不重启
+	Loops LoopSupervisor
+}
+
+// Server 加密货币网关的 HTTP 服务及其后台任务
+type Server struct {
+	srv            *http.Server
+	registry       *ServiceRegistry
+	stopBackground context.CancelFunc
+	loops          LoopSupervisor
+}
+
+// Start 初始化加密货币网关并开始监听，返回后即可接收请求
+func Start(opts Options) (*Server, error) {
+	// 初始化加密货币服务。代币登记须先于其他初始化，之后支持的币种网络组合只读
+	if err := LoadTokens(opts.DB); err != nil {
+		return nil, err
+	}
+	var stores Stores
+	if opts.DB != nil {
+		var err error
+		if stores, err = NewSQLiteStores(opts.DB); err != nil {
+			return nil, err
+		}
+	}
+	cryptoService := NewCryptoService(stores)
+	checkoutHub := NewCheckoutHub()
+	checkoutHub.OnPublish(NewCryptoWebhooks(cryptoService).observe)
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	slippageReporter := NewSlippageReporter(cryptoService)
+	go NewExpiryExtender(cryptoService, checkoutHub).Run(bgCtx)
+	go NewInvoiceExpirer(cryptoService, checkoutHub).Run(bgCtx)
+	go slippageReporter.Run(bgCtx)
+	go NewAddressRecycler(cryptoService).Run(bgCtx)
+	loops := opts.Loops
+	if loops == nil {
+		loops = newGoroutineLoops()
+	}
+	for _, chain := range LoadEVMChains() {
+		loops.Loop(strings.ToLower(chain.Network)+"_watcher", NewEVMWatcher(cryptoService, checkoutHub, chain).Run)
+	}
+	if watcher := NewTronWatcher(cryptoService, checkoutHub); watcher != nil {
+		loops.Loop("tron_watcher", watcher.Run)
+	}
+	if watcher := NewBTCWatcher(cryptoService, checkoutHub); watcher != nil {
+		loops.Loop("btc_watcher", watcher.Run)
+	}
+	if watcher := NewSolanaWatcher(cryptoService, checkoutHub); watcher != nil {
+		loops.Loop("solana_watcher", watcher.Run)
+	}
+	if err := cryptoService.startLedgers(loops, checkoutHub); err != nil {
+		stopBackground()
+		loops.Stop(context.Background())
+		return nil, err
+	}
+	// 监听器登记归集接口后再启动归集
+	sweeper := NewSweeper(cryptoService)
+	go sweeper.Run(bgCtx)
+
+	r := gin.Default()
+
+	// 中间件
+	r.Use(gin.Recovery())
+	r.Use(httpmw.JSONContentType())
+	r.Use(httpmw.NewCORSPolicy(r).Middleware())
+
+	// API路由
+	// 下单接口按客户端证书限制调用方服务，外部监听服务的上报按客户端证书或请求签名认证
+	certAuth := newClientCertAuth()
+	api := r.Group("/api/v1")
+	api.Use(certAuth.Middleware())
+	api.Use(newScannerAuth().Middleware())
+	// 管理接口按访问令牌中的角色授权，须在注册路由前挂载
+	if opts.AdminAuth != nil {
+		go opts.AdminAuth.Run(bgCtx)
+		api.Use(opts.AdminAuth.Middleware())
+	} else {
+		log.Printf("【警告】未配置管理接口认证，/crypto/admin 下的退款、归集、合规复核接口无认证")
+	}
+	{
+		api.POST("/crypto/payment/create", func(c *gin.Context) {
+			var req model.CryptoPaymentRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+				return
+			}
+
+			resp, err := cryptoService.CreatePayment(&req)
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+
+			c.JSON(http.StatusOK, resp)
+		})
+
+		api.GET("/crypto/payment/query/:paymentId", func(c *gin.Context) {
+			paymentID := c.Param("paymentId")
+
+			resp, err := cryptoService.QueryPayment(paymentID)
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+			if !resp.Success {
+				c.JSON(http.StatusNotFound, resp)
+				return
+			}
+
+			c.JSON(http.StatusOK, resp)
+		})
+
+		api.GET("/crypto/address/balance", func(c *gin.Context) {
+			resp, err := cryptoService.GetAddressBalance(c.Request.Context(), c.Query("address"), c.Query("currency"), c.Query("network"))
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+
+			c.JSON(http.StatusOK, resp)
+		})
+
+		api.GET("/crypto/fees", func(c *gin.Context) {
+			resp, err := cryptoService.GetFees(c.Request.Context(), c.Query("network"))
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+
+			c.JSON(http.StatusOK, resp)
+		})
+
+		api.GET("/crypto/transaction/validate", func(c *gin.Context) {
+			resp, err := cryptoService.ValidateTransaction(c.Request.Context(), &TxVerificationRequest{
+				TxHash:    c.Query("txHash"),
+				Currency:  c.Query("currency"),
+				Network:   c.Query("network"),
+				Address:   c.Query("address"),
+				Amount:    c.Query("amount"),
+				PaymentID: c.Query("paymentId"),
+			})
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+
+			c.JSON(http.StatusOK, resp)
+		})
+
+		api.GET("/crypto/assets", func(c *gin.Context) {
+			apierr.RespondOK(c, SupportedAssets())
+		})
+
+		registerCheckoutRoutes(api, cryptoService, checkoutHub)
+		registerSlippageRoutes(api, slippageReporter)
+		registerAttributionRoutes(api, cryptoService)
+		registerRepricingRoutes(api, cryptoService, checkoutHub)
+		registerQRCodeRoutes(api, cryptoService)
+		registerAmountResolutionRoutes(api, cryptoService, checkoutHub)
+		registerRefundRoutes(api, cryptoService, checkoutHub)
+		registerAddressPoolRoutes(api, cryptoService)
+		registerTokenRoutes(api)
+		registerSweepRoutes(api, cryptoService, sweeper)
+		registerComplianceRoutes(api, cryptoService, checkoutHub)
+		registerStatusRoutes(api, cryptoService)
+	}
+
+	// 托管收银页，面向付款人，不经过 /api/v1 的调用方校验
+	registerHostedPageRoutes(r, cryptoService)
+
+	// 健康检查
+	r.GET("/health", httpmw.Health("crypto-gateway"))
+
+	tlsConfig := httpmw.LoadTLSConfig()
+	serverTLS, err := tlsConfig.ServerConfig()
+	if err != nil {
+		stopBackground()
+		loops.Stop(context.Background())
+		return nil, fmt.Errorf("加载 TLS 配置失败: %w", err)
+	}
+	s := &Server{
+		srv: &http.Server{
+			Addr:      ":" + opts.Port,
+			Handler:   r,
+			TLSConfig: serverTLS,
+		},
+		stopBackground: stopBackground,
+		loops:          loops,
+	}
+
+	httpmw.ListenAndServe(s.srv, tlsConfig, "加密货币网关")
+
+	log.Printf("加密货币网关已启动，端口: %s", opts.Port)
+
+	// 注册到服务发现，元数据中带上支持的币种网络供网关按能力路由
+	assets := SupportedAssets()
+	assetKeys := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		assetKeys = append(assetKeys, asset.Key())
+	}
+	s.registry = NewServiceRegistry(opts.ServiceName, opts.Port, map[string]string{
+		"version":     opts.Version,
+		"environment": envString("APP_ENV", "development"),
+		"assets":      strings.Join(assetKeys, ","),
+	})
+	go s.registry.Run(bgCtx)
+	return s, nil
+}
+
+// Shutdown 从服务发现注销，停止后台任务并等待链上监听和账本核验退出，再等待处理中的请求完成
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.registry.Deregister()
+	s.stopBackground()
+	loopsErr := s.loops.Stop(ctx)
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	return loopsErr
+}
@@ -0,0 +1,105 @@
+package cryptogw
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// Signer 热钱包签名接口。私钥保存在 KMS/HSM 或加密的本地密钥库中，服务只持有公钥，按摘要请求签名，
+// 退款和归集共用。密钥须为 secp256k1 曲线
+type Signer interface {
+	PublicKey() *btcec.PublicKey
+	// SignDigest 对 32 字节摘要签名，返回 low-S 规范化的 r||s，各 32 字节
+	SignDigest(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// newSigner 按配置创建签名器：
+// aws-kms:<密钥 ID 或 ARN> 使用 AWS KMS 的 ECC_SECG_P256K1 非对称密钥；
+// gcp-kms:projects/<项目>/locations/<区域>/keyRings/<密钥环>/cryptoKeys/<密钥>/cryptoKeyVersions/<版本> 使用 Cloud KMS 的 EC_SIGN_SECP256K1_SHA256 密钥（可选 HSM 保护级别）；
+// keystore:<路径> 使用加密的本地密钥库（见 keystoreSigner），供未接入云 KMS 的部署和开发环境使用
+func newSigner(ctx context.Context, spec string) (Signer, error) {
+	scheme, target, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("签名器配置格式应为 aws-kms:<密钥>、gcp-kms:<密钥版本> 或 keystore:<路径>")
+	}
+	switch scheme {
+	case "aws-kms":
+		return newAWSKMSSigner(ctx, target)
+	case "gcp-kms":
+		return newGCPKMSSigner(ctx, target)
+	case "keystore":
+		return newKeystoreSigner(target)
+	default:
+		return nil, fmt.Errorf("不支持的签名器 %s", scheme)
+	}
+}
+
+// parseDERSignature 解析 KMS 返回的 DER 签名并规范化为 low-S 的 r||s。
+// KMS 不保证 low-S，而以太坊和比特币的交易规则都要求 low-S
+func parseDERSignature(der []byte) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(der, &sig); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("签名格式无效")
+	}
+	n := btcec.S256().N
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.Cmp(n) >= 0 || sig.S.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("签名超出曲线范围")
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		sig.S.Sub(n, sig.S)
+	}
+	out := make([]byte, 64)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:])
+	return out, nil
+}
+
+// parseSubjectPublicKey 解析 KMS 返回的 DER 编码 SubjectPublicKeyInfo。标准库不支持 secp256k1，只取出公钥点
+func parseSubjectPublicKey(der []byte) (*btcec.PublicKey, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if rest, err := asn1.Unmarshal(der, &spki); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("公钥格式无效")
+	}
+	return btcec.ParsePubKey(spki.PublicKey.Bytes)
+}
+
+// signEthereum 以太坊格式的签名：r||s 加恢复 ID。KMS 不返回恢复 ID，按签名恢复出的公钥与签名器公钥比对得出
+func signEthereum(ctx context.Context, signer Signer, hash []byte) (r, s []byte, recovery byte, err error) {
+	sig, err := signer.SignDigest(ctx, hash)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	compact := make([]byte, 65)
+	copy(compact[1:], sig)
+	for recovery = 0; recovery < 2; recovery++ {
+		compact[0] = 27 + recovery
+		if pubKey, _, err := ecdsa.RecoverCompact(compact, hash); err == nil && pubKey.IsEqual(signer.PublicKey()) {
+			return sig[:32], sig[32:], recovery, nil
+		}
+	}
+	return nil, nil, 0, fmt.Errorf("签名与签名器公钥不匹配")
+}
+
+// signBitcoin 比特币格式的 DER 签名
+func signBitcoin(ctx context.Context, signer Signer, hash []byte) ([]byte, error) {
+	sig, err := signer.SignDigest(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	var r, s btcec.ModNScalar
+	r.SetByteSlice(sig[:32])
+	s.SetByteSlice(sig[32:])
+	return ecdsa.NewSignature(&r, &s).Serialize(), nil
+}
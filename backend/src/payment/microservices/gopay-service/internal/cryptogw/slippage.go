@@ -0,0 +1,246 @@
+package cryptogw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// ConversionRequest 财务登记加密货币实际兑换成法币的汇率
+type ConversionRequest struct {
+	PaymentID    string  `json:"paymentId" binding:"required"`
+	RealizedRate float64 `json:"realizedRate" binding:"required"`
+	ConvertedAt  string  `json:"convertedAt"` // RFC3339，为空时取当前时间
+}
+
+// SlippageReport 某日锁定汇率与实际兑换汇率的偏差汇总，Loss 为正表示亏损
+type SlippageReport struct {
+	Day            string    `json:"day"`
+	FiatCurrency   string    `json:"fiatCurrency"`
+	Count          int       `json:"count"`
+	LockedValue    float64   `json:"lockedValue"`
+	RealizedValue  float64   `json:"realizedValue"`
+	Loss           float64   `json:"loss"`
+	SlippageBps    float64   `json:"slippageBps"`
+	WorstBps       float64   `json:"worstBps"`
+	WorstPayment   string    `json:"worstPayment,omitempty"`
+	CumulativeLoss float64   `json:"cumulativeLoss"` // 统计窗口内（含当日）累计亏损
+	Alert          bool      `json:"alert"`
+	GeneratedAt    time.Time `json:"generatedAt"`
+}
+
+// SlippageReporter 每日计算汇率锁定损益，累计亏损超过阈值时告警
+type SlippageReporter struct {
+	crypto        *CryptoService
+	window        int
+	lossThreshold float64
+	bpsThreshold  float64
+
+	mu      sync.RWMutex
+	reports map[string]*SlippageReport // key: day/fiatCurrency
+	lastDay string
+}
+
+func NewSlippageReporter(crypto *CryptoService) *SlippageReporter {
+	return &SlippageReporter{
+		crypto:        crypto,
+		window:        envInt("RATE_SLIPPAGE_WINDOW_DAYS", 7),
+		lossThreshold: envFloat("RATE_SLIPPAGE_LOSS_THRESHOLD", 1000),
+		bpsThreshold:  envFloat("RATE_SLIPPAGE_BPS_THRESHOLD", 50),
+		reports:       make(map[string]*SlippageReport),
+	}
+}
+
+// RecordConversion 登记实际兑换汇率
+func (sr *SlippageReporter) RecordConversion(req *ConversionRequest) (*apierr.Response, error) {
+	invoice, err := sr.crypto.invoices.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if invoice.LockedRate <= 0 {
+		return apierr.ErrorResponse("INVALID_STATE", "该账单未锁定汇率"), nil
+	}
+
+	convertedAt := time.Now()
+	if req.ConvertedAt != "" {
+		if convertedAt, err = time.Parse(time.RFC3339, req.ConvertedAt); err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("convertedAt 格式无效: %s", req.ConvertedAt)), nil
+		}
+	}
+
+	invoice.RealizedRate = req.RealizedRate
+	invoice.ConvertedAt = convertedAt
+	if err := sr.crypto.invoices.Save(invoice); err != nil {
+		return nil, err
+	}
+	return apierr.SuccessResponse(invoice), nil
+}
+
+// Run 每小时检查一次，跨日后生成前一日报告
+func (sr *SlippageReporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			day := now.AddDate(0, 0, -1).Format("2006-01-02")
+			if day == sr.lastDay {
+				continue
+			}
+			if _, err := sr.Generate(day); err != nil {
+				log.Printf("生成汇率损益报告失败 %s: %v", day, err)
+				continue
+			}
+			sr.lastDay = day
+		}
+	}
+}
+
+// Generate 按兑换日期计算指定日的损益报告
+func (sr *SlippageReporter) Generate(day string) ([]*SlippageReport, error) {
+	start, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("日期格式无效: %s", day)
+	}
+	end := start.AddDate(0, 0, 1)
+
+	invoices, err := sr.crypto.invoices.List()
+	if err != nil {
+		return nil, err
+	}
+
+	byCurrency := make(map[string]*SlippageReport)
+	for _, invoice := range invoices {
+		if invoice.LockedRate <= 0 || invoice.RealizedRate <= 0 {
+			continue
+		}
+		if invoice.ConvertedAt.Before(start) || !invoice.ConvertedAt.Before(end) {
+			continue
+		}
+
+		report, ok := byCurrency[invoice.FiatCurrency]
+		if !ok {
+			report = &SlippageReport{Day: day, FiatCurrency: invoice.FiatCurrency}
+			byCurrency[invoice.FiatCurrency] = report
+		}
+
+		locked := invoice.Amount * invoice.LockedRate
+		realized := invoice.Amount * invoice.RealizedRate
+		report.Count++
+		report.LockedValue += locked
+		report.RealizedValue += realized
+
+		bps := (invoice.LockedRate - invoice.RealizedRate) / invoice.LockedRate * 10000
+		if bps > report.WorstBps {
+			report.WorstBps = round2(bps)
+			report.WorstPayment = invoice.PaymentID
+		}
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	reports := make([]*SlippageReport, 0, len(byCurrency))
+	for currency, report := range byCurrency {
+		report.Loss = round2(report.LockedValue - report.RealizedValue)
+		report.LockedValue = round2(report.LockedValue)
+		report.RealizedValue = round2(report.RealizedValue)
+		if report.LockedValue > 0 {
+			report.SlippageBps = round2(report.Loss / report.LockedValue * 10000)
+		}
+		report.GeneratedAt = time.Now()
+		sr.reports[day+"/"+currency] = report
+
+		report.CumulativeLoss = sr.cumulativeLoss(start, currency)
+		report.Alert = report.CumulativeLoss > sr.lossThreshold || report.SlippageBps > sr.bpsThreshold
+		if report.Alert {
+			log.Printf("【告警】%s %s 汇率锁定损失异常：当日 %.2f（%.1f bps），近 %d 日累计 %.2f",
+				day, currency, report.Loss, report.SlippageBps, sr.window, report.CumulativeLoss)
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].FiatCurrency < reports[j].FiatCurrency })
+	return reports, nil
+}
+
+// cumulativeLoss 统计窗口内的累计亏损，调用方需持有锁
+func (sr *SlippageReporter) cumulativeLoss(day time.Time, currency string) float64 {
+	var total float64
+	for i := 0; i < sr.window; i++ {
+		key := day.AddDate(0, 0, -i).Format("2006-01-02") + "/" + currency
+		if report, ok := sr.reports[key]; ok {
+			total += report.Loss
+		}
+	}
+	return round2(total)
+}
+
+// Reports 返回 [from, to] 日期范围内已生成的报告
+func (sr *SlippageReporter) Reports(from, to string) []*SlippageReport {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	var reports []*SlippageReport
+	for _, report := range sr.reports {
+		if (from == "" || report.Day >= from) && (to == "" || report.Day <= to) {
+			copied := *report
+			reports = append(reports, &copied)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Day != reports[j].Day {
+			return reports[i].Day < reports[j].Day
+		}
+		return reports[i].FiatCurrency < reports[j].FiatCurrency
+	})
+	return reports
+}
+
+// registerSlippageRoutes 注册汇率损益管理接口
+func registerSlippageRoutes(api *gin.RouterGroup, sr *SlippageReporter) {
+	admin := api.Group("/crypto/admin")
+
+	admin.POST("/conversions", func(c *gin.Context) {
+		var req ConversionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := sr.RecordConversion(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// from/to 为 YYYY-MM-DD；regenerate=true 时先重新计算 to 当日报告
+	admin.GET("/reports/slippage", func(c *gin.Context) {
+		from, to := c.Query("from"), c.Query("to")
+		if c.Query("regenerate") == "true" && to != "" {
+			if _, err := sr.Generate(to); err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+				return
+			}
+		}
+		apierr.RespondOK(c, sr.Reports(from, to))
+	})
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
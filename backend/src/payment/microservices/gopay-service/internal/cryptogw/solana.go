@@ -0,0 +1,381 @@
+package cryptogw
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+)
+
+// splMint 币种在 Solana 上的 mint 地址，取自代币登记表，未登记时为空串
+func splMint(currency string) string {
+	token, _ := tokenRegistry.Lookup(Asset{Currency: currency, Network: "SOL"})
+	return token.Contract
+}
+
+// solanaMerchantWallet Solana 收款钱包（SOLANA_MERCHANT_WALLET）。
+// Solana 使用 ed25519 密钥，只支持硬化派生，无法像其他链一样从扩展公钥派生收款地址，
+// 因此所有账单共用一个收款钱包，按 Solana Pay 规范为每笔账单生成参考公钥（reference）区分入账。
+// 钱包需预先创建各代币的关联代币账户（ATA）。未配置时不支持 Solana 网络
+func solanaMerchantWallet() string {
+	wallet := os.Getenv("SOLANA_MERCHANT_WALLET")
+	if wallet == "" {
+		return ""
+	}
+	if len(base58.Decode(wallet)) != 32 {
+		log.Fatalf("SOLANA_MERCHANT_WALLET 不是有效的 Solana 地址: %s", wallet)
+	}
+	return wallet
+}
+
+// newSolanaReference 随机 32 字节作为参考公钥，付款交易把它作为只读账户带上，监听时按它查询交易
+func newSolanaReference() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base58.Encode(buf), nil
+}
+
+// isSolanaSignature 交易签名为 64 字节的 Base58 编码
+func isSolanaSignature(signature string) bool {
+	return len(signature) >= 64 && len(signature) <= 88 && len(base58.Decode(signature)) == 64
+}
+
+// solanaPayURL Solana Pay 转账请求链接，钱包扫码后自动填入收款地址、代币、数量和参考公钥
+func solanaPayURL(invoice *CryptoInvoice) string {
+	query := url.Values{}
+	query.Set("amount", invoice.AmountExact)
+	query.Set("spl-token", splMint(invoice.Currency))
+	query.Set("reference", invoice.Reference)
+	query.Set("label", envString("SOLANA_PAY_LABEL", paymentLabel()))
+	query.Set("message", fmt.Sprintf("订单 %s", invoice.OrderID))
+	return "solana:" + invoice.Address + "?" + query.Encode()
+}
+
+// SolanaWatcher 通过 Solana JSON-RPC（SOLANA_RPC_URLS，也可用单个 SOLANA_RPC_URL）按参考公钥查询付款交易，
+// 以交易前后收款钱包的代币余额变化作为入账数量，交给入账归属，并按 slot 推进确认数
+type SolanaWatcher struct {
+	crypto   *CryptoService
+	hub      *CheckoutHub
+	rpc      *jsonRPCClient
+	wallet   string
+	mints    map[string]Asset // mint -> 币种
+	interval time.Duration
+}
+
+// NewSolanaWatcher 未配置节点或收款钱包时返回 nil
+func NewSolanaWatcher(crypto *CryptoService, hub *CheckoutHub) *SolanaWatcher {
+	urls := splitList(envString("SOLANA_RPC_URLS", os.Getenv("SOLANA_RPC_URL")))
+	if len(urls) == 0 || crypto.solanaWallet == "" {
+		return nil
+	}
+	w := &SolanaWatcher{
+		crypto:   crypto,
+		hub:      hub,
+		rpc:      newJSONRPCClient(crypto.newEndpointPool("SOL", "SOLANA", urls), 0),
+		wallet:   crypto.solanaWallet,
+		mints:    make(map[string]Asset),
+		interval: envDuration("SOLANA_POLL_INTERVAL", 5*time.Second),
+	}
+	for _, asset := range assetsOnNetwork("SOL") {
+		if mint := splMint(asset.Currency); mint != "" {
+			w.mints[mint] = asset
+		}
+	}
+	crypto.registerChain("SOL", w)
+	return w
+}
+
+func (w *SolanaWatcher) Run(ctx context.Context) {
+	log.Printf("Solana 链上监听已启动，收款钱包 %s，%d 个节点，轮询间隔 %s", w.wallet, w.rpc.pool.Len(), w.interval)
+	go w.rpc.pool.RunHealthChecks(ctx, w.rpc.Probe("getHealth"))
+	w.verifyTokens(ctx)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Solana 链上监听失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type solanaSignature struct {
+	Signature string      `json:"signature"`
+	Slot      int64       `json:"slot"`
+	Err       interface{} `json:"err"`
+	BlockTime *int64      `json:"blockTime"`
+}
+
+type solanaTokenBalance struct {
+	Mint          string `json:"mint"`
+	Owner         string `json:"owner"`
+	UITokenAmount struct {
+		Amount string `json:"amount"`
+	} `json:"uiTokenAmount"`
+}
+
+type solanaTransaction struct {
+	Slot      int64  `json:"slot"`
+	BlockTime *int64 `json:"blockTime"`
+	Meta      *struct {
+		Err               interface{}          `json:"err"`
+		PreTokenBalances  []solanaTokenBalance `json:"preTokenBalances"`
+		PostTokenBalances []solanaTokenBalance `json:"postTokenBalances"`
+	} `json:"meta"`
+}
+
+// received 交易前后收款钱包某个 mint 的余额增量，转入关联代币账户或钱包名下其他代币账户都计入
+func (tx *solanaTransaction) received(owner, mint string) *big.Int {
+	sum := func(balances []solanaTokenBalance) *big.Int {
+		total := new(big.Int)
+		for _, b := range balances {
+			if b.Owner != owner || b.Mint != mint {
+				continue
+			}
+			if amount, ok := new(big.Int).SetString(b.UITokenAmount.Amount, 10); ok {
+				total.Add(total, amount)
+			}
+		}
+		return total
+	}
+	return new(big.Int).Sub(sum(tx.Meta.PostTokenBalances), sum(tx.Meta.PreTokenBalances))
+}
+
+// senders 交易中某个 mint 余额减少的持有人，即付款方钱包
+func (tx *solanaTransaction) senders(mint string) []string {
+	pre := make(map[string]*big.Int)
+	for _, b := range tx.Meta.PreTokenBalances {
+		if b.Mint != mint {
+			continue
+		}
+		if amount, ok := new(big.Int).SetString(b.UITokenAmount.Amount, 10); ok {
+			if pre[b.Owner] == nil {
+				pre[b.Owner] = new(big.Int)
+			}
+			pre[b.Owner].Add(pre[b.Owner], amount)
+		}
+	}
+	for _, b := range tx.Meta.PostTokenBalances {
+		if b.Mint != mint || pre[b.Owner] == nil {
+			continue
+		}
+		if amount, ok := new(big.Int).SetString(b.UITokenAmount.Amount, 10); ok {
+			pre[b.Owner].Sub(pre[b.Owner], amount)
+		}
+	}
+	var owners []string
+	for owner, decrease := range pre {
+		if decrease.Sign() > 0 {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// poll 查询未付款账单参考公钥下的交易，再按最新 slot 推进确认数
+func (w *SolanaWatcher) poll(ctx context.Context) error {
+	var slot int64
+	if err := w.rpc.Call(ctx, "getSlot", []interface{}{map[string]string{"commitment": "confirmed"}}, &slot); err != nil {
+		return err
+	}
+
+	invoices, err := w.crypto.invoices.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, invoice := range invoices {
+		if invoice.Network != "SOL" || invoice.Reference == "" {
+			continue
+		}
+		if invoice.Status != InvoicePending && invoice.Status != InvoiceExpired {
+			continue
+		}
+		// 与其他链一致，过期账单在地址回收冷却期内仍然监听
+		if now.Sub(invoice.ExpiresAt) > w.crypto.addresses.cooldown {
+			continue
+		}
+		if err := w.scanReference(ctx, invoice.Reference); err != nil {
+			return err
+		}
+	}
+
+	w.crypto.scanners.Observe("SOL", slot, nil)
+	changed, err := w.crypto.AdvanceConfirmations(ctx, "SOL", slot, w)
+	if err != nil {
+		return err
+	}
+	publishConfirmations(w.hub, changed)
+	return nil
+}
+
+func (w *SolanaWatcher) scanReference(ctx context.Context, reference string) error {
+	var signatures []solanaSignature
+	if err := w.rpc.Call(ctx, "getSignaturesForAddress", []interface{}{reference,
+		map[string]interface{}{"commitment": "confirmed", "limit": 20}}, &signatures); err != nil {
+		return err
+	}
+
+	for _, sig := range signatures {
+		if sig.Err != nil {
+			continue
+		}
+		tx, err := w.transaction(ctx, sig.Signature)
+		if err != nil {
+			return err
+		}
+		if tx == nil || tx.Meta == nil || tx.Meta.Err != nil {
+			continue
+		}
+
+		for mint, asset := range w.mints {
+			units := tx.received(w.wallet, mint)
+			if units.Sign() <= 0 {
+				continue
+			}
+			transfer := &InboundTransfer{
+				TxHash:      sig.Signature,
+				Address:     w.wallet,
+				Currency:    asset.Currency,
+				Network:     "SOL",
+				Amount:      unitsToAmount(units, asset.Decimals()),
+				BlockHeight: tx.Slot,
+				Reference:   reference,
+				Senders:     tx.senders(mint),
+			}
+			if tx.BlockTime != nil {
+				blockTime := time.Unix(*tx.BlockTime, 0)
+				transfer.BlockTime = &blockTime
+			}
+			w.crypto.deliverTransfer(w.hub, transfer)
+			break
+		}
+	}
+	return nil
+}
+
+func (w *SolanaWatcher) transaction(ctx context.Context, signature string) (*solanaTransaction, error) {
+	var tx *solanaTransaction
+	err := w.rpc.Call(ctx, "getTransaction", []interface{}{signature, map[string]interface{}{
+		"encoding":                       "jsonParsed",
+		"commitment":                     "confirmed",
+		"maxSupportedTransactionVersion": 0,
+	}}, &tx)
+	return tx, err
+}
+
+// FetchTx 按签名查询交易，按交易前后各钱包的代币余额变化列出转入
+func (w *SolanaWatcher) FetchTx(ctx context.Context, signature string) (*ChainTx, error) {
+	tx, err := w.transaction(ctx, signature)
+	if err != nil || tx == nil || tx.Meta == nil {
+		return nil, err
+	}
+	var slot int64
+	if err := w.rpc.Call(ctx, "getSlot", []interface{}{map[string]string{"commitment": "confirmed"}}, &slot); err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: signature, BlockHeight: tx.Slot, Head: slot, Failed: tx.Meta.Err != nil}
+	seen := make(map[[2]string]bool)
+	for _, balance := range tx.Meta.PostTokenBalances {
+		key := [2]string{balance.Owner, balance.Mint}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		units := tx.received(balance.Owner, balance.Mint)
+		if units.Sign() <= 0 {
+			continue
+		}
+		result.Transfers = append(result.Transfers, ChainTransfer{
+			To:       balance.Owner,
+			Currency: w.mints[balance.Mint].Currency,
+			Contract: balance.Mint,
+			Units:    units,
+		})
+	}
+	return result, nil
+}
+
+// verifyTokens 启动时按 getTokenSupply 核对登记的 mint 存在且精度一致，否则下架（见 TokenRegistry.verify）
+func (w *SolanaWatcher) verifyTokens(ctx context.Context) {
+	for mint, asset := range w.mints {
+		var supply struct {
+			Value struct {
+				Decimals int `json:"decimals"`
+			} `json:"value"`
+		}
+		err := w.rpc.Call(ctx, "getTokenSupply", []interface{}{mint}, &supply)
+		tokenRegistry.verify(asset, supply.Value.Decimals, err)
+	}
+}
+
+// Balance 钱包名下该代币全部代币账户的余额之和
+func (w *SolanaWatcher) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	mint := splMint(asset.Currency)
+	if mint == "" {
+		return nil, fmt.Errorf("未配置 %s_SOL_MINT", asset.Currency)
+	}
+	var accounts struct {
+		Value []struct {
+			Account struct {
+				Data struct {
+					Parsed struct {
+						Info struct {
+							TokenAmount struct {
+								Amount string `json:"amount"`
+							} `json:"tokenAmount"`
+						} `json:"info"`
+					} `json:"parsed"`
+				} `json:"data"`
+			} `json:"account"`
+		} `json:"value"`
+	}
+	if err := w.rpc.Call(ctx, "getTokenAccountsByOwner", []interface{}{address, map[string]string{"mint": mint},
+		map[string]string{"encoding": "jsonParsed", "commitment": "confirmed"}}, &accounts); err != nil {
+		return nil, err
+	}
+
+	total := new(big.Int)
+	for _, account := range accounts.Value {
+		amount, ok := new(big.Int).SetString(account.Account.Data.Parsed.Info.TokenAmount.Amount, 10)
+		if !ok {
+			return nil, fmt.Errorf("代币账户余额无效: %s", account.Account.Data.Parsed.Info.TokenAmount.Amount)
+		}
+		total.Add(total, amount)
+	}
+	return total, nil
+}
+
+// LocateTx 交易所在 slot，被分叉丢弃的交易查不到状态
+func (w *SolanaWatcher) LocateTx(ctx context.Context, signature string) (TxLocation, bool, error) {
+	var statuses struct {
+		Value []*struct {
+			Slot int64       `json:"slot"`
+			Err  interface{} `json:"err"`
+		} `json:"value"`
+	}
+	if err := w.rpc.Call(ctx, "getSignatureStatuses", []interface{}{[]string{signature},
+		map[string]bool{"searchTransactionHistory": true}}, &statuses); err != nil {
+		return TxLocation{}, false, err
+	}
+	if len(statuses.Value) == 0 || statuses.Value[0] == nil || statuses.Value[0].Err != nil {
+		return TxLocation{}, false, nil
+	}
+	return TxLocation{Height: statuses.Value[0].Slot}, true, nil
+}
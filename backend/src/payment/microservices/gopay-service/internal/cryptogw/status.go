@@ -0,0 +1,154 @@
+package cryptogw
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// ScannerHeartbeat 链上监听服务定时上报的扫描进度
+type ScannerHeartbeat struct {
+	Network     string     `json:"network" binding:"required"`
+	BlockHeight int64      `json:"blockHeight"`
+	BlockTime   *time.Time `json:"blockTime"`
+}
+
+// ScannerTracker 记录各链监听服务最近一次上报的区块，用于计算扫描延迟
+type ScannerTracker struct {
+	maxLag time.Duration
+
+	mu    sync.RWMutex
+	heads map[string]*model.CryptoScannerStatus
+}
+
+func NewScannerTracker() *ScannerTracker {
+	return &ScannerTracker{
+		maxLag: envDuration("SCANNER_MAX_LAG", 5*time.Minute),
+		heads:  make(map[string]*model.CryptoScannerStatus),
+	}
+}
+
+// Observe 记录一次心跳或入账，区块高度回退的上报忽略
+func (st *ScannerTracker) Observe(network string, height int64, blockTime *time.Time) {
+	network = strings.ToUpper(strings.TrimSpace(network))
+	if network == "" {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	head, ok := st.heads[network]
+	if !ok {
+		head = &model.CryptoScannerStatus{Network: network}
+		st.heads[network] = head
+	}
+	head.LastSeenAt = &now
+	if height > 0 && height < head.LastBlockHeight {
+		return
+	}
+	if height > 0 {
+		head.LastBlockHeight = height
+	}
+	if blockTime != nil {
+		bt := *blockTime
+		head.LastBlockTime = &bt
+	}
+}
+
+// Snapshot 返回全部支持网络的监听状态。有区块时间时以区块时间计算延迟，否则以最近上报时间计算
+func (st *ScannerTracker) Snapshot(now time.Time) []model.CryptoScannerStatus {
+	networks := make(map[string]bool)
+	for _, asset := range SupportedAssets() {
+		networks[asset.Network] = true
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	for network := range st.heads {
+		networks[network] = true
+	}
+
+	statuses := make([]model.CryptoScannerStatus, 0, len(networks))
+	for network := range networks {
+		head, ok := st.heads[network]
+		if !ok {
+			statuses = append(statuses, model.CryptoScannerStatus{Network: network, Status: model.ScannerUnknown})
+			continue
+		}
+		status := *head
+		reference := *head.LastSeenAt
+		if head.LastBlockTime != nil {
+			reference = *head.LastBlockTime
+		}
+		lag := now.Sub(reference)
+		if lag < 0 {
+			lag = 0
+		}
+		status.LagSeconds = int(lag.Seconds())
+		status.Status = model.ScannerOK
+		if lag > st.maxLag {
+			status.Status = model.ScannerLagging
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Network < statuses[j].Network })
+	return statuses
+}
+
+// Status 汇总账单存储、链上监听和人工复核积压
+func (cs *CryptoService) Status() *model.CryptoGatewayStatus {
+	now := time.Now()
+	status := &model.CryptoGatewayStatus{
+		Ready:         true,
+		Scanners:      cs.scanners.Snapshot(now),
+		Endpoints:     cs.endpointStatuses(now),
+		ReviewBacklog: len(cs.reviews.List(ReviewOpen)),
+		GeneratedAt:   now,
+	}
+
+	invoices, err := cs.invoices.List()
+	if err != nil {
+		status.Ready = false
+		status.Error = err.Error()
+		return status
+	}
+	for _, invoice := range invoices {
+		switch invoice.Status {
+		case InvoicePending:
+			status.PendingInvoices++
+		case InvoiceConfirming:
+			status.ConfirmingInvoices++
+		case InvoiceUnderpaid, InvoiceOverpaid:
+			status.MismatchedInvoices++
+		}
+	}
+	return status
+}
+
+// registerStatusRoutes 注册网关状态和链上监听心跳接口
+func registerStatusRoutes(api *gin.RouterGroup, cs *CryptoService) {
+	api.GET("/crypto/status", func(c *gin.Context) {
+		apierr.RespondOK(c, cs.Status())
+	})
+
+	// 链上监听服务即使没有入账也要定时上报，否则无法区分“没有交易”和“监听停止”。
+	// 心跳只用于监听存活和延迟统计，上报的区块高度不推进确认数，确认数由网关按节点查询的链头和交易所在区块推进
+	api.POST("/crypto/scanner/heartbeat", func(c *gin.Context) {
+		var req ScannerHeartbeat
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		cs.scanners.Observe(req.Network, req.BlockHeight, req.BlockTime)
+		apierr.RespondOK(c, gin.H{"network": strings.ToUpper(req.Network)})
+	})
+}
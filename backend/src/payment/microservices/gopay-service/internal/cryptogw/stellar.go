@@ -0,0 +1,171 @@
+package cryptogw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// StellarLedger 通过 Horizon API（XLM_HORIZON_URLS 逗号分隔，如 https://horizon.stellar.org，多个地址按健康评分故障切换）
+// 核验外部监听服务上报的 Stellar 入账，并按最新账本推进确认数。Horizon 只收录已关闭的账本，查到的交易即已最终确认；
+// 转入收款账户的 payment、path payment 和 create_account 操作均计入到账，只接受原生 XLM
+type StellarLedger struct {
+	crypto *CryptoService
+	hub    *CheckoutHub
+	pool   *EndpointPool
+	client *http.Client
+}
+
+// NewStellarLedger 未配置 XLM_HORIZON_URLS 时返回 nil
+func NewStellarLedger(crypto *CryptoService, hub *CheckoutHub) *StellarLedger {
+	var urls []string
+	for _, raw := range splitList(os.Getenv("XLM_HORIZON_URLS")) {
+		urls = append(urls, strings.TrimRight(raw, "/"))
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	w := &StellarLedger{
+		crypto: crypto,
+		hub:    hub,
+		pool:   crypto.newEndpointPool("XLM", "XLM", urls),
+		client: &http.Client{Timeout: envDuration("RPC_HTTP_TIMEOUT", 10*time.Second)},
+	}
+	crypto.registerChain("XLM", w)
+	return w
+}
+
+func (w *StellarLedger) Run(ctx context.Context) {
+	log.Printf("Stellar 入账核验已启动，%d 个节点", w.pool.Len())
+	go w.pool.RunHealthChecks(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		var root struct{}
+		return requestLedgerJSON(ctx, w.client, ep.URL+"/", nil, &root)
+	})
+	w.crypto.trackLedger(ctx, w.hub, "XLM", w)
+}
+
+type stellarTx struct {
+	Hash       string `json:"hash"`
+	Ledger     int64  `json:"ledger"`
+	Successful bool   `json:"successful"`
+	MemoType   string `json:"memo_type"`
+	Memo       string `json:"memo"`
+}
+
+// tx 按哈希查询交易，不存在时返回 nil
+func (w *StellarLedger) tx(ctx context.Context, txHash string) (*stellarTx, error) {
+	var tx stellarTx
+	err := getLedgerJSON(ctx, w.pool, w.client, "/transactions/"+url.PathEscape(txHash), nil, &tx)
+	if errors.Is(err, errLedgerNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Head 最新账本序号
+func (w *StellarLedger) Head(ctx context.Context) (int64, error) {
+	var root struct {
+		HistoryLatestLedger int64 `json:"history_latest_ledger"`
+	}
+	if err := getLedgerJSON(ctx, w.pool, w.client, "/", nil, &root); err != nil {
+		return 0, err
+	}
+	return root.HistoryLatestLedger, nil
+}
+
+// LocateTx 交易所在账本
+func (w *StellarLedger) LocateTx(ctx context.Context, txHash string) (TxLocation, bool, error) {
+	tx, err := w.tx(ctx, txHash)
+	if err != nil || tx == nil {
+		return TxLocation{}, false, err
+	}
+	return TxLocation{Height: tx.Ledger}, true, nil
+}
+
+// FetchTx 按哈希查询交易及其操作，转入原生 XLM 的操作作为转账，交易的 MEMO_ID 或 MEMO_TEXT 作为标签
+func (w *StellarLedger) FetchTx(ctx context.Context, txHash string) (*ChainTx, error) {
+	tx, err := w.tx(ctx, txHash)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	head, err := w.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var operations struct {
+		Embedded struct {
+			Records []struct {
+				Type            string `json:"type"`
+				To              string `json:"to"`
+				Account         string `json:"account"` // create_account 新建的账户
+				AssetType       string `json:"asset_type"`
+				Amount          string `json:"amount"`
+				StartingBalance string `json:"starting_balance"`
+			} `json:"records"`
+		} `json:"_embedded"`
+	}
+	if err := getLedgerJSON(ctx, w.pool, w.client, "/transactions/"+url.PathEscape(txHash)+"/operations?limit=200", nil, &operations); err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: tx.Hash, BlockHeight: tx.Ledger, Head: head, Failed: !tx.Successful}
+	memo := ""
+	if tx.MemoType == "id" || tx.MemoType == "text" {
+		memo = strings.TrimSpace(tx.Memo)
+	}
+	for _, op := range operations.Embedded.Records {
+		to, amount := op.To, op.Amount
+		switch op.Type {
+		case "payment", "path_payment_strict_receive", "path_payment_strict_send":
+			if op.AssetType != "native" {
+				continue
+			}
+		case "create_account":
+			to, amount = op.Account, op.StartingBalance
+		default:
+			continue
+		}
+		units, err := decimalUnits(amount, 7)
+		if err != nil {
+			return nil, fmt.Errorf("交易 %s 的转账数量无效: %w", txHash, err)
+		}
+		result.Transfers = append(result.Transfers, ChainTransfer{To: to, Currency: "XLM", Units: units, Memo: memo})
+	}
+	return result, nil
+}
+
+// Balance 账户的原生 XLM 余额（stroops），未激活的账户为 0
+func (w *StellarLedger) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	if asset.Currency != "XLM" {
+		return nil, fmt.Errorf("Stellar 不支持 %s", asset.Currency)
+	}
+	var account struct {
+		Balances []struct {
+			AssetType string `json:"asset_type"`
+			Balance   string `json:"balance"`
+		} `json:"balances"`
+	}
+	err := getLedgerJSON(ctx, w.pool, w.client, "/accounts/"+url.PathEscape(address), nil, &account)
+	if errors.Is(err, errLedgerNotFound) {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, balance := range account.Balances {
+		if balance.AssetType == "native" {
+			return decimalUnits(balance.Balance, 7)
+		}
+	}
+	return new(big.Int), nil
+}
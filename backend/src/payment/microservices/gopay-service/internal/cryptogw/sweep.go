@@ -0,0 +1,621 @@
+package cryptogw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// 归集状态
+const (
+	SweepFunding   = "funding"   // 收款地址的原生币不足以支付代币转账的网络费，已从热钱包补充，等待到账
+	SweepBroadcast = "broadcast" // 归集交易已广播，跟踪确认数
+	SweepConfirmed = "confirmed" // 归集交易达到所需确认数
+	SweepFailed    = "failed"    // 交易未能上链或执行失败，余额仍在收款地址，下一轮重新归集
+)
+
+var ErrSweepNotFound = errors.New("归集记录不存在")
+
+// errSweepDeferred 本轮暂不归集（如网络费占比过高），下一轮重新检查，不记入台账
+var errSweepDeferred = errors.New("暂缓归集")
+
+// feeCurrencies 各网络支付网络费的原生币
+var feeCurrencies = map[string]string{
+	"BTC":     "BTC",
+	"ERC20":   "ETH",
+	"BEP20":   "BNB",
+	"POLYGON": "POL",
+	"TRC20":   "TRX",
+}
+
+// defaultSweepMinimums 各币种默认的归集门槛，可用 SWEEP_MIN_<币种>_<网络> 覆盖。
+// 代币归集的网络费与金额无关，门槛过低时网络费可能超过归集的金额
+var defaultSweepMinimums = map[string]string{
+	"USDT": "50",
+	"ETH":  "0.02",
+	"BTC":  "0.001",
+}
+
+// SweepSource 归集的一个收款地址
+type SweepSource struct {
+	Address string   `json:"address"`
+	Index   uint32   `json:"index"`
+	Path    string   `json:"path"`
+	Amount  string   `json:"amount"`
+	Inputs  []string `json:"inputs,omitempty"` // 比特币归集花费的输出（txid:vout）
+}
+
+// SweepRecord 归集台账中的一笔归集
+type SweepRecord struct {
+	SweepID               string        `json:"sweepId"`
+	Currency              string        `json:"currency"`
+	Network               string        `json:"network"`
+	Sources               []SweepSource `json:"sources"`
+	ToAddress             string        `json:"toAddress"`
+	Amount                string        `json:"amount"` // 转入归集地址的数量
+	Status                string        `json:"status"`
+	Fee                   string        `json:"fee,omitempty"` // 归集交易的网络费，EVM 和 TRON 为按上限计算的最高值
+	FeeCurrency           string        `json:"feeCurrency"`
+	FundingTxHash         string        `json:"fundingTxHash,omitempty"` // 热钱包补充网络费的交易
+	FundingAmount         string        `json:"fundingAmount,omitempty"` // 补充的原生币数量
+	FundingNonce          *uint64       `json:"fundingNonce,omitempty"`  // EVM 补充交易的热钱包 nonce，重新补充时沿用
+	TxHash                string        `json:"txHash,omitempty"`
+	BlockHeight           int64         `json:"blockHeight,omitempty"`
+	Confirmations         int           `json:"confirmations,omitempty"`
+	RequiredConfirmations int           `json:"requiredConfirmations,omitempty"`
+	MissingSince          time.Time     `json:"missingSince,omitempty"` // 补充或归集交易既不在链上也不在交易池的起始时间
+	Error                 string        `json:"error,omitempty"`
+	BroadcastAt           time.Time     `json:"broadcastAt,omitempty"`
+	ConfirmedAt           time.Time     `json:"confirmedAt,omitempty"`
+	CreatedAt             time.Time     `json:"createdAt"`
+	UpdatedAt             time.Time     `json:"updatedAt"`
+}
+
+func newSweep(asset Asset, toAddress string, units *big.Int, sources ...SweepSource) *SweepRecord {
+	return &SweepRecord{
+		SweepID:     fmt.Sprintf("SW%d", time.Now().UnixNano()),
+		Currency:    asset.Currency,
+		Network:     asset.Network,
+		Sources:     sources,
+		ToAddress:   toAddress,
+		Amount:      formatAmount(new(big.Rat).SetFrac(units, pow10(asset.Decimals())), asset.Decimals()),
+		FeeCurrency: feeCurrencies[asset.Network],
+	}
+}
+
+// units 归集数量，以链上最小单位计
+func (sweep *SweepRecord) units() *big.Int {
+	amount, ok := new(big.Rat).SetString(sweep.Amount)
+	if !ok {
+		return new(big.Int)
+	}
+	scaled := amount.Mul(amount, new(big.Rat).SetInt(pow10(Asset{Currency: sweep.Currency, Network: sweep.Network}.Decimals())))
+	return new(big.Int).Quo(scaled.Num(), scaled.Denom())
+}
+
+// setUnits 按最小单位更新归集数量
+func (sweep *SweepRecord) setUnits(units *big.Int) {
+	decimals := Asset{Currency: sweep.Currency, Network: sweep.Network}.Decimals()
+	sweep.Amount = formatAmount(new(big.Rat).SetFrac(units, pow10(decimals)), decimals)
+}
+
+// sweepMinimum 币种的归集门槛，以链上最小单位计
+func sweepMinimum(asset Asset) *big.Int {
+	raw := envString("SWEEP_MIN_"+asset.Key(), defaultSweepMinimums[asset.Currency])
+	amount, ok := new(big.Rat).SetString(raw)
+	if !ok || amount.Sign() <= 0 {
+		return big.NewInt(1)
+	}
+	scaled := amount.Mul(amount, new(big.Rat).SetInt(pow10(asset.Decimals())))
+	return new(big.Int).Quo(scaled.Num(), scaled.Denom())
+}
+
+// SweepLedger 归集台账，记录每笔归集转出的收款地址、数量、网络费和交易
+type SweepLedger struct {
+	mu     sync.RWMutex
+	sweeps map[string]*SweepRecord
+	table  *queueTable // 为 nil 时只保存在内存中
+}
+
+func NewSweepLedger() *SweepLedger {
+	return &SweepLedger{sweeps: make(map[string]*SweepRecord)}
+}
+
+func (l *SweepLedger) Save(sweep *SweepRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if sweep.CreatedAt.IsZero() {
+		sweep.CreatedAt = now
+	}
+	sweep.UpdatedAt = now
+	copied := *sweep
+	copied.Sources = append([]SweepSource(nil), sweep.Sources...)
+	l.sweeps[sweep.SweepID] = &copied
+	l.table.save(sweep.SweepID, sweep.Status, sweep.CreatedAt, sweep.UpdatedAt, sweep)
+}
+
+func (l *SweepLedger) Get(sweepID string) (*SweepRecord, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	sweep, ok := l.sweeps[sweepID]
+	if !ok {
+		return nil, ErrSweepNotFound
+	}
+	copied := *sweep
+	copied.Sources = append([]SweepSource(nil), sweep.Sources...)
+	return &copied, nil
+}
+
+// List 按创建时间顺序返回指定状态和网络的归集，参数为空时不过滤
+func (l *SweepLedger) List(status, network string) []*SweepRecord {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var sweeps []*SweepRecord
+	for _, sweep := range l.sweeps {
+		if (status == "" || sweep.Status == status) && (network == "" || sweep.Network == network) {
+			copied := *sweep
+			copied.Sources = append([]SweepSource(nil), sweep.Sources...)
+			sweeps = append(sweeps, &copied)
+		}
+	}
+	sort.Slice(sweeps, func(i, j int) bool {
+		return sweeps[i].CreatedAt.Before(sweeps[j].CreatedAt)
+	})
+	return sweeps
+}
+
+// SweepSummary 单个币种网络的归集汇总
+type SweepSummary struct {
+	Currency    string `json:"currency"`
+	Network     string `json:"network"`
+	Confirmed   int    `json:"confirmed"`
+	Swept       string `json:"swept"` // 已确认归集的数量
+	InFlight    int    `json:"inFlight"`
+	Pending     string `json:"pending"` // 补充网络费中和已广播未确认的数量
+	Failed      int    `json:"failed"`
+	Fees        string `json:"fees"` // 已广播的归集交易的网络费合计，不含失败前未上链的交易
+	FeeCurrency string `json:"feeCurrency"`
+}
+
+func (l *SweepLedger) Summary() []SweepSummary {
+	type totals struct {
+		summary        SweepSummary
+		swept, pending *big.Rat
+		fees           *big.Rat
+	}
+	byAsset := make(map[string]*totals)
+	for _, sweep := range l.List("", "") {
+		asset := Asset{Currency: sweep.Currency, Network: sweep.Network}
+		t, ok := byAsset[asset.Key()]
+		if !ok {
+			t = &totals{
+				summary: SweepSummary{Currency: asset.Currency, Network: asset.Network, FeeCurrency: sweep.FeeCurrency},
+				swept:   new(big.Rat), pending: new(big.Rat), fees: new(big.Rat),
+			}
+			byAsset[asset.Key()] = t
+		}
+		amount, _ := new(big.Rat).SetString(sweep.Amount)
+		if amount == nil {
+			amount = new(big.Rat)
+		}
+		switch sweep.Status {
+		case SweepConfirmed:
+			t.summary.Confirmed++
+			t.swept.Add(t.swept, amount)
+		case SweepFunding, SweepBroadcast:
+			t.summary.InFlight++
+			t.pending.Add(t.pending, amount)
+		case SweepFailed:
+			t.summary.Failed++
+		}
+		if fee, ok := new(big.Rat).SetString(sweep.Fee); ok && sweep.TxHash != "" {
+			t.fees.Add(t.fees, fee)
+		}
+	}
+
+	summaries := make([]SweepSummary, 0, len(byAsset))
+	for _, t := range byAsset {
+		decimals := Asset{Currency: t.summary.Currency, Network: t.summary.Network}.Decimals()
+		t.summary.Swept = formatAmount(t.swept, decimals)
+		t.summary.Pending = formatAmount(t.pending, decimals)
+		t.summary.Fees = formatAmount(t.fees, 18)
+		summaries = append(summaries, t.summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Network+summaries[i].Currency < summaries[j].Network+summaries[j].Currency
+	})
+	return summaries
+}
+
+// SweepSender 链上监听器实现，把收款地址的余额转到归集地址
+type SweepSender interface {
+	// PlanSweeps 查询候选地址的余额，返回达到归集门槛、待发送的归集
+	PlanSweeps(ctx context.Context, addresses []*PooledAddress, toAddress string) ([]*SweepRecord, error)
+	// SendSweep 签名并广播归集交易，广播后置为 broadcast，广播结果不确定时同样置为 broadcast 并返回错误。
+	// 代币转账的网络费不足时先从热钱包补充并置为 funding，补充到账后再次调用时转出
+	SendSweep(ctx context.Context, sweep *SweepRecord, keys *hdKeystore) error
+}
+
+// registerSweepSender 登记网络的归集接口，由链上监听器创建时调用
+func (cs *CryptoService) registerSweepSender(network string, sender SweepSender) {
+	cs.chainsMu.Lock()
+	defer cs.chainsMu.Unlock()
+	if cs.sweepSenders == nil {
+		cs.sweepSenders = make(map[string]SweepSender)
+	}
+	cs.sweepSenders[network] = sender
+}
+
+func (cs *CryptoService) sweepSender(network string) SweepSender {
+	cs.chainsMu.RLock()
+	defer cs.chainsMu.RUnlock()
+	return cs.sweepSenders[network]
+}
+
+// Sweeper 定期把收款地址中的余额归集到归集地址（SWEEP_ADDRESS_<网络>，未配置时取 SWEEP_ADDRESS_<BTC|EVM|TRON>，通常为冷钱包）。
+// 收款地址的私钥来自 SWEEP_KEYSTORE_<BTC|EVM|TRON> 指向的扩展私钥密钥库（见 hdKeystore），未配置的链不归集。
+// 只归集已收款、没有待确认入账且不在迟到转账监听期内的地址，余额不低于 SWEEP_MIN_<币种>_<网络> 时才转出；
+// 原生币的网络费超过余额的 SWEEP_MAX_FEE_RATIO（默认 5%）时暂缓。代币转账的网络费不足时先从热钱包补充原生币。
+// 比特币把多个地址的输出合并为一笔交易，EVM 和 TRON 每个地址一笔。每轮最多检查每个网络 SWEEP_BATCH_SIZE 个地址，
+// 检查过且此后没有新入账的地址在 SWEEP_RECHECK_INTERVAL 内不再查询余额
+type Sweeper struct {
+	crypto       *CryptoService
+	interval     time.Duration
+	recheck      time.Duration
+	batch        int
+	destinations map[string]string      // 网络 -> 归集地址
+	keys         map[string]*hdKeystore // 地址派生链 -> 扩展私钥
+
+	runMu   sync.Mutex // 定时归集和手动触发不并发执行
+	checked map[string]time.Time
+}
+
+// NewSweeper 读取归集地址和扩展私钥，配置无效的链告警后不归集
+func NewSweeper(crypto *CryptoService) *Sweeper {
+	s := &Sweeper{
+		crypto:       crypto,
+		interval:     envDuration("SWEEP_INTERVAL", time.Hour),
+		recheck:      envDuration("SWEEP_RECHECK_INTERVAL", 24*time.Hour),
+		batch:        envInt("SWEEP_BATCH_SIZE", 50),
+		destinations: make(map[string]string),
+		keys:         make(map[string]*hdKeystore),
+		checked:      make(map[string]time.Time),
+	}
+	wallet := crypto.addresses.wallet
+	for chain, hc := range wallet.chains {
+		upper := strings.ToUpper(chain)
+		path := os.Getenv("SWEEP_KEYSTORE_" + upper)
+		if path == "" {
+			continue
+		}
+		keys, err := newHDKeystore(path, hc.external)
+		if err != nil {
+			log.Printf("【警告】SWEEP_KEYSTORE_%s 不可用，%s 链不归集: %v", upper, chain, err)
+			continue
+		}
+		s.keys[chain] = keys
+	}
+	for network, chain := range networkChains {
+		if s.keys[chain] == nil {
+			continue
+		}
+		destination := envString("SWEEP_ADDRESS_"+network, os.Getenv("SWEEP_ADDRESS_"+strings.ToUpper(chain)))
+		if destination == "" {
+			continue
+		}
+		if err := wallet.ValidateAddress(network, destination); err != nil {
+			log.Printf("【警告】%s 归集地址无效，不归集: %v", networkNames[network], err)
+			continue
+		}
+		s.destinations[network] = destination
+	}
+	return s
+}
+
+func (s *Sweeper) Run(ctx context.Context) {
+	if len(s.destinations) == 0 {
+		return
+	}
+	log.Printf("归集任务已启动，间隔 %s，网络: %s", s.interval, strings.Join(s.networks(), ","))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		}
+	}
+}
+
+func (s *Sweeper) networks() []string {
+	networks := make([]string, 0, len(s.destinations))
+	for network := range s.destinations {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// RunOnce 跟踪进行中的归集并发起新的归集，返回状态有变化的归集
+func (s *Sweeper) RunOnce(ctx context.Context) []*SweepRecord {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	changed := s.track(ctx)
+	for _, network := range s.networks() {
+		sender := s.crypto.sweepSender(network)
+		if sender == nil {
+			continue
+		}
+		keys := s.keys[networkChains[network]]
+		for _, sweep := range s.crypto.sweeps.List(SweepFunding, network) {
+			if s.send(ctx, sender, sweep, keys) {
+				changed = append(changed, sweep)
+			}
+		}
+
+		candidates, err := s.candidates(network)
+		if err != nil {
+			log.Printf("查询 %s 待归集地址失败: %v", networkNames[network], err)
+			continue
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		planned, err := sender.PlanSweeps(ctx, candidates, s.destinations[network])
+		if err != nil {
+			log.Printf("查询 %s 收款地址余额失败: %v", networkNames[network], err)
+		}
+		// 查询过且没有达到门槛的地址在有新入账或到期前不再查询
+		pending := make(map[string]bool)
+		for _, sweep := range planned {
+			for _, source := range sweep.Sources {
+				pending[source.Address] = true
+			}
+		}
+		now := time.Now()
+		for _, addr := range candidates {
+			if !pending[addr.Address] && err == nil {
+				s.checked[addr.Address] = now
+			}
+		}
+		for _, sweep := range planned {
+			if s.send(ctx, sender, sweep, keys) {
+				changed = append(changed, sweep)
+			}
+		}
+	}
+	return changed
+}
+
+// send 发送一笔归集，状态或交易有变化时返回 true
+func (s *Sweeper) send(ctx context.Context, sender SweepSender, sweep *SweepRecord, keys *hdKeystore) bool {
+	previous, previousTx, previousFunding := sweep.Status, sweep.TxHash, sweep.FundingTxHash
+	err := sender.SendSweep(ctx, sweep, keys)
+	switch {
+	case errors.Is(err, errSweepDeferred):
+		log.Printf("归集 %s %s %s: %v", sweep.Sources[0].Address, sweep.Amount, sweep.Currency, err)
+		for _, source := range sweep.Sources {
+			s.checked[source.Address] = time.Now()
+		}
+		return false
+	case err != nil && sweep.Status == "":
+		log.Printf("【警告】归集 %s %s %s 失败: %v", sweep.Sources[0].Address, sweep.Amount, sweep.Currency, err)
+		return false
+	case err != nil:
+		sweep.Error = err.Error()
+	default:
+		sweep.Error = ""
+	}
+	if sweep.Status == SweepBroadcast && previousTx != sweep.TxHash {
+		sweep.BroadcastAt = time.Now()
+		sweep.RequiredConfirmations = requiredConfirmations(sweep.Network)
+		sweep.MissingSince = time.Time{}
+		log.Printf("归集 %s 已广播: %d 个地址共 %s %s 转入 %s，交易 %s", sweep.SweepID, len(sweep.Sources), sweep.Amount, sweep.Currency, sweep.ToAddress, sweep.TxHash)
+	} else if sweep.Status == SweepFunding && previousFunding != sweep.FundingTxHash {
+		log.Printf("归集 %s 已从热钱包向 %s 补充 %s %s 网络费，交易 %s", sweep.SweepID, sweep.Sources[0].Address, sweep.FundingAmount, sweep.FeeCurrency, sweep.FundingTxHash)
+	}
+	// 等待补充交易上链期间也保存，记录交易不在链上的起始时间
+	s.crypto.sweeps.Save(sweep)
+	return err != nil || sweep.Status != previous || sweep.TxHash != previousTx || sweep.FundingTxHash != previousFunding
+}
+
+// candidates 本轮需要查询余额的收款地址：已收款，没有待确认的入账、进行中的归集，
+// 也不在迟到转账的监听期内（补充网络费的转账不会被误当作入账），且自上次查询后有新入账或已到期
+func (s *Sweeper) candidates(network string) ([]*PooledAddress, error) {
+	addresses, err := s.crypto.addresses.store.List(networkChains[network])
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := s.crypto.invoices.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	busy := make(map[string]bool)
+	lastPaid := make(map[string]time.Time)
+	for _, invoice := range invoices {
+		switch {
+		case invoice.Status == InvoicePending, invoice.Status == InvoiceConfirming,
+			invoice.Status == InvoiceExpired && now.Sub(invoice.ExpiresAt) <= s.crypto.addresses.cooldown:
+			busy[invoice.Address] = true
+		}
+		if invoice.PaidAt.After(lastPaid[invoice.Address]) {
+			lastPaid[invoice.Address] = invoice.PaidAt
+		}
+	}
+	for _, sweep := range s.crypto.sweeps.List("", network) {
+		if sweep.Status == SweepFunding || sweep.Status == SweepBroadcast {
+			for _, source := range sweep.Sources {
+				busy[source.Address] = true
+			}
+		}
+	}
+
+	var candidates []*PooledAddress
+	for _, addr := range addresses {
+		if addr.Status != AddressUsed || addr.Network != network || busy[addr.Address] {
+			continue
+		}
+		if checked, ok := s.checked[addr.Address]; ok && checked.After(lastPaid[addr.Address]) && now.Sub(checked) < s.recheck {
+			continue
+		}
+		candidates = append(candidates, addr)
+		if len(candidates) >= s.batch {
+			break
+		}
+	}
+	return candidates, nil
+}
+
+// track 按链上交易推进已广播的归集
+func (s *Sweeper) track(ctx context.Context) []*SweepRecord {
+	var changed []*SweepRecord
+	for _, sweep := range s.crypto.sweeps.List(SweepBroadcast, "") {
+		reader := s.crypto.chainReader(sweep.Network)
+		if reader == nil {
+			continue
+		}
+		tx, err := reader.FetchTx(ctx, sweep.TxHash)
+		if err != nil {
+			log.Printf("查询归集交易 %s 失败: %v", sweep.TxHash, err)
+			continue
+		}
+		if s.applySweepTx(sweep, tx, time.Now()) {
+			s.crypto.sweeps.Save(sweep)
+			changed = append(changed, sweep)
+		}
+	}
+	return changed
+}
+
+// applySweepTx 按链上交易更新归集，有变化时返回 true
+func (s *Sweeper) applySweepTx(sweep *SweepRecord, tx *ChainTx, now time.Time) bool {
+	previous := *sweep
+	switch {
+	case tx == nil:
+		sweep.BlockHeight, sweep.Confirmations = 0, 0
+		if sweep.MissingSince.IsZero() {
+			sweep.MissingSince = now
+		}
+		if now.Sub(sweep.MissingSince) > envDuration("REORG_FAIL_AFTER", time.Hour) {
+			sweep.Status = SweepFailed
+			sweep.Error = fmt.Sprintf("归集交易自 %s 起不在链上或交易池中", sweep.MissingSince.Format(time.RFC3339))
+		}
+	case tx.Failed:
+		sweep.Status = SweepFailed
+		sweep.Error = "归集交易执行失败"
+	default:
+		sweep.MissingSince = time.Time{}
+		sweep.BlockHeight, sweep.Confirmations = tx.BlockHeight, 0
+		if tx.BlockHeight > 0 && tx.Head >= tx.BlockHeight {
+			sweep.Confirmations = int(tx.Head-tx.BlockHeight) + 1
+		}
+		if sweep.Confirmations < sweep.RequiredConfirmations {
+			break
+		}
+		received := new(big.Int)
+		for _, transfer := range tx.Transfers {
+			if transfer.Currency == sweep.Currency && strings.EqualFold(transfer.To, sweep.ToAddress) {
+				received.Add(received, transfer.Units)
+			}
+		}
+		if received.Cmp(sweep.units()) < 0 {
+			sweep.Status = SweepFailed
+			sweep.Error = fmt.Sprintf("交易 %s 未向归集地址足额转入 %s %s", sweep.TxHash, sweep.Amount, sweep.Currency)
+		} else {
+			sweep.Status = SweepConfirmed
+			sweep.ConfirmedAt = now
+		}
+	}
+
+	if sweep.Status == previous.Status && sweep.BlockHeight == previous.BlockHeight &&
+		sweep.Confirmations == previous.Confirmations && sweep.MissingSince.Equal(previous.MissingSince) {
+		return false
+	}
+	switch sweep.Status {
+	case SweepConfirmed:
+		log.Printf("归集 %s 已确认: %s %s 转入 %s", sweep.SweepID, sweep.Amount, sweep.Currency, sweep.ToAddress)
+	case SweepFailed:
+		log.Printf("【警告】归集 %s 失败，余额留在收款地址，下一轮重新归集: %s", sweep.SweepID, sweep.Error)
+		// 失败的地址下一轮立即重新检查
+		for _, source := range sweep.Sources {
+			delete(s.checked, source.Address)
+		}
+	}
+	return true
+}
+
+// fundingStatus 补充网络费交易的状态：已上链、等待中，或已确定不会上链需要重新补充
+func fundingStatus(sweep *SweepRecord, tx *ChainTx, now time.Time) (confirmed, retry bool) {
+	switch {
+	case tx == nil:
+		if sweep.MissingSince.IsZero() {
+			sweep.MissingSince = now
+		}
+		return false, now.Sub(sweep.MissingSince) > envDuration("REORG_FAIL_AFTER", time.Hour)
+	case tx.Failed:
+		return false, true
+	default:
+		sweep.MissingSince = time.Time{}
+		return tx.BlockHeight > 0, false
+	}
+}
+
+// registerSweepRoutes 注册归集台账查询和手动触发接口
+func registerSweepRoutes(api *gin.RouterGroup, cs *CryptoService, sweeper *Sweeper) {
+	admin := api.Group("/crypto/admin")
+
+	admin.GET("/sweeps", func(c *gin.Context) {
+		apierr.RespondOK(c, cs.sweeps.List(c.Query("status"), strings.ToUpper(c.Query("network"))))
+	})
+
+	admin.GET("/sweeps/summary", func(c *gin.Context) {
+		apierr.RespondOK(c, cs.sweeps.Summary())
+	})
+
+	admin.GET("/sweeps/:sweepId", func(c *gin.Context) {
+		sweep, err := cs.sweeps.Get(c.Param("sweepId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "SWEEP_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, sweep)
+	})
+
+	// 立即执行一轮归集，返回状态有变化的归集
+	admin.POST("/sweeps/run", func(c *gin.Context) {
+		if len(sweeper.destinations) == 0 {
+			apierr.RespondError(c, http.StatusConflict, "SWEEP_DISABLED", "未配置归集地址和收款账户密钥库")
+			return
+		}
+		if operator := httpmw.Operator(c); operator != "" {
+			log.Printf("手动触发归集，操作人 %s", operator)
+		}
+		changed := sweeper.RunOnce(c.Request.Context())
+		if changed == nil {
+			changed = []*SweepRecord{}
+		}
+		apierr.RespondOK(c, changed)
+	})
+}
@@ -0,0 +1,98 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+)
+
+// hdKeystore 收款账户的扩展私钥，以 crypto-keystore -xprv 加密保存，归集时为收款地址签名。
+// 云 KMS 不支持 BIP32 派生，收款地址的私钥无法逐个放入 KMS，只能以加密的扩展私钥保管；
+// 与 keystoreSigner 相同，每次签名时才解密并派生私钥，签名后清零
+type hdKeystore struct {
+	path     string
+	external *hdkeychain.ExtendedKey // HD_XPUB_* 的外部链，取收款地址的公钥不需要解密
+}
+
+// newHDKeystore 解密一次核对扩展私钥与扩展公钥属于同一账户，避免签出的交易花费不了收款地址的余额
+func newHDKeystore(path string, external *hdkeychain.ExtendedKey) (*hdKeystore, error) {
+	ks := &hdKeystore{path: path, external: external}
+	child, err := ks.deriveExternal()
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	expected, err := external.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	if !pubKey.IsEqual(expected) || !bytes.Equal(child.ChainCode(), external.ChainCode()) {
+		return nil, fmt.Errorf("密钥库 %s 中的扩展私钥与 HD_XPUB 不属于同一账户", path)
+	}
+	return ks, nil
+}
+
+// deriveExternal 解密扩展私钥并派生外部链 .../0
+func (ks *hdKeystore) deriveExternal() (*hdkeychain.ExtendedKey, error) {
+	_, secret, err := openKeystore(ks.path)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(secret)
+	account, err := hdkeychain.NewKeyFromString(string(secret))
+	if err != nil || !account.IsPrivate() {
+		return nil, fmt.Errorf("密钥库 %s 保存的不是扩展私钥", ks.path)
+	}
+	return account.Derive(0)
+}
+
+// signer 派生序号为 index 的收款地址的签名器
+func (ks *hdKeystore) signer(index uint32) (Signer, error) {
+	child, err := ks.external.Derive(index)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return &hdAddressSigner{keystore: ks, index: index, pubKey: pubKey}, nil
+}
+
+type hdAddressSigner struct {
+	keystore *hdKeystore
+	index    uint32
+	pubKey   *btcec.PublicKey
+}
+
+func (s *hdAddressSigner) PublicKey() *btcec.PublicKey {
+	return s.pubKey
+}
+
+func (s *hdAddressSigner) SignDigest(_ context.Context, digest []byte) ([]byte, error) {
+	external, err := s.keystore.deriveExternal()
+	if err != nil {
+		return nil, err
+	}
+	child, err := external.Derive(s.index)
+	if err != nil {
+		return nil, err
+	}
+	key, err := child.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	sig, err := ecdsa.SignCompact(key, digest, false)
+	if err != nil {
+		return nil, err
+	}
+	return sig[1:], nil
+}
@@ -0,0 +1,293 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 代币登记来源，后者覆盖前者
+const (
+	TokenSourceBuiltin = "builtin"
+	TokenSourceFile    = "file" // CRYPTO_TOKENS_FILE
+	TokenSourceDB      = "db"   // crypto_tokens 表
+	TokenSourceEnv     = "env"  // <币种>_<网络>_CONTRACT，Solana 为 <币种>_SOL_MINT
+)
+
+// errNotContract 登记的合约地址上没有合约代码
+var errNotContract = errors.New("合约地址上没有合约代码")
+
+// Token 登记的代币：币种、所在网络、合约地址（Solana 为 mint 地址）和链上精度
+type Token struct {
+	Symbol   string `json:"symbol"`
+	Network  string `json:"network"`
+	Contract string `json:"contract"`
+	Decimals int    `json:"decimals"`
+	Disabled bool   `json:"disabled,omitempty"` // 已下架：不能下单，已下单的账单仍按登记的精度入账
+	Source   string `json:"source,omitempty"`
+	Verified bool   `json:"verified,omitempty"` // 已通过链上节点核对合约存在且精度一致
+}
+
+func (t Token) Asset() Asset {
+	return Asset{Currency: t.Symbol, Network: t.Network}
+}
+
+// builtinTokens 内置的稳定币合约，均为各链上官方发行的合约
+var builtinTokens = []Token{
+	{Symbol: "USDT", Network: "ERC20", Contract: "0xdAC17F958D2ee523a2206206994597C13D831ec7", Decimals: 6},
+	{Symbol: "USDT", Network: "BEP20", Contract: "0x55d398326f99059fF775485246999027B3197955", Decimals: 18},
+	{Symbol: "USDT", Network: "POLYGON", Contract: "0xc2132D05D31c914a87C6611C10748AEb04B58e8F", Decimals: 6},
+	{Symbol: "USDT", Network: "TRC20", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6},
+	{Symbol: "USDT", Network: "SOL", Contract: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", Decimals: 6},
+	{Symbol: "USDC", Network: "SOL", Contract: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Decimals: 6},
+}
+
+// TokenRegistry 代币登记表，监听、付款链接、余额查询和归集按币种网络从这里取合约地址和精度，
+// 未登记或已下架的代币不能下单。启动时由 LoadTokens 合并各来源的配置，配置中 disabled 为 true 时下架之前来源登记的同一代币，
+// 链上核对合约不存在或精度不一致的代币同样下架
+type TokenRegistry struct {
+	mu     sync.RWMutex
+	tokens map[string]*Token // Asset.Key() -> 代币
+}
+
+// tokenRegistry 全局登记表，包初始化时只含内置代币
+var tokenRegistry = newTokenRegistry()
+
+func newTokenRegistry() *TokenRegistry {
+	r := &TokenRegistry{tokens: make(map[string]*Token)}
+	for _, token := range builtinTokens {
+		token.Source = TokenSourceBuiltin
+		if err := r.put(token); err != nil {
+			log.Fatalf("内置代币配置错误: %v", err)
+		}
+	}
+	return r
+}
+
+// LoadTokens 依次合并 CRYPTO_TOKENS_FILE（JSON 数组，字段同 Token）、数据库 crypto_tokens 表（db 为 nil 时跳过）
+// 和环境变量中的代币配置，同一币种网络后者覆盖前者；环境变量只能覆盖已登记代币的合约地址。
+// 任何一项的网络、合约地址格式或精度无效都返回错误，网关拒绝启动。
+// 新增的代币会写入 supportedAssets 等不加锁的包级表（见 registerAsset），只能在 Start 启动后台任务和监听之前调用一次
+func LoadTokens(db *sql.DB) error {
+	if path := os.Getenv("CRYPTO_TOKENS_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("读取 CRYPTO_TOKENS_FILE 失败: %w", err)
+		}
+		var tokens []Token
+		if err := json.Unmarshal(content, &tokens); err != nil {
+			return fmt.Errorf("解析 CRYPTO_TOKENS_FILE 失败: %w", err)
+		}
+		for _, token := range tokens {
+			token.Source = TokenSourceFile
+			if err := tokenRegistry.put(token); err != nil {
+				return fmt.Errorf("CRYPTO_TOKENS_FILE 配置错误: %w", err)
+			}
+		}
+	}
+
+	if db != nil {
+		tokens, err := loadSQLiteTokens(db)
+		if err != nil {
+			return fmt.Errorf("加载代币登记表失败: %w", err)
+		}
+		for _, token := range tokens {
+			if err := tokenRegistry.put(token); err != nil {
+				return fmt.Errorf("crypto_tokens 表配置错误: %w", err)
+			}
+		}
+	}
+
+	for _, token := range tokenRegistry.List() {
+		name := token.Asset().Key() + "_CONTRACT"
+		if token.Network == "SOL" {
+			name = token.Symbol + "_SOL_MINT"
+		}
+		if contract := os.Getenv(name); contract != "" && contract != token.Contract {
+			token.Contract, token.Source = contract, TokenSourceEnv
+			if err := tokenRegistry.put(token); err != nil {
+				return fmt.Errorf("%s 配置错误: %w", name, err)
+			}
+		}
+	}
+
+	for _, token := range tokenRegistry.List() {
+		log.Printf("代币 %s：合约 %s，精度 %d（%s）", token.Asset(), token.Contract, token.Decimals, token.Source)
+	}
+	return nil
+}
+
+// put 校验并登记代币，Disabled 时只下架已登记的同一代币。网络可使用别名，币种统一为大写
+func (r *TokenRegistry) put(token Token) error {
+	token.Symbol = strings.ToUpper(strings.TrimSpace(token.Symbol))
+	token.Contract = strings.TrimSpace(token.Contract)
+	network, ok := networkAliases[strings.ToLower(strings.TrimSpace(token.Network))]
+	if !ok {
+		return fmt.Errorf("代币 %s 的网络 %s 不支持", token.Symbol, token.Network)
+	}
+	token.Network = network
+	token.Verified = false
+	asset := token.Asset()
+
+	if token.Disabled {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existing, ok := r.tokens[asset.Key()]; ok {
+			existing.Disabled, existing.Source = true, token.Source
+			log.Printf("代币 %s 已按配置（%s）下架", asset, token.Source)
+		}
+		return nil
+	}
+	if err := validateToken(token); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.tokens[asset.Key()] = &token
+	r.mu.Unlock()
+	registerAsset(asset)
+	return nil
+}
+
+// validateToken 校验币种、合约地址格式和精度
+func validateToken(token Token) error {
+	asset := token.Asset()
+	if token.Symbol == "" {
+		return fmt.Errorf("代币币种不能为空")
+	}
+	if _, native := nativeDecimals[asset.Key()]; native {
+		return fmt.Errorf("%s 是原生币，不需要登记合约", asset)
+	}
+	if token.Decimals < 0 || token.Decimals > 36 {
+		return fmt.Errorf("%s 的精度 %d 无效，须在 0 到 36 之间", asset, token.Decimals)
+	}
+
+	var err error
+	switch {
+	case token.Network == "TRC20":
+		_, err = tronHexAddress(token.Contract)
+	case token.Network == "SOL":
+		if len(base58.Decode(token.Contract)) != 32 {
+			err = fmt.Errorf("不是有效的 Solana 地址")
+		}
+	case evmChains[token.Network] != nil:
+		err = validateEVMAddress(token.Contract)
+	default:
+		return fmt.Errorf("%s 网络不支持代币", networkNames[token.Network])
+	}
+	if err != nil {
+		return fmt.Errorf("%s 的合约地址 %s 无效: %v", asset, token.Contract, err)
+	}
+	return nil
+}
+
+// validateEVMAddress EVM 地址为 0x 开头的 20 字节十六进制，大小写混合时按 EIP-55 校验
+func validateEVMAddress(address string) error {
+	raw, err := hex.DecodeString(strings.TrimPrefix(address, "0x"))
+	if err != nil || !strings.HasPrefix(address, "0x") || len(raw) != 20 {
+		return fmt.Errorf("不是有效的 EVM 地址: %s", address)
+	}
+	body := address[2:]
+	if body != strings.ToLower(body) && body != strings.ToUpper(body) && address != checksumAddress(raw) {
+		return fmt.Errorf("EVM 地址校验和不正确: %s", address)
+	}
+	return nil
+}
+
+// registerAsset 配置中新增的代币加入支持的币种网络组合，币种代码同时作为别名。
+// 新增的代币多为稳定币，未配置报价精度时保留 6 位。
+// supportedAssets、currencyAliases、quoteDecimals 在服务运行期间并发只读、不加锁，
+// 只能在包初始化和启动前的 LoadTokens 中调用；运行期间的下架、核对只修改登记表本身
+func registerAsset(asset Asset) {
+	if !slices.Contains(supportedAssets[asset.Currency], asset.Network) {
+		supportedAssets[asset.Currency] = append(supportedAssets[asset.Currency], asset.Network)
+	}
+	if _, ok := currencyAliases[strings.ToLower(asset.Currency)]; !ok {
+		currencyAliases[strings.ToLower(asset.Currency)] = asset.Currency
+	}
+	if _, ok := quoteDecimals[asset.Currency]; !ok {
+		quoteDecimals[asset.Currency] = 6
+	}
+}
+
+// Lookup 按币种网络查询登记的代币
+func (r *TokenRegistry) Lookup(asset Asset) (Token, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	token, ok := r.tokens[asset.Key()]
+	if !ok {
+		return Token{}, false
+	}
+	return *token, true
+}
+
+// List 按币种网络排序返回全部代币
+func (r *TokenRegistry) List() []Token {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := make([]Token, 0, len(r.tokens))
+	for _, token := range r.tokens {
+		tokens = append(tokens, *token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Asset().Key() < tokens[j].Asset().Key() })
+	return tokens
+}
+
+// verify 记录链上核对结果。合约地址上没有代码或精度与登记不一致时下架该代币；
+// 节点查询失败时保留登记，下次启动再核对。返回代币是否仍然可用
+func (r *TokenRegistry) verify(asset Asset, decimals int, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[asset.Key()]
+	if !ok || token.Disabled {
+		return false
+	}
+	switch {
+	case errors.Is(err, errNotContract):
+		log.Printf("【警告】%s 的合约 %s 上没有合约代码，已下架，不再接受该代币下单", asset, token.Contract)
+	case err != nil:
+		log.Printf("【警告】核对 %s 的合约 %s 失败，暂按登记信息收款: %v", asset, token.Contract, err)
+		return true
+	case decimals != token.Decimals:
+		log.Printf("【警告】%s 的合约 %s 链上精度为 %d，与登记的 %d 不一致，已下架，不再接受该代币下单", asset, token.Contract, decimals, token.Decimals)
+	default:
+		token.Verified = true
+		return true
+	}
+	token.Disabled = true
+	return false
+}
+
+// registered 原生币或已登记合约且未下架的代币
+func (a Asset) registered() bool {
+	if _, ok := nativeDecimals[a.Key()]; ok {
+		return true
+	}
+	token, ok := tokenRegistry.Lookup(a)
+	return ok && !token.Disabled
+}
+
+// registerTokenRoutes 注册代币登记表查询接口
+func registerTokenRoutes(api *gin.RouterGroup) {
+	admin := api.Group("/crypto/admin")
+
+	admin.GET("/tokens", func(c *gin.Context) {
+		apierr.RespondOK(c, tokenRegistry.List())
+	})
+}
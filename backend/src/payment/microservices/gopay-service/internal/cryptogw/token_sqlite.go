@@ -0,0 +1,22 @@
+package cryptogw
+
+import "database/sql"
+
+// loadSQLiteTokens 读取 crypto_tokens 表，表结构见 migrations/00003_crypto_tokens.sql
+func loadSQLiteTokens(db *sql.DB) ([]Token, error) {
+	rows, err := db.Query(`SELECT symbol, network, contract, decimals, disabled FROM crypto_tokens ORDER BY symbol, network`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		token := Token{Source: TokenSourceDB}
+		if err := rows.Scan(&token.Symbol, &token.Network, &token.Contract, &token.Decimals, &token.Disabled); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,171 @@
+package cryptogw
+
+import (
+	"database/sql"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// useTokenRegistry 测试期间使用只含内置代币的登记表，结束后恢复登记表和 registerAsset 修改的包级表
+func useTokenRegistry(t *testing.T) {
+	t.Helper()
+	registry, assets, aliases, decimals := tokenRegistry, maps.Clone(supportedAssets), maps.Clone(currencyAliases), maps.Clone(quoteDecimals)
+	tokenRegistry = newTokenRegistry()
+	t.Cleanup(func() {
+		tokenRegistry, supportedAssets, currencyAliases, quoteDecimals = registry, assets, aliases, decimals
+	})
+}
+
+func TestValidateToken(t *testing.T) {
+	cases := []struct {
+		name    string
+		token   Token
+		wantErr string
+	}{
+		{"EVM 小写地址", Token{Symbol: "DAI", Network: "ERC20", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 18}, ""},
+		{"EVM 校验和地址", Token{Symbol: "USDT", Network: "ERC20", Contract: "0xdAC17F958D2ee523a2206206994597C13D831ec7", Decimals: 6}, ""},
+		{"EVM 校验和错误", Token{Symbol: "USDT", Network: "ERC20", Contract: "0xdAC17F958D2ee523a2206206994597C13D831Ec7", Decimals: 6}, "校验和"},
+		{"EVM 地址长度错误", Token{Symbol: "USDT", Network: "BEP20", Contract: "0x55d398326f99059ff775485246999027b31979", Decimals: 18}, "无效"},
+		{"TRON 地址", Token{Symbol: "USDT", Network: "TRC20", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6}, ""},
+		{"TRON 地址校验失败", Token{Symbol: "USDT", Network: "TRC20", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6u", Decimals: 6}, "无效"},
+		{"Solana mint", Token{Symbol: "USDC", Network: "SOL", Contract: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Decimals: 6}, ""},
+		{"Solana mint 无效", Token{Symbol: "USDC", Network: "SOL", Contract: "EPjFWdd5", Decimals: 6}, "Solana"},
+		{"币种为空", Token{Network: "ERC20", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 18}, "币种不能为空"},
+		{"原生币", Token{Symbol: "ETH", Network: "ERC20", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 18}, "原生币"},
+		{"精度为负", Token{Symbol: "DAI", Network: "ERC20", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: -1}, "精度"},
+		{"精度过大", Token{Symbol: "DAI", Network: "ERC20", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 37}, "精度"},
+		{"网络不支持代币", Token{Symbol: "FOO", Network: "XRP", Contract: "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", Decimals: 6}, "不支持代币"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateToken(tc.token)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("预期通过，实际: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("预期错误包含 %q，实际: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTokenRegistryPut(t *testing.T) {
+	cases := []struct {
+		name     string
+		token    Token
+		wantErr  bool
+		asset    Asset
+		wantOK   bool
+		disabled bool
+	}{
+		{"网络别名和小写币种", Token{Symbol: " dai ", Network: "Ethereum", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 18}, false, Asset{Currency: "DAI", Network: "ERC20"}, true, false},
+		{"网络不支持", Token{Symbol: "DAI", Network: "avalanche", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 18}, true, Asset{Currency: "DAI", Network: "AVALANCHE"}, false, false},
+		{"合约地址无效", Token{Symbol: "FOO", Network: "bsc", Contract: "0x1234", Decimals: 18}, true, Asset{Currency: "FOO", Network: "BEP20"}, false, false},
+		{"下架已登记代币", Token{Symbol: "USDT", Network: "tron", Disabled: true}, false, Asset{Currency: "USDT", Network: "TRC20"}, true, true},
+		{"下架未登记代币", Token{Symbol: "FOO", Network: "polygon", Disabled: true}, false, Asset{Currency: "FOO", Network: "POLYGON"}, false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			useTokenRegistry(t)
+			err := tokenRegistry.put(tc.token)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("put 返回 %v，预期出错 %v", err, tc.wantErr)
+			}
+			token, ok := tokenRegistry.Lookup(tc.asset)
+			if ok != tc.wantOK || token.Disabled != tc.disabled {
+				t.Fatalf("登记结果 %+v（%v），预期登记 %v、下架 %v", token, ok, tc.wantOK, tc.disabled)
+			}
+			if ok && !tc.disabled && !tc.asset.registered() {
+				t.Fatalf("%s 已登记但不可下单", tc.asset)
+			}
+		})
+	}
+
+	useTokenRegistry(t)
+	if err := tokenRegistry.put(Token{Symbol: "DAI", Network: "ERC20", Contract: "0x6b175474e89094c44da98b954eedeac495271d0f", Decimals: 18}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NormalizeAsset("dai", "erc20"); err != nil {
+		t.Fatalf("新增代币未加入支持的币种网络组合: %v", err)
+	}
+	if quoteDecimals["DAI"] != 6 {
+		t.Fatalf("新增代币的报价精度为 %d，预期 6", quoteDecimals["DAI"])
+	}
+}
+
+// TestLoadTokensPrecedence 同一币种网络按 内置 < CRYPTO_TOKENS_FILE < crypto_tokens 表 < 环境变量 覆盖
+func TestLoadTokensPrecedence(t *testing.T) {
+	useTokenRegistry(t)
+
+	file := filepath.Join(t.TempDir(), "tokens.json")
+	content := `[
+		{"symbol": "USDT", "network": "ERC20", "contract": "0x1111111111111111111111111111111111111111", "decimals": 6},
+		{"symbol": "USDT", "network": "POLYGON", "contract": "0x2222222222222222222222222222222222222222", "decimals": 6},
+		{"symbol": "DAI", "network": "ERC20", "contract": "0x6b175474e89094c44da98b954eedeac495271d0f", "decimals": 18}
+	]`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CRYPTO_TOKENS_FILE", file)
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	migration, err := os.ReadFile("../../migrations/00003_crypto_tokens.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+	if _, err := db.Exec(up); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO crypto_tokens (symbol, network, contract, decimals, disabled, updated_at) VALUES
+		('USDT', 'ERC20', '0x3333333333333333333333333333333333333333', 6, 0, 0),
+		('USDT', 'POLYGON', '0x4444444444444444444444444444444444444444', 6, 0, 0),
+		('USDC', 'SOL', '', 0, 1, 0)`); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("USDT_ERC20_CONTRACT", "0x5555555555555555555555555555555555555555")
+	t.Setenv("USDT_SOL_MINT", "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB") // 与已登记的相同，不覆盖来源
+
+	if err := LoadTokens(db); err != nil {
+		t.Fatalf("加载代币失败: %v", err)
+	}
+
+	cases := []struct {
+		asset    Asset
+		contract string
+		source   string
+		disabled bool
+	}{
+		{Asset{Currency: "USDT", Network: "ERC20"}, "0x5555555555555555555555555555555555555555", TokenSourceEnv, false},
+		{Asset{Currency: "USDT", Network: "POLYGON"}, "0x4444444444444444444444444444444444444444", TokenSourceDB, false},
+		{Asset{Currency: "DAI", Network: "ERC20"}, "0x6b175474e89094c44da98b954eedeac495271d0f", TokenSourceFile, false},
+		{Asset{Currency: "USDC", Network: "SOL"}, "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", TokenSourceDB, true},
+		{Asset{Currency: "USDT", Network: "SOL"}, "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", TokenSourceBuiltin, false},
+		{Asset{Currency: "USDT", Network: "BEP20"}, "0x55d398326f99059fF775485246999027B3197955", TokenSourceBuiltin, false},
+	}
+	for _, tc := range cases {
+		token, ok := tokenRegistry.Lookup(tc.asset)
+		if !ok || token.Contract != tc.contract || token.Source != tc.source || token.Disabled != tc.disabled {
+			t.Errorf("%s 登记为 %+v（%v），预期合约 %s、来源 %s、下架 %v", tc.asset, token, ok, tc.contract, tc.source, tc.disabled)
+		}
+	}
+}
+
+func TestLoadTokensRejectsInvalid(t *testing.T) {
+	useTokenRegistry(t)
+	t.Setenv("USDT_BEP20_CONTRACT", "0x1234")
+	if err := LoadTokens(nil); err == nil || !strings.Contains(err.Error(), "USDT_BEP20_CONTRACT") {
+		t.Fatalf("无效的环境变量合约地址应拒绝启动，实际: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package cryptogw
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TONLedger 通过 toncenter API v3（TON_API_URLS 逗号分隔，如 https://toncenter.com/api/v3，TON_API_KEY 为可选的 API Key，
+// 多个地址按健康评分故障切换）核验外部监听服务上报的 TON 入账，并按最新主链区块推进确认数。
+// 上报的交易哈希须为收款钱包上处理该笔转入消息的交易，到账数量取转入消息的 value，文本注释作为标签
+type TONLedger struct {
+	crypto *CryptoService
+	hub    *CheckoutHub
+	pool   *EndpointPool
+	client *http.Client
+	header http.Header
+	wallet string // 收款地址，链上返回的原始地址与其一致时按收款地址上报
+}
+
+// NewTONLedger 未配置 TON_API_URLS 时返回 nil
+func NewTONLedger(crypto *CryptoService, hub *CheckoutHub) *TONLedger {
+	var urls []string
+	for _, raw := range splitList(os.Getenv("TON_API_URLS")) {
+		urls = append(urls, strings.TrimRight(raw, "/"))
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	w := &TONLedger{
+		crypto: crypto,
+		hub:    hub,
+		pool:   crypto.newEndpointPool("TON", "TON", urls),
+		client: &http.Client{Timeout: envDuration("RPC_HTTP_TIMEOUT", 10*time.Second)},
+		header: http.Header{},
+		wallet: crypto.memoWallets["TON"],
+	}
+	if key := os.Getenv("TON_API_KEY"); key != "" {
+		w.header.Set("X-API-Key", key)
+	}
+	crypto.registerChain("TON", w)
+	return w
+}
+
+func (w *TONLedger) Run(ctx context.Context) {
+	log.Printf("TON 入账核验已启动，%d 个节点", w.pool.Len())
+	go w.pool.RunHealthChecks(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		var info struct{}
+		return requestLedgerJSON(ctx, w.client, ep.URL+"/masterchainInfo", w.header, &info)
+	})
+	w.crypto.trackLedger(ctx, w.hub, "TON", w)
+}
+
+type tonTx struct {
+	Hash         string `json:"hash"`
+	MCBlockSeqno int64  `json:"mc_block_seqno"`
+	Description  struct {
+		Aborted   bool `json:"aborted"`
+		ComputePh struct {
+			Success *bool `json:"success"`
+		} `json:"compute_ph"`
+	} `json:"description"`
+	InMsg *struct {
+		Destination    string `json:"destination"`
+		Value          string `json:"value"`
+		MessageContent struct {
+			Decoded *struct {
+				Type    string `json:"type"`
+				Comment string `json:"comment"`
+			} `json:"decoded"`
+		} `json:"message_content"`
+	} `json:"in_msg"`
+}
+
+// tx 按哈希查询交易，不存在时返回 nil
+func (w *TONLedger) tx(ctx context.Context, txHash string) (*tonTx, error) {
+	var resp struct {
+		Transactions []tonTx `json:"transactions"`
+	}
+	if err := getLedgerJSON(ctx, w.pool, w.client, "/transactions?limit=1&hash="+url.QueryEscape(txHash), w.header, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Transactions) == 0 {
+		return nil, nil
+	}
+	return &resp.Transactions[0], nil
+}
+
+// Head 最新主链区块序号
+func (w *TONLedger) Head(ctx context.Context) (int64, error) {
+	var info struct {
+		Last struct {
+			Seqno int64 `json:"seqno"`
+		} `json:"last"`
+	}
+	if err := getLedgerJSON(ctx, w.pool, w.client, "/masterchainInfo", w.header, &info); err != nil {
+		return 0, err
+	}
+	return info.Last.Seqno, nil
+}
+
+// LocateTx 交易所在分片区块被主链引用时的主链区块序号
+func (w *TONLedger) LocateTx(ctx context.Context, txHash string) (TxLocation, bool, error) {
+	tx, err := w.tx(ctx, txHash)
+	if err != nil || tx == nil {
+		return TxLocation{}, false, err
+	}
+	return TxLocation{Height: tx.MCBlockSeqno}, true, nil
+}
+
+// FetchTx 按哈希查询交易，转入消息作为转账
+func (w *TONLedger) FetchTx(ctx context.Context, txHash string) (*ChainTx, error) {
+	tx, err := w.tx(ctx, txHash)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	head, err := w.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: tx.Hash, BlockHeight: tx.MCBlockSeqno, Head: head}
+	result.Failed = tx.Description.Aborted || (tx.Description.ComputePh.Success != nil && !*tx.Description.ComputePh.Success)
+	if tx.InMsg == nil || tx.InMsg.Value == "" {
+		return result, nil
+	}
+	units, ok := new(big.Int).SetString(tx.InMsg.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("交易 %s 的转入数量无效: %s", txHash, tx.InMsg.Value)
+	}
+	transfer := ChainTransfer{To: tx.InMsg.Destination, Currency: "TON", Units: units}
+	if w.wallet != "" && tonRawAddress(tx.InMsg.Destination) == tonRawAddress(w.wallet) {
+		transfer.To = w.wallet
+	}
+	if decoded := tx.InMsg.MessageContent.Decoded; decoded != nil && decoded.Type == "text_comment" {
+		transfer.Memo = strings.TrimSpace(decoded.Comment)
+	}
+	result.Transfers = append(result.Transfers, transfer)
+	return result, nil
+}
+
+// Balance 账户余额（nanoton），未初始化的账户为 0
+func (w *TONLedger) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	if asset.Currency != "TON" {
+		return nil, fmt.Errorf("TON 不支持 %s", asset.Currency)
+	}
+	var account struct {
+		Balance string `json:"balance"`
+	}
+	err := getLedgerJSON(ctx, w.pool, w.client, "/account?address="+url.QueryEscape(address), w.header, &account)
+	if errors.Is(err, errLedgerNotFound) {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := new(big.Int).SetString(account.Balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("账户 %s 的余额无效: %s", address, account.Balance)
+	}
+	return balance, nil
+}
+
+// tonRawAddress 地址统一为原始格式（工作链:十六进制账户哈希），用户友好格式（EQ、UQ 开头）的可弹回标志不影响比较，
+// 无法解析时返回空
+func tonRawAddress(address string) string {
+	if workchain, hash, ok := strings.Cut(address, ":"); ok {
+		raw, err := hex.DecodeString(hash)
+		if _, errWC := strconv.Atoi(workchain); err != nil || errWC != nil || len(raw) != 32 {
+			return ""
+		}
+		return workchain + ":" + hex.EncodeToString(raw)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.NewReplacer("+", "-", "/", "_").Replace(strings.TrimRight(address, "=")))
+	if err != nil || len(decoded) != 36 {
+		return ""
+	}
+	return strconv.Itoa(int(int8(decoded[1]))) + ":" + hex.EncodeToString(decoded[2:34])
+}
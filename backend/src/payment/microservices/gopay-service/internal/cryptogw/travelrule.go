@@ -0,0 +1,195 @@
+package cryptogw
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"gopay-service/internal/apierr"
+)
+
+// originatorKey 下单 metadata 中付款人信息的键
+const originatorKey = "originator"
+
+// TravelRuleOriginator 旅行规则要求的付款人（发起方）信息，字段参照 IVMS101 的自然人信息简化
+type TravelRuleOriginator struct {
+	Name          string `json:"name,omitempty"`
+	AccountNumber string `json:"accountNumber,omitempty"` // 付款钱包地址或在发起方 VASP 的账户
+	VASP          string `json:"vasp,omitempty"`          // 从交易所等 VASP 转出时的机构名称
+	Address       string `json:"address,omitempty"`       // 住址
+	NationalID    string `json:"nationalId,omitempty"`    // 身份证件号码
+	CustomerID    string `json:"customerId,omitempty"`
+	DateOfBirth   string `json:"dateOfBirth,omitempty"`
+	PlaceOfBirth  string `json:"placeOfBirth,omitempty"`
+	Country       string `json:"country,omitempty"`
+}
+
+// fields 按 JSON 字段名列出全部字段，用于必填校验和写回 metadata
+func (o *TravelRuleOriginator) fields() map[string]*string {
+	return map[string]*string{
+		"name":          &o.Name,
+		"accountNumber": &o.AccountNumber,
+		"vasp":          &o.VASP,
+		"address":       &o.Address,
+		"nationalId":    &o.NationalID,
+		"customerId":    &o.CustomerID,
+		"dateOfBirth":   &o.DateOfBirth,
+		"placeOfBirth":  &o.PlaceOfBirth,
+		"country":       &o.Country,
+	}
+}
+
+// metadata 写回账单 metadata 的形式，只保留已填写的字段
+func (o *TravelRuleOriginator) metadata() map[string]interface{} {
+	values := make(map[string]interface{})
+	for name, value := range o.fields() {
+		if *value != "" {
+			values[name] = *value
+		}
+	}
+	return values
+}
+
+// parseOriginator 读取 metadata.originator，未提供时返回 nil
+func parseOriginator(metadata map[string]interface{}) (*TravelRuleOriginator, error) {
+	raw, ok := metadata[originatorKey]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var originator TravelRuleOriginator
+	if err := json.Unmarshal(data, &originator); err != nil {
+		return nil, fmt.Errorf("metadata.originator 格式错误: %w", err)
+	}
+	for _, value := range originator.fields() {
+		*value = strings.TrimSpace(*value)
+	}
+	return &originator, nil
+}
+
+// TravelRule 账单金额达到旅行规则门槛时的评估结果。付款人信息保存在账单 metadata 的 originator 中，
+// 入账达到确认数后挂起，合规人员核对付款人信息与付款方地址后放行
+type TravelRule struct {
+	Value     float64 `json:"value"` // 账单折合的金额
+	Currency  string  `json:"currency"`
+	Threshold float64 `json:"threshold"`
+	Approved  bool    `json:"approved,omitempty"`
+	CaseID    string  `json:"caseId,omitempty"`
+}
+
+// pending 需要复核且尚未放行
+func (rule *TravelRule) pending() bool {
+	return rule != nil && !rule.Approved
+}
+
+// TravelRulePolicy 旅行规则门槛。TRAVEL_RULE_THRESHOLD 为门槛金额（0 为不启用，FATF 建议 1000 美元或欧元），
+// 以 TRAVEL_RULE_CURRENCY（默认 USD）计；达到门槛的账单须在 metadata.originator 中提供
+// TRAVEL_RULE_REQUIRED_FIELDS（默认 name,address）列出的付款人信息
+type TravelRulePolicy struct {
+	threshold float64
+	currency  string
+	required  []string
+}
+
+func NewTravelRulePolicy() *TravelRulePolicy {
+	p := &TravelRulePolicy{
+		threshold: envFloat("TRAVEL_RULE_THRESHOLD", 0),
+		currency:  strings.ToUpper(envString("TRAVEL_RULE_CURRENCY", "USD")),
+		required:  splitList(envString("TRAVEL_RULE_REQUIRED_FIELDS", "name,address")),
+	}
+	known := (&TravelRuleOriginator{}).fields()
+	for _, name := range p.required {
+		if _, ok := known[name]; !ok {
+			log.Fatalf("TRAVEL_RULE_REQUIRED_FIELDS 包含未知字段: %s", name)
+		}
+	}
+	if p.Enabled() {
+		log.Printf("旅行规则已启用：门槛 %.2f %s，付款人必填 %s", p.threshold, p.currency, strings.Join(p.required, ","))
+	}
+	return p
+}
+
+func (p *TravelRulePolicy) Enabled() bool {
+	return p.threshold > 0
+}
+
+// missing 未填写的必填字段
+func (p *TravelRulePolicy) missing(originator *TravelRuleOriginator) []string {
+	if originator == nil {
+		originator = &TravelRuleOriginator{}
+	}
+	fields := originator.fields()
+	var missing []string
+	for _, name := range p.required {
+		if *fields[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// travelRuleValue 账单折合为门槛币种的金额，按法币下单且币种相同时直接取订单金额
+func (cs *CryptoService) travelRuleValue(invoice *CryptoInvoice, asset Asset, amount CryptoAmount) (float64, error) {
+	currency := cs.travelRule.currency
+	if invoice.FiatAmount > 0 && invoice.FiatCurrency == currency {
+		return invoice.FiatAmount, nil
+	}
+	rate, err := cs.valuationRate(invoice, asset, currency)
+	if err != nil {
+		return 0, err
+	}
+	return amount.Value * rate, nil
+}
+
+// applyTravelRule 下单时评估旅行规则，达到门槛的账单校验并保存付款人信息，标记为确认前需合规复核。返回不能下单的原因
+func (cs *CryptoService) applyTravelRule(invoice *CryptoInvoice, asset Asset, amount CryptoAmount) *apierr.Response {
+	policy := cs.travelRule
+	if !policy.Enabled() {
+		return nil
+	}
+	value, err := cs.travelRuleValue(invoice, asset, amount)
+	if err != nil {
+		log.Printf("【旅行规则】%s 换算 %s/%s 失败: %v", invoice.OrderID, asset.Currency, policy.currency, err)
+		return apierr.ErrorResponse("RATE_UNAVAILABLE", fmt.Sprintf("暂时无法获取 %s/%s 汇率，请稍后重试", asset.Currency, policy.currency))
+	}
+	if value < policy.threshold {
+		return nil
+	}
+
+	originator, err := parseOriginator(invoice.Metadata)
+	if err != nil {
+		return apierr.ErrorResponse("INVALID_PARAMS", err.Error())
+	}
+	if missing := policy.missing(originator); len(missing) > 0 {
+		return apierr.ErrorResponse("TRAVEL_RULE_REQUIRED", fmt.Sprintf("账单金额折合 %.2f %s，达到旅行规则门槛 %.2f %s，需在 metadata.originator 中提供付款人信息: %s",
+			value, policy.currency, policy.threshold, policy.currency, strings.Join(missing, ",")))
+	}
+
+	// 复制一份再写回，不修改调用方传入的 metadata
+	metadata := make(map[string]interface{}, len(invoice.Metadata))
+	for key, v := range invoice.Metadata {
+		metadata[key] = v
+	}
+	metadata[originatorKey] = originator.metadata()
+	invoice.Metadata = metadata
+	invoice.TravelRule = &TravelRule{Value: value, Currency: policy.currency, Threshold: policy.threshold}
+	log.Printf("【旅行规则】账单 %s 折合 %.2f %s，达到门槛，已记录付款人信息，确认前需合规复核", invoice.PaymentID, value, policy.currency)
+	return nil
+}
+
+// holdTravelRule 达到旅行规则门槛的入账达到确认数后挂起，转合规人员核对付款人信息
+func (cs *CryptoService) holdTravelRule(invoice *CryptoInvoice) {
+	originator, _ := parseOriginator(invoice.Metadata)
+	item := paymentCase(invoice, CaseTravelRule, fmt.Sprintf("账单金额折合 %.2f %s，达到旅行规则门槛 %.2f %s，需核对付款人信息",
+		invoice.TravelRule.Value, invoice.TravelRule.Currency, invoice.TravelRule.Threshold, invoice.TravelRule.Currency))
+	item.Addresses = invoice.Senders
+	item.Originator = originator
+
+	invoice.Status = InvoiceHeld
+	invoice.TravelRule.CaseID = cs.compliance.Open(item)
+	log.Printf("【合规】账单 %s 的入账 %s 已达到确认数，达到旅行规则门槛，挂起等待复核 %s", invoice.PaymentID, invoice.TxHash, invoice.TravelRule.CaseID)
+}
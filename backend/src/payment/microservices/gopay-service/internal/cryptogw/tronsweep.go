@@ -0,0 +1,435 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// TRON 交易中的合约类型
+const (
+	tronTransferContract = 1  // TransferContract，转账 TRX
+	tronTriggerContract  = 31 // TriggerSmartContract，调用合约
+)
+
+// tronSweepBandwidth 归集交易预留的带宽（字节），收款地址没有免费带宽时按 getTransactionFee 燃烧 TRX
+const tronSweepBandwidth = 350
+
+// PlanSweeps 每个收款地址每轮归集一种达到门槛的代币
+func (w *TronWatcher) PlanSweeps(ctx context.Context, addresses []*PooledAddress, toAddress string) ([]*SweepRecord, error) {
+	assets := make([]Asset, 0, len(w.tokens))
+	for _, asset := range w.tokens {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Currency < assets[j].Currency })
+
+	var sweeps []*SweepRecord
+	var errs []error
+	for _, addr := range addresses {
+		for _, asset := range assets {
+			balance, err := w.Balance(ctx, addr.Address, asset)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", addr.Address, asset, err))
+				break
+			}
+			if balance.Cmp(sweepMinimum(asset)) < 0 {
+				continue
+			}
+			sweep := newSweep(asset, toAddress, balance, SweepSource{Address: addr.Address, Index: addr.Index, Path: addr.Path})
+			sweep.Sources[0].Amount = sweep.Amount
+			sweeps = append(sweeps, sweep)
+			break
+		}
+	}
+	return sweeps, errors.Join(errs...)
+}
+
+// SendSweep 调用代币合约的 transfer 转出收款地址的全部余额。按只读调用预估能量，fee_limit 取预估能量费的 1.2 倍，
+// 不超过 SWEEP_TRON_MAX_FEE_LIMIT（默认 100 TRX）；收款地址的 TRX 不足以支付 fee_limit 和带宽时先由热钱包补充。
+// 交易由节点构造，签名前解析 raw_data 核对合约类型、地址、数量和 fee_limit，不依赖节点返回的 JSON
+func (w *TronWatcher) SendSweep(ctx context.Context, sweep *SweepRecord, keys *hdKeystore) error {
+	source := &sweep.Sources[0]
+	signer, err := keys.signer(source.Index)
+	if err != nil {
+		return err
+	}
+	if from := base58.CheckEncode(keccakAddress(signer.PublicKey().SerializeUncompressed()), tronAddressPrefix); from != source.Address {
+		return fmt.Errorf("序号 %d 派生的地址 %s 与收款地址 %s 不一致", source.Index, from, source.Address)
+	}
+	asset := Asset{Currency: sweep.Currency, Network: sweep.Network}
+	var contract string
+	for candidate, token := range w.tokens {
+		if token == asset {
+			contract = candidate
+		}
+	}
+	if contract == "" {
+		return fmt.Errorf("未配置 %s_CONTRACT", asset.Key())
+	}
+	recipient, err := tronHexAddress(sweep.ToAddress)
+	if err != nil {
+		return fmt.Errorf("归集地址无效: %w", err)
+	}
+	balance, err := w.Balance(ctx, source.Address, asset)
+	if err != nil {
+		return err
+	}
+	if balance.Sign() == 0 {
+		return fmt.Errorf("收款地址 %s 的 %s 余额为 0", source.Address, asset)
+	}
+	recipientBytes, _ := hex.DecodeString(recipient[2:])
+	parameter := hex.EncodeToString(append(leftPad32(recipientBytes), leftPad32(balance.Bytes())...))
+
+	energy, err := w.estimateEnergy(ctx, source.Address, contract, parameter)
+	if err != nil {
+		return err
+	}
+	estimate, err := w.crypto.feeEstimate(ctx, "TRC20")
+	if err != nil {
+		return err
+	}
+	feeLimit := energy * estimate.Tron.EnergyPrice * 6 / 5
+	maxFeeLimit := int64(envFloat("SWEEP_TRON_MAX_FEE_LIMIT", 100) * 1e6)
+	if feeLimit > maxFeeLimit {
+		return fmt.Errorf("预估能量费 %s TRX 超过 SWEEP_TRON_MAX_FEE_LIMIT", formatAmount(new(big.Rat).SetFrac64(feeLimit, 1e6), 6))
+	}
+	needed := feeLimit + tronSweepBandwidth*estimate.Tron.BandwidthPrice
+	trxBalance, err := w.trxBalance(ctx, source.Address)
+	if err != nil {
+		return err
+	}
+	if trxBalance < needed {
+		return w.fundSweep(ctx, sweep, needed*6/5-trxBalance)
+	}
+
+	var built struct {
+		Result struct {
+			Result  bool   `json:"result"`
+			Message string `json:"message"`
+		} `json:"result"`
+		Transaction json.RawMessage `json:"transaction"`
+	}
+	payload := map[string]interface{}{
+		"owner_address":     source.Address,
+		"contract_address":  contract,
+		"function_selector": "transfer(address,uint256)",
+		"parameter":         parameter,
+		"fee_limit":         feeLimit,
+		"call_value":        0,
+		"visible":           true,
+	}
+	if err := w.post(ctx, "/wallet/triggersmartcontract", payload, &built); err != nil {
+		return err
+	}
+	if !built.Result.Result {
+		return fmt.Errorf("构造归集交易失败: %s", decodeTronMessage(built.Result.Message))
+	}
+	selector, _ := hex.DecodeString(trc20Transfer)
+	data, _ := hex.DecodeString(parameter)
+	expected := tronContractCall{
+		Type:     tronTriggerContract,
+		Owner:    mustTronHex(source.Address),
+		Target:   mustTronHex(contract),
+		Data:     append(selector, data...),
+		FeeLimit: feeLimit,
+	}
+	txID, err := w.signAndBroadcast(ctx, built.Transaction, expected, signer)
+	if err != nil {
+		return err
+	}
+	sweep.setUnits(balance)
+	source.Amount = sweep.Amount
+	sweep.Fee = formatAmount(new(big.Rat).SetFrac64(feeLimit, 1e6), 6)
+	sweep.TxHash, sweep.Status = txID, SweepBroadcast
+	return nil
+}
+
+// fundSweep 从热钱包向收款地址转入 TRX。TRON 交易默认 60 秒过期，补充交易长时间不在链上时重新补充不会重复到账
+func (w *TronWatcher) fundSweep(ctx context.Context, sweep *SweepRecord, amount int64) error {
+	if sweep.Status == SweepFunding {
+		tx, err := w.FetchTx(ctx, sweep.FundingTxHash)
+		if err != nil {
+			return err
+		}
+		if confirmed, retry := fundingStatus(sweep, tx, time.Now()); !confirmed && !retry {
+			return nil
+		}
+	}
+
+	hot := w.crypto.hotWallet
+	if hot.tron == nil {
+		return fmt.Errorf("收款地址 %s 的 TRX 不足以支付能量费，未配置 REFUND_SIGNER_TRON 无法补充", sweep.Sources[0].Address)
+	}
+	var built json.RawMessage
+	payload := map[string]interface{}{
+		"owner_address": hot.tronAddress,
+		"to_address":    sweep.Sources[0].Address,
+		"amount":        amount,
+		"visible":       true,
+	}
+	if err := w.post(ctx, "/wallet/createtransaction", payload, &built); err != nil {
+		return err
+	}
+	expected := tronContractCall{
+		Type:   tronTransferContract,
+		Owner:  mustTronHex(hot.tronAddress),
+		Target: mustTronHex(sweep.Sources[0].Address),
+		Amount: amount,
+	}
+	txID, err := w.signAndBroadcast(ctx, built, expected, hot.tron)
+	if err != nil {
+		return fmt.Errorf("补充 TRX 失败: %w", err)
+	}
+	sweep.FundingTxHash = txID
+	sweep.FundingAmount = formatAmount(new(big.Rat).SetFrac64(amount, 1e6), 6)
+	sweep.Status, sweep.MissingSince = SweepFunding, time.Time{}
+	return nil
+}
+
+// estimateEnergy 只读调用 transfer 预估消耗的能量
+func (w *TronWatcher) estimateEnergy(ctx context.Context, owner, contract, parameter string) (int64, error) {
+	var resp struct {
+		EnergyUsed int64 `json:"energy_used"`
+		Result     struct {
+			Result  bool   `json:"result"`
+			Message string `json:"message"`
+		} `json:"result"`
+	}
+	payload := map[string]interface{}{
+		"owner_address":     owner,
+		"contract_address":  contract,
+		"function_selector": "transfer(address,uint256)",
+		"parameter":         parameter,
+		"visible":           true,
+	}
+	if err := w.post(ctx, "/wallet/triggerconstantcontract", payload, &resp); err != nil {
+		return 0, err
+	}
+	if !resp.Result.Result || resp.EnergyUsed <= 0 {
+		return 0, fmt.Errorf("预估能量失败: %s", decodeTronMessage(resp.Result.Message))
+	}
+	return resp.EnergyUsed, nil
+}
+
+// chainParameters 链参数，取能量和带宽的单价（sun）
+func (w *TronWatcher) chainParameters(ctx context.Context) (map[string]int64, error) {
+	var resp struct {
+		ChainParameter []struct {
+			Key   string `json:"key"`
+			Value int64  `json:"value"`
+		} `json:"chainParameter"`
+	}
+	if err := w.post(ctx, "/wallet/getchainparameters", nil, &resp); err != nil {
+		return nil, err
+	}
+	params := make(map[string]int64, len(resp.ChainParameter))
+	for _, param := range resp.ChainParameter {
+		params[param.Key] = param.Value
+	}
+	if params["getEnergyFee"] <= 0 {
+		return nil, fmt.Errorf("节点未返回 getEnergyFee")
+	}
+	return params, nil
+}
+
+// trxBalance 账户的 TRX 余额（sun），未激活的账户返回空对象，余额为 0
+func (w *TronWatcher) trxBalance(ctx context.Context, address string) (int64, error) {
+	var account struct {
+		Balance int64 `json:"balance"`
+	}
+	if err := w.post(ctx, "/wallet/getaccount", map[string]interface{}{"address": address, "visible": true}, &account); err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// signAndBroadcast 核对节点构造的交易后签名并广播，返回交易 ID
+func (w *TronWatcher) signAndBroadcast(ctx context.Context, transaction json.RawMessage, expected tronContractCall, signer Signer) (string, error) {
+	var tx map[string]json.RawMessage
+	if err := json.Unmarshal(transaction, &tx); err != nil {
+		return "", fmt.Errorf("交易格式无效: %w", err)
+	}
+	var txID, rawHex string
+	_ = json.Unmarshal(tx["txID"], &txID)
+	_ = json.Unmarshal(tx["raw_data_hex"], &rawHex)
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil || len(raw) == 0 {
+		return "", fmt.Errorf("节点未返回 raw_data_hex")
+	}
+	digest := sha256.Sum256(raw)
+	if !strings.EqualFold(txID, hex.EncodeToString(digest[:])) {
+		return "", fmt.Errorf("交易 ID 与 raw_data 不符")
+	}
+	if err := verifyTronRaw(raw, expected); err != nil {
+		return "", fmt.Errorf("节点构造的交易与预期不符: %w", err)
+	}
+
+	r, s, recovery, err := signEthereum(ctx, signer, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %w", err)
+	}
+	signature, _ := json.Marshal([]string{hex.EncodeToString(append(append(r, s...), 27+recovery))})
+	tx["signature"] = signature
+
+	var resp struct {
+		Result  bool   `json:"result"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := w.post(ctx, "/wallet/broadcasttransaction", tx, &resp); err != nil {
+		return "", err
+	}
+	// 重复广播的交易已在节点交易池中，视为成功
+	if !resp.Result && resp.Code != "DUP_TRANSACTION_ERROR" {
+		return "", fmt.Errorf("节点拒绝交易: %s %s", resp.Code, decodeTronMessage(resp.Message))
+	}
+	return strings.ToLower(txID), nil
+}
+
+// decodeTronMessage 节点错误信息多为十六进制编码的文本
+func decodeTronMessage(message string) string {
+	if decoded, err := hex.DecodeString(message); err == nil && len(decoded) > 0 {
+		return string(decoded)
+	}
+	return message
+}
+
+func mustTronHex(address string) []byte {
+	hexAddr, _ := tronHexAddress(address)
+	raw, _ := hex.DecodeString(hexAddr)
+	return raw
+}
+
+// tronContractCall 交易中唯一的合约调用：TransferContract 的 Target 为收款地址，TriggerSmartContract 的 Target 为合约地址
+type tronContractCall struct {
+	Type     int
+	Owner    []byte
+	Target   []byte
+	Amount   int64 // TransferContract 的数量或 TriggerSmartContract 的 call_value
+	Data     []byte
+	FeeLimit int64
+}
+
+// verifyTronRaw 解析 Transaction.raw 的 protobuf 编码，核对只含一个预期的合约调用且 fee_limit 不超过预期
+func verifyTronRaw(raw []byte, expected tronContractCall) error {
+	var contracts [][]byte
+	var feeLimit int64
+	err := walkProto(raw, func(num protowire.Number, value uint64, field []byte) error {
+		switch num {
+		case 11: // contract
+			contracts = append(contracts, field)
+		case 18: // fee_limit
+			feeLimit = int64(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(contracts) != 1 {
+		return fmt.Errorf("包含 %d 个合约调用", len(contracts))
+	}
+	if feeLimit > expected.FeeLimit {
+		return fmt.Errorf("fee_limit %d 超过 %d", feeLimit, expected.FeeLimit)
+	}
+
+	var actual tronContractCall
+	var parameter []byte
+	err = walkProto(contracts[0], func(num protowire.Number, value uint64, field []byte) error {
+		switch num {
+		case 1: // type
+			actual.Type = int(value)
+		case 2: // parameter（google.protobuf.Any）
+			return walkProto(field, func(num protowire.Number, _ uint64, field []byte) error {
+				if num == 2 {
+					parameter = field
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if actual.Type != expected.Type {
+		return fmt.Errorf("合约类型为 %d", actual.Type)
+	}
+	var extra bool
+	err = walkProto(parameter, func(num protowire.Number, value uint64, field []byte) error {
+		switch num {
+		case 1:
+			actual.Owner = field
+		case 2:
+			actual.Target = field
+		case 3:
+			actual.Amount = int64(value)
+		case 4:
+			if expected.Type == tronTriggerContract {
+				actual.Data = field
+			} else {
+				extra = true
+			}
+		default:
+			// 附带 TRC10 代币等其他字段
+			extra = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case extra:
+		return fmt.Errorf("合约参数包含多余字段")
+	case !bytes.Equal(actual.Owner, expected.Owner):
+		return fmt.Errorf("发送地址不符")
+	case !bytes.Equal(actual.Target, expected.Target):
+		return fmt.Errorf("接收地址或合约地址不符")
+	case actual.Amount != expected.Amount:
+		return fmt.Errorf("数量为 %d，预期 %d", actual.Amount, expected.Amount)
+	case !bytes.Equal(actual.Data, expected.Data):
+		return fmt.Errorf("调用数据不符")
+	}
+	return nil
+}
+
+// walkProto 逐个读取 protobuf 消息的字段，varint 字段传入 value，长度前缀字段传入 field
+func walkProto(msg []byte, visit func(num protowire.Number, value uint64, field []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return fmt.Errorf("protobuf 解析失败: %w", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		var value uint64
+		var field []byte
+		switch typ {
+		case protowire.VarintType:
+			value, n = protowire.ConsumeVarint(msg)
+		case protowire.BytesType:
+			field, n = protowire.ConsumeBytes(msg)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+		}
+		if n < 0 {
+			return fmt.Errorf("protobuf 解析失败: %w", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		if err := visit(num, value, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+)
+
+// tronAddressPrefix TRON 主网地址的版本字节，十六进制地址以 41 开头，Base58 地址以 T 开头
+const tronAddressPrefix = 0x41
+
+// TRC20 转账方法的函数选择器
+const (
+	trc20Transfer     = "a9059cbb" // transfer(address,uint256)
+	trc20TransferFrom = "23b872dd" // transferFrom(address,address,uint256)
+)
+
+// tronBlockBatch getblockbylimitnext 单次最多返回 100 个区块
+const tronBlockBatch = 100
+
+// TronWatcher 通过 TRON HTTP API（TRON_API_URLS 逗号分隔，也可用单个 TRON_API_URL，TronGrid 如 https://api.trongrid.io，
+// 或自建 java-tron 节点；多个地址按健康评分故障切换，见 EndpointPool）
+// 逐块扫描 TRC20 代币的 transfer/transferFrom 调用，把转入收款地址的交易交给入账归属，并随新区块推进确认数。
+// TRON 的代币转账不走 EVM 式的日志订阅，而是解析 TriggerSmartContract 交易的调用数据，地址为 41 开头的十六进制，
+// 与账单上的 Base58 地址相互转换后比较。合约内部转账（如经由归集合约的转账）不在区块交易中，需人工复核补录
+type TronWatcher struct {
+	crypto   *CryptoService
+	hub      *CheckoutHub
+	pool     *EndpointPool
+	apiKey   string
+	client   *http.Client
+	tokens   map[string]Asset // Base58 合约地址 -> 币种
+	interval time.Duration
+	batch    int64
+
+	next int64 // 下一个待扫描的区块
+}
+
+// NewTronWatcher 未配置 TRON_API_URLS 时返回 nil
+func NewTronWatcher(crypto *CryptoService, hub *CheckoutHub) *TronWatcher {
+	var urls []string
+	for _, raw := range splitList(envString("TRON_API_URLS", os.Getenv("TRON_API_URL"))) {
+		urls = append(urls, strings.TrimRight(raw, "/"))
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	w := &TronWatcher{
+		crypto:   crypto,
+		hub:      hub,
+		pool:     crypto.newEndpointPool("TRC20", "TRON", urls),
+		apiKey:   os.Getenv("TRON_API_KEY"),
+		client:   &http.Client{Timeout: envDuration("RPC_HTTP_TIMEOUT", 10*time.Second)},
+		tokens:   make(map[string]Asset),
+		interval: envDuration("TRON_POLL_INTERVAL", 3*time.Second),
+		batch:    int64(min(envInt("TRON_BLOCK_BATCH", 20), tronBlockBatch)),
+		next:     int64(envInt("TRON_START_BLOCK", 0)),
+	}
+	for _, asset := range assetsOnNetwork("TRC20") {
+		if token, ok := tokenRegistry.Lookup(asset); ok {
+			w.tokens[token.Contract] = asset
+		}
+	}
+	crypto.registerChain("TRC20", w)
+	crypto.registerSweepSender("TRC20", w)
+	return w
+}
+
+func (w *TronWatcher) Run(ctx context.Context) {
+	log.Printf("TRON 链上监听已启动，%d 个节点，轮询间隔 %s", w.pool.Len(), w.interval)
+	go w.pool.RunHealthChecks(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		var head tronBlock
+		return w.request(ctx, ep.URL, "/wallet/getnowblock", nil, &head)
+	})
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("TRON 链上监听失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type tronBlock struct {
+	BlockID     string `json:"blockID"`
+	BlockHeader struct {
+		RawData struct {
+			Number    int64 `json:"number"`
+			Timestamp int64 `json:"timestamp"` // 毫秒
+		} `json:"raw_data"`
+	} `json:"block_header"`
+	Transactions []tronTransaction `json:"transactions"`
+}
+
+type tronTransaction struct {
+	TxID string `json:"txID"`
+	Ret  []struct {
+		ContractRet string `json:"contractRet"`
+	} `json:"ret"`
+	RawData struct {
+		Contract []struct {
+			Type      string `json:"type"`
+			Parameter struct {
+				Value struct {
+					Data            string `json:"data"`
+					OwnerAddress    string `json:"owner_address"`
+					ContractAddress string `json:"contract_address"`
+				} `json:"value"`
+			} `json:"parameter"`
+		} `json:"contract"`
+	} `json:"raw_data"`
+}
+
+// poll 扫描上次之后的新区块，再按链头推进确认数
+func (w *TronWatcher) poll(ctx context.Context) error {
+	var head tronBlock
+	if err := w.post(ctx, "/wallet/getnowblock", nil, &head); err != nil {
+		return err
+	}
+	height := head.BlockHeader.RawData.Number
+	if height <= 0 {
+		return fmt.Errorf("节点未返回最新区块")
+	}
+	if w.next <= 0 {
+		// 未指定起始区块时从尚未最终确认的区块开始，覆盖重启期间可能漏掉的入账
+		w.next = max(height-int64(requiredConfirmations("TRC20"))+1, 1)
+	}
+
+	for w.next <= height {
+		to := min(height, w.next+w.batch-1)
+		if err := w.scan(ctx, w.next, to); err != nil {
+			return err
+		}
+		w.next = to + 1
+	}
+
+	blockTime := time.UnixMilli(head.BlockHeader.RawData.Timestamp)
+	w.crypto.scanners.Observe("TRC20", height, &blockTime)
+
+	changed, err := w.crypto.AdvanceConfirmations(ctx, "TRC20", height, w)
+	if err != nil {
+		return err
+	}
+	publishConfirmations(w.hub, changed)
+	return nil
+}
+
+// scan 扫描 [from, to] 区块范围内转入收款地址的代币
+func (w *TronWatcher) scan(ctx context.Context, from, to int64) error {
+	watched, err := w.crypto.watchedAddresses("TRC20")
+	if err != nil {
+		return err
+	}
+	if len(watched) == 0 {
+		return nil
+	}
+
+	var resp struct {
+		Block []tronBlock `json:"block"`
+	}
+	// endNum 不包含在返回结果中
+	if err := w.post(ctx, "/wallet/getblockbylimitnext", map[string]int64{"startNum": from, "endNum": to + 1}, &resp); err != nil {
+		return err
+	}
+	if int64(len(resp.Block)) < to-from+1 {
+		return fmt.Errorf("区块 %d-%d 只返回了 %d 个", from, to, len(resp.Block))
+	}
+
+	for _, block := range resp.Block {
+		blockTime := time.UnixMilli(block.BlockHeader.RawData.Timestamp)
+		for _, tx := range block.Transactions {
+			if len(tx.Ret) == 0 || tx.Ret[0].ContractRet != "SUCCESS" || len(tx.RawData.Contract) != 1 {
+				continue
+			}
+			contract := tx.RawData.Contract[0]
+			if contract.Type != "TriggerSmartContract" {
+				continue
+			}
+			asset, ok := w.tokens[tronBase58Address(contract.Parameter.Value.ContractAddress)]
+			if !ok {
+				continue
+			}
+			recipient, units, ok := decodeTRC20Transfer(contract.Parameter.Value.Data)
+			if !ok || !watched[asset.Currency][recipient] {
+				continue
+			}
+
+			w.crypto.deliverTransfer(w.hub, &InboundTransfer{
+				TxHash:      tx.TxID,
+				Address:     recipient,
+				Currency:    asset.Currency,
+				Network:     "TRC20",
+				Amount:      unitsToAmount(units, asset.Decimals()),
+				BlockHeight: block.BlockHeader.RawData.Number,
+				BlockHash:   block.BlockID,
+				BlockTime:   &blockTime,
+				Senders:     []string{tronBase58Address(contract.Parameter.Value.OwnerAddress)},
+			})
+		}
+	}
+	return nil
+}
+
+// LocateTx 交易所在区块。TRON 出块由超级代表轮流完成，分叉极少，但未固化的区块仍可能被替换
+func (w *TronWatcher) LocateTx(ctx context.Context, txHash string) (TxLocation, bool, error) {
+	var info struct {
+		BlockNumber int64 `json:"blockNumber"`
+	}
+	if err := w.post(ctx, "/wallet/gettransactioninfobyid", map[string]string{"value": txHash}, &info); err != nil {
+		return TxLocation{}, false, err
+	}
+	// 查不到的交易返回空对象
+	return TxLocation{Height: info.BlockNumber}, info.BlockNumber > 0, nil
+}
+
+// FetchTx 按哈希查询交易，解析其中的 TRC20 transfer/transferFrom 调用
+func (w *TronWatcher) FetchTx(ctx context.Context, txHash string) (*ChainTx, error) {
+	var tx tronTransaction
+	if err := w.post(ctx, "/wallet/gettransactionbyid", map[string]string{"value": txHash}, &tx); err != nil {
+		return nil, err
+	}
+	// 查不到的交易返回空对象
+	if tx.TxID == "" {
+		return nil, nil
+	}
+	var head tronBlock
+	if err := w.post(ctx, "/wallet/getnowblock", nil, &head); err != nil {
+		return nil, err
+	}
+	located, _, err := w.LocateTx(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: tx.TxID, BlockHeight: located.Height, Head: head.BlockHeader.RawData.Number}
+	if len(tx.Ret) > 0 && tx.Ret[0].ContractRet != "" && tx.Ret[0].ContractRet != "SUCCESS" {
+		result.Failed = true
+	}
+	for _, contract := range tx.RawData.Contract {
+		if contract.Type != "TriggerSmartContract" {
+			continue
+		}
+		recipient, units, ok := decodeTRC20Transfer(contract.Parameter.Value.Data)
+		if !ok {
+			continue
+		}
+		address := tronBase58Address(contract.Parameter.Value.ContractAddress)
+		result.Transfers = append(result.Transfers, ChainTransfer{
+			To:       recipient,
+			Currency: w.tokens[address].Currency,
+			Contract: address,
+			Units:    units,
+		})
+	}
+	return result, nil
+}
+
+// Balance 通过只读调用代币合约的 balanceOf 查询余额
+func (w *TronWatcher) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	var contract string
+	for candidate, token := range w.tokens {
+		if token == asset {
+			contract = candidate
+		}
+	}
+	if contract == "" {
+		return nil, fmt.Errorf("未配置 %s_CONTRACT", asset.Key())
+	}
+	hexAddr, err := tronHexAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		ConstantResult []string `json:"constant_result"`
+		Result         struct {
+			Message string `json:"message"`
+		} `json:"result"`
+	}
+	payload := map[string]interface{}{
+		"owner_address":     address,
+		"contract_address":  contract,
+		"function_selector": "balanceOf(address)",
+		// ABI 编码的地址参数不带 41 前缀
+		"parameter": strings.Repeat("0", 24) + hexAddr[2:],
+		"visible":   true,
+	}
+	if err := w.post(ctx, "/wallet/triggerconstantcontract", payload, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.ConstantResult) == 0 {
+		return nil, fmt.Errorf("balanceOf 调用失败: %s", resp.Result.Message)
+	}
+	return parseHexUnits(resp.ConstantResult[0])
+}
+
+func (w *TronWatcher) post(ctx context.Context, path string, payload interface{}, result interface{}) error {
+	return w.pool.Do(ctx, func(ctx context.Context, ep *rpcEndpoint) error {
+		return w.request(ctx, ep.URL, path, payload, result)
+	}, nil)
+}
+
+func (w *TronWatcher) request(ctx context.Context, apiURL, path string, payload interface{}, result interface{}) error {
+	if payload == nil {
+		payload = struct{}{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.apiKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", w.apiKey)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s 请求失败: %w", path, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 HTTP %d: %s", path, resp.StatusCode, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("%s 响应解析失败: %w", path, err)
+	}
+	return nil
+}
+
+// decodeTRC20Transfer 解析 transfer/transferFrom 调用数据，返回 Base58 格式的收款地址和最小单位数量
+func decodeTRC20Transfer(data string) (string, *big.Int, bool) {
+	recipient, units, ok := decodeTransferCall(data)
+	if !ok {
+		return "", nil, false
+	}
+	recipient = tronBase58Address(recipient)
+	return recipient, units, recipient != ""
+}
+
+// decodeTransferCall 解析 ERC20/TRC20 的 transfer/transferFrom 调用数据，返回收款地址的 20 字节十六进制（不带前缀）和最小单位数量
+func decodeTransferCall(data string) (string, *big.Int, bool) {
+	data = strings.ToLower(strings.TrimPrefix(data, "0x"))
+	if len(data) < 8 {
+		return "", nil, false
+	}
+	var args string
+	switch data[:8] {
+	case trc20Transfer:
+		args = data[8:]
+	case trc20TransferFrom:
+		// 跳过 from 参数
+		if len(data) < 8+64 {
+			return "", nil, false
+		}
+		args = data[8+64:]
+	default:
+		return "", nil, false
+	}
+	if len(args) < 128 {
+		return "", nil, false
+	}
+
+	// ABI 编码的地址参数为 32 字节，低 20 字节是地址（TRON 地址不带 41 前缀）
+	recipient := args[24:64]
+	units, ok := new(big.Int).SetString(args[64:128], 16)
+	if !ok || units.Sign() <= 0 {
+		return "", nil, false
+	}
+	return recipient, units, true
+}
+
+// tronBase58Address 十六进制地址（41 开头的 21 字节，或不带前缀的 20 字节）转为 Base58Check 地址，无法解析时返回空
+func tronBase58Address(hexAddr string) string {
+	raw, err := hex.DecodeString(strings.TrimPrefix(hexAddr, "0x"))
+	if err != nil {
+		return ""
+	}
+	switch {
+	case len(raw) == 21 && raw[0] == tronAddressPrefix:
+		raw = raw[1:]
+	case len(raw) != 20:
+		return ""
+	}
+	return base58.CheckEncode(raw, tronAddressPrefix)
+}
+
+// tronHexAddress Base58Check 地址转为 41 开头的十六进制地址
+func tronHexAddress(address string) (string, error) {
+	payload, version, err := base58.CheckDecode(address)
+	if err != nil {
+		return "", err
+	}
+	if version != tronAddressPrefix || len(payload) != 20 {
+		return "", fmt.Errorf("不是 TRON 地址: %s", address)
+	}
+	return hex.EncodeToString(append([]byte{version}, payload...)), nil
+}
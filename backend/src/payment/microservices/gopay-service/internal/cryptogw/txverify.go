@@ -0,0 +1,245 @@
+package cryptogw
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// ChainTransfer 交易中的一笔转账
+type ChainTransfer struct {
+	To       string
+	Currency string // 按合约识别的币种，未知合约为空
+	Contract string // 代币合约（Solana 为 mint），原生币为空
+	Units    *big.Int
+	Memo     string // XRP 的 Destination Tag、Stellar 的 memo、TON 的转账注释，其他网络为空
+}
+
+// ChainTx 按哈希查到的链上交易
+type ChainTx struct {
+	TxHash      string
+	BlockHeight int64 // 0 表示尚未打包
+	BlockHash   string
+	Failed      bool  // 已打包但执行失败，转账不会到账
+	Head        int64 // 查询时的链头高度
+	Transfers   []ChainTransfer
+}
+
+// ChainReader 链上监听器实现，供交易核验和余额查询直接读取链上数据
+type ChainReader interface {
+	// FetchTx 交易不存在（或已被链重组丢弃且不在内存池）时返回 nil
+	FetchTx(ctx context.Context, txHash string) (*ChainTx, error)
+	// Balance 地址持有的币种数量，以链上最小单位计
+	Balance(ctx context.Context, address string, asset Asset) (*big.Int, error)
+}
+
+// registerChain 登记网络的链上读取接口，由监听器创建时调用
+func (cs *CryptoService) registerChain(network string, reader ChainReader) {
+	cs.chainsMu.Lock()
+	defer cs.chainsMu.Unlock()
+	if cs.chains == nil {
+		cs.chains = make(map[string]ChainReader)
+	}
+	cs.chains[network] = reader
+}
+
+func (cs *CryptoService) chainReader(network string) ChainReader {
+	cs.chainsMu.RLock()
+	defer cs.chainsMu.RUnlock()
+	return cs.chains[network]
+}
+
+// 交易核验项
+const (
+	checkFormat        = "format"        // 交易哈希格式
+	checkFound         = "found"         // 交易存在于链上或内存池
+	checkSucceeded     = "succeeded"     // 交易执行成功
+	checkToken         = "token"         // 转账的币种（代币合约）正确
+	checkDestination   = "destination"   // 转入指定的收款地址
+	checkAmount        = "amount"        // 到账数量不少于应付数量
+	checkConfirmations = "confirmations" // 达到所需确认数
+)
+
+// TxVerificationRequest 交易核验参数。指定 paymentId 时按账单的收款地址、币种和应付数量核验
+type TxVerificationRequest struct {
+	TxHash    string
+	Currency  string
+	Network   string
+	Address   string
+	Amount    string
+	PaymentID string
+}
+
+// VerificationCheck 单项核验结果
+type VerificationCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// VerifiedTransfer 交易中该币种的转账
+type VerifiedTransfer struct {
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+}
+
+// TxVerification 交易核验报告，valid 为全部核验项均通过
+type TxVerification struct {
+	TxHash                string              `json:"txHash"`
+	Currency              string              `json:"currency"`
+	Network               string              `json:"network"`
+	Valid                 bool                `json:"valid"`
+	TxStatus              string              `json:"txStatus,omitempty"`
+	BlockHeight           int64               `json:"blockHeight,omitempty"`
+	BlockHash             string              `json:"blockHash,omitempty"`
+	Confirmations         int                 `json:"confirmations"`
+	RequiredConfirmations int                 `json:"requiredConfirmations"`
+	Address               string              `json:"address,omitempty"`
+	ExpectedAmount        string              `json:"expectedAmount,omitempty"`
+	ReceivedAmount        string              `json:"receivedAmount,omitempty"`
+	Transfers             []VerifiedTransfer  `json:"transfers,omitempty"`
+	Checks                []VerificationCheck `json:"checks"`
+	CheckedAt             time.Time           `json:"checkedAt"`
+}
+
+func (v *TxVerification) check(name string, passed bool, detail string) bool {
+	v.Checks = append(v.Checks, VerificationCheck{Name: name, Passed: passed, Detail: detail})
+	return passed
+}
+
+// validTxHash 交易哈希的格式
+func validTxHash(network, txHash string) bool {
+	switch network {
+	case "BTC", "TRC20", "XRP", "XLM":
+		_, err := hex.DecodeString(txHash)
+		return len(txHash) == 64 && err == nil
+	case "TON":
+		// toncenter 接受十六进制或 Base64 的交易哈希
+		_, err := hex.DecodeString(txHash)
+		return (len(txHash) == 64 && err == nil) || len(txHash) == 44
+	case "SOL":
+		return isSolanaSignature(txHash)
+	default:
+		return len(txHash) == 66 && txHash[:2] == "0x"
+	}
+}
+
+// ValidateTransaction 通过该网络的链上节点核验交易：交易存在且执行成功、币种（代币合约）正确，
+// 指定了收款地址和应付数量时核对转入地址和到账数量，并按所需确认数核对确认深度，返回逐项核验报告
+func (cs *CryptoService) ValidateTransaction(ctx context.Context, req *TxVerificationRequest) (*apierr.Response, error) {
+	if req.TxHash == "" {
+		return apierr.ErrorResponse("INVALID_PARAMS", "交易哈希不能为空"), nil
+	}
+	if req.PaymentID != "" {
+		invoice, err := cs.invoices.Get(req.PaymentID)
+		if err != nil {
+			return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+		}
+		req.Currency, req.Network = invoice.Currency, invoice.Network
+		req.Address, req.Amount = invoice.Address, invoice.AmountExact
+	}
+	asset, err := NormalizeAsset(req.Currency, req.Network)
+	if err != nil {
+		return apierr.ErrorResponse("UNSUPPORTED_CURRENCY", err.Error()), nil
+	}
+	var expected *big.Rat
+	if req.Amount != "" {
+		var ok bool
+		if expected, ok = new(big.Rat).SetString(req.Amount); !ok || expected.Sign() <= 0 {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("amount 无效: %s", req.Amount)), nil
+		}
+	}
+
+	report := &TxVerification{
+		TxHash:                req.TxHash,
+		Currency:              asset.Currency,
+		Network:               asset.Network,
+		RequiredConfirmations: requiredConfirmations(asset.Network),
+		Address:               req.Address,
+		Checks:                []VerificationCheck{},
+		CheckedAt:             time.Now(),
+	}
+	if expected != nil {
+		report.ExpectedAmount = formatAmount(expected, asset.Decimals())
+	}
+	if !report.check(checkFormat, validTxHash(asset.Network, req.TxHash), "") {
+		return apierr.SuccessResponse(report), nil
+	}
+
+	reader := cs.chainReader(asset.Network)
+	if reader == nil {
+		return apierr.ErrorResponse("CHAIN_UNAVAILABLE", fmt.Sprintf("未配置 %s 节点，无法核验链上交易", networkNames[asset.Network])), nil
+	}
+	tx, err := reader.FetchTx(ctx, req.TxHash)
+	if err != nil {
+		return apierr.ErrorResponse("CHAIN_UNAVAILABLE", fmt.Sprintf("查询 %s 交易失败: %v", networkNames[asset.Network], err)), nil
+	}
+	if !report.check(checkFound, tx != nil, "") {
+		return apierr.SuccessResponse(report), nil
+	}
+
+	report.TxStatus = model.TxPending
+	if tx.BlockHeight > 0 {
+		report.TxStatus = model.TxMined
+		report.BlockHeight, report.BlockHash = tx.BlockHeight, tx.BlockHash
+		if tx.Head >= tx.BlockHeight {
+			report.Confirmations = int(tx.Head-tx.BlockHeight) + 1
+		}
+	}
+	valid := report.check(checkSucceeded, !tx.Failed, "")
+
+	var contracts []string
+	received := new(big.Int)
+	for _, transfer := range tx.Transfers {
+		if transfer.Currency != asset.Currency {
+			if transfer.Contract != "" {
+				contracts = append(contracts, transfer.Contract)
+			}
+			continue
+		}
+		report.Transfers = append(report.Transfers, VerifiedTransfer{
+			To:     transfer.To,
+			Amount: formatAmount(new(big.Rat).SetFrac(transfer.Units, pow10(asset.Decimals())), asset.Decimals()),
+		})
+		if req.Address == "" || strings.EqualFold(transfer.To, req.Address) {
+			received.Add(received, transfer.Units)
+		}
+	}
+	detail := ""
+	if len(report.Transfers) == 0 && len(contracts) > 0 {
+		detail = fmt.Sprintf("交易转账的合约为 %s", strings.Join(contracts, ", "))
+	}
+	valid = report.check(checkToken, len(report.Transfers) > 0, detail) && valid
+	receivedAmount := new(big.Rat).SetFrac(received, pow10(asset.Decimals()))
+	report.ReceivedAmount = formatAmount(receivedAmount, asset.Decimals())
+
+	if req.Address != "" {
+		valid = report.check(checkDestination, received.Sign() > 0, "") && valid
+	}
+	if expected != nil {
+		paid, _ := receivedAmount.Float64()
+		want, _ := expected.Float64()
+		enough := receivedAmount.Cmp(expected) >= 0 || cs.amountMatches(want, paid)
+		detail := ""
+		if !enough {
+			detail = fmt.Sprintf("到账 %s，少于应付 %s", report.ReceivedAmount, report.ExpectedAmount)
+		} else if !cs.amountMatches(want, paid) {
+			detail = fmt.Sprintf("到账 %s，多于应付 %s", report.ReceivedAmount, report.ExpectedAmount)
+		}
+		valid = report.check(checkAmount, enough, detail) && valid
+	}
+	detail = ""
+	if report.TxStatus == model.TxPending {
+		detail = "交易尚未打包"
+	}
+	valid = report.check(checkConfirmations, report.Confirmations >= report.RequiredConfirmations, detail) && valid
+
+	report.Valid = valid
+	return apierr.SuccessResponse(report), nil
+}
@@ -0,0 +1,247 @@
+package cryptogw
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopay-service/internal/model"
+)
+
+// 账单回调事件
+const (
+	WebhookPaymentDetected   = "crypto.payment.detected"   // 交易池或区块中发现入账
+	WebhookPaymentConfirming = "crypto.payment.confirming" // 确认数增加，直到达到所需确认数
+	WebhookPaymentConfirmed  = "crypto.payment.confirmed"
+	WebhookPaymentExpired    = "crypto.payment.expired"
+	WebhookPaymentReverted   = "crypto.payment.reverted" // 已确认的入账被链重组，退回确认中
+	WebhookPaymentFailed     = "crypto.payment.failed"
+	WebhookPaymentHeld       = "crypto.payment.held" // 合规复核挂起
+	WebhookPaymentRejected   = "crypto.payment.rejected"
+)
+
+// CryptoWebhookEvent 回调请求体。同一账单的事件可能并发投递，接收方按 confirmations 和 occurredAt 忽略过时的进度
+type CryptoWebhookEvent struct {
+	EventID               string  `json:"eventId"`
+	Type                  string  `json:"type"`
+	PaymentID             string  `json:"paymentId"`
+	OrderID               string  `json:"orderId"`
+	Currency              string  `json:"currency"`
+	Network               string  `json:"network"`
+	Status                string  `json:"status"`
+	TxHash                string  `json:"txHash,omitempty"`
+	Confirmations         int     `json:"confirmations"`
+	RequiredConfirmations int     `json:"requiredConfirmations,omitempty"`
+	Progress              string  `json:"progress,omitempty"` // 确认进度，如 1/12
+	ExpectedAmount        string  `json:"expectedAmount,omitempty"`
+	ActualAmount          float64 `json:"actualAmount,omitempty"`
+	OccurredAt            string  `json:"occurredAt"`
+}
+
+// CryptoWebhooks 按收银台事件流推导账单的里程碑并回调业务方：发现入账、每次确认数增加（至所需确认数为止）、
+// 最终确认和过期，以及链重组退回、失败和合规挂起。回调地址为 CRYPTO_WEBHOOK_URLS（逗号分隔）及下单时的 callbackUrl，
+// 签名与支付回调相同：X-Webhook-Signature 为 HMAC-SHA256(CRYPTO_WEBHOOK_SECRET, 时间戳 + "." + 请求体)。
+// 失败按 CRYPTO_WEBHOOK_RETRY_BACKOFF（默认 2 秒）指数退避重试，最多 CRYPTO_WEBHOOK_MAX_ATTEMPTS（默认 5）次。
+// 已通知的进度只保存在内存中，服务重启后同一里程碑可能重复通知
+type CryptoWebhooks struct {
+	crypto   *CryptoService
+	urls     []string
+	secret   string
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+
+	mu       sync.Mutex
+	notified map[string]model.CryptoPaymentStatus // 最近一次回调时的账单状态
+}
+
+func NewCryptoWebhooks(crypto *CryptoService) *CryptoWebhooks {
+	w := &CryptoWebhooks{
+		crypto:   crypto,
+		urls:     splitList(os.Getenv("CRYPTO_WEBHOOK_URLS")),
+		secret:   os.Getenv("CRYPTO_WEBHOOK_SECRET"),
+		client:   &http.Client{Timeout: envDuration("CRYPTO_WEBHOOK_TIMEOUT", 10*time.Second)},
+		attempts: max(envInt("CRYPTO_WEBHOOK_MAX_ATTEMPTS", 5), 1),
+		backoff:  envDuration("CRYPTO_WEBHOOK_RETRY_BACKOFF", 2*time.Second),
+		notified: make(map[string]model.CryptoPaymentStatus),
+	}
+	for _, target := range w.urls {
+		if err := validateCallbackURL(target); err != nil {
+			log.Fatalf("CRYPTO_WEBHOOK_URLS 配置错误: %v", err)
+		}
+	}
+	if w.secret == "" {
+		log.Printf("【警告】未配置 CRYPTO_WEBHOOK_SECRET，账单回调不签名")
+	}
+	return w
+}
+
+// validateCallbackURL 回调地址须为 http 或 https
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("无效的回调地址: %s", raw)
+	}
+	return nil
+}
+
+// observe 收银台事件的监听函数，只处理携带账单状态的事件
+func (w *CryptoWebhooks) observe(paymentID string, event CheckoutEvent) {
+	status, ok := event.Data.(*model.CryptoPaymentStatus)
+	if !ok {
+		return
+	}
+	invoice, err := w.crypto.invoices.Get(paymentID)
+	if err != nil {
+		return
+	}
+	targets := w.urls
+	if invoice.CallbackURL != "" {
+		targets = append(append([]string(nil), w.urls...), invoice.CallbackURL)
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	types := w.milestones(status)
+	if len(types) == 0 {
+		return
+	}
+	now := time.Now()
+	events := make([]*CryptoWebhookEvent, 0, len(types))
+	for _, eventType := range types {
+		e := &CryptoWebhookEvent{
+			EventID:               fmt.Sprintf("CWH%d", now.UnixNano()+int64(len(events))),
+			Type:                  eventType,
+			PaymentID:             invoice.PaymentID,
+			OrderID:               invoice.OrderID,
+			Currency:              invoice.Currency,
+			Network:               invoice.Network,
+			Status:                status.Status,
+			TxHash:                status.TxHash,
+			Confirmations:         status.Confirmations,
+			RequiredConfirmations: status.RequiredConfirmations,
+			ExpectedAmount:        status.ExpectedAmount,
+			ActualAmount:          status.ActualAmount,
+			OccurredAt:            now.Format(time.RFC3339Nano),
+		}
+		if status.RequiredConfirmations > 0 && status.TxHash != "" {
+			e.Progress = fmt.Sprintf("%d/%d", min(status.Confirmations, status.RequiredConfirmations), status.RequiredConfirmations)
+		}
+		events = append(events, e)
+	}
+	go w.send(targets, events)
+}
+
+// milestones 与上次回调时的状态比较，得出需要回调的事件
+func (w *CryptoWebhooks) milestones(status *model.CryptoPaymentStatus) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	last := w.notified[status.PaymentID]
+	var types []string
+	switch status.Status {
+	case InvoiceConfirming, InvoiceUnderpaid, InvoiceOverpaid:
+		if last.Status == InvoiceConfirmed {
+			types = append(types, WebhookPaymentReverted)
+		}
+		confirmed := last.Confirmations
+		if status.TxHash != last.TxHash {
+			// 新入账，或 RBF 替换后的交易
+			types = append(types, WebhookPaymentDetected)
+			confirmed = 0
+		}
+		if status.Confirmations > confirmed && (status.RequiredConfirmations == 0 || confirmed < status.RequiredConfirmations) {
+			types = append(types, WebhookPaymentConfirming)
+		}
+	case InvoiceConfirmed:
+		if last.Status != InvoiceConfirmed {
+			types = append(types, WebhookPaymentConfirmed)
+		}
+	case InvoiceExpired, InvoiceFailed, InvoiceHeld, InvoiceRejected:
+		if last.Status != status.Status {
+			types = append(types, "crypto.payment."+status.Status)
+		}
+	}
+
+	switch status.Status {
+	case InvoiceExpired, InvoiceFailed, InvoiceRejected:
+		// 终态不再有进度，过期账单之后的迟到付款按新入账通知
+		delete(w.notified, status.PaymentID)
+	default:
+		w.notified[status.PaymentID] = *status
+	}
+	return types
+}
+
+// send 按顺序投递同一批事件，每个回调地址独立重试
+func (w *CryptoWebhooks) send(targets []string, events []*CryptoWebhookEvent) {
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("【回调】编码账单 %s 的事件 %s 失败: %v", event.PaymentID, event.Type, err)
+			continue
+		}
+		for _, target := range targets {
+			w.deliverWithRetry(target, event, body)
+		}
+	}
+}
+
+func (w *CryptoWebhooks) deliverWithRetry(target string, event *CryptoWebhookEvent, body []byte) {
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err := w.deliver(target, event, body)
+		if err == nil {
+			return
+		}
+		if attempt >= w.attempts {
+			log.Printf("【回调】账单 %s 的事件 %s 推送到 %s 失败，已重试 %d 次: %v", event.PaymentID, event.Type, target, attempt, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// deliver 发送一次回调，2xx 视为成功
+func (w *CryptoWebhooks) deliver(target string, event *CryptoWebhookEvent, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("回调方返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package cryptogw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// XRPLedger 通过 rippled JSON-RPC（XRP_RPC_URLS 逗号分隔，如 https://xrplcluster.com，多个地址按健康评分故障切换）
+// 核验外部监听服务上报的 XRP 入账，并按最新验证账本推进确认数。交易只有进入已验证账本才最终生效，
+// 未验证的交易按未打包处理；到账数量取 delivered_amount，部分支付（tfPartialPayment）的 Amount 字段不可信
+type XRPLedger struct {
+	crypto *CryptoService
+	hub    *CheckoutHub
+	pool   *EndpointPool
+	rpc    *jsonRPCClient
+}
+
+// NewXRPLedger 未配置 XRP_RPC_URLS 时返回 nil
+func NewXRPLedger(crypto *CryptoService, hub *CheckoutHub) *XRPLedger {
+	urls := splitList(os.Getenv("XRP_RPC_URLS"))
+	if len(urls) == 0 {
+		return nil
+	}
+	pool := crypto.newEndpointPool("XRP", "XRP", urls)
+	w := &XRPLedger{crypto: crypto, hub: hub, pool: pool, rpc: newJSONRPCClient(pool, 0)}
+	crypto.registerChain("XRP", w)
+	return w
+}
+
+func (w *XRPLedger) Run(ctx context.Context) {
+	log.Printf("XRP Ledger 入账核验已启动，%d 个节点", w.pool.Len())
+	go w.pool.RunHealthChecks(ctx, w.rpc.Probe("server_info"))
+	w.crypto.trackLedger(ctx, w.hub, "XRP", w)
+}
+
+// xrplResult rippled 把业务错误放在 result 中返回
+type xrplResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+func (r xrplResult) err() error {
+	if r.Status == "error" {
+		return fmt.Errorf("rippled 返回错误: %s", r.Error)
+	}
+	return nil
+}
+
+type xrplTx struct {
+	xrplResult
+	Hash            string  `json:"hash"`
+	TransactionType string  `json:"TransactionType"`
+	Destination     string  `json:"Destination"`
+	DestinationTag  *uint32 `json:"DestinationTag"`
+	LedgerIndex     int64   `json:"ledger_index"`
+	Validated       bool    `json:"validated"`
+	Meta            struct {
+		TransactionResult string          `json:"TransactionResult"`
+		DeliveredAmount   json.RawMessage `json:"delivered_amount"`
+	} `json:"meta"`
+}
+
+// tx 按哈希查询交易，不存在时返回 nil
+func (w *XRPLedger) tx(ctx context.Context, txHash string) (*xrplTx, error) {
+	var tx xrplTx
+	if err := w.rpc.Call(ctx, "tx", []interface{}{map[string]interface{}{"transaction": txHash, "binary": false}}, &tx); err != nil {
+		return nil, err
+	}
+	if tx.Error == "txnNotFound" {
+		return nil, nil
+	}
+	if err := tx.err(); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Head 最新验证账本的序号
+func (w *XRPLedger) Head(ctx context.Context) (int64, error) {
+	var ledger struct {
+		xrplResult
+		LedgerIndex int64 `json:"ledger_index"`
+	}
+	if err := w.rpc.Call(ctx, "ledger", []interface{}{map[string]string{"ledger_index": "validated"}}, &ledger); err != nil {
+		return 0, err
+	}
+	if err := ledger.err(); err != nil {
+		return 0, err
+	}
+	return ledger.LedgerIndex, nil
+}
+
+// LocateTx 交易所在的已验证账本，尚未验证的交易高度为 0
+func (w *XRPLedger) LocateTx(ctx context.Context, txHash string) (TxLocation, bool, error) {
+	tx, err := w.tx(ctx, txHash)
+	if err != nil || tx == nil {
+		return TxLocation{}, false, err
+	}
+	if !tx.Validated {
+		return TxLocation{}, true, nil
+	}
+	return TxLocation{Height: tx.LedgerIndex}, true, nil
+}
+
+// FetchTx 按哈希查询交易，Payment 交易以 drops 计的实际到账数量作为转账
+func (w *XRPLedger) FetchTx(ctx context.Context, txHash string) (*ChainTx, error) {
+	tx, err := w.tx(ctx, txHash)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	head, err := w.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChainTx{TxHash: strings.ToUpper(tx.Hash), Head: head}
+	if tx.Validated {
+		result.BlockHeight = tx.LedgerIndex
+		result.Failed = tx.Meta.TransactionResult != "tesSUCCESS"
+	}
+	// 发行代币的 delivered_amount 为对象，只接受以字符串表示的 XRP
+	var drops string
+	if tx.TransactionType == "Payment" && json.Unmarshal(tx.Meta.DeliveredAmount, &drops) == nil {
+		units, ok := new(big.Int).SetString(drops, 10)
+		if !ok {
+			return nil, fmt.Errorf("交易 %s 的到账数量无效: %s", txHash, drops)
+		}
+		transfer := ChainTransfer{To: tx.Destination, Currency: "XRP", Units: units}
+		if tx.DestinationTag != nil {
+			transfer.Memo = strconv.FormatUint(uint64(*tx.DestinationTag), 10)
+		}
+		result.Transfers = append(result.Transfers, transfer)
+	}
+	return result, nil
+}
+
+// Balance 账户在最新验证账本中的余额（drops），未激活的账户为 0
+func (w *XRPLedger) Balance(ctx context.Context, address string, asset Asset) (*big.Int, error) {
+	if asset.Currency != "XRP" {
+		return nil, fmt.Errorf("XRP Ledger 不支持 %s", asset.Currency)
+	}
+	var info struct {
+		xrplResult
+		AccountData struct {
+			Balance string `json:"Balance"`
+		} `json:"account_data"`
+	}
+	if err := w.rpc.Call(ctx, "account_info", []interface{}{map[string]string{"account": address, "ledger_index": "validated"}}, &info); err != nil {
+		return nil, err
+	}
+	if info.Error == "actNotFound" {
+		return new(big.Int), nil
+	}
+	if err := info.err(); err != nil {
+		return nil, err
+	}
+	balance, ok := new(big.Int).SetString(info.AccountData.Balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("账户 %s 的余额无效: %s", address, info.AccountData.Balance)
+	}
+	return balance, nil
+}
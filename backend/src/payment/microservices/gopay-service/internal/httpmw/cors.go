@@ -0,0 +1,181 @@
+package httpmw
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 支付服务与加密货币网关共用同一组 CORS_* 配置，两个服务的行为保持一致
+const defaultCORSHeaders = "Content-Type, Authorization, X-API-Key, X-Timestamp, X-Signature, X-Tenant-ID"
+
+// CORSPolicy 跨域访问策略：只对白名单中的来源返回 CORS 头，
+// 预检请求的 Access-Control-Allow-Methods 按路由实际注册的方法返回
+type CORSPolicy struct {
+	origins     []string // 完整来源，或 *.example.com 形式的子域名通配
+	allowAny    bool
+	credentials bool
+	headers     string
+	maxAge      string
+
+	engine    *gin.Engine
+	routeOnce sync.Once
+	routes    []corsRoute
+}
+
+type corsRoute struct {
+	segments []string
+	methods  []string
+}
+
+// NewCORSPolicy 读取 CORS_ALLOWED_ORIGINS 等配置。未配置来源时不返回任何 CORS 头，浏览器跨域请求均被拦截
+func NewCORSPolicy(engine *gin.Engine) *CORSPolicy {
+	cp := &CORSPolicy{
+		credentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		headers:     os.Getenv("CORS_ALLOWED_HEADERS"),
+		maxAge:      strconv.Itoa(int(envDuration("CORS_MAX_AGE", 10*time.Minute).Seconds())),
+		engine:      engine,
+	}
+	if cp.headers == "" {
+		cp.headers = defaultCORSHeaders
+	}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		switch {
+		case origin == "":
+		case origin == "*":
+			cp.allowAny = true
+		default:
+			cp.origins = append(cp.origins, strings.ToLower(origin))
+		}
+	}
+	return cp
+}
+
+// allowed 来源是否在白名单中。携带凭证时浏览器不接受通配，因此 * 只在未开启凭证时生效
+func (cp *CORSPolicy) allowed(origin string) bool {
+	if cp.allowAny && !cp.credentials {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range cp.origins {
+		if allowed == origin {
+			return true
+		}
+		// https://*.example.com 匹配 https://shop.example.com，不匹配 https://example.com
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok {
+			if rest, ok := strings.CutPrefix(origin, scheme+"://"); ok && strings.HasSuffix(rest, "."+host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// methodsFor 返回路径上注册的方法，路由在首次请求时收集，此时全部路由已注册完毕
+func (cp *CORSPolicy) methodsFor(path string) []string {
+	cp.routeOnce.Do(func() {
+		index := make(map[string]int)
+		for _, info := range cp.engine.Routes() {
+			i, ok := index[info.Path]
+			if !ok {
+				i = len(cp.routes)
+				index[info.Path] = i
+				cp.routes = append(cp.routes, corsRoute{segments: strings.Split(strings.Trim(info.Path, "/"), "/")})
+			}
+			cp.routes[i].methods = append(cp.routes[i].methods, info.Method)
+		}
+	})
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var methods []string
+	for _, route := range cp.routes {
+		if matchRouteSegments(route.segments, segments) {
+			methods = append(methods, route.methods...)
+		}
+	}
+	return methods
+}
+
+func matchRouteSegments(pattern, segments []string) bool {
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(p, ":") && p != segments[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+// Middleware 处理跨域请求，须挂在引擎上以便未注册 OPTIONS 的路由也能响应预检
+func (cp *CORSPolicy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !cp.allowed(origin) {
+			if preflight {
+				apierr.RespondError(c, http.StatusForbidden, "CORS_ORIGIN_DENIED", "不允许的跨域来源")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if cp.allowAny && !cp.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cp.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			c.Next()
+			return
+		}
+
+		methods := cp.methodsFor(c.Request.URL.Path)
+		requested := strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))
+		permitted := false
+		for _, method := range methods {
+			permitted = permitted || method == requested
+		}
+		if !permitted {
+			c.Header("Allow", strings.Join(methods, ", "))
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+			return
+		}
+		c.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		c.Header("Access-Control-Allow-Headers", cp.headers)
+		c.Header("Access-Control-Max-Age", cp.maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if raw := os.Getenv(key); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,60 @@
+// Package httpmw 支付服务与加密货币网关共用的 HTTP 中间件和服务启动逻辑：
+// 跨域策略、TLS/mTLS 配置、客户端证书鉴权、健康检查。
+//
+// 两个服务读取同一组 CORS_*、TLS_*、MTLS_* 配置，行为保持一致。
+package httpmw
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// OperatorKey 认证中间件写入上下文的操作人（访问令牌中的用户名），两个服务的管理接口据此记录操作人
+const OperatorKey = "operator"
+
+// Operator 返回认证中间件写入的操作人，未启用认证时为空
+func Operator(c *gin.Context) string {
+	return c.GetString(OperatorKey)
+}
+
+// JSONContentType 默认以 JSON 返回，SSE、文件下载等接口自行覆盖
+func JSONContentType() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		c.Next()
+	}
+}
+
+// Health 健康检查接口，service 为空时不返回服务名
+func Health(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data := gin.H{
+			"status": "ok",
+			"time":   time.Now().Format(time.RFC3339),
+		}
+		if service != "" {
+			data["service"] = service
+		}
+		apierr.RespondOK(c, data)
+	}
+}
+
+// ListenAndServe 在后台按 TLS 配置启动服务，启动失败时退出进程。name 用于日志
+func ListenAndServe(srv *http.Server, tlsConfig *TLSConfig, name string) {
+	go func() {
+		var err error
+		if tlsConfig.Enabled() {
+			err = srv.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("%s启动失败: %v", name, err)
+		}
+	}()
+}
@@ -0,0 +1,186 @@
+package httpmw
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// ClientServiceKey 通过 mTLS 校验的调用方服务名在 gin.Context 中的键
+const ClientServiceKey = "clientService"
+
+// TLSConfig 服务端证书与 mTLS 配置。
+// 只配置 TLS_CERT_FILE/TLS_KEY_FILE 时为单向 TLS；再配置 TLS_CLIENT_CA_FILE 时校验调用方证书。
+// 支付渠道回调、收银台页面和事件流不带客户端证书，因此默认只在调用方出示证书时校验，由 ClientCertAuth 按接口要求证书；
+// TLS_CLIENT_AUTH=require 时握手阶段即要求证书，适用于不对外暴露回调地址和收银台的部署
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	RequireCert  bool
+}
+
+func LoadTLSConfig() *TLSConfig {
+	return &TLSConfig{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		RequireCert:  os.Getenv("TLS_CLIENT_AUTH") == "require",
+	}
+}
+
+// Enabled 是否以 HTTPS 启动
+func (tc *TLSConfig) Enabled() bool {
+	return tc.CertFile != "" && tc.KeyFile != ""
+}
+
+// ServerConfig 构造 http.Server 的 TLS 配置，未启用时返回 nil
+func (tc *TLSConfig) ServerConfig() (*tls.Config, error) {
+	if !tc.Enabled() {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tc.ClientCAFile == "" {
+		return cfg, nil
+	}
+
+	pool, err := loadCertPool(tc.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if tc.RequireCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA 证书 %s 中没有有效证书", path)
+	}
+	return pool, nil
+}
+
+// ClientTLSConfig 服务间调用使用的客户端 TLS 配置：出示本服务证书，并用 TLS_CLIENT_CA_FILE 校验对端。
+// 证书默认与服务端共用，可用 MTLS_CLIENT_CERT_FILE/MTLS_CLIENT_KEY_FILE 单独指定；都未配置时返回 nil
+func (tc *TLSConfig) ClientTLSConfig() (*tls.Config, error) {
+	certFile := os.Getenv("MTLS_CLIENT_CERT_FILE")
+	keyFile := os.Getenv("MTLS_CLIENT_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		certFile, keyFile = tc.CertFile, tc.KeyFile
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if tc.ClientCAFile != "" {
+		if cfg.RootCAs, err = loadCertPool(tc.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// CertPolicy 要求客户端证书的一组写接口及允许调用的服务
+type CertPolicy struct {
+	Name     string   // 用于日志，如 create、refund
+	Paths    []string // 路由模板
+	Services []string // 允许的服务名，为空时不做限制
+}
+
+// ClientCertAuth 按客户端证书限制可调用下单、退款等写接口的内部服务。
+// 服务名取证书 CN 和 DNS SAN；某类接口未配置允许的服务时不做限制
+type ClientCertAuth struct {
+	policies []CertPolicy
+}
+
+func NewClientCertAuth(policies ...CertPolicy) *ClientCertAuth {
+	for _, policy := range policies {
+		if len(policy.Services) > 0 && os.Getenv("TLS_CLIENT_CA_FILE") == "" {
+			log.Printf("【警告】已限制 %s 接口的调用方服务，但未配置 TLS_CLIENT_CA_FILE，这些接口将全部被拒绝", policy.Name)
+		}
+	}
+	return &ClientCertAuth{policies: policies}
+}
+
+// policyFor 返回写接口对应的策略，未配置允许服务的接口返回 nil
+func (ca *ClientCertAuth) policyFor(fullPath, method string) *CertPolicy {
+	if method != http.MethodPost {
+		return nil
+	}
+	for i := range ca.policies {
+		policy := &ca.policies[i]
+		if len(policy.Services) == 0 {
+			continue
+		}
+		for _, path := range policy.Paths {
+			if path == fullPath {
+				return policy
+			}
+		}
+	}
+	return nil
+}
+
+// certServiceNames 返回已验证证书链的叶子证书中的服务名
+func certServiceNames(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	names := append([]string{}, leaf.DNSNames...)
+	if leaf.Subject.CommonName != "" {
+		names = append(names, leaf.Subject.CommonName)
+	}
+	return names
+}
+
+// Middleware 校验客户端证书，须在注册路由前挂载
+func (ca *ClientCertAuth) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := ca.policyFor(c.FullPath(), c.Request.Method)
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		names := certServiceNames(c.Request)
+		if len(names) == 0 {
+			apierr.RespondError(c, http.StatusUnauthorized, "CLIENT_CERT_REQUIRED", "该接口需要内部服务客户端证书")
+			c.Abort()
+			return
+		}
+		for _, name := range names {
+			for _, allowed := range policy.Services {
+				if name == allowed {
+					c.Set(ClientServiceKey, name)
+					c.Next()
+					return
+				}
+			}
+		}
+
+		log.Printf("【mTLS】拒绝服务 %v 调用 %s 接口 %s", names, policy.Name, c.FullPath())
+		apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", "调用方服务无权访问该接口")
+		c.Abort()
+	}
+}
@@ -0,0 +1,130 @@
+// Package model 支付服务与加密货币网关之间传递的数据结构。
+//
+// 网关按这些类型返回数据，支付服务按同样的类型解码，两边不再各自维护一份结构体。
+package model
+
+import "time"
+
+// 链上监听状态
+const (
+	ScannerOK      = "ok"
+	ScannerLagging = "lagging"
+	ScannerUnknown = "unknown" // 启动后尚未收到该链的心跳或入账
+)
+
+// 入账交易状态
+const (
+	TxPending = "pending" // 已在内存池中发现，尚未打包
+	TxMined   = "mined"   // 已打包，确认数见 confirmations
+	TxDropped = "dropped" // 已被链重组移出主链，等待重新打包
+)
+
+// CryptoPaymentRequest 加密货币下单请求，POST /api/v1/crypto/payment/create。
+// 传 fiatAmount 时网关按实时汇率换算应付数量，忽略 amount；否则按 amount 直接以加密货币计价
+type CryptoPaymentRequest struct {
+	OrderID       string  `json:"orderId" binding:"required"`
+	Amount        float64 `json:"amount,omitempty"`
+	Currency      string  `json:"currency" binding:"required"`
+	Network       string  `json:"network,omitempty"` // 币种中已带网络（如 USDT-TRC20）时可省略；Solana 上的 USDC/USDT 为 SOL
+	UserID        int     `json:"userId" binding:"required"`
+	ExpireMinutes int     `json:"expireMinutes,omitempty"`
+	// 金额达到旅行规则门槛（TRAVEL_RULE_THRESHOLD）时须在 originator 中提供付款人信息，见 cryptogw.TravelRuleOriginator
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	FiatCurrency string                 `json:"fiatCurrency,omitempty"` // 订单计价法币，默认 DEFAULT_CURRENCY
+	FiatAmount   float64                `json:"fiatAmount,omitempty"`
+	CallbackURL  string                 `json:"callbackUrl,omitempty"` // 接收发现入账、确认进度、最终确认和过期等回调，与 CRYPTO_WEBHOOK_URLS 叠加
+}
+
+// CryptoPayment 网关返回的收款账单
+type CryptoPayment struct {
+	PaymentID       string  `json:"paymentId"`
+	Address         string  `json:"address"`
+	Currency        string  `json:"currency,omitempty"`
+	Network         string  `json:"network,omitempty"`
+	Amount          float64 `json:"amount"`
+	AmountExact     string  `json:"amountExact,omitempty"` // 按币种报价精度格式化的应付数量，展示和链上比对以此为准
+	BaseUnits       string  `json:"baseUnits,omitempty"`   // 链上最小单位的应付数量
+	Decimals        int     `json:"decimals,omitempty"`    // 链上精度
+	FiatCurrency    string  `json:"fiatCurrency,omitempty"`
+	FiatAmount      float64 `json:"fiatAmount,omitempty"`
+	Rate            float64 `json:"rate,omitempty"` // 锁定汇率：1 单位加密货币折合的法币
+	RateSource      string  `json:"rateSource,omitempty"`
+	RateLockedUntil string  `json:"rateLockedUntil,omitempty"` // 锁定汇率的有效期，不晚于账单过期时间
+	QRCode          string  `json:"qrCode,omitempty"`          // 编码 PaymentURL 的二维码图片（data URI，PNG 或 SVG）
+	Reference       string  `json:"reference,omitempty"`       // Solana Pay 参考公钥
+	Memo            string  `json:"memo,omitempty"`            // XRP 的 Destination Tag、Stellar 的 Memo (ID)、TON 的转账注释，付款时必须填写，否则无法自动入账
+	PaymentURL      string  `json:"paymentUrl,omitempty"`      // 钱包付款链接：BTC 为 BIP21，EVM 链为 EIP-681，TRC20 为 tron:，Solana 为 Solana Pay，XRP、Stellar、TON 带上 memo
+	CheckoutURL     string  `json:"checkoutUrl,omitempty"`     // 托管收银页地址，可直接引导付款人打开
+	TravelRule      bool    `json:"travelRule,omitempty"`      // 达到旅行规则门槛，入账确认前需合规复核
+	ExpiredAt       string  `json:"expiredAt,omitempty"`
+}
+
+// CryptoPaymentStatus 账单状态，GET /api/v1/crypto/payment/query/:paymentId
+type CryptoPaymentStatus struct {
+	PaymentID             string  `json:"paymentId"`
+	Status                string  `json:"status"`
+	TxHash                string  `json:"txHash,omitempty"`
+	TxStatus              string  `json:"txStatus,omitempty"`
+	Replaceable           bool    `json:"replaceable,omitempty"` // 未打包的交易声明了 RBF，打包前可能被替换
+	Confirmations         int     `json:"confirmations,omitempty"`
+	RequiredConfirmations int     `json:"requiredConfirmations,omitempty"`
+	Reorgs                int     `json:"reorgs,omitempty"`     // 入账所在区块被重组的次数
+	RevertedAt            string  `json:"revertedAt,omitempty"` // 已确认后因链重组退回确认中的时间，业务方应暂停发货直到再次确认
+	PaidAt                string  `json:"paidAt,omitempty"`
+	ExpectedAmount        string  `json:"expectedAmount,omitempty"`
+	ActualAmount          float64 `json:"actualAmount,omitempty"`
+	AmountDelta           string  `json:"amountDelta,omitempty"`    // 到账数量减应付数量，状态为 underpaid、overpaid 时不为空
+	TopUpPaymentID        string  `json:"topUpPaymentId,omitempty"` // 少付后生成的补款账单
+	Resolution            string  `json:"resolution,omitempty"`     // 差额处理方式：topup、accept、refund
+	TxURL                 string  `json:"txUrl,omitempty"`          // 入账交易在区块浏览器中的链接
+	AddressURL            string  `json:"addressUrl,omitempty"`     // 收款地址在区块浏览器中的链接
+	// 入账适用的确认数规则
+	ConfirmationPolicy *ConfirmationPolicy `json:"confirmationPolicy,omitempty"`
+}
+
+// ConfirmationPolicy 入账所需确认数的来源：网络默认值，或按入账金额所在档位
+type ConfirmationPolicy struct {
+	Network  string  `json:"network"`
+	Required int     `json:"required"`
+	Rule     string  `json:"rule"`            // network 或 band
+	Band     string  `json:"band,omitempty"`  // 命中的金额档位，如 [50, 500) USD
+	Value    float64 `json:"value,omitempty"` // 入账折合的金额
+	Currency string  `json:"currency,omitempty"`
+}
+
+// CryptoScannerStatus 单条链的监听进度
+type CryptoScannerStatus struct {
+	Network         string     `json:"network"`
+	Status          string     `json:"status"`
+	LastBlockHeight int64      `json:"lastBlockHeight,omitempty"`
+	LastBlockTime   *time.Time `json:"lastBlockTime,omitempty"`
+	LastSeenAt      *time.Time `json:"lastSeenAt,omitempty"`
+	LagSeconds      int        `json:"lagSeconds"`
+}
+
+// CryptoEndpointStatus 链上节点的健康状态，status 为 healthy、down（连续失败，冷却中）或 disabled（配置错误已停用）
+type CryptoEndpointStatus struct {
+	Network             string     `json:"network"`
+	Endpoint            string     `json:"endpoint"` // 只含协议和主机，不展示路径中的 API Key
+	Status              string     `json:"status"`
+	LatencyMs           int64      `json:"latencyMs"`
+	ConsecutiveFailures int        `json:"consecutiveFailures,omitempty"`
+	Requests            int64      `json:"requests"`
+	Errors              int64      `json:"errors"`
+	BudgetPerMinute     int        `json:"budgetPerMinute,omitempty"`
+	DownUntil           *time.Time `json:"downUntil,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// CryptoGatewayStatus 网关运行状态，GET /api/v1/crypto/status，供支付平台汇总状态页使用
+type CryptoGatewayStatus struct {
+	Ready              bool                   `json:"ready"`
+	Error              string                 `json:"error,omitempty"`
+	Scanners           []CryptoScannerStatus  `json:"scanners"`
+	Endpoints          []CryptoEndpointStatus `json:"endpoints,omitempty"` // 网关内置监听器使用的链上节点
+	PendingInvoices    int                    `json:"pendingInvoices"`
+	ConfirmingInvoices int                    `json:"confirmingInvoices"`
+	MismatchedInvoices int                    `json:"mismatchedInvoices"` // 待处理的少付、多付账单
+	ReviewBacklog      int                    `json:"reviewBacklog"`      // 待人工复核的入账
+	GeneratedAt        time.Time              `json:"generatedAt"`
+}
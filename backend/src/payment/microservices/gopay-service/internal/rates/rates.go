@@ -0,0 +1,171 @@
+// Package rates 法币和加密货币汇率，支付服务与加密货币网关共用。
+// 按 RATES_SOURCES 配置的顺序依次查询汇率源，前一个失败时使用下一个；
+// 结果缓存 RATES_CACHE_TTL，全部汇率源都失败时在 RATES_MAX_STALENESS 内继续使用上次的结果
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupportedPair 汇率源不提供该币种对，查询下一个汇率源，不视为故障
+var ErrUnsupportedPair = errors.New("汇率源不支持该币种对")
+
+// Quote 一次汇率查询的结果：1 单位 Base 折合 Rate 单位 Quote。
+// 随支付记录保存，用于事后核对下单时使用的汇率来自哪个汇率源、何时获取
+type Quote struct {
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	Rate      float64   `json:"rate"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	Stale     bool      `json:"stale,omitempty"` // 汇率源全部失败，使用的是过期的缓存
+}
+
+// Convert 将 Base 金额换算为 Quote 金额
+func (q *Quote) Convert(amount float64) float64 {
+	return amount * q.Rate
+}
+
+// Source 汇率源
+type Source interface {
+	Name() string
+	// Rate 返回 1 单位 base 折合的 quote 数量，币种代码为大写
+	Rate(ctx context.Context, base, quote string) (float64, error)
+}
+
+// Service 带缓存和故障切换的汇率查询
+type Service struct {
+	sources      []Source
+	ttl          time.Duration
+	maxStaleness time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*Quote
+}
+
+// NewService 按 RATES_SOURCES（默认 coingecko,erapi,static）创建汇率服务，未知的汇率源名称记录警告后忽略
+func NewService() *Service {
+	var sources []Source
+	for _, name := range splitList(envString("RATES_SOURCES", "coingecko,erapi,static")) {
+		source := newSource(strings.ToLower(name))
+		if source == nil {
+			log.Printf("【警告】未知的汇率源 %s，已忽略", name)
+			continue
+		}
+		sources = append(sources, source)
+	}
+	return NewServiceWithSources(sources,
+		envDuration("RATES_CACHE_TTL", time.Minute),
+		envDuration("RATES_MAX_STALENESS", 10*time.Minute))
+}
+
+// NewServiceWithSources 使用指定的汇率源，maxStaleness 为 0 时不使用过期缓存
+func NewServiceWithSources(sources []Source, ttl, maxStaleness time.Duration) *Service {
+	return &Service{
+		sources:      sources,
+		ttl:          ttl,
+		maxStaleness: maxStaleness,
+		cache:        make(map[string]*Quote),
+	}
+}
+
+// Sources 已启用的汇率源名称，按查询顺序
+func (s *Service) Sources() []string {
+	names := make([]string, 0, len(s.sources))
+	for _, source := range s.sources {
+		names = append(names, source.Name())
+	}
+	return names
+}
+
+// Get 查询 base/quote 汇率，缓存未过期时直接返回缓存
+func (s *Service) Get(ctx context.Context, base, quote string) (*Quote, error) {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+	if base == quote {
+		return &Quote{Base: base, Quote: quote, Rate: 1, Source: "identity", FetchedAt: time.Now()}, nil
+	}
+
+	key := base + "/" + quote
+	s.mu.Lock()
+	cached := s.cache[key]
+	s.mu.Unlock()
+	if cached != nil && time.Since(cached.FetchedAt) < s.ttl {
+		copied := *cached
+		return &copied, nil
+	}
+
+	fetched, err := s.fetch(ctx, base, quote)
+	if err == nil {
+		s.mu.Lock()
+		s.cache[key] = fetched
+		s.mu.Unlock()
+		copied := *fetched
+		return &copied, nil
+	}
+
+	if cached != nil && time.Since(cached.FetchedAt) < s.maxStaleness {
+		log.Printf("【汇率】%s 所有汇率源查询失败，使用 %s 前获取的缓存: %v",
+			key, time.Since(cached.FetchedAt).Round(time.Second), err)
+		copied := *cached
+		copied.Stale = true
+		return &copied, nil
+	}
+	return nil, err
+}
+
+// fetch 按顺序查询汇率源，返回第一个成功的结果
+func (s *Service) fetch(ctx context.Context, base, quote string) (*Quote, error) {
+	var failures []string
+	for _, source := range s.sources {
+		rate, err := source.Rate(ctx, base, quote)
+		if errors.Is(err, ErrUnsupportedPair) {
+			continue
+		}
+		if err == nil && rate <= 0 {
+			err = fmt.Errorf("汇率无效: %v", rate)
+		}
+		if err != nil {
+			log.Printf("【汇率】%s 查询 %s/%s 失败，尝试下一个汇率源: %v", source.Name(), base, quote, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", source.Name(), err))
+			continue
+		}
+		return &Quote{Base: base, Quote: quote, Rate: rate, Source: source.Name(), FetchedAt: time.Now()}, nil
+	}
+	if len(failures) == 0 {
+		return nil, fmt.Errorf("没有汇率源支持 %s/%s", base, quote)
+	}
+	return nil, fmt.Errorf("查询 %s/%s 汇率失败: %s", base, quote, strings.Join(failures, "; "))
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if raw := os.Getenv(key); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
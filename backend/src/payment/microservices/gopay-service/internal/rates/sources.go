@@ -0,0 +1,184 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func newSource(name string) Source {
+	client := &http.Client{Timeout: envDuration("RATES_HTTP_TIMEOUT", 5*time.Second)}
+	switch name {
+	case "coingecko":
+		return &coinGeckoSource{
+			baseURL: envString("COINGECKO_API_URL", "https://api.coingecko.com/api/v3"),
+			apiKey:  os.Getenv("COINGECKO_API_KEY"),
+			client:  client,
+		}
+	case "erapi":
+		return &erAPISource{
+			baseURL: envString("ERAPI_URL", "https://open.er-api.com/v6"),
+			client:  client,
+		}
+	case "static":
+		return NewStaticSource(os.Getenv("RATES_STATIC"))
+	}
+	return nil
+}
+
+// getJSON 请求汇率源接口并解析 JSON 响应
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("返回 %d: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// coinGeckoIDs 加密货币代码对应的 CoinGecko 币种 ID
+var coinGeckoIDs = map[string]string{
+	"BTC":  "bitcoin",
+	"ETH":  "ethereum",
+	"USDT": "tether",
+	"USDC": "usd-coin",
+	"TRX":  "tron",
+	"BNB":  "binancecoin",
+	"XRP":  "ripple",
+	"XLM":  "stellar",
+	"TON":  "the-open-network",
+}
+
+// coinGeckoSource 加密货币对法币的汇率，配置 COINGECKO_API_KEY 时使用 Pro 接口的鉴权头
+type coinGeckoSource struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func (s *coinGeckoSource) Name() string { return "coingecko" }
+
+func (s *coinGeckoSource) Rate(ctx context.Context, base, quote string) (float64, error) {
+	id, ok := coinGeckoIDs[base]
+	if !ok {
+		// 法币对加密货币时取反向汇率
+		if id, ok = coinGeckoIDs[quote]; !ok {
+			return 0, ErrUnsupportedPair
+		}
+		rate, err := s.price(ctx, id, base)
+		if err != nil || rate == 0 {
+			return 0, err
+		}
+		return 1 / rate, nil
+	}
+	return s.price(ctx, id, quote)
+}
+
+func (s *coinGeckoSource) price(ctx context.Context, id, vsCurrency string) (float64, error) {
+	vs := strings.ToLower(vsCurrency)
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s", s.baseURL, id, vs)
+	headers := map[string]string{"Accept": "application/json"}
+	if s.apiKey != "" {
+		headers["x-cg-pro-api-key"] = s.apiKey
+	}
+	var result map[string]map[string]float64
+	if err := getJSON(ctx, s.client, url, headers, &result); err != nil {
+		return 0, err
+	}
+	rate, ok := result[id][vs]
+	if !ok {
+		return 0, ErrUnsupportedPair
+	}
+	return rate, nil
+}
+
+// erAPISource 法币之间的汇率，数据每日更新，只作参考汇率使用
+type erAPISource struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (s *erAPISource) Name() string { return "erapi" }
+
+func (s *erAPISource) Rate(ctx context.Context, base, quote string) (float64, error) {
+	if _, crypto := coinGeckoIDs[base]; crypto {
+		return 0, ErrUnsupportedPair
+	}
+	if _, crypto := coinGeckoIDs[quote]; crypto {
+		return 0, ErrUnsupportedPair
+	}
+	var result struct {
+		Result string             `json:"result"`
+		Error  string             `json:"error-type"`
+		Rates  map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(ctx, s.client, s.baseURL+"/latest/"+base, nil, &result); err != nil {
+		return 0, err
+	}
+	if result.Result != "success" {
+		if result.Error == "unsupported-code" {
+			return 0, ErrUnsupportedPair
+		}
+		return 0, fmt.Errorf("返回错误: %s", result.Error)
+	}
+	rate, ok := result.Rates[quote]
+	if !ok {
+		return 0, ErrUnsupportedPair
+	}
+	return rate, nil
+}
+
+// StaticSource 固定汇率，用于本地开发、测试和外部汇率源全部不可用时的兜底。
+// 配置格式为 BASE/QUOTE=RATE，逗号分隔，如 USD/CNY=7.1,USDT/USD=1，反向汇率自动推出
+type StaticSource struct {
+	rates map[string]float64
+}
+
+func NewStaticSource(raw string) *StaticSource {
+	s := &StaticSource{rates: make(map[string]float64)}
+	for _, item := range splitList(raw) {
+		pair, value, ok := strings.Cut(item, "=")
+		base, quote, okPair := strings.Cut(strings.ToUpper(strings.TrimSpace(pair)), "/")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || !okPair || err != nil || rate <= 0 {
+			log.Printf("【警告】RATES_STATIC 中的 %s 格式错误，应为 BASE/QUOTE=RATE，已忽略", item)
+			continue
+		}
+		s.rates[base+"/"+quote] = rate
+	}
+	return s
+}
+
+func (s *StaticSource) Name() string { return "static" }
+
+func (s *StaticSource) Rate(_ context.Context, base, quote string) (float64, error) {
+	if rate, ok := s.rates[base+"/"+quote]; ok {
+		return rate, nil
+	}
+	if rate, ok := s.rates[quote+"/"+base]; ok {
+		return 1 / rate, nil
+	}
+	return 0, ErrUnsupportedPair
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// ErrJobQueueFull 队列已满，调用方应返回 RETRY_LATER 或记录失败
+var ErrJobQueueFull = errors.New("任务队列已满")
+
+// ErrJobQueueClosed 服务正在关闭，队列不再接受新任务
+var ErrJobQueueClosed = errors.New("任务队列已关闭")
+
+// maxDeadJobs 每个队列保留的死信任务数
+const maxDeadJobs = 1000
+
+// Job 后台任务。处理函数返回错误时按指数退避重试，达到最大次数或返回 PermanentJobError 后进入死信
+type Job struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Subject   string    `json:"subject,omitempty"` // 关联的业务单号，便于排查
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	RunAt     time.Time `json:"runAt"`
+
+	handle func(ctx context.Context) error
+}
+
+func NewJob(kind, subject string, handle func(ctx context.Context) error) *Job {
+	return &Job{
+		ID:        fmt.Sprintf("JB%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		Kind:      kind,
+		Subject:   subject,
+		CreatedAt: time.Now(),
+		handle:    handle,
+	}
+}
+
+type permanentJobError struct{ err error }
+
+func (e *permanentJobError) Error() string { return e.err.Error() }
+func (e *permanentJobError) Unwrap() error { return e.err }
+
+// PermanentJobError 标记不可重试的错误，任务直接进入死信
+func PermanentJobError(err error) error {
+	return &permanentJobError{err: err}
+}
+
+// JobQueueConfig 队列参数，可由 JOBS_<队列名>_WORKERS、_CAPACITY、_MAX_ATTEMPTS、_BACKOFF、_MAX_BACKOFF 覆盖
+type JobQueueConfig struct {
+	Workers     int
+	Capacity    int
+	MaxAttempts int
+	Backoff     time.Duration // 首次重试的等待时间，之后逐次翻倍
+	MaxBackoff  time.Duration
+}
+
+func (cfg JobQueueConfig) fromEnv(name string) JobQueueConfig {
+	prefix := "JOBS_" + strings.ToUpper(name) + "_"
+	cfg.Workers = envInt(prefix+"WORKERS", cfg.Workers)
+	cfg.Capacity = envInt(prefix+"CAPACITY", cfg.Capacity)
+	cfg.MaxAttempts = envInt(prefix+"MAX_ATTEMPTS", cfg.MaxAttempts)
+	cfg.Backoff = envDuration(prefix+"BACKOFF", cfg.Backoff)
+	cfg.MaxBackoff = envDuration(prefix+"MAX_BACKOFF", cfg.MaxBackoff)
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return cfg
+}
+
+// JobQueueStats 队列运行指标，计数自进程启动累计
+type JobQueueStats struct {
+	Name      string `json:"name"`
+	Workers   int    `json:"workers"`
+	Capacity  int    `json:"capacity"`
+	Queued    int    `json:"queued"`  // 等待 worker 的任务
+	Delayed   int    `json:"delayed"` // 等待到期或退避中的任务
+	Running   int    `json:"running"`
+	Submitted int64  `json:"submitted"`
+	Succeeded int64  `json:"succeeded"`
+	Retried   int64  `json:"retried"`
+	Dead      int64  `json:"dead"`
+}
+
+// Backlog 尚未完成的任务数
+func (s JobQueueStats) Backlog() int {
+	return s.Queued + s.Delayed + s.Running
+}
+
+// JobQueue 进程内任务队列：固定数量的 worker、延迟任务、失败重试和死信。
+// 任务不持久化，进程退出时未完成的任务丢失，处理函数须保证重复执行安全
+type JobQueue struct {
+	name  string
+	cfg   JobQueueConfig
+	ready chan *Job
+
+	mu        sync.Mutex
+	closed    bool
+	delayed   int
+	running   int
+	submitted int64
+	succeeded int64
+	retried   int64
+	deadCount int64
+	dead      []*Job
+}
+
+func newJobQueue(name string, cfg JobQueueConfig) *JobQueue {
+	cfg = cfg.fromEnv(name)
+	return &JobQueue{name: name, cfg: cfg, ready: make(chan *Job, cfg.Capacity)}
+}
+
+// Submit 提交立即执行的任务
+func (q *JobQueue) Submit(job *Job) error {
+	return q.SubmitAfter(job, 0)
+}
+
+// SubmitAfter 提交延迟 delay 后执行的任务
+func (q *JobQueue) SubmitAfter(job *Job, delay time.Duration) error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return ErrJobQueueClosed
+	}
+
+	job.RunAt = time.Now().Add(delay)
+	if delay <= 0 {
+		if err := q.push(job); err != nil {
+			return err
+		}
+	} else {
+		q.mu.Lock()
+		q.delayed++
+		q.mu.Unlock()
+		time.AfterFunc(delay, func() { q.promote(job) })
+	}
+
+	q.mu.Lock()
+	q.submitted++
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *JobQueue) push(job *Job) error {
+	select {
+	case q.ready <- job:
+		return nil
+	default:
+		return ErrJobQueueFull
+	}
+}
+
+// promote 延迟任务到期后转入就绪队列，队列满时稍后再试，已接受的任务不因积压丢弃
+func (q *JobQueue) promote(job *Job) {
+	q.mu.Lock()
+	closed := q.closed
+	if closed {
+		q.delayed--
+	}
+	q.mu.Unlock()
+	if closed {
+		log.Printf("【警告】服务关闭，放弃未到期的任务 %s/%s(%s)", q.name, job.Kind, job.Subject)
+		return
+	}
+
+	if err := q.push(job); err != nil {
+		time.AfterFunc(time.Second, func() { q.promote(job) })
+		return
+	}
+	q.mu.Lock()
+	q.delayed--
+	q.mu.Unlock()
+}
+
+// Run 启动 worker，阻塞直到 ctx 取消。正在执行的任务使用同一个 ctx
+func (q *JobQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.ready:
+					q.execute(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *JobQueue) execute(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	q.running++
+	q.mu.Unlock()
+
+	job.Attempts++
+	err := q.invoke(ctx, job)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	if err == nil {
+		q.succeeded++
+		return
+	}
+
+	job.LastError = err.Error()
+	var permanent *permanentJobError
+	if errors.As(err, &permanent) || job.Attempts >= q.cfg.MaxAttempts {
+		log.Printf("【警告】任务 %s/%s(%s) 第 %d 次执行失败，转入死信: %v", q.name, job.Kind, job.Subject, job.Attempts, err)
+		reportError(err, map[string]string{"component": "jobs", "queue": q.name, "kind": job.Kind, "subject": job.Subject})
+		q.deadCount++
+		q.dead = append(q.dead, job)
+		if len(q.dead) > maxDeadJobs {
+			q.dead = append([]*Job(nil), q.dead[len(q.dead)-maxDeadJobs:]...)
+		}
+		return
+	}
+
+	backoff := q.cfg.Backoff << (job.Attempts - 1)
+	if backoff > q.cfg.MaxBackoff || backoff <= 0 {
+		backoff = q.cfg.MaxBackoff
+	}
+	log.Printf("任务 %s/%s(%s) 第 %d 次执行失败，%s 后重试: %v", q.name, job.Kind, job.Subject, job.Attempts, backoff, err)
+	q.retried++
+	q.delayed++
+	job.RunAt = time.Now().Add(backoff)
+	time.AfterFunc(backoff, func() { q.promote(job) })
+}
+
+// invoke 执行处理函数，panic 视为一次失败
+func (q *JobQueue) invoke(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.handle(ctx)
+}
+
+// Stats 返回队列当前指标
+func (q *JobQueue) Stats() JobQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return JobQueueStats{
+		Name:      q.name,
+		Workers:   q.cfg.Workers,
+		Capacity:  q.cfg.Capacity,
+		Queued:    len(q.ready),
+		Delayed:   q.delayed,
+		Running:   q.running,
+		Submitted: q.submitted,
+		Succeeded: q.succeeded,
+		Retried:   q.retried,
+		Dead:      q.deadCount,
+	}
+}
+
+// DeadJobs 返回死信任务，最新的在前
+func (q *JobQueue) DeadJobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.dead))
+	for i := len(q.dead) - 1; i >= 0; i-- {
+		jobs = append(jobs, *q.dead[i])
+	}
+	return jobs
+}
+
+// RetryDead 把死信任务重新提交，尝试次数清零
+func (q *JobQueue) RetryDead(jobID string) (*Job, error) {
+	q.mu.Lock()
+	var job *Job
+	for i, dead := range q.dead {
+		if dead.ID == jobID {
+			job = dead
+			q.dead = append(q.dead[:i], q.dead[i+1:]...)
+			break
+		}
+	}
+	q.mu.Unlock()
+	if job == nil {
+		return nil, fmt.Errorf("死信任务不存在: %s", jobID)
+	}
+
+	job.Attempts = 0
+	job.LastError = ""
+	copied := *job
+	if err := q.Submit(job); err != nil {
+		q.mu.Lock()
+		q.dead = append(q.dead, job)
+		q.mu.Unlock()
+		return nil, err
+	}
+	copied.RunAt = time.Now()
+	return &copied, nil
+}
+
+// JobRegistry 管理全部任务队列，各功能通过 Queue 取得自己的队列，worker 统一随后台上下文启停
+type JobRegistry struct {
+	mu     sync.Mutex
+	queues map[string]*JobQueue
+	ctx    context.Context // Run 之后创建的队列立即启动
+}
+
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{queues: make(map[string]*JobQueue)}
+}
+
+// Queue 返回指定名称的队列，不存在时按默认参数创建
+func (r *JobRegistry) Queue(name string, defaults JobQueueConfig) *JobQueue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if q, ok := r.queues[name]; ok {
+		return q
+	}
+	q := newJobQueue(name, defaults)
+	r.queues[name] = q
+	if r.ctx != nil {
+		go q.Run(r.ctx)
+	}
+	return q
+}
+
+// Run 启动全部队列的 worker，直到 ctx 取消
+func (r *JobRegistry) Run(ctx context.Context) {
+	r.mu.Lock()
+	r.ctx = ctx
+	for _, q := range r.queues {
+		go q.Run(ctx)
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+}
+
+// Drain 关闭全部队列的提交，等待已就绪和正在执行的任务完成，ctx 到期时返回剩余任务数。
+// 退避中和未到期的延迟任务不再执行，到期时记录日志
+func (r *JobRegistry) Drain(ctx context.Context) error {
+	r.mu.Lock()
+	queues := make([]*JobQueue, 0, len(r.queues))
+	for _, q := range r.queues {
+		queues = append(queues, q)
+	}
+	r.mu.Unlock()
+
+	for _, q := range queues {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pending := 0
+		for _, q := range queues {
+			stats := q.Stats()
+			pending += stats.Queued + stats.Running
+		}
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("仍有 %d 个任务未完成: %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stats 返回全部队列的指标，按名称排序
+func (r *JobRegistry) Stats() []JobQueueStats {
+	r.mu.Lock()
+	queues := make([]*JobQueue, 0, len(r.queues))
+	for _, q := range r.queues {
+		queues = append(queues, q)
+	}
+	r.mu.Unlock()
+
+	stats := make([]JobQueueStats, 0, len(queues))
+	for _, q := range queues {
+		stats = append(stats, q.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+func (r *JobRegistry) get(name string) (*JobQueue, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q, ok := r.queues[name]
+	return q, ok
+}
+
+// LoopRunner 托管常驻循环（链上监听、账本核验等）。循环 panic 或在关闭前退出时按指数退避重启，
+// 退避参数可由 JOBS_LOOPS_BACKOFF、JOBS_LOOPS_MAX_BACKOFF 覆盖；Stop 取消上下文并等待全部循环退出
+type LoopRunner struct {
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewLoopRunner() *LoopRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LoopRunner{
+		backoff:    envDuration("JOBS_LOOPS_BACKOFF", 5*time.Second),
+		maxBackoff: envDuration("JOBS_LOOPS_MAX_BACKOFF", 5*time.Minute),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Loop 启动名为 name 的常驻循环，run 须在 ctx 取消后返回
+func (lr *LoopRunner) Loop(name string, run func(ctx context.Context)) {
+	lr.wg.Add(1)
+	go func() {
+		defer lr.wg.Done()
+		backoff := lr.backoff
+		for {
+			started := time.Now()
+			err := lr.invoke(run)
+			if lr.ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				err = errors.New("循环提前退出")
+			}
+			// 持续运行超过最大退避时间后再退出的，退避从头计算
+			if time.Since(started) > lr.maxBackoff {
+				backoff = lr.backoff
+			}
+			log.Printf("【警告】后台循环 %s 异常退出，%s 后重启: %v", name, backoff, err)
+			reportError(err, map[string]string{"component": "jobs", "loop": name})
+			select {
+			case <-lr.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > lr.maxBackoff {
+				backoff = lr.maxBackoff
+			}
+		}
+	}()
+}
+
+// invoke 执行一轮循环，panic 视为异常退出。每轮使用单独的子上下文，退出后循环内启动的 goroutine（如节点健康检查）随之停止，重启不会重复
+func (lr *LoopRunner) invoke(run func(ctx context.Context)) (err error) {
+	ctx, cancel := context.WithCancel(lr.ctx)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	run(ctx)
+	return nil
+}
+
+// Stop 取消全部循环并等待退出，ctx 到期时不再等待
+func (lr *LoopRunner) Stop(ctx context.Context) error {
+	lr.cancel()
+	done := make(chan struct{})
+	go func() {
+		lr.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// registerJobRoutes 注册任务队列的运维接口：查看指标、死信及重新投递
+func registerJobRoutes(api *gin.RouterGroup, jobs *JobRegistry) {
+	admin := api.Group("/admin")
+
+	admin.GET("/jobs", func(c *gin.Context) {
+		apierr.RespondOK(c, jobs.Stats())
+	})
+
+	admin.GET("/jobs/:queue/dead", func(c *gin.Context) {
+		q, ok := jobs.get(c.Param("queue"))
+		if !ok {
+			apierr.RespondError(c, http.StatusNotFound, "QUEUE_NOT_FOUND", "任务队列不存在")
+			return
+		}
+		apierr.RespondOK(c, q.DeadJobs())
+	})
+
+	admin.POST("/jobs/:queue/dead/:jobId/retry", func(c *gin.Context) {
+		q, ok := jobs.get(c.Param("queue"))
+		if !ok {
+			apierr.RespondError(c, http.StatusNotFound, "QUEUE_NOT_FOUND", "任务队列不存在")
+			return
+		}
+		job, err := q.RetryDead(c.Param("jobId"))
+		if err != nil {
+			if errors.Is(err, ErrJobQueueFull) || errors.Is(err, ErrJobQueueClosed) {
+				apierr.RespondError(c, http.StatusServiceUnavailable, "RETRY_LATER", err.Error())
+				return
+			}
+			apierr.RespondError(c, http.StatusNotFound, "JOB_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, job)
+	})
+}
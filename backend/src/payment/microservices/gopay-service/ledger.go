@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 记账方向
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+// 科目类别，决定试算平衡表中余额的正常方向
+const (
+	AccountAsset     = "asset"     // 渠道清算、待收款项
+	AccountLiability = "liability" // 用户余额、礼品卡、冻结资金
+	AccountRevenue   = "revenue"   // 销售收入
+	AccountExpense   = "expense"   // 退款、手续费
+)
+
+// accountTypes 按科目前缀归类，未列出的科目视为资产类
+var accountTypes = []struct {
+	prefix string
+	kind   string
+}{
+	{"clearing:", AccountAsset},
+	{"wallet:", AccountLiability},
+	{"giftcard:", AccountLiability},
+	{"split:hold", AccountLiability},
+	{"payouts:pending", AccountLiability},
+	{"merchant:sales", AccountRevenue},
+	{"merchant:refunds", AccountExpense},
+	{"fees:", AccountExpense},
+}
+
+func accountType(account string) string {
+	for _, t := range accountTypes {
+		if strings.HasPrefix(account, t.prefix) {
+			return t.kind
+		}
+	}
+	return AccountAsset
+}
+
+// LedgerEntry 一条借贷分录
+type LedgerEntry struct {
+	EntryID     int64     `json:"entryId"`
+	TxnID       string    `json:"txnId"`
+	Account     string    `json:"account"`
+	Direction   string    `json:"direction"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Ledger 记账，一次 Post 的分录按币种借贷必须平衡，已入账分录的金额和借贷方向不可修改
+type Ledger interface {
+	Post(entries ...LedgerEntry) error
+	Entries(txnID string) ([]LedgerEntry, error)
+	AccountEntries(account string) ([]LedgerEntry, error)
+	All() ([]LedgerEntry, error)
+	// RenameAccount 替换分录的账户名称，仅用于删除个人信息时把用户的余额账户改为假名
+	RenameAccount(from, to string) error
+}
+
+type memoryLedger struct {
+	mu      sync.RWMutex
+	seq     int64
+	entries []LedgerEntry
+}
+
+func NewMemoryLedger() Ledger {
+	return &memoryLedger{}
+}
+
+func (l *memoryLedger) Post(entries ...LedgerEntry) error {
+	if err := validateEntries(entries); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range entries {
+		l.seq++
+		e.EntryID = l.seq
+		e.CreatedAt = now
+		l.entries = append(l.entries, e)
+	}
+	return nil
+}
+
+func (l *memoryLedger) Entries(txnID string) ([]LedgerEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var matched []LedgerEntry
+	for _, e := range l.entries {
+		if e.TxnID == txnID {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+func (l *memoryLedger) AccountEntries(account string) ([]LedgerEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var matched []LedgerEntry
+	for _, e := range l.entries {
+		if e.Account == account {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+func (l *memoryLedger) RenameAccount(from, to string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range l.entries {
+		if l.entries[i].Account == from {
+			l.entries[i].Account = to
+		}
+	}
+	return nil
+}
+
+func (l *memoryLedger) All() ([]LedgerEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := make([]LedgerEntry, len(l.entries))
+	copy(entries, l.entries)
+	return entries, nil
+}
+
+// validateEntries 入账前的不变量检查：至少一借一贷、金额为正、按币种借贷相等
+func validateEntries(entries []LedgerEntry) error {
+	if len(entries) < 2 {
+		return fmt.Errorf("一笔凭证至少需要两条分录")
+	}
+
+	balance := make(map[string]int64)
+	for _, e := range entries {
+		if e.TxnID == "" || e.Account == "" {
+			return fmt.Errorf("分录缺少交易号或科目")
+		}
+		amount := toMinorUnitsIn(e.Amount, e.Currency)
+		if amount <= 0 {
+			return fmt.Errorf("分录金额必须大于0: %s %.2f", e.Account, e.Amount)
+		}
+		switch e.Direction {
+		case Debit:
+			balance[e.Currency] += amount
+		case Credit:
+			balance[e.Currency] -= amount
+		default:
+			return fmt.Errorf("无效的记账方向: %s", e.Direction)
+		}
+	}
+	for currency, diff := range balance {
+		if diff != 0 {
+			return fmt.Errorf("分录借贷不平衡: 币种 %q 差额 %d", currency, diff)
+		}
+	}
+	return nil
+}
+
+// TrialBalanceLine 试算平衡表中的一个科目
+type TrialBalanceLine struct {
+	Account  string  `json:"account"`
+	Type     string  `json:"type"`
+	Currency string  `json:"currency"`
+	Debit    float64 `json:"debit"`
+	Credit   float64 `json:"credit"`
+	Balance  float64 `json:"balance"` // 按科目正常方向计算的余额
+}
+
+// TrialBalance 试算平衡表，Violations 列出未通过不变量检查的凭证
+type TrialBalance struct {
+	AsOf        time.Time          `json:"asOf"`
+	Lines       []TrialBalanceLine `json:"lines"`
+	TotalDebit  float64            `json:"totalDebit"` // 包含多个币种时为各币种金额直接相加，仅供核对
+	TotalCredit float64            `json:"totalCredit"`
+	Balanced    bool               `json:"balanced"` // 每个币种借贷相等
+	Violations  []string           `json:"violations,omitempty"`
+}
+
+// BuildTrialBalance 汇总截至 asOf 的全部分录，currency 为空时包含所有币种
+func BuildTrialBalance(ledger Ledger, currency string, asOf time.Time) (*TrialBalance, error) {
+	entries, err := ledger.All()
+	if err != nil {
+		return nil, err
+	}
+
+	type lineKey struct{ account, currency string }
+	type sums struct{ debit, credit int64 }
+	lines := make(map[lineKey]*sums)
+	txns := make(map[string][]LedgerEntry)
+	totals := make(map[string]*sums) // 币种 -> 借贷合计，各币种的最小货币单位不同，分币种累加
+
+	for _, e := range entries {
+		if e.CreatedAt.After(asOf) || (currency != "" && e.Currency != currency) {
+			continue
+		}
+		txns[e.TxnID] = append(txns[e.TxnID], e)
+
+		key := lineKey{e.Account, e.Currency}
+		s, ok := lines[key]
+		if !ok {
+			s = &sums{}
+			lines[key] = s
+		}
+		total, ok := totals[e.Currency]
+		if !ok {
+			total = &sums{}
+			totals[e.Currency] = total
+		}
+		amount := toMinorUnitsIn(e.Amount, e.Currency)
+		if e.Direction == Debit {
+			s.debit += amount
+			total.debit += amount
+		} else {
+			s.credit += amount
+			total.credit += amount
+		}
+	}
+
+	tb := &TrialBalance{
+		AsOf:     asOf,
+		Lines:    make([]TrialBalanceLine, 0, len(lines)),
+		Balanced: true,
+	}
+	currencies := make([]string, 0, len(totals))
+	for cur := range totals {
+		currencies = append(currencies, cur)
+	}
+	sort.Strings(currencies)
+	for _, cur := range currencies {
+		total := totals[cur]
+		tb.TotalDebit += fromMinorUnitsIn(total.debit, cur)
+		tb.TotalCredit += fromMinorUnitsIn(total.credit, cur)
+		if total.debit != total.credit {
+			tb.Balanced = false
+		}
+	}
+	for key, s := range lines {
+		kind := accountType(key.account)
+		balance := s.debit - s.credit
+		if kind == AccountLiability || kind == AccountRevenue {
+			balance = -balance
+		}
+		tb.Lines = append(tb.Lines, TrialBalanceLine{
+			Account:  key.account,
+			Type:     kind,
+			Currency: key.currency,
+			Debit:    fromMinorUnitsIn(s.debit, key.currency),
+			Credit:   fromMinorUnitsIn(s.credit, key.currency),
+			Balance:  fromMinorUnitsIn(balance, key.currency),
+		})
+	}
+	sort.Slice(tb.Lines, func(i, j int) bool {
+		if tb.Lines[i].Currency != tb.Lines[j].Currency {
+			return tb.Lines[i].Currency < tb.Lines[j].Currency
+		}
+		return tb.Lines[i].Account < tb.Lines[j].Account
+	})
+
+	// 同一交易号可能分多次入账，逐笔复核凭证整体仍然平衡
+	for txnID, txnEntries := range txns {
+		if err := validateEntries(txnEntries); err != nil {
+			tb.Violations = append(tb.Violations, fmt.Sprintf("%s: %v", txnID, err))
+		}
+	}
+	sort.Strings(tb.Violations)
+	if len(tb.Violations) > 0 {
+		tb.Balanced = false
+	}
+	return tb, nil
+}
+
+// postSale 渠道收款确认：按手续费规则计费，借记渠道清算户（净额）与手续费支出，贷记销售收入（总额）
+func (ps *PaymentService) postSale(record *PaymentRecord, amount float64) error {
+	fee := ps.fees.Calculate(record.Method, record.Channel, record.Currency, amount)
+	description := fmt.Sprintf("%s 收款 %s", record.Method, record.PaymentID)
+	entries := []LedgerEntry{
+		{TxnID: record.PaymentID, Account: "merchant:sales", Direction: Credit, Amount: amount, Currency: record.Currency, Description: description},
+	}
+	if net := roundAmountIn(amount-fee, record.Currency); net > 0 {
+		entries = append(entries, LedgerEntry{TxnID: record.PaymentID, Account: "clearing:" + record.Method, Direction: Debit, Amount: net, Currency: record.Currency, Description: description})
+	}
+	if fee > 0 {
+		entries = append(entries, LedgerEntry{TxnID: record.PaymentID, Account: "fees:" + record.Method, Direction: Debit, Amount: fee, Currency: record.Currency, Description: description})
+	}
+	if err := ps.ledger.Post(entries...); err != nil {
+		return err
+	}
+
+	if fee == 0 {
+		return nil
+	}
+	record.Fee = fee
+	return ps.store.Save(record)
+}
+
+// registerLedgerRoutes 注册账务查询接口
+func registerLedgerRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	// asOf 为 RFC3339 时间，默认当前时间
+	admin.GET("/ledger/trial-balance", func(c *gin.Context) {
+		asOf := time.Now()
+		if raw := c.Query("asOf"); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", fmt.Sprintf("asOf 格式无效: %s", raw))
+				return
+			}
+			asOf = t
+		}
+
+		tb, err := BuildTrialBalance(ps.ledger, c.Query("currency"), asOf)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, tb)
+	})
+
+	// 按交易号或科目查询分录，二者必填其一
+	admin.GET("/ledger/entries", func(c *gin.Context) {
+		var (
+			entries []LedgerEntry
+			err     error
+		)
+		switch {
+		case c.Query("txnId") != "":
+			entries, err = ps.ledger.Entries(c.Query("txnId"))
+		case c.Query("account") != "":
+			entries, err = ps.ledger.AccountEntries(c.Query("account"))
+		default:
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "需要 txnId 或 account 参数")
+			return
+		}
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, entries)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrLockTimeout 在 LOCK_WAIT 内未能获取锁，调用方应返回错误让渠道或调度稍后重试
+var ErrLockTimeout = errors.New("获取锁超时")
+
+// Locker 按键加互斥锁，用于串行化同一支付单的状态变更。多副本部署时必须使用 Redis 实现，
+// 否则同一笔通知落到不同副本、或对账与通知并发时，状态变更和事件推送可能重复
+type Locker interface {
+	// Lock 获取 key 上的锁，返回释放函数
+	Lock(key string) (func(), error)
+}
+
+// NewLocker 配置 REDIS_URL 时使用 Redis 分布式锁，否则使用进程内锁
+func NewLocker() Locker {
+	wait := envDuration("LOCK_WAIT", 10*time.Second)
+	if client := sharedRedis(); client != nil {
+		return &redisLocker{client: client, ttl: envDuration("LOCK_TTL", 30*time.Second), wait: wait}
+	}
+	if currentEnvironment() == "production" {
+		log.Printf("【警告】生产环境未配置 REDIS_URL，支付状态锁仅在本进程内生效，多副本部署时可能重复处理回调")
+	}
+	return &memoryLocker{wait: wait, locks: make(map[string]*memoryLock)}
+}
+
+// redisLocker 基于 SET NX PX 的租约锁。持有者崩溃时锁在 LOCK_TTL 后自动释放；
+// 释放时校验令牌，避免误删租约过期后被其他副本获取的锁
+type redisLocker struct {
+	client *redis.Client
+	ttl    time.Duration
+	wait   time.Duration
+}
+
+// releaseScript 仅在锁仍属于自己时删除
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (l *redisLocker) Lock(key string) (func(), error) {
+	var buf [16]byte
+	rand.Read(buf[:])
+	token := hex.EncodeToString(buf[:])
+	redisKey := "gopay:lock:" + key
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.wait)
+	defer cancel()
+	backoff := 20 * time.Millisecond
+	for {
+		ok, err := l.client.SetNX(ctx, redisKey, token, l.ttl).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ErrLockTimeout
+			}
+			return nil, fmt.Errorf("获取锁 %s 失败: %w", key, err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ErrLockTimeout
+		case <-time.After(backoff):
+		}
+		if backoff < 500*time.Millisecond {
+			backoff *= 2
+		}
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := releaseScript.Run(ctx, l.client, []string{redisKey}, token).Err(); err != nil {
+			log.Printf("释放锁 %s 失败，将在租约到期后自动释放: %v", key, err)
+		}
+	}, nil
+}
+
+// memoryLocker 进程内按键加锁，无人持有或等待的键随即清理
+type memoryLocker struct {
+	wait  time.Duration
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}
+
+type memoryLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func (l *memoryLocker) Lock(key string) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &memoryLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case lock.ch <- struct{}{}:
+		return func() {
+			<-lock.ch
+			l.release(key, lock)
+		}, nil
+	case <-timer.C:
+		l.release(key, lock)
+		return nil, ErrLockTimeout
+	}
+}
+
+func (l *memoryLocker) release(key string, lock *memoryLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// lockPayment 获取支付单的状态变更锁
+func (ps *PaymentService) lockPayment(paymentID string) (func(), error) {
+	return ps.locks.Lock("payment:" + paymentID)
+}
+
+// withPaymentLock 持有支付单锁执行 fn，执行前从存储重新读取记录，避免基于其他副本已更新前的旧状态做判断
+func (ps *PaymentService) withPaymentLock(record *PaymentRecord, fn func() error) error {
+	unlock, err := ps.lockPayment(record.PaymentID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	latest, err := ps.store.Get(record.PaymentID)
+	if err != nil {
+		return err
+	}
+	*record = *latest
+	return fn()
+}
@@ -2,117 +2,266 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-pay/gopay"
-	"github.com/go-pay/gopay/alipay"
-	"github.com/go-pay/gopay/wechat"
 	"github.com/joho/godotenv"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/cryptogw"
+	"gopay-service/internal/httpmw"
+	"gopay-service/internal/rates"
 )
 
 type PaymentRequest struct {
-	Method       string                 `json:"method" binding:"required"`
-	OrderID      string                 `json:"orderId" binding:"required"`
-	Amount       float64                `json:"amount" binding:"required"`
-	Currency     string                 `json:"currency"`
-	Subject      string                 `json:"subject" binding:"required"`
-	Body         string                 `json:"body"`
-	ReturnURL    string                 `json:"returnUrl"`
-	NotifyURL    string                 `json:"notifyUrl"`
-	ExpireMinutes int                   `json:"expireMinutes"`
-	Metadata     map[string]interface{} `json:"metadata"`
-}
-
-type PaymentResponse struct {
-	Success   bool   `json:"success"`
-	Code      string `json:"code,omitempty"`
-	Message   string `json:"message,omitempty"`
-	Data      *PaymentData `json:"data,omitempty"`
+	Method        string                 `json:"method" binding:"required"`
+	OrderID       string                 `json:"orderId" binding:"required"`
+	UserID        string                 `json:"userId"`
+	TenantID      string                 `json:"-"`
+	ClientIP      string                 `json:"-"`
+	Risk          *RiskAssessment        `json:"-"` // 下单前的风险评分
+	Purpose       string                 `json:"-"`
+	Amount        float64                `json:"amount" binding:"required"`
+	Currency      string                 `json:"currency"`
+	Subject       string                 `json:"subject" binding:"required"`
+	Body          string                 `json:"body"`
+	ReturnURL     string                 `json:"returnUrl"`
+	NotifyURL     string                 `json:"notifyUrl"`
+	ExpireMinutes int                    `json:"expireMinutes"`
+	Metadata      map[string]interface{} `json:"metadata"`
+	Scene         string                 `json:"scene"`       // 支付宝支付场景：page（默认）或 app
+	Installment   *InstallmentOption     `json:"installment"` // 花呗分期，仅支付宝支持
+	GiftCardNo    string                 `json:"giftCardNo"`  // 礼品卡支付卡号
+	GiftCardPIN   string                 `json:"giftCardPin"` // 礼品卡支付密码
+	Invoice       *InvoiceRequest        `json:"invoice"`     // 需要开具电子发票时提交购方信息
+	// AlternateMethods 渠道维护时可接受的备选支付方式，按优先级排列
+	AlternateMethods []string `json:"alternateMethods"`
+	// Webhooks 仅针对本笔支付的额外回调地址，与租户订阅叠加
+	Webhooks       []PaymentWebhookRequest `json:"webhooks"`
+	webhookTargets []PaymentWebhook
+	// ActivateAt 预约支付的生效时间，到达前只登记不创建渠道订单
+	ActivateAt *time.Time `json:"activateAt"`
+	activating bool       // 由预约支付激活发起
 }
 
 type PaymentData struct {
-	PaymentID   string `json:"paymentId"`
-	RedirectURL string `json:"redirectUrl,omitempty"`
-	QRCode      string `json:"qrCode,omitempty"`
-	DeepLink    string `json:"deepLink,omitempty"`
-	ExpiredAt   string `json:"expiredAt,omitempty"`
+	PaymentID   string                  `json:"paymentId"`
+	RedirectURL string                  `json:"redirectUrl,omitempty"`
+	QRCode      string                  `json:"qrCode,omitempty"`
+	DeepLink    string                  `json:"deepLink,omitempty"`
+	ExpiredAt   string                  `json:"expiredAt,omitempty"`
+	Status      string                  `json:"status,omitempty"`
+	Installment *InstallmentPlan        `json:"installment,omitempty"`
+	Method      string                  `json:"method,omitempty"`     // 实际使用的支付方式，维护改道时与请求不同
+	RoutedFrom  string                  `json:"routedFrom,omitempty"` // 因维护改道前的支付方式
+	Webhooks    []CreatedPaymentWebhook `json:"webhooks,omitempty"`
+	Saga        *SagaState              `json:"saga,omitempty"`
+	ActivateAt  *time.Time              `json:"activateAt,omitempty"` // 预约支付的生效时间
 }
 
 type PaymentService struct {
-	alipayClient *alipay.Client
-	wechatClient *wechat.Client
+	credentials  *CredentialManager
+	stripeClient *StripeClient
+	crypto       *CryptoGatewayClient
+	repo         *Repository
+	store        PaymentStore
+	refunds      RefundStore
+	approvals    *RefundApprovalPolicy
+	wallets      WalletStore
+	ledger       Ledger
+	giftCards    *GiftCardService
+	passback     *PassbackConfig
+	webhooks     *WebhookService
+	fees         *FeeSchedule
+	currencies   *CurrencyRules
+	rates        *rates.Service
+	fapiao       *FapiaoClient
+	risk         *RiskEngine
+	scorer       RiskScorer
+	notifyDedup  NotifyDedupStore
+	actions      *ActionLog
+	audit        *AuditLog
+	tenants      *TenantRegistry
+	breakers     map[string]*CircuitBreaker
+	maintenance  *MaintenanceRegistry
+	preflight    *Preflight
+	locks        Locker
+	jobs         *JobRegistry
+	statusCache  StatusCache
+	mock         *MockProviders
+	chaos        *ChaosInjector
 }
 
 func NewPaymentService() *PaymentService {
-	// 初始化支付宝客户端
-	alipayClient, err := alipay.NewClient(
-		os.Getenv("ALIPAY_APP_ID"),
-		os.Getenv("ALIPAY_PRIVATE_KEY"),
-		true, // 是否是沙箱环境
-	)
-	if err != nil {
-		log.Printf("初始化支付宝客户端失败: %v", err)
-	} else {
-		// 设置支付宝公钥
-		err = alipayClient.SetAliPayPublicKey(os.Getenv("ALIPAY_PUBLIC_KEY"))
-		if err != nil {
-			log.Printf("设置支付宝公钥失败: %v", err)
-		}
+	// 初始化Stripe客户端（仅用于预授权）
+	var stripeClient *StripeClient
+	if secretKey := os.Getenv("STRIPE_SECRET_KEY"); secretKey != "" {
+		stripeClient = NewStripeClient(secretKey)
 	}
 
-	// 初始化微信客户端
-	wechatClient := wechat.NewClient(
-		os.Getenv("WECHAT_APP_ID"),
-		os.Getenv("WECHAT_MCH_ID"),
-		os.Getenv("WECHAT_API_KEY"),
-		true, // 是否是沙箱环境
-	)
+	// 渠道熔断器
+	threshold := envInt("BREAKER_FAILURE_THRESHOLD", 5)
+	cooldown := envDuration("BREAKER_COOLDOWN", 30*time.Second)
+	breakers := map[string]*CircuitBreaker{
+		"alipay": NewCircuitBreaker("alipay", threshold, cooldown),
+		"wechat": NewCircuitBreaker("wechat", threshold, cooldown),
+		"stripe": NewCircuitBreaker("stripe", threshold, cooldown),
+	}
+	statusCache := NewStatusCache()
+	jobs := NewJobRegistry()
+	mock := NewMockProviders()
+	cryptoClient := NewCryptoGatewayClient()
+	chaos := NewChaosInjector()
+	cryptoClient.mock = mock
+	cryptoClient.chaos = chaos
+	repo := NewRepository()
+	store := NewStatusCachingStore(NewEncryptedPaymentStore(repo.Payments, NewFieldCipher()), statusCache)
 
 	return &PaymentService{
-		alipayClient: alipayClient,
-		wechatClient: wechatClient,
+		credentials:  NewCredentialManager(),
+		stripeClient: stripeClient,
+		crypto:       cryptoClient,
+		repo:         repo,
+		store:        store,
+		refunds:      repo.Refunds,
+		approvals:    NewRefundApprovalPolicy(),
+		wallets:      repo.Wallets,
+		ledger:       repo.Ledger,
+		giftCards:    NewGiftCardService(repo.GiftCards),
+		passback:     NewPassbackConfig(),
+		webhooks:     NewWebhookService(jobs),
+		fees:         NewFeeSchedule(),
+		currencies:   NewCurrencyRules(),
+		rates:        rates.NewService(),
+		fapiao:       NewFapiaoClient(),
+		risk:         NewRiskEngine(),
+		scorer:       NewRiskScorer(),
+		notifyDedup:  NewMemoryNotifyDedupStore(),
+		actions:      NewActionLog(),
+		audit:        NewAuditLog(),
+		tenants:      NewTenantRegistry(),
+		breakers:     breakers,
+		maintenance:  NewMaintenanceRegistry(),
+		locks:        NewLocker(),
+		jobs:         jobs,
+		statusCache:  statusCache,
+		mock:         mock,
+		chaos:        chaos,
+		preflight:    NewPreflight(breakers, store),
+	}
+}
+
+func (ps *PaymentService) CreatePayment(req *PaymentRequest) (*apierr.Response, error) {
+	if resp := ps.currencies.Check(req.Method, &req.Currency, req.Amount); resp != nil {
+		return resp, nil
+	}
+	if req.ActivateAt != nil && req.ActivateAt.After(time.Now()) {
+		return ps.schedulePayment(req)
+	}
+	if ps.orderScheduled(req) {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已登记预约支付: %s", req.OrderID)), nil
+	}
+	routedFrom, notice := ps.routeAroundMaintenance(req)
+	if notice != nil {
+		return maintenanceResponse(notice), nil
+	}
+	if hint := ps.preflight.Check(req.Method); hint != nil {
+		return retryLaterResponse(hint), nil
 	}
+	defer ps.preflight.begin()()
+
+	if reason := ps.risk.Check(req); reason != "" {
+		return apierr.ErrorResponse("RISK_REJECTED", reason), nil
+	}
+	if req.Risk = ps.scoreBeforeCreate(req); req.Risk != nil && req.Risk.Decision == RiskReject {
+		log.Printf("【风控】拒绝支付 %s，分数 %.0f: %v", req.OrderID, req.Risk.Score, req.Risk.Reasons)
+		return apierr.ErrorResponse("RISK_REJECTED", "支付存在风险，已被拒绝"), nil
+	}
+	if req.Invoice != nil {
+		if err := req.Invoice.validate(); err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+		}
+	}
+	if resp := ps.preparePaymentWebhooks(req); resp != nil {
+		return resp, nil
+	}
+
+	resp, err := ps.createByMethod(req)
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := resp.Data.(*PaymentData); ok && resp.Success {
+		if routedFrom != "" {
+			data.Method = req.Method
+			data.RoutedFrom = routedFrom
+		}
+		if len(req.webhookTargets) > 0 {
+			data.Webhooks = createdPaymentWebhooks(req.webhookTargets)
+		}
+	}
+	return resp, nil
 }
 
-func (ps *PaymentService) CreatePayment(req *PaymentRequest) (*PaymentResponse, error) {
+func (ps *PaymentService) createByMethod(req *PaymentRequest) (*apierr.Response, error) {
+	if cb, ok := ps.breakers[req.Method]; ok {
+		if err := ps.chaos.BeforeProviderCall(req.Method, "create"); err != nil {
+			cb.Record(err)
+			return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建支付失败: %v", err)), nil
+		}
+	}
+	if ps.mock.Handles(req.Method) {
+		return ps.createMockPayment(req)
+	}
 	switch req.Method {
 	case "alipay":
 		return ps.createAlipayPayment(req)
 	case "wechat":
 		return ps.createWechatPayment(req)
+	case "balance":
+		return ps.payWithBalance(req)
+	case "giftcard":
+		return ps.payWithGiftCard(req)
 	default:
-		return &PaymentResponse{
-			Success: false,
-			Code:    "UNSUPPORTED_METHOD",
-			Message: fmt.Sprintf("不支持的支付方式: %s", req.Method),
-		}, nil
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持的支付方式: %s", req.Method)), nil
 	}
 }
 
-func (ps *PaymentService) createAlipayPayment(req *PaymentRequest) (*PaymentResponse, error) {
-	if ps.alipayClient == nil {
-		return &PaymentResponse{
-			Success: false,
-			Code:    "CLIENT_ERROR",
-			Message: "支付宝客户端未初始化",
-		}, nil
+func (ps *PaymentService) createAlipayPayment(req *PaymentRequest) (*apierr.Response, error) {
+	if ps.aliClient() == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "支付宝客户端未初始化"), nil
+	}
+
+	crossBorder := isAlipayCrossBorder(req.Currency)
+	var plan *InstallmentPlan
+	if req.Installment != nil {
+		if crossBorder {
+			return apierr.ErrorResponse("INVALID_PARAMS", "跨境支付不支持花呗分期"), nil
+		}
+		var err error
+		if plan, err = NewInstallmentPlan(req.Amount, req.Installment); err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+		}
 	}
 
 	// 构建支付宝支付参数
 	bm := make(gopay.BodyMap)
 	bm.Set("out_trade_no", req.OrderID)
-	bm.Set("total_amount", fmt.Sprintf("%.2f", req.Amount))
+	bm.Set("total_amount", formatAmount(req.Amount, req.Currency))
 	bm.Set("subject", req.Subject)
 	bm.Set("body", req.Body)
-	
+	if crossBorder {
+		setAlipayForexParams(bm, req.Currency)
+	}
+
 	if req.ReturnURL != "" {
 		bm.Set("return_url", req.ReturnURL)
 	}
@@ -122,44 +271,63 @@ func (ps *PaymentService) createAlipayPayment(req *PaymentRequest) (*PaymentResp
 	if req.ExpireMinutes > 0 {
 		bm.Set("timeout_express", fmt.Sprintf("%dm", req.ExpireMinutes))
 	}
+	if plan != nil {
+		bm.Set("extend_params", plan.extendParams())
+	}
+	if passback := ps.passback.Encode(req.Metadata, alipayPassbackLimit, true); passback != "" {
+		bm.Set("passback_params", passback)
+	}
 
-	// 创建支付宝页面支付
-	payURL, err := ps.alipayClient.TradePagePay(context.Background(), bm)
-	if err != nil {
-		return &PaymentResponse{
-			Success: false,
-			Code:    "PAYMENT_ERROR",
-			Message: fmt.Sprintf("创建支付宝支付失败: %v", err),
-		}, nil
-	}
-
-	return &PaymentResponse{
-		Success: true,
-		Data: &PaymentData{
-			PaymentID:   req.OrderID,
-			RedirectURL: payURL,
-			ExpiredAt:   time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute).Format(time.RFC3339),
-		},
-	}, nil
+	data := &PaymentData{
+		PaymentID:   req.OrderID,
+		ExpiredAt:   time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute).Format(time.RFC3339),
+		Installment: plan,
+	}
+
+	switch req.Scene {
+	case "", "page":
+		// 创建支付宝页面支付
+		payURL, err := ps.aliClient().TradePagePay(context.Background(), bm)
+		ps.breakers["alipay"].Record(err)
+		if err != nil {
+			return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建支付宝支付失败: %v", err)), nil
+		}
+		data.RedirectURL = payURL
+	case "app":
+		// 创建支付宝App支付，返回的订单串由客户端SDK拉起支付宝
+		orderStr, err := ps.aliClient().TradeAppPay(context.Background(), bm)
+		ps.breakers["alipay"].Record(err)
+		if err != nil {
+			return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建支付宝支付失败: %v", err)), nil
+		}
+		data.DeepLink = orderStr
+	default:
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的支付宝支付场景: %s", req.Scene)), nil
+	}
+
+	if err := ps.recordPayment(req, plan); err != nil {
+		return nil, err
+	}
+
+	return apierr.SuccessResponse(data), nil
 }
 
-func (ps *PaymentService) createWechatPayment(req *PaymentRequest) (*PaymentResponse, error) {
-	if ps.wechatClient == nil {
-		return &PaymentResponse{
-			Success: false,
-			Code:    "CLIENT_ERROR",
-			Message: "微信客户端未初始化",
-		}, nil
+func (ps *PaymentService) createWechatPayment(req *PaymentRequest) (*apierr.Response, error) {
+	if ps.wxClient() == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "微信客户端未初始化"), nil
+	}
+	if req.Installment != nil {
+		return apierr.ErrorResponse("INVALID_PARAMS", "微信支付不支持花呗分期"), nil
 	}
 
 	// 构建微信支付参数
 	bm := make(gopay.BodyMap)
 	bm.Set("out_trade_no", req.OrderID)
-	bm.Set("total_fee", int(req.Amount*100)) // 微信支付金额单位为分
+	bm.Set("total_fee", toMinorUnits(req.Amount)) // 微信支付金额单位为分
 	bm.Set("body", req.Subject)
 	bm.Set("spbill_create_ip", "127.0.0.1") // 实际应用中应该获取真实IP
-	bm.Set("trade_type", "NATIVE") // 扫码支付
-	
+	bm.Set("trade_type", "NATIVE")          // 扫码支付
+
 	if req.NotifyURL != "" {
 		bm.Set("notify_url", req.NotifyURL)
 	}
@@ -167,145 +335,290 @@ func (ps *PaymentService) createWechatPayment(req *PaymentRequest) (*PaymentResp
 		expireTime := time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute)
 		bm.Set("time_expire", expireTime.Format("20060102150405"))
 	}
+	if attach := ps.passback.Encode(req.Metadata, wechatAttachLimit, false); attach != "" {
+		bm.Set("attach", attach)
+	}
 
 	// 创建微信扫码支付
-	wxRsp, err := ps.wechatClient.UnifiedOrder(context.Background(), bm)
+	wxRsp, err := ps.wxClient().UnifiedOrder(context.Background(), bm)
+	ps.breakers["wechat"].Record(err)
 	if err != nil {
-		return &PaymentResponse{
-			Success: false,
-			Code:    "PAYMENT_ERROR",
-			Message: fmt.Sprintf("创建微信支付失败: %v", err),
-		}, nil
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建微信支付失败: %v", err)), nil
 	}
 
 	if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
-		return &PaymentResponse{
-			Success: false,
-			Code:    "PAYMENT_ERROR",
-			Message: fmt.Sprintf("微信支付创建失败: %s", wxRsp.ErrCodeDes),
-		}, nil
-	}
-
-	return &PaymentResponse{
-		Success: true,
-		Data: &PaymentData{
-			PaymentID: req.OrderID,
-			QRCode:    wxRsp.CodeUrl,
-			ExpiredAt: time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute).Format(time.RFC3339),
-		},
-	}, nil
-}
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("微信支付创建失败: %s", wxRsp.ErrCodeDes)), nil
+	}
 
-func (ps *PaymentService) QueryPayment(paymentID string) (*PaymentResponse, error) {
-	// 这里应该根据支付方式查询对应的支付状态
-	// 为简化示例，这里返回模拟数据
-	return &PaymentResponse{
-		Success: true,
-		Data: &PaymentData{
-			PaymentID: paymentID,
-		},
-	}, nil
+	if err := ps.recordPayment(req, nil); err != nil {
+		return nil, err
+	}
+
+	return apierr.SuccessResponse(&PaymentData{
+		PaymentID: req.OrderID,
+		QRCode:    wxRsp.CodeUrl,
+		ExpiredAt: time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute).Format(time.RFC3339),
+	}), nil
 }
 
-func main() {
-	// 加载环境变量
-	if err := godotenv.Load(); err != nil {
-		log.Printf("加载.env文件失败: %v", err)
+// recordPayment 保存新建的支付记录，plan 为用户选择的分期方案
+func (ps *PaymentService) recordPayment(req *PaymentRequest, plan *InstallmentPlan) error {
+	var expiresAt time.Time
+	if req.ExpireMinutes > 0 {
+		expiresAt = time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute)
 	}
 
-	// 初始化支付服务
-	paymentService := NewPaymentService()
+	var channel, credentialID string
+	switch req.Method {
+	case "alipay":
+		channel = req.Scene
+		if channel == "" {
+			channel = "page"
+		}
+		credentialID = ps.credentials.ActiveKeyID("alipay")
+	case "wechat":
+		channel = "native"
+		credentialID = ps.credentials.ActiveKeyID("wechat")
+	}
 
-	// 设置Gin模式
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	var invoice *FapiaoInfo
+	if req.Invoice != nil {
+		invoice = &FapiaoInfo{InvoiceRequest: *req.Invoice, Status: FapiaoPending}
+	}
 
-	// 中间件
-	r.Use(gin.Recovery())
-	r.Use(func(c *gin.Context) {
-		c.Header("Content-Type", "application/json")
-		c.Next()
-	})
+	record := &PaymentRecord{
+		PaymentID:    req.OrderID,
+		Channel:      channel,
+		Invoice:      invoice,
+		OrderID:      req.OrderID,
+		TenantID:     req.TenantID,
+		UserID:       req.UserID,
+		Method:       req.Method,
+		Purpose:      req.Purpose,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		Subject:      req.Subject,
+		Status:       StatusPending,
+		Metadata:     req.Metadata,
+		ReturnURL:    req.ReturnURL,
+		NotifyURL:    req.NotifyURL,
+		ExpiresAt:    expiresAt,
+		Installment:  plan,
+		CredentialID: credentialID,
+		Webhooks:     req.webhookTargets,
+	}
+	if req.Method == "alipay" && isAlipayCrossBorder(req.Currency) {
+		record.Forex = newForexInfo(req.Currency, req.Amount)
+	}
+	record.ExchangeRate = ps.referenceRate(req.Currency)
+	if req.Risk != nil {
+		record.applyRisk(req.Risk)
+	}
+	return ps.store.Save(record)
+}
 
-	// API路由
-	api := r.Group("/api/v1")
-	{
-		api.POST("/payment/create", func(c *gin.Context) {
-			var req PaymentRequest
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, PaymentResponse{
-					Success: false,
-					Code:    "INVALID_PARAMS",
-					Message: err.Error(),
-				})
-				return
-			}
+func (ps *PaymentService) QueryPayment(paymentID string) (*apierr.Response, error) {
+	if ps.statusCache != nil {
+		if data, ok := ps.statusCache.Get(paymentID); ok {
+			return apierr.SuccessResponse(data), nil
+		}
+	}
 
-			resp, err := paymentService.CreatePayment(&req)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, PaymentResponse{
-					Success: false,
-					Code:    "INTERNAL_ERROR",
-					Message: err.Error(),
-				})
-				return
+	data := &PaymentData{
+		PaymentID: paymentID,
+	}
+	if record, err := ps.store.Get(paymentID); err == nil {
+		// 待支付的记录向渠道查询最新状态，缓存有效期内同一笔支付只查询一次
+		if record.Status == StatusPending {
+			if err := ps.syncPaymentStatus(record); err != nil {
+				log.Printf("同步支付状态失败 %s: %v", paymentID, err)
 			}
+		}
+		data.Status = record.Status
+		data.Installment = record.Installment
+		data.Saga = record.Saga
+		// 不存在的支付单不缓存，记录写入后轮询应立即可见
+		if ps.statusCache != nil {
+			ps.statusCache.Set(paymentID, data)
+		}
+	}
+	return apierr.SuccessResponse(data), nil
+}
 
-			c.JSON(http.StatusOK, resp)
-		})
+// registerPaymentRoutes 注册下单、查询及预授权接口
+func registerPaymentRoutes(api *gin.RouterGroup, ps *PaymentService, async *AsyncCreator) {
+	api.POST("/payment/create", func(c *gin.Context) {
+		var req PaymentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		req.TenantID = tenantFromRequest(c)
+		req.ClientIP = c.ClientIP()
 
-		api.GET("/payment/query/:paymentId", func(c *gin.Context) {
-			paymentID := c.Param("paymentId")
-			
-			resp, err := paymentService.QueryPayment(paymentID)
+		// async=true 时入队后立即返回 202，渠道调用由后台 worker 完成
+		if c.Query("async") == "true" {
+			resp, err := async.Enqueue(&req)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, PaymentResponse{
-					Success: false,
-					Code:    "INTERNAL_ERROR",
-					Message: err.Error(),
-				})
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 				return
 			}
+			if resp.Success {
+				c.JSON(http.StatusAccepted, resp)
+				return
+			}
+			respondMaybeRetry(c, resp)
+			return
+		}
 
-			c.JSON(http.StatusOK, resp)
-		})
+		resp, err := ps.CreatePayment(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
 
-		api.POST("/payment/refund", func(c *gin.Context) {
-			// 退款逻辑
-			c.JSON(http.StatusOK, PaymentResponse{
-				Success: true,
-				Message: "退款功能待实现",
-			})
-		})
-	}
+		respondMaybeRetry(c, resp)
+	})
 
-	// 健康检查
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"time":   time.Now().Format(time.RFC3339),
-		})
+	api.GET("/payment/query/:paymentId", func(c *gin.Context) {
+		paymentID := c.Param("paymentId")
+
+		resp, err := ps.QueryPayment(paymentID)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
 	})
 
-	// 启动服务器
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	api.POST("/payment/authorize", func(c *gin.Context) {
+		var req AuthorizeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.Authorize(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		respondMaybeRetry(c, resp)
+	})
+
+	api.POST("/payment/capture", func(c *gin.Context) {
+		var req CaptureRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.Capture(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.POST("/payment/void", func(c *gin.Context) {
+		var req VoidRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.Void(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
+
+// 可启动的服务
+const (
+	serveFiat   = "fiat"   // 法币渠道：支付宝、微信、Stripe、余额、礼品卡
+	serveCrypto = "crypto" // 加密货币网关
+	serveAll    = "all"    // 同一进程内启动两者，各自监听端口
+)
+
+const serveUsage = `用法:
+  gopay-service serve [fiat|crypto|all] [--migrate]  启动服务，默认 fiat；--migrate 先执行表结构迁移
+  gopay-service --migrate                            只执行表结构迁移
+  gopay-service replay-notify [选项] <文件或目录>...   回放渠道通知报文
+  gopay-service crypto-keystore -out <路径> [-import]  生成或导入热钱包私钥，写入加密的密钥库`
+
+func main() {
+	// 加载环境变量
+	if err := godotenv.Load(); err != nil {
+		log.Printf("加载.env文件失败: %v", err)
 	}
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+	// 命令行工具：回放渠道通知报文
+	if len(os.Args) > 1 && os.Args[1] == "replay-notify" {
+		os.Exit(runNotifyReplayCLI(os.Args[2:]))
+	}
+
+	// 命令行工具：生成或导入热钱包密钥库
+	if len(os.Args) > 1 && os.Args[1] == "crypto-keystore" {
+		os.Exit(cryptogw.RunKeystoreCLI(os.Args[2:]))
 	}
 
-	// 优雅关闭
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("服务器启动失败: %v", err)
+	// 表结构迁移：单独执行时完成后退出，与 serve 一起使用时迁移后继续启动
+	args, migrate := extractFlag(os.Args[1:], "--migrate")
+	if migrate {
+		if err := runMigrations(context.Background()); err != nil {
+			log.Fatalf("表结构迁移失败: %v", err)
 		}
-	}()
+		if len(args) == 0 {
+			return
+		}
+	}
 
-	log.Printf("Gopay微服务已启动，端口: %s", port)
+	target, err := parseServeArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, serveUsage)
+		os.Exit(2)
+	}
+
+	// 错误上报：panic、通知处理失败、死信任务和渠道拨测失败
+	flushErrors := InitErrorReporting()
+	gin.SetMode(gin.ReleaseMode)
+
+	var fiat *fiatGateway
+	if target == serveFiat || target == serveAll {
+		fiat = startFiatGateway()
+	}
+	var crypto *cryptogw.Server
+	var cryptoDB *sql.DB
+	if target == serveCrypto || target == serveAll {
+		if cryptoDB, err = openCryptoDB(); err != nil {
+			log.Fatalf("打开加密货币网关存储失败: %v", err)
+		}
+		// 网关的退款发送、归集等管理接口与法币渠道服务使用同一身份提供方的令牌和角色，生产环境不允许不经认证开放
+		cryptoAuth := NewJWTAuth()
+		if !cryptoAuth.Enabled() && envString("APP_ENV", "development") == "production" {
+			log.Fatalf("生产环境须配置 AUTH_JWKS_URL，加密货币网关的管理接口不能不经认证开放")
+		}
+		crypto, err = cryptogw.Start(cryptogw.Options{
+			Port:        cryptoPort(target),
+			ServiceName: envString("NACOS_CRYPTO_SERVICE_NAME", "crypto-gateway"),
+			Version:     version,
+			DB:          cryptoDB,
+			AdminAuth:   cryptoAuth,
+			Loops:       NewLoopRunner(),
+		})
+		if err != nil {
+			log.Fatalf("启动加密货币网关失败: %v", err)
+		}
+	}
 
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
@@ -313,13 +626,248 @@ func main() {
 	<-quit
 
 	log.Println("正在关闭服务器...")
+	if crypto != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+		if err := crypto.Shutdown(ctx); err != nil {
+			log.Printf("加密货币网关未能在关闭期限内退出: %v", err)
+		}
+		cancel()
+	}
+	if cryptoDB != nil {
+		cryptoDB.Close()
+	}
+	if fiat != nil {
+		fiat.Shutdown()
+	}
+	flushErrors()
+
+	log.Println("服务器已关闭")
+}
+
+// parseServeArgs 解析 serve 子命令，不带参数时按 serve fiat 处理，兼容原有的启动方式
+func parseServeArgs(args []string) (string, error) {
+	if len(args) == 0 {
+		return serveFiat, nil
+	}
+	if args[0] != "serve" {
+		return "", fmt.Errorf("未知的子命令: %s", args[0])
+	}
+	if len(args) == 1 {
+		return serveFiat, nil
+	}
+	if len(args) > 2 {
+		return "", fmt.Errorf("serve 只接受一个参数")
+	}
+	switch args[1] {
+	case serveFiat, serveCrypto, serveAll:
+		return args[1], nil
+	default:
+		return "", fmt.Errorf("未知的服务: %s", args[1])
+	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// extractFlag 从参数中移除布尔开关，返回剩余参数和开关是否出现
+func extractFlag(args []string, flag string) ([]string, bool) {
+	rest := make([]string, 0, len(args))
+	found := false
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("服务器强制关闭:", err)
+// cryptoPort 加密货币网关单独运行时沿用 PORT，与法币渠道同进程运行时使用 CRYPTO_PORT
+func cryptoPort(target string) string {
+	if target == serveCrypto {
+		return envString("CRYPTO_PORT", envString("PORT", "8081"))
 	}
+	return envString("CRYPTO_PORT", "8081")
+}
 
-	log.Println("服务器已关闭")
-}
\ No newline at end of file
+// fiatGateway 法币渠道服务及关闭时需要排空的后台任务
+type fiatGateway struct {
+	srv        *http.Server
+	background *Background
+	jobs       *JobRegistry
+	stopJobs   context.CancelFunc
+	bus        EventBus
+	registry   *ServiceRegistry
+	repo       *Repository
+}
+
+// Shutdown 先从服务发现注销，再按顺序排空在途工作，最后关闭存储
+func (g *fiatGateway) Shutdown() {
+	g.registry.Deregister()
+	gracefulShutdown(g.srv, g.background, g.jobs, g.stopJobs, g.bus)
+	if err := g.repo.Close(); err != nil {
+		log.Printf("关闭存储失败: %v", err)
+	}
+}
+
+// startFiatGateway 初始化法币渠道服务并开始监听
+func startFiatGateway() *fiatGateway {
+	// 初始化支付服务
+	paymentService := NewPaymentService()
+	subscriptionService := NewSubscriptionService(paymentService)
+	payoutService := NewPayoutService(paymentService)
+	metricsRoller := NewMetricsRoller(paymentService)
+	configBundler := NewConfigBundler(paymentService)
+	settlementService := NewSettlementService(paymentService)
+	disputeService := NewDisputeService(paymentService)
+	refundBatches := NewRefundBatchProcessor(paymentService)
+	scheduledPayments := NewScheduledPaymentActivator(paymentService)
+	merchantPortal := NewMerchantPortal(paymentService, settlementService)
+	checkoutHub := NewCheckoutHub()
+	expiryExtender := NewExpiryExtender(paymentService, checkoutHub)
+	archiver := NewPaymentArchiver(paymentService)
+	asyncCreator := NewAsyncCreator(paymentService)
+	prober := NewSyntheticProber(paymentService)
+
+	// 后台任务随服务关闭一起停止，任务队列在后台任务退出后单独排空
+	background := NewBackground()
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go paymentService.jobs.Run(jobsCtx)
+	background.Go(subscriptionService.Run)
+	background.Go(payoutService.Run)
+	background.Go(metricsRoller.Run)
+	background.Go(settlementService.Run)
+	background.Go(disputeService.Run)
+	background.Go(refundBatches.Run)
+	background.Go(scheduledPayments.Run)
+	background.Go(expiryExtender.Run)
+	background.Go(archiver.Run)
+	background.Go(asyncCreator.Run)
+	background.Go(prober.Run)
+	if debugServer := NewDebugServer(); debugServer != nil {
+		background.Go(debugServer.Run)
+	}
+	background.Go(paymentService.credentials.Run)
+	background.Go(paymentService.risk.Run)
+	background.Go(paymentService.maintenance.Run)
+	background.Go(NewNotifyDedupJanitor(paymentService.notifyDedup).Run)
+	// 事件总线：发布支付事件，消费订单创建事件自动下单，消费履约结果驱动补偿
+	bus := NewEventBus()
+	if bus != nil {
+		paymentService.webhooks.bus = bus
+		background.Go(NewOrderEventConsumer(paymentService, bus).Run)
+		background.Go(func(ctx context.Context) {
+			paymentService.RunFulfillmentConsumer(ctx, bus)
+		})
+	}
+
+	r := gin.Default()
+	// c.ClientIP() 用于下单限速和审计，与通知来源校验一致，只有对端属于 NOTIFY_TRUSTED_PROXIES 才读取 X-Forwarded-For
+	if err := r.SetTrustedProxies(splitList(os.Getenv("NOTIFY_TRUSTED_PROXIES"))); err != nil {
+		log.Fatalf("解析 NOTIFY_TRUSTED_PROXIES 失败: %v", err)
+	}
+
+	// 中间件
+	r.Use(reportingRecovery())
+	r.Use(httpmw.JSONContentType())
+	r.Use(httpmw.NewCORSPolicy(r).Middleware())
+
+	// API路由
+	// 管理、退款、付款、对账接口的 JWT 认证，须在注册路由前挂载
+	auth := NewJWTAuth()
+	if !auth.Enabled() && envString("APP_ENV", "development") == "production" {
+		log.Fatalf("生产环境须配置 AUTH_JWKS_URL，管理、退款、付款接口不能不经认证开放")
+	}
+	background.Go(auth.Run)
+
+	// 下单、退款接口按客户端证书限制调用方服务
+	certAuth := newClientCertAuth()
+
+	api := r.Group("/api/v1")
+	api.Use(certAuth.Middleware())
+	api.Use(NewRequestSigner(paymentService.audit).Middleware())
+	api.Use(auth.Middleware())
+	registerPaymentRoutes(api, paymentService, asyncCreator)
+	registerAsyncCreateRoutes(api, asyncCreator)
+	registerJobRoutes(api, paymentService.jobs)
+	registerProbeRoutes(r, api, prober)
+	registerBatchQueryRoutes(api, paymentService)
+	registerScheduledPaymentRoutes(api, scheduledPayments)
+	registerRefundRoutes(api, paymentService)
+	registerRefundApprovalRoutes(api, paymentService)
+	registerRefundBatchRoutes(api, refundBatches)
+	registerWalletRoutes(api, paymentService)
+	registerSplitTenderRoutes(api, paymentService)
+	registerGiftCardRoutes(api, paymentService)
+	registerNotifyRoutes(api, paymentService)
+	registerNotifyReplayRoutes(api, paymentService)
+	registerLedgerRoutes(api, paymentService)
+	registerWebhookRoutes(api, paymentService.webhooks)
+	registerFeeRoutes(api, paymentService)
+	registerCurrencyRoutes(api, paymentService.currencies, paymentService.rates)
+	registerBundleRoutes(api, configBundler)
+	registerSettlementRoutes(api, settlementService)
+	registerFapiaoRoutes(api, paymentService)
+	registerCredentialRoutes(api, paymentService.credentials)
+	registerDisputeRoutes(api, disputeService)
+	registerMerchantRoutes(api, merchantPortal)
+	registerRiskRoutes(api, paymentService.risk)
+	registerMaintenanceRoutes(api, paymentService.maintenance)
+	registerTimelineRoutes(api, paymentService)
+	registerCheckoutRoutes(api, paymentService, checkoutHub)
+	registerSubscriptionRoutes(api, subscriptionService)
+	registerPayoutRoutes(api, payoutService)
+	registerAdminRoutes(api, paymentService)
+	registerGraphQLRoutes(api, paymentService, settlementService)
+	registerSandboxRoutes(api, paymentService)
+	registerMockRoutes(api, paymentService)
+	registerChaosRoutes(api, paymentService.chaos)
+	registerAuditRoutes(api, paymentService)
+	registerPrivacyRoutes(api, paymentService)
+	registerArchiveRoutes(api, archiver)
+	registerMetricsRoutes(api, metricsRoller)
+
+	// 平台状态页
+	registerPlatformStatusRoutes(r, NewPlatformStatusReporter(paymentService, refundBatches))
+	registerVersionRoutes(r, paymentService)
+
+	// 健康检查
+	r.GET("/health", httpmw.Health(""))
+
+	// 启动服务器
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	tlsConfig := httpmw.LoadTLSConfig()
+	serverTLS, err := tlsConfig.ServerConfig()
+	if err != nil {
+		log.Fatalf("加载 TLS 配置失败: %v", err)
+	}
+	srv := &http.Server{
+		Addr:      ":" + port,
+		Handler:   r,
+		TLSConfig: serverTLS,
+	}
+
+	httpmw.ListenAndServe(srv, tlsConfig, "服务器")
+
+	log.Printf("Gopay微服务已启动，端口: %s，存储: %s", port, paymentService.repo.Driver())
+
+	// 注册到服务发现，元数据中带上启用的支付渠道供网关按能力路由
+	registry := NewServiceRegistry(envString("NACOS_SERVICE_NAME", "gopay-service"), port, map[string]string{
+		"version":     version,
+		"environment": currentEnvironment(),
+		"providers":   strings.Join(paymentService.BuildInfo().Providers, ","),
+	})
+	background.Go(registry.Run)
+
+	return &fiatGateway{
+		srv:        srv,
+		background: background,
+		jobs:       paymentService.jobs,
+		stopJobs:   stopJobs,
+		bus:        bus,
+		registry:   registry,
+		repo:       paymentService.repo,
+	}
+}
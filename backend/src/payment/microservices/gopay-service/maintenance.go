@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 维护窗口来源
+const (
+	MaintenanceFromConfig = "config" // MAINTENANCE_WINDOWS / MAINTENANCE_WINDOWS_FILE
+	MaintenanceFromFeed   = "feed"   // MAINTENANCE_FEED_URL 定时拉取
+	MaintenanceFromAdmin  = "admin"  // 运营通过接口登记
+)
+
+var ErrMaintenanceNotFound = errors.New("维护窗口不存在")
+
+// MaintenanceWindow 渠道公告的维护时段，期间该渠道不可下单或退款
+type MaintenanceWindow struct {
+	ID       string    `json:"id"`
+	Provider string    `json:"provider" binding:"required"`
+	Start    time.Time `json:"start" binding:"required"`
+	End      time.Time `json:"end" binding:"required"`
+	Reason   string    `json:"reason"`
+	Source   string    `json:"source"`
+}
+
+func (w *MaintenanceWindow) activeAt(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// MaintenanceNotice 渠道维护中时返回给调用方的说明
+type MaintenanceNotice struct {
+	Provider          string    `json:"provider"`
+	Reason            string    `json:"reason,omitempty"`
+	WindowEnd         time.Time `json:"windowEnd"`
+	RetryAfterSeconds int       `json:"retryAfterSeconds"`
+}
+
+// MaintenanceRegistry 各渠道的维护窗口登记表
+type MaintenanceRegistry struct {
+	mu      sync.RWMutex
+	windows []*MaintenanceWindow
+
+	feedURL    string
+	interval   time.Duration
+	httpClient *http.Client
+}
+
+func NewMaintenanceRegistry() *MaintenanceRegistry {
+	mr := &MaintenanceRegistry{
+		feedURL:    os.Getenv("MAINTENANCE_FEED_URL"),
+		interval:   envDuration("MAINTENANCE_FEED_INTERVAL", 10*time.Minute),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	raw := []byte(os.Getenv("MAINTENANCE_WINDOWS"))
+	if path := os.Getenv("MAINTENANCE_WINDOWS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("读取维护窗口配置失败: %v", err)
+		} else {
+			raw = data
+		}
+	}
+	if len(raw) > 0 {
+		windows, err := parseMaintenanceWindows(raw)
+		if err != nil {
+			log.Printf("解析维护窗口配置失败: %v", err)
+		} else {
+			mr.replace(MaintenanceFromConfig, windows)
+		}
+	}
+	return mr
+}
+
+// parseMaintenanceWindows 解析 [{"provider":"alipay","start":"...","end":"...","reason":"..."}]
+func parseMaintenanceWindows(raw []byte) ([]*MaintenanceWindow, error) {
+	var windows []*MaintenanceWindow
+	if err := json.Unmarshal(raw, &windows); err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		if err := w.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return windows, nil
+}
+
+func (w *MaintenanceWindow) validate() error {
+	if w.Provider == "" {
+		return errors.New("维护窗口缺少渠道")
+	}
+	if !w.End.After(w.Start) {
+		return fmt.Errorf("%s 维护窗口结束时间必须晚于开始时间", w.Provider)
+	}
+	return nil
+}
+
+// replace 替换指定来源的全部窗口
+func (mr *MaintenanceRegistry) replace(source string, windows []*MaintenanceWindow) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	kept := make([]*MaintenanceWindow, 0, len(mr.windows)+len(windows))
+	for _, w := range mr.windows {
+		if w.Source != source {
+			kept = append(kept, w)
+		}
+	}
+	for i, w := range windows {
+		copied := *w
+		copied.Source = source
+		if copied.ID == "" {
+			copied.ID = fmt.Sprintf("%s-%s-%d", source, copied.Provider, i)
+		}
+		kept = append(kept, &copied)
+	}
+	mr.windows = kept
+}
+
+// Add 登记一个维护窗口
+func (mr *MaintenanceRegistry) Add(window MaintenanceWindow) (*MaintenanceWindow, error) {
+	if err := window.validate(); err != nil {
+		return nil, err
+	}
+	window.ID = fmt.Sprintf("MW%d%s", time.Now().UnixNano(), util.RandomNumber(4))
+	window.Source = MaintenanceFromAdmin
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.windows = append(mr.windows, &window)
+	copied := window
+	return &copied, nil
+}
+
+// Remove 删除运营登记的维护窗口，配置和拉取的窗口以来源为准
+func (mr *MaintenanceRegistry) Remove(id string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for i, w := range mr.windows {
+		if w.ID != id {
+			continue
+		}
+		if w.Source != MaintenanceFromAdmin {
+			return fmt.Errorf("维护窗口来自 %s，不能通过接口删除", w.Source)
+		}
+		mr.windows = append(mr.windows[:i], mr.windows[i+1:]...)
+		return nil
+	}
+	return ErrMaintenanceNotFound
+}
+
+// Active 返回渠道当前所处的维护窗口，多个窗口重叠时取结束最晚的
+func (mr *MaintenanceRegistry) Active(provider string) *MaintenanceWindow {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	now := time.Now()
+	var active *MaintenanceWindow
+	for _, w := range mr.windows {
+		if w.Provider == provider && w.activeAt(now) && (active == nil || w.End.After(active.End)) {
+			active = w
+		}
+	}
+	if active == nil {
+		return nil
+	}
+	copied := *active
+	return &copied
+}
+
+// Upcoming 返回尚未结束的窗口，按开始时间排序
+func (mr *MaintenanceRegistry) Upcoming() []MaintenanceWindow {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	now := time.Now()
+	windows := make([]MaintenanceWindow, 0, len(mr.windows))
+	for _, w := range mr.windows {
+		if w.End.After(now) {
+			windows = append(windows, *w)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Start.Before(windows[j].Start)
+	})
+	return windows
+}
+
+// Notice 渠道维护中时返回说明，否则返回 nil
+func (mr *MaintenanceRegistry) Notice(provider string) *MaintenanceNotice {
+	w := mr.Active(provider)
+	if w == nil {
+		return nil
+	}
+	return &MaintenanceNotice{
+		Provider:          provider,
+		Reason:            w.Reason,
+		WindowEnd:         w.End,
+		RetryAfterSeconds: seconds(time.Until(w.End)),
+	}
+}
+
+// Run 定时拉取渠道维护公告，并清理已结束的窗口
+func (mr *MaintenanceRegistry) Run(ctx context.Context) {
+	mr.refresh(ctx)
+
+	ticker := time.NewTicker(mr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mr.refresh(ctx)
+		}
+	}
+}
+
+func (mr *MaintenanceRegistry) refresh(ctx context.Context) {
+	mr.prune()
+	if mr.feedURL == "" {
+		return
+	}
+	windows, err := mr.fetch(ctx)
+	if err != nil {
+		// 拉取失败时保留上一次的结果
+		log.Printf("拉取渠道维护公告失败: %v", err)
+		return
+	}
+	mr.replace(MaintenanceFromFeed, windows)
+}
+
+func (mr *MaintenanceRegistry) fetch(ctx context.Context) ([]*MaintenanceWindow, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mr.feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mr.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("维护公告接口返回 %d", resp.StatusCode)
+	}
+	return parseMaintenanceWindows(body)
+}
+
+func (mr *MaintenanceRegistry) prune() {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	kept := mr.windows[:0]
+	for _, w := range mr.windows {
+		if w.End.After(now) {
+			kept = append(kept, w)
+		}
+	}
+	mr.windows = kept
+}
+
+// maintenanceResponse 构造 PROVIDER_MAINTENANCE 响应
+func maintenanceResponse(notice *MaintenanceNotice) *apierr.Response {
+	return &apierr.Response{
+		Success: false,
+		Code:    "PROVIDER_MAINTENANCE",
+		Message: fmt.Sprintf("支付渠道 %s 维护中，预计 %s 恢复", notice.Provider, notice.WindowEnd.Local().Format("2006-01-02 15:04")),
+		Data:    notice,
+	}
+}
+
+// routeAroundMaintenance 下单渠道维护中时，按调用方给出的备选支付方式改走可用渠道。
+// 改道时返回原支付方式；没有可用备选时返回维护说明
+func (ps *PaymentService) routeAroundMaintenance(req *PaymentRequest) (string, *MaintenanceNotice) {
+	notice := ps.maintenance.Notice(req.Method)
+	if notice == nil {
+		return "", nil
+	}
+	for _, alternate := range req.AlternateMethods {
+		if alternate == req.Method || ps.maintenance.Active(alternate) != nil || !ps.currencies.Supports(alternate, req.Currency) {
+			continue
+		}
+		if cb, ok := ps.breakers[alternate]; ok && !cb.Allow() {
+			continue
+		}
+		original := req.Method
+		req.Method = alternate
+		log.Printf("支付 %s 渠道 %s 维护中，改用 %s", req.OrderID, original, alternate)
+		return original, nil
+	}
+	return "", notice
+}
+
+// registerMaintenanceRoutes 注册维护窗口查询与登记接口
+func registerMaintenanceRoutes(api *gin.RouterGroup, mr *MaintenanceRegistry) {
+	// 收银台据此提前提示或隐藏维护中的支付方式
+	api.GET("/payment/maintenance", func(c *gin.Context) {
+		apierr.RespondOK(c, mr.Upcoming())
+	})
+
+	admin := api.Group("/admin")
+
+	admin.POST("/maintenance", func(c *gin.Context) {
+		var req MaintenanceWindow
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		window, err := mr.Add(req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, window)
+	})
+
+	admin.DELETE("/maintenance/:id", func(c *gin.Context) {
+		err := mr.Remove(c.Param("id"))
+		if err == ErrMaintenanceNotFound {
+			apierr.RespondError(c, http.StatusNotFound, "MAINTENANCE_NOT_FOUND", err.Error())
+			return
+		}
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, gin.H{"id": c.Param("id")})
+	})
+}
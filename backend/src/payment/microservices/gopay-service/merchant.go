@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// merchantTenantKey 商户认证通过后写入 gin.Context 的租户编号
+const merchantTenantKey = "merchantTenant"
+
+const merchantKeyPrefix = "mk_"
+
+var ErrMerchantKeyNotFound = errors.New("商户 API Key 不存在")
+
+// MerchantKey 商户门户使用的 API Key，只保存密钥哈希
+type MerchantKey struct {
+	KeyID      string    `json:"keyId"`
+	TenantID   string    `json:"tenantId"`
+	Name       string    `json:"name"`
+	SecretHash string    `json:"-"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type CreateMerchantKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreatedMerchantKey 创建结果，完整密钥仅在创建时返回一次
+type CreatedMerchantKey struct {
+	*MerchantKey
+	Secret string `json:"secret"`
+}
+
+// MerchantKeyStore 商户 API Key 存储
+type MerchantKeyStore interface {
+	Save(key *MerchantKey) error
+	Get(keyID string) (*MerchantKey, error)
+	ListByTenant(tenantID string) ([]*MerchantKey, error)
+}
+
+type memoryMerchantKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*MerchantKey
+}
+
+func NewMemoryMerchantKeyStore() MerchantKeyStore {
+	return &memoryMerchantKeyStore{keys: make(map[string]*MerchantKey)}
+}
+
+func (s *memoryMerchantKeyStore) Save(key *MerchantKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	copied := *key
+	s.keys[key.KeyID] = &copied
+	return nil
+}
+
+func (s *memoryMerchantKeyStore) Get(keyID string) (*MerchantKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return nil, ErrMerchantKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *memoryMerchantKeyStore) ListByTenant(tenantID string) ([]*MerchantKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*MerchantKey
+	for _, key := range s.keys {
+		if key.TenantID == tenantID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// MerchantPortal 面向商户的接口子集，所有数据按认证得到的租户隔离
+type MerchantPortal struct {
+	payments    *PaymentService
+	settlements *SettlementService
+	keys        MerchantKeyStore
+}
+
+func NewMerchantPortal(payments *PaymentService, settlements *SettlementService) *MerchantPortal {
+	return &MerchantPortal{
+		payments:    payments,
+		settlements: settlements,
+		keys:        NewMemoryMerchantKeyStore(),
+	}
+}
+
+// IssueKey 为租户签发 API Key，密钥格式为 mk_<keyId>.<secret>
+func (mp *MerchantPortal) IssueKey(tenantID, name string) (*CreatedMerchantKey, error) {
+	secret := util.RandomString(40)
+	key := &MerchantKey{
+		KeyID:      fmt.Sprintf("MK%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		TenantID:   tenantID,
+		Name:       name,
+		SecretHash: sha256Hex([]byte(secret)),
+	}
+	if err := mp.keys.Save(key); err != nil {
+		return nil, err
+	}
+	return &CreatedMerchantKey{MerchantKey: key, Secret: merchantKeyPrefix + key.KeyID + "." + secret}, nil
+}
+
+// RevokeKey 吊销租户自己的 API Key
+func (mp *MerchantPortal) RevokeKey(tenantID, keyID string) (*MerchantKey, error) {
+	key, err := mp.keys.Get(keyID)
+	if err != nil || key.TenantID != tenantID {
+		return nil, ErrMerchantKeyNotFound
+	}
+	if key.RevokedAt.IsZero() {
+		key.RevokedAt = time.Now()
+		if err := mp.keys.Save(key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// authenticate 校验 Authorization: Bearer mk_<keyId>.<secret>，返回所属租户
+func (mp *MerchantPortal) authenticate(header string) (string, error) {
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || !strings.HasPrefix(token, merchantKeyPrefix) {
+		return "", errors.New("缺少商户 API Key")
+	}
+	keyID, secret, ok := strings.Cut(strings.TrimPrefix(token, merchantKeyPrefix), ".")
+	if !ok {
+		return "", errors.New("商户 API Key 格式无效")
+	}
+
+	key, err := mp.keys.Get(keyID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(sha256Hex([]byte(secret)))) != 1 {
+		return "", errors.New("商户 API Key 无效")
+	}
+	if !key.RevokedAt.IsZero() {
+		return "", errors.New("商户 API Key 已吊销")
+	}
+
+	key.LastUsedAt = time.Now()
+	_ = mp.keys.Save(key)
+	return key.TenantID, nil
+}
+
+// middleware 商户认证，租户只取自 API Key，忽略 X-Tenant-ID
+func (mp *MerchantPortal) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID, err := mp.authenticate(c.GetHeader("Authorization"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			c.Abort()
+			return
+		}
+		c.Set(merchantTenantKey, tenantID)
+		c.Next()
+	}
+}
+
+func merchantTenant(c *gin.Context) string {
+	return c.GetString(merchantTenantKey)
+}
+
+// ownedBy 未带租户的历史记录归属 default 租户
+func ownedBy(recordTenant, tenantID string) bool {
+	if recordTenant == "" {
+		recordTenant = defaultTenantID
+	}
+	return recordTenant == tenantID
+}
+
+// tenantReport 返回只包含该租户结算行的报表副本
+func tenantReport(report *SettlementReport, tenantID string) *SettlementReport {
+	scoped := *report
+	scoped.UploadedTo = nil
+	scoped.Lines = make([]SettlementLine, 0)
+	for _, l := range report.Lines {
+		if l.TenantID == tenantID {
+			scoped.Lines = append(scoped.Lines, l)
+		}
+	}
+	return &scoped
+}
+
+// registerMerchantRoutes 注册商户门户接口。/merchant 下的接口使用商户 API Key 认证，
+// 首个 API Key 由运营通过 admin 接口签发
+func registerMerchantRoutes(api *gin.RouterGroup, mp *MerchantPortal) {
+	ps := mp.payments
+
+	api.Group("/admin").POST("/tenants/:tenantId/merchant-keys", func(c *gin.Context) {
+		var req CreateMerchantKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		created, err := mp.IssueKey(c.Param("tenantId"), req.Name)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, created)
+	})
+
+	merchant := api.Group("/merchant", mp.middleware())
+
+	// 支付列表，q 参数为过滤表达式，结果限定为本商户
+	merchant.GET("/payments", func(c *gin.Context) {
+		page, err := apierr.ParsePageParams(c)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		records, err := ps.SearchPayments(c.Query("q"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+			return
+		}
+
+		tenantID := merchantTenant(c)
+		owned := make([]*PaymentRecord, 0, len(records))
+		for _, record := range records {
+			if ownedBy(record.TenantID, tenantID) {
+				owned = append(owned, record)
+			}
+		}
+		start, end := apierr.Paginate(len(owned), page)
+		apierr.RespondPage(c, owned[start:end], page, len(owned))
+	})
+
+	merchant.GET("/payments/:paymentId", func(c *gin.Context) {
+		record, err := ps.store.Get(c.Param("paymentId"))
+		// 不区分不存在与无权访问，避免探测其他商户的订单号
+		if err != nil || !ownedBy(record.TenantID, merchantTenant(c)) {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", ErrPaymentNotFound.Error())
+			return
+		}
+		apierr.RespondOK(c, record)
+	})
+
+	merchant.GET("/refunds", func(c *gin.Context) {
+		page, err := apierr.ParsePageParams(c)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		refunds, err := ps.refunds.List()
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		tenantID, paymentID := merchantTenant(c), c.Query("paymentId")
+		owned := make([]*RefundRecord, 0, len(refunds))
+		for _, refund := range refunds {
+			if ownedBy(refund.TenantID, tenantID) && (paymentID == "" || refund.PaymentID == paymentID) {
+				owned = append(owned, refund)
+			}
+		}
+		start, end := apierr.Paginate(len(owned), page)
+		apierr.RespondPage(c, owned[start:end], page, len(owned))
+	})
+
+	merchant.GET("/webhooks", func(c *gin.Context) {
+		subs, err := ps.webhooks.subs.ListByTenant(merchantTenant(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, subs)
+	})
+
+	merchant.POST("/webhooks", func(c *gin.Context) {
+		var req CreateWebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		resp, err := ps.webhooks.Subscribe(merchantTenant(c), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	merchant.DELETE("/webhooks/:subscriptionId", func(c *gin.Context) {
+		sub, err := ps.webhooks.subs.Get(c.Param("subscriptionId"))
+		if err != nil || sub.TenantID != merchantTenant(c) {
+			apierr.RespondError(c, http.StatusNotFound, "WEBHOOK_NOT_FOUND", ErrWebhookNotFound.Error())
+			return
+		}
+		if err := ps.webhooks.subs.Delete(sub.SubscriptionID); err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, sub)
+	})
+
+	merchant.GET("/api-keys", func(c *gin.Context) {
+		keys, err := mp.keys.ListByTenant(merchantTenant(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, keys)
+	})
+
+	merchant.POST("/api-keys", func(c *gin.Context) {
+		var req CreateMerchantKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		created, err := mp.IssueKey(merchantTenant(c), req.Name)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, created)
+	})
+
+	merchant.DELETE("/api-keys/:keyId", func(c *gin.Context) {
+		key, err := mp.RevokeKey(merchantTenant(c), c.Param("keyId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "KEY_NOT_FOUND", err.Error())
+			return
+		}
+		apierr.RespondOK(c, key)
+	})
+
+	merchant.GET("/settlements", func(c *gin.Context) {
+		tenantID := merchantTenant(c)
+		reports := mp.settlements.List(c.Query("period"))
+		scoped := make([]*SettlementReport, 0, len(reports))
+		for _, report := range reports {
+			scoped = append(scoped, tenantReport(report, tenantID))
+		}
+		apierr.RespondOK(c, scoped)
+	})
+
+	// format=csv 时下载 CSV，默认返回 JSON
+	merchant.GET("/settlements/:reportId", func(c *gin.Context) {
+		report, err := mp.settlements.Get(c.Param("reportId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "REPORT_NOT_FOUND", err.Error())
+			return
+		}
+		report = tenantReport(report, merchantTenant(c))
+
+		if c.Query("format") != "csv" {
+			apierr.RespondOK(c, report)
+			return
+		}
+		content, err := settlementCSV(report)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename=settlement-"+report.ReportID+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+	})
+}
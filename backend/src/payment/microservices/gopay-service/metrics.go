@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 汇总粒度
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// MetricsRollup 某个时间桶内按支付方式、币种汇总的支付指标
+type MetricsRollup struct {
+	Granularity    string    `json:"granularity"`
+	BucketStart    time.Time `json:"bucketStart"`
+	Method         string    `json:"method"`
+	Currency       string    `json:"currency,omitempty"`
+	Count          int       `json:"count"`
+	Amount         float64   `json:"amount"`
+	PaidCount      int       `json:"paidCount"`
+	PaidAmount     float64   `json:"paidAmount"`
+	FailedCount    int       `json:"failedCount"`
+	RefundedAmount float64   `json:"refundedAmount"`
+	FeeAmount      float64   `json:"feeAmount"` // 扣除渠道退还后的净手续费
+	NetAmount      float64   `json:"netAmount"` // 实收 - 退款 - 净手续费
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+func (m *MetricsRollup) key() string {
+	return fmt.Sprintf("%s/%d/%s/%s", m.Granularity, m.BucketStart.Unix(), m.Method, m.Currency)
+}
+
+// RollupQuery 汇总查询条件
+type RollupQuery struct {
+	Granularity string
+	From        time.Time
+	To          time.Time
+	Method      string
+}
+
+// RollupStore 长期保存的指标汇总
+type RollupStore interface {
+	Upsert(rollups []*MetricsRollup) error
+	Query(q RollupQuery) ([]*MetricsRollup, error)
+	// DeleteBefore 删除指定粒度下早于 before 的汇总，返回被删除的记录
+	DeleteBefore(granularity string, before time.Time) ([]*MetricsRollup, error)
+}
+
+type memoryRollupStore struct {
+	mu      sync.RWMutex
+	rollups map[string]*MetricsRollup
+}
+
+func NewMemoryRollupStore() RollupStore {
+	return &memoryRollupStore{rollups: make(map[string]*MetricsRollup)}
+}
+
+func (s *memoryRollupStore) Upsert(rollups []*MetricsRollup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, rollup := range rollups {
+		copied := *rollup
+		copied.UpdatedAt = now
+		s.rollups[rollup.key()] = &copied
+	}
+	return nil
+}
+
+func (s *memoryRollupStore) Query(q RollupQuery) ([]*MetricsRollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*MetricsRollup
+	for _, rollup := range s.rollups {
+		if rollup.Granularity != q.Granularity {
+			continue
+		}
+		if !q.From.IsZero() && rollup.BucketStart.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !rollup.BucketStart.Before(q.To) {
+			continue
+		}
+		if q.Method != "" && rollup.Method != q.Method {
+			continue
+		}
+		copied := *rollup
+		matched = append(matched, &copied)
+	}
+	sortRollups(matched)
+	return matched, nil
+}
+
+func (s *memoryRollupStore) DeleteBefore(granularity string, before time.Time) ([]*MetricsRollup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted []*MetricsRollup
+	for key, rollup := range s.rollups {
+		if rollup.Granularity == granularity && rollup.BucketStart.Before(before) {
+			deleted = append(deleted, rollup)
+			delete(s.rollups, key)
+		}
+	}
+	sortRollups(deleted)
+	return deleted, nil
+}
+
+func sortRollups(rollups []*MetricsRollup) {
+	sort.Slice(rollups, func(i, j int) bool {
+		if !rollups[i].BucketStart.Equal(rollups[j].BucketStart) {
+			return rollups[i].BucketStart.Before(rollups[j].BucketStart)
+		}
+		if rollups[i].Method != rollups[j].Method {
+			return rollups[i].Method < rollups[j].Method
+		}
+		return rollups[i].Currency < rollups[j].Currency
+	})
+}
+
+// MetricsRoller 定期把支付记录汇总成小时/天粒度指标。
+// 小时汇总超过保留期后降采样：天汇总长期保留，小时明细可导出到冷存储目录后删除
+type MetricsRoller struct {
+	payments        *PaymentService
+	rollups         RollupStore
+	interval        time.Duration
+	lookback        time.Duration
+	hourlyRetention time.Duration
+	exportDir       string
+}
+
+func NewMetricsRoller(payments *PaymentService) *MetricsRoller {
+	return &MetricsRoller{
+		payments:        payments,
+		rollups:         NewMemoryRollupStore(),
+		interval:        envDuration("METRICS_ROLLUP_INTERVAL", 10*time.Minute),
+		lookback:        envDuration("METRICS_ROLLUP_LOOKBACK", 48*time.Hour),
+		hourlyRetention: envDuration("METRICS_HOURLY_RETENTION", 30*24*time.Hour),
+		exportDir:       os.Getenv("METRICS_EXPORT_DIR"),
+	}
+}
+
+func (mr *MetricsRoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(mr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := mr.rollup(time.Now()); err != nil {
+				log.Printf("支付指标汇总失败: %v", err)
+			}
+			if err := mr.downsample(time.Now()); err != nil {
+				log.Printf("支付指标降采样失败: %v", err)
+			}
+		}
+	}
+}
+
+// rollup 重新计算回溯窗口内的小时汇总及其所在自然日的天汇总，迟到的状态变更会在下一轮被修正
+func (mr *MetricsRoller) rollup(now time.Time) error {
+	from := now.Add(-mr.lookback).Truncate(time.Hour)
+	dayFrom := startOfDay(from)
+
+	records, err := mr.payments.store.List()
+	if err != nil {
+		return err
+	}
+
+	hourly := make(map[string]*MetricsRollup)
+	daily := make(map[string]*MetricsRollup)
+	for _, record := range records {
+		if record.CreatedAt.Before(dayFrom) {
+			continue
+		}
+		addToRollup(daily, GranularityDay, startOfDay(record.CreatedAt), record)
+		if !record.CreatedAt.Before(from) {
+			addToRollup(hourly, GranularityHour, record.CreatedAt.Truncate(time.Hour), record)
+		}
+	}
+
+	rollups := make([]*MetricsRollup, 0, len(hourly)+len(daily))
+	for _, r := range hourly {
+		rollups = append(rollups, r)
+	}
+	for _, r := range daily {
+		rollups = append(rollups, r)
+	}
+	return mr.rollups.Upsert(rollups)
+}
+
+func addToRollup(buckets map[string]*MetricsRollup, granularity string, bucketStart time.Time, record *PaymentRecord) {
+	probe := &MetricsRollup{Granularity: granularity, BucketStart: bucketStart, Method: record.Method, Currency: record.Currency}
+	rollup, ok := buckets[probe.key()]
+	if !ok {
+		rollup = probe
+		buckets[probe.key()] = rollup
+	}
+
+	rollup.Count++
+	rollup.Amount = roundAmountIn(rollup.Amount+record.Amount, rollup.Currency)
+	switch record.Status {
+	case StatusPaid, StatusPartiallyRefunded, StatusRefunded:
+		rollup.PaidCount++
+		paid := record.Amount
+		if record.CapturedAmount > 0 {
+			paid = record.CapturedAmount
+		}
+		rollup.PaidAmount = roundAmountIn(rollup.PaidAmount+paid, rollup.Currency)
+	case StatusFailed:
+		rollup.FailedCount++
+	}
+	rollup.RefundedAmount = roundAmountIn(rollup.RefundedAmount+record.RefundedAmount, rollup.Currency)
+	rollup.FeeAmount = roundAmountIn(rollup.FeeAmount+record.Fee-record.FeeRefunded, rollup.Currency)
+	rollup.NetAmount = roundAmountIn(rollup.PaidAmount-rollup.RefundedAmount-rollup.FeeAmount, rollup.Currency)
+}
+
+// downsample 删除超过保留期的小时汇总，配置了导出目录时先按天写入 JSON Lines 文件
+func (mr *MetricsRoller) downsample(now time.Time) error {
+	cutoff := startOfDay(now.Add(-mr.hourlyRetention))
+	expired, err := mr.rollups.DeleteBefore(GranularityHour, cutoff)
+	if err != nil || len(expired) == 0 || mr.exportDir == "" {
+		return err
+	}
+
+	byDay := make(map[string][]*MetricsRollup)
+	for _, rollup := range expired {
+		day := rollup.BucketStart.Format("2006-01-02")
+		byDay[day] = append(byDay[day], rollup)
+	}
+
+	if err := os.MkdirAll(mr.exportDir, 0o755); err != nil {
+		return err
+	}
+	for day, rollups := range byDay {
+		if err := exportRollups(filepath.Join(mr.exportDir, "hourly-"+day+".jsonl"), rollups); err != nil {
+			return err
+		}
+	}
+	log.Printf("已导出并清理 %d 条小时汇总", len(expired))
+	return nil
+}
+
+func exportRollups(path string, rollups []*MetricsRollup) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, rollup := range rollups {
+		if err := enc.Encode(rollup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// registerMetricsRoutes 注册指标汇总查询接口
+func registerMetricsRoutes(api *gin.RouterGroup, mr *MetricsRoller) {
+	admin := api.Group("/admin")
+
+	// granularity 为 hour 或 day，from/to 为 RFC3339 时间（to 不含）
+	admin.GET("/metrics/rollups", func(c *gin.Context) {
+		q := RollupQuery{
+			Granularity: c.DefaultQuery("granularity", GranularityDay),
+			Method:      c.Query("method"),
+		}
+		if q.Granularity != GranularityHour && q.Granularity != GranularityDay {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", fmt.Sprintf("不支持的汇总粒度: %s", q.Granularity))
+			return
+		}
+
+		for param, target := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+			raw := c.Query(param)
+			if raw == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", fmt.Sprintf("%s 格式无效: %s", param, raw))
+				return
+			}
+			*target = t
+		}
+
+		rollups, err := mr.rollups.Query(q)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, rollups)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/pressly/goose/v3"
+)
+
+// 表结构迁移随程序一起发布，文件名前缀为版本号，已发布的迁移不可修改，只能追加
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+func newMigrationProvider(db *sql.DB) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectSQLite3, db, fsys)
+}
+
+// checkSchemaVersion 启动时校验数据库表结构版本：低于程序内置的最新迁移时要求先执行 --migrate，
+// 高于时说明数据库已被更新版本的程序迁移过，旧程序可能写坏数据，同样拒绝启动
+func checkSchemaVersion(ctx context.Context, db *sql.DB) error {
+	provider, err := newMigrationProvider(db)
+	if err != nil {
+		return err
+	}
+	current, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("读取表结构版本失败: %w", err)
+	}
+	sources := provider.ListSources()
+	latest := sources[len(sources)-1].Version
+
+	switch {
+	case current < latest:
+		return fmt.Errorf("表结构版本 %d 低于程序要求的 %d，请先执行 gopay-service --migrate", current, latest)
+	case current > latest:
+		return fmt.Errorf("表结构版本 %d 高于程序支持的 %d，数据库已被更新版本的程序迁移，请升级程序", current, latest)
+	}
+	return nil
+}
+
+// runMigrations 对 STORE_DRIVER 指定的存储执行未应用的迁移，进程内存储没有表结构，直接返回
+func runMigrations(ctx context.Context) error {
+	driver := envString("STORE_DRIVER", StoreMemory)
+	if driver != StoreSQLite {
+		log.Printf("存储驱动为 %s，无需迁移", driver)
+		return nil
+	}
+
+	path := envString("SQLITE_PATH", "gopay.db")
+	db, err := openSQLite(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	provider, err := newMigrationProvider(db)
+	if err != nil {
+		return err
+	}
+	results, err := provider.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("执行迁移失败: %w", err)
+	}
+	for _, result := range results {
+		log.Printf("已应用迁移 %s（%s）", result.Source.Path, result.Duration)
+	}
+	version, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s 表结构已是最新版本 %d", path, version)
+	return nil
+}
@@ -0,0 +1,47 @@
+-- 本地模式初始表结构。记录整体以 JSON 保存在 data 列，单独的列只用于查询和排序
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS payments (
+    payment_id TEXT PRIMARY KEY,
+    order_id   TEXT NOT NULL,
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_payments_created_at ON payments (created_at);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    refund_id  TEXT PRIMARY KEY,
+    payment_id TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds (payment_id);
+
+CREATE TABLE IF NOT EXISTS wallet_accounts (
+    user_id       TEXT NOT NULL,
+    currency      TEXT NOT NULL,
+    balance_minor INTEGER NOT NULL,
+    updated_at    INTEGER NOT NULL,
+    PRIMARY KEY (user_id, currency)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    entry_id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    txn_id      TEXT NOT NULL,
+    account     TEXT NOT NULL,
+    direction   TEXT NOT NULL,
+    amount      REAL NOT NULL,
+    currency    TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_txn_id ON ledger_entries (txn_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries (account);
+
+-- +goose Down
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS wallet_accounts;
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS payments;
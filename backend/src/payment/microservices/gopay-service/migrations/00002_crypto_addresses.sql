@@ -0,0 +1,17 @@
+-- 加密货币网关的收款地址池。派生序号在同一条链上唯一，地址回收后重新分配给新账单
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS crypto_addresses (
+    address          TEXT PRIMARY KEY,
+    chain            TEXT NOT NULL,
+    derivation_index INTEGER NOT NULL,
+    status           TEXT NOT NULL,
+    payment_id       TEXT NOT NULL DEFAULT '',
+    updated_at       INTEGER NOT NULL,
+    data             TEXT NOT NULL,
+    UNIQUE (chain, derivation_index)
+);
+CREATE INDEX IF NOT EXISTS idx_crypto_addresses_status ON crypto_addresses (chain, status);
+
+-- +goose Down
+DROP TABLE IF EXISTS crypto_addresses;
@@ -0,0 +1,15 @@
+-- 加密货币网关的代币登记。启动时加载，覆盖内置和 CRYPTO_TOKENS_FILE 中的同一币种网络，disabled 为 1 时下架
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS crypto_tokens (
+    symbol     TEXT NOT NULL,
+    network    TEXT NOT NULL,
+    contract   TEXT NOT NULL DEFAULT '',
+    decimals   INTEGER NOT NULL DEFAULT 0,
+    disabled   INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (symbol, network)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS crypto_tokens;
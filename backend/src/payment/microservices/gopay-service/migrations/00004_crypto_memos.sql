@@ -0,0 +1,13 @@
+-- 加密货币网关为 XRP、Stellar、TON 账单分配的标签。同一网络的标签不重复且不释放，过期账单迟到的付款仍按标签归属
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS crypto_memos (
+    network    TEXT NOT NULL,
+    memo       TEXT NOT NULL,
+    payment_id TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (network, memo)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS crypto_memos;
@@ -0,0 +1,17 @@
+-- 储值余额改为按币种的最小货币单位保存，此前统一按分保存。小数位不是 2 的币种换算已有余额，币种列表与 minorUnitExponents 一致
+
+-- +goose Up
+UPDATE wallet_accounts SET balance_minor = balance_minor / 100
+WHERE currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF');
+UPDATE wallet_accounts SET balance_minor = balance_minor * 10
+WHERE currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND');
+UPDATE wallet_accounts SET balance_minor = balance_minor * 100
+WHERE currency IN ('CLF', 'UYW');
+
+-- +goose Down
+UPDATE wallet_accounts SET balance_minor = balance_minor * 100
+WHERE currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF');
+UPDATE wallet_accounts SET balance_minor = balance_minor / 10
+WHERE currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND');
+UPDATE wallet_accounts SET balance_minor = balance_minor / 100
+WHERE currency IN ('CLF', 'UYW');
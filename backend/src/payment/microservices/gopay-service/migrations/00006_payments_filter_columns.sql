@@ -0,0 +1,20 @@
+-- 管理端检索的过滤表达式编译为 SQL 执行，可检索字段单独成列。已有记录从 data 列回填
+
+-- +goose Up
+ALTER TABLE payments ADD COLUMN method TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN amount REAL NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+UPDATE payments SET
+    method = COALESCE(json_extract(data, '$.method'), ''),
+    currency = COALESCE(json_extract(data, '$.currency'), ''),
+    amount = COALESCE(json_extract(data, '$.amount'), 0),
+    updated_at = COALESCE(CAST((julianday(json_extract(data, '$.updatedAt')) - 2440587.5) * 86400000000000 AS INTEGER), created_at);
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments (status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payments_status;
+ALTER TABLE payments DROP COLUMN updated_at;
+ALTER TABLE payments DROP COLUMN amount;
+ALTER TABLE payments DROP COLUMN currency;
+ALTER TABLE payments DROP COLUMN method;
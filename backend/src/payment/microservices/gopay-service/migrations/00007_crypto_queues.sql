@@ -0,0 +1,50 @@
+-- 加密货币网关的账单、退款队列、归集台账、合规复核和人工复核队列。记录整体以 JSON 保存在 data 列，单独的列只用于查询和排序
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS crypto_invoices (
+    payment_id TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_crypto_invoices_created_at ON crypto_invoices (created_at);
+
+CREATE TABLE IF NOT EXISTS crypto_refunds (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS crypto_sweeps (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS crypto_compliance_cases (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS crypto_reviews (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS crypto_reviews;
+DROP TABLE IF EXISTS crypto_compliance_cases;
+DROP TABLE IF EXISTS crypto_sweeps;
+DROP TABLE IF EXISTS crypto_refunds;
+DROP TABLE IF EXISTS crypto_invoices;
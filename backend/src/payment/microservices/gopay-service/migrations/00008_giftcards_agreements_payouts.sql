@@ -0,0 +1,32 @@
+-- 礼品卡、代扣协议和提现付款。记录整体以 JSON 保存在 data 列，礼品卡密码只保存摘要
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS gift_cards (
+    card_no    TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS agreements (
+    agreement_id TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL,
+    status       TEXT NOT NULL,
+    created_at   INTEGER NOT NULL,
+    data         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_agreements_user_id ON agreements (user_id);
+
+CREATE TABLE IF NOT EXISTS payouts (
+    payout_id  TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL,
+    status     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_payouts_account_id ON payouts (account_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS payouts;
+DROP TABLE IF EXISTS agreements;
+DROP TABLE IF EXISTS gift_cards;
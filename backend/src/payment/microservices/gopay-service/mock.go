@@ -0,0 +1,499 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// 模拟渠道操作，用于预设失败
+const (
+	MockOpCreate = "create"
+	MockOpQuery  = "query"
+	MockOpRefund = "refund"
+)
+
+// 模拟交易状态
+const (
+	MockTradePending = "pending"
+	MockTradePaid    = "paid"
+	MockTradeClosed  = "closed"
+)
+
+var ErrMockTradeNotFound = errors.New("模拟交易不存在")
+
+// MockTrade 模拟渠道上的一笔交易，渠道交易号由渠道和订单号确定性生成
+type MockTrade struct {
+	Provider   string    `json:"provider"`
+	OutTradeNo string    `json:"outTradeNo"`
+	TradeNo    string    `json:"tradeNo"`
+	PayURL     string    `json:"payUrl"`
+	Amount     float64   `json:"amount"`
+	Refunded   float64   `json:"refunded,omitempty"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// MockFailure 预设的渠道失败：指定渠道的指定操作返回错误。
+// Remaining 为剩余失败次数，用完自动解除；0 表示一直失败直到清除。渠道为 * 时匹配全部渠道
+type MockFailure struct {
+	Provider  string `json:"provider" binding:"required"`
+	Operation string `json:"operation" binding:"required"`
+	Message   string `json:"message"`
+	Remaining int    `json:"remaining"`
+}
+
+// MockProviders 进程内的支付宝、微信和加密货币网关模拟实现，供本地开发和 CI 使用，无需渠道沙箱密钥。
+// 下单即时返回二维码和支付链接，由模拟支付接口推进为已支付或已关闭，支持按操作预设失败
+type MockProviders struct {
+	mu       sync.Mutex
+	trades   map[string]*MockTrade // 渠道:订单号 -> 交易
+	failures map[string]*MockFailure
+}
+
+// NewMockProviders PAYMENTS_MOCK=true 时启用，生产环境不允许启用。
+// PAYMENTS_MOCK_FAILURES 预设一直失败的操作，如 "wechat:create,alipay:refund"
+func NewMockProviders() *MockProviders {
+	if os.Getenv("PAYMENTS_MOCK") != "true" {
+		return nil
+	}
+	if currentEnvironment() == "production" {
+		log.Printf("【警告】生产环境不允许启用 PAYMENTS_MOCK，使用真实渠道")
+		return nil
+	}
+
+	mp := &MockProviders{
+		trades:   make(map[string]*MockTrade),
+		failures: make(map[string]*MockFailure),
+	}
+	for _, item := range splitList(os.Getenv("PAYMENTS_MOCK_FAILURES")) {
+		provider, operation, ok := strings.Cut(item, ":")
+		if !ok {
+			log.Printf("忽略无效的 PAYMENTS_MOCK_FAILURES 配置: %s", item)
+			continue
+		}
+		mp.SetFailure(&MockFailure{Provider: provider, Operation: operation})
+	}
+	log.Printf("【警告】已启用模拟渠道，支付宝、微信和加密货币支付不会调用真实渠道")
+	return mp
+}
+
+// Handles 该支付方式的下单、查询和退款是否由模拟渠道处理。
+// 加密货币网关在 CryptoGatewayClient 内替换，不经过这里
+func (mp *MockProviders) Handles(method string) bool {
+	return mp != nil && (method == "alipay" || method == "wechat")
+}
+
+func mockKey(provider, outTradeNo string) string {
+	return provider + ":" + outTradeNo
+}
+
+func mockDigest(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetFailure 预设渠道失败，同一渠道和操作的旧配置被覆盖
+func (mp *MockProviders) SetFailure(failure *MockFailure) {
+	if failure.Message == "" {
+		failure.Message = fmt.Sprintf("模拟渠道 %s 预设 %s 失败", failure.Provider, failure.Operation)
+	}
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.failures[mockKey(failure.Provider, failure.Operation)] = failure
+}
+
+// ClearFailures 清除全部预设失败
+func (mp *MockProviders) ClearFailures() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.failures = make(map[string]*MockFailure)
+}
+
+// Failures 返回当前预设的失败
+func (mp *MockProviders) Failures() []MockFailure {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	failures := make([]MockFailure, 0, len(mp.failures))
+	for _, failure := range mp.failures {
+		failures = append(failures, *failure)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Provider+failures[i].Operation < failures[j].Provider+failures[j].Operation
+	})
+	return failures
+}
+
+// fail 按预设返回失败并扣减剩余次数，调用方须持有 mu
+func (mp *MockProviders) fail(provider, operation string) error {
+	for _, key := range []string{mockKey(provider, operation), mockKey("*", operation)} {
+		failure, ok := mp.failures[key]
+		if !ok {
+			continue
+		}
+		if failure.Remaining > 0 {
+			failure.Remaining--
+			if failure.Remaining == 0 {
+				delete(mp.failures, key)
+			}
+		}
+		return errors.New(failure.Message)
+	}
+	return nil
+}
+
+// CreateTrade 创建模拟交易。同一订单重复下单返回原交易，与真实渠道的幂等行为一致
+func (mp *MockProviders) CreateTrade(provider, outTradeNo string, amount float64) (*MockTrade, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if err := mp.fail(provider, MockOpCreate); err != nil {
+		return nil, err
+	}
+
+	key := mockKey(provider, outTradeNo)
+	if trade, ok := mp.trades[key]; ok {
+		if trade.Status != MockTradePending {
+			return nil, fmt.Errorf("模拟交易 %s 已%s", outTradeNo, trade.Status)
+		}
+		copied := *trade
+		return &copied, nil
+	}
+
+	trade := &MockTrade{
+		Provider:   provider,
+		OutTradeNo: outTradeNo,
+		TradeNo:    "MOCK" + strings.ToUpper(mockDigest(provider, outTradeNo)[:20]),
+		PayURL:     fmt.Sprintf("mock://%s/pay?out_trade_no=%s", provider, outTradeNo),
+		Amount:     amount,
+		Status:     MockTradePending,
+		CreatedAt:  time.Now(),
+	}
+	mp.trades[key] = trade
+	copied := *trade
+	return &copied, nil
+}
+
+// QueryTrade 查询模拟交易
+func (mp *MockProviders) QueryTrade(provider, outTradeNo string) (*MockTrade, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if err := mp.fail(provider, MockOpQuery); err != nil {
+		return nil, err
+	}
+	trade, ok := mp.trades[mockKey(provider, outTradeNo)]
+	if !ok {
+		return nil, ErrMockTradeNotFound
+	}
+	copied := *trade
+	return &copied, nil
+}
+
+// Settle 把待支付的模拟交易推进为已支付或已关闭
+func (mp *MockProviders) Settle(provider, outTradeNo, status string) (*MockTrade, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	trade, ok := mp.trades[mockKey(provider, outTradeNo)]
+	if !ok {
+		return nil, ErrMockTradeNotFound
+	}
+	if trade.Status != MockTradePending && trade.Status != status {
+		return nil, fmt.Errorf("模拟交易 %s 已%s", outTradeNo, trade.Status)
+	}
+	trade.Status = status
+	copied := *trade
+	return &copied, nil
+}
+
+// Refund 模拟原路退款，返回渠道退款单号
+func (mp *MockProviders) Refund(provider, outTradeNo, refundID string, amount float64) (string, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if err := mp.fail(provider, MockOpRefund); err != nil {
+		return "", err
+	}
+	trade, ok := mp.trades[mockKey(provider, outTradeNo)]
+	if !ok {
+		return "", ErrMockTradeNotFound
+	}
+	if trade.Status != MockTradePaid {
+		return "", fmt.Errorf("模拟交易 %s 未支付", outTradeNo)
+	}
+	if roundAmount(trade.Refunded+amount) > trade.Amount {
+		return "", fmt.Errorf("退款金额超过模拟交易 %s 的可退金额", outTradeNo)
+	}
+	trade.Refunded = roundAmount(trade.Refunded + amount)
+	return "MOCKRF" + strings.ToUpper(mockDigest(provider, outTradeNo, refundID)[:20]), nil
+}
+
+// Trades 返回全部模拟交易，最新的在前
+func (mp *MockProviders) Trades() []MockTrade {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	trades := make([]MockTrade, 0, len(mp.trades))
+	for _, trade := range mp.trades {
+		trades = append(trades, *trade)
+	}
+	sort.Slice(trades, func(i, j int) bool { return trades[i].CreatedAt.After(trades[j].CreatedAt) })
+	return trades
+}
+
+// CreateInvoice 模拟加密货币网关创建账单，收款地址由订单号确定性生成，法币计价的订单按 1:1 汇率换算
+func (mp *MockProviders) CreateInvoice(req *model.CryptoPaymentRequest) (*model.CryptoPayment, error) {
+	paymentID := "MOCKCR" + req.OrderID
+	amount, rate := req.Amount, 0.0
+	if req.FiatAmount > 0 {
+		amount, rate = req.FiatAmount, 1
+	}
+	trade, err := mp.CreateTrade("crypto", paymentID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := mockDigest("address", req.Network, paymentID)
+	address := "0x" + digest[:40]
+	if strings.EqualFold(req.Network, "TRC20") || strings.EqualFold(req.Network, "TRON") {
+		address = "T" + digest[:33]
+	}
+	expireMinutes := req.ExpireMinutes
+	if expireMinutes <= 0 {
+		expireMinutes = 30
+	}
+	expiredAt := trade.CreatedAt.Add(time.Duration(expireMinutes) * time.Minute).Format(time.RFC3339)
+	payment := &model.CryptoPayment{
+		PaymentID:    paymentID,
+		Address:      address,
+		Currency:     req.Currency,
+		Network:      req.Network,
+		Amount:       trade.Amount,
+		FiatCurrency: req.FiatCurrency,
+		FiatAmount:   req.FiatAmount,
+		Rate:         rate,
+		QRCode:       address,
+		ExpiredAt:    expiredAt,
+	}
+	if rate > 0 {
+		payment.RateSource = "mock"
+		payment.RateLockedUntil = expiredAt
+	}
+	return payment, nil
+}
+
+// QueryInvoice 模拟加密货币网关查询账单，已支付的账单视为已确认
+func (mp *MockProviders) QueryInvoice(paymentID string) (*model.CryptoPaymentStatus, error) {
+	trade, err := mp.QueryTrade("crypto", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	status := &model.CryptoPaymentStatus{PaymentID: paymentID}
+	switch trade.Status {
+	case MockTradePaid:
+		status.Status = "confirmed"
+		status.TxHash = "0x" + mockDigest("tx", paymentID)
+		status.Confirmations = 12
+	case MockTradeClosed:
+		status.Status = "expired"
+	default:
+		status.Status = "pending"
+	}
+	return status, nil
+}
+
+// createMockPayment 模拟渠道下单，参数校验与真实渠道一致。
+// 支付宝页面支付返回跳转链接、App 支付返回订单串、微信返回二维码内容，均为 mock:// 地址
+func (ps *PaymentService) createMockPayment(req *PaymentRequest) (*apierr.Response, error) {
+	var plan *InstallmentPlan
+	switch req.Method {
+	case "alipay":
+		if req.Scene != "" && req.Scene != "page" && req.Scene != "app" {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的支付宝支付场景: %s", req.Scene)), nil
+		}
+		if req.Installment != nil {
+			var err error
+			if plan, err = NewInstallmentPlan(req.Amount, req.Installment); err != nil {
+				return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+			}
+		}
+	case "wechat":
+		if req.Installment != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", "微信支付不支持花呗分期"), nil
+		}
+	default:
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持的支付方式: %s", req.Method)), nil
+	}
+
+	trade, err := ps.mock.CreateTrade(req.Method, req.OrderID, req.Amount)
+	ps.breakers[req.Method].Record(err)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建模拟支付失败: %v", err)), nil
+	}
+	if err := ps.recordPayment(req, plan); err != nil {
+		return nil, err
+	}
+
+	data := &PaymentData{
+		PaymentID:   req.OrderID,
+		ExpiredAt:   time.Now().Add(time.Duration(req.ExpireMinutes) * time.Minute).Format(time.RFC3339),
+		Installment: plan,
+	}
+	switch {
+	case req.Method == "wechat":
+		data.QRCode = trade.PayURL
+	case req.Scene == "app":
+		data.DeepLink = trade.PayURL
+	default:
+		data.RedirectURL = trade.PayURL
+	}
+	return apierr.SuccessResponse(data), nil
+}
+
+// syncMockPayment 按模拟交易状态同步支付记录
+func (ps *PaymentService) syncMockPayment(record *PaymentRecord) error {
+	trade, err := ps.mock.QueryTrade(record.Method, outTradeNo(record))
+	if errors.Is(err, ErrMockTradeNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("查询模拟交易失败: %w", err)
+	}
+	switch trade.Status {
+	case MockTradePaid:
+		return ps.markPaid(record, trade.TradeNo)
+	case MockTradeClosed:
+		return ps.markClosed(record)
+	}
+	return nil
+}
+
+// refundMockPayment 模拟原路退款并记账
+func (ps *PaymentService) refundMockPayment(record *PaymentRecord, refund *RefundRecord) error {
+	refundNo, err := ps.mock.Refund(record.Method, outTradeNo(record), refund.RefundID, refund.Amount)
+	if err != nil {
+		return fmt.Errorf("模拟退款失败: %w", err)
+	}
+	refund.ProviderRefundNo = refundNo
+	return ps.postRefundEntries(refund, "clearing:"+record.Method)
+}
+
+// MockPayRequest 模拟支付结果
+type MockPayRequest struct {
+	Result string `json:"result"` // paid（默认）/ closed
+}
+
+// SimulatePayment 模拟买家完成支付或交易关闭，与收到渠道通知后的处理相同
+func (ps *PaymentService) SimulatePayment(paymentID string, req *MockPayRequest) (*apierr.Response, error) {
+	status := MockTradePaid
+	switch req.Result {
+	case "", MockTradePaid:
+	case MockTradeClosed:
+		status = MockTradeClosed
+	default:
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的模拟结果: %s", req.Result)), nil
+	}
+
+	record, err := ps.store.Get(paymentID)
+	if errors.Is(err, ErrPaymentNotFound) {
+		return apierr.ErrorResponse("NOT_FOUND", err.Error()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ps.mock.Handles(record.Method) && record.Method != "crypto" {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("支付方式 %s 不由模拟渠道处理", record.Method)), nil
+	}
+
+	trade, err := ps.mock.Settle(record.Method, outTradeNo(record), status)
+	if err != nil {
+		return apierr.ErrorResponse("INVALID_STATUS", err.Error()), nil
+	}
+	if status == MockTradePaid {
+		err = ps.markPaid(record, trade.TradeNo)
+	} else {
+		err = ps.markClosed(record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 组合支付的外部渠道段推进后汇总到主记录
+	if record.ParentPaymentID != "" {
+		if parent, err := ps.store.Get(record.ParentPaymentID); err == nil {
+			if err := ps.syncSplitTender(parent); err != nil {
+				log.Printf("同步组合支付 %s 失败: %v", parent.PaymentID, err)
+			}
+		}
+	}
+
+	if latest, err := ps.store.Get(paymentID); err == nil {
+		record = latest
+	}
+	return apierr.SuccessResponse(gin.H{"paymentId": record.PaymentID, "status": record.Status, "trade": trade}), nil
+}
+
+// registerMockRoutes 注册模拟支付和预设失败接口，仅在启用模拟渠道时注册
+func registerMockRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	if ps.mock == nil {
+		return
+	}
+
+	api.POST("/mock/pay/:paymentId", func(c *gin.Context) {
+		var req MockPayRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+				return
+			}
+		}
+
+		resp, err := ps.SimulatePayment(c.Param("paymentId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin := api.Group("/admin")
+
+	admin.GET("/mock/trades", func(c *gin.Context) {
+		apierr.RespondOK(c, ps.mock.Trades())
+	})
+
+	admin.GET("/mock/failures", func(c *gin.Context) {
+		apierr.RespondOK(c, ps.mock.Failures())
+	})
+
+	admin.POST("/mock/failures", func(c *gin.Context) {
+		var failure MockFailure
+		if err := c.ShouldBindJSON(&failure); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		switch failure.Operation {
+		case MockOpCreate, MockOpQuery, MockOpRefund:
+		default:
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", fmt.Sprintf("不支持的模拟操作: %s", failure.Operation))
+			return
+		}
+		ps.mock.SetFailure(&failure)
+		apierr.RespondOK(c, ps.mock.Failures())
+	})
+
+	admin.DELETE("/mock/failures", func(c *gin.Context) {
+		ps.mock.ClearFailures()
+		apierr.RespondOK(c, ps.mock.Failures())
+	})
+}
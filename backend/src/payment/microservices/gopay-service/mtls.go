@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"gopay-service/internal/httpmw"
+)
+
+// 内部服务调用的下单、退款写接口，预授权的请款和撤销同样转移资金，归入退款一组。退款审批由管理后台发起，走 JWT 认证，不在此列
+var (
+	createRoutes = []string{"/api/v1/payment/create", "/api/v1/payment/authorize", "/api/v1/payment/split", "/api/v1/wallet/topup"}
+	refundRoutes = []string{"/api/v1/refunds", "/api/v1/payment/refund", "/api/v1/payment/refund/batch", "/api/v1/payment/capture", "/api/v1/payment/void"}
+)
+
+// newClientCertAuth 按 MTLS_CREATE_CLIENTS/MTLS_REFUND_CLIENTS 限制可调用下单和退款接口的内部服务
+func newClientCertAuth() *httpmw.ClientCertAuth {
+	return httpmw.NewClientCertAuth(
+		httpmw.CertPolicy{
+			Name:     "create",
+			Paths:    createRoutes,
+			Services: splitList(os.Getenv("MTLS_CREATE_CLIENTS")),
+		},
+		httpmw.CertPolicy{
+			Name:     "refund",
+			Paths:    refundRoutes,
+			Services: splitList(os.Getenv("MTLS_REFUND_CLIENTS")),
+		},
+	)
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NonceStore 已使用的请求随机数，用于拒绝重放的签名请求
+type NonceStore interface {
+	// Consume 登记随机数，首次出现返回 true，ttl 内再次出现返回 false
+	Consume(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// NewNonceStore 配置 REDIS_URL 时使用 Redis，多实例部署共享已用随机数；否则使用进程内存储
+func NewNonceStore() NonceStore {
+	if client := sharedRedis(); client != nil {
+		return &redisNonceStore{client: client}
+	}
+	if currentEnvironment() == "production" {
+		log.Printf("【警告】未配置 REDIS_URL，请求随机数只在本实例内去重")
+	}
+	return NewMemoryNonceStore()
+}
+
+// redisNonceStore 以 SET NX PX 登记随机数，过期由 Redis 清理
+type redisNonceStore struct {
+	client *redis.Client
+}
+
+func (s *redisNonceStore) Consume(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, "gopay:nonce:"+key, 1, ttl).Result()
+}
+
+// memoryNonceStore 进程内的随机数存储，登记时顺带清理过期项
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{expires: make(map[string]time.Time)}
+}
+
+func (s *memoryNonceStore) Consume(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > time.Minute {
+		for k, exp := range s.expires {
+			if now.After(exp) {
+				delete(s.expires, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	if exp, ok := s.expires[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.expires[key] = now.Add(ttl)
+	return true, nil
+}
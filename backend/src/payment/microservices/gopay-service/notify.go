@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/alipay"
+	"github.com/go-pay/gopay/wechat"
+)
+
+var ErrNotifySign = errors.New("异步通知验签失败")
+
+// findByTradeNo 按渠道订单号查找支付记录，延长有效期后的订单号带 _X1 后缀
+func (ps *PaymentService) findByTradeNo(tradeNo string) (*PaymentRecord, error) {
+	if record, err := ps.store.Get(tradeNo); err == nil {
+		return record, nil
+	}
+	return ps.store.Get(strings.TrimSuffix(tradeNo, "_X1"))
+}
+
+// verifyNotify 使用支付创建时的密钥验签，该密钥已过重叠期时使用当前启用密钥。
+// verifier 返回该密钥集中用于验签的密钥及验签函数，密钥为空表示未配置
+func (ps *PaymentService) verifyNotify(provider string, record *PaymentRecord, verifier func(KeySet) (string, func() (bool, error))) error {
+	var lastErr error
+	configured := false
+	for _, ks := range ps.credentials.VerifyKeys(provider, record.CredentialID) {
+		key, verify := verifier(ks)
+		if key == "" {
+			continue
+		}
+		configured = true
+		ok, err := verify()
+		if err == nil && ok {
+			return nil
+		}
+		lastErr = err
+	}
+	if !configured {
+		// 验签是强制的；仅非生产环境可用 NOTIFY_SKIP_SIGNATURE=true 联调未签名的通知
+		if os.Getenv("NOTIFY_SKIP_SIGNATURE") == "true" && currentEnvironment() != "production" {
+			log.Printf("【警告】未配置 %s 验签密钥，跳过通知验签", provider)
+			return nil
+		}
+		return fmt.Errorf("%w: 未配置 %s 验签密钥", ErrNotifySign, provider)
+	}
+	return fmt.Errorf("%w: %v", ErrNotifySign, lastErr)
+}
+
+// HandleAlipayNotify 处理支付宝异步通知：验签、写回回传参数、推进支付状态
+func (ps *PaymentService) HandleAlipayNotify(bm gopay.BodyMap) error {
+	record, err := ps.findByTradeNo(bm.GetString("out_trade_no"))
+	if err != nil {
+		return err
+	}
+	if err := ps.verifyNotify("alipay", record, func(ks KeySet) (string, func() (bool, error)) {
+		return ks.PublicKey, func() (bool, error) { return alipay.VerifySign(ks.PublicKey, bm) }
+	}); err != nil {
+		return err
+	}
+	receipt := &NotifyReceipt{
+		Provider:        "alipay",
+		ProviderTradeNo: bm.GetString("trade_no"),
+		NotifyType:      bm.GetString("trade_status"),
+		PaymentID:       record.PaymentID,
+	}
+	return ps.withPaymentLock(record, func() error {
+		return ps.dedupNotify(receipt, func() error {
+			if applyPassback(record, bm.GetString("passback_params")) {
+				if err := ps.store.Save(record); err != nil {
+					return err
+				}
+			}
+
+			switch bm.GetString("trade_status") {
+			case "TRADE_SUCCESS", "TRADE_FINISHED":
+				captureAlipayForex(record, alipayForexFromNotify(bm))
+				if err := ps.applyPaid(record, bm.GetString("trade_no")); err != nil {
+					return err
+				}
+				ps.scoreAfterNotify(record.PaymentID)
+			case "TRADE_CLOSED":
+				return ps.applyClosed(record)
+			}
+			return nil
+		})
+	})
+}
+
+// HandleWechatNotify 处理微信支付异步通知
+func (ps *PaymentService) HandleWechatNotify(bm gopay.BodyMap) error {
+	record, err := ps.findByTradeNo(bm.GetString("out_trade_no"))
+	if err != nil {
+		return err
+	}
+	if err := ps.verifyNotify("wechat", record, func(ks KeySet) (string, func() (bool, error)) {
+		return ks.APIKey, func() (bool, error) { return wechat.VerifySign(ks.APIKey, wechat.SignType_MD5, bm) }
+	}); err != nil {
+		return err
+	}
+	receipt := &NotifyReceipt{
+		Provider:        "wechat",
+		ProviderTradeNo: bm.GetString("transaction_id"),
+		NotifyType:      bm.GetString("result_code"),
+		PaymentID:       record.PaymentID,
+	}
+	return ps.withPaymentLock(record, func() error {
+		return ps.dedupNotify(receipt, func() error {
+			if applyPassback(record, bm.GetString("attach")) {
+				if err := ps.store.Save(record); err != nil {
+					return err
+				}
+			}
+
+			if bm.GetString("return_code") == "SUCCESS" && bm.GetString("result_code") == "SUCCESS" {
+				if err := ps.applyPaid(record, bm.GetString("transaction_id")); err != nil {
+					return err
+				}
+				ps.scoreAfterNotify(record.PaymentID)
+			}
+			return nil
+		})
+	})
+}
+
+// reportNotifyError 上报通知处理失败。验签失败已写入审计日志，不重复上报
+func reportNotifyError(provider string, bm gopay.BodyMap, err error) {
+	if errors.Is(err, ErrNotifySign) {
+		return
+	}
+	reportError(err, map[string]string{
+		"component":  "notify",
+		"provider":   provider,
+		"payment_id": strings.TrimSuffix(bm.GetString("out_trade_no"), "_X1"),
+	})
+}
+
+// notifyContentTypes 各渠道通知报文的 Content-Type，回放时按此构造请求
+var notifyContentTypes = map[string]string{
+	"alipay": "application/x-www-form-urlencoded",
+	"wechat": "text/xml",
+}
+
+var notifyProviderNames = map[string]string{
+	"alipay": "支付宝",
+	"wechat": "微信",
+}
+
+// parseNotify 按渠道解析通知报文
+func parseNotify(provider string, r *http.Request) (gopay.BodyMap, error) {
+	switch provider {
+	case "alipay":
+		return alipay.ParseNotifyToBodyMap(r)
+	case "wechat":
+		return wechat.ParseNotifyToBodyMap(r)
+	default:
+		return nil, fmt.Errorf("不支持的通知渠道: %s", provider)
+	}
+}
+
+// processNotify 解析并处理渠道通知，通知接口和回放共用同一流程
+func (ps *PaymentService) processNotify(provider string, r *http.Request) (gopay.BodyMap, error) {
+	bm, err := parseNotify(provider, r)
+	if err != nil {
+		return nil, err
+	}
+	if provider == "alipay" {
+		return bm, ps.HandleAlipayNotify(bm)
+	}
+	return bm, ps.HandleWechatNotify(bm)
+}
+
+// readNotifyPayload 读取原始报文并放回请求体，供审计留存和回放
+func readNotifyPayload(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxNotifyPayload))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body)
+}
+
+// maxNotifyPayload 留存的通知报文上限，渠道通知远小于此
+const maxNotifyPayload = 64 << 10
+
+// registerNotifyRoutes 注册渠道异步通知接口，响应格式按渠道要求返回。
+// 来源不在白名单或验签失败的请求连同原始报文写入审计日志；
+// NOTIFY_AUDIT_PAYLOADS=true 时每条通知都留存报文，便于按审计记录回放
+func registerNotifyRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	guard := NewNotifyGuard(ps.audit, "alipay", "wechat")
+	capture := os.Getenv("NOTIFY_AUDIT_PAYLOADS") == "true"
+
+	handle := func(c *gin.Context, provider string) error {
+		payload := readNotifyPayload(c)
+		bm, err := ps.processNotify(provider, c.Request)
+		if errors.Is(err, ErrNotifySign) {
+			ps.auditSignatureFailure(c, guard, provider, bm.GetString("out_trade_no"), payload, err)
+		} else if capture {
+			ps.auditNotifyPayload(c, guard, provider, bm.GetString("out_trade_no"), payload, err)
+		}
+		if err != nil {
+			log.Printf("处理%s通知失败: %v", notifyProviderNames[provider], err)
+			reportNotifyError(provider, bm, err)
+		}
+		return err
+	}
+
+	api.POST("/payment/notify/alipay", guard.Middleware("alipay"), ps.chaos.NotifyMiddleware("alipay"), func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		if err := handle(c, "alipay"); err != nil {
+			c.String(http.StatusOK, "fail")
+			return
+		}
+		c.String(http.StatusOK, "success")
+	})
+
+	api.POST("/payment/notify/wechat", guard.Middleware("wechat"), ps.chaos.NotifyMiddleware("wechat"), func(c *gin.Context) {
+		c.Header("Content-Type", "application/xml; charset=utf-8")
+		rsp := &wechat.NotifyResponse{ReturnCode: gopay.SUCCESS, ReturnMsg: gopay.OK}
+		if err := handle(c, "wechat"); err != nil {
+			rsp = &wechat.NotifyResponse{ReturnCode: gopay.FAIL, ReturnMsg: err.Error()}
+		}
+		c.String(http.StatusOK, rsp.ToXmlString())
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// NotifyGuard 渠道异步通知的来源校验：按渠道限制来源 IP/网段，被拒绝的请求写入审计日志。
+// 来源 IP 默认取 TCP 连接对端；经负载均衡转发时，只有对端属于 NOTIFY_TRUSTED_PROXIES 才读取 X-Forwarded-For，
+// 避免伪造请求头绕过白名单
+type NotifyGuard struct {
+	allowlists map[string][]*net.IPNet
+	trusted    []*net.IPNet
+	audit      *AuditLog
+}
+
+// NewNotifyGuard 读取 NOTIFY_ALLOWED_IPS_<PROVIDER>，如 NOTIFY_ALLOWED_IPS_ALIPAY=110.75.0.0/16,203.209.230.1。
+// 未配置的渠道不限制来源，仅依赖验签
+func NewNotifyGuard(audit *AuditLog, providers ...string) *NotifyGuard {
+	ng := &NotifyGuard{allowlists: make(map[string][]*net.IPNet), audit: audit}
+	for _, provider := range providers {
+		nets, err := parseIPNets(os.Getenv("NOTIFY_ALLOWED_IPS_" + strings.ToUpper(provider)))
+		if err != nil {
+			log.Printf("解析 %s 通知来源白名单失败: %v", provider, err)
+			continue
+		}
+		if len(nets) == 0 {
+			if currentEnvironment() == "production" {
+				log.Printf("【警告】未配置 %s 通知来源白名单", provider)
+			}
+			continue
+		}
+		ng.allowlists[provider] = nets
+	}
+	trusted, err := parseIPNets(os.Getenv("NOTIFY_TRUSTED_PROXIES"))
+	if err != nil {
+		log.Printf("解析 NOTIFY_TRUSTED_PROXIES 失败: %v", err)
+	}
+	ng.trusted = trusted
+	return ng
+}
+
+// parseIPNets 解析逗号分隔的 IP 或 CIDR，单个 IP 视为 /32 或 /128
+func parseIPNets(raw string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range splitList(raw) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP 通知请求的真实来源。对端是受信代理时，从 X-Forwarded-For 右侧起取第一个非代理地址
+func (ng *NotifyGuard) sourceIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(ng.trusted, ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(ng.trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// Middleware 校验通知来源，不在白名单内时返回 403
+func (ng *NotifyGuard) Middleware(provider string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowlist, ok := ng.allowlists[provider]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		ip := ng.sourceIP(c.Request)
+		if ip != nil && containsIP(allowlist, ip) {
+			c.Next()
+			return
+		}
+
+		log.Printf("【安全】拒绝来自 %s 的 %s 通知：来源不在白名单", ip, provider)
+		ng.audit.Record(AuditEntry{
+			Category: AuditNotify,
+			Action:   "notify.ip_denied",
+			Provider: provider,
+			SourceIP: ip.String(),
+			Detail:   "来源不在渠道通知白名单",
+		})
+		apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", "通知来源不在白名单")
+		c.Abort()
+	}
+}
+
+// auditSignatureFailure 记录验签失败的通知及原始报文，关联到支付时同时写入该支付的操作记录
+func (ps *PaymentService) auditSignatureFailure(c *gin.Context, guard *NotifyGuard, provider, tradeNo, payload string, err error) {
+	ip := guard.sourceIP(c.Request)
+	var paymentID string
+	if record, err := ps.findByTradeNo(tradeNo); err == nil {
+		paymentID = record.PaymentID
+	}
+	ps.audit.Record(AuditEntry{
+		Category:  AuditNotify,
+		Action:    "notify.signature_invalid",
+		Provider:  provider,
+		SourceIP:  ip.String(),
+		PaymentID: paymentID,
+		Detail:    err.Error(),
+		Payload:   payload,
+	})
+	if paymentID != "" {
+		ps.actions.Record(paymentID, ip.String(), "notify.rejected", fmt.Sprintf("%s 通知验签失败", provider))
+	}
+}
+
+// auditNotifyPayload 留存收到的通知报文及处理结果
+func (ps *PaymentService) auditNotifyPayload(c *gin.Context, guard *NotifyGuard, provider, tradeNo, payload string, err error) {
+	var paymentID string
+	if record, err := ps.findByTradeNo(tradeNo); err == nil {
+		paymentID = record.PaymentID
+	}
+	detail := "success"
+	if err != nil {
+		detail = err.Error()
+	}
+	ps.audit.Record(AuditEntry{
+		Category:  AuditNotify,
+		Action:    "notify.received",
+		Provider:  provider,
+		SourceIP:  guard.sourceIP(c.Request).String(),
+		PaymentID: paymentID,
+		Detail:    detail,
+		Payload:   payload,
+	})
+}
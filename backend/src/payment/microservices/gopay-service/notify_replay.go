@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// NotifyFixture 一条待回放的渠道通知
+type NotifyFixture struct {
+	Name     string             `json:"name,omitempty"`
+	Provider string             `json:"provider"` // alipay | wechat
+	Payload  string             `json:"payload"`  // 原始报文：支付宝为表单编码，微信为 XML
+	Expect   *NotifyExpectation `json:"expect,omitempty"`
+}
+
+// NotifyExpectation 回放的预期结果，未填写的项不校验
+type NotifyExpectation struct {
+	Accepted *bool  `json:"accepted,omitempty"` // 是否应处理成功
+	Error    string `json:"error,omitempty"`    // 失败时错误信息应包含的内容
+	Status   string `json:"status,omitempty"`   // 回放后支付记录应处于的状态
+}
+
+// NotifyReplayRequest 回放请求，可同时提交报文和审计记录编号
+type NotifyReplayRequest struct {
+	Fixtures []NotifyFixture `json:"fixtures"`
+	AuditIDs []string        `json:"auditIds"`
+}
+
+// NotifyReplayResult 单条通知的回放结果
+type NotifyReplayResult struct {
+	Name         string   `json:"name,omitempty"`
+	Provider     string   `json:"provider"`
+	AuditID      string   `json:"auditId,omitempty"`
+	PaymentID    string   `json:"paymentId,omitempty"`
+	Accepted     bool     `json:"accepted"`
+	Error        string   `json:"error,omitempty"`
+	StatusBefore string   `json:"statusBefore,omitempty"`
+	StatusAfter  string   `json:"statusAfter,omitempty"`
+	Passed       *bool    `json:"passed,omitempty"` // 有预期结果时是否全部符合
+	Mismatches   []string `json:"mismatches,omitempty"`
+}
+
+// NotifyReplaySummary 一次回放的汇总
+type NotifyReplaySummary struct {
+	Total   int                   `json:"total"`
+	Failed  int                   `json:"failed"` // 与预期不符的条数
+	Results []*NotifyReplayResult `json:"results"`
+}
+
+// ReplayNotifies 把通知报文送入与通知接口相同的处理流程：真实验签、去重和状态推进。
+// 不经过来源白名单，回放会真实改变支付状态，应在测试或预发环境使用
+func (ps *PaymentService) ReplayNotifies(operator string, req *NotifyReplayRequest) (*apierr.Response, error) {
+	fixtures := append([]NotifyFixture(nil), req.Fixtures...)
+	auditIDs := make([]string, len(fixtures))
+	for _, id := range req.AuditIDs {
+		entry, ok := ps.audit.Get(id)
+		if !ok || entry.Category != AuditNotify || entry.Payload == "" {
+			return apierr.ErrorResponse("NOT_FOUND", fmt.Sprintf("审计记录 %s 不存在或未保存通知报文", id)), nil
+		}
+		fixtures = append(fixtures, NotifyFixture{Name: entry.Action, Provider: entry.Provider, Payload: entry.Payload})
+		auditIDs = append(auditIDs, id)
+	}
+	if len(fixtures) == 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "fixtures 和 auditIds 不能同时为空"), nil
+	}
+	for _, fixture := range fixtures {
+		if _, ok := notifyContentTypes[fixture.Provider]; !ok {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的通知渠道: %s", fixture.Provider)), nil
+		}
+	}
+
+	summary := &NotifyReplaySummary{Total: len(fixtures)}
+	for i, fixture := range fixtures {
+		result, err := ps.replayNotify(fixture)
+		if err != nil {
+			return nil, err
+		}
+		result.AuditID = auditIDs[i]
+		if result.Passed != nil && !*result.Passed {
+			summary.Failed++
+		}
+		summary.Results = append(summary.Results, result)
+
+		ps.audit.Record(AuditEntry{
+			Category:  AuditNotify,
+			Action:    "notify.replayed",
+			Provider:  fixture.Provider,
+			PaymentID: result.PaymentID,
+			Detail:    fmt.Sprintf("%s 回放，结果: %t %s", operator, result.Accepted, result.Error),
+		})
+	}
+	return apierr.SuccessResponse(summary), nil
+}
+
+func (ps *PaymentService) replayNotify(fixture NotifyFixture) (*NotifyReplayResult, error) {
+	result := &NotifyReplayResult{Name: fixture.Name, Provider: fixture.Provider}
+
+	// 先解析一次取出订单号，记录回放前的状态
+	var before *PaymentRecord
+	if bm, err := parseNotify(fixture.Provider, newNotifyRequest(fixture)); err == nil {
+		if record, err := ps.findByTradeNo(bm.GetString("out_trade_no")); err == nil {
+			before = record
+			result.PaymentID, result.StatusBefore = record.PaymentID, record.Status
+		}
+	}
+
+	_, err := ps.processNotify(fixture.Provider, newNotifyRequest(fixture))
+	result.Accepted = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if before != nil {
+		if latest, err := ps.store.Get(before.PaymentID); err == nil {
+			result.StatusAfter = latest.Status
+		}
+	}
+
+	if expect := fixture.Expect; expect != nil {
+		if expect.Accepted != nil && *expect.Accepted != result.Accepted {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("accepted 预期 %t，实际 %t", *expect.Accepted, result.Accepted))
+		}
+		if expect.Error != "" && !strings.Contains(result.Error, expect.Error) {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("error 预期包含 %q，实际 %q", expect.Error, result.Error))
+		}
+		if expect.Status != "" && expect.Status != result.StatusAfter {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("status 预期 %s，实际 %s", expect.Status, result.StatusAfter))
+		}
+		passed := len(result.Mismatches) == 0
+		result.Passed = &passed
+	}
+	return result, nil
+}
+
+// newNotifyRequest 以渠道通知的格式构造请求
+func newNotifyRequest(fixture NotifyFixture) *http.Request {
+	return &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: "/payment/notify/" + fixture.Provider},
+		Header: http.Header{"Content-Type": {notifyContentTypes[fixture.Provider]}},
+		Body:   io.NopCloser(strings.NewReader(fixture.Payload)),
+	}
+}
+
+// registerNotifyReplayRoutes 注册通知回放接口
+func registerNotifyReplayRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	admin.POST("/notify/replay", func(c *gin.Context) {
+		var req NotifyReplayRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		operator := c.ClientIP()
+		if principal := principalFromRequest(c); principal != nil {
+			operator = principal.Name
+		}
+
+		resp, err := ps.ReplayNotifies(operator, &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
+
+// runNotifyReplayCLI 命令行回放：读取通知报文文件，提交到运行中服务的回放接口并打印结果。
+// 文件内容为单个 NotifyFixture 或其数组，参数可以是文件或目录（读取目录下全部 .json）。
+// 任一条与预期不符或请求失败时返回非零退出码，可直接用于 CI
+//
+//	gopay-service replay-notify -url http://localhost:8080 -token $ADMIN_JWT fixtures/notify
+//	gopay-service replay-notify -token $ADMIN_JWT -audit AU1700000000000000001234
+func runNotifyReplayCLI(args []string) int {
+	fs := flag.NewFlagSet("replay-notify", flag.ContinueOnError)
+	baseURL := fs.String("url", envString("REPLAY_URL", "http://localhost:8080"), "服务地址")
+	token := fs.String("token", os.Getenv("REPLAY_TOKEN"), "管理接口的 Bearer 令牌")
+	auditIDs := fs.String("audit", "", "按审计记录编号回放，逗号分隔")
+	timeout := fs.Duration("timeout", 30*time.Second, "请求超时")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 && *auditIDs == "" {
+		fmt.Fprintln(os.Stderr, "用法: gopay-service replay-notify [-url 地址] [-token 令牌] [-audit 编号,...] <文件或目录>...")
+		return 2
+	}
+
+	req := NotifyReplayRequest{AuditIDs: splitList(*auditIDs)}
+	for _, path := range fs.Args() {
+		fixtures, err := loadNotifyFixtures(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取 %s 失败: %v\n", path, err)
+			return 1
+		}
+		req.Fixtures = append(req.Fixtures, fixtures...)
+	}
+
+	body, err := json.Marshal(&req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "编码请求失败: %v\n", err)
+		return 1
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimRight(*baseURL, "/")+"/api/v1/admin/notify/replay", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "构造请求失败: %v\n", err)
+		return 1
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if *token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	httpClient := &http.Client{Timeout: *timeout}
+	if tlsConfig, err := httpmw.LoadTLSConfig().ClientTLSConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载客户端证书失败: %v\n", err)
+		return 1
+	} else if tlsConfig != nil {
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "请求回放接口失败: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	summary := new(NotifyReplaySummary)
+	envelope := apierr.Response{Data: summary}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		fmt.Fprintf(os.Stderr, "解析回放结果失败（HTTP %d）: %v\n", resp.StatusCode, err)
+		return 1
+	}
+	if !envelope.Success {
+		fmt.Fprintf(os.Stderr, "回放失败(%s): %s\n", envelope.Code, envelope.Message)
+		return 1
+	}
+
+	for _, result := range summary.Results {
+		verdict := "-"
+		if result.Passed != nil {
+			verdict = "PASS"
+			if !*result.Passed {
+				verdict = "FAIL"
+			}
+		}
+		fmt.Printf("%-4s %-8s %-30s accepted=%t status=%s->%s %s\n",
+			verdict, result.Provider, result.Name, result.Accepted, result.StatusBefore, result.StatusAfter, result.Error)
+		for _, mismatch := range result.Mismatches {
+			fmt.Printf("       %s\n", mismatch)
+		}
+	}
+	fmt.Printf("共 %d 条，%d 条与预期不符\n", summary.Total, summary.Failed)
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadNotifyFixtures 读取报文文件或目录，未填写名称的报文以文件名命名
+func loadNotifyFixtures(path string) ([]NotifyFixture, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return nil, err
+		}
+	}
+
+	var fixtures []NotifyFixture
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var batch []NotifyFixture
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(data, &batch)
+		} else {
+			var single NotifyFixture
+			err = json.Unmarshal(data, &single)
+			batch = []NotifyFixture{single}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i := range batch {
+			if batch[i].Name == "" {
+				batch[i].Name = strings.TrimSuffix(filepath.Base(file), ".json")
+			}
+		}
+		fixtures = append(fixtures, batch...)
+	}
+	return fixtures, nil
+}
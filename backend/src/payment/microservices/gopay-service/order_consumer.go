@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// OrderCreatedEvent 订单服务发布的订单创建事件，字段与订单服务的 OrderCreatedEvent 一致。
+// paymentMethod、currency 为可选扩展字段，未携带时使用 ORDER_EVENTS_DEFAULT_METHOD
+type OrderCreatedEvent struct {
+	EventID       string                 `json:"eventId"`
+	OrderID       int64                  `json:"orderId"`
+	OrderNumber   string                 `json:"orderNumber"`
+	UserID        int64                  `json:"userId"`
+	TotalAmount   float64                `json:"totalAmount"`
+	Currency      string                 `json:"currency"`
+	PaymentMethod string                 `json:"paymentMethod"`
+	Timestamp     string                 `json:"timestamp"`
+	Metadata      map[string]interface{} `json:"metadata"`
+}
+
+// OrderEventConsumer 以消费组订阅订单创建事件并自动创建支付，结账时不必再同步调用下单接口。
+// 逐条处理，处理完成后才确认；重复投递的事件因支付编号即订单号而被跳过
+type OrderEventConsumer struct {
+	payments      *PaymentService
+	bus           EventBus
+	topic         string
+	group         string
+	dlqTopic      string
+	defaultMethod string
+	maxAttempts   int
+}
+
+func NewOrderEventConsumer(payments *PaymentService, bus EventBus) *OrderEventConsumer {
+	return &OrderEventConsumer{
+		payments:      payments,
+		bus:           bus,
+		topic:         envString("ORDER_EVENTS_TOPIC", "orders.created"),
+		group:         envString("ORDER_EVENTS_GROUP", "gopay-payment-intents"),
+		dlqTopic:      os.Getenv("ORDER_EVENTS_DLQ_TOPIC"),
+		defaultMethod: os.Getenv("ORDER_EVENTS_DEFAULT_METHOD"),
+		maxAttempts:   envInt("ORDER_EVENTS_MAX_ATTEMPTS", 5),
+	}
+}
+
+// Run 消费订单事件直到 ctx 取消
+func (oc *OrderEventConsumer) Run(ctx context.Context) {
+	log.Printf("订阅订单事件 %s，消费组 %s", oc.topic, oc.group)
+	err := oc.bus.Subscribe(ctx, oc.topic, oc.group, func(ctx context.Context, msg BusMessage) error {
+		err := oc.handle(ctx, msg)
+		if err != nil && ctx.Err() == nil {
+			oc.deadLetter(ctx, msg, err)
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("订阅订单事件失败: %v", err)
+	}
+}
+
+// handle 处理一条订单事件，返回错误表示事件无法处理，需要人工介入
+func (oc *OrderEventConsumer) handle(ctx context.Context, msg BusMessage) error {
+	var event OrderCreatedEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return fmt.Errorf("事件格式错误: %w", err)
+	}
+	req := oc.paymentRequest(&event)
+	if req.Method == "" {
+		log.Printf("订单 %s 未指定支付方式，跳过自动下单", req.OrderID)
+		return nil
+	}
+	if req.OrderID == "" || req.Amount <= 0 {
+		return fmt.Errorf("事件 %s 缺少订单号或金额", event.EventID)
+	}
+	if _, err := oc.payments.store.Get(req.OrderID); err == nil {
+		return nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := oc.payments.CreatePayment(req)
+		if err == nil && resp.Success {
+			log.Printf("已根据订单事件 %s 创建支付 %s", event.EventID, req.OrderID)
+			return nil
+		}
+
+		retry := true
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Code + ": " + resp.Message
+			switch resp.Code {
+			case "DUPLICATE_ORDER":
+				return nil
+			case "RETRY_LATER", "PROVIDER_MAINTENANCE":
+			default:
+				retry = false
+			}
+		}
+		if !retry || attempt >= oc.maxAttempts {
+			return fmt.Errorf("订单 %s 创建支付失败: %s", req.OrderID, reason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+}
+
+func (oc *OrderEventConsumer) paymentRequest(event *OrderCreatedEvent) *PaymentRequest {
+	orderID := event.OrderNumber
+	if orderID == "" && event.OrderID != 0 {
+		orderID = strconv.FormatInt(event.OrderID, 10)
+	}
+	method := event.PaymentMethod
+	if method == "" {
+		if m, ok := event.Metadata["paymentMethod"].(string); ok {
+			method = m
+		}
+	}
+	if method == "" {
+		method = oc.defaultMethod
+	}
+
+	metadata := map[string]interface{}{"source": "order.created", "eventId": event.EventID}
+	for k, v := range event.Metadata {
+		if _, exists := metadata[k]; !exists {
+			metadata[k] = v
+		}
+	}
+	req := &PaymentRequest{
+		Method:   method,
+		OrderID:  orderID,
+		Amount:   event.TotalAmount,
+		Currency: event.Currency,
+		Subject:  "订单支付-" + orderID,
+		Metadata: metadata,
+	}
+	if event.UserID != 0 {
+		req.UserID = strconv.FormatInt(event.UserID, 10)
+		req.Body = fmt.Sprintf("用户%d的订单支付", event.UserID)
+	}
+	return req
+}
+
+// deadLetter 把无法处理的事件连同失败原因写入死信主题，未配置时只记录日志
+func (oc *OrderEventConsumer) deadLetter(ctx context.Context, msg BusMessage, cause error) {
+	if oc.dlqTopic == "" {
+		return
+	}
+	headers := map[string]string{"error": cause.Error(), "originalTopic": msg.Topic}
+	for k, v := range msg.Headers {
+		if _, exists := headers[k]; !exists {
+			headers[k] = v
+		}
+	}
+	if err := oc.bus.Publish(ctx, BusMessage{Topic: oc.dlqTopic, Key: msg.Key, Value: msg.Value, Headers: headers}); err != nil {
+		log.Printf("写入死信主题 %s 失败: %v", oc.dlqTopic, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// 渠道回传参数长度上限：支付宝 passback_params 512 字符，微信 attach 127 字节
+const (
+	alipayPassbackLimit = 512
+	wechatAttachLimit   = 127
+)
+
+// passbackPrefix 回传参数写回 Metadata 时使用的键前缀，避免覆盖下单时的原始元数据
+const passbackPrefix = "passback."
+
+// PassbackConfig 需要随订单透传给渠道、并在异步通知中原样带回的元数据键
+type PassbackConfig struct {
+	keys []string
+}
+
+// NewPassbackConfig 从 PASSBACK_METADATA_KEYS 读取透传键，逗号分隔，按配置顺序决定超长时的保留优先级
+func NewPassbackConfig() *PassbackConfig {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("PASSBACK_METADATA_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return &PassbackConfig{keys: keys}
+}
+
+// Encode 把选中的元数据编码为 k=v&k=v 形式，超出 limit 的键按配置顺序从后往前丢弃
+func (pc *PassbackConfig) Encode(metadata map[string]interface{}, limit int, escape bool) string {
+	if pc == nil || len(pc.keys) == 0 || len(metadata) == 0 {
+		return ""
+	}
+
+	values := url.Values{}
+	for _, key := range pc.keys {
+		value, ok := metadata[key]
+		if !ok || value == nil {
+			continue
+		}
+		values.Set(key, fmt.Sprint(value))
+
+		if len(pc.render(values, escape)) > limit {
+			values.Del(key)
+			log.Printf("回传参数超出 %d 字符上限，已丢弃元数据键 %s", limit, key)
+		}
+	}
+	return pc.render(values, escape)
+}
+
+// render 按配置顺序拼接，url.Values.Encode 会按字母排序打乱优先级
+func (pc *PassbackConfig) render(values url.Values, escape bool) string {
+	parts := make([]string, 0, len(values))
+	for _, key := range pc.keys {
+		if value, ok := values[key]; ok {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value[0]))
+		}
+	}
+	encoded := strings.Join(parts, "&")
+	if escape {
+		// 支付宝要求 passback_params 整体再做一次 UrlEncode
+		encoded = url.QueryEscape(encoded)
+	}
+	return encoded
+}
+
+// decodePassback 解析通知中的回传参数，兼容渠道已解码和未解码两种情况
+func decodePassback(raw string) map[string]string {
+	if raw == "" {
+		return nil
+	}
+	if !strings.Contains(raw, "=") {
+		if unescaped, err := url.QueryUnescape(raw); err == nil {
+			raw = unescaped
+		}
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		log.Printf("解析回传参数失败 %q: %v", raw, err)
+		return nil
+	}
+
+	result := make(map[string]string, len(values))
+	for key := range values {
+		result[key] = values.Get(key)
+	}
+	return result
+}
+
+// applyPassback 把通知带回的参数写入支付记录元数据
+func applyPassback(record *PaymentRecord, raw string) bool {
+	params := decodePassback(raw)
+	if len(params) == 0 {
+		return false
+	}
+	if record.Metadata == nil {
+		record.Metadata = make(map[string]interface{}, len(params))
+	}
+	for key, value := range params {
+		record.Metadata[passbackPrefix+key] = value
+	}
+	return true
+}
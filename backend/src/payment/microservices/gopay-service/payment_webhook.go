@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// PaymentWebhookRequest 下单时为单笔支付追加的一次性回调地址，Events 为空时接收该支付的全部事件
+type PaymentWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	Format string   `json:"format"` // legacy | cloudevents
+}
+
+// PaymentWebhook 单笔支付的回调目标，与租户订阅叠加推送，签名和投递方式相同
+type PaymentWebhook struct {
+	WebhookID string   `json:"webhookId"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events,omitempty"`
+	Format    string   `json:"format,omitempty"`
+	Secret    string   `json:"-"`
+}
+
+// CreatedPaymentWebhook 下单结果中的回调目标，签名密钥仅在下单时返回一次
+type CreatedPaymentWebhook struct {
+	WebhookID string `json:"webhookId"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret"`
+}
+
+// subscription 转换为订阅，复用租户订阅的投递和推送记录
+func (pw *PaymentWebhook) subscription(tenantID string) *WebhookSubscription {
+	return &WebhookSubscription{
+		SubscriptionID: pw.WebhookID,
+		TenantID:       tenantID,
+		URL:            pw.URL,
+		Events:         pw.Events,
+		Format:         pw.Format,
+		Secret:         pw.Secret,
+	}
+}
+
+// preparePaymentWebhooks 校验下单请求中的回调地址并生成签名密钥，由 recordPayment 保存到支付记录
+func (ps *PaymentService) preparePaymentWebhooks(req *PaymentRequest) *apierr.Response {
+	if len(req.Webhooks) == 0 {
+		return nil
+	}
+	if limit := envInt("PAYMENT_WEBHOOK_LIMIT", 3); len(req.Webhooks) > limit {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("单笔支付最多追加 %d 个回调地址", limit))
+	}
+
+	req.webhookTargets = make([]PaymentWebhook, 0, len(req.Webhooks))
+	for _, w := range req.Webhooks {
+		if err := validateWebhookURL(w.URL); err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", err.Error())
+		}
+		if !validWebhookFormat(w.Format) {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的事件格式: %s", w.Format))
+		}
+		req.webhookTargets = append(req.webhookTargets, PaymentWebhook{
+			WebhookID: fmt.Sprintf("PWH%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+			URL:       w.URL,
+			Events:    w.Events,
+			Format:    w.Format,
+			Secret:    util.RandomString(32),
+		})
+	}
+	return nil
+}
+
+// createdPaymentWebhooks 下单响应中返回的回调目标及密钥
+func createdPaymentWebhooks(targets []PaymentWebhook) []CreatedPaymentWebhook {
+	created := make([]CreatedPaymentWebhook, 0, len(targets))
+	for _, t := range targets {
+		created = append(created, CreatedPaymentWebhook{WebhookID: t.WebhookID, URL: t.URL, Secret: t.Secret})
+	}
+	return created
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 付款状态
+const (
+	PayoutPendingApproval = "pending_approval"
+	PayoutProcessing      = "processing"
+	PayoutSucceeded       = "succeeded"
+	PayoutFailed          = "failed"
+	PayoutRejected        = "rejected"
+)
+
+var ErrPayoutNotFound = errors.New("付款单不存在")
+
+type PayoutRequest struct {
+	AccountID    string  `json:"accountId" binding:"required"` // 提现方的余额账户
+	Channel      string  `json:"channel" binding:"required"`   // alipay | wechat
+	Amount       float64 `json:"amount" binding:"required"`
+	Currency     string  `json:"currency"`
+	PayeeAccount string  `json:"payeeAccount" binding:"required"` // 支付宝登录号或微信 openid
+	PayeeName    string  `json:"payeeName"`                       // 填写时校验收款人实名
+	Remark       string  `json:"remark"`
+	RequestedBy  string  `json:"requestedBy"`
+}
+
+type PayoutApprovalRequest struct {
+	Operator string `json:"operator"` // 启用 JWT 认证时以令牌中的身份为准
+	Comment  string `json:"comment"`
+}
+
+// Payout 付款单
+type Payout struct {
+	PayoutID         string    `json:"payoutId"`
+	AccountID        string    `json:"accountId"`
+	Channel          string    `json:"channel"`
+	Amount           float64   `json:"amount"`
+	Currency         string    `json:"currency,omitempty"`
+	PayeeAccount     string    `json:"payeeAccount"`
+	PayeeName        string    `json:"payeeName,omitempty"`
+	Remark           string    `json:"remark,omitempty"`
+	Status           string    `json:"status"`
+	RequestedBy      string    `json:"requestedBy,omitempty"`
+	ApprovedBy       string    `json:"approvedBy,omitempty"`
+	ApprovalComment  string    `json:"approvalComment,omitempty"`
+	ProviderPayoutNo string    `json:"providerPayoutNo,omitempty"`
+	FailureReason    string    `json:"failureReason,omitempty"`
+	CompletedAt      time.Time `json:"completedAt,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// PayoutStore 付款单存储
+type PayoutStore interface {
+	Save(payout *Payout) error
+	Get(payoutID string) (*Payout, error)
+	List() ([]*Payout, error)
+}
+
+type memoryPayoutStore struct {
+	mu      sync.RWMutex
+	payouts map[string]*Payout
+}
+
+func NewMemoryPayoutStore() PayoutStore {
+	return &memoryPayoutStore{payouts: make(map[string]*Payout)}
+}
+
+func (s *memoryPayoutStore) Save(payout *Payout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if payout.CreatedAt.IsZero() {
+		payout.CreatedAt = now
+	}
+	payout.UpdatedAt = now
+
+	copied := *payout
+	s.payouts[payout.PayoutID] = &copied
+	return nil
+}
+
+func (s *memoryPayoutStore) Get(payoutID string) (*Payout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payout, ok := s.payouts[payoutID]
+	if !ok {
+		return nil, ErrPayoutNotFound
+	}
+	copied := *payout
+	return &copied, nil
+}
+
+func (s *memoryPayoutStore) List() ([]*Payout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payouts := make([]*Payout, 0, len(s.payouts))
+	for _, payout := range s.payouts {
+		copied := *payout
+		payouts = append(payouts, &copied)
+	}
+	sort.Slice(payouts, func(i, j int) bool {
+		return payouts[i].CreatedAt.After(payouts[j].CreatedAt)
+	})
+	return payouts, nil
+}
+
+// PayoutService 提现付款：余额冻结、审批、调用渠道转账及状态轮询
+type PayoutService struct {
+	payments          *PaymentService
+	payouts           PayoutStore
+	approvalThreshold float64
+	interval          time.Duration
+	executor          *JobQueue
+	mu                sync.Mutex
+}
+
+func NewPayoutService(payments *PaymentService) *PayoutService {
+	return &PayoutService{
+		payments:          payments,
+		payouts:           payments.repo.Payouts,
+		approvalThreshold: envFloat("PAYOUT_APPROVAL_THRESHOLD", 5000),
+		interval:          envDuration("PAYOUT_POLL_INTERVAL", time.Minute),
+		executor: payments.jobs.Queue("payouts", JobQueueConfig{
+			Workers:     4,
+			Capacity:    1000,
+			MaxAttempts: 5,
+			Backoff:     30 * time.Second,
+			MaxBackoff:  10 * time.Minute,
+		}),
+	}
+}
+
+// Create 创建付款单并冻结提现金额，超过审批阈值的付款需人工审批后才会打款
+func (pys *PayoutService) Create(req *PayoutRequest) (*apierr.Response, error) {
+	if req.Channel != "alipay" && req.Channel != "wechat" {
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持的付款渠道: %s", req.Channel)), nil
+	}
+	if req.Amount <= 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "付款金额必须大于0"), nil
+	}
+
+	payout := &Payout{
+		PayoutID:     fmt.Sprintf("PO%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		AccountID:    req.AccountID,
+		Channel:      req.Channel,
+		Amount:       roundAmountIn(req.Amount, req.Currency),
+		Currency:     req.Currency,
+		PayeeAccount: req.PayeeAccount,
+		PayeeName:    req.PayeeName,
+		Remark:       req.Remark,
+		RequestedBy:  req.RequestedBy,
+		Status:       PayoutPendingApproval,
+	}
+
+	if _, err := pys.payments.wallets.Debit(payout.AccountID, payout.Currency, payout.Amount); err != nil {
+		if errors.Is(err, ErrInsufficientBalance) {
+			return apierr.ErrorResponse("INSUFFICIENT_BALANCE", fmt.Sprintf("账户 %s 可提现余额不足", payout.AccountID)), nil
+		}
+		return nil, err
+	}
+	if err := pys.postEntries(payout, "wallet:"+payout.AccountID, "payouts:pending", "提现冻结"); err != nil {
+		return nil, err
+	}
+
+	if toMinorUnitsIn(payout.Amount, payout.Currency) < toMinorUnitsIn(pys.approvalThreshold, payout.Currency) {
+		payout.Status = PayoutProcessing
+	}
+	if err := pys.payouts.Save(payout); err != nil {
+		return nil, err
+	}
+	if payout.Status == PayoutProcessing {
+		pys.dispatch(payout)
+	}
+	return apierr.SuccessResponse(payout), nil
+}
+
+// Get 查询付款单
+func (pys *PayoutService) Get(payoutID string) (*apierr.Response, error) {
+	payout, err := pys.payouts.Get(payoutID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYOUT_NOT_FOUND", err.Error()), nil
+	}
+	return apierr.SuccessResponse(payout), nil
+}
+
+// Approve 审批通过并发起打款，审批人不能是申请人
+func (pys *PayoutService) Approve(payoutID string, req *PayoutApprovalRequest) (*apierr.Response, error) {
+	pys.mu.Lock()
+	defer pys.mu.Unlock()
+
+	payout, err := pys.payouts.Get(payoutID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYOUT_NOT_FOUND", err.Error()), nil
+	}
+	if payout.Status != PayoutPendingApproval {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许审批: %s", payout.Status)), nil
+	}
+	if payout.RequestedBy != "" && payout.RequestedBy == req.Operator {
+		return apierr.ErrorResponse("FORBIDDEN", "审批人不能是付款申请人"), nil
+	}
+
+	payout.ApprovedBy = req.Operator
+	payout.ApprovalComment = req.Comment
+	payout.Status = PayoutProcessing
+	if err := pys.payouts.Save(payout); err != nil {
+		return nil, err
+	}
+	pys.dispatch(payout)
+	return apierr.SuccessResponse(payout), nil
+}
+
+// Reject 驳回付款单并解冻余额
+func (pys *PayoutService) Reject(payoutID string, req *PayoutApprovalRequest) (*apierr.Response, error) {
+	pys.mu.Lock()
+	defer pys.mu.Unlock()
+
+	payout, err := pys.payouts.Get(payoutID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYOUT_NOT_FOUND", err.Error()), nil
+	}
+	if payout.Status != PayoutPendingApproval {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许驳回: %s", payout.Status)), nil
+	}
+
+	payout.ApprovedBy = req.Operator
+	payout.ApprovalComment = req.Comment
+	payout.Status = PayoutRejected
+	payout.CompletedAt = time.Now()
+	if err := pys.release(payout); err != nil {
+		return nil, err
+	}
+	if err := pys.payouts.Save(payout); err != nil {
+		return nil, err
+	}
+	return apierr.SuccessResponse(payout), nil
+}
+
+// dispatch 把打款交给 payouts 队列执行，接口立即返回 processing。队列已满时在当前请求内执行
+func (pys *PayoutService) dispatch(payout *Payout) {
+	payoutID := payout.PayoutID
+	job := NewJob("payout.execute", payoutID, func(context.Context) error {
+		pys.mu.Lock()
+		defer pys.mu.Unlock()
+
+		payout, err := pys.payouts.Get(payoutID)
+		if err != nil {
+			return PermanentJobError(err)
+		}
+		// 重试前已由轮询确定结果的不再打款；渠道按付款单号幂等，重复提交不会重复转账
+		if payout.Status != PayoutProcessing {
+			return nil
+		}
+		pys.execute(payout)
+		return pys.payouts.Save(payout)
+	})
+	if err := pys.executor.Submit(job); err != nil {
+		log.Printf("付款单 %s 入队失败，直接打款: %v", payoutID, err)
+		pys.execute(payout)
+		if err := pys.payouts.Save(payout); err != nil {
+			log.Printf("保存付款单 %s 失败: %v", payoutID, err)
+		}
+	}
+}
+
+// execute 调用渠道转账，结果不确定时保持 processing 等待轮询
+func (pys *PayoutService) execute(payout *Payout) {
+	payout.Status = PayoutProcessing
+
+	var err error
+	switch payout.Channel {
+	case "alipay":
+		err = pys.transferAlipay(payout)
+	case "wechat":
+		err = pys.transferWechat(payout)
+	}
+	if err != nil {
+		pys.fail(payout, err.Error())
+		return
+	}
+	if payout.Status == PayoutSucceeded {
+		pys.succeed(payout)
+	}
+}
+
+func (pys *PayoutService) transferAlipay(payout *Payout) error {
+	client := pys.payments.aliClient()
+	if client == nil {
+		return errors.New("支付宝客户端未初始化")
+	}
+
+	payeeInfo := map[string]string{
+		"identity":      payout.PayeeAccount,
+		"identity_type": "ALIPAY_LOGON_ID",
+	}
+	if payout.PayeeName != "" {
+		payeeInfo["name"] = payout.PayeeName
+	}
+
+	bm := make(gopay.BodyMap)
+	bm.Set("out_biz_no", payout.PayoutID)
+	bm.Set("trans_amount", fmt.Sprintf("%.2f", payout.Amount))
+	bm.Set("product_code", "TRANS_ACCOUNT_NO_PWD")
+	bm.Set("biz_scene", "DIRECT_TRANSFER")
+	bm.Set("order_title", "提现")
+	bm.Set("payee_info", payeeInfo)
+	if payout.Remark != "" {
+		bm.Set("remark", payout.Remark)
+	}
+
+	aliRsp, err := client.FundTransUniTransfer(context.Background(), bm)
+	if err != nil {
+		return fmt.Errorf("支付宝转账失败: %w", err)
+	}
+	payout.ProviderPayoutNo = aliRsp.Response.OrderId
+	if aliRsp.Response.Status == "SUCCESS" {
+		payout.Status = PayoutSucceeded
+	}
+	return nil
+}
+
+func (pys *PayoutService) transferWechat(payout *Payout) error {
+	client := pys.payments.wxClient()
+	if client == nil {
+		return errors.New("微信客户端未初始化")
+	}
+
+	bm := make(gopay.BodyMap)
+	bm.Set("nonce_str", util.RandomString(32))
+	bm.Set("partner_trade_no", payout.PayoutID)
+	bm.Set("openid", payout.PayeeAccount)
+	if payout.PayeeName != "" {
+		bm.Set("check_name", "FORCE_CHECK")
+		bm.Set("re_user_name", payout.PayeeName)
+	} else {
+		bm.Set("check_name", "NO_CHECK")
+	}
+	bm.Set("amount", toMinorUnits(payout.Amount))
+	bm.Set("desc", "提现")
+	bm.Set("spbill_create_ip", "127.0.0.1")
+
+	wxRsp, err := client.Transfer(context.Background(), bm)
+	if err != nil {
+		return fmt.Errorf("微信企业付款失败: %w", err)
+	}
+	if wxRsp.ReturnCode != "SUCCESS" {
+		return fmt.Errorf("微信企业付款失败: %s", wxRsp.ReturnMsg)
+	}
+	if wxRsp.ResultCode == "SUCCESS" {
+		payout.ProviderPayoutNo = wxRsp.PaymentNo
+		payout.Status = PayoutSucceeded
+		return nil
+	}
+	// SYSTEMERROR 时结果未知，需使用原单号查询
+	if wxRsp.ErrCode == "SYSTEMERROR" {
+		return nil
+	}
+	return fmt.Errorf("微信企业付款失败: %s", wxRsp.ErrCodeDes)
+}
+
+// Run 定期轮询处理中的付款单
+func (pys *PayoutService) Run(ctx context.Context) {
+	ticker := time.NewTicker(pys.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pys.poll()
+		}
+	}
+}
+
+func (pys *PayoutService) poll() {
+	payouts, err := pys.payouts.List()
+	if err != nil {
+		log.Printf("加载付款单失败: %v", err)
+		return
+	}
+
+	for _, payout := range payouts {
+		if payout.Status != PayoutProcessing {
+			continue
+		}
+		if err := pys.sync(payout); err != nil {
+			log.Printf("查询付款单 %s 状态失败: %v", payout.PayoutID, err)
+		}
+	}
+}
+
+// sync 向渠道查询付款结果并更新付款单
+func (pys *PayoutService) sync(payout *Payout) error {
+	pys.mu.Lock()
+	defer pys.mu.Unlock()
+
+	var status, reason string
+	switch payout.Channel {
+	case "alipay":
+		if pys.payments.aliClient() == nil {
+			return errors.New("支付宝客户端未初始化")
+		}
+		bm := make(gopay.BodyMap)
+		bm.Set("out_biz_no", payout.PayoutID)
+		bm.Set("product_code", "TRANS_ACCOUNT_NO_PWD")
+		bm.Set("biz_scene", "DIRECT_TRANSFER")
+		aliRsp, err := pys.payments.aliClient().FundTransCommonQuery(context.Background(), bm)
+		if err != nil {
+			return err
+		}
+		status, reason = aliRsp.Response.Status, aliRsp.Response.FailReason
+		if aliRsp.Response.OrderId != "" {
+			payout.ProviderPayoutNo = aliRsp.Response.OrderId
+		}
+	case "wechat":
+		if pys.payments.wxClient() == nil {
+			return errors.New("微信客户端未初始化")
+		}
+		bm := make(gopay.BodyMap)
+		bm.Set("nonce_str", util.RandomString(32))
+		bm.Set("partner_trade_no", payout.PayoutID)
+		wxRsp, err := pys.payments.wxClient().GetTransferInfo(context.Background(), bm)
+		if err != nil {
+			return err
+		}
+		status, reason = wxRsp.Status, wxRsp.Reason
+		if wxRsp.DetailId != "" {
+			payout.ProviderPayoutNo = wxRsp.DetailId
+		}
+	}
+
+	switch status {
+	case "SUCCESS":
+		payout.Status = PayoutSucceeded
+		pys.succeed(payout)
+	case "FAIL", "FAILED", "REFUND":
+		pys.fail(payout, reason)
+	default:
+		return nil
+	}
+	return pys.payouts.Save(payout)
+}
+
+func (pys *PayoutService) succeed(payout *Payout) {
+	payout.CompletedAt = time.Now()
+	if err := pys.postEntries(payout, "payouts:pending", "clearing:"+payout.Channel, "提现打款"); err != nil {
+		log.Printf("付款单 %s 记账失败: %v", payout.PayoutID, err)
+	}
+}
+
+func (pys *PayoutService) fail(payout *Payout, reason string) {
+	payout.Status = PayoutFailed
+	payout.FailureReason = reason
+	payout.CompletedAt = time.Now()
+	if err := pys.release(payout); err != nil {
+		log.Printf("付款单 %s 解冻余额失败: %v", payout.PayoutID, err)
+	}
+}
+
+// release 付款未完成时退回冻结的余额
+func (pys *PayoutService) release(payout *Payout) error {
+	if _, err := pys.payments.wallets.Credit(payout.AccountID, payout.Currency, payout.Amount); err != nil {
+		return err
+	}
+	return pys.postEntries(payout, "payouts:pending", "wallet:"+payout.AccountID, "提现退回")
+}
+
+// postEntries 记录付款分录：借记 debitAccount，贷记 creditAccount
+func (pys *PayoutService) postEntries(payout *Payout, debitAccount, creditAccount, action string) error {
+	description := fmt.Sprintf("%s %s", action, payout.PayoutID)
+	return pys.payments.ledger.Post(
+		LedgerEntry{TxnID: payout.PayoutID, Account: debitAccount, Direction: Debit, Amount: payout.Amount, Currency: payout.Currency, Description: description},
+		LedgerEntry{TxnID: payout.PayoutID, Account: creditAccount, Direction: Credit, Amount: payout.Amount, Currency: payout.Currency, Description: description},
+	)
+}
+
+// registerPayoutRoutes 注册付款接口
+func registerPayoutRoutes(api *gin.RouterGroup, pys *PayoutService) {
+	api.POST("/payouts", func(c *gin.Context) {
+		var req PayoutRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if principal := principalFromRequest(c); principal != nil {
+			req.RequestedBy = principal.Name
+		}
+
+		resp, err := pys.Create(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.GET("/payouts/:payoutId", func(c *gin.Context) {
+		resp, err := pys.Get(c.Param("payoutId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.POST("/payouts/:payoutId/approve", func(c *gin.Context) {
+		var req PayoutApprovalRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if principal := principalFromRequest(c); principal != nil {
+			req.Operator = principal.Name
+		}
+		if req.Operator == "" {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "operator 不能为空")
+			return
+		}
+
+		resp, err := pys.Approve(c.Param("payoutId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.POST("/payouts/:payoutId/reject", func(c *gin.Context) {
+		var req PayoutApprovalRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if principal := principalFromRequest(c); principal != nil {
+			req.Operator = principal.Name
+		}
+		if req.Operator == "" {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "operator 不能为空")
+			return
+		}
+
+		resp, err := pys.Reject(c.Param("payoutId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
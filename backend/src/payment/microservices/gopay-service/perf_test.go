@@ -0,0 +1,290 @@
+//go:build perf
+
+// 下单、查询、异步通知链路的压测与性能回归门禁。
+//
+//	go test -tags=perf -run TestPerf -v
+//
+// 支付宝页面支付只在本地生成签名链接，异步通知未配置验签公钥时跳过验签，
+// 因此整条链路不依赖外部渠道。基线可通过 PERF_* 环境变量调整。
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// perfBaseline 单条链路的性能基线
+type perfBaseline struct {
+	minRPS float64
+	maxP99 time.Duration
+}
+
+// defaultBaselines 默认基线按 16 并发留有余量，下单包含 RSA 签名，明显慢于其他链路
+var defaultBaselines = map[string]perfBaseline{
+	"CREATE": {minRPS: 200, maxP99: 150 * time.Millisecond},
+	"QUERY":  {minRPS: 5000, maxP99: 20 * time.Millisecond},
+	"NOTIFY": {minRPS: 3000, maxP99: 30 * time.Millisecond},
+}
+
+// loadBaseline 读取基线，可用 PERF_MIN_RPS_<PATH> / PERF_MAX_P99_<PATH> 覆盖
+func loadBaseline(path string) perfBaseline {
+	baseline := defaultBaselines[path]
+	return perfBaseline{
+		minRPS: envFloat("PERF_MIN_RPS_"+path, baseline.minRPS),
+		maxP99: envDuration("PERF_MAX_P99_"+path, baseline.maxP99),
+	}
+}
+
+// perfResult 一轮压测的统计
+type perfResult struct {
+	requests  int
+	failures  int
+	elapsed   time.Duration
+	latencies []time.Duration
+}
+
+func (r *perfResult) rps() float64 {
+	return float64(r.requests) / r.elapsed.Seconds()
+}
+
+func (r *perfResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	idx := int(float64(len(r.latencies)-1) * p)
+	return r.latencies[idx]
+}
+
+// attack 以固定并发持续发送请求，next 根据序号构造请求，返回 false 表示该请求失败
+func attack(t *testing.T, duration time.Duration, concurrency int, next func(seq int64) (*http.Request, func(*http.Response, []byte) bool)) *perfResult {
+	t.Helper()
+
+	var (
+		seq      int64
+		failures int64
+		mu       sync.Mutex
+		all      []time.Duration
+		wg       sync.WaitGroup
+	)
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: concurrency}}
+	deadline := time.Now().Add(duration)
+	start := time.Now()
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []time.Duration
+			for time.Now().Before(deadline) {
+				req, check := next(atomic.AddInt64(&seq, 1))
+				begin := time.Now()
+				resp, err := client.Do(req)
+				if err != nil {
+					atomic.AddInt64(&failures, 1)
+					continue
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				local = append(local, time.Since(begin))
+				if !check(resp, body) {
+					atomic.AddInt64(&failures, 1)
+				}
+			}
+			mu.Lock()
+			all = append(all, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	return &perfResult{
+		requests:  len(all),
+		failures:  int(failures),
+		elapsed:   time.Since(start),
+		latencies: all,
+	}
+}
+
+func assertBaseline(t *testing.T, path string, result *perfResult) {
+	t.Helper()
+	baseline := loadBaseline(path)
+	t.Logf("%-7s 请求 %d，失败 %d，%.0f req/s，p50 %s，p95 %s，p99 %s",
+		path, result.requests, result.failures, result.rps(),
+		result.percentile(0.50), result.percentile(0.95), result.percentile(0.99))
+
+	if result.failures > 0 {
+		t.Errorf("%s 失败请求 %d 个", path, result.failures)
+	}
+	if result.rps() < baseline.minRPS {
+		t.Errorf("%s 吞吐 %.0f req/s 低于基线 %.0f req/s", path, result.rps(), baseline.minRPS)
+	}
+	if p99 := result.percentile(0.99); p99 > baseline.maxP99 {
+		t.Errorf("%s p99 %s 超过基线 %s", path, p99, baseline.maxP99)
+	}
+}
+
+// newPerfServer 使用临时生成的支付宝应用私钥启动进程内服务
+func newPerfServer(t *testing.T) (*httptest.Server, *PaymentService) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"ALIPAY_APP_ID":      "perf",
+		"ALIPAY_PRIVATE_KEY": base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key)),
+		"ALIPAY_PUBLIC_KEY":  "",
+		"RISK_IP_LIMIT":      "100000000",
+		"RISK_USER_LIMIT":    "100000000",
+		"FAPIAO_API_URL":     "",
+		"RISK_SCORER_URL":    "",
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	// 未配置验签公钥时每次通知都会打印警告，压测期间关闭日志
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	gin.SetMode(gin.ReleaseMode)
+	ps := NewPaymentService()
+	r := gin.New()
+	api := r.Group("/api/v1")
+	registerPaymentRoutes(api, ps, NewAsyncCreator(ps))
+	registerNotifyRoutes(api, ps)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, ps
+}
+
+func perfDuration() time.Duration {
+	return envDuration("PERF_DURATION", 5*time.Second)
+}
+
+func perfConcurrency() int {
+	return envInt("PERF_CONCURRENCY", 16)
+}
+
+func successEnvelope(resp *http.Response, body []byte) bool {
+	var envelope apierr.Response
+	return resp.StatusCode == http.StatusOK && json.Unmarshal(body, &envelope) == nil && envelope.Success
+}
+
+func createRequest(baseURL, orderID string) *http.Request {
+	body, _ := json.Marshal(map[string]interface{}{
+		"method":        "alipay",
+		"orderId":       orderID,
+		"userId":        "perf-user",
+		"amount":        99.00,
+		"currency":      "CNY",
+		"subject":       "压测订单",
+		"expireMinutes": 30,
+	})
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/v1/payment/create", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// notifyRequest 构造未签名的支付宝通知，被测环境需设置 NOTIFY_SKIP_SIGNATURE=true
+func notifyRequest(baseURL, orderID string) *http.Request {
+	form := url.Values{}
+	form.Set("out_trade_no", orderID)
+	form.Set("trade_no", "ALI"+orderID)
+	form.Set("trade_status", "TRADE_SUCCESS")
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/v1/payment/notify/alipay", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+// seedPaid 预先创建并通知成功一批订单，供查询压测使用
+func seedPaid(t *testing.T, baseURL string, n int) []string {
+	t.Helper()
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		orderID := fmt.Sprintf("PERFSEED%d", i)
+		for _, req := range []*http.Request{createRequest(baseURL, orderID), notifyRequest(baseURL, orderID)} {
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		ids = append(ids, orderID)
+	}
+	return ids
+}
+
+func TestPerfCreate(t *testing.T) {
+	srv, _ := newPerfServer(t)
+	prefix := fmt.Sprintf("PERFC%d_", time.Now().UnixNano())
+
+	result := attack(t, perfDuration(), perfConcurrency(), func(seq int64) (*http.Request, func(*http.Response, []byte) bool) {
+		return createRequest(srv.URL, fmt.Sprintf("%s%d", prefix, seq)), successEnvelope
+	})
+	assertBaseline(t, "CREATE", result)
+}
+
+func TestPerfQuery(t *testing.T) {
+	srv, _ := newPerfServer(t)
+	ids := seedPaid(t, srv.URL, 500)
+
+	result := attack(t, perfDuration(), perfConcurrency(), func(seq int64) (*http.Request, func(*http.Response, []byte) bool) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/payment/query/"+ids[int(seq)%len(ids)], nil)
+		return req, successEnvelope
+	})
+	assertBaseline(t, "QUERY", result)
+}
+
+// TestPerfNotify 每个订单先下单再通知，同时覆盖重复通知的去重路径
+func TestPerfNotify(t *testing.T) {
+	srv, ps := newPerfServer(t)
+	prefix := fmt.Sprintf("PERFN%d_", time.Now().UnixNano())
+
+	const pool = 2000
+	for i := 0; i < pool; i++ {
+		resp, err := http.DefaultClient.Do(createRequest(srv.URL, fmt.Sprintf("%s%d", prefix, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	result := attack(t, perfDuration(), perfConcurrency(), func(seq int64) (*http.Request, func(*http.Response, []byte) bool) {
+		return notifyRequest(srv.URL, fmt.Sprintf("%s%d", prefix, seq%pool)), func(resp *http.Response, body []byte) bool {
+			return resp.StatusCode == http.StatusOK && string(body) == "success"
+		}
+	})
+	assertBaseline(t, "NOTIFY", result)
+
+	record, err := ps.store.Get(prefix + "0")
+	if err != nil || record.Status != StatusPaid {
+		t.Fatalf("通知后订单未变为已支付: %+v %v", record, err)
+	}
+}
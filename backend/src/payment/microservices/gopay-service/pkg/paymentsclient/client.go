@@ -0,0 +1,220 @@
+package paymentsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError 接口返回的业务错误或 HTTP 错误
+type APIError struct {
+	HTTPStatus int
+	Code       string
+	Message    string
+	RetryAfter time.Duration // RETRY_LATER、PROVIDER_MAINTENANCE 时服务端建议的重试间隔
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("支付服务错误(%s, HTTP %d): %s", e.Code, e.HTTPStatus, e.Message)
+}
+
+// Retryable 是否为稍后重试即可能成功的错误
+func (e *APIError) Retryable() bool {
+	return e.Code == "RETRY_LATER" || e.Code == "PROVIDER_MAINTENANCE" || e.HTTPStatus == http.StatusServiceUnavailable
+}
+
+// IsCode 判断 err 是否为指定业务错误码的 APIError
+func IsCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// Client 支付服务 HTTP 客户端，可并发使用
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	tenantID   string
+	token      string
+	appID      string
+	appSecret  string
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义的 http.Client，如需出示 mTLS 客户端证书
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithTenant 以指定租户身份调用，对应 X-Tenant-ID
+func WithTenant(tenantID string) Option {
+	return func(c *Client) { c.tenantID = tenantID }
+}
+
+// WithBearerToken 管理、退款等需要 JWT 的接口使用的令牌
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithSigner 按服务端 API_APP_SECRETS 中的 appId 和密钥对请求签名
+func WithSigner(appID, secret string) Option {
+	return func(c *Client) { c.appID, c.appSecret = appID, secret }
+}
+
+// New 创建客户端，baseURL 为服务地址，如 http://gopay-service:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CreatePayment 同步下单
+func (c *Client) CreatePayment(ctx context.Context, req *CreatePaymentRequest) (*Payment, error) {
+	payment := new(Payment)
+	if err := c.do(ctx, http.MethodPost, "/api/v1/payment/create", req, payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// CreatePaymentAsync 异步下单，受理后立即返回，结果通过 GetAsyncCreation 轮询或 payment.created 事件获取
+func (c *Client) CreatePaymentAsync(ctx context.Context, req *CreatePaymentRequest) (*AsyncCreation, error) {
+	task := new(AsyncCreation)
+	if err := c.do(ctx, http.MethodPost, "/api/v1/payment/create?async=true", req, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// GetAsyncCreation 查询异步下单任务
+func (c *Client) GetAsyncCreation(ctx context.Context, paymentID string) (*AsyncCreation, error) {
+	task := new(AsyncCreation)
+	if err := c.do(ctx, http.MethodGet, "/api/v1/payment/async/"+url.PathEscape(paymentID), nil, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// QueryPayment 查询支付状态，待支付的记录由服务端向渠道同步
+func (c *Client) QueryPayment(ctx context.Context, paymentID string) (*Payment, error) {
+	payment := new(Payment)
+	if err := c.do(ctx, http.MethodGet, "/api/v1/payment/query/"+url.PathEscape(paymentID), nil, payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// CreateRefund 发起退款，超过审批阈值的退款返回 awaiting_approval 状态
+func (c *Client) CreateRefund(ctx context.Context, req *RefundRequest) (*Refund, error) {
+	refund := new(Refund)
+	if err := c.do(ctx, http.MethodPost, "/api/v1/refunds", req, refund); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// GetRefund 查询退款
+func (c *Client) GetRefund(ctx context.Context, refundID string) (*Refund, error) {
+	refund := new(Refund)
+	if err := c.do(ctx, http.MethodGet, "/api/v1/refunds/"+url.PathEscape(refundID), nil, refund); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// ListRefunds 查询一笔支付的全部退款
+func (c *Client) ListRefunds(ctx context.Context, paymentID string) ([]Refund, error) {
+	var refunds []Refund
+	if err := c.do(ctx, http.MethodGet, "/api/v1/refunds?paymentId="+url.QueryEscape(paymentID), nil, &refunds); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.tenantID != "" {
+		httpReq.Header.Set("X-Tenant-ID", c.tenantID)
+	}
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.appID != "" {
+		c.sign(httpReq, body)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("请求支付服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取支付服务响应失败: %w", err)
+	}
+	envelope := Response{Data: out}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return &APIError{HTTPStatus: resp.StatusCode, Code: "INVALID_RESPONSE", Message: fmt.Sprintf("解析响应失败: %v", err)}
+	}
+	if !envelope.Success {
+		apiErr := &APIError{HTTPStatus: resp.StatusCode, Code: envelope.Code, Message: envelope.Message}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	return nil
+}
+
+// sign 与服务端 RequestSigner 一致：hex(sha256(appId + timestamp + nonce + body + secret))，无请求体时 body 为 "{}"
+func (c *Client) sign(httpReq *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceBytes := make([]byte, 16)
+	rand.Read(nonceBytes)
+	nonce := hex.EncodeToString(nonceBytes)
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	h := sha256.New()
+	h.Write([]byte(c.appID + timestamp + nonce))
+	h.Write(body)
+	h.Write([]byte(c.appSecret))
+
+	httpReq.Header.Set("X-App-Id", c.appID)
+	httpReq.Header.Set("X-Timestamp", timestamp)
+	httpReq.Header.Set("X-Nonce", nonce)
+	httpReq.Header.Set("X-Signature", hex.EncodeToString(h.Sum(nil)))
+}
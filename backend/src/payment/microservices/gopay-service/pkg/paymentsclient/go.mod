@@ -0,0 +1,3 @@
+module gopay-service/pkg/paymentsclient
+
+go 1.21
@@ -0,0 +1,219 @@
+// Package paymentsclient 支付服务的 Go 客户端及请求、响应类型。
+//
+// 类型与服务端接口的 JSON 字段一一对应，服务端的契约测试（go test -tags=contract）
+// 逐字段比对两边的类型，接口字段变化时测试失败，调用方不必再手写结构体。
+// 本包是独立模块、不依赖服务端代码，其他 Go 服务可直接引用：
+//
+//	require gopay-service/pkg/paymentsclient v0.0.0
+//	replace gopay-service/pkg/paymentsclient => ../gopay-service/pkg/paymentsclient
+package paymentsclient
+
+import "time"
+
+// 支付状态
+const (
+	StatusPending           = "pending"
+	StatusAuthorized        = "authorized"
+	StatusPaid              = "paid"
+	StatusVoided            = "voided"
+	StatusFailed            = "failed"
+	StatusClosed            = "closed"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+// 退款去向
+const (
+	RefundToSource  = "source"
+	RefundToBalance = "balance"
+)
+
+// 退款状态
+const (
+	RefundPending          = "pending"
+	RefundAwaitingApproval = "awaiting_approval"
+	RefundRejected         = "rejected"
+	RefundSucceeded        = "succeeded"
+	RefundFailed           = "failed"
+)
+
+// 异步下单任务状态
+const (
+	AsyncCreateQueued     = "queued"
+	AsyncCreateProcessing = "processing"
+	AsyncCreateSucceeded  = "succeeded"
+	AsyncCreateFailed     = "failed"
+)
+
+// Response 所有接口统一使用的响应信封，Data 按接口解码为对应类型
+type Response struct {
+	Success bool        `json:"success"`
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
+}
+
+// Meta 响应附加信息
+type Meta struct {
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination 基于游标的分页信息
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// CreatePaymentRequest 下单请求，POST /api/v1/payment/create
+type CreatePaymentRequest struct {
+	Method           string                  `json:"method"`
+	OrderID          string                  `json:"orderId"`
+	UserID           string                  `json:"userId,omitempty"`
+	Amount           float64                 `json:"amount"`
+	Currency         string                  `json:"currency,omitempty"`
+	Subject          string                  `json:"subject"`
+	Body             string                  `json:"body,omitempty"`
+	ReturnURL        string                  `json:"returnUrl,omitempty"`
+	NotifyURL        string                  `json:"notifyUrl,omitempty"`
+	ExpireMinutes    int                     `json:"expireMinutes,omitempty"`
+	Metadata         map[string]interface{}  `json:"metadata,omitempty"`
+	Scene            string                  `json:"scene,omitempty"`       // 支付宝支付场景：page（默认）或 app
+	Installment      *InstallmentOption      `json:"installment,omitempty"` // 花呗分期，仅支付宝支持
+	GiftCardNo       string                  `json:"giftCardNo,omitempty"`
+	GiftCardPIN      string                  `json:"giftCardPin,omitempty"`
+	Invoice          *InvoiceRequest         `json:"invoice,omitempty"`
+	AlternateMethods []string                `json:"alternateMethods,omitempty"` // 渠道维护时可接受的备选支付方式
+	Webhooks         []PaymentWebhookRequest `json:"webhooks,omitempty"`         // 仅针对本笔支付的额外回调地址
+	ActivateAt       *time.Time              `json:"activateAt,omitempty"`       // 预约支付的生效时间
+}
+
+// InstallmentOption 花呗分期选项
+type InstallmentOption struct {
+	Periods       int `json:"periods"`       // 3 / 6 / 12
+	SellerPercent int `json:"sellerPercent"` // 0（用户承担）或 100（商家贴息）
+}
+
+// InvoiceRequest 电子发票购方信息
+type InvoiceRequest struct {
+	Type  string `json:"type,omitempty"` // personal | company
+	Title string `json:"title"`
+	TaxNo string `json:"taxNo,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// PaymentWebhookRequest 单笔支付的回调地址
+type PaymentWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Format string   `json:"format,omitempty"` // legacy | cloudevents
+}
+
+// Payment 下单和查询接口返回的支付信息
+type Payment struct {
+	PaymentID   string                  `json:"paymentId"`
+	RedirectURL string                  `json:"redirectUrl,omitempty"`
+	QRCode      string                  `json:"qrCode,omitempty"`
+	DeepLink    string                  `json:"deepLink,omitempty"`
+	ExpiredAt   string                  `json:"expiredAt,omitempty"`
+	Status      string                  `json:"status,omitempty"`
+	Installment *InstallmentPlan        `json:"installment,omitempty"`
+	Method      string                  `json:"method,omitempty"`     // 实际使用的支付方式，维护改道时与请求不同
+	RoutedFrom  string                  `json:"routedFrom,omitempty"` // 因维护改道前的支付方式
+	Webhooks    []CreatedPaymentWebhook `json:"webhooks,omitempty"`
+	Saga        *SagaState              `json:"saga,omitempty"`
+	ActivateAt  *time.Time              `json:"activateAt,omitempty"`
+}
+
+// InstallmentPlan 分期方案及还款计划
+type InstallmentPlan struct {
+	Periods       int                 `json:"periods"`
+	SellerPercent int                 `json:"sellerPercent"`
+	FeeRate       float64             `json:"feeRate"`
+	TotalFee      float64             `json:"totalFee"`
+	BuyerFee      float64             `json:"buyerFee"`
+	SellerFee     float64             `json:"sellerFee"`
+	Schedule      []InstallmentPeriod `json:"schedule"`
+}
+
+// InstallmentPeriod 单期还款明细
+type InstallmentPeriod struct {
+	Period    int     `json:"period"`
+	Principal float64 `json:"principal"`
+	Fee       float64 `json:"fee"`
+	Amount    float64 `json:"amount"`
+}
+
+// CreatedPaymentWebhook 下单时登记的回调地址，签名密钥只在下单响应中返回一次
+type CreatedPaymentWebhook struct {
+	WebhookID string `json:"webhookId"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret"`
+}
+
+// SagaState 支付与订单履约的协调状态
+type SagaState struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	RefundID  string    `json:"refundId,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// AsyncCreation 异步下单任务，GET /api/v1/payment/async/:paymentId
+type AsyncCreation struct {
+	PaymentID string    `json:"paymentId"`
+	Status    string    `json:"status"`
+	Payment   *Payment  `json:"payment,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RefundRequest 退款请求，POST /api/v1/refunds
+type RefundRequest struct {
+	PaymentID   string  `json:"paymentId"`
+	Amount      float64 `json:"amount,omitempty"` // 为空时退还剩余可退金额
+	Reason      string  `json:"reason,omitempty"`
+	Destination string  `json:"destination,omitempty"` // source | balance，为空时使用租户默认策略
+}
+
+// Refund 退款记录
+type Refund struct {
+	RefundID         string     `json:"refundId"`
+	PaymentID        string     `json:"paymentId"`
+	TenantID         string     `json:"tenantId"`
+	Method           string     `json:"method"`
+	Amount           float64    `json:"amount"`
+	Currency         string     `json:"currency,omitempty"`
+	Destination      string     `json:"destination"`
+	Status           string     `json:"status"`
+	Reason           string     `json:"reason,omitempty"`
+	ProviderRefundNo string     `json:"providerRefundNo,omitempty"`
+	FeeReturned      float64    `json:"feeReturned,omitempty"`
+	FailureReason    string     `json:"failureReason,omitempty"`
+	RequestedBy      string     `json:"requestedBy,omitempty"`
+	ReviewedBy       string     `json:"reviewedBy,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewedAt,omitempty"`
+	ReviewNote       string     `json:"reviewNote,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// RetryHint 服务暂时无法处理时的重试建议，随 RETRY_LATER 返回
+type RetryHint struct {
+	Component         string `json:"component"`
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retryAfterSeconds"`
+}
+
+// MaintenanceNotice 渠道维护说明，随 PROVIDER_MAINTENANCE 返回
+type MaintenanceNotice struct {
+	Provider          string    `json:"provider"`
+	Reason            string    `json:"reason,omitempty"`
+	WindowEnd         time.Time `json:"windowEnd"`
+	RetryAfterSeconds int       `json:"retryAfterSeconds"`
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// 组件状态，按严重程度递增
+const (
+	ComponentOperational = "operational"
+	ComponentUnknown     = "unknown" // 暂无数据，不影响整体状态
+	ComponentMaintenance = "maintenance"
+	ComponentDegraded    = "degraded"
+	ComponentOutage      = "outage"
+)
+
+var componentStatusLabels = map[string]string{
+	ComponentOperational: "正常",
+	ComponentUnknown:     "未知",
+	ComponentMaintenance: "维护中",
+	ComponentDegraded:    "降级",
+	ComponentOutage:      "不可用",
+}
+
+// StatusComponent 状态页上的一个组件，Detail 给人看，Value 给程序用
+type StatusComponent struct {
+	Name   string      `json:"name"`
+	Status string      `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// PlatformStatus 支付平台整体状态：operational、degraded 或 outage
+type PlatformStatus struct {
+	Status      string            `json:"status"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Components  []StatusComponent `json:"components"`
+}
+
+// PlatformStatusReporter 汇总支付服务和加密货币网关的状态，供运维状态页使用
+type PlatformStatusReporter struct {
+	payments      *PaymentService
+	refundBatches *RefundBatchProcessor
+	cryptoTimeout time.Duration
+	webhookWarn   int
+}
+
+func NewPlatformStatusReporter(payments *PaymentService, refundBatches *RefundBatchProcessor) *PlatformStatusReporter {
+	return &PlatformStatusReporter{
+		payments:      payments,
+		refundBatches: refundBatches,
+		cryptoTimeout: envDuration("STATUS_CRYPTO_TIMEOUT", 3*time.Second),
+		webhookWarn:   envInt("STATUS_WEBHOOK_BACKLOG_WARN", 200),
+	}
+}
+
+// Report 采集各组件状态。存储不可用时整体为 outage，其余组件异常时为 degraded
+func (pr *PlatformStatusReporter) Report(ctx context.Context) *PlatformStatus {
+	ps := pr.payments
+	report := &PlatformStatus{GeneratedAt: time.Now()}
+	add := func(component StatusComponent) {
+		report.Components = append(report.Components, component)
+	}
+
+	store := StatusComponent{Name: "payments.store", Status: ComponentOperational}
+	if err := ps.store.Ping(); err != nil {
+		store.Status = ComponentOutage
+		store.Detail = err.Error()
+	}
+	add(store)
+
+	providers := make([]string, 0, len(ps.breakers))
+	for name := range ps.breakers {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	for _, name := range providers {
+		add(pr.providerComponent(name))
+	}
+
+	queues := append(ps.preflight.QueueDepths(), pr.refundBatches.QueueDepth())
+	for _, queue := range queues {
+		component := StatusComponent{
+			Name:   "queue." + queue.Name,
+			Status: ComponentOperational,
+			Detail: fmt.Sprintf("积压 %d / %d", queue.Depth, queue.Limit),
+			Value:  queue,
+		}
+		if queue.Depth >= queue.Limit {
+			component.Status = ComponentDegraded
+		}
+		add(component)
+	}
+
+	backlog := ps.webhooks.Backlog()
+	webhooks := StatusComponent{
+		Name:   "webhooks",
+		Status: ComponentOperational,
+		Detail: fmt.Sprintf("投递中 %d，最近一小时失败 %d", backlog.InFlight, backlog.FailedLastHour),
+		Value:  backlog,
+	}
+	if backlog.InFlight >= pr.webhookWarn || backlog.FailedLastHour >= pr.webhookWarn {
+		webhooks.Status = ComponentDegraded
+	}
+	add(webhooks)
+
+	for _, component := range pr.cryptoComponents(ctx) {
+		add(component)
+	}
+
+	report.Status = ComponentOperational
+	for _, component := range report.Components {
+		switch component.Status {
+		case ComponentOutage:
+			if component.Name == "payments.store" {
+				report.Status = ComponentOutage
+			} else if report.Status == ComponentOperational {
+				report.Status = ComponentDegraded
+			}
+		case ComponentDegraded, ComponentMaintenance:
+			if report.Status == ComponentOperational {
+				report.Status = ComponentDegraded
+			}
+		}
+	}
+	return report
+}
+
+func (pr *PlatformStatusReporter) providerComponent(name string) StatusComponent {
+	ps := pr.payments
+	cb := ps.breakers[name]
+	component := StatusComponent{
+		Name:   "provider." + name,
+		Status: ComponentOperational,
+		Value:  gin.H{"breaker": cb.State()},
+	}
+	if notice := ps.maintenance.Notice(name); notice != nil {
+		component.Status = ComponentMaintenance
+		component.Detail = fmt.Sprintf("维护中，预计 %s 恢复", notice.WindowEnd.Local().Format("2006-01-02 15:04"))
+		component.Value = gin.H{"breaker": cb.State(), "maintenance": notice}
+		return component
+	}
+	switch cb.State() {
+	case BreakerOpen:
+		component.Status = ComponentOutage
+		component.Detail = fmt.Sprintf("熔断中，%d 秒后探测", seconds(cb.RetryAfter()))
+	case BreakerHalfOpen:
+		component.Status = ComponentDegraded
+		component.Detail = "熔断半开，正在探测"
+	}
+	return component
+}
+
+// cryptoComponents 查询加密货币网关状态，网关不可达时只影响加密货币支付
+func (pr *PlatformStatusReporter) cryptoComponents(ctx context.Context) []StatusComponent {
+	ctx, cancel := context.WithTimeout(ctx, pr.cryptoTimeout)
+	defer cancel()
+
+	status, err := pr.payments.crypto.Status(ctx)
+	if err != nil {
+		return []StatusComponent{{Name: "crypto.gateway", Status: ComponentOutage, Detail: err.Error()}}
+	}
+
+	gateway := StatusComponent{
+		Name:   "crypto.gateway",
+		Status: ComponentOperational,
+		Detail: fmt.Sprintf("待支付 %d，确认中 %d，待人工复核 %d", status.PendingInvoices, status.ConfirmingInvoices, status.ReviewBacklog),
+		Value: gin.H{
+			"pendingInvoices":    status.PendingInvoices,
+			"confirmingInvoices": status.ConfirmingInvoices,
+			"reviewBacklog":      status.ReviewBacklog,
+		},
+	}
+	if !status.Ready {
+		gateway.Status = ComponentOutage
+		gateway.Detail = status.Error
+	}
+
+	components := []StatusComponent{gateway}
+	for _, scanner := range status.Scanners {
+		component := StatusComponent{
+			Name:   "crypto.scanner." + strings.ToLower(scanner.Network),
+			Status: ComponentOperational,
+			Detail: fmt.Sprintf("区块 %d，延迟 %d 秒", scanner.LastBlockHeight, scanner.LagSeconds),
+			Value:  scanner,
+		}
+		switch scanner.Status {
+		case model.ScannerLagging:
+			component.Status = ComponentDegraded
+		case model.ScannerUnknown:
+			component.Status = ComponentUnknown
+			component.Detail = "尚未收到监听上报"
+		}
+		components = append(components, component)
+	}
+	return components
+}
+
+// Text 渲染为纯文本，便于值班人员直接查看
+func (s *PlatformStatus) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "支付平台状态: %s（%s）\n", componentStatusLabels[s.Status], s.GeneratedAt.Local().Format("2006-01-02 15:04:05"))
+	for _, component := range s.Components {
+		fmt.Fprintf(&b, "  [%s] %s", componentStatusLabels[component.Status], component.Name)
+		if component.Detail != "" {
+			fmt.Fprintf(&b, "  %s", component.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// registerPlatformStatusRoutes 注册平台状态页接口，挂在网关根路径，不经过认证。
+// 默认返回 JSON；?format=text 或 Accept: text/plain 时返回纯文本。整体不可用时返回 503
+func registerPlatformStatusRoutes(r *gin.Engine, pr *PlatformStatusReporter) {
+	r.GET("/status", func(c *gin.Context) {
+		report := pr.Report(c.Request.Context())
+		code := http.StatusOK
+		if report.Status == ComponentOutage {
+			code = http.StatusServiceUnavailable
+		}
+
+		if c.Query("format") == "text" || strings.HasPrefix(c.GetHeader("Accept"), "text/plain") {
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			c.String(code, report.Text())
+			return
+		}
+		c.JSON(code, apierr.SuccessResponse(report))
+	})
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-pay/gopay"
+
+	"gopay-service/internal/apierr"
+)
+
+type AuthorizeRequest struct {
+	Method          string                 `json:"method" binding:"required"`
+	OrderID         string                 `json:"orderId" binding:"required"`
+	Amount          float64                `json:"amount" binding:"required"`
+	Currency        string                 `json:"currency"`
+	Subject         string                 `json:"subject" binding:"required"`
+	NotifyURL       string                 `json:"notifyUrl"`
+	ExpireMinutes   int                    `json:"expireMinutes"`
+	PaymentMethodID string                 `json:"paymentMethodId"` // Stripe PaymentMethod，传入时直接确认预授权
+	Metadata        map[string]interface{} `json:"metadata"`
+}
+
+type CaptureRequest struct {
+	PaymentID string  `json:"paymentId" binding:"required"`
+	Amount    float64 `json:"amount"` // 为空时按预授权全额扣款
+}
+
+type VoidRequest struct {
+	PaymentID string `json:"paymentId" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+type AuthorizationData struct {
+	PaymentID        string  `json:"paymentId"`
+	Status           string  `json:"status"`
+	AuthNo           string  `json:"authNo,omitempty"`
+	QRCode           string  `json:"qrCode,omitempty"`
+	ClientSecret     string  `json:"clientSecret,omitempty"`
+	AuthorizedAmount float64 `json:"authorizedAmount"`
+	CapturedAmount   float64 `json:"capturedAmount,omitempty"`
+	ExpiredAt        string  `json:"expiredAt,omitempty"`
+}
+
+// Authorize 冻结资金，等待发货时再扣款
+func (ps *PaymentService) Authorize(req *AuthorizeRequest) (*apierr.Response, error) {
+	if resp := ps.currencies.Check(req.Method, &req.Currency, req.Amount); resp != nil {
+		return resp, nil
+	}
+	if _, err := ps.store.Get(req.OrderID); err == nil {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已存在支付记录: %s", req.OrderID)), nil
+	}
+	if notice := ps.maintenance.Notice(req.Method); notice != nil {
+		return maintenanceResponse(notice), nil
+	}
+	if hint := ps.preflight.Check(req.Method); hint != nil {
+		return retryLaterResponse(hint), nil
+	}
+	defer ps.preflight.begin()()
+
+	switch req.Method {
+	case "alipay":
+		return ps.authorizeAlipay(req)
+	case "stripe":
+		return ps.authorizeStripe(req)
+	default:
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持预授权的支付方式: %s", req.Method)), nil
+	}
+}
+
+// Capture 对已冻结的资金执行扣款，扣款金额可小于冻结金额
+func (ps *PaymentService) Capture(req *CaptureRequest) (*apierr.Response, error) {
+	record, err := ps.store.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if record.Status != StatusAuthorized && record.Status != StatusPending {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许扣款: %s", record.Status)), nil
+	}
+
+	amount := req.Amount
+	if amount <= 0 {
+		amount = record.Amount
+	}
+	if toMinorUnitsIn(amount, record.Currency) > toMinorUnitsIn(record.Amount, record.Currency) {
+		return apierr.ErrorResponse("AMOUNT_EXCEEDED", fmt.Sprintf("扣款金额 %s 超过预授权金额 %s", formatAmount(amount, record.Currency), formatAmount(record.Amount, record.Currency))), nil
+	}
+
+	switch record.Method {
+	case "alipay":
+		return ps.captureAlipay(record, amount)
+	case "stripe":
+		return ps.captureStripe(record, amount)
+	default:
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("该支付不是预授权支付: %s", record.Method)), nil
+	}
+}
+
+// Void 撤销预授权，释放全部冻结资金
+func (ps *PaymentService) Void(req *VoidRequest) (*apierr.Response, error) {
+	record, err := ps.store.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if record.Status != StatusAuthorized && record.Status != StatusPending {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许撤销: %s", record.Status)), nil
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "商户撤销预授权"
+	}
+
+	switch record.Method {
+	case "alipay":
+		return ps.voidAlipay(record, reason)
+	case "stripe":
+		return ps.voidStripe(record, reason)
+	default:
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("该支付不是预授权支付: %s", record.Method)), nil
+	}
+}
+
+func (ps *PaymentService) authorizeAlipay(req *AuthorizeRequest) (*apierr.Response, error) {
+	if ps.aliClient() == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "支付宝客户端未初始化"), nil
+	}
+
+	requestNo := req.OrderID + "_FREEZE"
+
+	// 构建资金授权发码参数，买家扫码后完成冻结
+	bm := make(gopay.BodyMap)
+	bm.Set("out_order_no", req.OrderID)
+	bm.Set("out_request_no", requestNo)
+	bm.Set("order_title", req.Subject)
+	bm.Set("amount", fmt.Sprintf("%.2f", req.Amount))
+	bm.Set("product_code", "PRE_AUTH")
+	if req.ExpireMinutes > 0 {
+		bm.Set("pay_timeout", fmt.Sprintf("%dm", req.ExpireMinutes))
+	}
+	if req.NotifyURL != "" {
+		bm.Set("notify_url", req.NotifyURL)
+	}
+
+	aliRsp, err := ps.aliClient().FundAuthOrderVoucherCreate(context.Background(), bm)
+	ps.breakers["alipay"].Record(err)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建支付宝资金预授权失败: %v", err)), nil
+	}
+
+	record := &PaymentRecord{
+		PaymentID:     req.OrderID,
+		OrderID:       req.OrderID,
+		Method:        req.Method,
+		Amount:        req.Amount,
+		Currency:      req.Currency,
+		Subject:       req.Subject,
+		Status:        StatusPending,
+		AuthRequestNo: requestNo,
+		Metadata:      req.Metadata,
+	}
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+
+	return apierr.SuccessResponse(&AuthorizationData{
+		PaymentID:        record.PaymentID,
+		Status:           record.Status,
+		QRCode:           aliRsp.Response.CodeValue,
+		AuthorizedAmount: record.Amount,
+		ExpiredAt:        authExpiry(req.ExpireMinutes),
+	}), nil
+}
+
+// resolveAlipayAuth 买家扫码冻结成功后通过操作查询补全授权号
+func (ps *PaymentService) resolveAlipayAuth(record *PaymentRecord) error {
+	if record.AuthNo != "" {
+		return nil
+	}
+
+	bm := make(gopay.BodyMap)
+	bm.Set("out_order_no", record.OrderID)
+	bm.Set("out_request_no", record.AuthRequestNo)
+
+	aliRsp, err := ps.aliClient().FundAuthOperationDetailQuery(context.Background(), bm)
+	if err != nil {
+		return fmt.Errorf("查询支付宝预授权失败: %w", err)
+	}
+	if aliRsp.Response.Status != "SUCCESS" || aliRsp.Response.AuthNo == "" {
+		return fmt.Errorf("买家尚未完成资金冻结")
+	}
+
+	record.AuthNo = aliRsp.Response.AuthNo
+	record.PayerID = aliRsp.Response.PayerUserId
+	record.Status = StatusAuthorized
+	return ps.store.Save(record)
+}
+
+func (ps *PaymentService) captureAlipay(record *PaymentRecord, amount float64) (*apierr.Response, error) {
+	if ps.aliClient() == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "支付宝客户端未初始化"), nil
+	}
+	if err := ps.resolveAlipayAuth(record); err != nil {
+		return apierr.ErrorResponse("INVALID_STATE", err.Error()), nil
+	}
+
+	// 授权转支付，COMPLETE 模式下剩余冻结金额自动解冻
+	bm := make(gopay.BodyMap)
+	bm.Set("out_trade_no", record.PaymentID)
+	bm.Set("total_amount", fmt.Sprintf("%.2f", amount))
+	bm.Set("subject", record.Subject)
+	bm.Set("product_code", "PREAUTH_PAY")
+	bm.Set("auth_no", record.AuthNo)
+	bm.Set("auth_confirm_mode", "COMPLETE")
+	if record.PayerID != "" {
+		bm.Set("buyer_id", record.PayerID)
+	}
+
+	aliRsp, err := ps.aliClient().TradePay(context.Background(), bm)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("支付宝预授权扣款失败: %v", err)), nil
+	}
+
+	record.ProviderTradeNo = aliRsp.Response.TradeNo
+	record.CapturedAmount = amount
+	record.Status = StatusPaid
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	if err := ps.postSale(record, amount); err != nil {
+		return nil, err
+	}
+	ps.afterPaid(record)
+
+	return apierr.SuccessResponse(authorizationData(record)), nil
+}
+
+func (ps *PaymentService) voidAlipay(record *PaymentRecord, reason string) (*apierr.Response, error) {
+	if ps.aliClient() == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "支付宝客户端未初始化"), nil
+	}
+
+	if err := ps.resolveAlipayAuth(record); err != nil {
+		// 买家尚未冻结成功时撤销授权码即可
+		bm := make(gopay.BodyMap)
+		bm.Set("out_order_no", record.OrderID)
+		bm.Set("out_request_no", record.AuthRequestNo)
+		bm.Set("remark", reason)
+		if _, err := ps.aliClient().FundAuthOperationCancel(context.Background(), bm); err != nil {
+			return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("撤销支付宝预授权失败: %v", err)), nil
+		}
+	} else {
+		bm := make(gopay.BodyMap)
+		bm.Set("auth_no", record.AuthNo)
+		bm.Set("out_request_no", record.PaymentID+"_UNFREEZE")
+		bm.Set("amount", fmt.Sprintf("%.2f", record.Amount))
+		bm.Set("remark", reason)
+		if _, err := ps.aliClient().FundAuthOrderUnfreeze(context.Background(), bm); err != nil {
+			return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("解冻支付宝预授权资金失败: %v", err)), nil
+		}
+	}
+
+	record.Status = StatusVoided
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+
+	return apierr.SuccessResponse(authorizationData(record)), nil
+}
+
+func (ps *PaymentService) authorizeStripe(req *AuthorizeRequest) (*apierr.Response, error) {
+	if ps.stripeClient == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "Stripe客户端未初始化"), nil
+	}
+
+	currency := strings.ToLower(req.Currency)
+	if currency == "" {
+		currency = "usd"
+	}
+
+	params := url.Values{}
+	params.Set("amount", fmt.Sprintf("%d", toMinorUnitsIn(req.Amount, currency)))
+	params.Set("currency", currency)
+	params.Set("capture_method", "manual")
+	params.Set("description", req.Subject)
+	params.Set("metadata[order_id]", req.OrderID)
+	if req.PaymentMethodID != "" {
+		params.Set("payment_method", req.PaymentMethodID)
+		params.Set("confirm", "true")
+	}
+
+	intent, err := ps.stripeClient.CreatePaymentIntent(context.Background(), params, req.OrderID+"_authorize")
+	ps.breakers["stripe"].Record(err)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("创建Stripe预授权失败: %v", err)), nil
+	}
+
+	record := &PaymentRecord{
+		PaymentID:       req.OrderID,
+		OrderID:         req.OrderID,
+		Method:          req.Method,
+		Amount:          req.Amount,
+		Currency:        strings.ToUpper(currency),
+		Subject:         req.Subject,
+		Status:          stripeIntentStatus(intent.Status),
+		ProviderTradeNo: intent.ID,
+		AuthNo:          intent.ID,
+		Metadata:        req.Metadata,
+	}
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+
+	data := authorizationData(record)
+	data.ClientSecret = intent.ClientSecret
+	data.ExpiredAt = authExpiry(req.ExpireMinutes)
+	return apierr.SuccessResponse(data), nil
+}
+
+func (ps *PaymentService) captureStripe(record *PaymentRecord, amount float64) (*apierr.Response, error) {
+	if ps.stripeClient == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "Stripe客户端未初始化"), nil
+	}
+
+	params := url.Values{}
+	params.Set("amount_to_capture", fmt.Sprintf("%d", toMinorUnitsIn(amount, record.Currency)))
+
+	intent, err := ps.stripeClient.CapturePaymentIntent(context.Background(), record.AuthNo, params, record.PaymentID+"_capture")
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("Stripe预授权扣款失败: %v", err)), nil
+	}
+
+	record.CapturedAmount = amount
+	record.Status = stripeIntentStatus(intent.Status)
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	if record.Status == StatusPaid {
+		if err := ps.postSale(record, amount); err != nil {
+			return nil, err
+		}
+		ps.afterPaid(record)
+	}
+
+	return apierr.SuccessResponse(authorizationData(record)), nil
+}
+
+func (ps *PaymentService) voidStripe(record *PaymentRecord, reason string) (*apierr.Response, error) {
+	if ps.stripeClient == nil {
+		return apierr.ErrorResponse("CLIENT_ERROR", "Stripe客户端未初始化"), nil
+	}
+
+	params := url.Values{}
+	params.Set("cancellation_reason", "requested_by_customer")
+	params.Set("metadata[void_reason]", reason)
+
+	intent, err := ps.stripeClient.CancelPaymentIntent(context.Background(), record.AuthNo, params, record.PaymentID+"_void")
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", fmt.Sprintf("撤销Stripe预授权失败: %v", err)), nil
+	}
+
+	record.Status = stripeIntentStatus(intent.Status)
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+
+	return apierr.SuccessResponse(authorizationData(record)), nil
+}
+
+// stripeIntentStatus 将 PaymentIntent 状态映射为本服务的支付状态
+func stripeIntentStatus(status string) string {
+	switch status {
+	case "requires_capture":
+		return StatusAuthorized
+	case "succeeded":
+		return StatusPaid
+	case "canceled":
+		return StatusVoided
+	case "requires_payment_method", "requires_confirmation", "requires_action", "processing":
+		return StatusPending
+	default:
+		return StatusFailed
+	}
+}
+
+func authorizationData(record *PaymentRecord) *AuthorizationData {
+	return &AuthorizationData{
+		PaymentID:        record.PaymentID,
+		Status:           record.Status,
+		AuthNo:           record.AuthNo,
+		AuthorizedAmount: record.Amount,
+		CapturedAmount:   record.CapturedAmount,
+	}
+}
+
+func authExpiry(expireMinutes int) string {
+	if expireMinutes <= 0 {
+		return ""
+	}
+	return time.Now().Add(time.Duration(expireMinutes) * time.Minute).Format(time.RFC3339)
+}
+
+// toMinorUnits 金额转换为分，用于人民币渠道（微信支付、支付宝）的金额参数和按分记账的内部台账；
+// 与支付记录的金额比较（可退金额、扣款上限、是否已全额退款）须按记录币种换算，见 toMinorUnitsIn
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// RetryHint 系统繁忙时返回给调用方的退避建议
+type RetryHint struct {
+	Component         string `json:"component"`
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retryAfterSeconds"`
+}
+
+// queueProbe 队列积压探针，积压超过上限时拒绝新建支付
+type queueProbe struct {
+	name  string
+	limit int
+	depth func() int
+}
+
+// Preflight 创建渠道订单前的容量检查：渠道熔断状态、存储健康、队列积压。
+// 系统无法可靠处理后续回调时拒绝下单，避免产生无人跟踪的渠道订单
+type Preflight struct {
+	breakers   map[string]*CircuitBreaker
+	store      PaymentStore
+	retryAfter time.Duration
+
+	inFlight    int64
+	maxInFlight int
+
+	mu     sync.RWMutex
+	probes []queueProbe
+}
+
+func NewPreflight(breakers map[string]*CircuitBreaker, store PaymentStore) *Preflight {
+	pf := &Preflight{
+		breakers:    breakers,
+		store:       store,
+		retryAfter:  envDuration("PREFLIGHT_RETRY_AFTER", 5*time.Second),
+		maxInFlight: envInt("PREFLIGHT_MAX_INFLIGHT", 200),
+	}
+	pf.AddQueueProbe("inflight_create", pf.maxInFlight, func() int {
+		return int(atomic.LoadInt64(&pf.inFlight))
+	})
+	return pf
+}
+
+// AddQueueProbe 注册队列积压探针
+func (pf *Preflight) AddQueueProbe(name string, limit int, depth func() int) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pf.probes = append(pf.probes, queueProbe{name: name, limit: limit, depth: depth})
+}
+
+// QueueDepth 队列当前积压
+type QueueDepth struct {
+	Name  string `json:"name"`
+	Depth int    `json:"depth"`
+	Limit int    `json:"limit"`
+}
+
+// QueueDepths 返回全部探针的当前积压
+func (pf *Preflight) QueueDepths() []QueueDepth {
+	pf.mu.RLock()
+	defer pf.mu.RUnlock()
+
+	depths := make([]QueueDepth, 0, len(pf.probes))
+	for _, probe := range pf.probes {
+		depths = append(depths, QueueDepth{Name: probe.name, Depth: probe.depth(), Limit: probe.limit})
+	}
+	return depths
+}
+
+// Check 检查指定支付方式当前是否可以下单，不可下单时返回退避建议
+func (pf *Preflight) Check(method string) *RetryHint {
+	if cb, ok := pf.breakers[method]; ok && !cb.Allow() {
+		return &RetryHint{
+			Component:         "provider:" + method,
+			Reason:            "支付渠道暂时不可用",
+			RetryAfterSeconds: seconds(cb.RetryAfter()),
+		}
+	}
+
+	if err := pf.store.Ping(); err != nil {
+		return &RetryHint{
+			Component:         "store",
+			Reason:            fmt.Sprintf("支付记录存储不可用: %v", err),
+			RetryAfterSeconds: seconds(pf.retryAfter),
+		}
+	}
+
+	pf.mu.RLock()
+	defer pf.mu.RUnlock()
+	for _, probe := range pf.probes {
+		depth := probe.depth()
+		if depth < probe.limit {
+			continue
+		}
+		// 积压越多建议等待越久，最多放大 4 倍
+		factor := math.Min(float64(depth)/float64(probe.limit), 4)
+		return &RetryHint{
+			Component:         "queue:" + probe.name,
+			Reason:            fmt.Sprintf("队列积压 %d 超过上限 %d", depth, probe.limit),
+			RetryAfterSeconds: seconds(time.Duration(float64(pf.retryAfter) * factor)),
+		}
+	}
+	return nil
+}
+
+// begin 记录一笔正在创建的支付，返回结束函数
+func (pf *Preflight) begin() func() {
+	atomic.AddInt64(&pf.inFlight, 1)
+	return func() {
+		atomic.AddInt64(&pf.inFlight, -1)
+	}
+}
+
+// retryLaterResponse 构造 RETRY_LATER 响应
+func retryLaterResponse(hint *RetryHint) *apierr.Response {
+	return &apierr.Response{
+		Success: false,
+		Code:    "RETRY_LATER",
+		Message: "系统繁忙，请稍后重试: " + hint.Reason,
+		Data:    hint,
+	}
+}
+
+// respondMaybeRetry 输出业务响应，RETRY_LATER 和 PROVIDER_MAINTENANCE 时返回 503 并附带 Retry-After 头
+func respondMaybeRetry(c *gin.Context, resp *apierr.Response) {
+	if hint, ok := resp.Data.(*RetryHint); ok && resp.Code == "RETRY_LATER" {
+		c.Header("Retry-After", strconv.Itoa(hint.RetryAfterSeconds))
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	if notice, ok := resp.Data.(*MaintenanceNotice); ok && resp.Code == "PROVIDER_MAINTENANCE" {
+		c.Header("Retry-After", strconv.Itoa(notice.RetryAfterSeconds))
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func seconds(d time.Duration) int {
+	if s := int(math.Ceil(d.Seconds())); s > 0 {
+		return s
+	}
+	return 1
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// UserDataExport 用户个人信息导出内容
+type UserDataExport struct {
+	UserID        string           `json:"userId"`
+	Payments      []*PaymentRecord `json:"payments"`
+	Refunds       []*RefundRecord  `json:"refunds"`
+	Subscriptions []*Agreement     `json:"subscriptions"`
+	Payouts       []*Payout        `json:"payouts"`
+	Wallet        []*WalletAccount `json:"wallet"`
+	WalletEntries []LedgerEntry    `json:"walletEntries"`
+	ExportedAt    time.Time        `json:"exportedAt"`
+}
+
+// UserErasure 个人信息删除结果
+type UserErasure struct {
+	UserID         string    `json:"userId"`
+	Payments       int       `json:"payments"`
+	Refunds        int       `json:"refunds"`
+	Subscriptions  int       `json:"subscriptions"`
+	Payouts        int       `json:"payouts"`
+	WalletAccounts int       `json:"walletAccounts"`
+	ErasedAt       time.Time `json:"erasedAt"`
+}
+
+// userPayments 用户名下的全部支付记录，组合支付的各段是独立的支付记录，一并返回
+func (ps *PaymentService) userPayments(userID string) ([]*PaymentRecord, error) {
+	records, err := ps.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var owned []*PaymentRecord
+	for _, record := range records {
+		if record.UserID == userID {
+			owned = append(owned, record)
+		}
+	}
+	return owned, nil
+}
+
+// userAgreements 用户签订的代扣协议
+func (ps *PaymentService) userAgreements(userID string) ([]*Agreement, error) {
+	agreements, err := ps.repo.Agreements.List()
+	if err != nil {
+		return nil, err
+	}
+	owned := []*Agreement{}
+	for _, agreement := range agreements {
+		if agreement.UserID == userID {
+			owned = append(owned, agreement)
+		}
+	}
+	return owned, nil
+}
+
+// userPayouts 从用户余额账户发起的提现
+func (ps *PaymentService) userPayouts(userID string) ([]*Payout, error) {
+	payouts, err := ps.repo.Payouts.List()
+	if err != nil {
+		return nil, err
+	}
+	owned := []*Payout{}
+	for _, payout := range payouts {
+		if payout.AccountID == userID {
+			owned = append(owned, payout)
+		}
+	}
+	return owned, nil
+}
+
+// ExportUserData 导出用户名下的支付、退款、代扣协议、提现及储值余额和流水
+func (ps *PaymentService) ExportUserData(userID, operator string) (*apierr.Response, error) {
+	payments, err := ps.userPayments(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &UserDataExport{UserID: userID, Payments: payments, Refunds: []*RefundRecord{}, ExportedAt: time.Now()}
+	for _, record := range payments {
+		refunds, err := ps.refunds.ListByPayment(record.PaymentID)
+		if err != nil {
+			return nil, err
+		}
+		export.Refunds = append(export.Refunds, refunds...)
+	}
+	if export.Subscriptions, err = ps.userAgreements(userID); err != nil {
+		return nil, err
+	}
+	if export.Payouts, err = ps.userPayouts(userID); err != nil {
+		return nil, err
+	}
+	if export.Wallet, err = ps.wallets.List(userID); err != nil {
+		return nil, err
+	}
+	if export.WalletEntries, err = ps.ledger.AccountEntries("wallet:" + userID); err != nil {
+		return nil, err
+	}
+	if export.Wallet == nil {
+		export.Wallet = []*WalletAccount{}
+	}
+	if export.WalletEntries == nil {
+		export.WalletEntries = []LedgerEntry{}
+	}
+
+	ps.audit.Record(AuditEntry{
+		Category: AuditPrivacy,
+		Action:   "privacy.export",
+		UserID:   userID,
+		Detail: fmt.Sprintf("%s 导出 %d 笔支付、%d 笔退款、%d 份代扣协议、%d 笔提现", operator,
+			len(payments), len(export.Refunds), len(export.Subscriptions), len(export.Payouts)),
+	})
+	return apierr.SuccessResponse(export), nil
+}
+
+// EraseUserData 匿名化用户名下的个人信息，用户编号替换为本次删除生成的假名，同一用户的记录仍可汇总：
+//   - 支付和退款保留金额、币种、状态、手续费、时间和渠道单号等对账所需字段，清空元数据、购方信息、渠道付款人和退款原因。
+//     组合支付的各段是独立的支付记录，一并处理；状态缓存随支付记录写入失效
+//   - 代扣协议、提现单、储值账户及其账本分录改挂到假名下，提现单的收款账号、姓名和备注清空
+//   - 审计日志和该用户支付的操作记录中的用户编号改为假名
+//
+// 有意保留的数据：归档到冷存储的 CSV 不含用户编号；审计日志中渠道通知的原始报文须原样保留用于验签回放；
+// 风控限速计数按时间窗口自动过期；加密货币网关的账单由网关服务处理。
+// 存在进行中的支付、退款或提现、未解约的代扣协议或储值余额未清零时拒绝删除，避免后续资金变动无法关联用户
+func (ps *PaymentService) EraseUserData(userID, operator string) (*apierr.Response, error) {
+	payments, err := ps.userPayments(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds := make(map[string][]*RefundRecord)
+	for _, record := range payments {
+		switch record.Status {
+		case StatusPending, StatusAuthorized, StatusScheduled:
+			return apierr.ErrorResponse("ERASURE_BLOCKED", fmt.Sprintf("支付 %s 尚未完成，请完成或关闭后再删除", record.PaymentID)), nil
+		}
+		list, err := ps.refunds.ListByPayment(record.PaymentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, refund := range list {
+			if refund.Status == RefundPending || refund.Status == RefundAwaitingApproval {
+				return apierr.ErrorResponse("ERASURE_BLOCKED", fmt.Sprintf("退款 %s 尚未完成，请完成后再删除", refund.RefundID)), nil
+			}
+		}
+		refunds[record.PaymentID] = list
+	}
+
+	agreements, err := ps.userAgreements(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, agreement := range agreements {
+		if agreement.Status != AgreementCancelled {
+			return apierr.ErrorResponse("ERASURE_BLOCKED", fmt.Sprintf("代扣协议 %s 尚未解约，请解约后再删除", agreement.AgreementID)), nil
+		}
+	}
+	payouts, err := ps.userPayouts(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, payout := range payouts {
+		if payout.Status == PayoutPendingApproval || payout.Status == PayoutProcessing {
+			return apierr.ErrorResponse("ERASURE_BLOCKED", fmt.Sprintf("提现 %s 尚未完成，请完成后再删除", payout.PayoutID)), nil
+		}
+	}
+	accounts, err := ps.wallets.List(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		if toMinorUnitsIn(account.Balance, account.Currency) != 0 {
+			return apierr.ErrorResponse("ERASURE_BLOCKED", fmt.Sprintf("%s 储值余额 %s 未清零，请提现或退回后再删除",
+				account.Currency, formatAmount(account.Balance, account.Currency))), nil
+		}
+	}
+
+	pseudonym := fmt.Sprintf("erased-%d%s", time.Now().UnixNano(), util.RandomNumber(6))
+	result := &UserErasure{UserID: userID, ErasedAt: time.Now()}
+	for _, record := range payments {
+		anonymizePayment(record, pseudonym)
+		if err := ps.store.Save(record); err != nil {
+			return nil, err
+		}
+		for _, refund := range refunds[record.PaymentID] {
+			refund.Reason = ""
+			if err := ps.refunds.Save(refund); err != nil {
+				return nil, err
+			}
+			result.Refunds++
+		}
+		ps.actions.Redact(record.PaymentID, userID, pseudonym)
+		ps.actions.Record(record.PaymentID, operator, "privacy.erase", "用户个人信息已匿名化")
+		result.Payments++
+	}
+	for _, agreement := range agreements {
+		agreement.UserID = pseudonym
+		if err := ps.repo.Agreements.Save(agreement); err != nil {
+			return nil, err
+		}
+		result.Subscriptions++
+	}
+	for _, payout := range payouts {
+		payout.AccountID = pseudonym
+		payout.PayeeAccount = ""
+		payout.PayeeName = ""
+		payout.Remark = ""
+		if err := ps.repo.Payouts.Save(payout); err != nil {
+			return nil, err
+		}
+		result.Payouts++
+	}
+	if err := ps.wallets.Rename(userID, pseudonym); err != nil {
+		return nil, err
+	}
+	if err := ps.ledger.RenameAccount("wallet:"+userID, "wallet:"+pseudonym); err != nil {
+		return nil, err
+	}
+	result.WalletAccounts = len(accounts)
+	ps.audit.Pseudonymize(userID, pseudonym)
+
+	ps.audit.Record(AuditEntry{
+		Category: AuditPrivacy,
+		Action:   "privacy.erase",
+		UserID:   pseudonym,
+		Detail: fmt.Sprintf("%s 删除用户个人信息，涉及 %d 笔支付、%d 笔退款、%d 份代扣协议、%d 笔提现、%d 个储值账户", operator,
+			result.Payments, result.Refunds, result.Subscriptions, result.Payouts, result.WalletAccounts),
+	})
+	return apierr.SuccessResponse(result), nil
+}
+
+func anonymizePayment(record *PaymentRecord, pseudonym string) {
+	record.UserID = pseudonym
+	record.PayerID = ""
+	record.Metadata = nil
+	if record.Invoice != nil {
+		invoice := *record.Invoice
+		invoice.InvoiceRequest = InvoiceRequest{Type: invoice.Type}
+		record.Invoice = &invoice
+	}
+	if record.Scheduled != nil {
+		scheduled := *record.Scheduled
+		scheduled.Request.UserID = pseudonym
+		scheduled.Request.Metadata = nil
+		scheduled.Request.Invoice = nil
+		record.Scheduled = &scheduled
+	}
+}
+
+// registerPrivacyRoutes 注册个人信息导出和删除接口，处理个人信息主体请求。需要运营或合规角色，
+// 审计日志和操作记录中的操作人取访问令牌中的用户名
+func registerPrivacyRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	privacy := api.Group("/privacy/users/:userId")
+
+	privacy.POST("/export", func(c *gin.Context) {
+		resp, err := ps.ExportUserData(c.Param("userId"), operatorFromRequest(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	privacy.POST("/erase", func(c *gin.Context) {
+		resp, err := ps.EraseUserData(c.Param("userId"), operatorFromRequest(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
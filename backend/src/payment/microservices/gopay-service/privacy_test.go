@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestEraseUserDataLeavesNoUserID 删除后各存储、审计日志和操作记录中不再出现用户编号
+func TestEraseUserDataLeavesNoUserID(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+	ps := &PaymentService{
+		repo:    repo,
+		store:   repo.Payments,
+		refunds: repo.Refunds,
+		wallets: repo.Wallets,
+		ledger:  repo.Ledger,
+		actions: NewActionLog(),
+		audit:   NewAuditLog(),
+	}
+	const userID = "user-7731"
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(repo.Payments.Save(&PaymentRecord{PaymentID: "P1", OrderID: "ORD1", UserID: userID, Method: "split", Amount: 100, Currency: "CNY",
+		Status: StatusPartiallyRefunded, PayerID: "2088", Metadata: map[string]interface{}{"note": userID}}))
+	must(repo.Payments.Save(&PaymentRecord{PaymentID: "P1_EXT", OrderID: "ORD1", UserID: userID, Method: "alipay", Amount: 60, Currency: "CNY",
+		Status: StatusPaid, ParentPaymentID: "P1"}))
+	must(repo.Refunds.Save(&RefundRecord{RefundID: "R1", PaymentID: "P1", Amount: 20, Currency: "CNY", Destination: RefundToBalance,
+		Status: RefundSucceeded, Reason: "应 " + userID + " 要求退款"}))
+	_, err := repo.Wallets.Credit(userID, "CNY", 20)
+	must(err)
+	must(repo.Ledger.Post(
+		LedgerEntry{TxnID: "R1", Account: "merchant:refunds", Direction: Debit, Amount: 20, Currency: "CNY"},
+		LedgerEntry{TxnID: "R1", Account: "wallet:" + userID, Direction: Credit, Amount: 20, Currency: "CNY"},
+	))
+	agreement := &Agreement{AgreementID: "SUB1", UserID: userID, Method: "alipay", Amount: 10, Currency: "CNY", Status: AgreementActive}
+	must(repo.Agreements.Save(agreement))
+	must(repo.Payouts.Save(&Payout{PayoutID: "PO1", AccountID: userID, Channel: "alipay", Amount: 5, Currency: "CNY",
+		PayeeAccount: "user@example.com", PayeeName: "张三", Status: PayoutSucceeded}))
+	ps.actions.Record("P1", "ops", "note", "已联系用户 "+userID)
+
+	resp, err := ps.ExportUserData(userID, "ops")
+	must(err)
+	export := resp.Data.(*UserDataExport)
+	if len(export.Payments) != 2 || len(export.Refunds) != 1 || len(export.Subscriptions) != 1 || len(export.Payouts) != 1 ||
+		len(export.Wallet) != 1 || len(export.WalletEntries) != 1 {
+		t.Fatalf("导出内容不完整: %+v", export)
+	}
+
+	// 未解约的代扣协议和未清零的余额都会阻止删除
+	if resp, err := ps.EraseUserData(userID, "ops"); err != nil || resp.Code != "ERASURE_BLOCKED" {
+		t.Fatalf("代扣协议未解约时应拒绝删除，实际 %+v %v", resp, err)
+	}
+	agreement.Status = AgreementCancelled
+	must(repo.Agreements.Save(agreement))
+	if resp, err := ps.EraseUserData(userID, "ops"); err != nil || resp.Code != "ERASURE_BLOCKED" {
+		t.Fatalf("余额未清零时应拒绝删除，实际 %+v %v", resp, err)
+	}
+	_, err = repo.Wallets.Debit(userID, "CNY", 20)
+	must(err)
+
+	resp, err = ps.EraseUserData(userID, "ops")
+	must(err)
+	if !resp.Success {
+		t.Fatalf("删除失败: %+v", resp)
+	}
+
+	payments, err := repo.Payments.List()
+	must(err)
+	var refunds []*RefundRecord
+	for _, id := range []string{"P1", "P1_EXT"} {
+		list, err := repo.Refunds.ListByPayment(id)
+		must(err)
+		refunds = append(refunds, list...)
+	}
+	agreements, err := repo.Agreements.List()
+	must(err)
+	payouts, err := repo.Payouts.List()
+	must(err)
+	accounts, err := repo.Wallets.List(userID)
+	must(err)
+	entries, err := repo.Ledger.All()
+	must(err)
+	remaining := map[string]interface{}{
+		"支付记录": payments,
+		"退款记录": refunds,
+		"代扣协议": agreements,
+		"提现单":  payouts,
+		"储值账户": accounts,
+		"账本分录": entries,
+		"审计日志": ps.audit.List("", 100),
+		"操作记录": append(ps.actions.ListByPayment("P1"), ps.actions.ListByPayment("P1_EXT")...),
+	}
+	for name, v := range remaining {
+		data, err := json.Marshal(v)
+		must(err)
+		if strings.Contains(string(data), userID) {
+			t.Errorf("%s 中仍有用户编号: %s", name, data)
+		}
+	}
+	if payouts[0].PayeeAccount != "" || payouts[0].PayeeName != "" {
+		t.Errorf("提现单的收款账号和姓名未清空: %+v", payouts[0])
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/alipay"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 拨测步骤
+const (
+	ProbeStepCreate = "create"
+	ProbeStepClose  = "close"
+)
+
+// ProbeResult 一次拨测的结果
+type ProbeResult struct {
+	Provider             string    `json:"provider"`
+	Success              bool      `json:"success"`
+	FailedStep           string    `json:"failedStep,omitempty"`
+	Error                string    `json:"error,omitempty"`
+	CreateLatencySeconds float64   `json:"createLatencySeconds"`
+	CloseLatencySeconds  float64   `json:"closeLatencySeconds"`
+	CheckedAt            time.Time `json:"checkedAt"`
+}
+
+// SyntheticProber 定时对各渠道执行一次下单并立即关单的拨测，在用户受影响前发现渠道退化。
+// 拨测订单号以 PROBE 开头，不写入支付记录、不记账、不推送事件。
+// 使用与线上下单相同的渠道客户端，沙箱环境即探测沙箱，生产环境即探测生产
+type SyntheticProber struct {
+	payments  *PaymentService
+	enabled   bool
+	providers []string
+	interval  time.Duration
+	timeout   time.Duration
+	amount    float64
+
+	mu   sync.RWMutex
+	last map[string]*ProbeResult
+	runs map[string]map[bool]int64 // 渠道 -> 是否成功 -> 次数
+}
+
+// NewSyntheticProber PROBE_ENABLED=true 时启用，拨测会在渠道侧产生真实的待支付订单
+func NewSyntheticProber(payments *PaymentService) *SyntheticProber {
+	return &SyntheticProber{
+		payments:  payments,
+		enabled:   os.Getenv("PROBE_ENABLED") == "true",
+		providers: splitList(envString("PROBE_PROVIDERS", "alipay,wechat")),
+		interval:  envDuration("PROBE_INTERVAL", 5*time.Minute),
+		timeout:   envDuration("PROBE_TIMEOUT", 15*time.Second),
+		amount:    envFloat("PROBE_AMOUNT", 0.01),
+		last:      make(map[string]*ProbeResult),
+		runs:      make(map[string]map[bool]int64),
+	}
+}
+
+func (sp *SyntheticProber) Run(ctx context.Context) {
+	if !sp.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(sp.interval)
+	defer ticker.Stop()
+
+	sp.ProbeAll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sp.ProbeAll(ctx)
+		}
+	}
+}
+
+// ProbeAll 依次拨测全部渠道，未初始化客户端的渠道跳过
+func (sp *SyntheticProber) ProbeAll(ctx context.Context) []*ProbeResult {
+	results := make([]*ProbeResult, 0, len(sp.providers))
+	for _, provider := range sp.providers {
+		result := sp.probe(ctx, provider)
+		if result == nil {
+			continue
+		}
+		if !result.Success {
+			log.Printf("【警告】渠道 %s 拨测失败（%s）: %s", provider, result.FailedStep, result.Error)
+			reportWarning("渠道拨测失败: "+result.Error, map[string]string{"component": "prober", "provider": provider, "step": result.FailedStep})
+		}
+
+		sp.mu.Lock()
+		sp.last[provider] = result
+		if sp.runs[provider] == nil {
+			sp.runs[provider] = make(map[bool]int64)
+		}
+		sp.runs[provider][result.Success]++
+		sp.mu.Unlock()
+		results = append(results, result)
+	}
+	return results
+}
+
+func (sp *SyntheticProber) probe(ctx context.Context, provider string) *ProbeResult {
+	var create, closeOrder func(ctx context.Context, tradeNo string) error
+	switch provider {
+	case "alipay":
+		if sp.payments.aliClient() == nil {
+			return nil
+		}
+		create, closeOrder = sp.createAlipay, sp.closeAlipay
+	case "wechat":
+		if sp.payments.wxClient() == nil {
+			return nil
+		}
+		create, closeOrder = sp.createWechat, sp.closeWechat
+	default:
+		return nil
+	}
+
+	result := &ProbeResult{Provider: provider, CheckedAt: time.Now()}
+	tradeNo := fmt.Sprintf("PROBE%d%s", time.Now().UnixNano(), util.RandomNumber(4))
+
+	stepCtx, cancel := context.WithTimeout(ctx, sp.timeout)
+	start := time.Now()
+	err := create(stepCtx, tradeNo)
+	cancel()
+	result.CreateLatencySeconds = time.Since(start).Seconds()
+	if err != nil {
+		result.FailedStep, result.Error = ProbeStepCreate, err.Error()
+		return result
+	}
+
+	stepCtx, cancel = context.WithTimeout(ctx, sp.timeout)
+	start = time.Now()
+	err = closeOrder(stepCtx, tradeNo)
+	cancel()
+	result.CloseLatencySeconds = time.Since(start).Seconds()
+	if err != nil {
+		result.FailedStep, result.Error = ProbeStepClose, err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func (sp *SyntheticProber) createAlipay(ctx context.Context, tradeNo string) error {
+	bm := make(gopay.BodyMap)
+	bm.Set("out_trade_no", tradeNo)
+	bm.Set("total_amount", fmt.Sprintf("%.2f", sp.amount))
+	bm.Set("subject", "渠道拨测")
+	bm.Set("timeout_express", "1m")
+	_, err := sp.payments.aliClient().TradePrecreate(ctx, bm)
+	return err
+}
+
+// closeAlipay 预下单的交易在买家扫码前不存在，TRADE_NOT_EXIST 说明关单请求已正常往返
+func (sp *SyntheticProber) closeAlipay(ctx context.Context, tradeNo string) error {
+	bm := make(gopay.BodyMap)
+	bm.Set("out_trade_no", tradeNo)
+	_, err := sp.payments.aliClient().TradeClose(ctx, bm)
+	if bizErr, ok := alipay.IsBizError(err); ok && bizErr.SubCode == "ACQ.TRADE_NOT_EXIST" {
+		return nil
+	}
+	return err
+}
+
+func (sp *SyntheticProber) createWechat(ctx context.Context, tradeNo string) error {
+	bm := make(gopay.BodyMap)
+	bm.Set("out_trade_no", tradeNo)
+	bm.Set("nonce_str", util.RandomString(32))
+	bm.Set("total_fee", toMinorUnits(sp.amount))
+	bm.Set("body", "渠道拨测")
+	bm.Set("spbill_create_ip", "127.0.0.1")
+	bm.Set("trade_type", "NATIVE")
+	wxRsp, err := sp.payments.wxClient().UnifiedOrder(ctx, bm)
+	if err != nil {
+		return err
+	}
+	if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
+		return fmt.Errorf("%s %s", wxRsp.ReturnMsg, wxRsp.ErrCodeDes)
+	}
+	return nil
+}
+
+func (sp *SyntheticProber) closeWechat(ctx context.Context, tradeNo string) error {
+	bm := make(gopay.BodyMap)
+	bm.Set("out_trade_no", tradeNo)
+	bm.Set("nonce_str", util.RandomString(32))
+	wxRsp, err := sp.payments.wxClient().CloseOrder(ctx, bm)
+	if err != nil {
+		return err
+	}
+	if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
+		return errors.New(wxRsp.ReturnMsg + " " + wxRsp.ErrCodeDes)
+	}
+	return nil
+}
+
+// Results 返回各渠道最近一次拨测结果
+func (sp *SyntheticProber) Results() []ProbeResult {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	results := make([]ProbeResult, 0, len(sp.last))
+	for _, result := range sp.last {
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Provider < results[j].Provider })
+	return results
+}
+
+// writeMetrics 以 Prometheus 文本格式输出拨测指标，便于按渠道配置成功率和延迟告警
+func (sp *SyntheticProber) writeMetrics(b *strings.Builder) {
+	results := sp.Results()
+
+	b.WriteString("# HELP gopay_probe_success 最近一次渠道拨测是否成功（1 成功，0 失败）\n")
+	b.WriteString("# TYPE gopay_probe_success gauge\n")
+	for _, r := range results {
+		success := 0
+		if r.Success {
+			success = 1
+		}
+		fmt.Fprintf(b, "gopay_probe_success{provider=%q} %d\n", r.Provider, success)
+	}
+
+	b.WriteString("# HELP gopay_probe_latency_seconds 最近一次渠道拨测各步骤耗时\n")
+	b.WriteString("# TYPE gopay_probe_latency_seconds gauge\n")
+	for _, r := range results {
+		fmt.Fprintf(b, "gopay_probe_latency_seconds{provider=%q,step=%q} %g\n", r.Provider, ProbeStepCreate, r.CreateLatencySeconds)
+		if r.FailedStep != ProbeStepCreate {
+			fmt.Fprintf(b, "gopay_probe_latency_seconds{provider=%q,step=%q} %g\n", r.Provider, ProbeStepClose, r.CloseLatencySeconds)
+		}
+	}
+
+	b.WriteString("# HELP gopay_probe_last_run_timestamp_seconds 最近一次渠道拨测的时间\n")
+	b.WriteString("# TYPE gopay_probe_last_run_timestamp_seconds gauge\n")
+	for _, r := range results {
+		fmt.Fprintf(b, "gopay_probe_last_run_timestamp_seconds{provider=%q} %d\n", r.Provider, r.CheckedAt.Unix())
+	}
+
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	b.WriteString("# HELP gopay_probe_runs_total 渠道拨测次数\n")
+	b.WriteString("# TYPE gopay_probe_runs_total counter\n")
+	for _, r := range results {
+		for _, success := range []bool{true, false} {
+			result := "failure"
+			if success {
+				result = "success"
+			}
+			fmt.Fprintf(b, "gopay_probe_runs_total{provider=%q,result=%q} %d\n", r.Provider, result, sp.runs[r.Provider][success])
+		}
+	}
+}
+
+// registerProbeRoutes 注册拨测结果查询、手动触发接口及供 Prometheus 抓取的 /metrics
+func registerProbeRoutes(r *gin.Engine, api *gin.RouterGroup, sp *SyntheticProber) {
+	r.GET("/metrics", func(c *gin.Context) {
+		var b strings.Builder
+		sp.writeMetrics(&b)
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+	})
+
+	admin := api.Group("/admin")
+
+	admin.GET("/probes", func(c *gin.Context) {
+		apierr.RespondOK(c, sp.Results())
+	})
+
+	admin.POST("/probes/run", func(c *gin.Context) {
+		apierr.RespondOK(c, sp.ProbeAll(c.Request.Context()))
+	})
+}
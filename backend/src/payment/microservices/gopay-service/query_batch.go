@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// BatchQueryResult 批量查询中单笔支付的状态
+type BatchQueryResult struct {
+	PaymentID      string    `json:"paymentId"`
+	Found          bool      `json:"found"`
+	Status         string    `json:"status,omitempty"`
+	Method         string    `json:"method,omitempty"`
+	Amount         float64   `json:"amount,omitempty"`
+	RefundedAmount float64   `json:"refundedAmount,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt,omitempty"`
+}
+
+type batchQueryRequest struct {
+	PaymentIDs []string `json:"paymentIds" binding:"required"`
+}
+
+// BatchQuery 批量查询支付状态，结果顺序与请求一致，重复的支付单号只查询一次。
+// 与单笔查询一样，待支付的记录会向渠道同步，最多 QUERY_BATCH_CONCURRENCY 个并发，避免夜间同步时压垮渠道
+func (ps *PaymentService) BatchQuery(paymentIDs []string) (*apierr.Response, error) {
+	maxIDs := envInt("QUERY_BATCH_MAX_IDS", 500)
+	if len(paymentIDs) == 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "paymentIds 不能为空"), nil
+	}
+	if len(paymentIDs) > maxIDs {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("单次最多查询 %d 笔，当前 %d 笔", maxIDs, len(paymentIDs))), nil
+	}
+
+	unique := make(map[string]*BatchQueryResult, len(paymentIDs))
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, envInt("QUERY_BATCH_CONCURRENCY", 8))
+	)
+	for _, id := range paymentIDs {
+		if _, ok := unique[id]; ok {
+			continue
+		}
+		result := &BatchQueryResult{PaymentID: id}
+		unique[id] = result
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ps.queryOne(result)
+		}()
+	}
+	wg.Wait()
+
+	results := make([]*BatchQueryResult, len(paymentIDs))
+	for i, id := range paymentIDs {
+		results[i] = unique[id]
+	}
+	return apierr.SuccessResponse(results), nil
+}
+
+func (ps *PaymentService) queryOne(result *BatchQueryResult) {
+	record, err := ps.store.Get(result.PaymentID)
+	if err != nil {
+		return
+	}
+	if record.Status == StatusPending {
+		if err := ps.syncPaymentStatus(record); err != nil {
+			log.Printf("同步支付状态失败 %s: %v", record.PaymentID, err)
+		}
+	}
+	result.Found = true
+	result.Status = record.Status
+	result.Method = record.Method
+	result.Amount = record.Amount
+	result.RefundedAmount = record.RefundedAmount
+	result.UpdatedAt = record.UpdatedAt
+}
+
+// registerBatchQueryRoutes 注册批量查询接口，供订单服务夜间同步使用
+func registerBatchQueryRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	api.POST("/payment/query/batch", func(c *gin.Context) {
+		var req batchQueryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.BatchQuery(req.PaymentIDs)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
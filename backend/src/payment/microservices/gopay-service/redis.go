@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	redisOnce   sync.Once
+	redisClient *redis.Client
+)
+
+// sharedRedis 按 REDIS_URL 创建进程内共享的 Redis 客户端，未配置或地址无效时返回 nil
+func sharedRedis() *redis.Client {
+	redisOnce.Do(func() {
+		raw := os.Getenv("REDIS_URL")
+		if raw == "" {
+			return
+		}
+		opts, err := redis.ParseURL(raw)
+		if err != nil {
+			log.Printf("解析 REDIS_URL 失败，改用进程内存储: %v", err)
+			return
+		}
+		redisClient = redis.NewClient(opts)
+	})
+	return redisClient
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 退款去向
+const (
+	RefundToSource  = "source"  // 原路退回
+	RefundToBalance = "balance" // 退至用户储值余额，实时到账
+)
+
+// 退款状态
+const (
+	RefundPending          = "pending"
+	RefundAwaitingApproval = "awaiting_approval" // 超过审批阈值，等待复核
+	RefundRejected         = "rejected"
+	RefundSucceeded        = "succeeded"
+	RefundFailed           = "failed"
+)
+
+const (
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+var ErrRefundNotFound = errors.New("退款记录不存在")
+
+type RefundRequest struct {
+	PaymentID   string  `json:"paymentId" binding:"required"`
+	Amount      float64 `json:"amount"` // 为空时退还剩余可退金额
+	Reason      string  `json:"reason"`
+	Destination string  `json:"destination"` // source | balance，为空时使用租户默认策略
+}
+
+// RefundRecord 退款记录
+type RefundRecord struct {
+	RefundID         string     `json:"refundId"`
+	PaymentID        string     `json:"paymentId"`
+	TenantID         string     `json:"tenantId"`
+	Method           string     `json:"method"`
+	Amount           float64    `json:"amount"`
+	Currency         string     `json:"currency,omitempty"`
+	Destination      string     `json:"destination"`
+	Status           string     `json:"status"`
+	Reason           string     `json:"reason,omitempty"`
+	ProviderRefundNo string     `json:"providerRefundNo,omitempty"`
+	FeeReturned      float64    `json:"feeReturned,omitempty"`
+	FailureReason    string     `json:"failureReason,omitempty"`
+	RequestedBy      string     `json:"requestedBy,omitempty"`
+	ReviewedBy       string     `json:"reviewedBy,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewedAt,omitempty"`
+	ReviewNote       string     `json:"reviewNote,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// RefundStore 退款记录存储
+type RefundStore interface {
+	Save(refund *RefundRecord) error
+	Get(refundID string) (*RefundRecord, error)
+	ListByPayment(paymentID string) ([]*RefundRecord, error)
+	List() ([]*RefundRecord, error)
+	Delete(refundID string) error
+}
+
+type memoryRefundStore struct {
+	mu      sync.RWMutex
+	refunds map[string]*RefundRecord
+}
+
+func NewMemoryRefundStore() RefundStore {
+	return &memoryRefundStore{refunds: make(map[string]*RefundRecord)}
+}
+
+func (s *memoryRefundStore) Save(refund *RefundRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = now
+	}
+	refund.UpdatedAt = now
+
+	copied := *refund
+	s.refunds[refund.RefundID] = &copied
+	return nil
+}
+
+func (s *memoryRefundStore) Get(refundID string) (*RefundRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refund, ok := s.refunds[refundID]
+	if !ok {
+		return nil, ErrRefundNotFound
+	}
+	copied := *refund
+	return &copied, nil
+}
+
+func (s *memoryRefundStore) ListByPayment(paymentID string) ([]*RefundRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var refunds []*RefundRecord
+	for _, refund := range s.refunds {
+		if refund.PaymentID == paymentID {
+			copied := *refund
+			refunds = append(refunds, &copied)
+		}
+	}
+	sort.Slice(refunds, func(i, j int) bool {
+		return refunds[i].CreatedAt.Before(refunds[j].CreatedAt)
+	})
+	return refunds, nil
+}
+
+func (s *memoryRefundStore) List() ([]*RefundRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refunds := make([]*RefundRecord, 0, len(s.refunds))
+	for _, refund := range s.refunds {
+		copied := *refund
+		refunds = append(refunds, &copied)
+	}
+	sort.Slice(refunds, func(i, j int) bool {
+		return refunds[i].CreatedAt.After(refunds[j].CreatedAt)
+	})
+	return refunds, nil
+}
+
+// Delete 删除退款记录，仅用于归档后清理
+func (s *memoryRefundStore) Delete(refundID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.refunds, refundID)
+	return nil
+}
+
+// Refund 发起退款，按请求或租户默认策略选择原路退回或退至余额。
+// 超过审批阈值的退款先进入待审批状态，由另一名审批人批准后才调用渠道
+func (ps *PaymentService) Refund(tenantID, operator string, req *RefundRequest) (*apierr.Response, error) {
+	record, err := ps.store.Get(req.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	// 同一支付单的退款串行执行，持锁后基于最新记录计算可退金额；不同支付单的退款互不阻塞
+	var resp *apierr.Response
+	err = ps.withPaymentLock(record, func() error {
+		var err error
+		resp, err = ps.refund(tenantID, operator, record, req)
+		return err
+	})
+	return resp, err
+}
+
+// refund 校验并执行退款，调用方须持有支付单锁
+func (ps *PaymentService) refund(tenantID, operator string, record *PaymentRecord, req *RefundRequest) (*apierr.Response, error) {
+	if record.Status != StatusPaid && record.Status != StatusPartiallyRefunded {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许退款: %s", record.Status)), nil
+	}
+
+	destination := req.Destination
+	if destination == "" {
+		destination = ps.tenants.Get(tenantID).RefundDestination
+	}
+	if destination != RefundToSource && destination != RefundToBalance {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的退款去向: %s", destination)), nil
+	}
+	if destination == RefundToBalance && record.UserID == "" {
+		return apierr.ErrorResponse("INVALID_PARAMS", "支付记录未关联用户，无法退至余额"), nil
+	}
+
+	refundable, err := ps.refundable(record, "")
+	if err != nil {
+		return nil, err
+	}
+	amount := req.Amount
+	if amount <= 0 {
+		amount = refundable
+	}
+	if amount <= 0 {
+		return apierr.ErrorResponse("AMOUNT_EXCEEDED", "没有可退金额，可能已有退款在审批中"), nil
+	}
+	if toMinorUnitsIn(amount, record.Currency) > toMinorUnitsIn(refundable, record.Currency) {
+		return apierr.ErrorResponse("AMOUNT_EXCEEDED", fmt.Sprintf("退款金额 %.2f 超过可退金额 %.2f", amount, refundable)), nil
+	}
+
+	refund := &RefundRecord{
+		RefundID:    fmt.Sprintf("RF%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		PaymentID:   record.PaymentID,
+		TenantID:    tenantID,
+		Method:      record.Method,
+		Amount:      amount,
+		Currency:    record.Currency,
+		Destination: destination,
+		Status:      RefundPending,
+		Reason:      req.Reason,
+		RequestedBy: operator,
+	}
+
+	if ps.approvals.Required(amount) {
+		refund.Status = RefundAwaitingApproval
+		if err := ps.refunds.Save(refund); err != nil {
+			return nil, err
+		}
+		ps.actions.Record(record.PaymentID, operator, "refund.request", fmt.Sprintf("%s %.2f 待审批", refund.RefundID, amount))
+		log.Printf("退款 %s 金额 %.2f 超过审批阈值 %.2f，等待审批", refund.RefundID, amount, ps.approvals.threshold)
+		return apierr.SuccessResponse(refund), nil
+	}
+
+	return ps.executeRefund(record, refund)
+}
+
+// refundable 计算剩余可退金额，待审批的退款占用额度；excludeRefundID 为正在审批的退款自身
+func (ps *PaymentService) refundable(record *PaymentRecord, excludeRefundID string) (float64, error) {
+	refundable := record.Amount - record.RefundedAmount
+	if record.CapturedAmount > 0 {
+		refundable = record.CapturedAmount - record.RefundedAmount
+	}
+
+	refunds, err := ps.refunds.ListByPayment(record.PaymentID)
+	if err != nil {
+		return 0, err
+	}
+	for _, refund := range refunds {
+		if refund.Status == RefundAwaitingApproval && refund.RefundID != excludeRefundID {
+			refundable -= refund.Amount
+		}
+	}
+	return roundAmountIn(refundable, record.Currency), nil
+}
+
+// executeRefund 调用渠道或余额完成退款并更新支付记录
+func (ps *PaymentService) executeRefund(record *PaymentRecord, refund *RefundRecord) (*apierr.Response, error) {
+	amount := refund.Amount
+	if refund.Destination == RefundToSource {
+		// 渠道维护期间不发起退款，退款不落库，待审批的退款保持待审批
+		if notice := ps.maintenance.Notice(record.Method); notice != nil {
+			return maintenanceResponse(notice), nil
+		}
+		refund.FeeReturned = ps.fees.RefundedFee(record, amount)
+	}
+
+	var err error
+	if refund.Destination == RefundToBalance {
+		err = ps.refundToBalance(record, refund)
+	} else {
+		err = ps.refundToSource(record, refund)
+	}
+	if err != nil {
+		refund.Status = RefundFailed
+		refund.FailureReason = err.Error()
+		if saveErr := ps.refunds.Save(refund); saveErr != nil {
+			return nil, saveErr
+		}
+		ps.settleSaga(record, refund)
+		return &apierr.Response{Success: false, Code: "REFUND_ERROR", Message: err.Error(), Data: refund}, nil
+	}
+
+	refund.Status = RefundSucceeded
+	if err := ps.refunds.Save(refund); err != nil {
+		return nil, err
+	}
+
+	record.RefundedAmount = roundAmountIn(record.RefundedAmount+amount, record.Currency)
+	record.FeeRefunded = roundAmountIn(record.FeeRefunded+refund.FeeReturned, record.Currency)
+	refunded := toMinorUnitsIn(record.RefundedAmount, record.Currency)
+	if refunded >= toMinorUnitsIn(record.Amount, record.Currency) ||
+		(record.CapturedAmount > 0 && refunded >= toMinorUnitsIn(record.CapturedAmount, record.Currency)) {
+		record.Status = StatusRefunded
+	} else {
+		record.Status = StatusPartiallyRefunded
+	}
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	ps.settleSaga(record, refund)
+
+	return apierr.SuccessResponse(refund), nil
+}
+
+// refundToBalance 退款金额实时记入用户储值余额
+func (ps *PaymentService) refundToBalance(record *PaymentRecord, refund *RefundRecord) error {
+	account, err := ps.wallets.Credit(record.UserID, record.Currency, refund.Amount)
+	if err != nil {
+		return fmt.Errorf("退款至余额失败: %w", err)
+	}
+	log.Printf("退款 %s 已记入用户 %s 余额，当前余额 %.2f", refund.RefundID, record.UserID, account.Balance)
+
+	return ps.postRefundEntries(refund, "wallet:"+record.UserID)
+}
+
+// refundToSource 调用渠道原路退回
+func (ps *PaymentService) refundToSource(record *PaymentRecord, refund *RefundRecord) error {
+	if err := ps.chaos.BeforeProviderCall(record.Method, "refund"); err != nil {
+		return err
+	}
+	if ps.mock.Handles(record.Method) {
+		return ps.refundMockPayment(record, refund)
+	}
+	switch record.Method {
+	case "alipay":
+		if ps.aliClient() == nil {
+			return errors.New("支付宝客户端未初始化")
+		}
+		bm := make(gopay.BodyMap)
+		bm.Set("out_trade_no", outTradeNo(record))
+		bm.Set("refund_amount", formatAmount(refund.Amount, record.Currency))
+		bm.Set("out_request_no", refund.RefundID)
+		if record.Forex != nil {
+			// 跨境支付按标价币种退款，结算币种的退款金额由支付宝按退款时的汇率折算
+			bm.Set("refund_currency", record.Forex.TransCurrency)
+		}
+		if refund.Reason != "" {
+			bm.Set("refund_reason", refund.Reason)
+		}
+		aliRsp, err := ps.aliClient().TradeRefund(context.Background(), bm)
+		if err != nil {
+			return fmt.Errorf("支付宝退款失败: %w", err)
+		}
+		refund.ProviderRefundNo = aliRsp.Response.TradeNo
+	case "wechat":
+		if ps.wxClient() == nil {
+			return errors.New("微信客户端未初始化")
+		}
+		bm := make(gopay.BodyMap)
+		bm.Set("nonce_str", util.RandomString(32))
+		bm.Set("out_trade_no", outTradeNo(record))
+		bm.Set("out_refund_no", refund.RefundID)
+		bm.Set("total_fee", toMinorUnits(record.Amount))
+		bm.Set("refund_fee", toMinorUnits(refund.Amount))
+		if refund.Reason != "" {
+			bm.Set("refund_desc", refund.Reason)
+		}
+		wxRsp, _, err := ps.wxClient().Refund(context.Background(), bm)
+		if err != nil {
+			return fmt.Errorf("微信退款失败: %w", err)
+		}
+		if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
+			return fmt.Errorf("微信退款失败: %s", wxRsp.ErrCodeDes)
+		}
+		refund.ProviderRefundNo = wxRsp.RefundId
+	case "stripe":
+		if ps.stripeClient == nil {
+			return errors.New("Stripe客户端未初始化")
+		}
+		params := url.Values{}
+		params.Set("payment_intent", record.ProviderTradeNo)
+		params.Set("amount", fmt.Sprintf("%d", toMinorUnitsIn(refund.Amount, record.Currency)))
+		stripeRefund, err := ps.stripeClient.CreateRefund(context.Background(), params, refund.RefundID)
+		if err != nil {
+			return fmt.Errorf("Stripe退款失败: %w", err)
+		}
+		refund.ProviderRefundNo = stripeRefund.ID
+	case "balance":
+		// 余额支付的原路即用户余额
+		return ps.refundToBalance(record, refund)
+	case "giftcard":
+		// 礼品卡支付退回原卡
+		if err := ps.giftCards.Restore(record.GiftCardNo, refund.Amount); err != nil {
+			return fmt.Errorf("退回礼品卡失败: %w", err)
+		}
+		return ps.postRefundEntries(refund, "giftcard:"+record.GiftCardNo)
+	default:
+		return fmt.Errorf("不支持原路退款的支付方式: %s", record.Method)
+	}
+
+	return ps.postRefundEntries(refund, "clearing:"+record.Method)
+}
+
+// postRefundEntries 记录退款分录：借记退款支出，贷记资金去向账户；渠道退还的手续费冲减手续费支出
+func (ps *PaymentService) postRefundEntries(refund *RefundRecord, creditAccount string) error {
+	description := fmt.Sprintf("退款 %s（%s）", refund.PaymentID, refund.Destination)
+	entries := []LedgerEntry{
+		{TxnID: refund.RefundID, Account: "merchant:refunds", Direction: Debit, Amount: refund.Amount, Currency: refund.Currency, Description: description},
+		{TxnID: refund.RefundID, Account: creditAccount, Direction: Credit, Amount: roundAmountIn(refund.Amount-refund.FeeReturned, refund.Currency), Currency: refund.Currency, Description: description},
+	}
+	if refund.FeeReturned > 0 {
+		entries = append(entries, LedgerEntry{TxnID: refund.RefundID, Account: "fees:" + refund.Method, Direction: Credit, Amount: refund.FeeReturned, Currency: refund.Currency, Description: description})
+	}
+	return ps.ledger.Post(entries...)
+}
+
+// registerRefundRoutes 注册退款接口
+func registerRefundRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	createRefund := func(c *gin.Context) {
+		var req RefundRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.Refund(tenantFromRequest(c), operatorFromRequest(c), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		respondMaybeRetry(c, resp)
+	}
+	api.POST("/refunds", createRefund)
+	// 兼容旧路径
+	api.POST("/payment/refund", createRefund)
+
+	api.GET("/refunds/:refundId", func(c *gin.Context) {
+		refund, err := ps.refunds.Get(c.Param("refundId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "REFUND_NOT_FOUND", err.Error())
+			return
+		}
+
+		apierr.RespondOK(c, refund)
+	})
+
+	api.GET("/refunds", func(c *gin.Context) {
+		paymentID, status := c.Query("paymentId"), c.Query("status")
+		if paymentID == "" && status == "" {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "paymentId 和 status 不能同时为空")
+			return
+		}
+
+		var refunds []*RefundRecord
+		var err error
+		if paymentID != "" {
+			refunds, err = ps.refunds.ListByPayment(paymentID)
+		} else {
+			refunds, err = ps.refunds.List()
+		}
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		// 按状态过滤，审批人用 status=awaiting_approval 查看待审批退款
+		filtered := make([]*RefundRecord, 0, len(refunds))
+		for _, refund := range refunds {
+			if status == "" || refund.Status == status {
+				filtered = append(filtered, refund)
+			}
+		}
+		apierr.RespondOK(c, filtered)
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// RefundApprovalPolicy 退款复核策略：超过阈值的退款需由具备审批角色的另一人批准
+type RefundApprovalPolicy struct {
+	threshold     float64 // 小于等于 0 时不需要审批
+	approverRoles map[string]bool
+}
+
+func NewRefundApprovalPolicy() *RefundApprovalPolicy {
+	roles := os.Getenv("REFUND_APPROVER_ROLES")
+	if roles == "" {
+		roles = RoleFinance
+	}
+	policy := &RefundApprovalPolicy{
+		threshold:     envFloat("REFUND_APPROVAL_THRESHOLD", 5000),
+		approverRoles: make(map[string]bool),
+	}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			policy.approverRoles[role] = true
+		}
+	}
+	return policy
+}
+
+// Required 退款金额是否需要审批
+func (p *RefundApprovalPolicy) Required(amount float64) bool {
+	return p.threshold > 0 && toMinorUnits(amount) > toMinorUnits(p.threshold)
+}
+
+// CanApprove 操作人是否具备审批角色
+func (p *RefundApprovalPolicy) CanApprove(roles []string) bool {
+	for _, role := range roles {
+		if p.approverRoles[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// operatorRolesFromRequest 获取操作人角色：启用 JWT 认证时取令牌中的角色，
+// 否则取 X-Operator-Roles 请求头，多个角色以逗号分隔
+func operatorRolesFromRequest(c *gin.Context) []string {
+	if principal := principalFromRequest(c); principal != nil {
+		return principal.Roles
+	}
+	var roles []string
+	for _, role := range strings.Split(c.GetHeader("X-Operator-Roles"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// ReviewRefund 审批待复核的退款。批准后才调用渠道退款，审批人不能是发起人
+func (ps *PaymentService) ReviewRefund(refundID, operator string, approve bool, note string) (*apierr.Response, error) {
+	refund, err := ps.refunds.Get(refundID)
+	if err != nil {
+		return apierr.ErrorResponse("REFUND_NOT_FOUND", err.Error()), nil
+	}
+	// 与同一支付单的退款申请串行，持锁后重新读取退款单，并发审批时只有一次生效
+	unlock, err := ps.lockPayment(refund.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if refund, err = ps.refunds.Get(refundID); err != nil {
+		return nil, err
+	}
+	if refund.Status != RefundAwaitingApproval {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("退款当前状态不需要审批: %s", refund.Status)), nil
+	}
+	if operator == refund.RequestedBy {
+		return apierr.ErrorResponse("SELF_APPROVAL", "不能审批自己发起的退款"), nil
+	}
+
+	now := time.Now()
+	refund.ReviewedBy = operator
+	refund.ReviewedAt = &now
+	refund.ReviewNote = note
+
+	if !approve {
+		refund.Status = RefundRejected
+		if err := ps.refunds.Save(refund); err != nil {
+			return nil, err
+		}
+		ps.actions.Record(refund.PaymentID, operator, "refund.reject", fmt.Sprintf("%s %s", refund.RefundID, note))
+		if record, err := ps.store.Get(refund.PaymentID); err == nil {
+			ps.settleSaga(record, refund)
+		}
+		log.Printf("退款 %s 已被 %s 驳回", refund.RefundID, operator)
+		return apierr.SuccessResponse(refund), nil
+	}
+
+	// 审批期间支付状态可能已变化，重新校验
+	record, err := ps.store.Get(refund.PaymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if record.Status != StatusPaid && record.Status != StatusPartiallyRefunded {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("当前状态不允许退款: %s", record.Status)), nil
+	}
+	refundable, err := ps.refundable(record, refund.RefundID)
+	if err != nil {
+		return nil, err
+	}
+	if toMinorUnitsIn(refund.Amount, record.Currency) > toMinorUnitsIn(refundable, record.Currency) {
+		return apierr.ErrorResponse("AMOUNT_EXCEEDED", fmt.Sprintf("退款金额 %.2f 超过可退金额 %.2f", refund.Amount, refundable)), nil
+	}
+
+	refund.Status = RefundPending
+	ps.actions.Record(refund.PaymentID, operator, "refund.approve", fmt.Sprintf("%s %s", refund.RefundID, note))
+	log.Printf("退款 %s 已由 %s 批准，发起人 %s", refund.RefundID, operator, refund.RequestedBy)
+	return ps.executeRefund(record, refund)
+}
+
+type refundReviewRequest struct {
+	Note string `json:"note"`
+}
+
+// registerRefundApprovalRoutes 注册退款审批接口，审批人需具备 REFUND_APPROVER_ROLES 中的角色
+func registerRefundApprovalRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	review := func(approve bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var req refundReviewRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+					return
+				}
+			}
+			if !ps.approvals.CanApprove(operatorRolesFromRequest(c)) {
+				apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", "没有退款审批权限")
+				return
+			}
+
+			resp, err := ps.ReviewRefund(c.Param("refundId"), operatorFromRequest(c), approve, req.Note)
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+
+			respondMaybeRetry(c, resp)
+		}
+	}
+
+	api.POST("/refunds/:refundId/approve", review(true))
+	api.POST("/refunds/:refundId/reject", review(false))
+}
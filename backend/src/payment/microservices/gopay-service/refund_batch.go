@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 批量退款任务状态
+const (
+	RefundBatchProcessing = "processing"
+	RefundBatchCompleted  = "completed"
+)
+
+// 批量退款明细状态
+const (
+	RefundItemQueued           = "queued"
+	RefundItemSucceeded        = "succeeded"
+	RefundItemFailed           = "failed"
+	RefundItemAwaitingApproval = "awaiting_approval" // 超过审批阈值，已生成待审批退款
+)
+
+var ErrRefundBatchNotFound = errors.New("批量退款任务不存在")
+
+// RefundBatchItem 批量退款中的一笔
+type RefundBatchItem struct {
+	Index    int           `json:"index"`
+	Request  RefundRequest `json:"request"`
+	Status   string        `json:"status"`
+	RefundID string        `json:"refundId,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Message  string        `json:"message,omitempty"`
+}
+
+// RefundBatch 批量退款任务，用于商品召回等场景的大批量撤单
+type RefundBatch struct {
+	BatchID     string            `json:"batchId"`
+	TenantID    string            `json:"tenantId"`
+	RequestedBy string            `json:"requestedBy"`
+	Status      string            `json:"status"`
+	Total       int               `json:"total"`
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	Awaiting    int               `json:"awaitingApproval"`
+	Items       []RefundBatchItem `json:"items"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+}
+
+// RefundBatchStore 批量退款任务存储
+type RefundBatchStore interface {
+	Save(batch *RefundBatch) error
+	Get(batchID string) (*RefundBatch, error)
+	// UpdateItem 更新一笔明细的结果并重新汇总，全部完成时任务置为 completed
+	UpdateItem(batchID string, item RefundBatchItem) (*RefundBatch, error)
+}
+
+type memoryRefundBatchStore struct {
+	mu      sync.RWMutex
+	batches map[string]*RefundBatch
+}
+
+func NewMemoryRefundBatchStore() RefundBatchStore {
+	return &memoryRefundBatchStore{batches: make(map[string]*RefundBatch)}
+}
+
+func (s *memoryRefundBatchStore) Save(batch *RefundBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches[batch.BatchID] = copyRefundBatch(batch)
+	return nil
+}
+
+func (s *memoryRefundBatchStore) Get(batchID string) (*RefundBatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batch, ok := s.batches[batchID]
+	if !ok {
+		return nil, ErrRefundBatchNotFound
+	}
+	return copyRefundBatch(batch), nil
+}
+
+func (s *memoryRefundBatchStore) UpdateItem(batchID string, item RefundBatchItem) (*RefundBatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch, ok := s.batches[batchID]
+	if !ok {
+		return nil, ErrRefundBatchNotFound
+	}
+	if item.Index < 0 || item.Index >= len(batch.Items) {
+		return nil, fmt.Errorf("批量退款 %s 明细序号越界: %d", batchID, item.Index)
+	}
+	if batch.Items[item.Index].Status != RefundItemQueued {
+		return nil, fmt.Errorf("批量退款 %s 明细 %d 已处理", batchID, item.Index)
+	}
+	batch.Items[item.Index] = item
+
+	batch.Succeeded, batch.Failed, batch.Awaiting = 0, 0, 0
+	for _, it := range batch.Items {
+		switch it.Status {
+		case RefundItemSucceeded:
+			batch.Succeeded++
+		case RefundItemFailed:
+			batch.Failed++
+		case RefundItemAwaitingApproval:
+			batch.Awaiting++
+		}
+	}
+	if batch.Succeeded+batch.Failed+batch.Awaiting == batch.Total {
+		now := time.Now()
+		batch.Status = RefundBatchCompleted
+		batch.CompletedAt = &now
+	}
+	return copyRefundBatch(batch), nil
+}
+
+func copyRefundBatch(batch *RefundBatch) *RefundBatch {
+	copied := *batch
+	copied.Items = append([]RefundBatchItem(nil), batch.Items...)
+	return &copied
+}
+
+// refundTask 工作池中的一笔待处理退款
+type refundTask struct {
+	batchID  string
+	tenantID string
+	operator string
+	item     RefundBatchItem
+}
+
+// RefundBatchProcessor 接收批量退款并由固定大小的工作池异步处理
+type RefundBatchProcessor struct {
+	ps       *PaymentService
+	store    RefundBatchStore
+	queue    chan refundTask
+	workers  int
+	maxItems int
+}
+
+func NewRefundBatchProcessor(ps *PaymentService) *RefundBatchProcessor {
+	return &RefundBatchProcessor{
+		ps:       ps,
+		store:    NewMemoryRefundBatchStore(),
+		queue:    make(chan refundTask, envInt("REFUND_BATCH_QUEUE_SIZE", 10000)),
+		workers:  envInt("REFUND_BATCH_WORKERS", 4),
+		maxItems: envInt("REFUND_BATCH_MAX_ITEMS", 500),
+	}
+}
+
+// QueueDepth 待处理的退款明细
+func (p *RefundBatchProcessor) QueueDepth() QueueDepth {
+	return QueueDepth{Name: "refund_batch", Depth: len(p.queue), Limit: cap(p.queue)}
+}
+
+// Submit 登记批量退款并入队，立即返回任务
+func (p *RefundBatchProcessor) Submit(tenantID, operator string, requests []RefundRequest) (*apierr.Response, error) {
+	if len(requests) == 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "退款明细不能为空"), nil
+	}
+	if len(requests) > p.maxItems {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("单批最多 %d 笔退款，当前 %d 笔", p.maxItems, len(requests))), nil
+	}
+	if len(requests) > cap(p.queue)-len(p.queue) {
+		return apierr.ErrorResponse("QUEUE_FULL", "退款队列已满，请稍后重试"), nil
+	}
+
+	batch := &RefundBatch{
+		BatchID:     fmt.Sprintf("RB%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		TenantID:    tenantID,
+		RequestedBy: operator,
+		Status:      RefundBatchProcessing,
+		Total:       len(requests),
+		Items:       make([]RefundBatchItem, len(requests)),
+		CreatedAt:   time.Now(),
+	}
+	for i, req := range requests {
+		batch.Items[i] = RefundBatchItem{Index: i, Request: req, Status: RefundItemQueued}
+	}
+	if err := p.store.Save(batch); err != nil {
+		return nil, err
+	}
+
+	// 队列容量已在上面检查，并发提交时可能短暂阻塞
+	for _, item := range batch.Items {
+		p.queue <- refundTask{batchID: batch.BatchID, tenantID: tenantID, operator: operator, item: item}
+	}
+	log.Printf("批量退款 %s 已受理，共 %d 笔", batch.BatchID, batch.Total)
+	return apierr.SuccessResponse(batch), nil
+}
+
+// Run 启动工作池，ctx 结束后不再处理新的明细
+func (p *RefundBatchProcessor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-p.queue:
+					p.process(task)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *RefundBatchProcessor) process(task refundTask) {
+	item := task.item
+	req := item.Request
+
+	resp, err := p.ps.Refund(task.tenantID, task.operator, &req)
+	switch {
+	case err != nil:
+		item.Status = RefundItemFailed
+		item.Code = "INTERNAL_ERROR"
+		item.Message = err.Error()
+	case !resp.Success:
+		item.Status = RefundItemFailed
+		item.Code = resp.Code
+		item.Message = resp.Message
+	default:
+		item.Status = RefundItemSucceeded
+	}
+	if resp != nil {
+		if refund, ok := resp.Data.(*RefundRecord); ok {
+			item.RefundID = refund.RefundID
+			if refund.Status == RefundAwaitingApproval {
+				item.Status = RefundItemAwaitingApproval
+			}
+		}
+	}
+
+	batch, err := p.store.UpdateItem(task.batchID, item)
+	if err != nil {
+		log.Printf("更新批量退款 %s 明细 %d 失败: %v", task.batchID, item.Index, err)
+		return
+	}
+	// 每笔明细只更新一次，只有最后一笔会看到任务完成
+	if batch.Status == RefundBatchCompleted {
+		log.Printf("批量退款 %s 处理完成：成功 %d，失败 %d，待审批 %d", batch.BatchID, batch.Succeeded, batch.Failed, batch.Awaiting)
+	}
+}
+
+type refundBatchRequest struct {
+	Items []RefundRequest `json:"items" binding:"required,dive"`
+}
+
+// registerRefundBatchRoutes 注册批量退款接口
+func registerRefundBatchRoutes(api *gin.RouterGroup, p *RefundBatchProcessor) {
+	api.POST("/payment/refund/batch", func(c *gin.Context) {
+		var req refundBatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := p.Submit(tenantFromRequest(c), operatorFromRequest(c), req.Items)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.GET("/payment/refund/batch/:batchId", func(c *gin.Context) {
+		batch, err := p.store.Get(c.Param("batchId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "BATCH_NOT_FOUND", err.Error())
+			return
+		}
+
+		// 只返回指定状态的明细，便于重试失败项
+		if status := c.Query("status"); status != "" {
+			items := make([]RefundBatchItem, 0, len(batch.Items))
+			for _, item := range batch.Items {
+				if item.Status == status {
+					items = append(items, item)
+				}
+			}
+			batch.Items = items
+		}
+		apierr.RespondOK(c, batch)
+	})
+}
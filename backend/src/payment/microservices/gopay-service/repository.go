@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// 存储驱动，STORE_DRIVER 配置
+const (
+	StoreMemory = "memory"
+	StoreSQLite = "sqlite"
+)
+
+// Repository 支付、退款、储值余额、账本、礼品卡、代扣协议和提现付款的存储，按 STORE_DRIVER 选择实现：
+// memory（默认）为进程内存储，重启后数据丢失，测试直接使用；
+// sqlite 写入 SQLITE_PATH（默认 gopay.db）指定的文件，本地开发不依赖 Docker Compose 即可跑通完整支付流程
+type Repository struct {
+	Payments PaymentStore
+	Refunds  RefundStore
+	Wallets  WalletStore
+	Ledger   Ledger
+
+	GiftCards  GiftCardStore
+	Agreements AgreementStore
+	Payouts    PayoutStore
+
+	driver string
+	db     *sql.DB
+}
+
+// NewRepository 按配置创建存储，SQLite 文件无法打开时退出进程
+func NewRepository() *Repository {
+	driver := envString("STORE_DRIVER", StoreMemory)
+	switch driver {
+	case StoreMemory:
+		return NewMemoryRepository()
+	case StoreSQLite:
+		if currentEnvironment() == "production" {
+			log.Printf("【警告】生产环境使用 SQLite 存储，仅适用于单实例部署")
+		}
+		repo, err := NewSQLiteRepository(envString("SQLITE_PATH", "gopay.db"))
+		if err != nil {
+			log.Fatalf("打开 SQLite 存储失败: %v", err)
+		}
+		return repo
+	default:
+		log.Fatalf("不支持的 STORE_DRIVER: %s，可选 %s、%s", driver, StoreMemory, StoreSQLite)
+		return nil
+	}
+}
+
+func NewMemoryRepository() *Repository {
+	return &Repository{
+		Payments: NewMemoryPaymentStore(),
+		Refunds:  NewMemoryRefundStore(),
+		Wallets:  NewMemoryWalletStore(),
+		Ledger:   NewMemoryLedger(),
+
+		GiftCards:  NewMemoryGiftCardStore(),
+		Agreements: NewMemoryAgreementStore(),
+		Payouts:    NewMemoryPayoutStore(),
+
+		driver: StoreMemory,
+	}
+}
+
+// openCryptoDB 加密货币网关的数据库连接，与法币渠道使用同一个 SQLite 文件和表结构版本；进程内存储时返回 nil
+func openCryptoDB() (*sql.DB, error) {
+	if envString("STORE_DRIVER", StoreMemory) != StoreSQLite {
+		return nil, nil
+	}
+	db, err := openSQLite(envString("SQLITE_PATH", "gopay.db"))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Driver 当前使用的存储驱动
+func (r *Repository) Driver() string {
+	return r.driver
+}
+
+// Close 关闭数据库连接，进程内存储无需关闭
+func (r *Repository) Close() error {
+	if r == nil || r.db == nil {
+		return nil
+	}
+	return r.db.Close()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// VelocityLimit 滑动窗口内允许的下单次数，Max 为 0 表示不限制
+type VelocityLimit struct {
+	Max           int `json:"max"`
+	WindowSeconds int `json:"windowSeconds"`
+}
+
+func (v VelocityLimit) window() time.Duration {
+	return time.Duration(v.WindowSeconds) * time.Second
+}
+
+// RiskRules 下单前的风控规则
+type RiskRules struct {
+	PerUser   VelocityLimit      `json:"perUser"`
+	PerIP     VelocityLimit      `json:"perIp"`
+	MaxAmount map[string]float64 `json:"maxAmount,omitempty"` // 按支付方式的单笔上限
+	Denylist  []string           `json:"denylist,omitempty"`  // 正则，匹配 orderId 或 userId 时拒绝
+}
+
+// RiskEngine 按规则检查下单请求：用户/IP 频率、单笔金额上限、黑名单
+type RiskEngine struct {
+	mu       sync.Mutex
+	rules    RiskRules
+	patterns []*regexp.Regexp
+	hits     map[string][]time.Time
+}
+
+// NewRiskEngine 从 RISK_RULES_FILE 加载规则，未配置时使用 RISK_USER_LIMIT / RISK_IP_LIMIT 的默认频率限制
+func NewRiskEngine() *RiskEngine {
+	re := &RiskEngine{hits: make(map[string][]time.Time)}
+	defaults := RiskRules{
+		PerUser: VelocityLimit{Max: envInt("RISK_USER_LIMIT", 20), WindowSeconds: 600},
+		PerIP:   VelocityLimit{Max: envInt("RISK_IP_LIMIT", 60), WindowSeconds: 600},
+	}
+	if err := re.Replace(defaults); err != nil {
+		log.Printf("加载默认风控规则失败: %v", err)
+	}
+
+	if path := os.Getenv("RISK_RULES_FILE"); path != "" {
+		if err := re.loadFile(path); err != nil {
+			log.Printf("加载风控规则失败，使用默认规则: %v", err)
+		}
+	}
+	return re
+}
+
+func (re *RiskEngine) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rules RiskRules
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return err
+	}
+	return re.Replace(rules)
+}
+
+// Replace 校验并替换全部规则
+func (re *RiskEngine) Replace(rules RiskRules) error {
+	for _, limit := range []VelocityLimit{rules.PerUser, rules.PerIP} {
+		if limit.Max < 0 || (limit.Max > 0 && limit.WindowSeconds <= 0) {
+			return fmt.Errorf("频率限制需要正的 max 和 windowSeconds")
+		}
+	}
+	for method, max := range rules.MaxAmount {
+		if max <= 0 {
+			return fmt.Errorf("%s 单笔上限必须大于 0", method)
+		}
+	}
+	patterns := make([]*regexp.Regexp, 0, len(rules.Denylist))
+	for _, expr := range rules.Denylist {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("黑名单规则无效 %q: %w", expr, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	re.rules = rules
+	re.patterns = patterns
+	return nil
+}
+
+func (re *RiskEngine) Rules() RiskRules {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	return re.rules
+}
+
+// Check 返回拒绝原因，通过时返回空字符串。被拒绝的请求同样计入频率
+func (re *RiskEngine) Check(req *PaymentRequest) string {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	for _, pattern := range re.patterns {
+		if pattern.MatchString(req.OrderID) || (req.UserID != "" && pattern.MatchString(req.UserID)) {
+			return "订单或用户命中黑名单"
+		}
+	}
+	if max, ok := re.rules.MaxAmount[req.Method]; ok && req.Amount > max {
+		return fmt.Sprintf("%s 单笔金额不能超过 %.2f", req.Method, max)
+	}
+
+	now := time.Now()
+	var reason string
+	if req.UserID != "" && re.hit("user:"+req.TenantID+":"+req.UserID, re.rules.PerUser, now) {
+		reason = "该用户下单过于频繁，请稍后再试"
+	}
+	if req.ClientIP != "" && re.hit("ip:"+req.ClientIP, re.rules.PerIP, now) && reason == "" {
+		reason = "该 IP 下单过于频繁，请稍后再试"
+	}
+	return reason
+}
+
+// hit 记录一次下单并返回是否超过频率限制
+func (re *RiskEngine) hit(key string, limit VelocityLimit, now time.Time) bool {
+	if limit.Max <= 0 {
+		return false
+	}
+	cutoff := now.Add(-limit.window())
+	recent := re.hits[key][:0]
+	for _, t := range re.hits[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	re.hits[key] = append(recent, now)
+	return len(recent) >= limit.Max
+}
+
+// Run 定时清理窗口外的计数，避免长期不活跃的用户和 IP 占用内存
+func (re *RiskEngine) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			re.mu.Lock()
+			window := re.rules.PerUser.window()
+			if w := re.rules.PerIP.window(); w > window {
+				window = w
+			}
+			for key, times := range re.hits {
+				if len(times) == 0 || now.Sub(times[len(times)-1]) > window {
+					delete(re.hits, key)
+				}
+			}
+			re.mu.Unlock()
+		}
+	}
+}
+
+// registerRiskRoutes 注册风控规则配置接口
+func registerRiskRoutes(api *gin.RouterGroup, re *RiskEngine) {
+	admin := api.Group("/admin")
+
+	admin.GET("/risk/rules", func(c *gin.Context) {
+		apierr.RespondOK(c, re.Rules())
+	})
+
+	admin.PUT("/risk/rules", func(c *gin.Context) {
+		var rules RiskRules
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		if err := re.Replace(rules); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, re.Rules())
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gopay-service/internal/apierr"
+)
+
+// 订单履约 Saga 状态
+const (
+	SagaFulfilled          = "fulfilled"           // 订单服务已确认履约
+	SagaCompensating       = "compensating"        // 已发起补偿退款，等待审批或渠道恢复
+	SagaCompensated        = "compensated"         // 补偿退款成功
+	SagaCompensationFailed = "compensation_failed" // 补偿退款失败或被驳回，需人工处理
+)
+
+// sagaOperator 补偿退款的发起人，executeRefund 据此推进 Saga
+const sagaOperator = "saga"
+
+// SagaState 支付与订单履约的协调状态
+type SagaState struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"` // 订单服务拒绝履约的原因
+	RefundID  string    `json:"refundId,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// FulfillmentRequest 订单服务回报的履约结果
+type FulfillmentRequest struct {
+	Status string `json:"status"` // fulfilled | rejected
+	Reason string `json:"reason"` // 拒绝原因，如库存不足
+}
+
+// ReportFulfillment 处理订单服务的履约结果。拒绝履约时对已收款的支付全额退款，退款成功后推送 payment.compensated；
+// 退款进入审批或因渠道维护未发起时保持 compensating，重复回报 rejected 会重试补偿
+func (ps *PaymentService) ReportFulfillment(paymentID string, req *FulfillmentRequest) (*apierr.Response, error) {
+	record, err := ps.store.Get(paymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+
+	if saga := record.Saga; saga != nil {
+		switch {
+		case saga.Status == SagaFulfilled && req.Status == SagaFulfilled,
+			saga.Status == SagaCompensated && req.Status == "rejected":
+			return apierr.SuccessResponse(saga), nil
+		case saga.Status == SagaFulfilled || saga.Status == SagaCompensated:
+			return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("履约结果已确定: %s", saga.Status)), nil
+		case saga.Status == SagaCompensating && saga.RefundID != "":
+			if refund, err := ps.refunds.Get(saga.RefundID); err == nil && refund.Status == RefundAwaitingApproval {
+				return apierr.SuccessResponse(saga), nil
+			}
+		}
+	}
+	if record.Status != StatusPaid && record.Status != StatusPartiallyRefunded {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("支付尚未完成，当前状态: %s", record.Status)), nil
+	}
+
+	if req.Status == SagaFulfilled {
+		record.Saga = &SagaState{Status: SagaFulfilled, UpdatedAt: time.Now()}
+		if err := ps.store.Save(record); err != nil {
+			return nil, err
+		}
+		return apierr.SuccessResponse(record.Saga), nil
+	}
+
+	record.Saga = &SagaState{Status: SagaCompensating, Reason: req.Reason, UpdatedAt: time.Now()}
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	ps.actions.Record(paymentID, sagaOperator, "saga.compensate", req.Reason)
+
+	reason := "订单履约失败"
+	if req.Reason != "" {
+		reason += ": " + req.Reason
+	}
+	resp, err := ps.Refund(record.TenantID, sagaOperator, &RefundRequest{PaymentID: paymentID, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+
+	// 同步完成的退款已由 executeRefund 推进 Saga，这里处理审批中和未发起的情况
+	record, err = ps.store.Get(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Saga.Status == SagaCompensating {
+		if refund, ok := resp.Data.(*RefundRecord); ok && resp.Success {
+			record.Saga.RefundID = refund.RefundID
+		} else if !resp.Success {
+			record.Saga.Error = resp.Code + ": " + resp.Message
+			if resp.Code != "PROVIDER_MAINTENANCE" {
+				record.Saga.Status = SagaCompensationFailed
+			}
+		}
+		record.Saga.UpdatedAt = time.Now()
+		if err := ps.store.Save(record); err != nil {
+			return nil, err
+		}
+	}
+	return apierr.SuccessResponse(record.Saga), nil
+}
+
+// settleSaga 补偿退款完成、失败或被驳回时推进 Saga，由退款流程调用
+func (ps *PaymentService) settleSaga(record *PaymentRecord, refund *RefundRecord) {
+	if record.Saga == nil || record.Saga.Status != SagaCompensating || refund.RequestedBy != sagaOperator {
+		return
+	}
+	record.Saga.RefundID = refund.RefundID
+	record.Saga.UpdatedAt = time.Now()
+	switch refund.Status {
+	case RefundSucceeded:
+		record.Saga.Status = SagaCompensated
+		record.Saga.Error = ""
+	case RefundFailed, RefundRejected:
+		record.Saga.Status = SagaCompensationFailed
+		record.Saga.Error = refund.FailureReason
+		if refund.Status == RefundRejected {
+			record.Saga.Error = "补偿退款被驳回: " + refund.ReviewNote
+		}
+	default:
+		return
+	}
+	if err := ps.store.Save(record); err != nil {
+		log.Printf("更新支付 %s 的 Saga 状态失败: %v", record.PaymentID, err)
+		return
+	}
+	if record.Saga.Status == SagaCompensated {
+		log.Printf("支付 %s 已补偿退款 %s", record.PaymentID, refund.RefundID)
+		ps.webhooks.Emit(record.TenantID, EventPaymentCompensated, record)
+	} else {
+		log.Printf("【警告】支付 %s 补偿退款失败，需人工处理: %s", record.PaymentID, record.Saga.Error)
+	}
+}
+
+// FulfillmentEvent 订单服务通过事件总线发布的履约结果
+type FulfillmentEvent struct {
+	PaymentID   string `json:"paymentId"`
+	OrderID     int64  `json:"orderId"`
+	OrderNumber string `json:"orderNumber"`
+	Status      string `json:"status"` // fulfilled | rejected
+	Reason      string `json:"reason"`
+}
+
+// RunFulfillmentConsumer 配置 ORDER_FULFILLMENT_TOPIC 时从事件总线消费履约结果。
+// 拒绝履约会触发全额退款，履约结果只从内部事件总线接收，不提供 HTTP 回报接口
+func (ps *PaymentService) RunFulfillmentConsumer(ctx context.Context, bus EventBus) {
+	topic := os.Getenv("ORDER_FULFILLMENT_TOPIC")
+	if topic == "" {
+		return
+	}
+	group := envString("ORDER_FULFILLMENT_GROUP", "gopay-saga")
+	err := bus.Subscribe(ctx, topic, group, func(ctx context.Context, msg BusMessage) error {
+		var event FulfillmentEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			return fmt.Errorf("履约事件格式错误: %w", err)
+		}
+		paymentID := event.PaymentID
+		if paymentID == "" {
+			paymentID = event.OrderNumber
+		}
+		if paymentID == "" && event.OrderID != 0 {
+			paymentID = strconv.FormatInt(event.OrderID, 10)
+		}
+		if event.Status != SagaFulfilled && event.Status != "rejected" {
+			return fmt.Errorf("未知的履约结果: %s", event.Status)
+		}
+		resp, err := ps.ReportFulfillment(paymentID, &FulfillmentRequest{Status: event.Status, Reason: event.Reason})
+		if err != nil {
+			return err
+		}
+		if !resp.Success {
+			return fmt.Errorf("支付 %s: %s", paymentID, resp.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("订阅履约事件失败: %v", err)
+	}
+}
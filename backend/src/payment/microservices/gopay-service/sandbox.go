@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// SeedRequest 演示数据生成参数
+type SeedRequest struct {
+	Count int   `json:"count"` // 默认 30，最多 1000
+	Seed  int64 `json:"seed"`  // 相同的种子生成相同的数据，为 0 时随机
+}
+
+// SeedResult 演示数据生成结果
+type SeedResult struct {
+	Seeded     int            `json:"seeded"`
+	Seed       int64          `json:"seed"`
+	ByStatus   map[string]int `json:"byStatus"`
+	PaymentIDs []string       `json:"paymentIds"`
+}
+
+// seedScenario 一类演示支付：支付方式、渠道产品和最终状态
+type seedScenario struct {
+	method  string
+	channel string
+	status  string
+	refund  float64 // 退款比例，0 表示不退款
+}
+
+var seedScenarios = []seedScenario{
+	{method: "alipay", channel: "page", status: StatusPaid},
+	{method: "alipay", channel: "app", status: StatusPaid},
+	{method: "wechat", channel: "native", status: StatusPaid},
+	{method: "balance", status: StatusPaid},
+	{method: "giftcard", status: StatusPaid},
+	{method: "alipay", channel: "page", status: StatusRefunded, refund: 1},
+	{method: "wechat", channel: "native", status: StatusPartiallyRefunded, refund: 0.3},
+	{method: "alipay", channel: "page", status: StatusClosed},    // 超时未支付
+	{method: "wechat", channel: "native", status: StatusPending}, // 等待扫码
+	{method: "crypto", status: StatusPending},                    // 链上确认中
+}
+
+var seedSubjects = []string{"无线降噪耳机", "机械键盘", "27 英寸显示器", "运动手环", "咖啡豆 1kg", "双肩背包", "儿童绘本套装", "空气净化器滤芯"}
+
+// SeedDemoData 写入覆盖各支付方式和状态的演示支付，不调用任何真实渠道。
+// 记录带有 metadata.sandboxSeed 标记，支付单号以 DEMO 开头
+func (ps *PaymentService) SeedDemoData(tenantID string, req *SeedRequest) (*SeedResult, error) {
+	count := req.Count
+	if count <= 0 {
+		count = 30
+	}
+	if count > 1000 {
+		count = 1000
+	}
+	seed := req.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	result := &SeedResult{Seed: seed, ByStatus: make(map[string]int)}
+	for i := 0; i < count; i++ {
+		scenario := seedScenarios[i%len(seedScenarios)]
+		record, err := ps.seedPayment(tenantID, seed, i, scenario, rng)
+		if err != nil {
+			return nil, err
+		}
+		result.Seeded++
+		result.ByStatus[record.Status]++
+		result.PaymentIDs = append(result.PaymentIDs, record.PaymentID)
+	}
+	return result, nil
+}
+
+func (ps *PaymentService) seedPayment(tenantID string, seed int64, index int, scenario seedScenario, rng *rand.Rand) (*PaymentRecord, error) {
+	paymentID := fmt.Sprintf("DEMO%d%04d", seed%1000000, index)
+	amount := roundAmount(float64(rng.Intn(200000)+100) / 100)
+	createdAt := time.Now().Add(-time.Duration(rng.Intn(30*24*60)) * time.Minute)
+	currency := "CNY"
+	if scenario.method == "crypto" {
+		currency = "USDT"
+	}
+
+	record := &PaymentRecord{
+		PaymentID: paymentID,
+		OrderID:   paymentID,
+		TenantID:  tenantID,
+		UserID:    fmt.Sprintf("demo-user-%d", rng.Intn(20)+1),
+		Method:    scenario.method,
+		Channel:   scenario.channel,
+		Amount:    amount,
+		Currency:  currency,
+		Subject:   seedSubjects[rng.Intn(len(seedSubjects))],
+		Status:    StatusPending,
+		Metadata:  map[string]interface{}{"sandboxSeed": true},
+		ExpiresAt: createdAt.Add(30 * time.Minute),
+		CreatedAt: createdAt,
+	}
+	switch scenario.method {
+	case "giftcard":
+		record.GiftCardNo = fmt.Sprintf("DEMOGC%08d", rng.Intn(100000000))
+	case "crypto":
+		record.Metadata["chainStatus"] = "confirming"
+		record.Metadata["confirmations"] = rng.Intn(5) + 1
+		record.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	if scenario.status == StatusPending && scenario.method != "crypto" {
+		record.ExpiresAt = time.Now().Add(15 * time.Minute)
+	}
+	// 先以待支付状态保存，状态历史才与真实支付一致
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	if scenario.status == StatusPending {
+		return record, nil
+	}
+
+	if scenario.status != StatusClosed {
+		record.ProviderTradeNo = fmt.Sprintf("SANDBOX%d", rng.Int63())
+		record.Fee = ps.fees.Calculate(record.Method, record.Channel, record.Currency, amount)
+		record.Status = StatusPaid
+		if err := ps.store.Save(record); err != nil {
+			return nil, err
+		}
+	}
+
+	if scenario.refund > 0 {
+		refundAmount := roundAmount(amount * scenario.refund)
+		refund := &RefundRecord{
+			RefundID:         fmt.Sprintf("DEMORF%d%04d", seed%1000000, index),
+			PaymentID:        paymentID,
+			TenantID:         tenantID,
+			Method:           record.Method,
+			Amount:           refundAmount,
+			Currency:         currency,
+			Destination:      RefundToSource,
+			Status:           RefundSucceeded,
+			Reason:           "演示数据",
+			ProviderRefundNo: fmt.Sprintf("SANDBOXRF%d", rng.Int63()),
+			FeeReturned:      ps.fees.RefundedFee(record, refundAmount),
+			RequestedBy:      "sandbox",
+		}
+		if err := ps.refunds.Save(refund); err != nil {
+			return nil, err
+		}
+		record.RefundedAmount = refundAmount
+		record.FeeRefunded = refund.FeeReturned
+	}
+
+	record.Status = scenario.status
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// registerSandboxRoutes 注册演示数据接口，供前端开发和演示环境使用，生产环境禁用
+func registerSandboxRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	admin.POST("/sandbox/seed", func(c *gin.Context) {
+		if currentEnvironment() == "production" {
+			apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", "生产环境不允许写入演示数据")
+			return
+		}
+
+		var req SeedRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+				return
+			}
+		}
+
+		result, err := ps.SeedDemoData(tenantFromRequest(c), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, result)
+	})
+}
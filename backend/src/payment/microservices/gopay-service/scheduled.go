@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// StatusScheduled 预约支付，到达生效时间前不创建渠道订单
+const StatusScheduled = "scheduled"
+
+// ScheduledActivation 预约支付的生效信息，Request 为下单时的原始请求
+type ScheduledActivation struct {
+	ActivateAt  time.Time      `json:"activateAt"`
+	Request     PaymentRequest `json:"request"`
+	Attempts    int            `json:"attempts,omitempty"`
+	LastError   string         `json:"lastError,omitempty"`
+	ActivatedAt *time.Time     `json:"activatedAt,omitempty"`
+}
+
+// PayablePayment payment.payable 事件数据：预约支付已创建渠道订单，可以引导用户支付
+type PayablePayment struct {
+	*PaymentRecord
+	Payment *PaymentData `json:"payment"`
+}
+
+// schedulePayment 保存预约支付，渠道订单在生效时由 ScheduledPaymentActivator 创建。
+// 礼品卡需要用户当场输入密码，不支持预约
+func (ps *PaymentService) schedulePayment(req *PaymentRequest) (*apierr.Response, error) {
+	switch req.Method {
+	case "alipay", "wechat", "balance":
+	default:
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持预约的支付方式: %s", req.Method)), nil
+	}
+	if _, err := ps.store.Get(req.OrderID); err == nil {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已存在支付记录: %s", req.OrderID)), nil
+	}
+	if req.Invoice != nil {
+		if err := req.Invoice.validate(); err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+		}
+	}
+	if resp := ps.preparePaymentWebhooks(req); resp != nil {
+		return resp, nil
+	}
+
+	request := *req
+	request.ActivateAt = nil
+	request.Webhooks = nil
+	request.webhookTargets = nil
+	record := &PaymentRecord{
+		PaymentID: req.OrderID,
+		OrderID:   req.OrderID,
+		TenantID:  req.TenantID,
+		UserID:    req.UserID,
+		Method:    req.Method,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Subject:   req.Subject,
+		Status:    StatusScheduled,
+		Metadata:  req.Metadata,
+		Webhooks:  req.webhookTargets,
+		Scheduled: &ScheduledActivation{ActivateAt: *req.ActivateAt, Request: request},
+	}
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	log.Printf("预约支付 %s 已登记，将于 %s 生效", record.PaymentID, req.ActivateAt.Format(time.RFC3339))
+
+	return apierr.SuccessResponse(&PaymentData{
+		PaymentID:  record.PaymentID,
+		Status:     StatusScheduled,
+		ActivateAt: req.ActivateAt,
+		Webhooks:   createdPaymentWebhooks(req.webhookTargets),
+	}), nil
+}
+
+// orderScheduled 订单已登记预约支付且本次不是激活，避免提前下单覆盖预约记录
+func (ps *PaymentService) orderScheduled(req *PaymentRequest) bool {
+	if req.activating {
+		return false
+	}
+	existing, err := ps.store.Get(req.OrderID)
+	return err == nil && existing.Status == StatusScheduled
+}
+
+// ScheduledPaymentActivator 定时激活到期的预约支付：创建渠道订单并推送 payment.payable
+type ScheduledPaymentActivator struct {
+	payments    *PaymentService
+	interval    time.Duration
+	maxAttempts int
+	mu          sync.Mutex // 激活与取消互斥
+}
+
+func NewScheduledPaymentActivator(payments *PaymentService) *ScheduledPaymentActivator {
+	return &ScheduledPaymentActivator{
+		payments:    payments,
+		interval:    envDuration("SCHEDULED_PAYMENT_INTERVAL", 30*time.Second),
+		maxAttempts: envInt("SCHEDULED_PAYMENT_MAX_ATTEMPTS", 10),
+	}
+}
+
+func (sa *ScheduledPaymentActivator) Run(ctx context.Context) {
+	ticker := time.NewTicker(sa.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sa.activateDue(now)
+		}
+	}
+}
+
+func (sa *ScheduledPaymentActivator) activateDue(now time.Time) {
+	records, err := sa.payments.store.List()
+	if err != nil {
+		log.Printf("加载预约支付失败: %v", err)
+		return
+	}
+	for _, record := range records {
+		if record.Status != StatusScheduled || record.Scheduled == nil || record.Scheduled.ActivateAt.After(now) {
+			continue
+		}
+		sa.activate(record.PaymentID)
+	}
+}
+
+// activate 激活一笔预约支付。渠道繁忙或维护时保留预约状态等待下次重试，其余失败直接置为失败
+func (sa *ScheduledPaymentActivator) activate(paymentID string) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	ps := sa.payments
+	record, err := ps.store.Get(paymentID)
+	if err != nil || record.Status != StatusScheduled || record.Scheduled == nil {
+		return
+	}
+
+	req := record.Scheduled.Request
+	req.TenantID = record.TenantID
+	req.webhookTargets = record.Webhooks
+	req.activating = true
+
+	resp, err := ps.CreatePayment(&req)
+	if err == nil && resp.Success {
+		log.Printf("预约支付 %s 已生效", paymentID)
+		ps.markActivated(paymentID, record.Scheduled)
+		ps.notifyPayable(paymentID, resp)
+		return
+	}
+
+	reason := ""
+	retry := true
+	if err != nil {
+		reason = err.Error()
+	} else {
+		reason = resp.Code + ": " + resp.Message
+		retry = resp.Code == "RETRY_LATER" || resp.Code == "PROVIDER_MAINTENANCE"
+	}
+
+	scheduled := *record.Scheduled
+	scheduled.Attempts++
+	scheduled.LastError = reason
+	record.Scheduled = &scheduled
+	if !retry || scheduled.Attempts >= sa.maxAttempts {
+		record.Status = StatusFailed
+	}
+	if err := ps.store.Save(record); err != nil {
+		log.Printf("保存预约支付 %s 失败: %v", paymentID, err)
+		return
+	}
+	log.Printf("预约支付 %s 激活失败（第 %d 次）: %s", paymentID, scheduled.Attempts, reason)
+	if record.Status == StatusFailed {
+		ps.webhooks.Emit(record.TenantID, EventPaymentActivationFailed, record)
+	}
+}
+
+// markActivated 下单会重建支付记录，这里补回预约信息
+func (ps *PaymentService) markActivated(paymentID string, scheduled *ScheduledActivation) {
+	record, err := ps.store.Get(paymentID)
+	if err != nil {
+		return
+	}
+	activation := *scheduled
+	activation.Attempts++
+	activation.LastError = ""
+	now := time.Now()
+	activation.ActivatedAt = &now
+	record.Scheduled = &activation
+	if err := ps.store.Save(record); err != nil {
+		log.Printf("保存预约支付 %s 失败: %v", paymentID, err)
+	}
+}
+
+// notifyPayable 推送 payment.payable，附带支付链接或二维码。余额支付激活即完成扣款，只推送 payment.paid
+func (ps *PaymentService) notifyPayable(paymentID string, resp *apierr.Response) {
+	record, err := ps.store.Get(paymentID)
+	if err != nil || record.Status != StatusPending {
+		return
+	}
+	data, _ := resp.Data.(*PaymentData)
+	ps.webhooks.Emit(record.TenantID, EventPaymentPayable, &PayablePayment{PaymentRecord: record, Payment: data})
+}
+
+// Cancel 取消尚未生效的预约支付
+func (sa *ScheduledPaymentActivator) Cancel(paymentID, operator string) (*apierr.Response, error) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	ps := sa.payments
+	record, err := ps.store.Get(paymentID)
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_NOT_FOUND", err.Error()), nil
+	}
+	if record.Status != StatusScheduled {
+		return apierr.ErrorResponse("INVALID_STATE", fmt.Sprintf("只能取消未生效的预约支付，当前状态: %s", record.Status)), nil
+	}
+
+	record.Status = StatusClosed
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	ps.actions.Record(paymentID, operator, "scheduled.cancel", "")
+	ps.webhooks.Emit(record.TenantID, EventPaymentClosed, record)
+	return apierr.SuccessResponse(record), nil
+}
+
+// registerScheduledPaymentRoutes 注册预约支付接口，预约通过下单接口的 activateAt 参数创建
+func registerScheduledPaymentRoutes(api *gin.RouterGroup, sa *ScheduledPaymentActivator) {
+	api.POST("/payment/scheduled/:paymentId/cancel", func(c *gin.Context) {
+		resp, err := sa.Cancel(c.Param("paymentId"), operatorFromRequest(c))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 风险评分阶段
+const (
+	RiskStagePreCreate  = "pre_create"  // 创建渠道订单前
+	RiskStagePostNotify = "post_notify" // 收到渠道支付成功通知后
+)
+
+// 风险决策
+const (
+	RiskApprove = "approve"
+	RiskReview  = "review" // 放行但需人工关注
+	RiskReject  = "reject"
+)
+
+// RiskInput 评分输入
+type RiskInput struct {
+	Stage           string    `json:"stage"`
+	PaymentID       string    `json:"paymentId"`
+	TenantID        string    `json:"tenantId,omitempty"`
+	UserID          string    `json:"userId,omitempty"`
+	ClientIP        string    `json:"clientIp,omitempty"`
+	Method          string    `json:"method"`
+	Amount          float64   `json:"amount"`
+	Currency        string    `json:"currency,omitempty"`
+	ProviderTradeNo string    `json:"providerTradeNo,omitempty"`
+	CreatedAt       time.Time `json:"createdAt,omitempty"`
+}
+
+// RiskAssessment 一次评分结果，保存在支付记录上
+type RiskAssessment struct {
+	Stage      string    `json:"stage"`
+	Scorer     string    `json:"scorer"`
+	Score      float64   `json:"score"` // 0-100，越高风险越大
+	Decision   string    `json:"decision"`
+	Reasons    []string  `json:"reasons,omitempty"`
+	AssessedAt time.Time `json:"assessedAt"`
+}
+
+// RiskScorer 欺诈评分扩展点，下单前和支付通知后各调用一次
+type RiskScorer interface {
+	Score(ctx context.Context, input *RiskInput) (*RiskAssessment, error)
+}
+
+// riskThresholds 按分数给出决策
+type riskThresholds struct {
+	review float64
+	reject float64
+}
+
+func (t riskThresholds) decide(score float64) string {
+	switch {
+	case score >= t.reject:
+		return RiskReject
+	case score >= t.review:
+		return RiskReview
+	default:
+		return RiskApprove
+	}
+}
+
+// NewRiskScorer 配置了 RISK_SCORER_URL 时使用外部评分服务，失败时回退到内置规则
+func NewRiskScorer() RiskScorer {
+	thresholds := riskThresholds{
+		review: envFloat("RISK_REVIEW_SCORE", 60),
+		reject: envFloat("RISK_REJECT_SCORE", 85),
+	}
+	heuristic := &heuristicScorer{
+		thresholds: thresholds,
+		highAmount: envFloat("RISK_HIGH_AMOUNT", 5000),
+	}
+	if url := os.Getenv("RISK_SCORER_URL"); url != "" {
+		return &remoteScorer{
+			url:        url,
+			apiKey:     os.Getenv("RISK_SCORER_API_KEY"),
+			thresholds: thresholds,
+			fallback:   heuristic,
+			httpClient: &http.Client{Timeout: envDuration("RISK_SCORER_TIMEOUT", 2*time.Second)},
+		}
+	}
+	return heuristic
+}
+
+// heuristicScorer 内置的规则评分
+type heuristicScorer struct {
+	thresholds riskThresholds
+	highAmount float64
+}
+
+func (h *heuristicScorer) Score(_ context.Context, input *RiskInput) (*RiskAssessment, error) {
+	var score float64
+	var reasons []string
+	add := func(points float64, reason string) {
+		score += points
+		reasons = append(reasons, reason)
+	}
+
+	if input.Amount >= h.highAmount {
+		add(40, "大额支付")
+	} else if input.Amount >= h.highAmount/2 {
+		add(20, "较大金额支付")
+	}
+	if input.Amount >= 1000 && input.Amount == float64(int64(input.Amount/100))*100 {
+		add(10, "整百金额")
+	}
+	if input.UserID == "" {
+		add(15, "匿名用户")
+	}
+	if input.Stage == RiskStagePreCreate && input.ClientIP == "" {
+		add(5, "缺少客户端 IP")
+	}
+	// 创建后极短时间内完成支付，常见于脚本刷单
+	if input.Stage == RiskStagePostNotify && !input.CreatedAt.IsZero() && time.Since(input.CreatedAt) < 5*time.Second {
+		add(30, "创建后立即完成支付")
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	return &RiskAssessment{
+		Stage:      input.Stage,
+		Scorer:     "heuristic",
+		Score:      score,
+		Decision:   h.thresholds.decide(score),
+		Reasons:    reasons,
+		AssessedAt: time.Now(),
+	}, nil
+}
+
+// remoteScorer 外部评分服务适配器：POST 评分输入，响应 {"score":..,"decision":..,"reasons":[..]}，
+// decision 为空时按本地阈值决策
+type remoteScorer struct {
+	url        string
+	apiKey     string
+	thresholds riskThresholds
+	fallback   RiskScorer
+	httpClient *http.Client
+}
+
+type remoteScoreResponse struct {
+	Score    float64  `json:"score"`
+	Decision string   `json:"decision"`
+	Reasons  []string `json:"reasons"`
+}
+
+func (r *remoteScorer) Score(ctx context.Context, input *RiskInput) (*RiskAssessment, error) {
+	assessment, err := r.call(ctx, input)
+	if err != nil {
+		// 评分服务不可用时不阻断支付，使用内置规则
+		log.Printf("外部风险评分失败，使用内置规则: %v", err)
+		return r.fallback.Score(ctx, input)
+	}
+	return assessment, nil
+}
+
+func (r *remoteScorer) call(ctx context.Context, input *RiskInput) (*RiskAssessment, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("评分服务返回 %d", resp.StatusCode)
+	}
+
+	var result remoteScoreResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析评分结果失败: %w", err)
+	}
+	decision := result.Decision
+	switch decision {
+	case RiskApprove, RiskReview, RiskReject:
+	case "":
+		decision = r.thresholds.decide(result.Score)
+	default:
+		return nil, fmt.Errorf("评分服务返回未知决策: %s", decision)
+	}
+	return &RiskAssessment{
+		Stage:      input.Stage,
+		Scorer:     "remote",
+		Score:      result.Score,
+		Decision:   decision,
+		Reasons:    result.Reasons,
+		AssessedAt: time.Now(),
+	}, nil
+}
+
+// scoreBeforeCreate 下单前评分，结果随请求带到 recordPayment 保存
+func (ps *PaymentService) scoreBeforeCreate(req *PaymentRequest) *RiskAssessment {
+	assessment, err := ps.scorer.Score(context.Background(), &RiskInput{
+		Stage:     RiskStagePreCreate,
+		PaymentID: req.OrderID,
+		TenantID:  req.TenantID,
+		UserID:    req.UserID,
+		ClientIP:  req.ClientIP,
+		Method:    req.Method,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+	})
+	if err != nil {
+		log.Printf("支付 %s 风险评分失败: %v", req.OrderID, err)
+		return nil
+	}
+	return assessment
+}
+
+// scoreAfterNotify 支付成功通知后复评。此时资金已到账，评分结果只记录和告警，不再拦截
+func (ps *PaymentService) scoreAfterNotify(paymentID string) {
+	record, err := ps.store.Get(paymentID)
+	if err != nil || record.Status != StatusPaid {
+		return
+	}
+	// 渠道重复通知时只复评一次
+	for _, a := range record.RiskAssessments {
+		if a.Stage == RiskStagePostNotify {
+			return
+		}
+	}
+	assessment, err := ps.scorer.Score(context.Background(), &RiskInput{
+		Stage:           RiskStagePostNotify,
+		PaymentID:       record.PaymentID,
+		TenantID:        record.TenantID,
+		UserID:          record.UserID,
+		Method:          record.Method,
+		Amount:          record.Amount,
+		Currency:        record.Currency,
+		ProviderTradeNo: record.ProviderTradeNo,
+		CreatedAt:       record.CreatedAt,
+	})
+	if err != nil {
+		log.Printf("支付 %s 风险复评失败: %v", paymentID, err)
+		return
+	}
+
+	record.applyRisk(assessment)
+	if err := ps.store.Save(record); err != nil {
+		log.Printf("保存支付 %s 风险复评结果失败: %v", paymentID, err)
+		return
+	}
+	if assessment.Decision != RiskApprove {
+		log.Printf("【风控】支付 %s 复评分数 %.0f，决策 %s: %v", paymentID, assessment.Score, assessment.Decision, assessment.Reasons)
+	}
+}
+
+// applyRisk 记录评分结果，RiskScore/RiskDecision 为最近一次评分
+func (r *PaymentRecord) applyRisk(assessment *RiskAssessment) {
+	r.RiskScore = assessment.Score
+	r.RiskDecision = assessment.Decision
+	// 存储返回的是浅拷贝，追加前复制切片
+	r.RiskAssessments = append(append([]RiskAssessment(nil), r.RiskAssessments...), *assessment)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// 结算周期
+const (
+	SettlementDaily   = "daily"
+	SettlementMonthly = "monthly"
+)
+
+var ErrSettlementNotFound = errors.New("结算报表不存在")
+
+// SettlementLine 结算报表中按渠道、商户（租户）、币种汇总的一行
+type SettlementLine struct {
+	Provider     string  `json:"provider"`
+	TenantID     string  `json:"tenantId"`
+	Currency     string  `json:"currency"`
+	PaymentCount int     `json:"paymentCount"`
+	Gross        float64 `json:"gross"`
+	RefundCount  int     `json:"refundCount"`
+	Refunds      float64 `json:"refunds"`
+	Fees         float64 `json:"fees"` // 收款手续费减去退款时渠道退还的部分
+	Net          float64 `json:"net"`
+}
+
+// SettlementReport 某个结算周期的报表
+type SettlementReport struct {
+	ReportID    string           `json:"reportId"`
+	Period      string           `json:"period"`
+	PeriodStart time.Time        `json:"periodStart"`
+	PeriodEnd   time.Time        `json:"periodEnd"`
+	Lines       []SettlementLine `json:"lines"`
+	UploadedTo  []string         `json:"uploadedTo,omitempty"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+}
+
+type GenerateSettlementRequest struct {
+	Period string `json:"period" binding:"required"` // daily | monthly
+	Date   string `json:"date" binding:"required"`   // daily 为 2006-01-02，monthly 为 2006-01
+}
+
+// SettlementService 生成日结、月结报表，配置了 SETTLEMENT_UPLOAD_URL 时同时上传 CSV
+type SettlementService struct {
+	payments *PaymentService
+	uploader Uploader
+	interval time.Duration
+
+	mu      sync.RWMutex
+	reports map[string]*SettlementReport
+}
+
+func NewSettlementService(payments *PaymentService) *SettlementService {
+	ss := &SettlementService{
+		payments: payments,
+		interval: envDuration("SETTLEMENT_INTERVAL", time.Hour),
+		reports:  make(map[string]*SettlementReport),
+	}
+	if target := os.Getenv("SETTLEMENT_UPLOAD_URL"); target != "" {
+		uploader, err := NewUploader(target)
+		if err != nil {
+			log.Printf("结算报表上传配置无效，仅本地保留: %v", err)
+		} else {
+			ss.uploader = uploader
+		}
+	}
+	return ss
+}
+
+// Run 定时补齐上一自然日和上一自然月的报表，已生成的不会重复生成
+func (ss *SettlementService) Run(ctx context.Context) {
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			today := startOfDay(time.Now())
+			thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+			for _, p := range []struct {
+				period string
+				start  time.Time
+			}{
+				{SettlementDaily, today.AddDate(0, 0, -1)},
+				{SettlementMonthly, thisMonth.AddDate(0, -1, 0)},
+			} {
+				if _, err := ss.Get(settlementReportID(p.period, p.start)); err == nil {
+					continue
+				}
+				if _, err := ss.Generate(ctx, p.period, p.start); err != nil {
+					log.Printf("生成%s结算报表失败: %v", p.period, err)
+				}
+			}
+		}
+	}
+}
+
+func settlementReportID(period string, start time.Time) string {
+	if period == SettlementMonthly {
+		return "monthly-" + start.Format("2006-01")
+	}
+	return "daily-" + start.Format("2006-01-02")
+}
+
+// Generate 生成（或重新生成）指定周期的报表。收款按创建时间归属周期，退款按退款时间归属周期
+func (ss *SettlementService) Generate(ctx context.Context, period string, start time.Time) (*SettlementReport, error) {
+	var end time.Time
+	switch period {
+	case SettlementDaily:
+		end = start.AddDate(0, 0, 1)
+	case SettlementMonthly:
+		end = start.AddDate(0, 1, 0)
+	default:
+		return nil, fmt.Errorf("不支持的结算周期: %s", period)
+	}
+
+	records, err := ss.payments.store.List()
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := ss.payments.refunds.List()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[string]*SettlementLine)
+	line := func(provider, tenantID, currency string) *SettlementLine {
+		if tenantID == "" {
+			tenantID = defaultTenantID
+		}
+		key := provider + "/" + tenantID + "/" + currency
+		l, ok := lines[key]
+		if !ok {
+			l = &SettlementLine{Provider: provider, TenantID: tenantID, Currency: currency}
+			lines[key] = l
+		}
+		return l
+	}
+
+	inPeriod := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+	for _, record := range records {
+		if !inPeriod(record.CreatedAt) {
+			continue
+		}
+		if record.Status != StatusPaid && record.Status != StatusPartiallyRefunded && record.Status != StatusRefunded {
+			continue
+		}
+
+		// 组合支付的外部渠道段有独立记录，主记录只计余额段
+		provider, gross := record.Method, record.Amount
+		if record.Method == "split" && len(record.Legs) > 0 {
+			provider, gross = "balance", record.Legs[0].Amount
+		} else if record.CapturedAmount > 0 {
+			gross = record.CapturedAmount
+		}
+
+		l := line(provider, record.TenantID, record.Currency)
+		l.PaymentCount++
+		l.Gross = roundAmountIn(l.Gross+gross, l.Currency)
+		l.Fees = roundAmountIn(l.Fees+record.Fee, l.Currency)
+	}
+	for _, refund := range refunds {
+		if refund.Status != RefundSucceeded || !inPeriod(refund.CreatedAt) {
+			continue
+		}
+		provider := refund.Method
+		if refund.Destination == RefundToBalance {
+			provider = "balance"
+		}
+		l := line(provider, refund.TenantID, refund.Currency)
+		l.RefundCount++
+		l.Refunds = roundAmountIn(l.Refunds+refund.Amount, l.Currency)
+		l.Fees = roundAmountIn(l.Fees-refund.FeeReturned, l.Currency)
+	}
+
+	report := &SettlementReport{
+		ReportID:    settlementReportID(period, start),
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Lines:       make([]SettlementLine, 0, len(lines)),
+		GeneratedAt: time.Now(),
+	}
+	for _, l := range lines {
+		l.Net = roundAmountIn(l.Gross-l.Refunds-l.Fees, l.Currency)
+		report.Lines = append(report.Lines, *l)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		a, b := report.Lines[i], report.Lines[j]
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		return a.Currency < b.Currency
+	})
+
+	if ss.uploader != nil {
+		content, err := settlementCSV(report)
+		if err != nil {
+			return nil, err
+		}
+		location, err := ss.uploader.Upload(ctx, report.ReportID+".csv", content, "text/csv; charset=utf-8")
+		if err != nil {
+			// 上传失败不影响报表生成，可通过接口手动下载
+			log.Printf("上传结算报表 %s 失败: %v", report.ReportID, err)
+		} else {
+			report.UploadedTo = append(report.UploadedTo, location)
+		}
+	}
+
+	ss.mu.Lock()
+	ss.reports[report.ReportID] = report
+	ss.mu.Unlock()
+	log.Printf("已生成结算报表 %s，共 %d 行", report.ReportID, len(report.Lines))
+	return report, nil
+}
+
+func (ss *SettlementService) Get(reportID string) (*SettlementReport, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	report, ok := ss.reports[reportID]
+	if !ok {
+		return nil, ErrSettlementNotFound
+	}
+	return report, nil
+}
+
+// List 返回指定周期的报表，最新的在前；period 为空时返回全部
+func (ss *SettlementService) List(period string) []*SettlementReport {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	var reports []*SettlementReport
+	for _, report := range ss.reports {
+		if period == "" || report.Period == period {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].PeriodStart.After(reports[j].PeriodStart)
+	})
+	return reports
+}
+
+func settlementCSV(report *SettlementReport) ([]byte, error) {
+	var buf bytes.Buffer
+	// 写入 BOM，便于 Excel 正确识别中文
+	buf.WriteString("\xEF\xBB\xBF")
+
+	w := csv.NewWriter(&buf)
+	header := []string{"period", "periodStart", "provider", "tenantId", "currency", "paymentCount", "gross", "refundCount", "refunds", "fees", "net"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, l := range report.Lines {
+		row := []string{
+			report.Period,
+			report.PeriodStart.Format("2006-01-02"),
+			l.Provider,
+			csvSafe(l.TenantID),
+			l.Currency,
+			strconv.Itoa(l.PaymentCount),
+			money(l.Gross),
+			strconv.Itoa(l.RefundCount),
+			money(l.Refunds),
+			money(l.Fees),
+			money(l.Net),
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// registerSettlementRoutes 注册结算报表接口
+func registerSettlementRoutes(api *gin.RouterGroup, ss *SettlementService) {
+	admin := api.Group("/admin")
+
+	admin.GET("/settlements", func(c *gin.Context) {
+		apierr.RespondOK(c, ss.List(c.Query("period")))
+	})
+
+	admin.POST("/settlements/generate", func(c *gin.Context) {
+		var req GenerateSettlementRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		layout := "2006-01-02"
+		if req.Period == SettlementMonthly {
+			layout = "2006-01"
+		}
+		start, err := time.ParseInLocation(layout, req.Date, time.Local)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", fmt.Sprintf("date 格式无效: %s", req.Date))
+			return
+		}
+
+		report, err := ss.Generate(c.Request.Context(), req.Period, start)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+		apierr.RespondOK(c, report)
+	})
+
+	// format=csv 时下载 CSV，默认返回 JSON
+	admin.GET("/settlements/:reportId", func(c *gin.Context) {
+		report, err := ss.Get(c.Param("reportId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusNotFound, "REPORT_NOT_FOUND", err.Error())
+			return
+		}
+
+		switch c.DefaultQuery("format", "json") {
+		case "csv":
+			content, err := settlementCSV(report)
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Header("Content-Disposition", "attachment; filename=settlement-"+report.ReportID+".csv")
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+		case "json":
+			content, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+			c.Header("Content-Disposition", "attachment; filename=settlement-"+report.ReportID+".json")
+			c.Data(http.StatusOK, "application/json; charset=utf-8", content)
+		default:
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", "format 仅支持 csv 或 json")
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Background 跟踪后台循环。关闭时取消上下文并等待各循环处理完当前一轮后退出，
+// 避免对账、批量退款等正在调用渠道的工作被进程退出打断
+type Background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewBackground() *Background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Background{ctx: ctx, cancel: cancel}
+}
+
+// Go 启动一个后台循环，run 须在 ctx 取消后返回
+func (b *Background) Go(run func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		run(b.ctx)
+	}()
+}
+
+// Stop 取消后台上下文并等待全部循环退出，ctx 到期时不再等待
+func (b *Background) Stop(ctx context.Context) error {
+	b.cancel()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// gracefulShutdown 按顺序排空在途工作，全部步骤共用 SHUTDOWN_TIMEOUT（默认 30 秒）：
+// 停止接收请求并等待处理中的请求，停止后台循环，排空任务队列（推送、付款、异步下单），
+// 最后关闭事件总线以刷出尚未发送的消息
+func gracefulShutdown(srv *http.Server, background *Background, jobs *JobRegistry, stopJobs context.CancelFunc, bus EventBus) {
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("等待处理中的请求超时，强制关闭连接: %v", err)
+		srv.Close()
+	}
+	if err := background.Stop(ctx); err != nil {
+		log.Printf("【警告】后台任务未能在关闭期限内退出: %v", err)
+	}
+	if err := jobs.Drain(ctx); err != nil {
+		log.Printf("【警告】任务队列未排空: %v", err)
+	}
+	stopJobs()
+	if bus != nil {
+		if err := bus.Close(); err != nil {
+			log.Printf("关闭事件总线失败: %v", err)
+		}
+	}
+}
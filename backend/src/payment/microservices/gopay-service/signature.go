@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+)
+
+// RequestSigner 校验业务系统的签名请求，签名方式与订单服务网关客户端一致：
+// X-Signature = hex(sha256(appId + timestamp + nonce + body + secret))，无请求体时 body 为 "{}"。
+// 时间戳超出窗口的请求直接拒绝，窗口内的随机数只能使用一次，防止截获的请求被重放
+type RequestSigner struct {
+	secrets  map[string]string
+	window   time.Duration
+	required bool
+	nonces   NonceStore
+	audit    *AuditLog
+}
+
+// NewRequestSigner 读取 API_APP_SECRETS（appId:secret，逗号分隔）。未配置时不校验签名。
+// API_SIGNATURE_REQUIRED=true 时下单和退款接口必须签名，其余接口只校验携带了签名的请求
+func NewRequestSigner(audit *AuditLog) *RequestSigner {
+	rs := &RequestSigner{
+		secrets:  make(map[string]string),
+		window:   envDuration("API_SIGNATURE_WINDOW", 5*time.Minute),
+		required: os.Getenv("API_SIGNATURE_REQUIRED") == "true",
+		audit:    audit,
+	}
+	for _, pair := range splitList(os.Getenv("API_APP_SECRETS")) {
+		appID, secret, ok := strings.Cut(pair, ":")
+		if !ok || appID == "" || secret == "" {
+			log.Printf("忽略格式错误的 API_APP_SECRETS 项")
+			continue
+		}
+		rs.secrets[appID] = secret
+	}
+	if len(rs.secrets) > 0 {
+		rs.nonces = NewNonceStore()
+	}
+	return rs
+}
+
+func sign(appID, timestamp, nonce string, body []byte, secret string) string {
+	h := sha256.New()
+	h.Write([]byte(appID + timestamp + nonce))
+	h.Write(body)
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func signatureRequiredFor(fullPath string) bool {
+	for _, routes := range [][]string{createRoutes, refundRoutes} {
+		for _, route := range routes {
+			if route == fullPath {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware 校验签名、时间戳和随机数，须在注册路由前挂载
+func (rs *RequestSigner) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(rs.secrets) == 0 {
+			c.Next()
+			return
+		}
+
+		signature := c.GetHeader("X-Signature")
+		if signature == "" {
+			if rs.required && c.Request.Method == http.MethodPost && signatureRequiredFor(c.FullPath()) {
+				apierr.RespondError(c, http.StatusUnauthorized, "SIGNATURE_REQUIRED", "该接口需要签名")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		appID := c.GetHeader("X-App-Id")
+		timestamp := c.GetHeader("X-Timestamp")
+		nonce := c.GetHeader("X-Nonce")
+		secret, ok := rs.secrets[appID]
+		if !ok {
+			rs.reject(c, http.StatusUnauthorized, "INVALID_SIGNATURE", "未知的 appId", appID)
+			return
+		}
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(ts, 0)).Abs() > rs.window {
+			rs.reject(c, http.StatusUnauthorized, "TIMESTAMP_EXPIRED", "请求时间戳超出允许范围", appID)
+			return
+		}
+		if len(nonce) < 8 || len(nonce) > 64 {
+			rs.reject(c, http.StatusUnauthorized, "INVALID_SIGNATURE", "随机数长度应为 8-64", appID)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) == 0 {
+			body = []byte("{}")
+		}
+		expected := sign(appID, timestamp, nonce, body, secret)
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(signature)), []byte(expected)) != 1 {
+			rs.reject(c, http.StatusUnauthorized, "INVALID_SIGNATURE", "签名错误", appID)
+			return
+		}
+
+		// 签名通过后再登记随机数，伪造的请求无法占用合法调用方的随机数。
+		// 时间戳在窗口两侧都可能有效，保留两倍窗口
+		fresh, err := rs.nonces.Consume(c.Request.Context(), appID+":"+nonce, 2*rs.window)
+		if err != nil {
+			log.Printf("登记请求随机数失败: %v", err)
+			apierr.RespondError(c, http.StatusServiceUnavailable, "NONCE_STORE_UNAVAILABLE", "暂时无法校验请求，请稍后重试")
+			c.Abort()
+			return
+		}
+		if !fresh {
+			rs.reject(c, http.StatusUnauthorized, "REPLAYED_REQUEST", "请求已被使用过", appID)
+			return
+		}
+		c.Next()
+	}
+}
+
+// reject 拒绝请求并写入审计日志
+func (rs *RequestSigner) reject(c *gin.Context, status int, code, message, appID string) {
+	rs.audit.Record(AuditEntry{
+		Category: AuditSignature,
+		Action:   "signature." + strings.ToLower(code),
+		SourceIP: c.ClientIP(),
+		Detail:   appID + " " + c.Request.Method + " " + c.Request.URL.Path + ": " + message,
+	})
+	apierr.RespondError(c, status, code, message)
+	c.Abort()
+}
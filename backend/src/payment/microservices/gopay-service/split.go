@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/model"
+)
+
+// SplitTenderRequest 组合支付：部分余额抵扣，剩余部分通过外部渠道支付
+type SplitTenderRequest struct {
+	OrderID       string  `json:"orderId" binding:"required"`
+	UserID        string  `json:"userId" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required"`
+	Currency      string  `json:"currency"`
+	Subject       string  `json:"subject" binding:"required"`
+	WalletAmount  float64 `json:"walletAmount" binding:"required"`
+	Method        string  `json:"method" binding:"required"` // 外部渠道：alipay | wechat | crypto
+	ReturnURL     string  `json:"returnUrl"`
+	NotifyURL     string  `json:"notifyUrl"`
+	ExpireMinutes int     `json:"expireMinutes"`
+
+	// 加密货币渠道参数，应付币数由加密货币网关按实时汇率换算，cryptoAmount 仅为兼容旧客户端保留
+	CryptoCurrency string  `json:"cryptoCurrency"`
+	CryptoNetwork  string  `json:"cryptoNetwork"`
+	CryptoAmount   float64 `json:"cryptoAmount,omitempty"`
+}
+
+// PaymentLeg 组合支付中的一段
+type PaymentLeg struct {
+	Method    string  `json:"method"`
+	PaymentID string  `json:"paymentId"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+}
+
+// SplitTenderData 组合支付返回数据，外部渠道的支付信息放在 External 中
+type SplitTenderData struct {
+	PaymentID string               `json:"paymentId"`
+	Status    string               `json:"status"`
+	Legs      []PaymentLeg         `json:"legs"`
+	External  interface{}          `json:"external,omitempty"`
+	Crypto    *model.CryptoPayment `json:"crypto,omitempty"`
+}
+
+// PaySplitTender 先冻结余额，再创建外部渠道订单；外部渠道下单失败时退回余额
+func (ps *PaymentService) PaySplitTender(req *SplitTenderRequest) (*apierr.Response, error) {
+	if _, err := ps.store.Get(req.OrderID); err == nil {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已存在支付记录: %s", req.OrderID)), nil
+	}
+	walletAmount := roundAmountIn(req.WalletAmount, req.Currency)
+	externalAmount := roundAmountIn(req.Amount-walletAmount, req.Currency)
+	if walletAmount <= 0 || externalAmount <= 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "余额抵扣金额必须大于0且小于订单金额"), nil
+	}
+	if req.Method != "alipay" && req.Method != "wechat" && req.Method != "crypto" {
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持组合支付的渠道: %s", req.Method)), nil
+	}
+	if notice := ps.maintenance.Notice(req.Method); notice != nil {
+		return maintenanceResponse(notice), nil
+	}
+	if hint := ps.preflight.Check(req.Method); hint != nil {
+		return retryLaterResponse(hint), nil
+	}
+
+	// 第一段：冻结余额
+	if _, err := ps.wallets.Debit(req.UserID, req.Currency, walletAmount); err != nil {
+		if errors.Is(err, ErrInsufficientBalance) {
+			return apierr.ErrorResponse("INSUFFICIENT_BALANCE", "余额不足"), nil
+		}
+		return nil, err
+	}
+	if err := ps.postSplitEntries(req.OrderID, "wallet:"+req.UserID, "split:hold", walletAmount, req.Currency, "组合支付冻结余额"); err != nil {
+		return nil, err
+	}
+
+	parent := &PaymentRecord{
+		PaymentID: req.OrderID,
+		OrderID:   req.OrderID,
+		UserID:    req.UserID,
+		Method:    "split",
+		Amount:    roundAmountIn(req.Amount, req.Currency),
+		Currency:  req.Currency,
+		Subject:   req.Subject,
+		Status:    StatusPending,
+		NotifyURL: req.NotifyURL,
+		Legs: []PaymentLeg{
+			{Method: "balance", PaymentID: req.OrderID, Amount: walletAmount, Status: StatusAuthorized},
+		},
+	}
+
+	// 第二段：外部渠道
+	data := &SplitTenderData{PaymentID: parent.PaymentID}
+	leg, failure, err := ps.createExternalLeg(req, externalAmount, data)
+	if err != nil || failure != nil {
+		if compErr := ps.releaseSplitHold(parent); compErr != nil {
+			log.Printf("组合支付 %s 退回余额失败，需人工处理: %v", parent.PaymentID, compErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return failure, nil
+	}
+
+	parent.Legs = append(parent.Legs, *leg)
+	if err := ps.store.Save(parent); err != nil {
+		return nil, err
+	}
+
+	data.Status = parent.Status
+	data.Legs = parent.Legs
+	return apierr.SuccessResponse(data), nil
+}
+
+// createExternalLeg 创建外部渠道订单，业务失败时返回 failure 响应
+func (ps *PaymentService) createExternalLeg(req *SplitTenderRequest, amount float64, data *SplitTenderData) (*PaymentLeg, *apierr.Response, error) {
+	legID := req.OrderID + "_EXT"
+	leg := &PaymentLeg{Method: req.Method, PaymentID: legID, Amount: amount, Status: StatusPending}
+
+	if req.Method == "crypto" {
+		userID, err := strconv.Atoi(req.UserID)
+		if err != nil {
+			return nil, apierr.ErrorResponse("INVALID_PARAMS", "加密货币支付需要数字用户ID"), nil
+		}
+		if req.CryptoCurrency == "" {
+			return nil, apierr.ErrorResponse("INVALID_PARAMS", "加密货币支付需要 cryptoCurrency"), nil
+		}
+
+		invoice, err := ps.crypto.CreateInvoice(context.Background(), &model.CryptoPaymentRequest{
+			OrderID:       legID,
+			Currency:      req.CryptoCurrency,
+			Network:       req.CryptoNetwork,
+			UserID:        userID,
+			ExpireMinutes: req.ExpireMinutes,
+			FiatCurrency:  req.Currency,
+			FiatAmount:    amount,
+		})
+		if err != nil {
+			return nil, apierr.ErrorResponse("PAYMENT_ERROR", err.Error()), nil
+		}
+
+		leg.PaymentID = invoice.PaymentID
+		if err := ps.store.Save(&PaymentRecord{
+			PaymentID:       invoice.PaymentID,
+			OrderID:         req.OrderID,
+			UserID:          req.UserID,
+			Method:          "crypto",
+			Amount:          amount,
+			Currency:        req.Currency,
+			Subject:         req.Subject,
+			Status:          StatusPending,
+			ParentPaymentID: req.OrderID,
+		}); err != nil {
+			return nil, nil, err
+		}
+		data.Crypto = invoice
+		return leg, nil, nil
+	}
+
+	resp, err := ps.CreatePayment(&PaymentRequest{
+		Method:        req.Method,
+		OrderID:       legID,
+		UserID:        req.UserID,
+		Amount:        amount,
+		Currency:      req.Currency,
+		Subject:       req.Subject,
+		ReturnURL:     req.ReturnURL,
+		NotifyURL:     req.NotifyURL,
+		ExpireMinutes: req.ExpireMinutes,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !resp.Success {
+		return nil, resp, nil
+	}
+
+	record, err := ps.store.Get(legID)
+	if err != nil {
+		return nil, nil, err
+	}
+	record.ParentPaymentID = req.OrderID
+	if err := ps.store.Save(record); err != nil {
+		return nil, nil, err
+	}
+	data.External = resp.Data
+	return leg, nil, nil
+}
+
+// syncSplitTender 同步外部渠道状态，结果通过 settleSplitTender 汇总到主记录
+func (ps *PaymentService) syncSplitTender(parent *PaymentRecord) error {
+	for _, leg := range parent.Legs {
+		if leg.Method == "balance" {
+			continue
+		}
+		record, err := ps.store.Get(leg.PaymentID)
+		if err != nil {
+			return err
+		}
+		if record.Status != StatusPending {
+			continue
+		}
+
+		if record.Method == "crypto" {
+			status, err := ps.crypto.QueryInvoice(context.Background(), record.PaymentID)
+			if err != nil {
+				return err
+			}
+			switch status.Status {
+			case "confirmed":
+				err = ps.markPaid(record, status.TxHash)
+			case "expired", "failed":
+				err = ps.markClosed(record)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ps.syncPaymentStatus(record); err != nil {
+			return err
+		}
+	}
+
+	latest, err := ps.store.Get(parent.PaymentID)
+	if err != nil {
+		return err
+	}
+	*parent = *latest
+	return nil
+}
+
+// settleSplitTender 外部渠道支付结束后处理主记录：成功则确认余额扣款，失败则退回余额
+func (ps *PaymentService) settleSplitTender(leg *PaymentRecord) error {
+	unlock, err := ps.lockPayment(leg.ParentPaymentID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	parent, err := ps.store.Get(leg.ParentPaymentID)
+	if err != nil {
+		return err
+	}
+	if parent.Status != StatusPending {
+		return nil
+	}
+
+	for i := range parent.Legs {
+		if parent.Legs[i].PaymentID == leg.PaymentID && parent.Legs[i].Method == leg.Method {
+			parent.Legs[i].Status = leg.Status
+		}
+	}
+
+	if leg.Status == StatusPaid {
+		walletAmount := parent.Legs[0].Amount
+		if err := ps.postSplitEntries(parent.PaymentID, "split:hold", "merchant:sales", walletAmount, parent.Currency, "组合支付余额扣款"); err != nil {
+			return err
+		}
+		parent.Legs[0].Status = StatusPaid
+		parent.Status = StatusPaid
+		return ps.store.Save(parent)
+	}
+
+	if err := ps.releaseSplitHold(parent); err != nil {
+		return err
+	}
+	parent.Legs[0].Status = StatusVoided
+	parent.Status = StatusClosed
+	return ps.store.Save(parent)
+}
+
+// releaseSplitHold 补偿：退回冻结的余额
+func (ps *PaymentService) releaseSplitHold(parent *PaymentRecord) error {
+	walletAmount := parent.Legs[0].Amount
+	if _, err := ps.wallets.Credit(parent.UserID, parent.Currency, walletAmount); err != nil {
+		return err
+	}
+	return ps.postSplitEntries(parent.PaymentID, "split:hold", "wallet:"+parent.UserID, walletAmount, parent.Currency, "组合支付退回余额")
+}
+
+func (ps *PaymentService) postSplitEntries(txnID, debitAccount, creditAccount string, amount float64, currency, action string) error {
+	description := fmt.Sprintf("%s %s", action, txnID)
+	return ps.ledger.Post(
+		LedgerEntry{TxnID: txnID, Account: debitAccount, Direction: Debit, Amount: amount, Currency: currency, Description: description},
+		LedgerEntry{TxnID: txnID, Account: creditAccount, Direction: Credit, Amount: amount, Currency: currency, Description: description},
+	)
+}
+
+// registerSplitTenderRoutes 注册组合支付接口
+func registerSplitTenderRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	api.POST("/payment/split", func(c *gin.Context) {
+		var req SplitTenderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.PaySplitTender(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		respondMaybeRetry(c, resp)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/pkg/util"
+)
+
+// syncPaymentStatus 向渠道查询待支付记录的最新状态
+func (ps *PaymentService) syncPaymentStatus(record *PaymentRecord) error {
+	if err := ps.chaos.BeforeProviderCall(record.Method, "query"); err != nil {
+		return err
+	}
+	if ps.mock.Handles(record.Method) {
+		return ps.syncMockPayment(record)
+	}
+	switch record.Method {
+	case "split":
+		return ps.syncSplitTender(record)
+	case "alipay":
+		if ps.aliClient() == nil {
+			return errors.New("支付宝客户端未初始化")
+		}
+		bm := make(gopay.BodyMap)
+		bm.Set("out_trade_no", outTradeNo(record))
+		aliRsp, err := ps.aliClient().TradeQuery(context.Background(), bm)
+		if err != nil {
+			return fmt.Errorf("查询支付宝交易失败: %w", err)
+		}
+		switch aliRsp.Response.TradeStatus {
+		case "TRADE_SUCCESS", "TRADE_FINISHED":
+			rsp := aliRsp.Response
+			return ps.withPaymentLock(record, func() error {
+				captureAlipayForex(record, alipayForexFields{
+					SettleCurrency:  rsp.SettleCurrency,
+					SettleAmount:    rsp.SettleAmount,
+					SettleTransRate: rsp.SettleTransRate,
+					PayCurrency:     rsp.PayCurrency,
+					PayAmount:       rsp.PayAmount,
+					TransPayRate:    rsp.TransPayRate,
+				})
+				return ps.applyPaid(record, rsp.TradeNo)
+			})
+		case "TRADE_CLOSED":
+			return ps.markClosed(record)
+		}
+	case "wechat":
+		if ps.wxClient() == nil {
+			return errors.New("微信客户端未初始化")
+		}
+		bm := make(gopay.BodyMap)
+		bm.Set("out_trade_no", outTradeNo(record))
+		bm.Set("nonce_str", util.RandomString(32))
+		wxRsp, _, err := ps.wxClient().QueryOrder(context.Background(), bm)
+		if err != nil {
+			return fmt.Errorf("查询微信订单失败: %w", err)
+		}
+		switch wxRsp.TradeState {
+		case "SUCCESS":
+			return ps.markPaid(record, wxRsp.TransactionId)
+		case "CLOSED", "REVOKED", "PAYERROR":
+			return ps.markClosed(record)
+		}
+	}
+	return nil
+}
+
+// markPaid 支付成功后的统一处理：充值类支付记入用户余额，其余记入销售收入。
+// 持有支付单锁并重新读取记录后再判断状态，多副本同时收到通知或对账与通知并发时只处理一次
+func (ps *PaymentService) markPaid(record *PaymentRecord, providerTradeNo string) error {
+	return ps.withPaymentLock(record, func() error {
+		return ps.applyPaid(record, providerTradeNo)
+	})
+}
+
+// applyPaid markPaid 的状态变更，调用方须持有支付单锁
+func (ps *PaymentService) applyPaid(record *PaymentRecord, providerTradeNo string) error {
+	if record.Status != StatusPending {
+		return nil
+	}
+
+	record.Status = StatusPaid
+	if providerTradeNo != "" {
+		record.ProviderTradeNo = providerTradeNo
+	}
+	if err := ps.store.Save(record); err != nil {
+		return err
+	}
+	ps.afterPaid(record)
+
+	if record.Purpose == PurposeTopUp {
+		return ps.creditTopUp(record)
+	}
+	if err := ps.postSale(record, record.Amount); err != nil {
+		return err
+	}
+	if record.ParentPaymentID != "" {
+		return ps.settleSplitTender(record)
+	}
+	return nil
+}
+
+// afterPaid 支付成功后的通知类后续动作：推送事件、申请电子发票
+func (ps *PaymentService) afterPaid(record *PaymentRecord) {
+	ps.webhooks.Emit(record.TenantID, EventPaymentPaid, record)
+	if record.Invoice != nil {
+		ps.requestFapiao(record.PaymentID)
+	}
+}
+
+// markClosed 交易关闭或超时未支付，与 markPaid 同样持有支付单锁
+func (ps *PaymentService) markClosed(record *PaymentRecord) error {
+	return ps.withPaymentLock(record, func() error {
+		return ps.applyClosed(record)
+	})
+}
+
+// applyClosed markClosed 的状态变更，调用方须持有支付单锁
+func (ps *PaymentService) applyClosed(record *PaymentRecord) error {
+	if record.Status != StatusPending {
+		return nil
+	}
+	record.Status = StatusClosed
+	if err := ps.store.Save(record); err != nil {
+		return err
+	}
+	ps.webhooks.Emit(record.TenantID, EventPaymentClosed, record)
+
+	if record.ParentPaymentID != "" {
+		return ps.settleSplitTender(record)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StatusCache 支付状态查询结果的短期缓存，供收银台高频轮询使用。
+// 记录写入时由 statusCachingStore 失效，TTL 只兜底跨副本的进程内缓存和写入与回填的竞争
+type StatusCache interface {
+	Get(paymentID string) (*PaymentData, bool)
+	Set(paymentID string, data *PaymentData)
+	Invalidate(paymentID string)
+}
+
+// NewStatusCache 配置 REDIS_URL 时各副本共享 Redis 缓存，否则使用进程内缓存。STATUS_CACHE_TTL 默认 3 秒，设为 0 关闭缓存
+func NewStatusCache() StatusCache {
+	ttl := envDuration("STATUS_CACHE_TTL", 3*time.Second)
+	if ttl <= 0 {
+		return nil
+	}
+	if client := sharedRedis(); client != nil {
+		return &redisStatusCache{client: client, ttl: ttl}
+	}
+	return &memoryStatusCache{ttl: ttl, entries: make(map[string]statusCacheEntry)}
+}
+
+type redisStatusCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func statusCacheKey(paymentID string) string {
+	return "gopay:status:" + paymentID
+}
+
+// Get Redis 不可用时视为未命中，查询回落到存储和渠道
+func (c *redisStatusCache) Get(paymentID string) (*PaymentData, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	raw, err := c.client.Get(ctx, statusCacheKey(paymentID)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("读取支付状态缓存失败 %s: %v", paymentID, err)
+		}
+		return nil, false
+	}
+	var data PaymentData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, false
+	}
+	return &data, true
+}
+
+func (c *redisStatusCache) Set(paymentID string, data *PaymentData) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := c.client.Set(ctx, statusCacheKey(paymentID), raw, c.ttl).Err(); err != nil {
+		log.Printf("写入支付状态缓存失败 %s: %v", paymentID, err)
+	}
+}
+
+func (c *redisStatusCache) Invalidate(paymentID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.client.Del(ctx, statusCacheKey(paymentID)).Err(); err != nil {
+		log.Printf("【警告】失效支付状态缓存失败 %s，将在 TTL 后过期: %v", paymentID, err)
+	}
+}
+
+type statusCacheEntry struct {
+	data      PaymentData
+	expiresAt time.Time
+}
+
+// memoryStatusCache 进程内缓存，过期条目在写入时顺带清理
+type memoryStatusCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]statusCacheEntry
+}
+
+func (c *memoryStatusCache) Get(paymentID string) (*PaymentData, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[paymentID]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	data := entry.data
+	return &data, true
+}
+
+func (c *memoryStatusCache) Set(paymentID string, data *PaymentData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= 10000 {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+	c.entries[paymentID] = statusCacheEntry{data: *data, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *memoryStatusCache) Invalidate(paymentID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, paymentID)
+}
+
+// statusCachingStore 在支付记录写入或删除后失效状态缓存，回调、对账、退款等所有状态变更都经过这里
+type statusCachingStore struct {
+	PaymentStore
+	cache StatusCache
+}
+
+// NewStatusCachingStore cache 为 nil 时直接返回底层存储
+func NewStatusCachingStore(inner PaymentStore, cache StatusCache) PaymentStore {
+	if cache == nil {
+		return inner
+	}
+	return &statusCachingStore{PaymentStore: inner, cache: cache}
+}
+
+func (s *statusCachingStore) Save(record *PaymentRecord) error {
+	err := s.PaymentStore.Save(record)
+	s.cache.Invalidate(record.PaymentID)
+	return err
+}
+
+func (s *statusCachingStore) Delete(paymentID string) error {
+	err := s.PaymentStore.Delete(paymentID)
+	s.cache.Invalidate(paymentID)
+	return err
+}
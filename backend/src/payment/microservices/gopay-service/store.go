@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gopay-service/internal/rates"
+)
+
+// 支付状态
+const (
+	StatusPending    = "pending"
+	StatusAuthorized = "authorized"
+	StatusPaid       = "paid"
+	StatusVoided     = "voided"
+	StatusFailed     = "failed"
+	StatusClosed     = "closed"
+)
+
+// 支付用途
+const (
+	PurposeOrder = ""      // 普通订单支付
+	PurposeTopUp = "topup" // 储值余额充值
+)
+
+var ErrPaymentNotFound = errors.New("支付记录不存在")
+
+// PaymentRecord 服务内保存的支付记录
+type PaymentRecord struct {
+	PaymentID       string                 `json:"paymentId"`
+	OrderID         string                 `json:"orderId"`
+	TenantID        string                 `json:"tenantId,omitempty"`
+	UserID          string                 `json:"userId,omitempty"`
+	Method          string                 `json:"method"`
+	Purpose         string                 `json:"purpose,omitempty"`
+	Amount          float64                `json:"amount"`
+	Currency        string                 `json:"currency,omitempty"`
+	Subject         string                 `json:"subject,omitempty"`
+	Status          string                 `json:"status"`
+	OutTradeNo      string                 `json:"outTradeNo,omitempty"`
+	ProviderTradeNo string                 `json:"providerTradeNo,omitempty"`
+	AuthNo          string                 `json:"authNo,omitempty"`
+	AuthRequestNo   string                 `json:"authRequestNo,omitempty"`
+	PayerID         string                 `json:"payerId,omitempty"`
+	CapturedAmount  float64                `json:"capturedAmount,omitempty"`
+	RefundedAmount  float64                `json:"refundedAmount,omitempty"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	ReturnURL       string                 `json:"returnUrl,omitempty"`
+	NotifyURL       string                 `json:"notifyUrl,omitempty"`
+	ExpiresAt       time.Time              `json:"expiresAt,omitempty"`
+	ExpiryExtended  bool                   `json:"expiryExtended,omitempty"`
+	Installment     *InstallmentPlan       `json:"installment,omitempty"`
+	Forex           *ForexInfo             `json:"forex,omitempty"`           // 跨境支付的币种和汇率
+	ExchangeRate    *rates.Quote           `json:"exchangeRate,omitempty"`    // 下单时订单币种对记账币种的参考汇率
+	ParentPaymentID string                 `json:"parentPaymentId,omitempty"` // 组合支付中外部渠道段所属的主记录
+	Legs            []PaymentLeg           `json:"legs,omitempty"`            // 组合支付的各段
+	GiftCardNo      string                 `json:"giftCardNo,omitempty"`
+	Channel         string                 `json:"channel,omitempty"`     // 渠道产品，如支付宝 page/app、微信 native
+	Fee             float64                `json:"fee,omitempty"`         // 渠道手续费
+	FeeRefunded     float64                `json:"feeRefunded,omitempty"` // 退款时渠道退还的手续费
+	Invoice         *FapiaoInfo            `json:"invoice,omitempty"`
+	CredentialID    string                 `json:"credentialId,omitempty"` // 创建支付时使用的渠道密钥编号，用于回调验签
+	RiskScore       float64                `json:"riskScore,omitempty"`
+	RiskDecision    string                 `json:"riskDecision,omitempty"`
+	RiskAssessments []RiskAssessment       `json:"riskAssessments,omitempty"`
+	StatusHistory   []StatusChange         `json:"statusHistory,omitempty"` // 由存储在状态变化时维护
+	Webhooks        []PaymentWebhook       `json:"webhooks,omitempty"`      // 下单时追加的本笔支付回调地址
+	Scheduled       *ScheduledActivation   `json:"scheduled,omitempty"`     // 预约支付的生效信息
+	Saga            *SagaState             `json:"saga,omitempty"`          // 与订单履约的协调状态
+	Sealed          *SealedData            `json:"sealed,omitempty"`        // 加密保存的元数据和购方信息，读取时由存储解密
+	CreatedAt       time.Time              `json:"createdAt"`
+	UpdatedAt       time.Time              `json:"updatedAt"`
+}
+
+// StatusChange 一次支付状态变化
+type StatusChange struct {
+	From string    `json:"from,omitempty"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// PaymentStore 支付记录存储
+type PaymentStore interface {
+	Save(record *PaymentRecord) error
+	Get(paymentID string) (*PaymentRecord, error)
+	List() ([]*PaymentRecord, error)
+	Find(filter FilterExpr) ([]*PaymentRecord, error)
+	Delete(paymentID string) error
+	Ping() error
+}
+
+// memoryPaymentStore 基于内存的支付记录存储
+type memoryPaymentStore struct {
+	mu      sync.RWMutex
+	records map[string]*PaymentRecord
+}
+
+func NewMemoryPaymentStore() PaymentStore {
+	return &memoryPaymentStore{
+		records: make(map[string]*PaymentRecord),
+	}
+}
+
+func (s *memoryPaymentStore) Save(record *PaymentRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+
+	copied := *record
+	// 状态历史以存储中的为准，调用方持有的副本可能已过期
+	var from string
+	copied.StatusHistory = nil
+	if existing, ok := s.records[record.PaymentID]; ok {
+		from = existing.Status
+		copied.StatusHistory = existing.StatusHistory
+	}
+	if from != record.Status {
+		copied.StatusHistory = append(append([]StatusChange(nil), copied.StatusHistory...), StatusChange{From: from, To: record.Status, At: now})
+	}
+	s.records[record.PaymentID] = &copied
+	return nil
+}
+
+func (s *memoryPaymentStore) Get(paymentID string) (*PaymentRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// Delete 删除支付记录，仅用于归档后清理
+func (s *memoryPaymentStore) Delete(paymentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, paymentID)
+	return nil
+}
+
+func (s *memoryPaymentStore) Ping() error {
+	return nil
+}
+
+// List 按创建时间倒序返回全部记录
+func (s *memoryPaymentStore) List() ([]*PaymentRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*PaymentRecord, 0, len(s.records))
+	for _, record := range s.records {
+		copied := *record
+		records = append(records, &copied)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+// Find 返回匹配过滤表达式的记录，filter 为 nil 时返回全部
+func (s *memoryPaymentStore) Find(filter FilterExpr) ([]*PaymentRecord, error) {
+	records, err := s.List()
+	if err != nil || filter == nil {
+		return records, err
+	}
+
+	matched := records[:0]
+	for _, record := range records {
+		if filter.Match(record) {
+			matched = append(matched, record)
+		}
+	}
+	return matched, nil
+}
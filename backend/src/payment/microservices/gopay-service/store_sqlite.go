@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// openSQLite 打开或创建 SQLite 文件。
+// 只保留一个连接：SQLite 同一时刻只允许一个写事务，串行化后不会出现 SQLITE_BUSY
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// NewSQLiteRepository 打开 SQLite 存储，表结构版本须与程序内置的迁移一致，见 checkSchemaVersion
+func NewSQLiteRepository(path string) (*Repository, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Repository{
+		Payments: &sqlitePaymentStore{db: db},
+		Refunds:  &sqliteRefundStore{db: db},
+		Wallets:  &sqliteWalletStore{db: db},
+		Ledger:   &sqliteLedger{db: db},
+
+		GiftCards:  &sqliteGiftCardStore{db: db},
+		Agreements: &sqliteAgreementStore{db: db},
+		Payouts:    &sqlitePayoutStore{db: db},
+
+		driver: StoreSQLite,
+		db:     db,
+	}, nil
+}
+
+// sqlitePaymentStore 基于 SQLite 的支付记录存储，状态历史的维护方式与内存存储一致
+type sqlitePaymentStore struct {
+	db *sql.DB
+}
+
+// paymentRow data 列的内容。回调签名密钥等字段不对外返回（json:"-"），但需要随记录持久化
+type paymentRow struct {
+	*PaymentRecord
+	WebhookSecrets    map[string]string `json:"webhookSecrets,omitempty"` // 按 webhookId
+	ScheduledPurpose  string            `json:"scheduledPurpose,omitempty"`
+	ScheduledClientIP string            `json:"scheduledClientIp,omitempty"`
+}
+
+func encodePaymentRow(record *PaymentRecord) ([]byte, error) {
+	row := paymentRow{PaymentRecord: record}
+	for _, webhook := range record.Webhooks {
+		if webhook.Secret == "" {
+			continue
+		}
+		if row.WebhookSecrets == nil {
+			row.WebhookSecrets = make(map[string]string)
+		}
+		row.WebhookSecrets[webhook.WebhookID] = webhook.Secret
+	}
+	if record.Scheduled != nil {
+		row.ScheduledPurpose = record.Scheduled.Request.Purpose
+		row.ScheduledClientIP = record.Scheduled.Request.ClientIP
+	}
+	return json.Marshal(&row)
+}
+
+func decodePaymentRow(data []byte) (*PaymentRecord, error) {
+	row := paymentRow{PaymentRecord: new(PaymentRecord)}
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, fmt.Errorf("解析支付记录失败: %w", err)
+	}
+	record := row.PaymentRecord
+	for i := range record.Webhooks {
+		record.Webhooks[i].Secret = row.WebhookSecrets[record.Webhooks[i].WebhookID]
+	}
+	if record.Scheduled != nil {
+		record.Scheduled.Request.Purpose = row.ScheduledPurpose
+		record.Scheduled.Request.ClientIP = row.ScheduledClientIP
+	}
+	return record, nil
+}
+
+func (s *sqlitePaymentStore) Save(record *PaymentRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+
+	copied := *record
+	// 状态历史以存储中的为准，调用方持有的副本可能已过期
+	var from string
+	copied.StatusHistory = nil
+	var data []byte
+	err = tx.QueryRow(`SELECT data FROM payments WHERE payment_id = ?`, record.PaymentID).Scan(&data)
+	switch {
+	case err == nil:
+		existing, err := decodePaymentRow(data)
+		if err != nil {
+			return err
+		}
+		from = existing.Status
+		copied.StatusHistory = existing.StatusHistory
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	if from != record.Status {
+		copied.StatusHistory = append(copied.StatusHistory, StatusChange{From: from, To: record.Status, At: now})
+	}
+
+	if data, err = encodePaymentRow(&copied); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO payments (payment_id, order_id, tenant_id, status, method, currency, amount, created_at, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (payment_id) DO UPDATE SET order_id = excluded.order_id, tenant_id = excluded.tenant_id,
+		status = excluded.status, method = excluded.method, currency = excluded.currency, amount = excluded.amount,
+		created_at = excluded.created_at, updated_at = excluded.updated_at, data = excluded.data`,
+		copied.PaymentID, copied.OrderID, copied.TenantID, copied.Status, copied.Method, copied.Currency, copied.Amount,
+		copied.CreatedAt.UnixNano(), copied.UpdatedAt.UnixNano(), data)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlitePaymentStore) Get(paymentID string) (*PaymentRecord, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM payments WHERE payment_id = ?`, paymentID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePaymentRow(data)
+}
+
+// List 按创建时间倒序返回全部记录
+func (s *sqlitePaymentStore) List() ([]*PaymentRecord, error) {
+	return s.Find(nil)
+}
+
+// Find 过滤表达式编译为参数化的 WHERE 子句，在 SQL 中过滤，列名只来自 filterFields 白名单
+func (s *sqlitePaymentStore) Find(filter FilterExpr) ([]*PaymentRecord, error) {
+	where, args := FilterToSQL(filter)
+	rows, err := s.db.Query(`SELECT data FROM payments WHERE `+where+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*PaymentRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		record, err := decodePaymentRow(data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Delete 删除支付记录，仅用于归档后清理
+func (s *sqlitePaymentStore) Delete(paymentID string) error {
+	_, err := s.db.Exec(`DELETE FROM payments WHERE payment_id = ?`, paymentID)
+	return err
+}
+
+func (s *sqlitePaymentStore) Ping() error {
+	return s.db.Ping()
+}
+
+// sqliteRefundStore 基于 SQLite 的退款记录存储
+type sqliteRefundStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteRefundStore) Save(refund *RefundRecord) error {
+	now := time.Now()
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = now
+	}
+	refund.UpdatedAt = now
+
+	data, err := json.Marshal(refund)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO refunds (refund_id, payment_id, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (refund_id) DO UPDATE SET payment_id = excluded.payment_id, created_at = excluded.created_at, data = excluded.data`,
+		refund.RefundID, refund.PaymentID, refund.CreatedAt.UnixNano(), data)
+	return err
+}
+
+func (s *sqliteRefundStore) Get(refundID string) (*RefundRecord, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM refunds WHERE refund_id = ?`, refundID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefundNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	refund := new(RefundRecord)
+	if err := json.Unmarshal(data, refund); err != nil {
+		return nil, fmt.Errorf("解析退款记录失败: %w", err)
+	}
+	return refund, nil
+}
+
+func (s *sqliteRefundStore) ListByPayment(paymentID string) ([]*RefundRecord, error) {
+	return s.query(`SELECT data FROM refunds WHERE payment_id = ? ORDER BY created_at`, paymentID)
+}
+
+func (s *sqliteRefundStore) List() ([]*RefundRecord, error) {
+	return s.query(`SELECT data FROM refunds ORDER BY created_at DESC`)
+}
+
+func (s *sqliteRefundStore) query(query string, args ...interface{}) ([]*RefundRecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []*RefundRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		refund := new(RefundRecord)
+		if err := json.Unmarshal(data, refund); err != nil {
+			return nil, fmt.Errorf("解析退款记录失败: %w", err)
+		}
+		refunds = append(refunds, refund)
+	}
+	return refunds, rows.Err()
+}
+
+// Delete 删除退款记录，仅用于归档后清理
+func (s *sqliteRefundStore) Delete(refundID string) error {
+	_, err := s.db.Exec(`DELETE FROM refunds WHERE refund_id = ?`, refundID)
+	return err
+}
+
+// sqliteWalletStore 基于 SQLite 的储值余额，余额按币种的最小货币单位保存
+type sqliteWalletStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteWalletStore) Credit(userID, currency string, amount float64) (*WalletAccount, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("入账金额必须大于0")
+	}
+	return s.adjust(userID, currency, toMinorUnitsIn(amount, currency))
+}
+
+// Debit 扣减余额，余额不足时返回 ErrInsufficientBalance
+func (s *sqliteWalletStore) Debit(userID, currency string, amount float64) (*WalletAccount, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("扣减金额必须大于0")
+	}
+	return s.adjust(userID, currency, -toMinorUnitsIn(amount, currency))
+}
+
+// adjust 在同一事务中读出余额并写回，delta 为负时校验余额
+func (s *sqliteWalletStore) adjust(userID, currency string, delta int64) (*WalletAccount, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var balance int64
+	err = tx.QueryRow(`SELECT balance_minor FROM wallet_accounts WHERE user_id = ? AND currency = ?`, userID, currency).Scan(&balance)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if delta < 0 && (errors.Is(err, sql.ErrNoRows) || balance < -delta) {
+		return nil, ErrInsufficientBalance
+	}
+
+	account := &WalletAccount{
+		UserID:    userID,
+		Currency:  currency,
+		Balance:   fromMinorUnitsIn(balance+delta, currency),
+		UpdatedAt: time.Now(),
+	}
+	_, err = tx.Exec(`INSERT INTO wallet_accounts (user_id, currency, balance_minor, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, currency) DO UPDATE SET balance_minor = excluded.balance_minor, updated_at = excluded.updated_at`,
+		userID, currency, balance+delta, account.UpdatedAt.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *sqliteWalletStore) Get(userID, currency string) (*WalletAccount, error) {
+	account := &WalletAccount{UserID: userID, Currency: currency}
+	var balance, updatedAt int64
+	err := s.db.QueryRow(`SELECT balance_minor, updated_at FROM wallet_accounts WHERE user_id = ? AND currency = ?`, userID, currency).Scan(&balance, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	account.Balance = fromMinorUnitsIn(balance, currency)
+	account.UpdatedAt = time.Unix(0, updatedAt)
+	return account, nil
+}
+
+func (s *sqliteWalletStore) List(userID string) ([]*WalletAccount, error) {
+	rows, err := s.db.Query(`SELECT currency, balance_minor, updated_at FROM wallet_accounts WHERE user_id = ? ORDER BY currency`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*WalletAccount
+	for rows.Next() {
+		account := &WalletAccount{UserID: userID}
+		var balance, updatedAt int64
+		if err := rows.Scan(&account.Currency, &balance, &updatedAt); err != nil {
+			return nil, err
+		}
+		account.Balance = fromMinorUnitsIn(balance, account.Currency)
+		account.UpdatedAt = time.Unix(0, updatedAt)
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (s *sqliteWalletStore) Rename(userID, to string) error {
+	_, err := s.db.Exec(`UPDATE wallet_accounts SET user_id = ? WHERE user_id = ?`, to, userID)
+	return err
+}
+
+// sqliteLedger 基于 SQLite 的账本，一次 Post 的分录在同一事务中写入
+type sqliteLedger struct {
+	db *sql.DB
+}
+
+func (l *sqliteLedger) Post(entries ...LedgerEntry) error {
+	if err := validateEntries(entries); err != nil {
+		return err
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	for _, e := range entries {
+		_, err := tx.Exec(`INSERT INTO ledger_entries (txn_id, account, direction, amount, currency, description, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			e.TxnID, e.Account, e.Direction, e.Amount, e.Currency, e.Description, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (l *sqliteLedger) Entries(txnID string) ([]LedgerEntry, error) {
+	return l.query(`WHERE txn_id = ?`, txnID)
+}
+
+func (l *sqliteLedger) AccountEntries(account string) ([]LedgerEntry, error) {
+	return l.query(`WHERE account = ?`, account)
+}
+
+func (l *sqliteLedger) RenameAccount(from, to string) error {
+	_, err := l.db.Exec(`UPDATE ledger_entries SET account = ? WHERE account = ?`, to, from)
+	return err
+}
+
+func (l *sqliteLedger) All() ([]LedgerEntry, error) {
+	return l.query(``)
+}
+
+// query 按入账顺序返回分录，where 为空时返回全部
+func (l *sqliteLedger) query(where string, args ...interface{}) ([]LedgerEntry, error) {
+	rows, err := l.db.Query(`SELECT entry_id, txn_id, account, direction, amount, currency, description, created_at
+		FROM ledger_entries `+where+` ORDER BY entry_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		var e LedgerEntry
+		var createdAt int64
+		if err := rows.Scan(&e.EntryID, &e.TxnID, &e.Account, &e.Direction, &e.Amount, &e.Currency, &e.Description, &createdAt); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = time.Unix(0, createdAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// giftCardRow gift_cards 表 data 列的内容。密码摘要和输错次数不对外返回（json:"-"），但需要随礼品卡持久化
+type giftCardRow struct {
+	*GiftCard
+	PinHash        string `json:"pinHash"`
+	FailedAttempts int    `json:"failedAttempts,omitempty"`
+}
+
+// sqliteGiftCardStore 基于 SQLite 的礼品卡存储
+type sqliteGiftCardStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteGiftCardStore) Save(card *GiftCard) error {
+	now := time.Now()
+	if card.CreatedAt.IsZero() {
+		card.CreatedAt = now
+	}
+	card.UpdatedAt = now
+
+	data, err := json.Marshal(&giftCardRow{GiftCard: card, PinHash: card.PinHash, FailedAttempts: card.FailedAttempts})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO gift_cards (card_no, status, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (card_no) DO UPDATE SET status = excluded.status, data = excluded.data`,
+		card.CardNo, card.Status, card.CreatedAt.UnixNano(), data)
+	return err
+}
+
+func (s *sqliteGiftCardStore) Get(cardNo string) (*GiftCard, error) {
+	cards, err := s.query(`SELECT data FROM gift_cards WHERE card_no = ?`, cardNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return nil, ErrGiftCardNotFound
+	}
+	return cards[0], nil
+}
+
+func (s *sqliteGiftCardStore) List() ([]*GiftCard, error) {
+	return s.query(`SELECT data FROM gift_cards ORDER BY created_at DESC`)
+}
+
+func (s *sqliteGiftCardStore) query(query string, args ...interface{}) ([]*GiftCard, error) {
+	rows, err := queryJSONRows[giftCardRow](s.db, "礼品卡", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	cards := make([]*GiftCard, 0, len(rows))
+	for _, row := range rows {
+		card := row.GiftCard
+		if card == nil {
+			card = new(GiftCard)
+		}
+		card.PinHash, card.FailedAttempts = row.PinHash, row.FailedAttempts
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+// sqliteAgreementStore 基于 SQLite 的代扣协议存储
+type sqliteAgreementStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteAgreementStore) Save(agreement *Agreement) error {
+	now := time.Now()
+	if agreement.CreatedAt.IsZero() {
+		agreement.CreatedAt = now
+	}
+	agreement.UpdatedAt = now
+
+	data, err := json.Marshal(agreement)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO agreements (agreement_id, user_id, status, created_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (agreement_id) DO UPDATE SET user_id = excluded.user_id, status = excluded.status, data = excluded.data`,
+		agreement.AgreementID, agreement.UserID, agreement.Status, agreement.CreatedAt.UnixNano(), data)
+	return err
+}
+
+func (s *sqliteAgreementStore) Get(agreementID string) (*Agreement, error) {
+	agreements, err := queryJSONRows[Agreement](s.db, "代扣协议", `SELECT data FROM agreements WHERE agreement_id = ?`, agreementID)
+	if err != nil {
+		return nil, err
+	}
+	if len(agreements) == 0 {
+		return nil, ErrAgreementNotFound
+	}
+	return agreements[0], nil
+}
+
+func (s *sqliteAgreementStore) List() ([]*Agreement, error) {
+	return queryJSONRows[Agreement](s.db, "代扣协议", `SELECT data FROM agreements ORDER BY created_at DESC`)
+}
+
+// sqlitePayoutStore 基于 SQLite 的提现付款存储
+type sqlitePayoutStore struct {
+	db *sql.DB
+}
+
+func (s *sqlitePayoutStore) Save(payout *Payout) error {
+	now := time.Now()
+	if payout.CreatedAt.IsZero() {
+		payout.CreatedAt = now
+	}
+	payout.UpdatedAt = now
+
+	data, err := json.Marshal(payout)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO payouts (payout_id, account_id, status, created_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (payout_id) DO UPDATE SET account_id = excluded.account_id, status = excluded.status, data = excluded.data`,
+		payout.PayoutID, payout.AccountID, payout.Status, payout.CreatedAt.UnixNano(), data)
+	return err
+}
+
+func (s *sqlitePayoutStore) Get(payoutID string) (*Payout, error) {
+	payouts, err := queryJSONRows[Payout](s.db, "提现记录", `SELECT data FROM payouts WHERE payout_id = ?`, payoutID)
+	if err != nil {
+		return nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, ErrPayoutNotFound
+	}
+	return payouts[0], nil
+}
+
+func (s *sqlitePayoutStore) List() ([]*Payout, error) {
+	return queryJSONRows[Payout](s.db, "提现记录", `SELECT data FROM payouts ORDER BY created_at DESC`)
+}
+
+// queryJSONRows 读出 data 列并逐行解析，what 用于错误信息
+func queryJSONRows[T any](db *sql.DB, what, query string, args ...interface{}) ([]*T, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*T
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		record := new(T)
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, fmt.Errorf("解析%s失败: %w", what, err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteRepository 在临时目录创建 SQLite 存储并执行全部迁移
+func newTestSQLiteRepository(t *testing.T) *Repository {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gopay.db")
+	t.Setenv("SQLITE_PATH", path)
+	t.Setenv("STORE_DRIVER", StoreSQLite)
+	if err := runMigrations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewSQLiteRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestSQLiteGiftCardStore(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+	card := &GiftCard{CardNo: "GC1", PinHash: "abc", Currency: "CNY", InitialValue: 100, Balance: 100, Status: GiftCardActive, FailedAttempts: 2}
+	if err := repo.GiftCards.Save(card); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GiftCards.Get("GC1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PinHash != "abc" || got.FailedAttempts != 2 || got.Balance != 100 {
+		t.Fatalf("读出的礼品卡 %+v，密码摘要和输错次数须随卡保存", got)
+	}
+	if _, err := repo.GiftCards.Get("GC2"); err != ErrGiftCardNotFound {
+		t.Fatalf("不存在的礼品卡返回 %v", err)
+	}
+}
+
+func TestSQLiteAgreementAndPayoutStores(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+	base := time.Now()
+	for i, id := range []string{"A1", "A2"} {
+		agreement := &Agreement{AgreementID: id, UserID: "U1", Status: AgreementActive, CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if err := repo.Agreements.Save(agreement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	agreements, err := repo.Agreements.List()
+	if err != nil || len(agreements) != 2 || agreements[0].AgreementID != "A2" {
+		t.Fatalf("代扣协议应按创建时间倒序返回: %+v %v", agreements, err)
+	}
+	if _, err := repo.Agreements.Get("A3"); err != ErrAgreementNotFound {
+		t.Fatalf("不存在的代扣协议返回 %v", err)
+	}
+
+	if err := repo.Payouts.Save(&Payout{PayoutID: "PO1", AccountID: "U1", Amount: 1.005, Currency: "KWD", Status: PayoutPendingApproval}); err != nil {
+		t.Fatal(err)
+	}
+	payout, err := repo.Payouts.Get("PO1")
+	if err != nil || payout.Amount != 1.005 || payout.Status != PayoutPendingApproval {
+		t.Fatalf("读出的提现记录 %+v %v", payout, err)
+	}
+	if _, err := repo.Payouts.Get("PO2"); err != ErrPayoutNotFound {
+		t.Fatalf("不存在的提现记录返回 %v", err)
+	}
+}
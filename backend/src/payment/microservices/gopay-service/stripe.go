@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const stripeAPIBase = "https://api.stripe.com/v1"
+
+// StripeClient Stripe REST API 的精简客户端，目前只覆盖 PaymentIntent 预授权相关接口
+type StripeClient struct {
+	secretKey  string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// StripePaymentIntent PaymentIntent 中本服务关心的字段
+type StripePaymentIntent struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Amount         int64  `json:"amount"`
+	AmountReceived int64  `json:"amount_received"`
+	Currency       string `json:"currency"`
+	ClientSecret   string `json:"client_secret"`
+}
+
+// StripeRefund Refund 中本服务关心的字段
+type StripeRefund struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Amount int64  `json:"amount"`
+}
+
+type stripeErrorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewStripeClient(secretKey string) *StripeClient {
+	return &StripeClient{
+		secretKey:  secretKey,
+		baseURL:    stripeAPIBase,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// CreatePaymentIntent 创建 PaymentIntent
+func (sc *StripeClient) CreatePaymentIntent(ctx context.Context, params url.Values, idempotencyKey string) (*StripePaymentIntent, error) {
+	intent := new(StripePaymentIntent)
+	if err := sc.post(ctx, "/payment_intents", params, idempotencyKey, intent); err != nil {
+		return nil, err
+	}
+	return intent, nil
+}
+
+// CapturePaymentIntent 对手动扣款模式的 PaymentIntent 执行扣款
+func (sc *StripeClient) CapturePaymentIntent(ctx context.Context, intentID string, params url.Values, idempotencyKey string) (*StripePaymentIntent, error) {
+	intent := new(StripePaymentIntent)
+	if err := sc.post(ctx, "/payment_intents/"+url.PathEscape(intentID)+"/capture", params, idempotencyKey, intent); err != nil {
+		return nil, err
+	}
+	return intent, nil
+}
+
+// CancelPaymentIntent 取消 PaymentIntent 并释放冻结金额
+func (sc *StripeClient) CancelPaymentIntent(ctx context.Context, intentID string, params url.Values, idempotencyKey string) (*StripePaymentIntent, error) {
+	intent := new(StripePaymentIntent)
+	if err := sc.post(ctx, "/payment_intents/"+url.PathEscape(intentID)+"/cancel", params, idempotencyKey, intent); err != nil {
+		return nil, err
+	}
+	return intent, nil
+}
+
+// CreateRefund 对 PaymentIntent 发起退款
+func (sc *StripeClient) CreateRefund(ctx context.Context, params url.Values, idempotencyKey string) (*StripeRefund, error) {
+	refund := new(StripeRefund)
+	if err := sc.post(ctx, "/refunds", params, idempotencyKey, refund); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (sc *StripeClient) post(ctx context.Context, path string, params url.Values, idempotencyKey string, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, sc.baseURL+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	httpReq.SetBasicAuth(sc.secretKey, "")
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := sc.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("请求Stripe失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取Stripe响应失败: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errBody stripeErrorBody
+		if json.Unmarshal(body, &errBody) == nil && errBody.Error.Message != "" {
+			return fmt.Errorf("Stripe错误(%s): %s", errBody.Error.Code, errBody.Error.Message)
+		}
+		return fmt.Errorf("Stripe返回状态码 %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/alipay"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 代扣协议状态
+const (
+	AgreementSigning   = "signing"
+	AgreementActive    = "active"
+	AgreementPastDue   = "past_due"
+	AgreementCancelled = "cancelled"
+)
+
+// dunningSchedule 扣款失败后的重试间隔，全部用完后协议进入 past_due
+var dunningSchedule = []time.Duration{time.Hour, 24 * time.Hour, 72 * time.Hour}
+
+var ErrAgreementNotFound = errors.New("代扣协议不存在")
+
+type SubscriptionRequest struct {
+	UserID         string  `json:"userId" binding:"required"`
+	Method         string  `json:"method" binding:"required"`
+	Subject        string  `json:"subject" binding:"required"`
+	Amount         float64 `json:"amount" binding:"required"`
+	Currency       string  `json:"currency"`
+	Interval       string  `json:"interval" binding:"required"` // day | month
+	IntervalCount  int     `json:"intervalCount"`
+	FirstChargeAt  string  `json:"firstChargeAt"` // RFC3339，为空时签约后立即扣首期
+	ReturnURL      string  `json:"returnUrl"`
+	NotifyURL      string  `json:"notifyUrl"`
+	ClientIP       string  `json:"clientIp"`
+	DisplayAccount string  `json:"displayAccount"`
+}
+
+type CancelSubscriptionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Agreement 代扣协议
+type Agreement struct {
+	AgreementID         string    `json:"agreementId"`
+	UserID              string    `json:"userId"`
+	Method              string    `json:"method"`
+	Subject             string    `json:"subject"`
+	Amount              float64   `json:"amount"`
+	Currency            string    `json:"currency,omitempty"`
+	Interval            string    `json:"interval"`
+	IntervalCount       int       `json:"intervalCount"`
+	Status              string    `json:"status"`
+	ProviderAgreementNo string    `json:"providerAgreementNo,omitempty"`
+	NotifyURL           string    `json:"notifyUrl,omitempty"`
+	CycleCount          int       `json:"cycleCount"`
+	FailedAttempts      int       `json:"failedAttempts"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastChargedAt       time.Time `json:"lastChargedAt,omitempty"`
+	NextChargeAt        time.Time `json:"nextChargeAt"`
+	CancelledAt         time.Time `json:"cancelledAt,omitempty"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+type SubscriptionData struct {
+	*Agreement
+	SignURL string `json:"signUrl,omitempty"`
+}
+
+// AgreementStore 代扣协议存储
+type AgreementStore interface {
+	Save(agreement *Agreement) error
+	Get(agreementID string) (*Agreement, error)
+	List() ([]*Agreement, error)
+}
+
+type memoryAgreementStore struct {
+	mu         sync.RWMutex
+	agreements map[string]*Agreement
+}
+
+func NewMemoryAgreementStore() AgreementStore {
+	return &memoryAgreementStore{agreements: make(map[string]*Agreement)}
+}
+
+func (s *memoryAgreementStore) Save(agreement *Agreement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if agreement.CreatedAt.IsZero() {
+		agreement.CreatedAt = now
+	}
+	agreement.UpdatedAt = now
+
+	copied := *agreement
+	s.agreements[agreement.AgreementID] = &copied
+	return nil
+}
+
+func (s *memoryAgreementStore) Get(agreementID string) (*Agreement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	agreement, ok := s.agreements[agreementID]
+	if !ok {
+		return nil, ErrAgreementNotFound
+	}
+	copied := *agreement
+	return &copied, nil
+}
+
+func (s *memoryAgreementStore) List() ([]*Agreement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	agreements := make([]*Agreement, 0, len(s.agreements))
+	for _, agreement := range s.agreements {
+		copied := *agreement
+		agreements = append(agreements, &copied)
+	}
+	sort.Slice(agreements, func(i, j int) bool {
+		return agreements[i].CreatedAt.After(agreements[j].CreatedAt)
+	})
+	return agreements, nil
+}
+
+// SubscriptionService 代扣签约、周期扣款及解约
+type SubscriptionService struct {
+	payments   *PaymentService
+	agreements AgreementStore
+	interval   time.Duration
+}
+
+func NewSubscriptionService(payments *PaymentService) *SubscriptionService {
+	return &SubscriptionService{
+		payments:   payments,
+		agreements: payments.repo.Agreements,
+		interval:   envDuration("SUBSCRIPTION_SCHEDULER_INTERVAL", time.Minute),
+	}
+}
+
+// Sign 创建代扣协议并返回签约链接
+func (ss *SubscriptionService) Sign(req *SubscriptionRequest) (*apierr.Response, error) {
+	if req.Interval != "day" && req.Interval != "month" {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的扣款周期: %s", req.Interval)), nil
+	}
+	if req.IntervalCount <= 0 {
+		req.IntervalCount = 1
+	}
+
+	firstChargeAt := time.Now()
+	if req.FirstChargeAt != "" {
+		t, err := time.Parse(time.RFC3339, req.FirstChargeAt)
+		if err != nil {
+			return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("firstChargeAt 格式无效: %s", req.FirstChargeAt)), nil
+		}
+		firstChargeAt = t
+	}
+
+	agreement := &Agreement{
+		AgreementID:   fmt.Sprintf("SUB%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		UserID:        req.UserID,
+		Method:        req.Method,
+		Subject:       req.Subject,
+		Amount:        req.Amount,
+		Currency:      req.Currency,
+		Interval:      req.Interval,
+		IntervalCount: req.IntervalCount,
+		Status:        AgreementSigning,
+		NotifyURL:     req.NotifyURL,
+		NextChargeAt:  firstChargeAt,
+	}
+
+	var signURL string
+	var err error
+	switch req.Method {
+	case "alipay":
+		signURL, err = ss.signAlipay(agreement, req)
+	case "wechat":
+		signURL, err = ss.signWechat(agreement, req)
+	default:
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持代扣的支付方式: %s", req.Method)), nil
+	}
+	if err != nil {
+		return apierr.ErrorResponse("PAYMENT_ERROR", err.Error()), nil
+	}
+
+	if err := ss.agreements.Save(agreement); err != nil {
+		return nil, err
+	}
+	return apierr.SuccessResponse(&SubscriptionData{Agreement: agreement, SignURL: signURL}), nil
+}
+
+func (ss *SubscriptionService) signAlipay(agreement *Agreement, req *SubscriptionRequest) (string, error) {
+	if ss.payments.aliClient() == nil {
+		return "", errors.New("支付宝客户端未初始化")
+	}
+
+	periodType := "DAY"
+	if agreement.Interval == "month" {
+		periodType = "MONTH"
+	}
+
+	bm := make(gopay.BodyMap)
+	bm.Set("personal_product_code", "CYCLE_PAY_AUTH_P")
+	bm.Set("product_code", "CYCLE_PAY_AUTH")
+	bm.Set("sign_scene", "INDUSTRY|DIGITAL_MEDIA")
+	bm.Set("external_agreement_no", agreement.AgreementID)
+	bm.SetBodyMap("access_params", func(b gopay.BodyMap) {
+		b.Set("channel", "ALIPAYAPP")
+	})
+	bm.SetBodyMap("period_rule_params", func(b gopay.BodyMap) {
+		b.Set("period_type", periodType)
+		b.Set("period", agreement.IntervalCount)
+		b.Set("execute_time", agreement.NextChargeAt.Format("2006-01-02"))
+		b.Set("single_amount", fmt.Sprintf("%.2f", agreement.Amount))
+	})
+	if req.ReturnURL != "" {
+		bm.Set("return_url", req.ReturnURL)
+	}
+	if req.NotifyURL != "" {
+		bm.Set("notify_url", req.NotifyURL)
+	}
+
+	signURL, err := ss.payments.aliClient().UserAgreementPageSign(context.Background(), bm)
+	if err != nil {
+		return "", fmt.Errorf("创建支付宝代扣签约失败: %w", err)
+	}
+	return signURL, nil
+}
+
+func (ss *SubscriptionService) signWechat(agreement *Agreement, req *SubscriptionRequest) (string, error) {
+	if ss.payments.wxClient() == nil {
+		return "", errors.New("微信客户端未初始化")
+	}
+
+	displayAccount := req.DisplayAccount
+	if displayAccount == "" {
+		displayAccount = agreement.UserID
+	}
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = "127.0.0.1"
+	}
+
+	bm := make(gopay.BodyMap)
+	bm.Set("plan_id", os.Getenv("WECHAT_PAPAY_PLAN_ID"))
+	bm.Set("contract_code", agreement.AgreementID)
+	bm.Set("request_serial", time.Now().UnixNano()/int64(time.Millisecond))
+	bm.Set("contract_display_account", displayAccount)
+	bm.Set("notify_url", req.NotifyURL)
+	bm.Set("version", "1.0")
+	bm.Set("timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	bm.Set("clientip", clientIP)
+	if req.ReturnURL != "" {
+		bm.Set("return_web", req.ReturnURL)
+	}
+
+	wxRsp, err := ss.payments.wxClient().EntrustH5(context.Background(), bm)
+	if err != nil {
+		return "", fmt.Errorf("创建微信代扣签约失败: %w", err)
+	}
+	if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
+		return "", fmt.Errorf("创建微信代扣签约失败: %s", wxRsp.ResultMsg)
+	}
+	return wxRsp.RedirectUrl, nil
+}
+
+// Get 查询协议，签约中的协议会向渠道同步签约结果
+func (ss *SubscriptionService) Get(agreementID string) (*apierr.Response, error) {
+	agreement, err := ss.agreements.Get(agreementID)
+	if err != nil {
+		return apierr.ErrorResponse("AGREEMENT_NOT_FOUND", err.Error()), nil
+	}
+
+	if agreement.Status == AgreementSigning {
+		if err := ss.syncSigning(agreement); err != nil {
+			log.Printf("同步代扣签约状态失败 %s: %v", agreement.AgreementID, err)
+		}
+	}
+	return apierr.SuccessResponse(&SubscriptionData{Agreement: agreement}), nil
+}
+
+// syncSigning 查询渠道签约结果，签约成功后协议生效
+func (ss *SubscriptionService) syncSigning(agreement *Agreement) error {
+	switch agreement.Method {
+	case "alipay":
+		bm := make(gopay.BodyMap)
+		bm.Set("personal_product_code", "CYCLE_PAY_AUTH_P")
+		bm.Set("sign_scene", "INDUSTRY|DIGITAL_MEDIA")
+		bm.Set("external_agreement_no", agreement.AgreementID)
+		aliRsp, err := ss.payments.aliClient().UserAgreementQuery(context.Background(), bm)
+		if err != nil {
+			return err
+		}
+		if aliRsp.Response.Status != "NORMAL" {
+			return nil
+		}
+		agreement.ProviderAgreementNo = aliRsp.Response.AgreementNo
+	case "wechat":
+		bm := make(gopay.BodyMap)
+		bm.Set("plan_id", os.Getenv("WECHAT_PAPAY_PLAN_ID"))
+		bm.Set("contract_code", agreement.AgreementID)
+		bm.Set("version", "1.0")
+		wxRsp, err := ss.payments.wxClient().EntrustQuery(context.Background(), bm)
+		if err != nil {
+			return err
+		}
+		// contract_state 0 表示签约中（已生效）
+		if wxRsp.ResultCode != "SUCCESS" || wxRsp.ContractState != "0" {
+			return nil
+		}
+		agreement.ProviderAgreementNo = wxRsp.ContractId
+	default:
+		return nil
+	}
+
+	agreement.Status = AgreementActive
+	return ss.agreements.Save(agreement)
+}
+
+// Cancel 解约，解约后不再发起扣款
+func (ss *SubscriptionService) Cancel(agreementID, reason string) (*apierr.Response, error) {
+	agreement, err := ss.agreements.Get(agreementID)
+	if err != nil {
+		return apierr.ErrorResponse("AGREEMENT_NOT_FOUND", err.Error()), nil
+	}
+	if agreement.Status == AgreementCancelled {
+		return apierr.SuccessResponse(&SubscriptionData{Agreement: agreement}), nil
+	}
+	if reason == "" {
+		reason = "用户取消订阅"
+	}
+
+	if agreement.ProviderAgreementNo != "" {
+		if err := ss.unsign(agreement, reason); err != nil {
+			return apierr.ErrorResponse("PAYMENT_ERROR", err.Error()), nil
+		}
+	}
+
+	agreement.Status = AgreementCancelled
+	agreement.CancelledAt = time.Now()
+	if err := ss.agreements.Save(agreement); err != nil {
+		return nil, err
+	}
+	return apierr.SuccessResponse(&SubscriptionData{Agreement: agreement}), nil
+}
+
+func (ss *SubscriptionService) unsign(agreement *Agreement, reason string) error {
+	switch agreement.Method {
+	case "alipay":
+		bm := make(gopay.BodyMap)
+		bm.Set("agreement_no", agreement.ProviderAgreementNo)
+		if _, err := ss.payments.aliClient().UserAgreementPageUnSign(context.Background(), bm); err != nil {
+			return fmt.Errorf("支付宝代扣解约失败: %w", err)
+		}
+	case "wechat":
+		bm := make(gopay.BodyMap)
+		bm.Set("contract_id", agreement.ProviderAgreementNo)
+		bm.Set("contract_termination_remark", reason)
+		bm.Set("version", "1.0")
+		wxRsp, err := ss.payments.wxClient().EntrustDelete(context.Background(), bm)
+		if err != nil {
+			return fmt.Errorf("微信代扣解约失败: %w", err)
+		}
+		if wxRsp.ResultCode != "SUCCESS" {
+			return fmt.Errorf("微信代扣解约失败: %s", wxRsp.ErrCodeDes)
+		}
+	}
+	return nil
+}
+
+// Run 周期扣款调度，直到 ctx 取消
+func (ss *SubscriptionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ss.chargeDue(time.Now())
+		}
+	}
+}
+
+func (ss *SubscriptionService) chargeDue(now time.Time) {
+	agreements, err := ss.agreements.List()
+	if err != nil {
+		log.Printf("加载代扣协议失败: %v", err)
+		return
+	}
+
+	for _, agreement := range agreements {
+		if agreement.Status == AgreementSigning {
+			if err := ss.syncSigning(agreement); err != nil {
+				log.Printf("同步代扣签约状态失败 %s: %v", agreement.AgreementID, err)
+			}
+		}
+		if agreement.Status != AgreementActive || agreement.NextChargeAt.After(now) {
+			continue
+		}
+		ss.charge(agreement, now)
+	}
+}
+
+// charge 发起一期扣款，失败时按 dunningSchedule 安排重试
+func (ss *SubscriptionService) charge(agreement *Agreement, now time.Time) {
+	paymentID := fmt.Sprintf("%s_%d_%d", agreement.AgreementID, agreement.CycleCount+1, agreement.FailedAttempts)
+
+	status, err := ss.applyCharge(agreement, paymentID)
+	record := &PaymentRecord{
+		PaymentID: paymentID,
+		OrderID:   paymentID,
+		UserID:    agreement.UserID,
+		Method:    agreement.Method,
+		Amount:    agreement.Amount,
+		Currency:  agreement.Currency,
+		Subject:   agreement.Subject,
+		Status:    status,
+		Metadata:  map[string]interface{}{"agreementId": agreement.AgreementID},
+	}
+	if saveErr := ss.payments.store.Save(record); saveErr != nil {
+		log.Printf("保存代扣支付记录失败 %s: %v", paymentID, saveErr)
+	}
+	if status == StatusPaid {
+		if postErr := ss.payments.postSale(record, record.Amount); postErr != nil {
+			log.Printf("代扣支付记账失败 %s: %v", paymentID, postErr)
+		}
+		ss.payments.afterPaid(record)
+	}
+
+	if err != nil {
+		agreement.LastError = err.Error()
+		if agreement.FailedAttempts >= len(dunningSchedule) {
+			agreement.Status = AgreementPastDue
+			log.Printf("代扣协议 %s 多次扣款失败，已暂停: %v", agreement.AgreementID, err)
+		} else {
+			agreement.NextChargeAt = now.Add(dunningSchedule[agreement.FailedAttempts])
+			log.Printf("代扣协议 %s 扣款失败，将于 %s 重试: %v", agreement.AgreementID, agreement.NextChargeAt.Format(time.RFC3339), err)
+		}
+		agreement.FailedAttempts++
+	} else {
+		agreement.CycleCount++
+		agreement.FailedAttempts = 0
+		agreement.LastError = ""
+		agreement.LastChargedAt = now
+		agreement.NextChargeAt = nextCycle(agreement.NextChargeAt, agreement.Interval, agreement.IntervalCount)
+	}
+
+	if err := ss.agreements.Save(agreement); err != nil {
+		log.Printf("保存代扣协议失败 %s: %v", agreement.AgreementID, err)
+	}
+}
+
+func (ss *SubscriptionService) applyCharge(agreement *Agreement, paymentID string) (string, error) {
+	switch agreement.Method {
+	case "alipay":
+		bm := make(gopay.BodyMap)
+		bm.Set("out_trade_no", paymentID)
+		bm.Set("total_amount", fmt.Sprintf("%.2f", agreement.Amount))
+		bm.Set("subject", agreement.Subject)
+		bm.Set("product_code", "CYCLE_PAY_AUTH")
+		bm.SetBodyMap("agreement_params", func(b gopay.BodyMap) {
+			b.Set("agreement_no", agreement.ProviderAgreementNo)
+		})
+		if _, err := ss.payments.aliClient().TradePay(context.Background(), bm); err != nil {
+			// 10003 表示扣款处理中，最终结果由支付状态同步确认
+			if bizErr, ok := alipay.IsBizError(err); ok && bizErr.Code == "10003" {
+				return StatusPending, nil
+			}
+			return StatusFailed, fmt.Errorf("支付宝代扣失败: %w", err)
+		}
+		// 受理成功不代表已扣款，以交易状态为准
+		queryBm := make(gopay.BodyMap)
+		queryBm.Set("out_trade_no", paymentID)
+		aliRsp, err := ss.payments.aliClient().TradeQuery(context.Background(), queryBm)
+		if err != nil {
+			log.Printf("查询支付宝代扣结果失败 %s: %v", paymentID, err)
+			return StatusPending, nil
+		}
+		switch aliRsp.Response.TradeStatus {
+		case "TRADE_SUCCESS", "TRADE_FINISHED":
+			return StatusPaid, nil
+		case "WAIT_BUYER_PAY":
+			return StatusPending, nil
+		default:
+			return StatusFailed, fmt.Errorf("支付宝代扣未成功，交易状态: %s", aliRsp.Response.TradeStatus)
+		}
+	case "wechat":
+		bm := make(gopay.BodyMap)
+		bm.Set("nonce_str", util.RandomString(32))
+		bm.Set("body", agreement.Subject)
+		bm.Set("out_trade_no", paymentID)
+		bm.Set("total_fee", toMinorUnits(agreement.Amount))
+		bm.Set("spbill_create_ip", "127.0.0.1")
+		bm.Set("notify_url", agreement.NotifyURL)
+		bm.Set("trade_type", "PAP")
+		bm.Set("contract_id", agreement.ProviderAgreementNo)
+		wxRsp, err := ss.payments.wxClient().EntrustApplyPay(context.Background(), bm)
+		if err != nil {
+			return StatusFailed, fmt.Errorf("微信代扣失败: %w", err)
+		}
+		if wxRsp.ReturnCode != "SUCCESS" || wxRsp.ResultCode != "SUCCESS" {
+			return StatusFailed, fmt.Errorf("微信代扣失败: %s", wxRsp.ErrCodeDes)
+		}
+		// 微信申请扣款为异步受理，最终结果以回调为准
+		return StatusPending, nil
+	default:
+		return StatusFailed, fmt.Errorf("不支持代扣的支付方式: %s", agreement.Method)
+	}
+}
+
+func nextCycle(from time.Time, interval string, count int) time.Time {
+	if interval == "month" {
+		return from.AddDate(0, count, 0)
+	}
+	return from.AddDate(0, 0, count)
+}
+
+// registerSubscriptionRoutes 注册代扣协议接口
+func registerSubscriptionRoutes(api *gin.RouterGroup, ss *SubscriptionService) {
+	api.POST("/subscriptions", func(c *gin.Context) {
+		var req SubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ss.Sign(&req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.GET("/subscriptions/:agreementId", func(c *gin.Context) {
+		resp, err := ss.Get(c.Param("agreementId"))
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.POST("/subscriptions/:agreementId/cancel", func(c *gin.Context) {
+		var req CancelSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		if agreement, err := ss.agreements.Get(c.Param("agreementId")); err == nil && !authorizeOwner(c, agreement.UserID) {
+			return
+		}
+
+		resp, err := ss.Cancel(c.Param("agreementId"), req.Reason)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultTenantID = "default"
+
+// TenantSettings 租户级别的支付策略
+type TenantSettings struct {
+	TenantID          string `json:"tenantId"`
+	RefundDestination string `json:"refundDestination"` // source | balance
+}
+
+// TenantRegistry 租户配置，未单独配置的租户使用 default 租户的配置
+type TenantRegistry struct {
+	mu       sync.RWMutex
+	settings map[string]*TenantSettings
+}
+
+// NewTenantRegistry 从 TENANT_CONFIG_FILE 指向的 JSON 文件加载租户配置
+func NewTenantRegistry() *TenantRegistry {
+	registry := &TenantRegistry{
+		settings: map[string]*TenantSettings{
+			defaultTenantID: {TenantID: defaultTenantID, RefundDestination: RefundToSource},
+		},
+	}
+
+	if path := os.Getenv("TENANT_CONFIG_FILE"); path != "" {
+		if err := registry.loadFile(path); err != nil {
+			log.Printf("加载租户配置失败: %v", err)
+		}
+	}
+	return registry
+}
+
+func (tr *TenantRegistry) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var list []*TenantSettings
+	if err := json.Unmarshal(content, &list); err != nil {
+		return err
+	}
+	for _, settings := range list {
+		if err := tr.Put(settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get 返回租户配置的副本
+func (tr *TenantRegistry) Get(tenantID string) TenantSettings {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	if settings, ok := tr.settings[tenantID]; ok {
+		return *settings
+	}
+	settings := *tr.settings[defaultTenantID]
+	settings.TenantID = tenantID
+	return settings
+}
+
+// Put 新增或覆盖租户配置
+func (tr *TenantRegistry) Put(settings *TenantSettings) error {
+	if settings.TenantID == "" {
+		return fmt.Errorf("tenantId 不能为空")
+	}
+	if settings.RefundDestination != RefundToSource && settings.RefundDestination != RefundToBalance {
+		return fmt.Errorf("不支持的退款去向: %s", settings.RefundDestination)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	copied := *settings
+	tr.settings[settings.TenantID] = &copied
+	return nil
+}
+
+// tenantFromToken 从已校验令牌的租户声明获取租户，按租户隔离的接口不能信任调用方自报的 X-Tenant-ID。
+// 未启用认证时（仅限本地开发）退回请求头
+func tenantFromToken(c *gin.Context) (string, error) {
+	principal := principalFromRequest(c)
+	if principal == nil {
+		return tenantFromRequest(c), nil
+	}
+	if principal.TenantID == "" {
+		return "", errors.New("访问令牌缺少租户声明")
+	}
+	return principal.TenantID, nil
+}
+
+// tenantFromRequest 从 X-Tenant-ID 请求头获取租户，缺省为 default
+func tenantFromRequest(c *gin.Context) string {
+	if tenantID := c.GetHeader("X-Tenant-ID"); tenantID != "" {
+		return tenantID
+	}
+	return defaultTenantID
+}
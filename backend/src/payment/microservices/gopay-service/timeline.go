@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// 时间线条目来源
+const (
+	TimelineStatus  = "status"
+	TimelineNotify  = "notify"
+	TimelineChain   = "chain"
+	TimelineWebhook = "webhook"
+	TimelineAdmin   = "admin"
+	TimelineRefund  = "refund"
+)
+
+// TimelineEntry 支付时间线中的一条记录
+type TimelineEntry struct {
+	At        time.Time `json:"at"`
+	Source    string    `json:"source"`
+	Event     string    `json:"event"`
+	Detail    string    `json:"detail,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	PaymentID string    `json:"paymentId"` // 组合支付中为对应分段的支付单号
+}
+
+// PaymentAction 运营人员对支付的一次操作
+type PaymentAction struct {
+	PaymentID string    `json:"paymentId"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// ActionLog 运营操作记录
+type ActionLog struct {
+	mu      sync.RWMutex
+	actions map[string][]PaymentAction
+}
+
+func NewActionLog() *ActionLog {
+	return &ActionLog{actions: make(map[string][]PaymentAction)}
+}
+
+func (al *ActionLog) Record(paymentID, actor, action, detail string) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.actions[paymentID] = append(al.actions[paymentID], PaymentAction{
+		PaymentID: paymentID,
+		Actor:     actor,
+		Action:    action,
+		Detail:    detail,
+		At:        time.Now(),
+	})
+}
+
+// Redact 把支付操作说明中出现的 value 替换为 replacement，删除个人信息时调用
+func (al *ActionLog) Redact(paymentID, value, replacement string) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	for i := range al.actions[paymentID] {
+		al.actions[paymentID][i].Detail = strings.ReplaceAll(al.actions[paymentID][i].Detail, value, replacement)
+	}
+}
+
+func (al *ActionLog) ListByPayment(paymentID string) []PaymentAction {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	return append([]PaymentAction(nil), al.actions[paymentID]...)
+}
+
+// operatorFromRequest 获取操作人：启用 JWT 认证时取令牌中的身份，否则取 X-Operator 请求头
+func operatorFromRequest(c *gin.Context) string {
+	if principal := principalFromRequest(c); principal != nil {
+		return principal.Name
+	}
+	if operator := c.GetHeader("X-Operator"); operator != "" {
+		return operator
+	}
+	// 内部服务通过 mTLS 调用时记为调用方服务
+	if service := c.GetString(httpmw.ClientServiceKey); service != "" {
+		return service
+	}
+	return "admin"
+}
+
+// Timeline 汇总状态变化、渠道通知、链上确认、Webhook 推送、运营操作和退款，按时间升序排列。
+// 组合支付同时包含各外部渠道分段的记录
+func (ps *PaymentService) Timeline(ctx context.Context, paymentID string) ([]TimelineEntry, error) {
+	record, err := ps.store.Get(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*PaymentRecord{record}
+	for _, leg := range record.Legs {
+		if leg.PaymentID == "" || leg.PaymentID == record.PaymentID {
+			continue
+		}
+		if legRecord, err := ps.store.Get(leg.PaymentID); err == nil {
+			records = append(records, legRecord)
+		}
+	}
+
+	var entries []TimelineEntry
+	for _, r := range records {
+		legEntries, err := ps.timelineOf(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, legEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries, nil
+}
+
+func (ps *PaymentService) timelineOf(ctx context.Context, record *PaymentRecord) ([]TimelineEntry, error) {
+	id := record.PaymentID
+	var entries []TimelineEntry
+
+	for _, change := range record.StatusHistory {
+		event := "created"
+		if change.From != "" {
+			event = "status_changed"
+		}
+		entries = append(entries, TimelineEntry{
+			At:        change.At,
+			Source:    TimelineStatus,
+			Event:     event,
+			Detail:    fmt.Sprintf("%s -> %s", change.From, change.To),
+			PaymentID: id,
+		})
+	}
+
+	receipts, err := ps.notifyDedup.ListByPayment(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, receipt := range receipts {
+		detail := fmt.Sprintf("渠道交易号 %s，处理结果 %s", receipt.ProviderTradeNo, receipt.Status)
+		if receipt.Duplicates > 0 {
+			detail += fmt.Sprintf("，重复通知 %d 次（最后一次 %s）", receipt.Duplicates, receipt.LastSeenAt.Format(time.RFC3339))
+		}
+		if receipt.Error != "" {
+			detail += "，错误: " + receipt.Error
+		}
+		entries = append(entries, TimelineEntry{
+			At:        receipt.FirstSeenAt,
+			Source:    TimelineNotify,
+			Event:     receipt.Provider + "." + receipt.NotifyType,
+			Detail:    detail,
+			Actor:     receipt.Provider,
+			PaymentID: id,
+		})
+	}
+
+	// 链上确认只能取到网关当前的状态
+	if record.Method == "crypto" {
+		if status, err := ps.crypto.QueryInvoice(ctx, id); err == nil {
+			at := time.Now()
+			if paidAt, err := time.Parse(time.RFC3339, status.PaidAt); err == nil {
+				at = paidAt
+			}
+			entries = append(entries, TimelineEntry{
+				At:        at,
+				Source:    TimelineChain,
+				Event:     "chain." + status.Status,
+				Detail:    fmt.Sprintf("交易 %s，确认数 %d", status.TxHash, status.Confirmations),
+				PaymentID: id,
+			})
+		}
+	}
+
+	for _, delivery := range ps.webhooks.DeliveriesByPayment(id) {
+		detail := delivery.URL
+		if !delivery.Success {
+			detail += "，失败: " + delivery.Error
+		}
+		entries = append(entries, TimelineEntry{
+			At:        delivery.DeliveredAt,
+			Source:    TimelineWebhook,
+			Event:     delivery.Type,
+			Detail:    detail,
+			PaymentID: id,
+		})
+	}
+
+	for _, action := range ps.actions.ListByPayment(id) {
+		entries = append(entries, TimelineEntry{
+			At:        action.At,
+			Source:    TimelineAdmin,
+			Event:     action.Action,
+			Detail:    action.Detail,
+			Actor:     action.Actor,
+			PaymentID: id,
+		})
+	}
+
+	refunds, err := ps.refunds.ListByPayment(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, refund := range refunds {
+		detail := fmt.Sprintf("%s %.2f，去向 %s，状态 %s", refund.RefundID, refund.Amount, refund.Destination, refund.Status)
+		if refund.FailureReason != "" {
+			detail += "，原因: " + refund.FailureReason
+		}
+		entries = append(entries, TimelineEntry{
+			At:        refund.CreatedAt,
+			Source:    TimelineRefund,
+			Event:     "refund." + refund.Status,
+			Detail:    detail,
+			PaymentID: id,
+		})
+	}
+	return entries, nil
+}
+
+// registerTimelineRoutes 注册支付时间线接口，供客服排查工单使用
+func registerTimelineRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	admin := api.Group("/admin")
+
+	admin.GET("/payments/:paymentId/timeline", func(c *gin.Context) {
+		entries, err := ps.Timeline(c.Request.Context(), c.Param("paymentId"))
+		if err == ErrPaymentNotFound {
+			apierr.RespondError(c, http.StatusNotFound, "PAYMENT_NOT_FOUND", err.Error())
+			return
+		}
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, entries)
+	})
+}
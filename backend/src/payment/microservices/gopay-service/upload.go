@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// Uploader 把生成的文件投递到外部存储
+type Uploader interface {
+	Upload(ctx context.Context, name string, content []byte, contentType string) (string, error)
+}
+
+// NewUploader 根据目标地址选择上传方式，支持 s3://bucket/prefix 与 sftp://user@host[:port]/dir
+func NewUploader(target string) (Uploader, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &s3Uploader{
+			bucket:     u.Host,
+			prefix:     strings.Trim(u.Path, "/"),
+			region:     region,
+			endpoint:   os.Getenv("S3_ENDPOINT"),
+			accessKey:  os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:  os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			httpClient: &http.Client{Timeout: 60 * time.Second},
+		}, nil
+	case "sftp":
+		return &sftpUploader{target: u}, nil
+	default:
+		return nil, fmt.Errorf("不支持的上传地址: %s", target)
+	}
+}
+
+// s3Uploader 使用 SigV4 签名的 PutObject；配置 S3_ENDPOINT 时使用路径风格访问兼容存储
+type s3Uploader struct {
+	bucket     string
+	prefix     string
+	region     string
+	endpoint   string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+}
+
+func (s *s3Uploader) Upload(ctx context.Context, name string, content []byte, contentType string) (string, error) {
+	if s.accessKey == "" || s.secretKey == "" {
+		return "", fmt.Errorf("未配置 AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY")
+	}
+
+	key := strings.TrimPrefix(path.Join(s.prefix, name), "/")
+	var target *url.URL
+	if s.endpoint != "" {
+		base, err := url.Parse(s.endpoint)
+		if err != nil {
+			return "", err
+		}
+		target = &url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/" + s.bucket + "/" + key}
+	} else {
+		target = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", s.bucket, s.region), Path: "/" + key}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, content, time.Now().UTC())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("上传 S3 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("上传 S3 失败: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+// sign 按 AWS Signature Version 4 签名请求
+func (s *s3Uploader) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sftpUploader 调用系统 sftp 命令以批处理模式上传，认证依赖部署环境中的 SSH 密钥
+type sftpUploader struct {
+	target *url.URL
+}
+
+func (s *sftpUploader) Upload(ctx context.Context, name string, content []byte, _ string) (string, error) {
+	tmp, err := os.CreateTemp("", "upload-*-"+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	remote := path.Join(s.target.Path, name)
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if port := s.target.Port(); port != "" {
+		args = append(args, "-P", port)
+	}
+	host := s.target.Hostname()
+	if s.target.User != nil {
+		host = s.target.User.Username() + "@" + host
+	}
+	args = append(args, host)
+
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("put %q %q\n", tmp.Name(), remote))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("上传 SFTP 失败: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return fmt.Sprintf("sftp://%s%s", host, remote), nil
+}
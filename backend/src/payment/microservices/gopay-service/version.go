@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gopay-service/internal/apierr"
+	"gopay-service/internal/httpmw"
+)
+
+// 构建信息，由 -ldflags "-X main.version=... -X main.gitSHA=... -X main.buildTime=..." 注入。
+// 未注入时使用 go build 嵌入的 VCS 信息
+var (
+	version   = "dev"
+	gitSHA    = ""
+	buildTime = ""
+)
+
+var startedAt = time.Now()
+
+// BuildInfo 当前运行的版本、构建信息及启用的渠道和功能，用于排查资金差异时确认实际部署的代码
+type BuildInfo struct {
+	Version     string          `json:"version"`
+	GitSHA      string          `json:"gitSha"`
+	BuildTime   string          `json:"buildTime"`
+	GoVersion   string          `json:"goVersion"`
+	Environment string          `json:"environment"`
+	StartedAt   time.Time       `json:"startedAt"`
+	Providers   []string        `json:"providers"`
+	Features    map[string]bool `json:"features"`
+}
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if gitSHA == "" {
+				gitSHA = setting.Value
+			}
+		case "vcs.time":
+			if buildTime == "" {
+				buildTime = setting.Value
+			}
+		}
+	}
+}
+
+// BuildInfo 渠道按当前客户端状态计算，密钥轮换或加载失败会即时反映
+func (ps *PaymentService) BuildInfo() *BuildInfo {
+	providers := []string{"balance", "giftcard"}
+	if ps.aliClient() != nil || ps.mock != nil {
+		providers = append(providers, "alipay")
+	}
+	if ps.wxClient() != nil || ps.mock != nil {
+		providers = append(providers, "wechat")
+	}
+	if ps.stripeClient != nil {
+		providers = append(providers, "stripe")
+	}
+	if os.Getenv("CRYPTO_SERVICE_URL") != "" || ps.mock != nil {
+		providers = append(providers, "crypto")
+	}
+
+	return &BuildInfo{
+		Version:     version,
+		GitSHA:      gitSHA,
+		BuildTime:   buildTime,
+		GoVersion:   runtime.Version(),
+		Environment: currentEnvironment(),
+		StartedAt:   startedAt,
+		Providers:   providers,
+		Features: map[string]bool{
+			"eventBus":        ps.webhooks.bus != nil,
+			"redis":           sharedRedis() != nil,
+			"sqlite":          ps.repo.Driver() == StoreSQLite,
+			"statusCache":     ps.statusCache != nil,
+			"fieldEncryption": os.Getenv("FIELD_ENCRYPTION_KEYS") != "",
+			"syntheticProbe":  os.Getenv("PROBE_ENABLED") == "true",
+			"debugPort":       os.Getenv("DEBUG_ADDR") != "",
+			"mtls":            httpmw.LoadTLSConfig().Enabled(),
+			"mockProviders":   ps.mock != nil,
+			"chaos":           ps.chaos != nil,
+		},
+	}
+}
+
+// registerVersionRoutes 注册版本信息接口，不含任何密钥，供运维和部署流水线核对
+func registerVersionRoutes(r *gin.Engine, ps *PaymentService) {
+	r.GET("/version", func(c *gin.Context) {
+		apierr.RespondOK(c, ps.BuildInfo())
+	})
+}
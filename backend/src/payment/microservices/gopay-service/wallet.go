@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+var ErrInsufficientBalance = errors.New("余额不足")
+
+// WalletAccount 用户储值账户
+type WalletAccount struct {
+	UserID    string    `json:"userId"`
+	Currency  string    `json:"currency"`
+	Balance   float64   `json:"balance"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WalletStore 用户储值余额
+type WalletStore interface {
+	Credit(userID, currency string, amount float64) (*WalletAccount, error)
+	Debit(userID, currency string, amount float64) (*WalletAccount, error)
+	Get(userID, currency string) (*WalletAccount, error)
+	// List 返回用户各币种的账户，按币种排序
+	List(userID string) ([]*WalletAccount, error)
+	// Rename 把用户的全部账户改挂到 to 名下，余额不变，用于删除个人信息
+	Rename(userID, to string) error
+}
+
+type memoryWalletStore struct {
+	mu       sync.Mutex
+	accounts map[string]*WalletAccount
+}
+
+func NewMemoryWalletStore() WalletStore {
+	return &memoryWalletStore{accounts: make(map[string]*WalletAccount)}
+}
+
+func walletKey(userID, currency string) string {
+	return userID + "/" + currency
+}
+
+func (s *memoryWalletStore) Credit(userID, currency string, amount float64) (*WalletAccount, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("入账金额必须大于0")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := walletKey(userID, currency)
+	account, ok := s.accounts[key]
+	if !ok {
+		account = &WalletAccount{UserID: userID, Currency: currency}
+		s.accounts[key] = account
+	}
+	account.Balance = roundAmountIn(account.Balance+amount, currency)
+	account.UpdatedAt = time.Now()
+
+	copied := *account
+	return &copied, nil
+}
+
+// Debit 扣减余额，余额不足时返回 ErrInsufficientBalance
+func (s *memoryWalletStore) Debit(userID, currency string, amount float64) (*WalletAccount, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("扣减金额必须大于0")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[walletKey(userID, currency)]
+	if !ok || toMinorUnitsIn(account.Balance, currency) < toMinorUnitsIn(amount, currency) {
+		return nil, ErrInsufficientBalance
+	}
+	account.Balance = roundAmountIn(account.Balance-amount, currency)
+	account.UpdatedAt = time.Now()
+
+	copied := *account
+	return &copied, nil
+}
+
+func (s *memoryWalletStore) Get(userID, currency string) (*WalletAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if account, ok := s.accounts[walletKey(userID, currency)]; ok {
+		copied := *account
+		return &copied, nil
+	}
+	return &WalletAccount{UserID: userID, Currency: currency}, nil
+}
+
+func (s *memoryWalletStore) List(userID string) ([]*WalletAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var accounts []*WalletAccount
+	for _, account := range s.accounts {
+		if account.UserID == userID {
+			copied := *account
+			accounts = append(accounts, &copied)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Currency < accounts[j].Currency })
+	return accounts, nil
+}
+
+func (s *memoryWalletStore) Rename(userID, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var owned []*WalletAccount
+	for key, account := range s.accounts {
+		if account.UserID == userID {
+			owned = append(owned, account)
+			delete(s.accounts, key)
+		}
+	}
+	for _, account := range owned {
+		account.UserID = to
+		s.accounts[walletKey(to, account.Currency)] = account
+	}
+	return nil
+}
+
+// roundAmount 金额保留两位小数，用于人民币渠道的模拟交易和演示数据；支付记录、余额等按币种舍入，见 roundAmountIn
+func roundAmount(amount float64) float64 {
+	return float64(toMinorUnits(amount)) / 100
+}
+
+type TopUpRequest struct {
+	UserID    string  `json:"userId" binding:"required"`
+	Method    string  `json:"method" binding:"required"` // alipay | wechat
+	Amount    float64 `json:"amount" binding:"required"`
+	Currency  string  `json:"currency"`
+	ReturnURL string  `json:"returnUrl"`
+	NotifyURL string  `json:"notifyUrl"`
+}
+
+// WalletData 余额及流水
+type WalletData struct {
+	*WalletAccount
+	Transactions []LedgerEntry `json:"transactions,omitempty"`
+}
+
+// TopUp 通过现有支付渠道充值，支付成功后记入余额
+func (ps *PaymentService) TopUp(tenantID string, req *TopUpRequest) (*apierr.Response, error) {
+	if req.Method != "alipay" && req.Method != "wechat" {
+		return apierr.ErrorResponse("UNSUPPORTED_METHOD", fmt.Sprintf("不支持的充值方式: %s", req.Method)), nil
+	}
+	if req.Amount <= 0 {
+		return apierr.ErrorResponse("INVALID_PARAMS", "充值金额必须大于0"), nil
+	}
+
+	return ps.CreatePayment(&PaymentRequest{
+		Method:    req.Method,
+		OrderID:   fmt.Sprintf("TOPUP%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		UserID:    req.UserID,
+		TenantID:  tenantID,
+		Purpose:   PurposeTopUp,
+		Amount:    roundAmountIn(req.Amount, req.Currency),
+		Currency:  req.Currency,
+		Subject:   "余额充值",
+		ReturnURL: req.ReturnURL,
+		NotifyURL: req.NotifyURL,
+	})
+}
+
+// creditTopUp 充值到账：借记渠道清算户，贷记用户余额
+func (ps *PaymentService) creditTopUp(record *PaymentRecord) error {
+	account, err := ps.wallets.Credit(record.UserID, record.Currency, record.Amount)
+	if err != nil {
+		return fmt.Errorf("充值入账失败: %w", err)
+	}
+	log.Printf("充值 %s 已到账，用户 %s 当前余额 %.2f", record.PaymentID, record.UserID, account.Balance)
+
+	description := fmt.Sprintf("余额充值 %s", record.PaymentID)
+	return ps.ledger.Post(
+		LedgerEntry{TxnID: record.PaymentID, Account: "clearing:" + record.Method, Direction: Debit, Amount: record.Amount, Currency: record.Currency, Description: description},
+		LedgerEntry{TxnID: record.PaymentID, Account: "wallet:" + record.UserID, Direction: Credit, Amount: record.Amount, Currency: record.Currency, Description: description},
+	)
+}
+
+// payWithBalance 使用储值余额支付，扣款成功即支付完成
+func (ps *PaymentService) payWithBalance(req *PaymentRequest) (*apierr.Response, error) {
+	if req.UserID == "" {
+		return apierr.ErrorResponse("INVALID_PARAMS", "余额支付需要 userId"), nil
+	}
+	if req.Purpose == PurposeTopUp {
+		return apierr.ErrorResponse("INVALID_PARAMS", "不能使用余额充值余额"), nil
+	}
+	if existing, err := ps.store.Get(req.OrderID); err == nil && !(req.activating && existing.Status == StatusScheduled) {
+		return apierr.ErrorResponse("DUPLICATE_ORDER", fmt.Sprintf("订单已存在支付记录: %s", req.OrderID)), nil
+	}
+
+	amount := roundAmountIn(req.Amount, req.Currency)
+	account, err := ps.wallets.Debit(req.UserID, req.Currency, amount)
+	if err != nil {
+		if errors.Is(err, ErrInsufficientBalance) {
+			return apierr.ErrorResponse("INSUFFICIENT_BALANCE", "余额不足"), nil
+		}
+		return nil, err
+	}
+
+	description := fmt.Sprintf("余额支付 %s", req.OrderID)
+	if err := ps.ledger.Post(
+		LedgerEntry{TxnID: req.OrderID, Account: "wallet:" + req.UserID, Direction: Debit, Amount: amount, Currency: req.Currency, Description: description},
+		LedgerEntry{TxnID: req.OrderID, Account: "merchant:sales", Direction: Credit, Amount: amount, Currency: req.Currency, Description: description},
+	); err != nil {
+		return nil, err
+	}
+
+	if err := ps.recordPayment(req, nil); err != nil {
+		return nil, err
+	}
+	record, err := ps.store.Get(req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	record.Status = StatusPaid
+	if err := ps.store.Save(record); err != nil {
+		return nil, err
+	}
+	log.Printf("订单 %s 余额支付成功，用户 %s 剩余余额 %.2f", req.OrderID, req.UserID, account.Balance)
+	ps.afterPaid(record)
+
+	return apierr.SuccessResponse(&PaymentData{
+		PaymentID: req.OrderID,
+		Status:    StatusPaid,
+	}), nil
+}
+
+// registerWalletRoutes 注册储值余额接口
+func registerWalletRoutes(api *gin.RouterGroup, ps *PaymentService) {
+	api.POST("/wallet/topup", func(c *gin.Context) {
+		var req TopUpRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ps.TopUp(tenantFromRequest(c), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		respondMaybeRetry(c, resp)
+	})
+
+	// 余额及流水，currency 为空时查询默认币种账户
+	api.GET("/wallet/:userId", func(c *gin.Context) {
+		userID := c.Param("userId")
+		if !authorizeOwner(c, userID) {
+			return
+		}
+		currency := c.Query("currency")
+
+		account, err := ps.wallets.Get(userID, currency)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+
+		entries, err := ps.ledger.AccountEntries("wallet:" + userID)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		transactions := make([]LedgerEntry, 0, len(entries))
+		for _, e := range entries {
+			if e.Currency == currency {
+				transactions = append(transactions, e)
+			}
+		}
+
+		apierr.RespondOK(c, &WalletData{WalletAccount: account, Transactions: transactions})
+	})
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/pkg/util"
+
+	"gopay-service/internal/apierr"
+)
+
+// 事件类型
+const (
+	EventPaymentPaid             = "payment.paid"
+	EventPaymentClosed           = "payment.closed"
+	EventPaymentPayable          = "payment.payable" // 预约支付已生效，可以引导用户支付
+	EventPaymentActivationFailed = "payment.activation_failed"
+	EventPaymentCompensated      = "payment.compensated"   // 订单拒绝履约，已补偿退款
+	EventPaymentCreated          = "payment.created"       // 异步下单完成
+	EventPaymentCreateFailed     = "payment.create_failed" // 异步下单失败
+	EventDisputeCreated          = "dispute.created"
+	EventDisputeDeadline         = "dispute.deadline_approaching"
+	EventDisputeClosed           = "dispute.closed"
+	EventWebhookVerification     = "webhook.verification"
+)
+
+// 迁移结果
+const (
+	MigrationCompleted  = "completed"
+	MigrationRolledBack = "rolled_back"
+)
+
+var ErrWebhookNotFound = errors.New("Webhook 订阅不存在")
+
+// WebhookSubscription 租户的事件订阅，Events 为空时订阅全部事件
+type WebhookSubscription struct {
+	SubscriptionID string    `json:"subscriptionId"`
+	TenantID       string    `json:"tenantId"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events,omitempty"`
+	Format         string    `json:"format,omitempty"` // legacy 或 cloudevents，为空时使用 WEBHOOK_EVENT_FORMAT
+	Secret         string    `json:"-"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+func (s *WebhookSubscription) subscribes(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookStore Webhook 订阅存储
+type WebhookStore interface {
+	Save(sub *WebhookSubscription) error
+	Get(subscriptionID string) (*WebhookSubscription, error)
+	Delete(subscriptionID string) error
+	ListByTenant(tenantID string) ([]*WebhookSubscription, error)
+}
+
+type memoryWebhookStore struct {
+	mu   sync.RWMutex
+	subs map[string]*WebhookSubscription
+}
+
+func NewMemoryWebhookStore() WebhookStore {
+	return &memoryWebhookStore{subs: make(map[string]*WebhookSubscription)}
+}
+
+func (s *memoryWebhookStore) Save(sub *WebhookSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+	sub.UpdatedAt = now
+
+	copied := *sub
+	s.subs[sub.SubscriptionID] = &copied
+	return nil
+}
+
+func (s *memoryWebhookStore) Get(subscriptionID string) (*WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.subs[subscriptionID]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	copied := *sub
+	return &copied, nil
+}
+
+func (s *memoryWebhookStore) Delete(subscriptionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[subscriptionID]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.subs, subscriptionID)
+	return nil
+}
+
+func (s *memoryWebhookStore) ListByTenant(tenantID string) ([]*WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subs []*WebhookSubscription
+	for _, sub := range s.subs {
+		if sub.TenantID == tenantID {
+			copied := *sub
+			subs = append(subs, &copied)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.After(subs[j].CreatedAt)
+	})
+	return subs, nil
+}
+
+// WebhookEvent 推送给订阅方的事件
+type WebhookEvent struct {
+	EventID   string      `json:"eventId"`
+	Type      string      `json:"type"`
+	TenantID  string      `json:"tenantId"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+
+	subject     string // 关联的支付单号，CloudEvents 格式使用
+	traceParent string
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	Format string   `json:"format"` // legacy | cloudevents
+}
+
+// CreatedWebhook 创建结果，签名密钥仅在创建时返回一次
+type CreatedWebhook struct {
+	*WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type MigrateWebhooksRequest struct {
+	NewBaseURL string `json:"newBaseUrl" binding:"required"`
+	OldBaseURL string `json:"oldBaseUrl"` // 为空时迁移该租户全部订阅
+	Operator   string `json:"operator" binding:"required"`
+}
+
+// WebhookMigrationItem 单个订阅的迁移结果
+type WebhookMigrationItem struct {
+	SubscriptionID string `json:"subscriptionId"`
+	OldURL         string `json:"oldUrl"`
+	NewURL         string `json:"newUrl"`
+	Verified       bool   `json:"verified"`
+	Error          string `json:"error,omitempty"`
+}
+
+// WebhookMigration 一次批量迁移的记录
+type WebhookMigration struct {
+	MigrationID string                 `json:"migrationId"`
+	TenantID    string                 `json:"tenantId"`
+	NewBaseURL  string                 `json:"newBaseUrl"`
+	OldBaseURL  string                 `json:"oldBaseUrl,omitempty"`
+	Operator    string                 `json:"operator"`
+	Status      string                 `json:"status"`
+	Items       []WebhookMigrationItem `json:"items"`
+	CreatedAt   time.Time              `json:"createdAt"`
+}
+
+// WebhookDelivery 一次事件推送的结果
+type WebhookDelivery struct {
+	EventID        string    `json:"eventId"`
+	Type           string    `json:"type"`
+	SubscriptionID string    `json:"subscriptionId"`
+	URL            string    `json:"url"`
+	PaymentID      string    `json:"paymentId,omitempty"`
+	Success        bool      `json:"success"`
+	Error          string    `json:"error,omitempty"`
+	DeliveredAt    time.Time `json:"deliveredAt"`
+}
+
+// maxWebhookDeliveries 内存中保留的最近推送记录数
+const maxWebhookDeliveries = 10000
+
+// WebhookService 管理订阅、推送事件及批量迁移回调地址
+type WebhookService struct {
+	subs       WebhookStore
+	httpClient *http.Client
+
+	defaultFormat   string
+	eventSource     string
+	eventTypePrefix string
+
+	bus      EventBus // 配置事件总线时，全部事件同时以 CloudEvents 格式发布
+	busTopic string
+
+	jobs       *JobQueue // 推送和发布均经任务队列执行，失败按退避重试
+	deliveryMu sync.RWMutex
+	deliveries []WebhookDelivery
+
+	migrationMu sync.Mutex
+	migrations  []*WebhookMigration
+}
+
+func NewWebhookService(jobs *JobRegistry) *WebhookService {
+	return &WebhookService{
+		subs: NewMemoryWebhookStore(),
+		jobs: jobs.Queue("webhooks", JobQueueConfig{
+			Workers:     16,
+			Capacity:    10000,
+			MaxAttempts: 6,
+			Backoff:     10 * time.Second,
+			MaxBackoff:  10 * time.Minute,
+		}),
+		httpClient: &http.Client{Timeout: envDuration("WEBHOOK_TIMEOUT", 10*time.Second)},
+
+		defaultFormat:   envString("WEBHOOK_EVENT_FORMAT", WebhookFormatLegacy),
+		eventSource:     envString("CLOUDEVENTS_SOURCE", "/gopay-service"),
+		eventTypePrefix: envString("CLOUDEVENTS_TYPE_PREFIX", "com.onlinestore."),
+		busTopic:        envString("EVENT_BUS_PAYMENT_TOPIC", "payments.events"),
+	}
+}
+
+// Subscribe 新增订阅
+func (ws *WebhookService) Subscribe(tenantID string, req *CreateWebhookRequest) (*apierr.Response, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+	}
+	if !validWebhookFormat(req.Format) {
+		return apierr.ErrorResponse("INVALID_PARAMS", fmt.Sprintf("不支持的事件格式: %s", req.Format)), nil
+	}
+
+	sub := &WebhookSubscription{
+		SubscriptionID: fmt.Sprintf("WH%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		TenantID:       tenantID,
+		URL:            req.URL,
+		Events:         req.Events,
+		Format:         req.Format,
+		Secret:         util.RandomString(32),
+	}
+	if err := ws.subs.Save(sub); err != nil {
+		return nil, err
+	}
+	return apierr.SuccessResponse(&CreatedWebhook{WebhookSubscription: sub, Secret: sub.Secret}), nil
+}
+
+// Emit 异步推送事件给租户下订阅了该事件的地址，支付事件同时推送给该笔支付下单时追加的地址。
+// 每个地址一个任务，失败按退避重试，重试耗尽后进入 webhooks 队列的死信
+func (ws *WebhookService) Emit(tenantID, eventType string, data interface{}) {
+	if tenantID == "" {
+		tenantID = defaultTenantID
+	}
+	subs, err := ws.subs.ListByTenant(tenantID)
+	if err != nil {
+		log.Printf("加载 Webhook 订阅失败 %s: %v", tenantID, err)
+		return
+	}
+	if record := eventPaymentRecord(data); record != nil {
+		for i := range record.Webhooks {
+			subs = append(subs, record.Webhooks[i].subscription(tenantID))
+		}
+	}
+
+	event := &WebhookEvent{
+		EventID:   fmt.Sprintf("EV%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		Type:      eventType,
+		TenantID:  tenantID,
+		CreatedAt: time.Now(),
+		Data:      data,
+
+		subject:     eventPaymentID(data),
+		traceParent: newTraceParent(),
+	}
+	if ws.bus != nil {
+		job := NewJob("event.publish", event.subject, func(context.Context) error {
+			return ws.publish(event)
+		})
+		if err := ws.jobs.Submit(job); err != nil {
+			log.Printf("发布事件 %s 到 %s 失败: %v", event.Type, ws.busTopic, err)
+		}
+	}
+	for _, sub := range subs {
+		if !sub.subscribes(eventType) {
+			continue
+		}
+		sub := sub
+		job := NewJob("webhook.deliver", event.subject, func(ctx context.Context) error {
+			_, err := ws.deliver(ctx, sub, sub.URL, event)
+			ws.logDelivery(event, sub, event.subject, err)
+			return err
+		})
+		if err := ws.jobs.Submit(job); err != nil {
+			log.Printf("推送事件 %s 到 %s 失败: %v", event.Type, sub.URL, err)
+			ws.logDelivery(event, sub, event.subject, err)
+		}
+	}
+}
+
+// publish 把事件以 CloudEvents 格式发布到事件总线，按支付单号分区保证同一支付的事件有序；失败时由任务队列重试
+func (ws *WebhookService) publish(event *WebhookEvent) error {
+	body, contentType, err := ws.encodeEvent(WebhookFormatCloudEvents, event)
+	if err != nil {
+		return PermanentJobError(fmt.Errorf("序列化事件 %s 失败: %w", event.EventID, err))
+	}
+	key := event.subject
+	if key == "" {
+		key = event.TenantID
+	}
+	return ws.bus.Publish(context.Background(), BusMessage{
+		Topic: ws.busTopic,
+		Key:   key,
+		Value: body,
+		Headers: map[string]string{
+			"content-type": contentType,
+			"ce_type":      ws.eventTypePrefix + event.Type,
+			"traceparent":  event.traceParent,
+		},
+	})
+}
+
+// eventPaymentRecord 取出事件数据中的支付记录，用于投递本笔支付的回调地址
+func eventPaymentRecord(data interface{}) *PaymentRecord {
+	switch v := data.(type) {
+	case *PaymentRecord:
+		return v
+	case *PayablePayment:
+		return v.PaymentRecord
+	}
+	return nil
+}
+
+// eventPaymentID 事件关联的支付单号
+func eventPaymentID(data interface{}) string {
+	switch v := data.(type) {
+	case *PaymentRecord:
+		return v.PaymentID
+	case *PayablePayment:
+		return v.PaymentID
+	case *Dispute:
+		return v.PaymentID
+	}
+	return ""
+}
+
+func (ws *WebhookService) logDelivery(event *WebhookEvent, sub *WebhookSubscription, paymentID string, err error) {
+	delivery := WebhookDelivery{
+		EventID:        event.EventID,
+		Type:           event.Type,
+		SubscriptionID: sub.SubscriptionID,
+		URL:            sub.URL,
+		PaymentID:      paymentID,
+		Success:        err == nil,
+		DeliveredAt:    time.Now(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	ws.deliveryMu.Lock()
+	defer ws.deliveryMu.Unlock()
+	ws.deliveries = append(ws.deliveries, delivery)
+	if len(ws.deliveries) > maxWebhookDeliveries {
+		ws.deliveries = append([]WebhookDelivery(nil), ws.deliveries[len(ws.deliveries)-maxWebhookDeliveries:]...)
+	}
+}
+
+// WebhookBacklog 推送积压情况
+type WebhookBacklog struct {
+	InFlight       int `json:"inFlight"` // 待投递、退避重试中和正在投递的任务数
+	FailedLastHour int `json:"failedLastHour"`
+}
+
+// Backlog 返回尚未投递完成的任务数和最近一小时失败的推送次数
+func (ws *WebhookService) Backlog() WebhookBacklog {
+	backlog := WebhookBacklog{InFlight: ws.jobs.Stats().Backlog()}
+	since := time.Now().Add(-time.Hour)
+
+	ws.deliveryMu.RLock()
+	defer ws.deliveryMu.RUnlock()
+	for i := len(ws.deliveries) - 1; i >= 0 && ws.deliveries[i].DeliveredAt.After(since); i-- {
+		if !ws.deliveries[i].Success {
+			backlog.FailedLastHour++
+		}
+	}
+	return backlog
+}
+
+// DeliveriesByPayment 返回与支付相关的推送记录
+func (ws *WebhookService) DeliveriesByPayment(paymentID string) []WebhookDelivery {
+	ws.deliveryMu.RLock()
+	defer ws.deliveryMu.RUnlock()
+
+	var deliveries []WebhookDelivery
+	for _, d := range ws.deliveries {
+		if d.PaymentID == paymentID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries
+}
+
+// deliver 按订阅的格式发送一次事件到 target，签名为 HMAC-SHA256(secret, timestamp + "." + body)
+func (ws *WebhookService) deliver(ctx context.Context, sub *WebhookSubscription, target string, event *WebhookEvent) ([]byte, error) {
+	body, contentType, err := ws.encodeEvent(sub.Format, event)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(sub.Secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if event.traceParent != "" {
+		httpReq.Header.Set("traceparent", event.traceParent)
+	}
+	httpReq.Header.Set("X-Webhook-Timestamp", timestamp)
+	httpReq.Header.Set("X-Webhook-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := ws.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respBody, fmt.Errorf("订阅方返回状态码 %d", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+// verify 握手校验：向新地址发送随机 challenge，订阅方须原样回显
+func (ws *WebhookService) verify(sub *WebhookSubscription, target string) error {
+	challenge := util.RandomString(32)
+	body, err := ws.deliver(context.Background(), sub, target, &WebhookEvent{
+		EventID:   fmt.Sprintf("EV%d%s", time.Now().UnixNano(), util.RandomNumber(4)),
+		Type:      EventWebhookVerification,
+		TenantID:  sub.TenantID,
+		CreatedAt: time.Now(),
+		Data:      map[string]string{"challenge": challenge},
+	})
+	if err != nil {
+		return err
+	}
+
+	var echo struct {
+		Challenge string `json:"challenge"`
+	}
+	if json.Unmarshal(body, &echo) == nil && echo.Challenge == challenge {
+		return nil
+	}
+	if strings.TrimSpace(string(body)) == challenge {
+		return nil
+	}
+	return fmt.Errorf("订阅方未回显 challenge")
+}
+
+// Migrate 把租户的订阅迁移到新的基础地址，逐个握手校验后切换；任一失败则回滚已切换的订阅
+func (ws *WebhookService) Migrate(tenantID string, req *MigrateWebhooksRequest) (*apierr.Response, error) {
+	if err := validateWebhookURL(req.NewBaseURL); err != nil {
+		return apierr.ErrorResponse("INVALID_PARAMS", err.Error()), nil
+	}
+
+	ws.migrationMu.Lock()
+	defer ws.migrationMu.Unlock()
+
+	subs, err := ws.subs.ListByTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	migration := &WebhookMigration{
+		MigrationID: fmt.Sprintf("WM%d", time.Now().UnixNano()),
+		TenantID:    tenantID,
+		NewBaseURL:  req.NewBaseURL,
+		OldBaseURL:  req.OldBaseURL,
+		Operator:    req.Operator,
+		Status:      MigrationCompleted,
+		CreatedAt:   time.Now(),
+	}
+
+	var switched []*WebhookSubscription
+	for _, sub := range subs {
+		if req.OldBaseURL != "" && !strings.HasPrefix(sub.URL, req.OldBaseURL) {
+			continue
+		}
+		item := WebhookMigrationItem{SubscriptionID: sub.SubscriptionID, OldURL: sub.URL}
+
+		newURL, err := rebaseURL(sub.URL, req.OldBaseURL, req.NewBaseURL)
+		if err == nil {
+			item.NewURL = newURL
+			err = ws.verify(sub, newURL)
+		}
+		if err == nil {
+			item.Verified = true
+			original := *sub
+			sub.URL = newURL
+			if err = ws.subs.Save(sub); err == nil {
+				switched = append(switched, &original)
+			}
+		}
+
+		if err != nil {
+			item.Error = err.Error()
+			migration.Items = append(migration.Items, item)
+			migration.Status = MigrationRolledBack
+			break
+		}
+		migration.Items = append(migration.Items, item)
+	}
+
+	if migration.Status == MigrationRolledBack {
+		for _, original := range switched {
+			if err := ws.subs.Save(original); err != nil {
+				log.Printf("【警告】回滚 Webhook 订阅 %s 失败，需人工处理: %v", original.SubscriptionID, err)
+			}
+		}
+		log.Printf("租户 %s 的 Webhook 迁移校验失败，已回滚 %d 个订阅", tenantID, len(switched))
+	} else {
+		log.Printf("租户 %s 的 %d 个 Webhook 订阅已迁移到 %s，操作人 %s", tenantID, len(switched), req.NewBaseURL, req.Operator)
+	}
+
+	ws.migrations = append(ws.migrations, migration)
+	return apierr.SuccessResponse(migration), nil
+}
+
+// Migrations 返回租户的迁移记录，最新的在前
+func (ws *WebhookService) Migrations(tenantID string) []*WebhookMigration {
+	ws.migrationMu.Lock()
+	defer ws.migrationMu.Unlock()
+
+	var result []*WebhookMigration
+	for i := len(ws.migrations) - 1; i >= 0; i-- {
+		if ws.migrations[i].TenantID == tenantID {
+			result = append(result, ws.migrations[i])
+		}
+	}
+	return result
+}
+
+// rebaseURL 替换地址前缀；未指定旧前缀时替换协议和主机，保留路径与查询参数
+func rebaseURL(current, oldBase, newBase string) (string, error) {
+	if oldBase != "" {
+		return strings.TrimSuffix(newBase, "/") + "/" + strings.TrimPrefix(strings.TrimPrefix(current, oldBase), "/"), nil
+	}
+
+	cur, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	base, err := url.Parse(newBase)
+	if err != nil {
+		return "", err
+	}
+	cur.Scheme = base.Scheme
+	cur.Host = base.Host
+	cur.Path = strings.TrimSuffix(base.Path, "/") + cur.Path
+	return cur.String(), nil
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("无效的回调地址: %s", raw)
+	}
+	return nil
+}
+
+// registerWebhookRoutes 注册 Webhook 订阅及迁移接口
+func registerWebhookRoutes(api *gin.RouterGroup, ws *WebhookService) {
+	api.POST("/webhooks", func(c *gin.Context) {
+		var req CreateWebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		tenantID, err := tenantFromToken(c)
+		if err != nil {
+			apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", err.Error())
+			return
+		}
+
+		resp, err := ws.Subscribe(tenantID, &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	api.GET("/webhooks", func(c *gin.Context) {
+		tenantID, err := tenantFromToken(c)
+		if err != nil {
+			apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", err.Error())
+			return
+		}
+		subs, err := ws.subs.ListByTenant(tenantID)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, subs)
+	})
+
+	api.DELETE("/webhooks/:subscriptionId", func(c *gin.Context) {
+		tenantID, err := tenantFromToken(c)
+		if err != nil {
+			apierr.RespondError(c, http.StatusForbidden, "FORBIDDEN", err.Error())
+			return
+		}
+		sub, err := ws.subs.Get(c.Param("subscriptionId"))
+		if err != nil || sub.TenantID != tenantID {
+			apierr.RespondError(c, http.StatusNotFound, "WEBHOOK_NOT_FOUND", ErrWebhookNotFound.Error())
+			return
+		}
+		if err := ws.subs.Delete(sub.SubscriptionID); err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		apierr.RespondOK(c, sub)
+	})
+
+	admin := api.Group("/admin")
+
+	admin.POST("/tenants/:tenantId/webhooks/migrate", func(c *gin.Context) {
+		var req MigrateWebhooksRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierr.RespondError(c, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+			return
+		}
+
+		resp, err := ws.Migrate(c.Param("tenantId"), &req)
+		if err != nil {
+			apierr.RespondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.GET("/tenants/:tenantId/webhooks/migrations", func(c *gin.Context) {
+		apierr.RespondOK(c, ws.Migrations(c.Param("tenantId")))
+	})
+}